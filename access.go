@@ -0,0 +1,351 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Access Tracking
+
+// RecordAccessTimes
+//
+//	Record the last access sampled for each key prefix in the system keyspace, returning the prefixes recorded.
+//	A prefix is only written when its sampled access is after the access already recorded, so recording an idle instance commits nothing.
+//	Last access is only tracked with AccessPrefixLength, and followers record nothing, since their system keyspace is written by the leader.
+func (mariInst *Mari) RecordAccessTimes() (int, error) {
+	tracker := mariInst.accessTracker
+	if tracker == nil || atomic.LoadUint32(&mariInst.isFollower) == 1 {
+		return 0, nil
+	}
+
+	accessed := tracker.snapshot()
+	if len(accessed) == 0 {
+		return 0, nil
+	}
+
+	var recorded int
+	updateErr := mariInst.UpdateTx(func(tx *Tx) error {
+		recorded = 0
+
+		for prefix, lastAccess := range accessed {
+			kvPair, getErr := tx.GetSystem(AccessBucket, []byte(prefix))
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil && len(kvPair.Value) == 8 && int64(binary.BigEndian.Uint64(kvPair.Value)) >= lastAccess {
+				continue
+			}
+
+			sLastAccess := make([]byte, 8)
+			binary.BigEndian.PutUint64(sLastAccess, uint64(lastAccess))
+
+			putErr := tx.PutSystem(AccessBucket, []byte(prefix), sLastAccess)
+			if putErr != nil {
+				return putErr
+			}
+
+			recorded++
+		}
+
+		return nil
+	})
+
+	if updateErr != nil {
+		return 0, updateErr
+	}
+
+	return recorded, nil
+}
+
+// AccessTimes
+//
+//	Get the last access of every key prefix, recorded by RecordAccessTimes or sampled since, ordered by prefix.
+//	The recorded times are read even if the instance was opened without AccessPrefixLength.
+func (mariInst *Mari) AccessTimes() ([]*PrefixAccess, error) {
+	var accesses []*PrefixAccess
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		lastAccesses, loadErr := tx.loadAccessTimes()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		accesses = make([]*PrefixAccess, 0, len(lastAccesses))
+		for prefix, lastAccess := range lastAccesses {
+			accesses = append(accesses, &PrefixAccess{Prefix: []byte(prefix), LastAccess: time.Unix(lastAccess, 0)})
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	slices.SortFunc(accesses, func(first, second *PrefixAccess) int {
+		return bytes.Compare(first.Prefix, second.Prefix)
+	})
+
+	return accesses, nil
+}
+
+// AccessReport
+//
+//	Report the key prefixes with keys accessed within a window and the prefixes unused for as long, with the keys stored under each.
+//	Prefixes are counted like TopPrefixes with a depth of AccessPrefixLength, so keys shorter than the prefix length are not reported, and prefixes of reserved keys are left out.
+//	A prefix with no access recorded or sampled is unused. Since accesses are sampled, a prefix accessed rarely can be reported unused, so the window should be much longer than the time between its accesses.
+//	Last access is only tracked with AccessPrefixLength, so without it nil is returned.
+func (mariInst *Mari) AccessReport(window time.Duration) (*AccessReport, error) {
+	tracker := mariInst.accessTracker
+	if tracker == nil {
+		return nil, nil
+	}
+
+	cutoff := time.Now().Add(-window).Unix()
+	report := &AccessReport{}
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		lastAccesses, loadErr := tx.loadAccessTimes()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		prefixCounts, topErr := tx.TopPrefixes(tracker.prefixLength, math.MaxInt)
+		if topErr != nil {
+			return topErr
+		}
+
+		for _, prefixCount := range prefixCounts {
+			if isReservedKey(prefixCount.Prefix) || bytes.HasPrefix(ReservedKeyPrefix, prefixCount.Prefix) {
+				continue
+			}
+
+			access := &PrefixAccess{Prefix: prefixCount.Prefix, Keys: prefixCount.Count}
+			lastAccess, ok := lastAccesses[string(prefixCount.Prefix)]
+			if ok {
+				access.LastAccess = time.Unix(lastAccess, 0)
+			}
+
+			if ok && lastAccess >= cutoff {
+				report.Active = append(report.Active, access)
+				report.ActiveKeys += access.Keys
+				continue
+			}
+
+			report.Unused = append(report.Unused, access)
+			report.UnusedKeys += access.Keys
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return report, nil
+}
+
+// handleAccess
+//
+//	Record the sampled last access times on the access record interval until the instance is closed.
+//	Accesses sampled since the last interval are not recorded on close.
+func (mariInst *Mari) handleAccess() {
+	defer mariInst.workers.Done()
+
+	ticker := time.NewTicker(mariInst.accessTracker.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			_, recordErr := mariInst.RecordAccessTimes()
+			if recordErr != nil {
+				mariInst.logger.Warn("error recording access times", "error", recordErr)
+			}
+		}
+	}
+}
+
+// openAccessTracker
+//
+//	Start tracking the last access of key prefixes with AccessPrefixLength, loading the access times recorded before the instance was opened.
+func (mariInst *Mari) openAccessTracker(opts InitOpts) error {
+	if opts.AccessPrefixLength == nil || *opts.AccessPrefixLength <= 0 {
+		return nil
+	}
+
+	tracker := &accessTracker{
+		accessed:     make(map[string]int64),
+		prefixLength: *opts.AccessPrefixLength,
+		sampleRate:   DefaultAccessSampleRate,
+		interval:     DefaultAccessRecordInterval,
+	}
+
+	if opts.AccessSampleRate != nil {
+		tracker.sampleRate = *opts.AccessSampleRate
+	}
+
+	if opts.AccessRecordInterval != nil && *opts.AccessRecordInterval > 0 {
+		tracker.interval = *opts.AccessRecordInterval
+	}
+
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		var loadErr error
+		tracker.recorded, loadErr = tx.loadRecordedAccessTimes()
+		return loadErr
+	})
+
+	if readErr != nil {
+		return readErr
+	}
+
+	mariInst.accessTracker = tracker
+	return nil
+}
+
+// loadAccessTimes
+//
+//	Load the last access times recorded in the system keyspace, merged with the times sampled since they were recorded, in unix seconds by prefix.
+func (tx *Tx) loadAccessTimes() (map[string]int64, error) {
+	lastAccesses, loadErr := tx.loadRecordedAccessTimes()
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	for prefix, lastAccess := range tx.store.accessTracker.snapshot() {
+		lastAccesses[prefix] = max(lastAccesses[prefix], lastAccess)
+	}
+
+	return lastAccesses, nil
+}
+
+// loadRecordedAccessTimes
+//
+//	Load the last access times recorded in the system keyspace, in unix seconds by prefix.
+func (tx *Tx) loadRecordedAccessTimes() (map[string]int64, error) {
+	recorded, rangeErr := tx.RangeSystem(AccessBucket)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	lastAccesses := make(map[string]int64, len(recorded))
+	for _, kvPair := range recorded {
+		if len(kvPair.Value) != 8 {
+			continue
+		}
+
+		lastAccesses[string(kvPair.Key)] = int64(binary.BigEndian.Uint64(kvPair.Value))
+	}
+
+	return lastAccesses, nil
+}
+
+// track
+//
+//	Sample an access of a key, recording the current time as the last access of its prefix.
+func (tracker *accessTracker) track(key []byte) {
+	if tracker == nil || !tracker.sample() {
+		return
+	}
+
+	tracker.record(time.Now().Unix(), key)
+}
+
+// trackPairs
+//
+//	Sample an access of the keys returned by a scan, recording the current time as the last access of each of their prefixes.
+//	The scan is sampled as a whole, so a scan over many keys is not more likely to be recorded.
+func (tracker *accessTracker) trackPairs(kvPairs []*KeyValuePair) {
+	if tracker == nil || len(kvPairs) == 0 || !tracker.sample() {
+		return
+	}
+
+	keys := make([][]byte, len(kvPairs))
+	for idx, kvPair := range kvPairs {
+		keys[idx] = kvPair.Key
+	}
+
+	tracker.record(time.Now().Unix(), keys...)
+}
+
+// trackWrites
+//
+//	Sample the writes of a commit, recording the current time as the last access of the prefix of each key written.
+func (tracker *accessTracker) trackWrites(writeSet []*txWrite) {
+	if tracker == nil || len(writeSet) == 0 || !tracker.sample() {
+		return
+	}
+
+	keys := make([][]byte, len(writeSet))
+	for idx, write := range writeSet {
+		keys[idx] = write.key
+	}
+
+	tracker.record(time.Now().Unix(), keys...)
+}
+
+// sample
+//
+//	Determine whether an access is sampled, with the probability of the sample rate.
+func (tracker *accessTracker) sample() bool {
+	return tracker.sampleRate > 0 && (tracker.sampleRate >= 1 || rand.Float64() < tracker.sampleRate)
+}
+
+// record
+//
+//	Record the last access of the prefixes of keys.
+//	Reserved keys and keys shorter than the prefix length are skipped, and once AccessMaxPrefixes prefixes are tracked, accesses of prefixes not already tracked are dropped.
+func (tracker *accessTracker) record(now int64, keys ...[]byte) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	for _, key := range keys {
+		if len(key) < tracker.prefixLength || isReservedKey(key) {
+			continue
+		}
+
+		prefix := key[:tracker.prefixLength]
+		if _, ok := tracker.accessed[string(prefix)]; !ok && len(tracker.accessed) >= AccessMaxPrefixes {
+			continue
+		}
+
+		tracker.accessed[string(prefix)] = now
+	}
+}
+
+// recordedSince
+//
+//	Determine whether the last access of the prefix of a key recorded before the instance was opened is at or after a time.
+func (tracker *accessTracker) recordedSince(key []byte, since time.Time) bool {
+	if tracker == nil || len(key) < tracker.prefixLength {
+		return false
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	lastAccess, ok := tracker.recorded[string(key[:tracker.prefixLength])]
+	return ok && lastAccess >= since.Unix()
+}
+
+// snapshot
+//
+//	Copy the last access sampled for each prefix since the instance was opened.
+func (tracker *accessTracker) snapshot() map[string]int64 {
+	if tracker == nil {
+		return nil
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	return maps.Clone(tracker.accessed)
+}
@@ -0,0 +1,94 @@
+package mariv2
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Adaptive Sync
+
+// newAdaptiveSync
+//
+//	Create the latency window for FlushStrategyAdaptive, starting with per-commit syncs.
+func newAdaptiveSync(target time.Duration) *adaptiveSync {
+	return &adaptiveSync{target: target, samples: make([]time.Duration, 0, AdaptiveSyncWindow)}
+}
+
+// isGrouped
+//
+//	Determine if commits are currently grouped and synced by the dirty pages go routine, instead of synced individually.
+func (adaptive *adaptiveSync) isGrouped() bool {
+	return atomic.LoadUint32(&adaptive.grouped) == 1
+}
+
+// record
+//
+//	Add the latency of a sync to the window, and switch modes once the window has enough samples.
+//	Per-commit syncs switch to grouped syncs when the p99 latency exceeds the target.
+//	Grouped syncs switch back when the p99 latency falls under half the target, so the mode does not flap around the target.
+//	The window is cleared on a switch, since latencies from one mode do not predict the other.
+func (adaptive *adaptiveSync) record(latency time.Duration) {
+	adaptive.lock.Lock()
+	defer adaptive.lock.Unlock()
+
+	if len(adaptive.samples) < AdaptiveSyncWindow {
+		adaptive.samples = append(adaptive.samples, latency)
+	} else {
+		adaptive.samples[adaptive.next] = latency
+	}
+
+	adaptive.next = (adaptive.next + 1) % AdaptiveSyncWindow
+	if len(adaptive.samples) < AdaptiveSyncMinSamples {
+		return
+	}
+
+	p99 := adaptive.percentile(0.99)
+	grouped := adaptive.isGrouped()
+
+	switch {
+	case !grouped && p99 > adaptive.target:
+		atomic.StoreUint32(&adaptive.grouped, 1)
+	case grouped && p99 < adaptive.target/2:
+		atomic.StoreUint32(&adaptive.grouped, 0)
+	default:
+		return
+	}
+
+	adaptive.samples = adaptive.samples[:0]
+	adaptive.next = 0
+}
+
+// p99
+//
+//	Get the p99 latency of the samples in the window.
+func (adaptive *adaptiveSync) p99() time.Duration {
+	adaptive.lock.Lock()
+	defer adaptive.lock.Unlock()
+
+	return adaptive.percentile(0.99)
+}
+
+// percentile
+//
+//	Get the latency at the percentile of the samples in the window. The caller must hold the lock.
+func (adaptive *adaptiveSync) percentile(percentile float64) time.Duration {
+	if len(adaptive.samples) == 0 {
+		return 0
+	}
+
+	sorted := slices.Clone(adaptive.samples)
+	slices.Sort(sorted)
+	return sorted[int(float64(len(sorted)-1)*percentile)]
+}
+
+// recordSyncLatency
+//
+//	With FlushStrategyAdaptive, record the latency of a sync that started at the start time.
+func (mariInst *Mari) recordSyncLatency(start time.Time) {
+	if mariInst.flushStrategy != FlushStrategyAdaptive {
+		return
+	}
+
+	mariInst.adaptive.record(time.Since(start))
+}
@@ -0,0 +1,271 @@
+package mariv2
+
+import (
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+//============================================= Mari Admin
+
+// adminTemplate is the single page of the admin UI
+var adminTemplate = template.Must(template.New("admin").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mari {{.Instance}}</title>
+<style>
+body { font-family: monospace; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>mari {{.Instance}}</h1>
+
+<h2>lookup</h2>
+<form method="get" action="">
+<input name="key" value="{{.Key}}" size="64"> <input type="submit" value="get">
+</form>
+{{if .LookupErr}}<p class="error">{{.LookupErr}}</p>{{end}}
+{{with .Lookup}}<table>
+<tr><th>key</th><td>{{.Key}}</td></tr>
+<tr><th>version</th><td>{{.Version}}</td></tr>
+<tr><th>timestamp</th><td>{{.Timestamp}}</td></tr>
+<tr><th>size</th><td>{{.Size}}</td></tr>
+<tr><th>value</th><td><pre>{{.Value}}</pre>{{if .Truncated}}(truncated){{end}}</td></tr>
+</table>{{else}}{{if .Key}}{{if not .LookupErr}}<p>key not found</p>{{end}}{{end}}{{end}}
+
+<h2>stats</h2>
+{{if .StatsErr}}<p class="error">{{.StatsErr}}</p>{{else}}<pre>{{.Stats}}</pre>{{end}}
+
+<h2>versions</h2>
+{{if .VersionsErr}}<p class="error">{{.VersionsErr}}</p>{{else}}<table>
+<tr><th>version</th><th>timestamp</th><th>root offset</th><th>size</th><th>readers</th><th>iterators</th></tr>
+{{range .Versions}}<tr><td>{{.Version}}</td><td>{{.Timestamp}}</td><td>{{.RootOffset}}</td><td>{{.Size}}</td><td>{{.Readers}}</td><td>{{.Iterators}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>prefixes of length {{.Depth}}</h2>
+{{if .PrefixesErr}}<p class="error">{{.PrefixesErr}}</p>{{else}}<table>
+<tr><th>prefix</th><th>keys</th></tr>
+{{range .Prefixes}}<tr><td>{{.Prefix}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>slow transactions</h2>
+<table>
+<tr><th>finished</th><th>op</th><th>duration</th><th>version</th><th>retries</th></tr>
+{{range .SlowOps}}<tr><td>{{.FinishedAt.Format "2006-01-02T15:04:05.000Z07:00"}}</td><td>{{.Op}}</td><td>{{.Duration}}</td><td>{{.Version}}</td><td>{{.Retries}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// adminPage is the data rendered by the admin template
+type adminPage struct {
+	Instance    string
+	Key         string
+	Lookup      *adminLookup
+	LookupErr   error
+	Stats       string
+	StatsErr    error
+	Versions    []VersionInfo
+	VersionsErr error
+	Depth       int
+	Prefixes    []adminPrefix
+	PrefixesErr error
+	SlowOps     []*SlowOp
+}
+
+// adminLookup is a key-value pair found by a lookup in the admin UI
+type adminLookup struct {
+	Key       string
+	Version   uint64
+	Timestamp uint64
+	Size      int
+	Value     string
+	Truncated bool
+}
+
+// adminPrefix is a key prefix and its total keys in the admin UI
+type adminPrefix struct {
+	Prefix string
+	Count  int
+}
+
+// AdminHandler
+//
+//	Get a read-only http handler serving a small web UI for debugging an embedded instance without shelling into its host.
+//	The page at the root shows the stats, the latest AdminVersions retained versions, the AdminTopPrefixes key prefixes with the most keys, and the slow transactions, and looks up the key in the key query parameter.
+//	The length of the prefixes defaults to AdminPrefixDepth, and can be changed with the depth query parameter, up to AdminMaxPrefixDepth.
+//	The stats are also served as JSON at /stats.json, for scripts.
+//	Only GET and HEAD are accepted, every read is a read only transaction, and nothing is written, but keys and values are exposed, so the handler should only be reachable by operators.
+func (mariInst *Mari) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", mariInst.serveAdminPage)
+	mux.HandleFunc("GET /stats.json", mariInst.serveAdminStats)
+	return mux
+}
+
+// ServeAdmin
+//
+//	Serve the admin UI of AdminHandler on the listener.
+//	Blocks until the listener is closed, then returns nil.
+func (mariInst *Mari) ServeAdmin(listener net.Listener) error {
+	server := &http.Server{Handler: mariInst.AdminHandler(), ReadHeaderTimeout: AdminReadHeaderTimeout}
+	serveErr := server.Serve(listener)
+	if errors.Is(serveErr, net.ErrClosed) {
+		return nil
+	}
+
+	return serveErr
+}
+
+// SlowOps
+//
+//	Get the most recent transactions that ran past their warning thresholds, up to MaxSlowOps, newest first.
+//	Read only transactions are recorded past ReadTxWarnThreshold, and read-write transactions retrying on contention past ContentionWarnThreshold.
+func (mariInst *Mari) SlowOps() []*SlowOp {
+	return mariInst.slowOps.list()
+}
+
+// serveAdminPage
+//
+//	Render the admin page. A section that fails to load shows its error instead of failing the page, so the rest is still shown while the instance is unhealthy.
+func (mariInst *Mari) serveAdminPage(w http.ResponseWriter, r *http.Request) {
+	page := &adminPage{Instance: mariInst.instanceLabel, Key: r.URL.Query().Get("key"), Depth: AdminPrefixDepth, SlowOps: mariInst.SlowOps()}
+	if depth, parseErr := strconv.Atoi(r.URL.Query().Get("depth")); parseErr == nil && depth > 0 {
+		page.Depth = min(depth, AdminMaxPrefixDepth)
+	}
+
+	stats, statsErr := mariInst.Stats()
+	if statsErr != nil {
+		page.StatsErr = statsErr
+	} else {
+		page.Stats = stats.String()
+	}
+
+	versions, versionsErr := mariInst.Versions()
+	page.VersionsErr = versionsErr
+	slices.Reverse(versions)
+	page.Versions = versions[:min(len(versions), AdminVersions)]
+
+	page.PrefixesErr = mariInst.ReadTx(func(tx *Tx) error {
+		prefixes, topErr := tx.TopPrefixes(page.Depth, AdminTopPrefixes)
+		if topErr != nil {
+			return topErr
+		}
+
+		for _, prefix := range prefixes {
+			page.Prefixes = append(page.Prefixes, adminPrefix{Prefix: printableKey(prefix.Prefix), Count: prefix.Count})
+		}
+
+		return nil
+	})
+
+	if page.Key != "" {
+		page.LookupErr = mariInst.ReadTx(func(tx *Tx) error {
+			kvPair, getErr := tx.getAdmin(mariInst.normalizeKey([]byte(page.Key)))
+			if getErr != nil || kvPair == nil {
+				return getErr
+			}
+
+			page.Lookup = &adminLookup{Key: printableKey(kvPair.Key), Version: kvPair.Version, Timestamp: kvPair.Timestamp, Size: len(kvPair.Value)}
+			value := kvPair.Value
+			if len(value) > AdminMaxValueSize {
+				value, page.Lookup.Truncated = value[:AdminMaxValueSize], true
+			}
+
+			page.Lookup.Value = printableKey(value)
+			return nil
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	renderErr := adminTemplate.Execute(w, page)
+	if renderErr != nil {
+		mariInst.logger.Warn("error rendering admin page", "error", renderErr)
+	}
+}
+
+// getAdmin
+//
+//	Look up a key for the admin page with the transforms registered with the instance applied, treating it as missing if its ttl has elapsed.
+//	Unlike Get, the read is not recorded in the hot set, tiering, or access tracker, and does not fill the value cache, so browsing the admin page does not change the stats it shows.
+func (tx *Tx) getAdmin(key []byte) (*KeyValuePair, error) {
+	kvPair, getErr := tx.get(key)
+	if getErr != nil || kvPair == nil {
+		return nil, getErr
+	}
+
+	expired, expireErr := tx.isExpired(key)
+	if expireErr != nil || expired {
+		return nil, expireErr
+	}
+
+	return tx.store.readTransform(nil)(kvPair), nil
+}
+
+// serveAdminStats
+//
+//	Write the stats as JSON.
+func (mariInst *Mari) serveAdminStats(w http.ResponseWriter, r *http.Request) {
+	stats, statsErr := mariInst.Stats()
+	if statsErr != nil {
+		http.Error(w, statsErr.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	sStats, marshalErr := stats.MarshalJSON()
+	if marshalErr != nil {
+		http.Error(w, marshalErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(sStats)
+}
+
+// record
+//
+//	Record a slow transaction, dropping the oldest once MaxSlowOps are recorded.
+func (ring *slowOps) record(op *SlowOp) {
+	if ring == nil {
+		return
+	}
+
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+
+	if len(ring.ops) < MaxSlowOps {
+		ring.ops = append(ring.ops, op)
+	} else {
+		ring.ops[ring.next] = op
+	}
+
+	ring.next = (ring.next + 1) % MaxSlowOps
+}
+
+// list
+//
+//	Get the recorded slow transactions, newest first.
+func (ring *slowOps) list() []*SlowOp {
+	if ring == nil {
+		return nil
+	}
+
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+
+	ops := make([]*SlowOp, 0, len(ring.ops))
+	for idx := range len(ring.ops) {
+		ops = append(ops, ring.ops[(ring.next-1-idx+len(ring.ops))%len(ring.ops)])
+	}
+
+	return ops
+}
@@ -0,0 +1,58 @@
+package mariv2
+
+import "sync/atomic"
+
+//============================================= Mari Write Amplification
+
+// record
+//
+//	Count a successful commit with the bytes it appended to the memory map and the payload it wrote.
+func (tracker *amplification) record(written, payload uint64) {
+	atomic.AddUint64(&tracker.commits, 1)
+	atomic.AddUint64(&tracker.writtenBytes, written)
+	atomic.AddUint64(&tracker.payloadBytes, payload)
+}
+
+// stats
+//
+//	Get the totals of the commits since the instance was opened and the ratio of bytes written to payload.
+func (tracker *amplification) stats() WriteAmplificationStats {
+	stats := WriteAmplificationStats{
+		Commits:      atomic.LoadUint64(&tracker.commits),
+		WrittenBytes: atomic.LoadUint64(&tracker.writtenBytes),
+		PayloadBytes: atomic.LoadUint64(&tracker.payloadBytes),
+	}
+
+	if stats.PayloadBytes > 0 {
+		stats.Ratio = float64(stats.WrittenBytes) / float64(stats.PayloadBytes)
+	}
+
+	return stats
+}
+
+// payloadBytes
+//
+//	Get the logical bytes of the write set, the key and value of the last write to each key, or only the key for a delete.
+//	Writes to reserved keys, like the ttl index, are overhead of the commit and are not counted.
+func (tx *Tx) payloadBytes() uint64 {
+	var payload uint64
+	seen := make(map[string]struct{}, len(tx.writeSet))
+	for idx := len(tx.writeSet) - 1; idx >= 0; idx-- {
+		write := tx.writeSet[idx]
+		if isReservedKey(write.key) {
+			continue
+		}
+
+		if _, ok := seen[string(write.key)]; ok {
+			continue
+		}
+
+		seen[string(write.key)] = struct{}{}
+		payload += uint64(len(write.key))
+		if !write.isDelete {
+			payload += uint64(len(write.value))
+		}
+	}
+
+	return payload
+}
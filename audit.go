@@ -0,0 +1,139 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+//============================================= Mari Audit Log
+
+// SetAnnotation
+//
+//	Attach metadata to a read-write transaction, like the actor or request id, which is recorded with each of its operations in the audit log.
+//	Setting a key again replaces the value. UpdateTx runs the function again on retry, so annotations set within it are set again for the retried transaction.
+func (tx *Tx) SetAnnotation(key, value string) error {
+	if !tx.isWrite {
+		return errors.New("attempting to annotate a read only transaction, use tx.UpdateTx")
+	}
+
+	if tx.annotations == nil {
+		tx.annotations = make(map[string]string)
+	}
+
+	tx.annotations[key] = value
+	return nil
+}
+
+// ReadAuditLog
+//
+//	Read every entry of an audit log, in the order the operations were committed.
+//	A partially written last entry, from a crash during a commit, is returned as an error after the complete entries.
+func ReadAuditLog(fileName string) ([]*AuditEntry, error) {
+	file, openErr := os.Open(fileName)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	defer file.Close()
+
+	var entries []*AuditEntry
+	decoder := json.NewDecoder(file)
+	for {
+		entry := &AuditEntry{}
+		decodeErr := decoder.Decode(entry)
+		if errors.Is(decodeErr, io.EOF) {
+			return entries, nil
+		}
+
+		if decodeErr != nil {
+			return entries, decodeErr
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// openAuditLog
+//
+//	Open the audit log for appending, creating it if it does not exist.
+func openAuditLog(fileName string, mode os.FileMode) (*auditLog, error) {
+	file, openErr := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, mode)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	return &auditLog{file: file}, nil
+}
+
+// encode
+//
+//	Encode the operations of a transaction as entries of the audit log, one JSON object per line, with the version and timestamp of the commit.
+//	Operations on reserved keys, like the ttl index, and values replaced by stubs when moved to the cold file, are internal and are not recorded. Returns nil if the audit log is disabled.
+func (audit *auditLog) encode(tx *Tx, version, timestamp uint64) ([]byte, error) {
+	if audit == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, write := range tx.writeSet {
+		if isReservedKey(write.key) || tx.store.tiering.isStub(write.value) {
+			continue
+		}
+
+		entry := &AuditEntry{Version: version, Timestamp: timestamp, Op: AuditOpPut, Key: write.key, ValueSize: len(write.value), Annotations: tx.annotations}
+		switch {
+		case write.isPrefix:
+			entry.Op = AuditOpDeletePrefix
+		case write.isDelete:
+			entry.Op = AuditOpDelete
+		}
+
+		encodeErr := encoder.Encode(entry)
+		if encodeErr != nil {
+			return nil, encodeErr
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// append
+//
+//	Append encoded entries to the audit log with a single write.
+//	This is called while the commit holds the next version, so entries are appended in version order.
+func (audit *auditLog) append(sEntries []byte) error {
+	if audit == nil || len(sEntries) == 0 {
+		return nil
+	}
+
+	_, writeErr := audit.file.Write(sEntries)
+	return writeErr
+}
+
+// sync
+//
+//	Sync the audit log to disk, along with the commits synced by the flush go routine.
+func (audit *auditLog) sync() error {
+	if audit == nil {
+		return nil
+	}
+
+	return audit.file.Sync()
+}
+
+// close
+//
+//	Sync and close the audit log.
+func (audit *auditLog) close() error {
+	if audit == nil {
+		return nil
+	}
+
+	syncErr := audit.file.Sync()
+	closeErr := audit.file.Close()
+	return errors.Join(syncErr, closeErr)
+}
@@ -0,0 +1,96 @@
+package benchmarks
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Mari Benchmarks
+
+// DatasetSize is the total key-value pairs seeded into each instance before it is benchmarked
+const DatasetSize = 100000
+
+// KeySize is the length in bytes of each generated key
+const KeySize = 32
+
+// ValueSize is the length in bytes of each generated value
+const ValueSize = 32
+
+// SeedBatchSize is the total key-value pairs written per read-write transaction when seeding an instance
+const SeedBatchSize = 1000
+
+// datasetSeed is the fixed seed the dataset is generated from, so every run benchmarks the same keys and values
+const datasetSeed = uint64(1197)
+
+// dataset
+//
+//	Generate size random key-value pairs from the fixed seed, so the dataset is the same across runs and machines.
+func dataset(size int) []*mariv2.KeyValuePair {
+	random := rand.New(rand.NewPCG(datasetSeed, datasetSeed))
+
+	kvPairs := make([]*mariv2.KeyValuePair, size)
+	for idx := range kvPairs {
+		kvPairs[idx] = &mariv2.KeyValuePair{Key: randomBytes(random, KeySize), Value: randomBytes(random, ValueSize)}
+	}
+
+	return kvPairs
+}
+
+// sortedKeys
+//
+//	Get the keys of the dataset in sorted order, which is the order of scans, so benchmarks can pick the end key of a range with an exact size.
+func sortedKeys(kvPairs []*mariv2.KeyValuePair) [][]byte {
+	keys := make([][]byte, len(kvPairs))
+	for idx, kvPair := range kvPairs {
+		keys[idx] = kvPair.Key
+	}
+
+	slices.SortFunc(keys, bytes.Compare)
+	return keys
+}
+
+// randomBytes
+//
+//	Generate length random bytes from the source. Every byte is non-zero, so generated keys are never under ReservedKeyPrefix.
+func randomBytes(random *rand.Rand, length int) []byte {
+	generated := make([]byte, length)
+	for idx := range generated {
+		generated[idx] = byte(1 + random.IntN(255))
+	}
+
+	return generated
+}
+
+// open
+//
+//	Open an instance in the directory and seed it with the dataset in batches of SeedBatchSize.
+func open(opts mariv2.InitOpts, kvPairs []*mariv2.KeyValuePair) (*mariv2.Mari, error) {
+	mariInst, openErr := mariv2.Open(opts)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	for start := 0; start < len(kvPairs); start += SeedBatchSize {
+		batch := kvPairs[start:min(start+SeedBatchSize, len(kvPairs))]
+		putErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, kvPair := range batch {
+				putTxErr := tx.Put(kvPair.Key, kvPair.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			mariInst.Remove()
+			return nil, putErr
+		}
+	}
+
+	return mariInst, nil
+}
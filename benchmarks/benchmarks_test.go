@@ -0,0 +1,341 @@
+package benchmarks
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var benchDir string
+var benchKvPairs []*mariv2.KeyValuePair
+var benchSortedKeys [][]byte
+var readMariInst *mariv2.Mari
+var readOnce sync.Once
+var readErr error
+
+// scanSizes are the total keys read by each scan benchmark
+var scanSizes = []int{10, 100, 1000, 10000}
+
+// writePercents are the percent of operations that are writes in the mixed read/write benchmarks
+var writePercents = []int{1, 10, 50}
+
+func TestMain(m *testing.M) {
+	var dirErr error
+	benchDir, dirErr = os.MkdirTemp("", "maribenchmarks")
+	if dirErr != nil {
+		panic(dirErr.Error())
+	}
+
+	code := m.Run()
+
+	if readMariInst != nil {
+		readMariInst.Close()
+	}
+
+	os.RemoveAll(benchDir)
+	os.Exit(code)
+}
+
+// readInstance opens the instance shared by the read only benchmarks on first use, so running the tests of the package does not seed it
+func readInstance(b *testing.B) *mariv2.Mari {
+	readOnce.Do(func() {
+		benchKvPairs = dataset(DatasetSize)
+		benchSortedKeys = sortedKeys(benchKvPairs)
+		readMariInst, readErr = open(benchOpts("read"), benchKvPairs)
+	})
+
+	if readErr != nil {
+		b.Fatalf("error seeding mari: %s", readErr.Error())
+	}
+
+	return readMariInst
+}
+
+// benchOpts are the options every benchmarked instance is opened with
+func benchOpts(fileName string) mariv2.InitOpts {
+	nodePoolSize := int64(10000)
+	return mariv2.InitOpts{Filepath: benchDir, FileName: fileName, NodePoolSize: &nodePoolSize}
+}
+
+// get reads a key, failing the benchmark if the key is missing
+func get(b *testing.B, mariInst *mariv2.Mari, key []byte) {
+	getErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+		kvPair, getTxErr := tx.Get(key, nil)
+		if getTxErr == nil && kvPair == nil {
+			return fmt.Errorf("expected key %x to exist", key)
+		}
+
+		return getTxErr
+	})
+
+	if getErr != nil {
+		b.Fatal(getErr.Error())
+	}
+}
+
+// put writes a key in its own read-write transaction, failing the benchmark on error
+func put(b *testing.B, mariInst *mariv2.Mari, key, value []byte) {
+	putErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put(key, value)
+	})
+
+	if putErr != nil {
+		b.Fatal(putErr.Error())
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	mariInst := readInstance(b)
+
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		get(b, mariInst, benchKvPairs[idx%len(benchKvPairs)].Key)
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	mariInst := readInstance(b)
+
+	var worker atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		random := rand.New(rand.NewPCG(datasetSeed, worker.Add(1)))
+		for pb.Next() {
+			get(b, mariInst, benchKvPairs[random.IntN(len(benchKvPairs))].Key)
+		}
+	})
+}
+
+func BenchmarkIterate(b *testing.B) {
+	mariInst := readInstance(b)
+
+	for _, size := range scanSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			random := rand.New(rand.NewPCG(datasetSeed, uint64(size)))
+
+			b.ResetTimer()
+			for idx := 0; idx < b.N; idx++ {
+				startKey := benchSortedKeys[random.IntN(len(benchSortedKeys)-size)]
+				iterErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+					kvPairs, iterTxErr := tx.Iterate(startKey, size, nil)
+					if iterTxErr == nil && len(kvPairs) != size {
+						return fmt.Errorf("expected %d keys: actual(%d)", size, len(kvPairs))
+					}
+
+					return iterTxErr
+				})
+
+				if iterErr != nil {
+					b.Fatal(iterErr.Error())
+				}
+			}
+
+			b.ReportMetric(float64(size), "keys/op")
+		})
+	}
+}
+
+// earlyStopSizes are the total keys read by each iteration that stops after a few keys, in a node with many children after the start key
+var earlyStopSizes = []int{1, 10}
+
+func BenchmarkIterateEarlyStop(b *testing.B) {
+	mariInst := readInstance(b)
+
+	for _, size := range earlyStopSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			random := rand.New(rand.NewPCG(datasetSeed, uint64(size)))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for idx := 0; idx < b.N; idx++ {
+				startKey := benchSortedKeys[random.IntN(len(benchSortedKeys)/2)]
+				iterErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+					kvPairs, iterTxErr := tx.Iterate(startKey, size, nil)
+					if iterTxErr == nil && len(kvPairs) != size {
+						return fmt.Errorf("expected %d keys: actual(%d)", size, len(kvPairs))
+					}
+
+					return iterTxErr
+				})
+
+				if iterErr != nil {
+					b.Fatal(iterErr.Error())
+				}
+			}
+
+			b.ReportMetric(float64(size), "keys/op")
+		})
+	}
+}
+
+func BenchmarkRange(b *testing.B) {
+	mariInst := readInstance(b)
+
+	for _, size := range scanSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			random := rand.New(rand.NewPCG(datasetSeed, uint64(size)))
+
+			b.ResetTimer()
+			for idx := 0; idx < b.N; idx++ {
+				start := random.IntN(len(benchSortedKeys) - size)
+				rangeErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+					kvPairs, rangeTxErr := tx.Range(benchSortedKeys[start], benchSortedKeys[start+size], nil)
+					if rangeTxErr == nil && len(kvPairs) != size {
+						return fmt.Errorf("expected %d keys: actual(%d)", size, len(kvPairs))
+					}
+
+					return rangeTxErr
+				})
+
+				if rangeErr != nil {
+					b.Fatal(rangeErr.Error())
+				}
+			}
+
+			b.ReportMetric(float64(size), "keys/op")
+		})
+	}
+}
+
+func BenchmarkRangeSharedBuffers(b *testing.B) {
+	mariInst := readInstance(b)
+
+	for _, sharedBuffers := range []bool{false, true} {
+		for _, size := range scanSizes {
+			b.Run(fmt.Sprintf("shared=%t/size=%d", sharedBuffers, size), func(b *testing.B) {
+				random := rand.New(rand.NewPCG(datasetSeed, uint64(size)))
+				opts := &mariv2.RangeOpts{SharedBuffers: &sharedBuffers}
+				if !sharedBuffers {
+					transform := mariv2.Transform(mariv2.CopyTransform)
+					opts = &mariv2.RangeOpts{Transform: &transform}
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for idx := 0; idx < b.N; idx++ {
+					start := random.IntN(len(benchSortedKeys) - size)
+					rangeErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+						kvPairs, rangeTxErr := tx.Range(benchSortedKeys[start], benchSortedKeys[start+size], opts)
+						if rangeTxErr == nil && len(kvPairs) != size {
+							return fmt.Errorf("expected %d keys: actual(%d)", size, len(kvPairs))
+						}
+
+						return rangeTxErr
+					})
+
+					if rangeErr != nil {
+						b.Fatal(rangeErr.Error())
+					}
+				}
+
+				b.ReportMetric(float64(size), "keys/op")
+			})
+		}
+	}
+}
+
+func BenchmarkMixed(b *testing.B) {
+	kvPairs := dataset(DatasetSize)
+
+	for _, writePercent := range writePercents {
+		b.Run(fmt.Sprintf("writes=%d", writePercent), func(b *testing.B) {
+			mariInst, openErr := open(benchOpts(fmt.Sprintf("mixed%d", writePercent)), kvPairs)
+			if openErr != nil {
+				b.Fatalf("error seeding mari: %s", openErr.Error())
+			}
+
+			defer mariInst.Remove()
+
+			var worker atomic.Uint64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				random := rand.New(rand.NewPCG(datasetSeed, worker.Add(1)))
+				for pb.Next() {
+					kvPair := kvPairs[random.IntN(len(kvPairs))]
+					if random.IntN(100) < writePercent {
+						put(b, mariInst, kvPair.Key, randomBytes(random, ValueSize))
+					} else {
+						get(b, mariInst, kvPair.Key)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCompaction measures point reads while a writer updates keys in the background, with and without compacting the instance every compactEvery writes
+func BenchmarkCompaction(b *testing.B) {
+	const compactEvery = 1000
+	kvPairs := dataset(DatasetSize)
+
+	for _, compact := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compaction=%t", compact), func(b *testing.B) {
+			var compactNow atomic.Bool
+			var compactions atomic.Uint64
+			compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool {
+				if compactNow.CompareAndSwap(true, false) {
+					compactions.Add(1)
+					return true
+				}
+
+				return false
+			})
+
+			opts := benchOpts(fmt.Sprintf("compaction%t", compact))
+			opts.CompactTrigger = &compactTrigger
+
+			mariInst, openErr := open(opts, kvPairs)
+			if openErr != nil {
+				b.Fatalf("error seeding mari: %s", openErr.Error())
+			}
+
+			defer mariInst.Remove()
+
+			stop := make(chan struct{})
+			written := make(chan error, 1)
+			go func() {
+				random := rand.New(rand.NewPCG(datasetSeed, 0))
+				for writes := 1; ; writes++ {
+					select {
+					case <-stop:
+						written <- nil
+						return
+					default:
+					}
+
+					putErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+						return tx.Put(kvPairs[random.IntN(len(kvPairs))].Key, randomBytes(random, ValueSize))
+					})
+
+					if putErr != nil {
+						written <- putErr
+						return
+					}
+
+					if compact && writes%compactEvery == 0 {
+						compactNow.Store(true)
+					}
+				}
+			}()
+
+			random := rand.New(rand.NewPCG(datasetSeed, 1))
+			b.ResetTimer()
+			for idx := 0; idx < b.N; idx++ {
+				get(b, mariInst, kvPairs[random.IntN(len(kvPairs))].Key)
+			}
+
+			b.StopTimer()
+			close(stop)
+			if writeErr := <-written; writeErr != nil {
+				b.Fatalf("error on background write: %s", writeErr.Error())
+			}
+
+			b.ReportMetric(float64(compactions.Load()), "compactions")
+		})
+	}
+}
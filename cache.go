@@ -0,0 +1,250 @@
+package mariv2
+
+import (
+	"bytes"
+	"container/list"
+	"strings"
+)
+
+//============================================= Mari Value Cache
+
+// newValueCache
+//
+//	Create a value cache that holds up to capacity key-value pairs, evicting the least recently used.
+func newValueCache(capacity int) *valueCache {
+	return &valueCache{capacity: capacity, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// getCached
+//
+//	Get a key through the value cache and the negative cache for read only transactions, falling back to the trie and caching the result.
+//	A key found is cached in the value cache, and a key not found is cached in the negative cache, so polling for a key that is not yet written does not descend the trie each time.
+//	An entry is only served to a transaction whose snapshot is at or after the version it was cached at, and no later than the latest version invalidated, so no commit in between could have changed the key.
+//	Read-write transactions always read the trie, since their reads observe their own writes, and so do operations within Explain, so the traversal is traced.
+func (tx *Tx) getCached(key []byte) (*KeyValuePair, error) {
+	valueCache, missCache := tx.store.valueCache, tx.store.missCache
+	if (valueCache == nil && missCache == nil) || tx.isWrite || len(key) == 0 || loadINodeFromPointer(tx.root).trace != nil {
+		return tx.get(key)
+	}
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	if kvPair, ok := valueCache.get(key, tx.snapshotVersion); ok {
+		return kvPair, nil
+	}
+
+	if _, ok := missCache.get(key, tx.snapshotVersion); ok {
+		return nil, nil
+	}
+
+	kvPair, getErr := tx.get(key)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if kvPair == nil {
+		missCache.add(key, nil, tx.snapshotVersion)
+		tx.store.checkMemory()
+		return nil, nil
+	}
+
+	valueCache.add(key, kvPair, tx.snapshotVersion)
+	tx.store.checkMemory()
+	return kvPair, nil
+}
+
+// get
+//
+//	Get the cached key-value pair for a key if it is valid for the snapshot version, moving it to the front of the cache.
+//	The key and value are shared by every read of the entry, so a new key-value pair is returned for each read, or nil for an entry of the negative cache.
+func (cache *valueCache) get(key []byte, version uint64) (*KeyValuePair, bool) {
+	if cache == nil {
+		return nil, false
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	elem, ok := cache.entries[string(key)]
+	if !ok || version < elem.Value.(*cacheEntry).version || version > cache.applied {
+		cache.misses++
+		return nil, false
+	}
+
+	cache.hits++
+	cache.order.MoveToFront(elem)
+
+	cached := elem.Value.(*cacheEntry).kvPair
+	if cached == nil {
+		return nil, true
+	}
+
+	return &KeyValuePair{Version: cached.Version, Timestamp: cached.Timestamp, Key: cached.Key, Value: cached.Value}, true
+}
+
+// add
+//
+//	Cache a copy of a key-value pair read at the snapshot version, or a nil pair for a key not found, evicting the least recently used entry if the cache is full.
+//	The pair is only cached if the snapshot is the latest version invalidated, since a commit after it may have changed the key without invalidating an entry that did not exist yet.
+func (cache *valueCache) add(key []byte, kvPair *KeyValuePair, version uint64) {
+	if cache == nil {
+		return
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if version != cache.applied {
+		return
+	}
+
+	if elem, ok := cache.entries[string(key)]; ok {
+		cache.remove(elem)
+	}
+
+	entry := &cacheEntry{key: string(key), version: version}
+	if kvPair != nil {
+		entry.kvPair = &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: bytes.Clone(kvPair.Key), Value: bytes.Clone(kvPair.Value)}
+	}
+
+	cache.entries[entry.key] = cache.order.PushFront(entry)
+	cache.bytes += entry.size()
+	for cache.order.Len() > cache.capacity {
+		cache.remove(cache.order.Back())
+		cache.evictions++
+	}
+}
+
+// shrink
+//
+//	Evict the least recently used entries until at least the given bytes are freed or the cache is empty, returning the bytes freed.
+//	Shrunk entries are counted as evictions.
+func (cache *valueCache) shrink(target int64) int64 {
+	if cache == nil || target <= 0 {
+		return 0
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	var freed int64
+	for freed < target && cache.order.Len() > 0 {
+		freed += cache.remove(cache.order.Back())
+		cache.evictions++
+	}
+
+	return freed
+}
+
+// size
+//
+//	Get the estimated bytes held by the entries of the cache, which is 0 if the cache is disabled.
+func (cache *valueCache) size() int64 {
+	if cache == nil {
+		return 0
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	return cache.bytes
+}
+
+// remove
+//
+//	Remove an entry from the cache, returning its estimated bytes. The lock must be held.
+func (cache *valueCache) remove(elem *list.Element) int64 {
+	entry := elem.Value.(*cacheEntry)
+	cache.order.Remove(elem)
+	delete(cache.entries, entry.key)
+
+	size := entry.size()
+	cache.bytes -= size
+	return size
+}
+
+// size
+//
+//	Get the estimated bytes held by the entry, counting its key twice since the key-value pair is copied out of the map key.
+func (entry *cacheEntry) size() int64 {
+	size := int64(len(entry.key) + cacheEntryOverhead)
+	if entry.kvPair != nil {
+		size += int64(len(entry.kvPair.Key) + len(entry.kvPair.Value))
+	}
+
+	return size
+}
+
+// invalidate
+//
+//	Remove the keys written by a commit from the cache, and mark the version of the commit as the latest version invalidated.
+//	A prefix delete removes every cached key that begins with the prefix.
+//	This is called after the path copy is written and before the new root is visible to transactions, so commits are invalidated in version order.
+func (cache *valueCache) invalidate(writeSet []*txWrite, version uint64) {
+	if cache == nil {
+		return
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for _, write := range writeSet {
+		if write.isPrefix {
+			for key, elem := range cache.entries {
+				if strings.HasPrefix(key, string(write.key)) {
+					cache.remove(elem)
+					cache.invalidations++
+				}
+			}
+
+			continue
+		}
+
+		if elem, ok := cache.entries[string(write.key)]; ok {
+			cache.remove(elem)
+			cache.invalidations++
+		}
+	}
+
+	cache.applied = version
+}
+
+// reset
+//
+//	Remove every entry from the cache and set the latest version invalidated, when the instance is opened or versions restart after compaction.
+func (cache *valueCache) reset(version uint64) {
+	if cache == nil {
+		return
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	clear(cache.entries)
+	cache.order.Init()
+	cache.bytes = 0
+	cache.applied = version
+}
+
+// stats
+//
+//	Get the hits, misses, evictions and invalidations since the instance was opened, and the entries currently cached.
+func (cache *valueCache) stats() ValueCacheStats {
+	if cache == nil {
+		return ValueCacheStats{}
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	return ValueCacheStats{
+		Hits:          cache.hits,
+		Misses:        cache.misses,
+		Evictions:     cache.evictions,
+		Invalidations: cache.invalidations,
+		Entries:       cache.order.Len(),
+	}
+}
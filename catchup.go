@@ -0,0 +1,424 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+//============================================= Mari Replication Catch Up
+
+// ReplicationPosition
+//
+//	Get the position of the replica, which is the leader version of the last delta or snapshot applied, and the progress of a snapshot being applied.
+//	A CatchUpSink reports the position to the leader, so the leader resumes the replica from deltas, resumes the snapshot being transferred, or starts a new snapshot.
+func (mariInst *Mari) ReplicationPosition() (*ReplicaPosition, error) {
+	position := &ReplicaPosition{}
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		applied, loadErr := tx.loadReplicated()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		snapshot, snapshotKey, loadErr := tx.loadSnapshotProgress()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		position.Version, position.Timestamp = applied.version, applied.timestamp
+		position.SnapshotVersion, position.SnapshotTimestamp = snapshot.version, snapshot.timestamp
+		position.SnapshotKey = snapshotKey
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return position, nil
+}
+
+// ApplySnapshotChunk
+//
+//	Apply a chunk of a snapshot received from a leader to a replica, in a single read-write transaction, even if the instance is a follower.
+//	The chunk is verified against its checksum first, returning ErrSnapshotChecksum if it was corrupted in transfer.
+//	The first chunk deletes the keys of the replica under the prefix of the snapshot, so once the last chunk is applied the replica matches the leader version, and the version is recorded as the last applied.
+//	Until then, the last key applied is recorded in ReplicationBucket with each chunk, so an interrupted transfer resumes after it.
+//	A chunk that was already applied is skipped, so a chunk shipped again by the leader is only applied once, and a chunk that does not follow the last chunk applied returns ErrSnapshotOutOfOrder.
+//	The replica is only consistent with the leader once the last chunk is applied.
+func (mariInst *Mari) ApplySnapshotChunk(chunk *SnapshotChunk) error {
+	if chunk == nil {
+		return errors.New("snapshot chunk is nil")
+	}
+
+	if checksumPairs(chunk.Pairs) != chunk.Checksum {
+		return ErrSnapshotChecksum
+	}
+
+	return mariInst.updateTx(func(tx *Tx) error {
+		applied, loadErr := tx.loadReplicated()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		if applied.version == chunk.Version && applied.timestamp == chunk.Timestamp {
+			return nil
+		}
+
+		snapshot, snapshotKey, loadErr := tx.loadSnapshotProgress()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		inProgress := snapshot.version == chunk.Version && snapshot.timestamp == chunk.Timestamp
+		switch {
+		case inProgress && chunk.After != nil && bytes.Equal(snapshotKey, chunk.After):
+			// the chunk follows the last chunk applied
+		case inProgress && bytes.Compare(snapshotKey, chunk.Last) >= 0:
+			return nil
+		case chunk.After == nil:
+			clearErr := tx.clearReplicated(chunk.Prefix)
+			if clearErr != nil {
+				return clearErr
+			}
+		default:
+			return fmt.Errorf("%w: chunk follows %q, the replica applied up to %q", ErrSnapshotOutOfOrder, chunk.After, snapshotKey)
+		}
+
+		for _, kvPair := range chunk.Pairs {
+			putErr := tx.put(bytes.Clone(kvPair.Key), bytes.Clone(kvPair.Value))
+			if putErr != nil {
+				return putErr
+			}
+		}
+
+		if !chunk.Done {
+			progress := append(encodeVersionEntry(versionEntry{version: chunk.Version, timestamp: chunk.Timestamp}), chunk.Last...)
+			return tx.PutSystem(ReplicationBucket, snapshotProgressKey, progress)
+		}
+
+		deleteErr := tx.DeleteSystem(ReplicationBucket, snapshotProgressKey)
+		if deleteErr != nil {
+			return deleteErr
+		}
+
+		return tx.PutSystem(ReplicationBucket, replicatedKey, encodeVersionEntry(versionEntry{version: chunk.Version, timestamp: chunk.Timestamp}))
+	})
+}
+
+// catchUp
+//
+//	Request the position of the replica, sending it a snapshot if it is too far behind, then open a changefeed after the version it applied.
+//	A failure of the sink, or a snapshot version dropped by compaction while it is transferred, is logged and the position is requested again after the retry interval.
+//	Returns a nil changefeed if replication was stopped.
+func (replication *Replication) catchUp(sink CatchUpSink) (*Changefeed, error) {
+	for {
+		start, catchUpErr := replication.catchUpEntry(sink)
+		if catchUpErr == nil {
+			return replication.mariInst.openChangefeed(replication.feedOpts(), &start)
+		}
+
+		if replication.ctx.Err() != nil {
+			return nil, nil
+		}
+
+		if errors.Is(catchUpErr, ErrClosed) {
+			return nil, catchUpErr
+		}
+
+		replication.mariInst.logger.Warn("error catching up replica", "error", catchUpErr)
+		if !replication.wait() {
+			return nil, nil
+		}
+	}
+}
+
+// catchUpEntry
+//
+//	Get the version the changefeed to the replica starts after.
+//	If the version the replica applied is still retained with the same timestamp, the replica resumes from deltas, otherwise it is sent a snapshot and resumes after the snapshot version.
+//	A replica that was interrupted while applying a snapshot only matches the leader once the snapshot is complete, so the snapshot is always resumed or restarted.
+func (replication *Replication) catchUpEntry(sink CatchUpSink) (versionEntry, error) {
+	position, positionErr := sink.Position(replication.ctx)
+	if positionErr != nil {
+		return versionEntry{}, positionErr
+	}
+
+	if position.SnapshotTimestamp == 0 && position.Timestamp != 0 {
+		entry, entryErr := replication.mariInst.checkpointEntry(versionEntry{version: position.Version, timestamp: position.Timestamp})
+		if entryErr == nil {
+			return entry, nil
+		}
+
+		if !errors.Is(entryErr, ErrVersionNotFound) {
+			return versionEntry{}, entryErr
+		}
+	}
+
+	return replication.sendSnapshot(sink, position)
+}
+
+// sendSnapshot
+//
+//	Send the key-value pairs of a version to the replica in chunks, returning the version once the last chunk is acked, which is then the acked version of the replication.
+//	The snapshot the replica was applying is resumed after its last key if its version is still retained, otherwise a snapshot of the latest version is started.
+func (replication *Replication) sendSnapshot(sink CatchUpSink, position *ReplicaPosition) (versionEntry, error) {
+	snapshot, after := versionEntry{}, position.SnapshotKey
+	if position.SnapshotTimestamp != 0 {
+		var entryErr error
+		snapshot, entryErr = replication.mariInst.checkpointEntry(versionEntry{version: position.SnapshotVersion, timestamp: position.SnapshotTimestamp})
+		if entryErr != nil && !errors.Is(entryErr, ErrVersionNotFound) {
+			return versionEntry{}, entryErr
+		}
+	}
+
+	if snapshot.timestamp == 0 {
+		var latestErr error
+		snapshot, latestErr = replication.mariInst.latestVersionEntry()
+		if latestErr != nil {
+			return versionEntry{}, latestErr
+		}
+
+		after = nil
+	}
+
+	replication.mariInst.logger.Info("sending snapshot to replica", "version", snapshot.version, "resumed", after != nil)
+	for {
+		chunk, chunkErr := replication.snapshotChunk(snapshot, after)
+		if chunkErr != nil {
+			return versionEntry{}, chunkErr
+		}
+
+		receiveErr := sink.ReceiveSnapshot(replication.ctx, chunk)
+		if receiveErr != nil {
+			return versionEntry{}, receiveErr
+		}
+
+		if chunk.Done {
+			atomic.StoreUint64(&replication.acked, snapshot.version)
+			return snapshot, nil
+		}
+
+		after = chunk.Last
+	}
+}
+
+// snapshotChunk
+//
+//	Read the next chunk of a snapshot, which is the user keys under the prefix of the replication following the after key, as of the snapshot version.
+//	Keys whose ttl has elapsed are read for the chunk but not sent, so the replica does not keep them without their ttl.
+//	Values moved to the cold file are read from it, so the replica receives the values and not their stubs.
+func (replication *Replication) snapshotChunk(snapshot versionEntry, after []byte) (*SnapshotChunk, error) {
+	prefix := replication.opts.Prefix
+	chunk := &SnapshotChunk{Version: snapshot.version, Timestamp: snapshot.timestamp, Prefix: prefix, After: after, Last: after}
+
+	startKey, totalResults := after, replication.opts.SnapshotChunkSize
+	if after == nil {
+		startKey = prefix
+	} else {
+		totalResults++
+	}
+
+	_, entryErr := replication.mariInst.checkpointEntry(snapshot)
+	if entryErr != nil {
+		return nil, entryErr
+	}
+
+	readErr := replication.mariInst.ReadTxAtVersion(snapshot.version, func(tx *Tx) error {
+		kvPairs, iterErr := tx.iterateUser(startKey, totalResults, nil)
+		if iterErr != nil {
+			return iterErr
+		}
+
+		chunk.Done = len(kvPairs) < totalResults
+		if after != nil && len(kvPairs) > 0 && bytes.Equal(kvPairs[0].Key, after) {
+			kvPairs = kvPairs[1:]
+		}
+
+		for idx, kvPair := range kvPairs {
+			if !bytes.HasPrefix(kvPair.Key, prefix) {
+				kvPairs, chunk.Done = kvPairs[:idx], true
+				break
+			}
+		}
+
+		if len(kvPairs) == 0 {
+			chunk.Done = true
+			return nil
+		}
+
+		chunk.Last = bytes.Clone(kvPairs[len(kvPairs)-1].Key)
+		kvPairs, iterErr = tx.excludeExpired(kvPairs)
+		if iterErr != nil {
+			return iterErr
+		}
+
+		for _, kvPair := range kvPairs {
+			chunk.Pairs = append(chunk.Pairs, &KeyValuePair{Key: bytes.Clone(kvPair.Key), Value: bytes.Clone(kvPair.Value)})
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	chunk.Checksum = checksumPairs(chunk.Pairs)
+	return chunk, nil
+}
+
+// clearReplicated
+//
+//	Delete the user keys under a prefix before the first chunk of a snapshot is applied, so keys deleted on the leader since the replica fell behind are removed.
+func (tx *Tx) clearReplicated(prefix []byte) error {
+	kvPairs, rangeErr := tx.store.prefixKvPairs(tx.root, tx.snapshotVersion, prefix, 0)
+	if rangeErr != nil {
+		return rangeErr
+	}
+
+	for _, kvPair := range excludeReserved(kvPairs) {
+		delErr := tx.delete(bytes.Clone(kvPair.Key))
+		if delErr != nil {
+			return delErr
+		}
+	}
+
+	return nil
+}
+
+// loadSnapshotProgress
+//
+//	Get the leader version and timestamp of the snapshot being applied, and the last key applied, as of the snapshot of the transaction.
+func (tx *Tx) loadSnapshotProgress() (versionEntry, []byte, error) {
+	kvPair, getErr := tx.GetSystem(ReplicationBucket, snapshotProgressKey)
+	if getErr != nil || kvPair == nil {
+		return versionEntry{}, nil, getErr
+	}
+
+	if len(kvPair.Value) <= 2*OffsetSize64 {
+		return versionEntry{}, nil, errors.New("snapshot progress is not a version, timestamp, and key")
+	}
+
+	return decodeVersionEntry(kvPair.Value[:2*OffsetSize64]), bytes.Clone(kvPair.Value[2*OffsetSize64:]), nil
+}
+
+// checksumPairs
+//
+//	Get the crc32 checksum of the key-value pairs of a snapshot chunk, serialized as a write set.
+func checksumPairs(kvPairs []*KeyValuePair) uint32 {
+	return checksumValue(serializeWriteSet(pairsWriteSet(kvPairs)))
+}
+
+// pairsWriteSet
+//
+//	Get the key-value pairs of a snapshot chunk as puts of a write set, so they are serialized like the changes of a delta.
+func pairsWriteSet(kvPairs []*KeyValuePair) []*txWrite {
+	writeSet := make([]*txWrite, 0, len(kvPairs))
+	for _, kvPair := range kvPairs {
+		writeSet = append(writeSet, &txWrite{key: kvPair.Key, value: kvPair.Value})
+	}
+
+	return writeSet
+}
+
+// serializeSnapshotChunk
+//
+//	Serialize a snapshot chunk as the version (8 bytes), the timestamp (8 bytes), the checksum (4 bytes), and whether it is done (1 byte), followed by the prefix, after key, and last key, each prefixed with its length (4 bytes), and the key-value pairs serialized as a write set.
+func serializeSnapshotChunk(chunk *SnapshotChunk) []byte {
+	var done byte
+	if chunk.Done {
+		done = 1
+	}
+
+	sChunk := serializeUint64(chunk.Version)
+	sChunk = append(sChunk, serializeUint64(chunk.Timestamp)...)
+	sChunk = append(sChunk, serializeUint32(chunk.Checksum)...)
+	sChunk = append(sChunk, done)
+	for _, key := range [][]byte{chunk.Prefix, chunk.After, chunk.Last} {
+		sChunk = append(sChunk, serializeUint32(uint32(len(key)))...)
+		sChunk = append(sChunk, key...)
+	}
+
+	return append(sChunk, serializeWriteSet(pairsWriteSet(chunk.Pairs))...)
+}
+
+// deserializeSnapshotChunk
+//
+//	Deserialize the byte representation of a snapshot chunk. An empty after key is the first chunk, so it is deserialized as nil.
+func deserializeSnapshotChunk(sChunk []byte) (*SnapshotChunk, error) {
+	invalidErr := errors.New("invalid data length for serialized snapshot chunk")
+	headerSize := 2*OffsetSize64 + OffsetSize32 + 1
+	if len(sChunk) < headerSize {
+		return nil, invalidErr
+	}
+
+	version, _ := deserializeUint64(sChunk[:OffsetSize64])
+	timestamp, _ := deserializeUint64(sChunk[OffsetSize64 : 2*OffsetSize64])
+	checksum, _ := deserializeUint32(sChunk[2*OffsetSize64 : 2*OffsetSize64+OffsetSize32])
+	chunk := &SnapshotChunk{Version: version, Timestamp: timestamp, Checksum: checksum, Done: sChunk[headerSize-1] == 1}
+
+	offset := headerSize
+	keys := make([][]byte, 3)
+	for idx := range keys {
+		if offset+OffsetSize32 > len(sChunk) {
+			return nil, invalidErr
+		}
+
+		length, _ := deserializeUint32(sChunk[offset : offset+OffsetSize32])
+		offset += OffsetSize32
+		if uint64(offset)+uint64(length) > uint64(len(sChunk)) {
+			return nil, invalidErr
+		}
+
+		if length > 0 {
+			keys[idx] = bytes.Clone(sChunk[offset : offset+int(length)])
+		}
+
+		offset += int(length)
+	}
+
+	chunk.Prefix, chunk.After, chunk.Last = keys[0], keys[1], keys[2]
+	writeSet, desErr := deserializeWriteSet(sChunk[offset:])
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	for _, write := range writeSet {
+		chunk.Pairs = append(chunk.Pairs, &KeyValuePair{Key: write.key, Value: write.value})
+	}
+
+	return chunk, nil
+}
+
+// serializePosition
+//
+//	Serialize a replica position as the version, timestamp, snapshot version, and snapshot timestamp (8 bytes each), followed by the snapshot key.
+func serializePosition(position *ReplicaPosition) []byte {
+	sPosition := serializeUint64(position.Version)
+	sPosition = append(sPosition, serializeUint64(position.Timestamp)...)
+	sPosition = append(sPosition, serializeUint64(position.SnapshotVersion)...)
+	sPosition = append(sPosition, serializeUint64(position.SnapshotTimestamp)...)
+	return append(sPosition, position.SnapshotKey...)
+}
+
+// deserializePosition
+//
+//	Deserialize the byte representation of a replica position.
+func deserializePosition(sPosition []byte) (*ReplicaPosition, error) {
+	if len(sPosition) < 4*OffsetSize64 {
+		return nil, errors.New("invalid data length for serialized replica position")
+	}
+
+	position := &ReplicaPosition{}
+	position.Version, _ = deserializeUint64(sPosition[:OffsetSize64])
+	position.Timestamp, _ = deserializeUint64(sPosition[OffsetSize64 : 2*OffsetSize64])
+	position.SnapshotVersion, _ = deserializeUint64(sPosition[2*OffsetSize64 : 3*OffsetSize64])
+	position.SnapshotTimestamp, _ = deserializeUint64(sPosition[3*OffsetSize64 : 4*OffsetSize64])
+	if len(sPosition) > 4*OffsetSize64 {
+		position.SnapshotKey = bytes.Clone(sPosition[4*OffsetSize64:])
+	}
+
+	return position, nil
+}
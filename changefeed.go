@@ -0,0 +1,481 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"slices"
+	"sort"
+	"sync/atomic"
+	"unsafe"
+)
+
+//============================================= Mari Changefeed
+
+// Changefeed
+//
+//	Subscribe to the commit events of the instance, filtered to the changes matching the prefix and kinds of changes in the opts.
+//	With a cursor, the changefeed starts after the version last acked with the cursor, and the commits missed since are rebuilt from the retained versions, so consumers resume exactly where they left off after restarts.
+//	Events dropped because the consumer fell behind are rebuilt the same way once the next commit is received, so every version is delivered in order.
+//	Versions without matching changes are not sent.
+//	If the cursor can not be resumed because compaction reset the versions, ErrChangefeedReset is returned and the cursor must be deleted with ResetChangefeed.
+func (mariInst *Mari) Changefeed(opts ChangefeedOpts) (*Changefeed, error) {
+	for _, op := range opts.Ops {
+		if op != AuditOpPut && op != AuditOpDelete {
+			return nil, errors.New("changefeed ops must be AuditOpPut or AuditOpDelete")
+		}
+	}
+
+	return mariInst.openChangefeed(opts, nil)
+}
+
+// openChangefeed
+//
+//	Open a changefeed starting after a version entry, or after the entry determined by the cursor of the opts if the start is nil.
+//	The commit events are subscribed to before the start is determined, so no commit after the start is missed.
+func (mariInst *Mari) openChangefeed(opts ChangefeedOpts, start *versionEntry) (*Changefeed, error) {
+	opts.Prefix = mariInst.normalizeKey(opts.Prefix)
+	feed := &Changefeed{
+		mariInst: mariInst,
+		opts:     opts,
+		events:   make(chan *CommitEvent, max(opts.BufferSize, 1)),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	live, cancel := mariInst.CommitChan(opts.BufferSize)
+	feed.cancel = cancel
+
+	if start == nil {
+		entry, startErr := feed.startEntry()
+		if startErr != nil {
+			cancel()
+			return nil, startErr
+		}
+
+		start = &entry
+	}
+
+	go feed.run(live, *start)
+	return feed, nil
+}
+
+// ResetChangefeed
+//
+//	Delete the durable cursor of a changefeed, so the next changefeed with the cursor starts at the latest version.
+func (mariInst *Mari) ResetChangefeed(cursor string) error {
+	return mariInst.UpdateTx(func(tx *Tx) error {
+		return tx.DeleteSystem(ChangefeedBucket, []byte(cursor))
+	})
+}
+
+// Events
+//
+//	The filtered commit events of the changefeed, in version order.
+//	The channel is closed when the changefeed stops, after which Err returns why it stopped.
+func (feed *Changefeed) Events() <-chan *CommitEvent {
+	return feed.events
+}
+
+// Ack
+//
+//	Record a version as consumed under the cursor of the changefeed, so a changefeed opened with the cursor resumes after it.
+//	The cursor is stored with the timestamp of the version, so a cursor from before compaction reset the versions is detected.
+func (feed *Changefeed) Ack(version uint64) error {
+	if feed.opts.Cursor == "" {
+		return errors.New("changefeed has no cursor to ack")
+	}
+
+	entry, entryErr := feed.mariInst.versionEntryAt(version)
+	if entryErr != nil {
+		return entryErr
+	}
+
+	return feed.mariInst.UpdateTx(func(tx *Tx) error {
+		return tx.PutSystem(ChangefeedBucket, []byte(feed.opts.Cursor), encodeVersionEntry(entry))
+	})
+}
+
+// Err
+//
+//	Why the changefeed stopped, which is nil if it was closed or the instance was closed.
+//	Only valid once the events channel is closed.
+func (feed *Changefeed) Err() error {
+	select {
+	case <-feed.stopped:
+		return feed.err
+	default:
+		return nil
+	}
+}
+
+// Close
+//
+//	Stop the changefeed and wait for the events channel to be closed.
+//	Events that were not acked are delivered again by the next changefeed with the cursor.
+func (feed *Changefeed) Close() {
+	feed.closeOnce.Do(func() {
+		close(feed.done)
+		feed.cancel()
+	})
+
+	<-feed.stopped
+}
+
+// startEntry
+//
+//	Determine the version the changefeed starts after, which is the acked version of the cursor, or the latest version without a cursor or if the cursor was never acked.
+//	A cursor whose version is no longer retained with the same timestamp was acked before compaction reset the versions, so ErrChangefeedReset is returned.
+func (feed *Changefeed) startEntry() (versionEntry, error) {
+	var encoded []byte
+	if feed.opts.Cursor != "" {
+		cursorErr := feed.mariInst.ReadTx(func(tx *Tx) error {
+			kvPair, getErr := tx.GetSystem(ChangefeedBucket, []byte(feed.opts.Cursor))
+			if getErr != nil || kvPair == nil {
+				return getErr
+			}
+
+			encoded = bytes.Clone(kvPair.Value)
+			return nil
+		})
+
+		if cursorErr != nil {
+			return versionEntry{}, cursorErr
+		}
+	}
+
+	if encoded == nil {
+		return feed.mariInst.latestVersionEntry()
+	}
+
+	if len(encoded) != 16 {
+		return versionEntry{}, errors.New("changefeed cursor is not a version and timestamp")
+	}
+
+	cursor := decodeVersionEntry(encoded)
+	entry, entryErr := feed.mariInst.versionEntryAt(cursor.version)
+	switch {
+	case errors.Is(entryErr, ErrVersionNotFound):
+		return versionEntry{}, ErrChangefeedReset
+	case entryErr != nil:
+		return versionEntry{}, entryErr
+	case entry.timestamp != cursor.timestamp:
+		return versionEntry{}, ErrChangefeedReset
+	}
+
+	return entry, nil
+}
+
+// run
+//
+//	Send the versions committed since the start version, then the live commit events, until the changefeed or instance is closed.
+//	Live events that were already rebuilt from the retained versions are skipped by timestamp, and a gap in the versions is rebuilt before the next event is sent.
+//	A version less than the last sent version with a newer timestamp means compaction reset the versions, which stops the changefeed with ErrChangefeedReset.
+func (feed *Changefeed) run(live <-chan *CommitEvent, last versionEntry) {
+	defer close(feed.stopped)
+	defer close(feed.events)
+
+	latest, runErr := feed.mariInst.latestVersionEntry()
+	if runErr != nil {
+		feed.err = runErr
+		return
+	}
+
+	last, runErr = feed.catchUp(last, latest.version)
+	if runErr != nil {
+		feed.err = runErr
+		return
+	}
+
+	for {
+		select {
+		case <-feed.done:
+			return
+		case event, ok := <-live:
+			if !ok {
+				return
+			}
+
+			if event.Timestamp <= last.timestamp {
+				continue
+			}
+
+			if event.Version <= last.version {
+				feed.err = ErrChangefeedReset
+				return
+			}
+
+			last, runErr = feed.catchUp(last, event.Version-1)
+			if runErr != nil {
+				feed.err = runErr
+				return
+			}
+
+			if !feed.send(event) {
+				return
+			}
+
+			last = versionEntry{version: event.Version, timestamp: event.Timestamp}
+		}
+	}
+}
+
+// catchUp
+//
+//	Rebuild and send the commit events of the versions after the last sent version up to the target version.
+//	If a version is no longer retained, compaction reset the versions so ErrChangefeedReset is returned.
+func (feed *Changefeed) catchUp(last versionEntry, target uint64) (versionEntry, error) {
+	for version := last.version + 1; version <= target; version++ {
+		event, eventErr := feed.mariInst.versionEvent(version)
+		switch {
+		case errors.Is(eventErr, ErrVersionNotFound):
+			return last, ErrChangefeedReset
+		case eventErr != nil:
+			return last, eventErr
+		case event.Timestamp <= last.timestamp:
+			return last, ErrChangefeedReset
+		}
+
+		if !feed.send(event) {
+			return last, nil
+		}
+
+		last = versionEntry{version: event.Version, timestamp: event.Timestamp}
+	}
+
+	return last, nil
+}
+
+// send
+//
+//	Send the changes of an event that match the filters of the changefeed, skipping the event if none match.
+//	Returns false if the changefeed was closed while waiting for the consumer.
+func (feed *Changefeed) send(event *CommitEvent) bool {
+	filtered := &CommitEvent{Version: event.Version, Timestamp: event.Timestamp, Annotations: event.Annotations}
+	for _, change := range event.Changes {
+		if feed.matches(change) {
+			filtered.Changes = append(filtered.Changes, change)
+		}
+	}
+
+	if len(filtered.Changes) == 0 {
+		select {
+		case <-feed.done:
+			return false
+		default:
+			return true
+		}
+	}
+
+	select {
+	case feed.events <- filtered:
+		return true
+	case <-feed.done:
+		return false
+	}
+}
+
+// matches
+//
+//	Determine whether a change matches the prefix and kinds of changes of the changefeed.
+//	A prefix delete that covers the prefix of the changefeed also matches, and is received as a delete.
+func (feed *Changefeed) matches(change *Change) bool {
+	if !bytes.HasPrefix(change.Key, feed.opts.Prefix) && !(change.Prefix && bytes.HasPrefix(feed.opts.Prefix, change.Key)) {
+		return false
+	}
+
+	if len(feed.opts.Ops) == 0 {
+		return true
+	}
+
+	op := AuditOpPut
+	if change.Delete {
+		op = AuditOpDelete
+	}
+
+	return slices.Contains(feed.opts.Ops, op)
+}
+
+// versionEvent
+//
+//	Rebuild the commit event of a retained version by comparing its root to the root of the previous version.
+//	The puts are the leaves written at the version, and the deletes are the keys of the previous root that are not in the root of the version.
+//	Subtrees shared by both roots are skipped, since they were not modified by the commit. Values replaced by stubs when moved to the cold file are left out, as they are from live events.
+//	The changes are sorted by key rather than in the order they were performed, and the annotations are not retained.
+//	A put of an unchanged value does not write a new leaf, so it is not included.
+func (mariInst *Mari) versionEvent(version uint64) (*CommitEvent, error) {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Changefeed"); stateErr != nil {
+		return nil, stateErr
+	}
+
+	entries, indexErr := mariInst.indexVersions()
+	if indexErr != nil {
+		return nil, indexErr
+	}
+
+	idx := sort.Search(len(entries), func(i int) bool { return entries[i].version >= version })
+	if idx == 0 || idx == len(entries) || entries[idx].version != version || entries[idx-1].version != version-1 {
+		return nil, ErrVersionNotFound
+	}
+
+	prevRoot, readErr := mariInst.readINodeFromMemMap(entries[idx-1].rootOffset)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	currRoot, readErr := mariInst.readINodeFromMemMap(entries[idx].rootOffset)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	currPtr := storeINodeAsPointer(currRoot)
+	puts, rangeErr := mariInst.rangeRecursive(currPtr, version, version, nil, nil, 0)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	event := &CommitEvent{Version: version, Timestamp: entries[idx].timestamp}
+	for _, kvPair := range puts {
+		if kvPair.Version != version || isReservedKey(kvPair.Key) || mariInst.tiering.isStub(kvPair.Value) {
+			continue
+		}
+
+		event.Changes = append(event.Changes, &Change{Key: bytes.Clone(kvPair.Key), Value: bytes.Clone(kvPair.Value)})
+	}
+
+	deleted, diffErr := mariInst.deletedKeys(prevRoot, currRoot, currPtr, version-1, 0)
+	if diffErr != nil {
+		return nil, diffErr
+	}
+
+	for _, key := range deleted {
+		if isReservedKey(key) {
+			continue
+		}
+
+		event.Changes = append(event.Changes, &Change{Key: bytes.Clone(key), Delete: true})
+	}
+
+	slices.SortFunc(event.Changes, func(a, b *Change) int { return bytes.Compare(a.Key, b.Key) })
+	return event, nil
+}
+
+// deletedKeys
+//
+//	Recursively find the keys below a node of the previous root that are not in the current root.
+//	Children at the same index are compared in parallel, and a child with the same offset in both is shared so it is skipped.
+//	Every key of a child that is only in the previous root is a candidate, and every candidate is checked against the current root, since a leaf can be relocated to a different level.
+func (mariInst *Mari) deletedKeys(prevNode, currNode *INode, currRoot *unsafe.Pointer, prevVersion uint64, level int) ([][]byte, error) {
+	var candidates [][]byte
+	if len(prevNode.leaf.key) > 0 && (currNode == nil || !bytes.Equal(prevNode.leaf.key, currNode.leaf.key)) {
+		candidates = append(candidates, prevNode.leaf.key)
+	}
+
+	var deleted [][]byte
+	for index := 0; index < 256; index++ {
+		if !isBitSet(prevNode.bitmap, byte(index)) {
+			continue
+		}
+
+		prevPos := getPosition(prevNode.bitmap, byte(index), level)
+		var currChild *INode
+		if currNode != nil && isBitSet(currNode.bitmap, byte(index)) {
+			currPos := getPosition(currNode.bitmap, byte(index), level)
+			if currNode.children[currPos].startOffset != 0 && currNode.children[currPos].startOffset == prevNode.children[prevPos].startOffset {
+				continue
+			}
+
+			var childErr error
+			currChild, childErr = mariInst.getChildNode(currNode, currPos)
+			if childErr != nil {
+				return nil, childErr
+			}
+		}
+
+		prevChild, childErr := mariInst.getChildNode(prevNode, prevPos)
+		if childErr != nil {
+			return nil, childErr
+		}
+
+		if currChild == nil {
+			kvPairs, rangeErr := mariInst.rangeRecursive(storeINodeAsPointer(prevChild), 0, prevVersion, nil, nil, level+1)
+			if rangeErr != nil {
+				return nil, rangeErr
+			}
+
+			for _, kvPair := range kvPairs {
+				candidates = append(candidates, kvPair.Key)
+			}
+
+			continue
+		}
+
+		childDeleted, diffErr := mariInst.deletedKeys(prevChild, currChild, currRoot, prevVersion, level+1)
+		if diffErr != nil {
+			return nil, diffErr
+		}
+
+		deleted = append(deleted, childDeleted...)
+	}
+
+	for _, key := range candidates {
+		leaf, getErr := mariInst.getLeafRecursive(currRoot, key, 0)
+		if getErr != nil {
+			return nil, getErr
+		}
+
+		if leaf == nil {
+			deleted = append(deleted, key)
+		}
+	}
+
+	return deleted, nil
+}
+
+// versionEntryAt
+//
+//	Get the root offset and timestamp of a retained version from the version index.
+func (mariInst *Mari) versionEntryAt(version uint64) (versionEntry, error) {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Changefeed"); stateErr != nil {
+		return versionEntry{}, stateErr
+	}
+
+	return mariInst.lookupVersionEntry(version)
+}
+
+// latestVersionEntry
+//
+//	Get the latest committed version from the version index.
+func (mariInst *Mari) latestVersionEntry() (versionEntry, error) {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Changefeed"); stateErr != nil {
+		return versionEntry{}, stateErr
+	}
+
+	entries, indexErr := mariInst.indexVersions()
+	if indexErr != nil {
+		return versionEntry{}, indexErr
+	}
+
+	return entries[len(entries)-1], nil
+}
@@ -0,0 +1,237 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+//============================================= Mari Checkpoints
+
+// Checkpoint
+//
+//	Tag the latest version with a name, so it can later be read with ReadTxAtCheckpoint or restored with RollbackToCheckpoint as a cheap logical restore point.
+//	The checkpoint is recorded in the system keyspace by a read-write transaction, and tags the version the transaction started from, which is returned.
+//	Tagging a name again moves the checkpoint to the latest version. Once MaxCheckpoints are recorded, tagging a new name drops the oldest checkpoint.
+//	Checkpoints are logical, so compaction, which only retains the latest version, invalidates every checkpoint taken before it.
+func (mariInst *Mari) Checkpoint(name string) (uint64, error) {
+	if len(name) == 0 {
+		return 0, errors.New("checkpoint name must be non-empty")
+	}
+
+	var entry versionEntry
+	updateErr := mariInst.UpdateTx(func(tx *Tx) error {
+		var lookupErr error
+		entry, lookupErr = mariInst.lookupVersionEntry(tx.snapshotVersion - 1)
+		if lookupErr != nil {
+			return lookupErr
+		}
+
+		checkpoints, rangeErr := tx.RangeSystem(CheckpointBucket)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		dropErr := tx.dropOldestCheckpoint(checkpoints, name)
+		if dropErr != nil {
+			return dropErr
+		}
+
+		return tx.PutSystem(CheckpointBucket, []byte(name), encodeVersionEntry(entry))
+	})
+
+	if updateErr != nil {
+		return 0, updateErr
+	}
+
+	return entry.version, nil
+}
+
+// Checkpoints
+//
+//	List every named checkpoint, sorted by name, with whether its version is still retained.
+func (mariInst *Mari) Checkpoints() ([]CheckpointInfo, error) {
+	var checkpoints []CheckpointInfo
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		kvPairs, rangeErr := tx.RangeSystem(CheckpointBucket)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		checkpoints = make([]CheckpointInfo, 0, len(kvPairs))
+		for _, kvPair := range kvPairs {
+			if len(kvPair.Value) != 16 {
+				return fmt.Errorf("checkpoint %q is not a version and timestamp", kvPair.Key)
+			}
+
+			entry := decodeVersionEntry(kvPair.Value)
+			checkpoints = append(checkpoints, CheckpointInfo{Name: string(kvPair.Key), Version: entry.version, Timestamp: entry.timestamp})
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	for idx, checkpoint := range checkpoints {
+		_, retainedErr := mariInst.checkpointEntry(versionEntry{version: checkpoint.Version, timestamp: checkpoint.Timestamp})
+		switch {
+		case retainedErr == nil:
+			checkpoints[idx].Retained = true
+		case !errors.Is(retainedErr, ErrVersionNotFound):
+			return nil, retainedErr
+		}
+	}
+
+	return checkpoints, nil
+}
+
+// DeleteCheckpoint
+//
+//	Remove a named checkpoint. Removing a name that is not recorded is a no-op.
+func (mariInst *Mari) DeleteCheckpoint(name string) error {
+	return mariInst.UpdateTx(func(tx *Tx) error {
+		return tx.DeleteSystem(CheckpointBucket, []byte(name))
+	})
+}
+
+// ReadTxAtCheckpoint
+//
+//	Handles read related operations on the version tagged by a named checkpoint.
+//	If no checkpoint is recorded with the name, ErrCheckpointNotFound is returned, and if compaction reset the versions since it was taken, ErrVersionNotFound is returned.
+func (mariInst *Mari) ReadTxAtCheckpoint(name string, txOps func(tx *Tx) error) error {
+	checkpoint, loadErr := mariInst.loadCheckpoint(name)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("ReadTxAtCheckpoint"); stateErr != nil {
+		return stateErr
+	}
+
+	entry, retainedErr := mariInst.retainedEntry(checkpoint)
+	if retainedErr != nil {
+		return retainedErr
+	}
+
+	return mariInst.readTxAtOffset(entry.rootOffset, txOps)
+}
+
+// RollbackToCheckpoint
+//
+//	Restore the user keys to the version tagged by a named checkpoint, recording the rollback as a new version.
+//	If no checkpoint is recorded with the name, ErrCheckpointNotFound is returned, and if compaction reset the versions since it was taken, ErrVersionNotFound is returned.
+func (mariInst *Mari) RollbackToCheckpoint(name string) error {
+	checkpoint, loadErr := mariInst.loadCheckpoint(name)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	return mariInst.rollbackTo(checkpoint)
+}
+
+// loadCheckpoint
+//
+//	Get the version and timestamp recorded for a named checkpoint.
+//	The read is served by a read only transaction, so it counts towards ReadOpsPerSecond.
+func (mariInst *Mari) loadCheckpoint(name string) (versionEntry, error) {
+	var encoded []byte
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		kvPair, getErr := tx.GetSystem(CheckpointBucket, []byte(name))
+		if getErr != nil {
+			return getErr
+		}
+
+		if kvPair == nil {
+			return fmt.Errorf("%w: %q", ErrCheckpointNotFound, name)
+		}
+
+		encoded = bytes.Clone(kvPair.Value)
+		return nil
+	})
+
+	if readErr != nil {
+		return versionEntry{}, readErr
+	}
+
+	if len(encoded) != 16 {
+		return versionEntry{}, fmt.Errorf("checkpoint %q is not a version and timestamp", name)
+	}
+
+	return decodeVersionEntry(encoded), nil
+}
+
+// checkpointEntry
+//
+//	Get the retained version entry of a checkpoint, taking the resize read lock.
+func (mariInst *Mari) checkpointEntry(checkpoint versionEntry) (versionEntry, error) {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Checkpoints"); stateErr != nil {
+		return versionEntry{}, stateErr
+	}
+
+	return mariInst.retainedEntry(checkpoint)
+}
+
+// retainedEntry
+//
+//	Get the entry of a recorded version from the version index, checking it was committed with the recorded timestamp.
+//	A version committed with another timestamp was recorded before compaction reset the versions, so ErrVersionNotFound is returned.
+//	The resize read lock must be held by the caller.
+func (mariInst *Mari) retainedEntry(recorded versionEntry) (versionEntry, error) {
+	entry, lookupErr := mariInst.lookupVersionEntry(recorded.version)
+	if lookupErr != nil {
+		return versionEntry{}, lookupErr
+	}
+
+	if entry.timestamp != recorded.timestamp {
+		return versionEntry{}, fmt.Errorf("%w: version %d was recorded before compaction reset the versions", ErrVersionNotFound, recorded.version)
+	}
+
+	return entry, nil
+}
+
+// dropOldestCheckpoint
+//
+//	Delete the checkpoint with the oldest timestamp when MaxCheckpoints are recorded and the name being tagged is not one of them, so the checkpoints are bounded like a ring.
+func (tx *Tx) dropOldestCheckpoint(checkpoints []*KeyValuePair, name string) error {
+	if len(checkpoints) < MaxCheckpoints {
+		return nil
+	}
+
+	var oldest *KeyValuePair
+	var oldestTimestamp uint64
+	for _, checkpoint := range checkpoints {
+		if string(checkpoint.Key) == name {
+			return nil
+		}
+
+		var timestamp uint64
+		if len(checkpoint.Value) == 16 {
+			timestamp = decodeVersionEntry(checkpoint.Value).timestamp
+		}
+
+		if oldest == nil || timestamp < oldestTimestamp {
+			oldest, oldestTimestamp = checkpoint, timestamp
+		}
+	}
+
+	return tx.DeleteSystem(CheckpointBucket, oldest.Key)
+}
@@ -0,0 +1,77 @@
+package mariv2
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+//============================================= Mari Checksum
+
+// checksumTable is the crc32 table used for value checksums
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// GetVerified
+//
+//	Attempts to retrieve the value for a key, validating the value against the checksum serialized with its leaf.
+//	A value that does not match its checksum is returned as a RegionError wrapping ErrChecksumMismatch, with the offset of the leaf.
+//	Values written in the transaction have not been serialized yet, so they are returned without validation.
+//	The value is validated before the transforms registered with the instance are applied.
+//	With RepairSources, a value that does not match its checksum is fetched from the sources and returned if a source has a value matching the checksum, and the value is rewritten in the background.
+//	If the file was not written with value checksums, ErrNoValueChecksums is returned.
+func (tx *Tx) GetVerified(key []byte) (_ *KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("GetVerified", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	if !tx.store.valueChecksums {
+		return nil, ErrNoValueChecksums
+	}
+
+	leaf, getErr := tx.store.getLeafRecursive(tx.root, tx.store.normalizeKey(key), 0)
+	if getErr != nil || leaf == nil {
+		return nil, getErr
+	}
+
+	value := leaf.value
+	verifyErr := tx.store.verifyChecksum(leaf)
+	if verifyErr != nil {
+		value = tx.store.repairValue(leaf)
+		if value == nil {
+			return nil, verifyErr
+		}
+	}
+
+	kvPair, thawErr := tx.store.thaw(&KeyValuePair{Version: leaf.version, Timestamp: leaf.timestamp, Key: leaf.key, Value: value})
+	if thawErr != nil {
+		return nil, thawErr
+	}
+
+	return tx.store.transform(kvPair), nil
+}
+
+// verifyChecksum
+//
+//	Compare the value of a leaf read from the memory map against the checksum serialized with it.
+func (mariInst *Mari) verifyChecksum(leaf *LNode) error {
+	if !leaf.checksummed {
+		return nil
+	}
+
+	actual := checksumValue(leaf.value)
+	if actual != leaf.checksum {
+		reason := fmt.Sprintf("value has checksum %08x, but the serialized checksum is %08x", actual, leaf.checksum)
+		return &RegionError{Op: "verify value checksum", Offset: leaf.startOffset, Length: uint64(leaf.endOffset) + 1, MapSize: uint64(len(mariInst.data.Load().(MMap))), Reason: reason, Err: ErrChecksumMismatch}
+	}
+
+	return nil
+}
+
+// checksumValue
+//
+//	Get the crc32 checksum of a value, using the Castagnoli polynomial.
+func checksumValue(value []byte) uint32 {
+	return crc32.Checksum(value, checksumTable)
+}
@@ -0,0 +1,151 @@
+package mariv2
+
+import (
+	"os"
+	"runtime"
+	"sync/atomic"
+)
+
+//============================================= Mari Clone
+
+// CloneTo
+//
+//	Copy the file of the instance to a new file, as a snapshot of the latest version that can be opened as its own instance, like a backup.
+//	On filesystems with reflinks, like XFS and btrfs, the file is cloned with FICLONE, which shares the extents of the file instead of copying them, so the snapshot is near instant and takes no space until either file is written.
+//	Otherwise the serialized data is copied with copy_file_range, which is done in the kernel, and where that is not supported, it is streamed through user space.
+//	Transactions and background workers are blocked while the file is copied, like during a resize, so without reflinks, writes are blocked for the length of the copy.
+//	The new file must not exist, and it is synced before returning. If the copy fails, the new file is removed.
+func (mariInst *Mari) CloneTo(fileName string) (cloneErr error) {
+	for !atomic.CompareAndSwapUint32(&mariInst.isResizing, 0, 1) {
+		runtime.Gosched()
+	}
+	defer atomic.StoreUint32(&mariInst.isResizing, 0)
+
+	mariInst.rwResizeLock.Lock()
+	defer mariInst.rwResizeLock.Unlock()
+
+	if stateErr := mariInst.checkOpen("CloneTo"); stateErr != nil {
+		return stateErr
+	}
+
+	_, endSerialized, loadErr := mariInst.loadMetaEndSerialized()
+	if loadErr != nil {
+		return loadErr
+	}
+
+	fileInfo, statErr := mariInst.file.Stat()
+	if statErr != nil {
+		return statErr
+	}
+
+	clone, openErr := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_EXCL, mariInst.fileMode)
+	if openErr != nil {
+		return openErr
+	}
+
+	defer func() {
+		closeErr := clone.Close()
+		if cloneErr == nil {
+			cloneErr = closeErr
+		}
+
+		if cloneErr != nil {
+			os.Remove(fileName)
+		}
+	}()
+
+	cloneErr = cloneFile(clone, mariInst.file, int64(endSerialized))
+	if cloneErr != nil {
+		return cloneErr
+	}
+
+	cloneInfo, cloneErr := clone.Stat()
+	if cloneErr != nil {
+		return cloneErr
+	}
+
+	if cloneInfo.Size() < fileInfo.Size() {
+		cloneErr = clone.Truncate(fileInfo.Size())
+		if cloneErr != nil {
+			return cloneErr
+		}
+	}
+
+	cloneErr = clone.Sync()
+	if cloneErr != nil {
+		return cloneErr
+	}
+
+	return mariInst.syncDir(fileName)
+}
+
+// LoadSnapshotIntoMemory
+//
+//	Copy the key-value pairs of a version into a new read only instance held in memory, for heavy analytical scans that should not touch the page cache of the file.
+//	The clone is an anonymous instance in the memory directory of the platform, which is tmpfs on linux, so it is reclaimed when it is closed.
+//	The pairs are copied in batches of SnapshotLoadBatchSize, each committed as a version of the clone, so the versions and timestamps of the clone are its own.
+//	Keys under ReservedKeyPrefix, like the ttl index, are not copied, and values moved to the cold file are read from it, since the clone has no cold file. The clone shares the key normalizer and transforms of the instance, and is demoted to a follower once it is loaded.
+//	If the version is not retained, ErrVersionNotFound is returned.
+func (mariInst *Mari) LoadSnapshotIntoMemory(version uint64) (*Mari, error) {
+	anonymous := true
+	disableFlush := true
+	subtreeCounts := mariInst.subtreeCounts
+	valueChecksums := mariInst.valueChecksums
+	nodePoolSize := int64(SnapshotLoadBatchSize)
+	opts := InitOpts{
+		Filepath:       memoryDir(),
+		Anonymous:      &anonymous,
+		DisableFlush:   &disableFlush,
+		SubtreeCounts:  &subtreeCounts,
+		ValueChecksums: &valueChecksums,
+		NodePoolSize:   &nodePoolSize,
+		KeyNormalizer:  mariInst.keyNormalizer,
+		Logger:         mariInst.logger,
+	}
+
+	clone, openErr := Open(opts)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	clone.transform = mariInst.transform
+
+	loadErr := mariInst.ReadTxAtVersion(version, func(tx *Tx) error {
+		kvPairs, rangeErr := tx.rangeKvPairs(nil, nil, nil)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for start := 0; start < len(kvPairs); start += SnapshotLoadBatchSize {
+			batch := kvPairs[start:min(start+SnapshotLoadBatchSize, len(kvPairs))]
+			putErr := clone.UpdateTx(func(cloneTx *Tx) error {
+				for _, kvPair := range batch {
+					if isReservedKey(kvPair.Key) {
+						continue
+					}
+
+					putTxErr := cloneTx.put(kvPair.Key, kvPair.Value)
+					if putTxErr != nil {
+						return putTxErr
+					}
+				}
+
+				return nil
+			})
+
+			if putErr != nil {
+				return putErr
+			}
+		}
+
+		return nil
+	})
+
+	if loadErr != nil {
+		clone.Close()
+		return nil, loadErr
+	}
+
+	clone.Demote()
+	return clone, nil
+}
@@ -0,0 +1,12 @@
+package cluster
+
+import "errors"
+
+// ErrNoHealthyNodes is returned when there are no healthy nodes to route a key to
+var ErrNoHealthyNodes = errors.New("no healthy nodes available on the ring")
+
+// ErrNodeExists is returned when adding a node with an id that is already on the ring
+var ErrNodeExists = errors.New("node with the same id already exists on the ring")
+
+// ErrNodeNotFound is returned when removing a node that is not on the ring
+var ErrNodeNotFound = errors.New("node not found on the ring")
@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//============================================= Cluster Health
+
+// CheckHealth
+//
+//	Run a single round of health checks against every node in parallel.
+//	A node is marked unhealthy after the configured number of consecutive failures, and healthy again on the first successful check.
+func (router *Router) CheckHealth(ctx context.Context) {
+	router.lock.RLock()
+	nodes := make([]Node, 0, len(router.nodes))
+	for _, state := range router.nodes {
+		nodes = append(nodes, state.node)
+	}
+	router.lock.RUnlock()
+
+	var checkWG sync.WaitGroup
+	for _, node := range nodes {
+		checkWG.Add(1)
+		go func() {
+			defer checkWG.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, router.opts.HealthCheckTimeout)
+			defer cancel()
+
+			checkErr := node.Check(checkCtx)
+			router.recordCheck(node.ID(), checkErr)
+		}()
+	}
+
+	checkWG.Wait()
+}
+
+// handleHealthChecks
+//
+//	Run in a separate go routine.
+//	Checks every node on the health check interval until the router is closed.
+func (router *Router) handleHealthChecks() {
+	defer router.checkWG.Done()
+
+	ticker := time.NewTicker(router.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-router.stopChan
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-router.stopChan:
+			return
+		case <-ticker.C:
+			router.CheckHealth(ctx)
+		}
+	}
+}
+
+// recordCheck
+//
+//	Update the status of a node with the result of a health check.
+//	Nodes removed from the ring while the check was running are ignored.
+func (router *Router) recordCheck(id string, checkErr error) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	state, ok := router.nodes[id]
+	if !ok {
+		return
+	}
+
+	state.status.LastChecked = time.Now()
+	if checkErr == nil {
+		state.status.Healthy = true
+		state.status.ConsecutiveFailures = 0
+		state.status.LastError = nil
+		return
+	}
+
+	state.status.ConsecutiveFailures++
+	state.status.LastError = checkErr
+	if state.status.ConsecutiveFailures >= router.opts.UnhealthyThreshold {
+		state.status.Healthy = false
+	}
+}
@@ -0,0 +1,236 @@
+package cluster
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+)
+
+//============================================= Cluster Router
+
+// NewRouter
+//
+//	Create a consistent hashing router over an initial set of nodes.
+//	Each node is placed on the ring at multiple virtual points, so keys are spread evenly and only the keys owned by a node move when it is added or removed.
+//	If a health check interval is provided, a background go routine checks every node on the interval until Close is called.
+func NewRouter(opts RouterOpts, nodes ...Node) (*Router, error) {
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = DefaultVirtualNodes
+	}
+
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+
+	if opts.UnhealthyThreshold <= 0 {
+		opts.UnhealthyThreshold = 1
+	}
+
+	router := &Router{
+		opts:     opts,
+		nodes:    make(map[string]*nodeState),
+		stopChan: make(chan struct{}),
+	}
+
+	for _, node := range nodes {
+		addErr := router.AddNode(node)
+		if addErr != nil {
+			return nil, addErr
+		}
+	}
+
+	if opts.HealthCheckInterval > 0 {
+		router.checkWG.Add(1)
+		go pprof.Do(context.Background(), pprof.Labels(ProfileLabelSubsystem, ProfileSubsystemHealth), func(context.Context) {
+			router.handleHealthChecks()
+		})
+	}
+
+	return router, nil
+}
+
+// Close
+//
+//	Stop the background health checker, if running.
+func (router *Router) Close() {
+	select {
+	case <-router.stopChan:
+	default:
+		close(router.stopChan)
+	}
+
+	router.checkWG.Wait()
+}
+
+// Route
+//
+//	Find the node that owns a key, which is the first healthy node clockwise from the hash of the key.
+//	Unhealthy nodes are skipped, so their keys fail over to the next node on the ring.
+func (router *Router) Route(key []byte) (Node, error) {
+	nodes := router.RouteN(key, 1)
+	if len(nodes) == 0 {
+		return nil, ErrNoHealthyNodes
+	}
+
+	return nodes[0], nil
+}
+
+// RouteN
+//
+//	Find up to n distinct healthy nodes for a key, walking clockwise from the hash of the key.
+//	The first node is the owner, and the rest can be used as replicas or fallbacks.
+func (router *Router) RouteN(key []byte, n int) []Node {
+	router.lock.RLock()
+	defer router.lock.RUnlock()
+
+	if len(router.ring) == 0 || n <= 0 {
+		return nil
+	}
+
+	keyHash := hashBytes(key)
+	start := sort.Search(len(router.ring), func(idx int) bool { return router.ring[idx].hash >= keyHash })
+
+	var routed []Node
+	seen := make(map[string]bool)
+	for offset := range router.ring {
+		entry := router.ring[(start+offset)%len(router.ring)]
+		if seen[entry.nodeID] {
+			continue
+		}
+
+		seen[entry.nodeID] = true
+		state := router.nodes[entry.nodeID]
+		if !state.status.Healthy {
+			continue
+		}
+
+		routed = append(routed, state.node)
+		if len(routed) == n || len(seen) == len(router.nodes) {
+			break
+		}
+	}
+
+	return routed
+}
+
+// AddNode
+//
+//	Add a node to the ring. New nodes are considered healthy until a health check fails.
+func (router *Router) AddNode(node Node) error {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	if _, ok := router.nodes[node.ID()]; ok {
+		return ErrNodeExists
+	}
+
+	router.nodes[node.ID()] = &nodeState{
+		node:   node,
+		status: NodeStatus{ID: node.ID(), Healthy: true},
+	}
+
+	router.rebuildRing()
+	return nil
+}
+
+// RemoveNode
+//
+//	Remove a node from the ring. Only the keys owned by the removed node move to other nodes.
+func (router *Router) RemoveNode(id string) error {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	if _, ok := router.nodes[id]; !ok {
+		return ErrNodeNotFound
+	}
+
+	delete(router.nodes, id)
+	router.rebuildRing()
+	return nil
+}
+
+// SetNodes
+//
+//	Replace the topology with a new set of nodes.
+//	The health of nodes that remain on the ring is kept, while new nodes start healthy.
+func (router *Router) SetNodes(nodes []Node) error {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+
+	updated := make(map[string]*nodeState)
+	for _, node := range nodes {
+		if _, ok := updated[node.ID()]; ok {
+			return ErrNodeExists
+		}
+
+		state, ok := router.nodes[node.ID()]
+		if ok {
+			state.node = node
+		} else {
+			state = &nodeState{node: node, status: NodeStatus{ID: node.ID(), Healthy: true}}
+		}
+
+		updated[node.ID()] = state
+	}
+
+	router.nodes = updated
+	router.rebuildRing()
+	return nil
+}
+
+// Nodes
+//
+//	Get the status of every node on the ring, sorted by id.
+func (router *Router) Nodes() []NodeStatus {
+	router.lock.RLock()
+	defer router.lock.RUnlock()
+
+	statuses := make([]NodeStatus, 0, len(router.nodes))
+	for _, state := range router.nodes {
+		statuses = append(statuses, state.status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// rebuildRing
+//
+//	Rebuild the sorted ring from the current node set. Must be called with the write lock held.
+func (router *Router) rebuildRing() {
+	ring := make([]ringEntry, 0, len(router.nodes)*router.opts.VirtualNodes)
+	for id := range router.nodes {
+		for vIdx := range make([]int, router.opts.VirtualNodes) {
+			vHash := hashBytes([]byte(id + "#" + strconv.Itoa(vIdx)))
+			ring = append(ring, ringEntry{hash: vHash, nodeID: id})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash == ring[j].hash {
+			return ring[i].nodeID < ring[j].nodeID
+		}
+		return ring[i].hash < ring[j].hash
+	})
+
+	router.ring = ring
+}
+
+// hashBytes
+//
+//	64 bit FNV-1a hash used for both keys and virtual nodes.
+//	FNV-1a alone clusters similar inputs, like the virtual node labels of a single node, so the hash is passed through the splitmix64 finalizer.
+func hashBytes(data []byte) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write(data)
+
+	hash := hasher.Sum64()
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Node is a remote mari server that keys can be routed to.
+// The client transport is provided by the caller, so the router only depends on the node identity and its health check
+type Node interface {
+	// ID: a stable, unique identifier for the node, used to place the node's virtual nodes on the ring
+	ID() string
+	// Check: perform a health check against the remote server, returning an error if the node should not receive traffic
+	Check(ctx context.Context) error
+}
+
+// RouterOpts contains options for the consistent hashing router
+type RouterOpts struct {
+	// VirtualNodes: the number of points each node is assigned on the ring. Defaults to DefaultVirtualNodes
+	VirtualNodes int
+	// HealthCheckInterval: how often to check the health of every node in the background. 0 disables background checks
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout: the timeout for a single node health check. Defaults to DefaultHealthCheckTimeout
+	HealthCheckTimeout time.Duration
+	// UnhealthyThreshold: the number of consecutive failed checks before a node stops receiving traffic. Defaults to 1
+	UnhealthyThreshold int
+}
+
+// Router maps keys to nodes using consistent hashing with virtual nodes
+type Router struct {
+	// opts: the resolved router options
+	opts RouterOpts
+	// lock: guards the ring and node set on topology updates
+	lock sync.RWMutex
+	// ring: the virtual nodes sorted by hash
+	ring []ringEntry
+	// nodes: the node state for each node id on the ring
+	nodes map[string]*nodeState
+	// stopChan: closed to stop the background health checker
+	stopChan chan struct{}
+	// checkWG: tracks the background health checker
+	checkWG sync.WaitGroup
+}
+
+// NodeStatus is a point in time snapshot of the health of a node
+type NodeStatus struct {
+	// ID: the node identifier
+	ID string
+	// Healthy: whether the node is currently receiving traffic
+	Healthy bool
+	// ConsecutiveFailures: the number of health checks that have failed in a row
+	ConsecutiveFailures int
+	// LastError: the error from the most recent failed health check, if any
+	LastError error
+	// LastChecked: the time of the most recent health check
+	LastChecked time.Time
+}
+
+// ringEntry is a single virtual node on the ring
+type ringEntry struct {
+	// hash: the position of the virtual node on the ring
+	hash uint64
+	// nodeID: the node that owns the virtual node
+	nodeID string
+}
+
+// nodeState contains the node and its health
+type nodeState struct {
+	// node: the remote node
+	node Node
+	// status: the current health of the node, guarded by the router lock
+	status NodeStatus
+}
+
+// DefaultVirtualNodes is the default number of virtual nodes per node
+const DefaultVirtualNodes = 128
+
+// DefaultHealthCheckTimeout is the default timeout for a single health check
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// ProfileLabelSubsystem is the pprof label key for the subsystem running on a go routine, matching the key used by mari instances
+const ProfileLabelSubsystem = "mari.subsystem"
+
+// ProfileSubsystemHealth is the pprof label value for the background health checks of a router
+const ProfileSubsystemHealth = "cluster-health"
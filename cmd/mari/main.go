@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Mari Command
+
+// ExitOK is the exit code when the command succeeds and no corruption was found
+const ExitOK = 0
+
+// ExitCorrupt is the exit code when the file was checked and corruption was found
+const ExitCorrupt = 1
+
+// ExitError is the exit code when the arguments are invalid or the file could not be checked
+const ExitError = 2
+
+// usage is printed when the command is run without a known subcommand
+const usage = `usage: mari <command> [arguments]
+
+commands:
+  verify [--deep] <file>  check a file for corruption and print a JSON report
+`
+
+// verifyOutput is the JSON report printed by verify, with the error if the file could not be checked
+type verifyOutput struct {
+	*mariv2.VerifyReport
+	// Error: why the file could not be checked
+	Error string `json:"error,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run
+//
+//	Run the subcommand in the arguments, returning the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return ExitError
+	}
+
+	switch args[0] {
+	case "verify":
+		return runVerify(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return ExitError
+	}
+}
+
+// runVerify
+//
+//	Check a file for corruption without writing to it, printing the report as JSON.
+//	Exits with ExitOK if the file is ok, ExitCorrupt if corruption was found, and ExitError if the file could not be checked.
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	deep := flags.Bool("deep", false, "walk every node reachable from the root and validate value checksums")
+
+	parseErr := flags.Parse(args)
+	if parseErr != nil {
+		return ExitError
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprint(stderr, usage)
+		return ExitError
+	}
+
+	fileName := flags.Arg(0)
+	opts := mariv2.InitOpts{Filepath: filepath.Dir(fileName), FileName: filepath.Base(fileName)}
+
+	exitCode := ExitOK
+	output := verifyOutput{}
+
+	report, verifyErr := mariv2.VerifyFile(opts, *deep)
+	switch {
+	case verifyErr != nil:
+		output.VerifyReport = &mariv2.VerifyReport{File: fileName, Deep: *deep, Issues: []*mariv2.VerifyIssue{}}
+		output.Error = verifyErr.Error()
+		exitCode = ExitError
+	case !report.OK:
+		output.VerifyReport = report
+		exitCode = ExitCorrupt
+	default:
+		output.VerifyReport = report
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+
+	encodeErr := encoder.Encode(output)
+	if encodeErr != nil {
+		fmt.Fprintln(stderr, encodeErr.Error())
+		return ExitError
+	}
+
+	return exitCode
+}
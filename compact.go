@@ -1,8 +1,6 @@
 package mariv2
 
 import (
-	"errors"
-	"fmt"
 	"os"
 	"runtime"
 	"sync/atomic"
@@ -15,22 +13,30 @@ import (
 //
 //	Instatiate the compaction strategy on compaction signal.
 //	Creates a new temporary memory mapped file where the version to be snapshotted will be written to.
+//	With DirectCompaction, the temporary file is opened with direct I/O and written sequentially instead of memory mapped.
 func (mariInst *Mari) newCompaction(compactedVersion uint64) (*Compaction, error) {
-	var compactErr error
+	compact := &Compaction{
+		anonymous:        mariInst.anonymous,
+		disableFlush:     mariInst.disableFlush,
+		compactedVersion: compactedVersion,
+	}
+
+	compact.tempData.Store(MMap{})
+
 	tempFileName := mariInst.file.Name() + "temp"
+	directFile := mariInst.openDirectTempFile(tempFileName)
+	if directFile != nil {
+		compact.tempFile = directFile
+		compact.direct = newDirectWriter(directFile)
+		return compact, nil
+	}
 
-	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
-	tempFile, compactErr := os.OpenFile(tempFileName, flag, 0600)
+	var compactErr error
+	compact.tempFile, compactErr = mariInst.openFile(tempFileName)
 	if compactErr != nil {
 		return nil, compactErr
 	}
 
-	compact := &Compaction{
-		tempFile:         tempFile,
-		compactedVersion: compactedVersion,
-	}
-
-	compact.tempData.Store(MMap{})
 	compactErr = compact.resizeTempFile(0)
 	if compactErr != nil {
 		return nil, compactErr
@@ -54,8 +60,17 @@ func (mariInst *Mari) signalCompact() {
 //	On signal, sets the resizing flag and acquires the write lock.
 //	The current root is loaded and then the elements are recursively written to the new file.
 //	On completion, the original memory mapped file is removed and the new file is swapped in.
+//	The instance is compacting until the new file is swapped in. Returns when the instance is closed, and a signal received while it is closing is dropped.
 func (mariInst *Mari) compactHandler() {
-	for range mariInst.signalCompactChan {
+	defer mariInst.workers.Done()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-mariInst.signalCompactChan:
+		}
+
 		cErr := func() error {
 			for !atomic.CompareAndSwapUint32(&mariInst.isResizing, 0, 1) {
 				runtime.Gosched()
@@ -65,6 +80,11 @@ func (mariInst *Mari) compactHandler() {
 			mariInst.rwResizeLock.Lock()
 			defer mariInst.rwResizeLock.Unlock()
 
+			if !mariInst.transition(StateRunning, StateCompacting) {
+				return nil
+			}
+			defer mariInst.transition(StateCompacting, StateRunning)
+
 			var compactErr error
 			_, rootOffset, compactErr := mariInst.loadMetaRootOffset()
 			if compactErr != nil {
@@ -81,37 +101,75 @@ func (mariInst *Mari) compactHandler() {
 				return compactErr
 			}
 
-			currRootPtr := storeINodeAsPointer(currRoot)
-			endOff, compactErr := mariInst.serializeCurrentVersionToNewFile(compact, currRootPtr, 0, 0, InitRootOffset)
+			var endOff uint64
+			if compact.direct != nil {
+				endOff, compactErr = mariInst.serializeCurrentVersionDirect(compact, currRoot)
+			} else {
+				currRootPtr := storeINodeAsPointer(currRoot)
+				endOff, _, compactErr = mariInst.serializeCurrentVersionToNewFile(compact, currRootPtr, 0, 0, InitRootOffset)
+			}
+
+			if compactErr != nil {
+				compact.removeTempFile()
+				return compactErr
+			}
+
+			_, timestamp, compactErr := mariInst.loadMetaTimestamp()
 			if compactErr != nil {
-				os.Remove(compact.tempFile.Name())
+				compact.removeTempFile()
 				return compactErr
 			}
 
 			newMeta := &MetaData{
-				version:         0,
-				rootOffset:      uint64(InitRootOffset),
-				nextStartOffset: endOff,
+				version:            0,
+				rootOffset:         uint64(InitRootOffset),
+				nextStartOffset:    endOff,
+				formatVersion:      mariInst.targetFormatVersion(),
+				timestamp:          timestamp,
+				historyStartOffset: endOff,
+				keyNormalizer:      mariInst.keyNormalizerID(),
 			}
 
 			serializedMeta := newMeta.serializeMetaData()
-			_, compactErr = compact.writeMetaToTempMemMap(serializedMeta)
+			if compact.direct != nil {
+				compactErr = compact.direct.finish(serializedMeta, endOff)
+			} else {
+				_, compactErr = compact.writeMetaToTempMemMap(serializedMeta)
+			}
+
 			if compactErr != nil {
-				os.Remove(compact.tempFile.Name())
+				compact.removeTempFile()
 				return compactErr
 			}
 
 			compactErr = mariInst.swapTempFileWithMari(compact)
 			if compactErr != nil {
-				os.Remove(compact.tempFile.Name())
+				compact.removeTempFile()
 				return compactErr
 			}
 
+			mariInst.subtreeCounts = mariInst.enableSubtreeCounts
+			mariInst.valueChecksums = mariInst.enableValueChecksums
+			mariInst.notifyVersion()
+
+			punchErr := mariInst.punchFreeSpace(endOff)
+			if punchErr != nil {
+				mariInst.logger.Warn("error punching a hole past the compacted data", "error", punchErr)
+			}
+
 			return nil
 		}()
 
 		if cErr != nil {
-			fmt.Println("error on compaction process:", cErr)
+			mariInst.logger.Warn("error on compaction process", "error", cErr)
+			continue
+		}
+
+		if mariInst.tombstones {
+			purgeErr := mariInst.purgeTombstones()
+			if purgeErr != nil {
+				mariInst.logger.Warn("error purging tombstones after compaction", "error", purgeErr)
+			}
 		}
 	}
 }
@@ -121,7 +179,9 @@ func (mariInst *Mari) compactHandler() {
 //	Recursively builds the new copy of the current version to the new file.
 //	All previous unused paths are discarded.
 //	At each level, the nodes are directly written to the memory map as to avoid loading the entire structure into memory.
-func (mariInst *Mari) serializeCurrentVersionToNewFile(compact *Compaction, node *unsafe.Pointer, level int, version, offset uint64) (uint64, error) {
+//	The subtree count of each node is recomputed from its children, so a file written without subtree counts is upgraded when they are enabled.
+//	Returns the offset after the subtree and the subtree count.
+func (mariInst *Mari) serializeCurrentVersionToNewFile(compact *Compaction, node *unsafe.Pointer, level int, version, offset uint64) (uint64, uint64, error) {
 	currNode := loadINodeFromPointer(node)
 
 	currNode.version = version
@@ -129,14 +189,19 @@ func (mariInst *Mari) serializeCurrentVersionToNewFile(compact *Compaction, node
 	currNode.leaf.version = version
 
 	var serializeErr error
-	sNode, serializeErr := currNode.serializeINode(true)
+	sNode, serializeErr := currNode.serializeINode(true, mariInst.enableSubtreeCounts)
 	if serializeErr != nil {
-		return 0, serializeErr
+		return 0, 0, serializeErr
+	}
+
+	var count uint64
+	if len(currNode.leaf.key) > 0 {
+		count++
 	}
 
-	serializedKeyVal, serializeErr := currNode.leaf.serializeLNode()
+	serializedKeyVal, serializeErr := currNode.leaf.serializeLNode(mariInst.enableValueChecksums)
 	if serializeErr != nil {
-		return 0, serializeErr
+		return 0, 0, serializeErr
 	}
 
 	nextStartOffset := currNode.leaf.getEndOffsetLNode() + 1
@@ -144,54 +209,61 @@ func (mariInst *Mari) serializeCurrentVersionToNewFile(compact *Compaction, node
 	if len(currNode.children) > 0 {
 		var childNode *INode
 		var childPtr *unsafe.Pointer
-		var updatedOffset uint64
+		var updatedOffset, childCount uint64
 
 		for _, child := range currNode.children {
 			sNode = append(sNode, serializeUint64(nextStartOffset)...)
 
 			childNode, serializeErr = mariInst.readINodeFromMemMap(child.startOffset)
 			if serializeErr != nil {
-				return 0, serializeErr
+				return 0, 0, serializeErr
 			}
 
 			childPtr = storeINodeAsPointer(childNode)
-			updatedOffset, serializeErr = mariInst.serializeCurrentVersionToNewFile(compact, childPtr, level+1, version, nextStartOffset)
+			updatedOffset, childCount, serializeErr = mariInst.serializeCurrentVersionToNewFile(compact, childPtr, level+1, version, nextStartOffset)
 			if serializeErr != nil {
-				return 0, serializeErr
+				return 0, 0, serializeErr
 			}
 
 			nextStartOffset = updatedOffset
+			count += childCount
 		}
 	}
 
+	if mariInst.enableSubtreeCounts {
+		copy(sNode[NodeCountIdx:NodeCountIdx+OffsetSize64], serializeUint64(count))
+	}
+
 	serializeErr = compact.resizeTempFile(currNode.leaf.getEndOffsetLNode() + 1)
 	if serializeErr != nil {
-		return 0, serializeErr
+		return 0, 0, serializeErr
 	}
 
 	sNode = append(sNode, serializedKeyVal...)
+	mariInst.ioLimiter.wait(len(sNode))
 
 	temp := compact.tempData.Load().(MMap)
 	copy(temp[currNode.startOffset:currNode.leaf.getEndOffsetLNode()+1], sNode)
-	return nextStartOffset, nil
+	return nextStartOffset, count, nil
 }
 
 // swapTempFileWithMari
 //
 //	Close the current mari memory mapped file and swap the new compacted copy.
-//	Rebuild the version index on compaction
+//	Rebuild the version index on compaction.
+//	An anonymous temporary file replaces the file without a rename, otherwise the directory is synced after the rename if SyncDirectory is set.
 func (mariInst *Mari) swapTempFileWithMari(compact *Compaction) error {
 	currFileName := mariInst.file.Name()
 	tempFileName := compact.tempFile.Name()
 	swapFileName := mariInst.file.Name() + "swap"
 
 	var swapErr error
-	swapErr = mariInst.Close()
+	swapErr = mariInst.closeFile()
 	if swapErr != nil {
 		return swapErr
 	}
 
-	swapErr = compact.tempFile.Sync()
+	swapErr = syncFile(compact.tempFile, compact.disableFlush)
 	if swapErr != nil {
 		return swapErr
 	}
@@ -201,29 +273,58 @@ func (mariInst *Mari) swapTempFileWithMari(compact *Compaction) error {
 		return swapErr
 	}
 
-	swapErr = compact.tempFile.Close()
-	if swapErr != nil {
-		return swapErr
-	}
+	if compact.anonymous {
+		mariInst.file, compact.tempFile = compact.tempFile, nil
+	} else {
+		swapErr = compact.tempFile.Close()
+		if swapErr != nil {
+			return swapErr
+		}
 
-	os.Rename(currFileName, swapFileName)
-	os.Rename(tempFileName, currFileName)
+		os.Rename(currFileName, swapFileName)
+		os.Rename(tempFileName, currFileName)
 
-	os.Remove(swapFileName)
+		os.Remove(swapFileName)
 
-	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
-	mariInst.file, swapErr = os.OpenFile(currFileName, flag, 0600)
-	if swapErr != nil {
-		return swapErr
+		swapErr = mariInst.syncDir(currFileName)
+		if swapErr != nil {
+			return swapErr
+		}
+
+		mariInst.file, swapErr = mariInst.openFile(currFileName)
+		if swapErr != nil {
+			return swapErr
+		}
 	}
 
 	swapErr = mariInst.mmap()
 	if swapErr != nil {
 		return swapErr
 	}
+
+	mariInst.versions.reset()
+	mariInst.valueCache.reset(0)
+	mariInst.missCache.reset(0)
+
 	return nil
 }
 
+// removeTempFile
+//
+//	Remove the temporary file when compaction fails. An anonymous temporary file has no name, so it is closed instead.
+func (compact *Compaction) removeTempFile() {
+	if compact.tempFile == nil {
+		return
+	}
+
+	if compact.anonymous {
+		compact.tempFile.Close()
+		return
+	}
+
+	os.Remove(compact.tempFile.Name())
+}
+
 // mMapTemp
 //
 //	Mmap helper for the temporary memory mapped file.
@@ -239,9 +340,13 @@ func (compact *Compaction) mMapTemp() error {
 
 // munmapTemp
 //
-//	Unmap helper for the tempory memory mapped file
+//	Unmap helper for the tempory memory mapped file. A temporary file written with direct I/O is never mapped.
 func (compact *Compaction) munmapTemp() error {
 	temp := compact.tempData.Load().(MMap)
+	if len(temp) == 0 {
+		return nil
+	}
+
 	unmapErr := temp.Unmap()
 	if unmapErr != nil {
 		return unmapErr
@@ -274,7 +379,7 @@ func (compact *Compaction) resizeTempFile(offset uint64) error {
 
 	var resizeErr error
 	if len(temp) > 0 {
-		resizeErr = compact.tempFile.Sync()
+		resizeErr = syncFile(compact.tempFile, compact.disableFlush)
 		if resizeErr != nil {
 			return resizeErr
 		}
@@ -300,19 +405,16 @@ func (compact *Compaction) resizeTempFile(offset uint64) error {
 // writeMetaToTempMemMap
 //
 //	Copy the serialized metadata into the memory map.
-func (compact *Compaction) writeMetaToTempMemMap(sMeta []byte) (ok bool, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			ok = false
-			err = errors.New("error writing metadata to mmap")
-		}
-	}()
-
+func (compact *Compaction) writeMetaToTempMemMap(sMeta []byte) (bool, error) {
 	temp := compact.tempData.Load().(MMap)
-	copy(temp[MetaVersionIdx:MetaEndSerializedOffset+OffsetSize64], sMeta)
+	writeErr := checkRegion(temp, "write compacted metadata", MetaVersionIdx, MetaSize, ErrOutOfBounds)
+	if writeErr != nil {
+		return false, writeErr
+	}
+
+	copy(temp[MetaVersionIdx:MetaSize], sMeta)
 
-	flushErr := compact.tempFile.Sync()
+	flushErr := syncFile(compact.tempFile, compact.disableFlush)
 	if flushErr != nil {
 		return false, flushErr
 	}
@@ -0,0 +1,63 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+//============================================= Mari Compare
+
+// compareKeys
+//
+//	Compare two keys lexicographically, returning the same result as bytes.Compare.
+//	Every key below a node shares the path to the node, so the first shared bytes are skipped, and the rest are compared as 8 byte big endian words.
+//	A big endian word orders the same as its bytes, so only the final partial word is compared byte by byte.
+func compareKeys(first, second []byte, shared int) int {
+	shared = min(shared, len(first), len(second))
+	first, second = first[shared:], second[shared:]
+
+	for len(first) >= OffsetSize64 && len(second) >= OffsetSize64 {
+		firstWord, secondWord := binary.BigEndian.Uint64(first), binary.BigEndian.Uint64(second)
+		if firstWord != secondWord {
+			if firstWord < secondWord {
+				return -1
+			}
+
+			return 1
+		}
+
+		first, second = first[OffsetSize64:], second[OffsetSize64:]
+	}
+
+	return bytes.Compare(first, second)
+}
+
+// searchKeyAfter
+//
+//	Find the position of the first key-value pair in a sorted batch with a key greater than the key, which is where a leaf stored above the batch is inserted.
+//	The batch is binary searched with compareKeys, skipping the bytes shared by every key in the batch, instead of comparing each key from its first byte.
+func searchKeyAfter(kvPairs []*KeyValuePair, key []byte, shared int) int {
+	low, high := 0, len(kvPairs)
+	for low < high {
+		mid := int(uint(low+high) >> 1)
+		if compareKeys(kvPairs[mid].Key, key, shared) <= 0 {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+
+	return low
+}
+
+// keyInBounds
+//
+//	Determine whether a key is within the inclusive start and end key, where a nil bound is open.
+//	Both bounds share the first shared bytes with the key, so they are compared with compareKeys.
+func keyInBounds(key, startKey, endKey []byte, shared int) bool {
+	if startKey != nil && compareKeys(key, startKey, shared) < 0 {
+		return false
+	}
+
+	return endKey == nil || compareKeys(key, endKey, shared) <= 0
+}
@@ -0,0 +1,107 @@
+package mariv2
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Contention
+
+// recordConflict
+//
+//	Mark the transaction as conflicted and count a conflict on the key that failed validation, grouped by the key prefix if a prefix length is set.
+//	Once ContentionMaxKeys keys are tracked, conflicts on keys not already tracked are dropped.
+func (tx *Tx) recordConflict(key []byte) {
+	tx.conflicted = true
+
+	tracker := tx.store.contention
+	if tracker.prefixLength > 0 && len(key) > tracker.prefixLength {
+		key = key[:tracker.prefixLength]
+	}
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if _, ok := tracker.conflicts[string(key)]; !ok && len(tracker.conflicts) >= ContentionMaxKeys {
+		return
+	}
+
+	tracker.conflicts[string(key)]++
+}
+
+// recordRetry
+//
+//	Count a retry of a read-write transaction by UpdateTx after it failed validation.
+func (tracker *contention) recordRetry() {
+	atomic.AddUint64(&tracker.retries, 1)
+}
+
+// recordAbort
+//
+//	Count a commit of a transaction started with Begin rejected on conflict.
+func (tracker *contention) recordAbort() {
+	atomic.AddUint64(&tracker.aborts, 1)
+}
+
+// hotKeys
+//
+//	Get the keys with the most conflicts, up to ContentionHotKeys, most conflicts first.
+func (tracker *contention) hotKeys() []*KeyContention {
+	tracker.lock.Lock()
+	hot := make([]*KeyContention, 0, len(tracker.conflicts))
+	for key, conflicts := range tracker.conflicts {
+		hot = append(hot, &KeyContention{Key: []byte(key), Conflicts: conflicts})
+	}
+	tracker.lock.Unlock()
+
+	slices.SortFunc(hot, func(first, second *KeyContention) int {
+		if first.Conflicts != second.Conflicts {
+			return cmp.Compare(second.Conflicts, first.Conflicts)
+		}
+
+		return bytes.Compare(first.Key, second.Key)
+	})
+
+	return hot[:min(len(hot), ContentionHotKeys)]
+}
+
+// stats
+//
+//	Get the retries, aborts and hottest keys.
+func (tracker *contention) stats() ContentionStats {
+	return ContentionStats{
+		Retries: atomic.LoadUint64(&tracker.retries),
+		Aborts:  atomic.LoadUint64(&tracker.aborts),
+		HotKeys: tracker.hotKeys(),
+	}
+}
+
+// warnContention
+//
+//	Log a warning with the hottest keys, and record a slow transaction, if a read-write transaction spent longer than the threshold retrying.
+func (mariInst *Mari) warnContention(retries int, startedAt time.Time) {
+	if retries == 0 || mariInst.contention.warnThreshold <= 0 {
+		return
+	}
+
+	elapsed := time.Since(startedAt)
+	if elapsed < mariInst.contention.warnThreshold {
+		return
+	}
+
+	mariInst.slowOps.record(&SlowOp{Op: ProfileOpUpdate, FinishedAt: time.Now(), Duration: elapsed, Retries: retries})
+
+	hotKeys := make([]string, 0, ContentionHotKeys)
+	for _, hot := range mariInst.contention.hotKeys() {
+		hotKeys = append(hotKeys, string(hot.Key))
+	}
+
+	mariInst.logger.Warn("read-write transaction retried on contention, writes to the hot keys conflict",
+		"duration", elapsed,
+		"retries", retries,
+		"hot keys", hotKeys,
+	)
+}
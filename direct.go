@@ -0,0 +1,240 @@
+package mariv2
+
+import (
+	"os"
+	"unsafe"
+)
+
+//============================================= Mari Direct Compaction
+
+// openDirectTempFile
+//
+//	Open the temporary file for compaction with direct I/O, truncating anything left by a failed compaction.
+//	If direct I/O is not supported by the platform or filesystem, nil is returned and the compaction falls back to the memory mapped temporary file.
+func (mariInst *Mari) openDirectTempFile(fileName string) *os.File {
+	if !mariInst.directCompaction || mariInst.anonymous {
+		return nil
+	}
+
+	file, openErr := openDirectFile(fileName, mariInst.fileMode)
+	if openErr != nil {
+		mariInst.logger.Warn("direct I/O not supported, compacting through the memory map", "error", openErr)
+		return nil
+	}
+
+	return file
+}
+
+// measureSubtree
+//
+//	Recursively determine the serialized size and key count of every subtree, by the offset of its root in the memory map.
+//	Direct I/O writes are sequential, so the offset of each child must be known before its parent is written.
+func (mariInst *Mari) measureSubtree(node *INode, sizes map[uint64]subtreeSize) (subtreeSize, error) {
+	measured := subtreeSize{
+		size: uint64(node.determineEndOffsetINode(mariInst.enableSubtreeCounts)) + 1,
+	}
+
+	measured.size += uint64(node.leaf.determineEndOffsetLNode(mariInst.enableValueChecksums)) + 1
+	if len(node.leaf.key) > 0 {
+		measured.count++
+	}
+
+	for _, child := range node.children {
+		childNode, measureErr := mariInst.readINodeFromMemMap(child.startOffset)
+		if measureErr != nil {
+			return subtreeSize{}, measureErr
+		}
+
+		childSize, measureErr := mariInst.measureSubtree(childNode, sizes)
+		if measureErr != nil {
+			return subtreeSize{}, measureErr
+		}
+
+		measured.size += childSize.size
+		measured.count += childSize.count
+	}
+
+	sizes[node.startOffset] = measured
+	return measured, nil
+}
+
+// serializeCurrentVersionDirect
+//
+//	Write the current version to the temporary file in the same layout as serializeCurrentVersionToNewFile, with direct I/O.
+//	The subtrees are measured first, so every node is complete when it is written and the file is written sequentially.
+//	Returns the offset after the serialized version.
+func (mariInst *Mari) serializeCurrentVersionDirect(compact *Compaction, root *INode) (uint64, error) {
+	sizes := make(map[uint64]subtreeSize)
+	measured, serializeErr := mariInst.measureSubtree(root, sizes)
+	if serializeErr != nil {
+		return 0, serializeErr
+	}
+
+	serializeErr = mariInst.serializeSubtreeDirect(compact, root, sizes, 0, InitRootOffset)
+	if serializeErr != nil {
+		return 0, serializeErr
+	}
+
+	return InitRootOffset + measured.size, nil
+}
+
+// serializeSubtreeDirect
+//
+//	Recursively append a node, its leaf, and then each of its children to the direct I/O writer.
+func (mariInst *Mari) serializeSubtreeDirect(compact *Compaction, node *INode, sizes map[uint64]subtreeSize, version, offset uint64) error {
+	measured := sizes[node.startOffset]
+
+	node.version = version
+	node.startOffset = offset
+	node.leaf.version = version
+	node.count = measured.count
+
+	sNode, serializeErr := node.serializeINode(true, mariInst.enableSubtreeCounts)
+	if serializeErr != nil {
+		return serializeErr
+	}
+
+	serializedKeyVal, serializeErr := node.leaf.serializeLNode(mariInst.enableValueChecksums)
+	if serializeErr != nil {
+		return serializeErr
+	}
+
+	childNodes := make([]*INode, len(node.children))
+	nextStartOffset := node.leaf.getEndOffsetLNode() + 1
+	for idx, child := range node.children {
+		sNode = append(sNode, serializeUint64(nextStartOffset)...)
+
+		childNodes[idx], serializeErr = mariInst.readINodeFromMemMap(child.startOffset)
+		if serializeErr != nil {
+			return serializeErr
+		}
+
+		nextStartOffset += sizes[child.startOffset].size
+	}
+
+	sNode = append(sNode, serializedKeyVal...)
+	mariInst.ioLimiter.wait(len(sNode))
+
+	serializeErr = compact.direct.write(sNode)
+	if serializeErr != nil {
+		return serializeErr
+	}
+
+	childOffset := node.leaf.getEndOffsetLNode() + 1
+	for _, childNode := range childNodes {
+		childSize := sizes[childNode.startOffset].size
+		serializeErr = mariInst.serializeSubtreeDirect(compact, childNode, sizes, version, childOffset)
+		if serializeErr != nil {
+			return serializeErr
+		}
+
+		childOffset += childSize
+	}
+
+	return nil
+}
+
+// newDirectWriter
+//
+//	Create a writer for a file opened with direct I/O. The metadata is reserved at the start of the file and written by finish.
+func newDirectWriter(file *os.File) *directWriter {
+	return &directWriter{
+		file:     file,
+		buffer:   alignedBuffer(DirectIOBufferSize),
+		buffered: MetaSize,
+	}
+}
+
+// write
+//
+//	Append bytes to the buffer, writing the buffer to the file each time it fills.
+func (writer *directWriter) write(data []byte) error {
+	for len(data) > 0 {
+		copied := copy(writer.buffer[writer.buffered:], data)
+		writer.buffered += copied
+		data = data[copied:]
+
+		if writer.buffered == len(writer.buffer) {
+			writeErr := writer.flush()
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+	}
+
+	return nil
+}
+
+// flush
+//
+//	Write the buffer to the file, padded with zeros to the alignment, and keep a copy of the first block.
+func (writer *directWriter) flush() error {
+	length := (writer.buffered + DirectIOAlignment - 1) &^ (DirectIOAlignment - 1)
+	clear(writer.buffer[writer.buffered:length])
+
+	if writer.offset == 0 && writer.head == nil {
+		writer.head = alignedBuffer(DirectIOAlignment)
+		copy(writer.head, writer.buffer[:DirectIOAlignment])
+	}
+
+	_, writeErr := writer.file.WriteAt(writer.buffer[:length], int64(writer.offset))
+	if writeErr != nil {
+		return writeErr
+	}
+
+	writer.offset += uint64(writer.buffered)
+	writer.buffered = 0
+	return nil
+}
+
+// finish
+//
+//	Write the remaining buffer and the metadata, then extend the file with free space like a resized memory map, since the padding of the last block is overwritten by the next commit.
+func (writer *directWriter) finish(sMeta []byte, endOffset uint64) error {
+	var finishErr error
+	if writer.offset == 0 {
+		copy(writer.buffer[MetaVersionIdx:MetaSize], sMeta)
+		finishErr = writer.flush()
+	} else {
+		finishErr = writer.flush()
+		if finishErr == nil {
+			copy(writer.head[MetaVersionIdx:MetaSize], sMeta)
+			_, finishErr = writer.file.WriteAt(writer.head, 0)
+		}
+	}
+
+	if finishErr != nil {
+		return finishErr
+	}
+
+	return writer.file.Truncate(compactedFileSize(endOffset))
+}
+
+// alignedBuffer
+//
+//	Allocate a buffer whose start is aligned to DirectIOAlignment, as direct I/O requires.
+func alignedBuffer(size int) []byte {
+	buffer := make([]byte, size+DirectIOAlignment)
+	shift := int(uintptr(unsafe.Pointer(&buffer[0])) & (DirectIOAlignment - 1))
+	if shift != 0 {
+		shift = DirectIOAlignment - shift
+	}
+
+	return buffer[shift : shift+size : shift+size]
+}
+
+// compactedFileSize
+//
+//	Determine the size of a compacted file, growing from the initial size like the temporary memory map until the serialized data fits.
+func compactedFileSize(endOffset uint64) int64 {
+	size := int64(DefaultPageSize) * 16 * 1000 // 64MB
+	for uint64(size) <= endOffset {
+		if size >= MaxResize {
+			size += MaxResize
+		} else {
+			size *= 2
+		}
+	}
+
+	return size
+}
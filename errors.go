@@ -0,0 +1,276 @@
+package mariv2
+
+import (
+	"errors"
+	"fmt"
+)
+
+//============================================= Mari Errors
+
+// ErrBusy is returned when closing or removing an instance while transactions or background workers are still active past the close timeout
+var ErrBusy = errors.New("instance is busy with active transactions or background workers")
+
+// ErrClosed is returned, wrapped in a StateError, by operations on an instance that is closing or closed
+var ErrClosed = errors.New("instance is closed")
+
+// ErrInternal is returned when an operation panics within Mari, instead of crashing the process
+var ErrInternal = errors.New("internal error in mari")
+
+// ErrNilTxOps is returned when a transaction is started with a nil transaction function
+var ErrNilTxOps = errors.New("transaction function is nil")
+
+// ErrEmptyKey is returned when writing or deleting a nil or empty key, since an empty key marks a node without a leaf in the trie
+var ErrEmptyKey = errors.New("key is nil or empty")
+
+// ErrEmptyValue is returned when writing a nil or empty value with EmptyValuesReject
+var ErrEmptyValue = errors.New("value is nil or empty")
+
+// ErrKeyNormalizerMismatch is returned when a file is opened with a different key normalizer than the one it was created with
+var ErrKeyNormalizerMismatch = errors.New("key normalizer does not match the key normalizer of the file")
+
+// ErrReservedKey is returned when writing or deleting a key under ReservedKeyPrefix, which is reserved for state persisted by Mari
+var ErrReservedKey = errors.New("key is under the reserved key prefix")
+
+// ErrKeyTooLarge is returned when writing a key longer than the max key size of the instance, or than MaxKeySize, since the key length is serialized in a single byte
+var ErrKeyTooLarge = errors.New("key is longer than the max key size")
+
+// ErrValueTooLarge is returned when writing a value longer than the max value size of the instance, or than MaxValueSize, since the length of a leaf node is serialized in two bytes
+var ErrValueTooLarge = errors.New("value is longer than the max value size")
+
+// ErrThrottled is returned, wrapped in a ThrottledError, when a transaction is rejected because the instance is over its limit on transactions per second
+var ErrThrottled = errors.New("instance is over its limit on transactions per second")
+
+// ErrInvalidValue is returned, wrapped in a ValidationError, when a key-value pair is rejected by a validator
+var ErrInvalidValue = errors.New("key-value pair rejected by a validator")
+
+// ErrQuotaExceeded is returned, wrapped in a QuotaError, when a commit is rejected because it would put a key prefix over its quota
+var ErrQuotaExceeded = errors.New("commit would put a key prefix over its quota")
+
+// ErrMemoryPressure is returned when a scan over ShedScansOver results is rejected because the instance is over its soft memory limit
+var ErrMemoryPressure = errors.New("instance is over its soft memory limit, scan rejected")
+
+// ErrReadOnlyStorage is returned when writing to an instance whose storage is wrapped with ReadOnlyStorage
+var ErrReadOnlyStorage = errors.New("storage is read only")
+
+// ErrReplicationAck is returned by a TCPSink when the replica does not ack the delta it was sent
+var ErrReplicationAck = errors.New("replica did not ack the delta")
+
+// ErrSnapshotChecksum is returned when applying a snapshot chunk whose key-value pairs do not match its checksum
+var ErrSnapshotChecksum = errors.New("snapshot chunk does not match its checksum")
+
+// ErrSnapshotOutOfOrder is returned when applying a snapshot chunk that does not follow the last chunk applied by the replica
+var ErrSnapshotOutOfOrder = errors.New("snapshot chunk does not follow the last chunk applied")
+
+// ErrQuorumNotReached is returned, wrapped in a QuorumError, when a quorum read does not get a reply from a quorum of the replicas
+var ErrQuorumNotReached = errors.New("quorum of replicas did not reply")
+
+// ErrColdValueMismatch is returned when a value read from the cold file does not match the checksum of its stub
+var ErrColdValueMismatch = errors.New("cold value does not match its checksum")
+
+// ErrNotLeader is returned when a read-write transaction is attempted on a follower
+var ErrNotLeader = errors.New("instance is a follower, read-write transactions are only accepted by the leader")
+
+// ErrUnsupportedFormat is returned when opening a file written with a different serialized format version
+var ErrUnsupportedFormat = errors.New("unsupported file format version")
+
+// ErrKeyLocked is returned when writing a key held by a prepared transaction
+var ErrKeyLocked = errors.New("key is locked by a prepared transaction")
+
+// ErrKeyLockHeld is returned when a transaction writes a key held by an advisory lock that the transaction was not started through
+var ErrKeyLockHeld = errors.New("key is held by an advisory lock")
+
+// ErrKeyLockReleased is returned when using an advisory lock that has already been released
+var ErrKeyLockReleased = errors.New("key lock has already been released")
+
+// ErrTxPrepared is returned when preparing a transaction with an id that is already prepared
+var ErrTxPrepared = errors.New("transaction is already prepared")
+
+// ErrPreparedTxNotFound is returned when committing or rolling back a transaction that is not prepared
+var ErrPreparedTxNotFound = errors.New("prepared transaction not found")
+
+// ErrChangefeedReset is returned by a changefeed when compaction resets the versions of the instance, so the changefeed can not continue from its last version and its cursor must be reset
+var ErrChangefeedReset = errors.New("versions were reset by compaction, reset the changefeed cursor")
+
+// ErrVersionNotFound is returned when a version or timestamp is older than the retained history of the instance
+var ErrVersionNotFound = errors.New("version is not retained in the history of the instance")
+
+// ErrCheckpointNotFound is returned when no checkpoint is recorded with a name
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// ErrStaleFencingToken is returned when a read-write transaction is checked with a fencing token lower than the highest token seen by the instance, since a newer leader was elected
+var ErrStaleFencingToken = errors.New("fencing token is lower than the highest token seen")
+
+// ErrStaleVersion is returned by UpdateTxIf when the latest commit is not the expected commit, since another transaction committed first
+var ErrStaleVersion = errors.New("latest version is not the expected version")
+
+// ErrVersionNotReached is returned when ReadTxAtLeast times out waiting for the instance to reach a commit timestamp
+var ErrVersionNotReached = errors.New("instance did not reach the version before the timeout")
+
+// ErrTxConflict is returned when a transaction started with Begin can not be committed, because another transaction committed a conflicting write first or the file is being resized or compacted
+var ErrTxConflict = errors.New("transaction could not be committed on the version it started from, begin a new transaction and retry")
+
+// ErrTxDone is returned when committing or rolling back a transaction that has already been committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// ErrTxNotManaged is returned when committing or rolling back a transaction passed to ReadTx or UpdateTx
+var ErrTxNotManaged = errors.New("transaction was not started with Begin, it is committed when the transaction function returns")
+
+// ErrReadTxTimeout is returned by operations in a read only transaction that has run past the abort threshold
+var ErrReadTxTimeout = errors.New("read only transaction exceeded the abort threshold")
+
+// ErrIteratorClosed is returned when closing an iterator that has already been closed
+var ErrIteratorClosed = errors.New("iterator has already been closed")
+
+// ErrConflict is returned when a key read with GetForUpdate was written by another transaction before the transaction committed. It wraps ErrTxConflict
+var ErrConflict = fmt.Errorf("%w: a key read for update was modified", ErrTxConflict)
+
+// ErrSnapshotViolation is returned when a scan reaches a node written after the version pinned by the transaction, which would break snapshot isolation
+var ErrSnapshotViolation = errors.New("scan reached a version newer than the transaction snapshot")
+
+// ErrCorrupt is returned, wrapped in a RegionError, when a region of the memory map can not be read as a valid node or metadata
+var ErrCorrupt = errors.New("corrupt data in memory map")
+
+// ErrIOURingUnavailable is returned by Open with FlushBackendIOURing when an io_uring can not be set up, like on platforms other than linux or kernels with io_uring disabled
+var ErrIOURingUnavailable = errors.New("io_uring is not available")
+
+// ErrOutOfBounds is returned, wrapped in a RegionError, when a write would extend past the end of the memory map
+var ErrOutOfBounds = errors.New("region is outside of the memory map")
+
+// ErrQuarantined is returned, wrapped in a QuarantineError, when an operation reads a quarantined subtree
+var ErrQuarantined = errors.New("key prefix is quarantined")
+
+// ErrAlreadyOpen is returned, wrapped in an AlreadyOpenError, when a file is opened while another instance in the process has it open
+var ErrAlreadyOpen = errors.New("file is already open in this process")
+
+// ErrNoValueChecksums is returned when verifying a value in a file that was not written with value checksums
+var ErrNoValueChecksums = errors.New("file was not written with value checksums, enable value checksums and compact the file")
+
+// ErrChecksumMismatch is returned, wrapped in a RegionError, when a value does not match the checksum serialized with it. It wraps ErrCorrupt
+var ErrChecksumMismatch = fmt.Errorf("%w: value does not match its checksum", ErrCorrupt)
+
+// Error
+//
+//	Format the operation, the location of the region, and the reason it is invalid.
+func (regionErr *RegionError) Error() string {
+	return fmt.Sprintf("%s: %s at offset %d, length %d, memory map size %d: %s",
+		regionErr.Err, regionErr.Op, regionErr.Offset, regionErr.Length, regionErr.MapSize, regionErr.Reason,
+	)
+}
+
+// Unwrap
+//
+//	Get the sentinel error, so the kind of region error can be checked with errors.Is.
+func (regionErr *RegionError) Unwrap() error {
+	return regionErr.Err
+}
+
+// checkRegion
+//
+//	Validate that a region is within the memory map before slicing it, so an invalid offset is reported with its location instead of panicking.
+//	Overflowing offsets are handled by comparing the length to the remaining size of the memory map.
+func checkRegion(mMap MMap, op string, offset, length uint64, sentinel error) error {
+	mapSize := uint64(len(mMap))
+	if offset > mapSize || length > mapSize-offset {
+		return &RegionError{Op: op, Offset: offset, Length: length, MapSize: mapSize, Reason: "region extends past the end of the memory map", Err: sentinel}
+	}
+
+	return nil
+}
+
+// Error
+//
+//	Format the quarantined prefix and the corruption found in the subtree.
+func (quarantineErr *QuarantineError) Error() string {
+	return fmt.Sprintf("%s: prefix %x at offset %d: %s", ErrQuarantined, quarantineErr.Prefix, quarantineErr.Offset, quarantineErr.Err)
+}
+
+// Unwrap
+//
+//	Get ErrQuarantined and the corruption found in the subtree, so both ErrQuarantined and ErrCorrupt can be checked with errors.Is.
+func (quarantineErr *QuarantineError) Unwrap() []error {
+	return []error{ErrQuarantined, quarantineErr.Err}
+}
+
+// Error
+//
+//	Format the operation and the state it was invoked in.
+func (stateErr *StateError) Error() string {
+	return fmt.Sprintf("%s: %s invoked while the instance is %s", ErrClosed, stateErr.Op, stateErr.State)
+}
+
+// Unwrap
+//
+//	Get ErrClosed, so the error can be checked with errors.Is.
+func (stateErr *StateError) Unwrap() error {
+	return ErrClosed
+}
+
+// Error
+//
+//	Format the operation and how long until it can be retried.
+func (throttledErr *ThrottledError) Error() string {
+	return fmt.Sprintf("%s: %s can be retried after %s", ErrThrottled, throttledErr.Op, throttledErr.RetryAfter)
+}
+
+// Unwrap
+//
+//	Get ErrThrottled, so the error can be checked with errors.Is.
+func (throttledErr *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+// Error
+//
+//	Format the prefix of the quota exceeded, with the usage of the prefix and the limits of the quota.
+func (quotaErr *QuotaError) Error() string {
+	return fmt.Sprintf("%s: prefix %s would have %d keys and %d bytes, quota is %d keys and %d bytes", ErrQuotaExceeded, printableKey(quotaErr.Prefix), quotaErr.Keys, quotaErr.Bytes, quotaErr.MaxKeys, quotaErr.MaxBytes)
+}
+
+// Unwrap
+//
+//	Get ErrQuotaExceeded, so the error can be checked with errors.Is.
+func (quotaErr *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Error
+//
+//	Format the path of the file that is already open.
+func (alreadyOpenErr *AlreadyOpenError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrAlreadyOpen, alreadyOpenErr.Path)
+}
+
+// Unwrap
+//
+//	Get ErrAlreadyOpen, so the error can be checked with errors.Is.
+func (alreadyOpenErr *AlreadyOpenError) Unwrap() error {
+	return ErrAlreadyOpen
+}
+
+// Error
+//
+//	Format the key rejected, the prefix of the validator, and the error of the validator.
+func (validationErr *ValidationError) Error() string {
+	return fmt.Sprintf("%s: key %s under prefix %s: %s", ErrInvalidValue, printableKey(validationErr.Key), printableKey(validationErr.Prefix), validationErr.Err)
+}
+
+// Unwrap
+//
+//	Get ErrInvalidValue and the error of the validator, so either can be checked with errors.Is.
+func (validationErr *ValidationError) Unwrap() []error {
+	return []error{ErrInvalidValue, validationErr.Err}
+}
+
+// Error
+//
+//	Format how many replicas replied out of the quorum, and the errors of the replicas that did not.
+func (quorumErr *QuorumError) Error() string {
+	return fmt.Sprintf("%s: %d of %d replied: %s", ErrQuorumNotReached, quorumErr.Replied, quorumErr.Quorum, errors.Join(quorumErr.Errs...))
+}
+
+// Unwrap
+//
+//	Get ErrQuorumNotReached and the errors of the replicas, so any of them can be checked with errors.Is.
+func (quorumErr *QuorumError) Unwrap() []error {
+	return append([]error{ErrQuorumNotReached}, quorumErr.Errs...)
+}
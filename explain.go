@@ -0,0 +1,74 @@
+package mariv2
+
+import "time"
+
+//============================================= Mari Explain
+
+// Explain
+//
+//	Run operations on the transaction while recording the nodes visited, the offsets and bytes read from the memory map, and the nodes path copied.
+//	The trace is attached to the root of the transaction and passed down to every node traversed, so the operations are traced without slowing untraced transactions.
+//	The trace is returned and logged through the instance logger, to debug unexpectedly slow operations.
+func (tx *Tx) Explain(op func(tx *Tx) error) (*TxTrace, error) {
+	if op == nil {
+		return nil, ErrNilTxOps
+	}
+
+	trace := &TxTrace{active: true}
+	loadINodeFromPointer(tx.root).trace = trace
+
+	start := time.Now()
+	opErr := op(tx)
+	trace.Duration = time.Since(start)
+
+	trace.active = false
+	loadINodeFromPointer(tx.root).trace = nil
+
+	tx.store.logger.Info("transaction trace",
+		"nodesVisited", trace.NodesVisited,
+		"nodesRead", trace.NodesRead,
+		"bytesRead", trace.BytesRead,
+		"pathCopies", trace.PathCopies,
+		"duration", trace.Duration,
+	)
+
+	return trace, opErr
+}
+
+// recordVisit
+//
+//	Record an internal node traversed by a traced operation.
+func (trace *TxTrace) recordVisit() {
+	if trace == nil || !trace.active {
+		return
+	}
+
+	trace.NodesVisited++
+}
+
+// recordRead
+//
+//	Record an internal node and its leaf read from the memory map by a traced operation.
+func (trace *TxTrace) recordRead(node *INode) {
+	if trace == nil || !trace.active {
+		return
+	}
+
+	trace.NodesRead++
+	trace.OffsetsRead = append(trace.OffsetsRead, node.startOffset)
+	trace.BytesRead += uint64(node.endOffset) + 1
+	if node.leaf != nil {
+		trace.BytesRead += uint64(node.leaf.endOffset) + 1
+	}
+}
+
+// recordCopy
+//
+//	Record an internal node path copied by a traced operation.
+func (trace *TxTrace) recordCopy() {
+	if trace == nil || !trace.active {
+		return
+	}
+
+	trace.PathCopies++
+}
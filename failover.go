@@ -0,0 +1,355 @@
+package mariv2
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Failover
+
+// Promote
+//
+//	Promote the instance to leader so read-write transactions are accepted.
+//	Returns true if the instance was previously a follower.
+func (mariInst *Mari) Promote() bool {
+	return atomic.CompareAndSwapUint32(&mariInst.isFollower, 1, 0)
+}
+
+// Demote
+//
+//	Demote the instance to follower so read-write transactions are rejected with ErrNotLeader.
+//	Returns true if the instance was previously the leader.
+func (mariInst *Mari) Demote() bool {
+	return atomic.CompareAndSwapUint32(&mariInst.isFollower, 0, 1)
+}
+
+// IsLeader
+//
+//	Determine whether the instance currently accepts read-write transactions.
+func (mariInst *Mari) IsLeader() bool {
+	return atomic.LoadUint32(&mariInst.isFollower) == 0
+}
+
+// NewFailover
+//
+//	Create a lease based coordinator for the instance.
+//	The instance is demoted to follower immediately, and is only promoted once the coordinator holds the lease.
+//	The lease is not checked until Start is called, or Tick is called manually.
+func (mariInst *Mari) NewFailover(opts FailoverOpts) (*Failover, error) {
+	if opts.ID == "" {
+		return nil, errors.New("failover requires an instance id")
+	}
+
+	if opts.Store == nil {
+		return nil, errors.New("failover requires a lease store")
+	}
+
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
+
+	if opts.RenewInterval <= 0 {
+		opts.RenewInterval = opts.LeaseDuration / 3
+	}
+
+	mariInst.Demote()
+	return &Failover{
+		store:    mariInst,
+		opts:     opts,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}, nil
+}
+
+// Start
+//
+//	Run the coordinator in a separate go routine, checking the lease on every renew interval until Stop is called.
+//	Only the first call starts the coordinator, later calls do nothing.
+func (failover *Failover) Start() {
+	if !atomic.CompareAndSwapUint32(&failover.started, 0, 1) {
+		return
+	}
+
+	go failover.store.runLabeled(ProfileSubsystemFailover, failover.handleLease)
+}
+
+// Stop
+//
+//	Stop the coordinator. The lease is not released, so another instance is only promoted once it lapses. Use Resign to hand off immediately.
+//	If the coordinator was never started, Stop returns immediately, and a later Start exits without checking the lease.
+func (failover *Failover) Stop() {
+	select {
+	case <-failover.stopChan:
+		return
+	default:
+		close(failover.stopChan)
+	}
+
+	if atomic.LoadUint32(&failover.started) == 0 {
+		return
+	}
+
+	<-failover.doneChan
+}
+
+// Resign
+//
+//	Expire the lease if it is held by this instance and demote the instance, so another instance can be promoted without waiting for the lease to lapse.
+func (failover *Failover) Resign(ctx context.Context) error {
+	lease, loadErr := failover.opts.Store.Load(ctx)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	failover.demote()
+	if lease == nil || lease.Holder != failover.opts.ID {
+		return nil
+	}
+
+	expired := &Lease{Holder: lease.Holder, Term: lease.Term, Expires: time.Now()}
+	_, swapErr := failover.opts.Store.CompareAndSwap(ctx, lease, expired)
+	return swapErr
+}
+
+// Term
+//
+//	The term of the last lease observed by the coordinator, or 0 if no lease has been observed.
+func (failover *Failover) Term() uint64 {
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+
+	if failover.lease == nil {
+		return 0
+	}
+
+	return failover.lease.Term
+}
+
+// Tick
+//
+//	Perform a single round of lease maintenance.
+//	If this instance holds an unexpired lease, it is renewed.
+//	If the lease has lapsed, this instance attempts to acquire it with the next term and is promoted on success.
+//	If another instance holds an unexpired lease, this instance is demoted.
+func (failover *Failover) Tick(ctx context.Context) error {
+	lease, loadErr := failover.opts.Store.Load(ctx)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	now := time.Now()
+	failover.setLease(lease)
+
+	switch {
+	case lease != nil && now.Before(lease.Expires) && lease.Holder != failover.opts.ID:
+		failover.demote()
+		return nil
+	case lease != nil && now.Before(lease.Expires):
+		renewed := &Lease{Holder: failover.opts.ID, Term: lease.Term, Expires: now.Add(failover.opts.LeaseDuration)}
+		return failover.swapLease(ctx, lease, renewed)
+	default:
+		var nextTerm uint64 = 1
+		if lease != nil {
+			nextTerm = lease.Term + 1
+		}
+
+		acquired := &Lease{Holder: failover.opts.ID, Term: nextTerm, Expires: now.Add(failover.opts.LeaseDuration)}
+		return failover.swapLease(ctx, lease, acquired)
+	}
+}
+
+// handleLease
+//
+//	Run in a separate go routine.
+//	Ticks on every renew interval. If the lease cannot be checked, the instance is demoted since it can no longer prove it holds the lease.
+func (failover *Failover) handleLease() {
+	defer close(failover.doneChan)
+
+	select {
+	case <-failover.stopChan:
+		return
+	default:
+	}
+
+	ticker := time.NewTicker(failover.opts.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), failover.opts.RenewInterval)
+		tickErr := failover.Tick(ctx)
+		cancel()
+
+		if tickErr != nil {
+			failover.demote()
+		}
+
+		select {
+		case <-failover.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// swapLease
+//
+//	Attempt to replace the observed lease. On success the instance is promoted, otherwise another instance won and this instance is demoted.
+func (failover *Failover) swapLease(ctx context.Context, prev, next *Lease) error {
+	ok, swapErr := failover.opts.Store.CompareAndSwap(ctx, prev, next)
+	if swapErr != nil {
+		return swapErr
+	}
+
+	if !ok {
+		failover.demote()
+		return nil
+	}
+
+	prevTerm := failover.setLease(next)
+	if failover.store.Promote() || prevTerm != next.Term {
+		if failover.opts.OnPromote != nil {
+			failover.opts.OnPromote(next.Term)
+		}
+	}
+
+	return nil
+}
+
+// demote
+//
+//	Demote the instance, calling the demote hook if the instance was previously the leader.
+func (failover *Failover) demote() {
+	if failover.store.Demote() && failover.opts.OnDemote != nil {
+		failover.opts.OnDemote()
+	}
+}
+
+// setLease
+//
+//	Record the last lease observed by the coordinator, returning the term of the lease it replaced, or 0 if no lease had been observed.
+func (failover *Failover) setLease(lease *Lease) uint64 {
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+
+	var prevTerm uint64
+	if failover.lease != nil {
+		prevTerm = failover.lease.Term
+	}
+
+	failover.lease = lease
+	return prevTerm
+}
+
+//============================================= Key Lease Store
+
+// NewKeyLeaseStore
+//
+//	Create a lease store that persists the lease in a designated key of a mari instance.
+//	Writes to the key bypass the leader check, since a follower needs to write the lease to be promoted.
+func NewKeyLeaseStore(mariInst *Mari, key []byte) *KeyLeaseStore {
+	return &KeyLeaseStore{store: mariInst, key: key}
+}
+
+// Load
+//
+//	Read the lease from the designated key.
+func (leaseStore *KeyLeaseStore) Load(ctx context.Context) (*Lease, error) {
+	var lease *Lease
+	loadErr := leaseStore.store.ReadTx(func(tx *Tx) error {
+		var getErr error
+		lease, getErr = leaseStore.get(tx)
+		return getErr
+	})
+
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return lease, nil
+}
+
+// CompareAndSwap
+//
+//	Replace the lease in the designated key if it still matches prev.
+//	The compare and the write happen in the same read-write transaction, so concurrent swaps on the same instance cannot both succeed.
+func (leaseStore *KeyLeaseStore) CompareAndSwap(ctx context.Context, prev, next *Lease) (bool, error) {
+	var swapped bool
+	swapErr := leaseStore.store.updateTx(func(tx *Tx) error {
+		curr, getErr := leaseStore.get(tx)
+		if getErr != nil {
+			return getErr
+		}
+
+		swapped = leaseEqual(curr, prev)
+		if !swapped {
+			return nil
+		}
+		return tx.Put(leaseStore.key, serializeLease(next))
+	})
+
+	if swapErr != nil {
+		return false, swapErr
+	}
+	return swapped, nil
+}
+
+// get
+//
+//	Read and deserialize the lease key within a transaction.
+func (leaseStore *KeyLeaseStore) get(tx *Tx) (*Lease, error) {
+	kvPair, getErr := tx.get(leaseStore.key)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if kvPair == nil || len(kvPair.Value) == 0 {
+		return nil, nil
+	}
+	return deserializeLease(kvPair.Value)
+}
+
+// leaseEqual
+//
+//	Two leases are equal if they have the same holder, term, and expiration.
+func leaseEqual(a, b *Lease) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Holder == b.Holder && a.Term == b.Term && a.Expires.Equal(b.Expires)
+}
+
+// serializeLease
+//
+//	Serialize a lease as the term (8 bytes), the expiration in unix nanoseconds (8 bytes), and the holder.
+func serializeLease(lease *Lease) []byte {
+	sLease := serializeUint64(lease.Term)
+	sLease = append(sLease, serializeUint64(uint64(lease.Expires.UnixNano()))...)
+	return append(sLease, []byte(lease.Holder)...)
+}
+
+// deserializeLease
+//
+//	Deserialize the byte representation of a lease.
+func deserializeLease(sLease []byte) (*Lease, error) {
+	if len(sLease) < 2*OffsetSize64 {
+		return nil, errors.New("invalid data length for serialized lease")
+	}
+
+	term, desErr := deserializeUint64(sLease[:OffsetSize64])
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	expires, desErr := deserializeUint64(sLease[OffsetSize64 : 2*OffsetSize64])
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	return &Lease{
+		Holder:  string(sLease[2*OffsetSize64:]),
+		Term:    term,
+		Expires: time.Unix(0, int64(expires)),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package mariv2
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//============================================= Mari File
+
+// openFile
+//
+//	Open the file for the instance, creating it with the file mode of the instance if it does not exist.
+//	An anonymous instance creates an unnamed file in the directory instead, which is never linked into the directory.
+func (mariInst *Mari) openFile(fileName string) (*os.File, error) {
+	if mariInst.anonymous {
+		return openAnonymousFile(mariInst.filepath, mariInst.fileMode)
+	}
+
+	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	return os.OpenFile(fileName, flag, mariInst.fileMode)
+}
+
+// createUnlinkedFile
+//
+//	Create a file in the directory and remove its name immediately, for platforms or filesystems without O_TMPFILE.
+//	The file is reclaimed when closed, but a crash between the create and the remove leaves the named file behind.
+func createUnlinkedFile(dir string, mode os.FileMode) (*os.File, error) {
+	file, createErr := os.CreateTemp(dir, "mari-anonymous-*")
+	if createErr != nil {
+		return nil, createErr
+	}
+
+	createErr = os.Remove(file.Name())
+	if createErr == nil {
+		createErr = file.Chmod(mode)
+	}
+
+	if createErr != nil {
+		file.Close()
+		return nil, createErr
+	}
+
+	return file, nil
+}
+
+// streamFile
+//
+//	Copy the bytes of a file from the offset up to the length into the same offsets of another file, through a buffer in user space.
+//	Used to copy a file when the kernel can not copy it, like across filesystems on older kernels or on platforms without copy_file_range.
+func streamFile(dst, src *os.File, offset, length int64) error {
+	buffer := make([]byte, CloneBufferSize)
+	_, copyErr := io.CopyBuffer(io.NewOffsetWriter(dst, offset), io.NewSectionReader(src, offset, length-offset), buffer)
+	return copyErr
+}
+
+// punchFreeSpace
+//
+//	Punch a hole from the end of the serialized data, rounded up to the page size, to the end of the file, so blocks allocated for the pre-allocated space are released while the file keeps its size.
+//	Compaction writes the compacted data to a new file, so any blocks past the compacted data, like the tail of the last buffer written with direct I/O, are reclaimed.
+func (mariInst *Mari) punchFreeSpace(endOffset uint64) error {
+	fileInfo, statErr := mariInst.file.Stat()
+	if statErr != nil {
+		return statErr
+	}
+
+	pageSize := uint64(DefaultPageSize)
+	start := int64((endOffset + pageSize - 1) / pageSize * pageSize)
+	if start >= fileInfo.Size() {
+		return nil
+	}
+
+	return punchHole(mariInst.file, start, fileInfo.Size()-start)
+}
+
+// syncFile
+//
+//	Sync a file to disk, unless flushing is disabled.
+func syncFile(file *os.File, disableFlush bool) error {
+	if disableFlush {
+		return nil
+	}
+
+	return file.Sync()
+}
+
+// syncDir
+//
+//	Sync the directory containing a file, so a created or renamed directory entry is durable.
+//	Only runs if the instance was opened with SyncDirectory.
+func (mariInst *Mari) syncDir(fileName string) error {
+	if !mariInst.syncDirectory || mariInst.anonymous {
+		return nil
+	}
+
+	return syncDirectory(filepath.Dir(fileName))
+}
+
+// syncDirectory
+//
+//	Sync a directory, so the entries created or renamed in it are durable.
+func syncDirectory(path string) error {
+	dir, openErr := os.Open(path)
+	if openErr != nil {
+		return openErr
+	}
+
+	defer dir.Close()
+	return dir.Sync()
+}
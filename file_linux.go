@@ -0,0 +1,128 @@
+//go:build linux
+
+package mariv2
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+//============================================= Mari File (linux)
+
+// datasyncFile
+//
+//	Sync the contents of a file to disk with fdatasync, which skips metadata like the modification time that is not needed to read the file back.
+func datasyncFile(file *os.File) error {
+	return unix.Fdatasync(int(file.Fd()))
+}
+
+// openDirectFile
+//
+//	Open a file with O_DIRECT, truncating it, so writes bypass the page cache.
+//	Filesystems without direct I/O, like tmpfs, return an error.
+func openDirectFile(fileName string, mode os.FileMode) (*os.File, error) {
+	return os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC|unix.O_DIRECT, mode)
+}
+
+// openAnonymousFile
+//
+//	Create an unnamed file in the directory with O_TMPFILE.
+//	If the filesystem does not support O_TMPFILE, the file is created and then unlinked.
+func openAnonymousFile(dir string, mode os.FileMode) (*os.File, error) {
+	file, openErr := os.OpenFile(dir, os.O_RDWR|os.O_APPEND|unix.O_TMPFILE, mode)
+	if openErr == nil {
+		return file, nil
+	}
+
+	if errors.Is(openErr, unix.EOPNOTSUPP) || errors.Is(openErr, unix.EISDIR) {
+		return createUnlinkedFile(dir, mode)
+	}
+
+	return nil, openErr
+}
+
+// memoryDir
+//
+//	Get the directory for files held in memory, which is the tmpfs mounted at /dev/shm, or the temp directory if it is not mounted.
+func memoryDir() string {
+	fileInfo, statErr := os.Stat("/dev/shm")
+	if statErr != nil || !fileInfo.IsDir() {
+		return os.TempDir()
+	}
+
+	return "/dev/shm"
+}
+
+// cloneFile
+//
+//	Copy the first length bytes of a file into an empty file.
+//	The file is cloned with FICLONE on filesystems with reflinks, which shares every extent of the file, so the clone has the size of the file.
+//	Otherwise the bytes are copied with copy_file_range, which can still share extents or copy on the server for network filesystems, and if that is not supported, the rest are streamed.
+func cloneFile(dst, src *os.File, length int64) error {
+	cloneErr := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	if cloneErr == nil || !cloneUnsupported(cloneErr) {
+		return cloneErr
+	}
+
+	var copied int64
+	for copied < length {
+		srcOffset, dstOffset := copied, copied
+		total, copyErr := unix.CopyFileRange(int(src.Fd()), &srcOffset, int(dst.Fd()), &dstOffset, int(length-copied), 0)
+		switch {
+		case errors.Is(copyErr, unix.EINTR):
+			continue
+		case copyErr != nil && cloneUnsupported(copyErr):
+			return streamFile(dst, src, copied, length)
+		case copyErr != nil:
+			return copyErr
+		case total == 0:
+			return io.ErrUnexpectedEOF
+		}
+
+		copied += int64(total)
+	}
+
+	return nil
+}
+
+// cloneUnsupported
+//
+//	Determine if FICLONE or copy_file_range failed because the filesystems or kernel do not support it, so the copy falls back.
+func cloneUnsupported(cloneErr error) bool {
+	for _, unsupported := range []error{unix.EOPNOTSUPP, unix.ENOTTY, unix.ENOSYS, unix.EXDEV, unix.EINVAL} {
+		if errors.Is(cloneErr, unsupported) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// punchHole
+//
+//	Release the blocks of a region of a file with FALLOC_FL_PUNCH_HOLE, keeping the size of the file, so the region reads back as zeros without taking space on disk.
+//	Filesystems without hole punching return an error that is ignored, since the region is only unused space.
+func punchHole(file *os.File, offset, length int64) error {
+	punchErr := unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, offset, length)
+	if errors.Is(punchErr, unix.EOPNOTSUPP) || errors.Is(punchErr, unix.ENOSYS) {
+		return nil
+	}
+
+	return punchErr
+}
+
+// allocatedSize
+//
+//	Get the bytes allocated on disk for a file from the blocks it holds, which is less than its size when the file is sparse.
+func allocatedSize(file *os.File) (int64, error) {
+	var stat unix.Stat_t
+	statErr := unix.Fstat(int(file.Fd()), &stat)
+	if statErr != nil {
+		return 0, statErr
+	}
+
+	return stat.Blocks * 512, nil
+}
@@ -0,0 +1,64 @@
+//go:build !linux
+
+package mariv2
+
+import (
+	"errors"
+	"os"
+)
+
+//============================================= Mari File (other)
+
+// datasyncFile
+//
+//	Sync the contents of a file to disk. fdatasync is not available on every platform, so the file is synced with fsync.
+func datasyncFile(file *os.File) error {
+	return file.Sync()
+}
+
+// openDirectFile
+//
+//	Direct I/O is only supported on linux, so an error is returned and compaction writes through the memory map.
+func openDirectFile(fileName string, mode os.FileMode) (*os.File, error) {
+	return nil, errors.New("direct I/O is not supported on this platform")
+}
+
+// openAnonymousFile
+//
+//	Create an unnamed file in the directory. O_TMPFILE is only available on linux, so the file is created and then unlinked.
+func openAnonymousFile(dir string, mode os.FileMode) (*os.File, error) {
+	return createUnlinkedFile(dir, mode)
+}
+
+// memoryDir
+//
+//	Get the directory for files held in memory. There is no standard memory backed filesystem on every platform, so the temp directory is used.
+func memoryDir() string {
+	return os.TempDir()
+}
+
+// cloneFile
+//
+//	Copy the first length bytes of a file into an empty file. FICLONE and copy_file_range are only available on linux, so the bytes are streamed.
+func cloneFile(dst, src *os.File, length int64) error {
+	return streamFile(dst, src, 0, length)
+}
+
+// punchHole
+//
+//	Hole punching is only supported on linux, so the region keeps its blocks.
+func punchHole(file *os.File, offset, length int64) error {
+	return nil
+}
+
+// allocatedSize
+//
+//	The blocks allocated for a file are only read on linux, so the size of the file is returned.
+func allocatedSize(file *os.File) (int64, error) {
+	fileInfo, statErr := file.Stat()
+	if statErr != nil {
+		return 0, statErr
+	}
+
+	return fileInfo.Size(), nil
+}
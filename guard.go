@@ -0,0 +1,197 @@
+package mariv2
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+//============================================= Mari Read Guard
+
+// startReadGuard
+//
+//	Track a read only transaction as active, pinning its snapshot version, and record its start time if a warning or abort threshold is set.
+//	With a warning threshold, the stack of the caller is captured, so a transaction still open past the threshold can be reported before it finishes.
+//	Long running reads hold the resize read lock, so they block resizing and compaction, which is what lets the file grow with old versions.
+func (mariInst *Mari) startReadGuard(tx *Tx) {
+	atomic.AddInt64(&mariInst.activeReadTxs, 1)
+	if mariInst.readTxWarnThreshold > 0 || mariInst.readTxAbortThreshold > 0 {
+		tx.startedAt = time.Now()
+	}
+
+	if mariInst.readTxWarnThreshold > 0 {
+		stack := make([]uintptr, ReadTxStackDepth)
+		tx.stack = stack[:runtime.Callers(3, stack)]
+	}
+
+	if mariInst.readTxAbortThreshold > 0 {
+		tx.deadline = tx.startedAt.Add(mariInst.readTxAbortThreshold)
+	}
+
+	mariInst.readPins.pin(tx)
+}
+
+// finishReadGuard
+//
+//	Stop tracking a read only transaction and unpin its snapshot version, recording a slow transaction if it ran past the warning threshold.
+//	A warning is logged with the stack that started the transaction, unless it was already reported while open, in which case only its duration is logged.
+func (mariInst *Mari) finishReadGuard(tx *Tx) {
+	atomic.AddInt64(&mariInst.activeReadTxs, -1)
+	reported := mariInst.readPins.unpin(tx)
+	if mariInst.readTxWarnThreshold <= 0 || tx.startedAt.IsZero() {
+		return
+	}
+
+	elapsed := time.Since(tx.startedAt)
+	if elapsed < mariInst.readTxWarnThreshold {
+		return
+	}
+
+	atomic.AddUint64(&mariInst.longReadTxs, 1)
+	mariInst.slowOps.record(&SlowOp{Op: ProfileOpRead, FinishedAt: time.Now(), Duration: elapsed, Version: tx.snapshotVersion})
+	if reported {
+		mariInst.logger.Warn("long running read transaction finished", "duration", elapsed, "version", tx.snapshotVersion)
+		return
+	}
+
+	mariInst.logger.Warn("long running read transaction, resizing and compaction are blocked while it is open",
+		"duration", elapsed,
+		"version", tx.snapshotVersion,
+		"stack", formatStack(tx.stack),
+	)
+}
+
+// handleReadGuard
+//
+//	Run in a separate go routine.
+//	Periodically log a warning for each read only transaction still open past the warning threshold, with the stack that started it, so a transaction that never finishes is still reported.
+//	Each transaction is only reported once while it is open.
+func (mariInst *Mari) handleReadGuard() {
+	defer mariInst.workers.Done()
+
+	if mariInst.readTxWarnThreshold <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(max(mariInst.readTxWarnThreshold/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			for _, tx := range mariInst.readPins.overdue(mariInst.readTxWarnThreshold) {
+				mariInst.logger.Warn("long running read transaction still open, resizing and compaction are blocked while it is open",
+					"age", time.Since(tx.startedAt),
+					"version", tx.snapshotVersion,
+					"stack", formatStack(tx.stack),
+				)
+			}
+		}
+	}
+}
+
+// checkReadGuard
+//
+//	Stop a read only transaction that has run past the abort threshold, which is checked at the start of each read operation.
+//	An operation already in progress is not interrupted.
+func (tx *Tx) checkReadGuard() error {
+	if tx.deadline.IsZero() || time.Now().Before(tx.deadline) {
+		return nil
+	}
+
+	return ErrReadTxTimeout
+}
+
+// newReadPins
+//
+//	Create the read pins with every shard empty.
+func newReadPins() *readPins {
+	readPins := &readPins{}
+	for idx := range readPins.shards {
+		readPins.shards[idx].pins = make(map[uint64]int)
+		readPins.shards[idx].open = make(map[*Tx]struct{})
+	}
+
+	return readPins
+}
+
+// shard
+//
+//	Get the shard of a read only transaction, from its address, so it is unpinned from the shard it was pinned in.
+func (readPins *readPins) shard(tx *Tx) *readPinShard {
+	return &readPins.shards[(uintptr(unsafe.Pointer(tx))>>6)%ReadPinShards]
+}
+
+// pin
+//
+//	Count a read only transaction reading a version, and track the transaction if its stack was captured.
+func (readPins *readPins) pin(tx *Tx) {
+	shard := readPins.shard(tx)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shard.pins[tx.snapshotVersion]++
+	if tx.stack != nil {
+		shard.open[tx] = struct{}{}
+	}
+}
+
+// unpin
+//
+//	Remove a read only transaction reading a version, dropping the version once no transaction in the shard reads it.
+//	Returns whether the transaction was reported as open past the warning threshold.
+func (readPins *readPins) unpin(tx *Tx) bool {
+	shard := readPins.shard(tx)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shard.pins[tx.snapshotVersion]--
+	if shard.pins[tx.snapshotVersion] <= 0 {
+		delete(shard.pins, tx.snapshotVersion)
+	}
+
+	delete(shard.open, tx)
+	return tx.reported
+}
+
+// overdue
+//
+//	Get the open read only transactions older than the warning threshold that have not been reported yet, and mark them as reported.
+func (readPins *readPins) overdue(threshold time.Duration) []*Tx {
+	var overdue []*Tx
+	for idx := range readPins.shards {
+		shard := &readPins.shards[idx]
+		shard.lock.Lock()
+		for tx := range shard.open {
+			if !tx.reported && time.Since(tx.startedAt) > threshold {
+				tx.reported = true
+				overdue = append(overdue, tx)
+			}
+		}
+
+		shard.lock.Unlock()
+	}
+
+	return overdue
+}
+
+// snapshot
+//
+//	Sum the versions read by open read only transactions across the shards, mapped to the total transactions reading each version.
+func (readPins *readPins) snapshot() map[uint64]int {
+	pins := make(map[uint64]int)
+	for idx := range readPins.shards {
+		shard := &readPins.shards[idx]
+		shard.lock.Lock()
+		for version, total := range shard.pins {
+			pins[version] += total
+		}
+
+		shard.lock.Unlock()
+	}
+
+	return pins
+}
@@ -0,0 +1,78 @@
+package mariv2
+
+import "time"
+
+//============================================= Mari Hybrid Logical Clock
+
+// newHLC
+//
+//	Create a hybrid logical clock that will never issue a timestamp at or below last.
+func newHLC(last uint64) *HLC {
+	return &HLC{last: last, now: time.Now}
+}
+
+// Now
+//
+//	Issue a timestamp for a local event, like a commit.
+//	If the wall clock has moved past the last issued timestamp, the physical time is used with a logical counter of 0.
+//	Otherwise the wall clock is behind or equal, so the last timestamp is incremented, which keeps timestamps strictly increasing when the clock is skewed backwards.
+func (clock *HLC) Now() uint64 {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	physical := uint64(clock.now().UnixMilli()) << HLCLogicalBits
+	if physical > clock.last {
+		clock.last = physical
+	} else {
+		clock.last++
+	}
+
+	return clock.last
+}
+
+// Update
+//
+//	Merge a timestamp received from another instance into the clock, so every timestamp issued afterwards is greater than it.
+//	This preserves causality between instances even when their wall clocks are skewed.
+func (clock *HLC) Update(remote uint64) uint64 {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	if remote > clock.last {
+		clock.last = remote
+	}
+
+	return clock.last
+}
+
+// Last
+//
+//	Get the last timestamp issued or received by the clock.
+func (clock *HLC) Last() uint64 {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	return clock.last
+}
+
+// HLCTime
+//
+//	Get the physical wall clock time of a hybrid logical clock timestamp, truncated to the millisecond.
+func HLCTime(timestamp uint64) time.Time {
+	return time.UnixMilli(int64(timestamp >> HLCLogicalBits))
+}
+
+// HLCLogical
+//
+//	Get the logical counter of a hybrid logical clock timestamp, which orders events issued within the same millisecond.
+func HLCLogical(timestamp uint64) uint16 {
+	return uint16(timestamp & (1<<HLCLogicalBits - 1))
+}
+
+// HLCFromTime
+//
+//	Get the largest hybrid logical clock timestamp within the millisecond of a wall clock time.
+//	Used for as-of queries, so every commit within the millisecond is included.
+func HLCFromTime(t time.Time) uint64 {
+	return uint64(t.UnixMilli())<<HLCLogicalBits | (1<<HLCLogicalBits - 1)
+}
@@ -0,0 +1,131 @@
+package mariv2
+
+import (
+	"bytes"
+	"maps"
+)
+
+//============================================= Mari Commit Hooks
+
+// Annotations
+//
+//	Get a copy of the metadata attached to the transaction with SetAnnotation.
+func (tx *Tx) Annotations() map[string]string {
+	return maps.Clone(tx.annotations)
+}
+
+// CommitChan
+//
+//	Subscribe to an event for every successful commit, with the changes to user keys and the annotations of the transaction, as a change data capture stream.
+//	Events are sent in version order, once the commit is visible to new transactions. The channel is buffered with size events, at least 1, and an event is dropped instead of blocking commits when the buffer is full.
+//	A subscriber can detect dropped events by a gap in the versions, and catch up with ChangesSince. Compaction resets the version, so versions restart from the compacted root.
+//	The returned cancel function unsubscribes and closes the channel. All channels are closed when the instance is closed.
+func (mariInst *Mari) CommitChan(size int) (<-chan *CommitEvent, func()) {
+	stream := mariInst.commitStream
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	eventChan := make(chan *CommitEvent, max(size, 1))
+	if stream.closed {
+		close(eventChan)
+		return eventChan, func() {}
+	}
+
+	stream.chans[eventChan] = struct{}{}
+
+	cancel := func() {
+		stream.lock.Lock()
+		defer stream.lock.Unlock()
+
+		if _, ok := stream.chans[eventChan]; ok {
+			delete(stream.chans, eventChan)
+			close(eventChan)
+		}
+	}
+
+	return eventChan, cancel
+}
+
+// newCommitEvent
+//
+//	Build the event for a commit of a transaction, with copies of the keys and values of its writes to user keys, in the order they were performed.
+//	Values replaced by stubs when moved to the cold file are not changes to the key, so they are left out.
+//	Returns nil if there are no commit hooks or subscribers, so commits are not slowed when nothing consumes the event.
+func (mariInst *Mari) newCommitEvent(tx *Tx, version, timestamp uint64) *CommitEvent {
+	if len(mariInst.commitHooks) == 0 && !mariInst.commitStream.subscribed() {
+		return nil
+	}
+
+	event := &CommitEvent{Version: version, Timestamp: timestamp, Annotations: maps.Clone(tx.annotations)}
+	for _, write := range tx.writeSet {
+		if isReservedKey(write.key) || mariInst.tiering.isStub(write.value) {
+			continue
+		}
+
+		event.Changes = append(event.Changes, &Change{Key: bytes.Clone(write.key), Value: bytes.Clone(write.value), Delete: write.isDelete, Prefix: write.isPrefix})
+	}
+
+	return event
+}
+
+// runCommitHooks
+//
+//	Run the commit hooks on the event of a commit, in the order they were passed, in the goroutine that committed.
+//	This is called after the resize read lock is released, so hooks can run transactions on the instance.
+func (mariInst *Mari) runCommitHooks(event *CommitEvent) {
+	if event == nil {
+		return
+	}
+
+	for _, hook := range mariInst.commitHooks {
+		hook(event)
+	}
+}
+
+// subscribed
+//
+//	Determine if any channel is subscribed to commit events.
+func (stream *commitStream) subscribed() bool {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	return len(stream.chans) > 0
+}
+
+// publish
+//
+//	Make a commit visible, then send its event to every subscriber, dropping it for subscribers with a full buffer.
+//	The lock is held across both, so a later commit, which can only be made visible after this one, is sent after it.
+//	If the event is nil, the commit is made visible without taking the lock.
+func (stream *commitStream) publish(event *CommitEvent, makeVisible func()) {
+	if event == nil {
+		makeVisible()
+		return
+	}
+
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	makeVisible()
+	for eventChan := range stream.chans {
+		select {
+		case eventChan <- event:
+		default:
+		}
+	}
+}
+
+// close
+//
+//	Close every subscribed channel, and close channels subscribed afterwards immediately.
+func (stream *commitStream) close() {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	for eventChan := range stream.chans {
+		close(eventChan)
+	}
+
+	stream.chans = make(map[chan *CommitEvent]struct{})
+	stream.closed = true
+}
@@ -0,0 +1,197 @@
+package mariv2
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"slices"
+)
+
+//============================================= Mari Hot Set
+
+// RecordHotSet
+//
+//	Record the key prefixes with the most reads, up to limit, as the hot set manifest in the system keyspace, replacing the previous manifest.
+//	Reads are only counted with HotSetPrefixLength, so without it nothing is recorded and the previous manifest is kept.
+//	The manifest is read by WarmHotSet, so it should be recorded periodically, or before the instance is closed, for the next open to warm.
+func (mariInst *Mari) RecordHotSet(limit int) ([]*HotPrefix, error) {
+	if mariInst.hotSet == nil || limit <= 0 {
+		return nil, nil
+	}
+
+	hot := mariInst.hotSet.top(limit)
+	if len(hot) == 0 {
+		return nil, nil
+	}
+
+	updateErr := mariInst.UpdateTx(func(tx *Tx) error {
+		recorded, rangeErr := tx.RangeSystem(HotSetBucket)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for _, kvPair := range recorded {
+			deleteErr := tx.DeleteSystem(HotSetBucket, kvPair.Key)
+			if deleteErr != nil {
+				return deleteErr
+			}
+		}
+
+		for _, prefix := range hot {
+			reads := make([]byte, 8)
+			binary.BigEndian.PutUint64(reads, prefix.Reads)
+
+			putErr := tx.PutSystem(HotSetBucket, prefix.Prefix, reads)
+			if putErr != nil {
+				return putErr
+			}
+		}
+
+		return nil
+	})
+
+	if updateErr != nil {
+		return nil, updateErr
+	}
+
+	return hot, nil
+}
+
+// HotSet
+//
+//	Get the hot set manifest recorded by RecordHotSet, most reads first.
+func (mariInst *Mari) HotSet() ([]*HotPrefix, error) {
+	var hot []*HotPrefix
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		recorded, rangeErr := tx.RangeSystem(HotSetBucket)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		hot = make([]*HotPrefix, 0, len(recorded))
+		for _, kvPair := range recorded {
+			if len(kvPair.Value) != 8 {
+				continue
+			}
+
+			hot = append(hot, &HotPrefix{Prefix: bytes.Clone(kvPair.Key), Reads: binary.BigEndian.Uint64(kvPair.Value)})
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	sortHotPrefixes(hot)
+	return hot, nil
+}
+
+// WarmHotSet
+//
+//	Prefetch every key under the prefixes of the hot set manifest, most reads first, and return the prefixes warmed.
+//	Each prefix is prefetched with PrefetchRange, so the internal nodes on the paths to its keys are read and the pages of its values are advised as needed soon.
+//	Warming stops early if the instance is closed.
+func (mariInst *Mari) WarmHotSet() (int, error) {
+	hot, hotErr := mariInst.HotSet()
+	if hotErr != nil {
+		return 0, hotErr
+	}
+
+	for idx, prefix := range hot {
+		select {
+		case <-mariInst.closeChan:
+			return idx, nil
+		default:
+		}
+
+		prefetchErr := mariInst.PrefetchRange(prefix.Prefix, prefixEndKey(prefix.Prefix))
+		if prefetchErr != nil {
+			return idx, prefetchErr
+		}
+	}
+
+	return len(hot), nil
+}
+
+// handleWarm
+//
+//	Warm the hot set manifest once the instance is opened, logging the prefixes warmed.
+func (mariInst *Mari) handleWarm() {
+	defer mariInst.workers.Done()
+
+	warmed, warmErr := mariInst.WarmHotSet()
+	if warmErr != nil {
+		mariInst.logger.Warn("error warming the hot set", "warmed", warmed, "error", warmErr)
+		return
+	}
+
+	mariInst.logger.Info("warmed the hot set", "prefixes", warmed)
+}
+
+// recordRead
+//
+//	Count a read of a key by its prefix of the hot set prefix length.
+//	Once HotSetMaxPrefixes prefixes are tracked, reads of prefixes not already tracked are dropped.
+func (set *hotSet) recordRead(key []byte) {
+	if set == nil || len(key) == 0 || isReservedKey(key) {
+		return
+	}
+
+	if len(key) > set.prefixLength {
+		key = key[:set.prefixLength]
+	}
+
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	if _, ok := set.reads[string(key)]; !ok && len(set.reads) >= HotSetMaxPrefixes {
+		return
+	}
+
+	set.reads[string(key)]++
+}
+
+// top
+//
+//	Get the prefixes with the most reads, up to limit, most reads first.
+func (set *hotSet) top(limit int) []*HotPrefix {
+	set.lock.Lock()
+	hot := make([]*HotPrefix, 0, len(set.reads))
+	for prefix, reads := range set.reads {
+		hot = append(hot, &HotPrefix{Prefix: []byte(prefix), Reads: reads})
+	}
+	set.lock.Unlock()
+
+	sortHotPrefixes(hot)
+	return hot[:min(len(hot), limit)]
+}
+
+// sortHotPrefixes
+//
+//	Sort prefixes by reads, most reads first, with ties ordered by prefix.
+func sortHotPrefixes(hot []*HotPrefix) {
+	slices.SortFunc(hot, func(first, second *HotPrefix) int {
+		if first.Reads != second.Reads {
+			return cmp.Compare(second.Reads, first.Reads)
+		}
+
+		return bytes.Compare(first.Prefix, second.Prefix)
+	})
+}
+
+// prefixEndKey
+//
+//	Get the smallest key after every key with a prefix, which is nil if every byte of the prefix is 0xff, since no key is after them.
+func prefixEndKey(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for idx := len(end) - 1; idx >= 0; idx-- {
+		if end[idx] < 0xff {
+			end[idx]++
+			return end[:idx+1]
+		}
+	}
+
+	return nil
+}
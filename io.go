@@ -2,7 +2,9 @@ package mariv2
 
 import (
 	"runtime"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -15,8 +17,7 @@ func (mariInst *Mari) compareAndSwap(node *unsafe.Pointer, currNode, nodeCopy *I
 	if atomic.CompareAndSwapPointer(node, unsafe.Pointer(currNode), unsafe.Pointer(nodeCopy)) {
 		return true
 	} else {
-		mariInst.pool.iPool.Put(nodeCopy.leaf)
-		mariInst.pool.lPool.Put(nodeCopy)
+		mariInst.pool.putINode(nodeCopy)
 		return false
 	}
 }
@@ -41,14 +42,24 @@ func (mariInst *Mari) determineIfResize(offset uint64) bool {
 //
 //	Flushes a region of the memory map to disk instead of flushing the entire map.
 //	When a startoffset is provided, if it is not aligned with the start of the last page, the offset needs to be normalized.
+//	With FlushStrategyBatch or FlushStrategyBackground, the region is marked dirty instead, and written back by the dirty pages go routine.
 func (mariInst *Mari) flushRegionToDisk(startOffset, endOffset uint64) error {
+	if mariInst.disableFlush {
+		return nil
+	}
+
+	if mariInst.flushStrategy != FlushStrategySync {
+		mariInst.markDirty(startOffset, endOffset)
+		return nil
+	}
+
 	startOffsetOfPage := startOffset & ^(uint64(DefaultPageSize) - 1)
 	mMap := mariInst.data.Load().(MMap)
 	if len(mMap) == 0 {
 		return nil
 	}
 
-	flushErr := mMap[startOffsetOfPage:endOffset].Flush()
+	flushErr := mariInst.flushRegion(mMap, startOffsetOfPage, endOffset)
 	if flushErr != nil {
 		return flushErr
 	}
@@ -60,8 +71,18 @@ func (mariInst *Mari) flushRegionToDisk(startOffset, endOffset uint64) error {
 //
 //	This is "optimistic" flushing.
 //	A separate go routine is spawned and signalled to flush changes to the mmap to disk.
+//	The commit sequence is loaded before the sync, so every commit up to it is recorded as synced once the sync completes.
+//	A commit signalled during the sync is buffered in the channel, so it is synced on the next pass.
 func (mariInst *Mari) handleFlush() {
-	for range mariInst.signalFlushChan {
+	defer mariInst.workers.Done()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-mariInst.signalFlushChan:
+		}
+
 		func() {
 			for atomic.LoadUint32(&mariInst.isResizing) == 1 {
 				runtime.Gosched()
@@ -70,18 +91,248 @@ func (mariInst *Mari) handleFlush() {
 			mariInst.rwResizeLock.RLock()
 			defer mariInst.rwResizeLock.RUnlock()
 
-			mariInst.file.Sync()
+			commitSeq := atomic.LoadUint64(&mariInst.commitSeq)
+			start := time.Now()
+			syncErr := mariInst.syncCommitBarrier()
+			mariInst.recordSyncLatency(start)
+			mariInst.commitSyncs.markSynced(commitSeq, syncErr)
 		}()
 	}
 }
 
+// syncCommitBarrier
+//
+//	Sync the file to disk after commits.
+//	With FlushStrategyBatch, writeback of the dirty pages has already been started, so a single fdatasync waits for it, and the dirty region is cleared.
+//	With FlushStrategyAdaptive, the dirty region is cleared before the fsync, since the fsync covers it.
+//	With FlushBackendIOURing, the file up to the end of the serialized data is flushed through the storage instead, which writes back its dirty pages and syncs the file in one submission.
+//	The audit log is synced first, so a synced commit is always audited.
+func (mariInst *Mari) syncCommitBarrier() error {
+	auditErr := mariInst.audit.sync()
+	if auditErr != nil {
+		return auditErr
+	}
+
+	if mariInst.flushRing != nil {
+		if mariInst.flushStrategy != FlushStrategySync {
+			mariInst.dirty.take()
+		}
+
+		_, endOffset, loadErr := mariInst.loadMetaEndSerialized()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		mMap := mariInst.data.Load().(MMap)
+		return mariInst.flushRegion(mMap, 0, min(endOffset, uint64(len(mMap))))
+	}
+
+	switch mariInst.flushStrategy {
+	case FlushStrategyBatch:
+		mariInst.dirty.take()
+		return datasyncFile(mariInst.file)
+	case FlushStrategyAdaptive:
+		mariInst.dirty.take()
+		return mariInst.file.Sync()
+	default:
+		return mariInst.file.Sync()
+	}
+}
+
+// handleDirtyPages
+//
+//	Run in a separate go routine with FlushStrategyBatch, FlushStrategyBackground or FlushStrategyAdaptive.
+//	The dirty pages are written back on each interval, or earlier when signalled because the dirty bytes exceed the threshold.
+func (mariInst *Mari) handleDirtyPages() {
+	defer mariInst.workers.Done()
+
+	ticker := time.NewTicker(mariInst.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			mariInst.writeBackDirtyPages()
+		case <-mariInst.signalDirtyChan:
+			mariInst.writeBackDirtyPages()
+		}
+	}
+}
+
+// writeBackDirtyPages
+//
+//	With FlushStrategyBatch, start writeback of the pages written since the last pass with an asynchronous msync, so the fdatasync at the next commit barrier has less to wait for.
+//	With FlushStrategyBackground or FlushStrategyAdaptive, write them back synchronously through the storage, and record every commit appended before the pass as synced.
+//	With FlushStrategyAdaptive, the latency of a pass that wrote back pages is recorded while commits are grouped.
+//	The commit sequence is loaded before the dirty region is taken, so the pages of every recorded commit are in the region.
+func (mariInst *Mari) writeBackDirtyPages() {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	commitSeq := atomic.LoadUint64(&mariInst.commitSeq)
+	startOffset, endOffset, meta := mariInst.dirty.take()
+	mMap := mariInst.data.Load().(MMap)
+
+	synchronous := mariInst.flushStrategy == FlushStrategyBackground || mariInst.flushStrategy == FlushStrategyAdaptive
+	flush := func(startOffset, endOffset uint64) error { return mMap[startOffset:endOffset].FlushAsync() }
+	if synchronous {
+		flush = func(startOffset, endOffset uint64) error { return mariInst.flushRegion(mMap, startOffset, endOffset) }
+	}
+
+	start := time.Now()
+	var flushErr error
+	endOffset = min(endOffset, uint64(len(mMap)))
+	if startOffset < endOffset {
+		startOffsetOfPage := startOffset & ^(uint64(DefaultPageSize) - 1)
+		flushErr = flush(startOffsetOfPage, endOffset)
+		if flushErr != nil {
+			mariInst.logger.Warn("error writing back dirty pages", "error", flushErr)
+		}
+	}
+
+	if meta && len(mMap) >= MetaSize && flushErr == nil {
+		flushErr = flush(MetaVersionIdx, MetaSize)
+		if flushErr != nil {
+			mariInst.logger.Warn("error writing back dirty metadata", "error", flushErr)
+		}
+	}
+
+	if !synchronous {
+		return
+	}
+
+	if startOffset < endOffset && mariInst.adaptive.isGrouped() {
+		mariInst.recordSyncLatency(start)
+	}
+
+	mariInst.commitSyncs.markSynced(commitSeq, flushErr)
+}
+
+// markDirty
+//
+//	Mark a written region dirty, and signal the dirty pages go routine if the dirty bytes exceed the threshold.
+func (mariInst *Mari) markDirty(startOffset, endOffset uint64) {
+	if mariInst.dirty.mark(startOffset, endOffset) < mariInst.flushDirtyBytes {
+		return
+	}
+
+	select {
+	case mariInst.signalDirtyChan <- true:
+	default:
+	}
+}
+
+// mark
+//
+//	Extend the dirty region to include the written region, and return the total dirty bytes. A write to the metadata only marks the metadata dirty.
+func (dirty *dirtyRegion) mark(startOffset, endOffset uint64) uint64 {
+	dirty.lock.Lock()
+	defer dirty.lock.Unlock()
+
+	if endOffset <= MetaSize {
+		dirty.meta = true
+		return dirty.bytes
+	}
+
+	if dirty.end == 0 || startOffset < dirty.start {
+		dirty.start = startOffset
+	}
+
+	dirty.end = max(dirty.end, endOffset)
+	dirty.bytes += endOffset - startOffset
+	return dirty.bytes
+}
+
+// take
+//
+//	Get the dirty region and whether the metadata is dirty, and clear them.
+func (dirty *dirtyRegion) take() (uint64, uint64, bool) {
+	dirty.lock.Lock()
+	defer dirty.lock.Unlock()
+
+	startOffset, endOffset, meta := dirty.start, dirty.end, dirty.meta
+	dirty.start, dirty.end, dirty.meta, dirty.bytes = 0, 0, false, 0
+	return startOffset, endOffset, meta
+}
+
+// newCommitSyncs
+//
+//	Create the tracker for commits synced to disk.
+func newCommitSyncs() *commitSyncs {
+	syncs := &commitSyncs{}
+	syncs.cond = sync.NewCond(&syncs.lock)
+	return syncs
+}
+
+// markSynced
+//
+//	Record the result of a sync covering every commit up to the commit sequence, and wake the waiting commits.
+func (syncs *commitSyncs) markSynced(commitSeq uint64, syncErr error) {
+	syncs.lock.Lock()
+	defer syncs.lock.Unlock()
+
+	switch {
+	case syncErr != nil && commitSeq > syncs.failed:
+		syncs.failed = commitSeq
+		syncs.err = syncErr
+	case syncErr == nil && commitSeq > syncs.synced:
+		syncs.synced = commitSeq
+	}
+
+	syncs.cond.Broadcast()
+}
+
+// wait
+//
+//	Block until a sync covering the commit sequence completes, returning the error if the sync failed.
+func (syncs *commitSyncs) wait(commitSeq uint64) error {
+	syncs.lock.Lock()
+	defer syncs.lock.Unlock()
+
+	for syncs.synced < commitSeq && syncs.failed < commitSeq {
+		syncs.cond.Wait()
+	}
+
+	if syncs.synced >= commitSeq {
+		return nil
+	}
+
+	return syncs.err
+}
+
+// waitForCommitSync
+//
+//	With synchronous commits, block the committed transaction until the flush go routine syncs it to disk.
+//	With FlushStrategyBackground, or FlushStrategyAdaptive while commits are grouped, the commit is synced by the next pass of the dirty pages go routine instead.
+//	The resize read lock must be released by the caller, so the next transaction is serialized and appended while this commit is synced, and one sync covers every commit appended before it.
+func (mariInst *Mari) waitForCommitSync() error {
+	if !mariInst.syncCommits || mariInst.disableFlush {
+		return nil
+	}
+
+	return mariInst.commitSyncs.wait(atomic.LoadUint64(&mariInst.commitSeq))
+}
+
 // handleResize
 //
 //	A separate go routine is spawned to handle resizing the memory map.
 //	When the mmap reaches its size limit, the go routine is signalled.
 func (mariInst *Mari) handleResize() {
-	for range mariInst.signalResizeChan {
-		mariInst.resizeMmap()
+	defer mariInst.workers.Done()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-mariInst.signalResizeChan:
+			mariInst.resizeMmap()
+		}
 	}
 }
 
@@ -123,6 +374,11 @@ func (mariInst *Mari) resizeMmap() (bool, error) {
 	defer mariInst.rwResizeLock.Unlock()
 	defer atomic.StoreUint32(&mariInst.isResizing, 0)
 
+	resizeErr = mariInst.checkOpen("Resize")
+	if resizeErr != nil {
+		return false, resizeErr
+	}
+
 	mMap := mariInst.data.Load().(MMap)
 	allocateSize := func() int64 {
 		switch {
@@ -136,7 +392,7 @@ func (mariInst *Mari) resizeMmap() (bool, error) {
 	}()
 
 	if len(mMap) > 0 {
-		resizeErr = mariInst.file.Sync()
+		resizeErr = syncFile(mariInst.file, mariInst.disableFlush)
 		if resizeErr != nil {
 			return false, resizeErr
 		}
@@ -163,7 +419,16 @@ func (mariInst *Mari) resizeMmap() (bool, error) {
 // signalFlush
 //
 //	Called by all writes to "optimistically" handle flushing changes to the mmap to disk.
+//	With FlushStrategyBackground, or FlushStrategyAdaptive while commits are grouped, commits are not synced individually, so the flush go routine is not signalled.
 func (mariInst *Mari) signalFlush() {
+	if mariInst.disableFlush || mariInst.flushStrategy == FlushStrategyBackground {
+		return
+	}
+
+	if mariInst.flushStrategy == FlushStrategyAdaptive && mariInst.adaptive.isGrouped() {
+		return
+	}
+
 	select {
 	case mariInst.signalFlushChan <- true:
 	default:
@@ -172,34 +437,63 @@ func (mariInst *Mari) signalFlush() {
 
 // exclusiveWriteMmap
 //
-//	Takes a path copy and writes the nodes to the memory map, then updates the metadata.
-func (mariInst *Mari) exclusiveWriteMmap(path *INode) (bool, error) {
+//	Takes the path copy of a transaction and writes the nodes to the memory map, then updates the metadata.
+//	The commit timestamp is issued by the hybrid logical clock before serializing, and a retried commit is issued a new timestamp, so timestamps increase with versions.
+//	With an audit log, the operations of the transaction are appended to it once the nodes are written, and the commit is undone if the append fails, so every commit is audited.
+//	The keys in the write set are invalidated in the value and negative caches before the new root is stored, so no transaction reads a stale value at the new version.
+//	The event of the commit is sent to CommitChan subscribers as the new root is stored, and kept on the transaction for the commit hooks.
+//	A write set holding a key locked by a prepared transaction, other than the one the transaction prepares or applies, fails with ErrKeyLocked, since the key may have been locked after it was written.
+//	A prepared transaction locks its keys before its intent is committed, so a commit checked before the keys were locked fails to swap the version and is checked again.
+//	A commit that would put a key prefix over its quota fails with a QuotaError, and the bytes under each quota prefix are recorded at the new root before it is stored.
+//	Returns the bytes appended to the memory map on success.
+func (mariInst *Mari) exclusiveWriteMmap(tx *Tx) (uint64, bool, error) {
+	path := loadINodeFromPointer(tx.root)
 	if atomic.LoadUint32(&mariInst.isResizing) == 1 {
-		return false, nil
+		return 0, false, nil
+	}
+
+	if mariInst.lockedByOther(tx.writeSet, tx.preparedID) {
+		return 0, false, ErrKeyLocked
+	}
+
+	quotaBytes, quotaErr := mariInst.checkQuotas(tx)
+	if quotaErr != nil {
+		return 0, false, quotaErr
 	}
 
 	var writeErr error
 	versionPtr, version, writeErr := mariInst.loadMetaVersion()
 	if writeErr != nil {
-		return false, nil
+		return 0, false, nil
 	}
 
 	rootOffsetPtr, prevRootOffset, writeErr := mariInst.loadMetaRootOffset()
 	if writeErr != nil {
-		return false, nil
+		return 0, false, nil
 	}
 
 	endOffsetPtr, endOffset, writeErr := mariInst.loadMetaEndSerialized()
 	if writeErr != nil {
-		return false, nil
+		return 0, false, nil
+	}
+
+	timestampPtr, _, writeErr := mariInst.loadMetaTimestamp()
+	if writeErr != nil {
+		return 0, false, nil
 	}
 
 	newVersion := path.version
 	newOffsetInMMap := endOffset
+	timestamp := mariInst.clock.Now()
+
+	serializedPath, writeErr := mariInst.serializePathToMemMap(path, newOffsetInMMap, timestamp)
+	if writeErr != nil {
+		return 0, false, writeErr
+	}
 
-	serializedPath, writeErr := mariInst.serializePathToMemMap(path, newOffsetInMMap)
+	sAudit, writeErr := mariInst.audit.encode(tx, newVersion, timestamp)
 	if writeErr != nil {
-		return false, writeErr
+		return 0, false, writeErr
 	}
 
 	updatedMeta := &MetaData{
@@ -210,12 +504,12 @@ func (mariInst *Mari) exclusiveWriteMmap(path *INode) (bool, error) {
 
 	isResize := mariInst.determineIfResize(updatedMeta.nextStartOffset)
 	if isResize {
-		return false, nil
+		return 0, false, nil
 	}
 
 	if !mariInst.appendOnly && mariInst.compactTrigger(updatedMeta) {
 		mariInst.signalCompact()
-		return false, nil
+		return 0, false, nil
 	}
 
 	if atomic.LoadUint32(&mariInst.isResizing) == 0 {
@@ -223,20 +517,44 @@ func (mariInst *Mari) exclusiveWriteMmap(path *INode) (bool, error) {
 			mariInst.storeMetaPointer(endOffsetPtr, updatedMeta.nextStartOffset)
 
 			_, writeErr = mariInst.writeNodesToMemMap(serializedPath, newOffsetInMMap)
+			if writeErr == nil {
+				writeErr = mariInst.audit.append(sAudit)
+			}
+
 			if writeErr != nil {
 				mariInst.storeMetaPointer(endOffsetPtr, endOffset)
 				mariInst.storeMetaPointer(versionPtr, version)
 				mariInst.storeMetaPointer(rootOffsetPtr, prevRootOffset)
 
-				return false, writeErr
+				return 0, false, writeErr
+			}
+
+			mariInst.storeMetaPointer(timestampPtr, timestamp)
+			mariInst.recordQuotas(quotaBytes, updatedMeta.rootOffset, updatedMeta.version)
+			mariInst.valueCache.invalidate(tx.writeSet, updatedMeta.version)
+			mariInst.missCache.invalidate(tx.writeSet, updatedMeta.version)
+			if _, ok := tx.annotations[TieringAnnotation]; !ok {
+				mariInst.accessTracker.trackWrites(tx.writeSet)
+			}
+
+			tx.commitVersion, tx.commitTimestamp = updatedMeta.version, timestamp
+			tx.commitEvent = mariInst.newCommitEvent(tx, updatedMeta.version, timestamp)
+			mariInst.commitStream.publish(tx.commitEvent, func() {
+				mariInst.storeMetaPointer(rootOffsetPtr, updatedMeta.rootOffset)
+			})
+
+			if mariInst.flushStrategy != FlushStrategySync {
+				mariInst.markDirty(MetaVersionIdx, MetaSize)
+				mariInst.markDirty(newOffsetInMMap, updatedMeta.nextStartOffset)
 			}
 
-			mariInst.storeMetaPointer(rootOffsetPtr, updatedMeta.rootOffset)
+			atomic.AddUint64(&mariInst.commitSeq, 1)
 			mariInst.signalFlush()
+			mariInst.notifyVersion()
 
-			return true, nil
+			return uint64(len(serializedPath)), true, nil
 		}
 	}
 
-	return false, nil
+	return 0, false, nil
 }
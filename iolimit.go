@@ -0,0 +1,79 @@
+package mariv2
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari IO Limiter
+
+// NewIOLimiter
+//
+//	Create a token bucket limiting background I/O to a rate in bytes per second, with a burst of up to burst bytes.
+//	A rate of 0 or less does not limit, but still counts the bytes. A burst of 0 or less defaults to one second at the rate.
+//	The limiter can be passed to multiple instances, like every shard of a sharded instance, so they share the rate.
+func NewIOLimiter(bytesPerSecond, burst int64) *IOLimiter {
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+
+	return &IOLimiter{rate: bytesPerSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait
+//
+//	Take tokens for the bytes of background I/O, sleeping until the bucket refills if there are not enough.
+//	The tokens are taken before sleeping, so I/O larger than the burst is allowed and the bucket goes into debt, which later waits repay.
+func (limiter *IOLimiter) wait(bytes int) {
+	atomic.AddUint64(&limiter.bytes, uint64(bytes))
+	if limiter.rate <= 0 {
+		return
+	}
+
+	limiter.lock.Lock()
+	now := time.Now()
+	refill := int64(now.Sub(limiter.last).Seconds() * float64(limiter.rate))
+	if refill > 0 {
+		limiter.tokens = min(limiter.tokens+refill, limiter.burst)
+		limiter.last = now
+	}
+
+	limiter.tokens -= int64(bytes)
+	debt := -limiter.tokens
+	limiter.lock.Unlock()
+
+	if debt <= 0 {
+		return
+	}
+
+	delay := time.Duration(float64(debt) / float64(limiter.rate) * float64(time.Second))
+	atomic.AddInt64(&limiter.waited, int64(delay))
+	time.Sleep(delay)
+}
+
+// available
+//
+//	Get the tokens in the bucket, refilled up to now, which is negative while background I/O is waiting.
+func (limiter *IOLimiter) available() int64 {
+	if limiter.rate <= 0 {
+		return 0
+	}
+
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	refill := int64(time.Since(limiter.last).Seconds() * float64(limiter.rate))
+	return min(limiter.tokens+refill, limiter.burst)
+}
+
+// stats
+//
+//	Snapshot the usage of the limiter.
+func (limiter *IOLimiter) stats() IOLimiterStats {
+	return IOLimiterStats{
+		Rate:      limiter.rate,
+		Available: limiter.available(),
+		Bytes:     atomic.LoadUint64(&limiter.bytes),
+		Waited:    time.Duration(atomic.LoadInt64(&limiter.waited)),
+	}
+}
@@ -0,0 +1,205 @@
+//go:build linux
+
+package mariv2
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+//============================================= Mari IO Uring (linux)
+
+// The offsets the io_uring queues are mapped at, and the operations and flags submitted, from the kernel uapi, since x/sys does not wrap io_uring
+const (
+	ioringOffSQRing      = 0
+	ioringOffCQRing      = 0x8000000
+	ioringOffSQEs        = 0x10000000
+	ioringOpFsync        = 3
+	ioringOpSyncRange    = 8
+	ioringFsyncDatasync  = 1
+	ioringEnterGetEvents = 1
+	iosqeIOLink          = 1 << 2
+	ioringSQESize        = 64
+	ioringCQESize        = 16
+)
+
+// ioURingParams is struct io_uring_params, filled by io_uring_setup with the sizes of the queues and the offsets of their fields
+type ioURingParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        ioSQRingOffsets
+	cqOff        ioCQRingOffsets
+}
+
+// ioSQRingOffsets is struct io_sqring_offsets
+type ioSQRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// ioCQRingOffsets is struct io_cqring_offsets
+type ioCQRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// newIOURing
+//
+//	Set up an io_uring with a submission queue of entries, and map its queues into memory.
+//	The io_uring is closed when it is garbage collected, like an os.File, so it is not leaked if the instance fails to open.
+func newIOURing(entries uint32) (*ioURing, error) {
+	var params ioURingParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("%w: %w", ErrIOURingUnavailable, errno)
+	}
+
+	ring := &ioURing{
+		fd:      int(fd),
+		entries: params.sqEntries,
+		sqHead:  params.sqOff.head,
+		sqTail:  params.sqOff.tail,
+		sqMask:  params.sqOff.ringMask,
+		sqArray: params.sqOff.array,
+		cqHead:  params.cqOff.head,
+		cqTail:  params.cqOff.tail,
+		cqMask:  params.cqOff.ringMask,
+		cqes:    params.cqOff.cqes,
+	}
+
+	var mapErr error
+	ring.sqRing, mapErr = unix.Mmap(ring.fd, ioringOffSQRing, int(params.sqOff.array+params.sqEntries*4), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if mapErr == nil {
+		ring.cqRing, mapErr = unix.Mmap(ring.fd, ioringOffCQRing, int(params.cqOff.cqes+params.cqEntries*ioringCQESize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	}
+
+	if mapErr == nil {
+		ring.sqes, mapErr = unix.Mmap(ring.fd, ioringOffSQEs, int(params.sqEntries*ioringSQESize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	}
+
+	if mapErr != nil {
+		return nil, errors.Join(fmt.Errorf("%w: %w", ErrIOURingUnavailable, mapErr), ring.close())
+	}
+
+	runtime.SetFinalizer(ring, (*ioURing).close)
+	return ring, nil
+}
+
+// sync
+//
+//	Write back the regions of a file and wait for them, then sync the file with fdatasync, as a chain of linked operations submitted and waited on in one system call.
+//	The ranges must fit the submission queue with the fdatasync. A region longer than sync_file_range can be passed is synced to the end of the file.
+//	If an operation fails, the operations linked after it are canceled, and the first error is returned.
+func (ring *ioURing) sync(fd int, ranges []syncRange) error {
+	tail := atomic.LoadUint32(ring.ringField(ring.sqRing, ring.sqTail))
+	mask := *ring.ringField(ring.sqRing, ring.sqMask)
+
+	submit := uint32(len(ranges) + 1)
+	for idx := range submit {
+		index := (tail + idx) & mask
+		sqe := ring.sqes[index*ioringSQESize : (index+1)*ioringSQESize]
+		clear(sqe)
+
+		*(*int32)(unsafe.Pointer(&sqe[4])) = int32(fd)
+		if int(idx) < len(ranges) {
+			length := ranges[idx].length
+			if length > uint64(^uint32(0)) {
+				length = 0
+			}
+
+			sqe[0], sqe[1] = ioringOpSyncRange, iosqeIOLink
+			*(*uint64)(unsafe.Pointer(&sqe[8])) = ranges[idx].offset
+			*(*uint32)(unsafe.Pointer(&sqe[24])) = uint32(length)
+			*(*uint32)(unsafe.Pointer(&sqe[28])) = unix.SYNC_FILE_RANGE_WAIT_BEFORE | unix.SYNC_FILE_RANGE_WRITE | unix.SYNC_FILE_RANGE_WAIT_AFTER
+		} else {
+			sqe[0] = ioringOpFsync
+			*(*uint32)(unsafe.Pointer(&sqe[28])) = ioringFsyncDatasync
+		}
+
+		*ring.ringField(ring.sqRing, ring.sqArray+index*4) = index
+	}
+
+	atomic.StoreUint32(ring.ringField(ring.sqRing, ring.sqTail), tail+submit)
+
+	var syncErr error
+	var completed uint32
+	for completed < submit {
+		unsubmitted := tail + submit - atomic.LoadUint32(ring.ringField(ring.sqRing, ring.sqHead))
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(ring.fd), uintptr(unsubmitted), uintptr(submit-completed), ioringEnterGetEvents, 0, 0)
+		if errno != 0 && errno != unix.EINTR {
+			return fmt.Errorf("error submitting to io_uring: %w", errno)
+		}
+
+		head := atomic.LoadUint32(ring.ringField(ring.cqRing, ring.cqHead))
+		cqTail := atomic.LoadUint32(ring.ringField(ring.cqRing, ring.cqTail))
+		cqMask := *ring.ringField(ring.cqRing, ring.cqMask)
+		for ; head != cqTail; head++ {
+			cqe := ring.cqes + (head&cqMask)*ioringCQESize
+			res := *(*int32)(unsafe.Pointer(&ring.cqRing[cqe+8]))
+			if res < 0 && syncErr == nil {
+				syncErr = fmt.Errorf("error syncing through io_uring: %w", unix.Errno(-res))
+			}
+
+			completed++
+		}
+
+		atomic.StoreUint32(ring.ringField(ring.cqRing, ring.cqHead), head)
+	}
+
+	return syncErr
+}
+
+// ringField
+//
+//	Get a pointer to a 32 bit field of a mapped queue ring at its offset.
+func (ring *ioURing) ringField(mapped []byte, offset uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mapped[offset]))
+}
+
+// close
+//
+//	Unmap the queues of the io_uring and close it. Closing an io_uring that is already closed returns nil.
+func (ring *ioURing) close() error {
+	if ring == nil || ring.fd < 0 {
+		return nil
+	}
+
+	runtime.SetFinalizer(ring, nil)
+
+	var closeErr error
+	for _, mapped := range [][]byte{ring.sqes, ring.cqRing, ring.sqRing} {
+		if mapped != nil {
+			closeErr = errors.Join(closeErr, unix.Munmap(mapped))
+		}
+	}
+
+	ring.sqRing, ring.cqRing, ring.sqes = nil, nil, nil
+	closeErr = errors.Join(closeErr, unix.Close(ring.fd))
+	ring.fd = -1
+	return closeErr
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package mariv2
+
+import "fmt"
+
+//============================================= Mari IO Uring (other)
+
+// newIOURing
+//
+//	io_uring is only available on linux, so ErrIOURingUnavailable is returned.
+func newIOURing(entries uint32) (*ioURing, error) {
+	return nil, fmt.Errorf("%w: io_uring is only available on linux", ErrIOURingUnavailable)
+}
+
+// sync
+//
+//	An io_uring can not be set up on the platform, so ErrIOURingUnavailable is returned.
+func (ring *ioURing) sync(fd int, ranges []syncRange) error {
+	return ErrIOURingUnavailable
+}
+
+// close
+//
+//	An io_uring can not be set up on the platform, so there is nothing to close.
+func (ring *ioURing) close() error {
+	return nil
+}
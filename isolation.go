@@ -0,0 +1,273 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"unsafe"
+)
+
+//============================================= Mari Isolation
+
+// commit
+//
+//	Append the modified path of a read-write transaction to the memory map.
+//	If another transaction committed since the transaction started, the transaction is validated against the latest version instead of failing outright.
+//	If validation passes, the write set is replayed on the latest root and the commit is attempted again, otherwise false is returned so the transaction is retried or rejected.
+//	The resize read lock must be held by the caller, and the transaction is never rebased while the file is resized or compacted, so the snapshot root stays in the memory map.
+//	The bytes written and the payload of a successful commit are recorded for the write amplification stats.
+func (tx *Tx) commit() (bool, error) {
+	written, ok, commitErr := tx.store.exclusiveWriteMmap(tx)
+	for !ok && commitErr == nil && tx.canRebase() {
+		var rebased bool
+		rebased, commitErr = tx.rebase()
+		if commitErr != nil || !rebased {
+			return false, commitErr
+		}
+
+		written, ok, commitErr = tx.store.exclusiveWriteMmap(tx)
+	}
+
+	if ok {
+		tx.store.amplification.record(written, tx.payloadBytes())
+	}
+
+	return ok, commitErr
+}
+
+// canRebase
+//
+//	Determine if a commit failed because another transaction committed on top of the root the transaction was built on, as opposed to the file being resized or compacted.
+//	A transaction that can not be rebased is retried on the latest version instead.
+func (tx *Tx) canRebase() bool {
+	if tx.noRebase || atomic.LoadUint32(&tx.store.isResizing) == 1 {
+		return false
+	}
+
+	_, version, loadErr := tx.store.loadMetaVersion()
+	if loadErr != nil {
+		return false
+	}
+
+	return version+1 != loadINodeFromPointer(tx.root).version
+}
+
+// rebase
+//
+//	Validate the transaction against the latest root, then replay the write set on a copy of it.
+//	Every key in the write set must be unchanged since the snapshot, and with IsolationSerializable so must every key read and the results of every scan.
+//	Returns false if validation fails.
+func (tx *Tx) rebase() (bool, error) {
+	snapshotRoot, rebaseErr := tx.store.readINodeFromMemMap(tx.snapshotOffset)
+	if rebaseErr != nil {
+		return false, rebaseErr
+	}
+
+	_, latestOffset, rebaseErr := tx.store.loadMetaRootOffset()
+	if rebaseErr != nil {
+		return false, rebaseErr
+	}
+
+	latestRoot, rebaseErr := tx.store.readINodeFromMemMap(latestOffset)
+	if rebaseErr != nil {
+		return false, rebaseErr
+	}
+
+	snapshotPtr, latestPtr := storeINodeAsPointer(snapshotRoot), storeINodeAsPointer(latestRoot)
+	valid, rebaseErr := tx.validate(snapshotPtr, latestPtr)
+	if rebaseErr != nil || !valid {
+		return false, rebaseErr
+	}
+
+	latestRoot.version = latestRoot.version + 1
+	rootPtr := storeINodeAsPointer(latestRoot)
+	for _, write := range tx.writeSet {
+		switch {
+		case write.isPrefix:
+			_, rebaseErr = tx.store.deletePrefixRecursive(rootPtr, write.key, 0)
+		case write.isDelete:
+			_, rebaseErr = tx.store.deleteRecursive(rootPtr, write.key, 0)
+		default:
+			_, rebaseErr = tx.store.putRecursive(rootPtr, write.key, write.value, latestRoot.version, 0, 0)
+		}
+
+		if rebaseErr != nil {
+			return false, rebaseErr
+		}
+	}
+
+	tx.root, tx.baseOffset = rootPtr, latestOffset
+	return true, nil
+}
+
+// validate
+//
+//	Check that the keys and scans the transaction depends on are the same in the snapshot and latest roots.
+//	A prefix delete depends on every key that begins with the prefix, so the path to the prefix is compared instead of a single key.
+//	A key read with GetForUpdate is checked against the version observed first, and returns ErrConflict if it changed.
+//	The key that fails validation is recorded as contended, so write hotspots show in the stats.
+func (tx *Tx) validate(snapshotPtr, latestPtr *unsafe.Pointer) (bool, error) {
+	for _, read := range tx.forUpdate {
+		latestKvPair, validateErr := tx.store.getRecursive(latestPtr, read.key, 0, identityTransform)
+		if validateErr != nil {
+			return false, validateErr
+		}
+
+		if (latestKvPair != nil) != read.exists || (read.exists && latestKvPair.Version != read.version) {
+			tx.recordConflict(read.key)
+			return false, ErrConflict
+		}
+	}
+
+	keys := make([][]byte, 0, len(tx.writeSet)+len(tx.readSet))
+	for _, write := range tx.writeSet {
+		if !write.isPrefix {
+			keys = append(keys, write.key)
+			continue
+		}
+
+		same, validateErr := tx.store.samePrefixRecursive(snapshotPtr, latestPtr, write.key, 0)
+		if validateErr != nil {
+			return false, validateErr
+		}
+
+		if !same {
+			tx.recordConflict(write.key)
+			return false, nil
+		}
+	}
+
+	keys = append(keys, tx.readSet...)
+	for _, key := range keys {
+		snapshotKvPair, validateErr := tx.store.getRecursive(snapshotPtr, key, 0, identityTransform)
+		if validateErr != nil {
+			return false, validateErr
+		}
+
+		latestKvPair, validateErr := tx.store.getRecursive(latestPtr, key, 0, identityTransform)
+		if validateErr != nil {
+			return false, validateErr
+		}
+
+		if !sameKvPair(snapshotKvPair, latestKvPair) {
+			tx.recordConflict(key)
+			return false, nil
+		}
+	}
+
+	for _, scan := range tx.scanSet {
+		snapshotKvPairs, validateErr := tx.store.repeatScan(snapshotPtr, scan)
+		if validateErr != nil {
+			return false, validateErr
+		}
+
+		latestKvPairs, validateErr := tx.store.repeatScan(latestPtr, scan)
+		if validateErr != nil {
+			return false, validateErr
+		}
+
+		if len(snapshotKvPairs) != len(latestKvPairs) {
+			tx.recordConflict(scan.startKey)
+			return false, nil
+		}
+
+		for idx := range snapshotKvPairs {
+			if !sameKvPair(snapshotKvPairs[idx], latestKvPairs[idx]) {
+				tx.recordConflict(snapshotKvPairs[idx].Key)
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// repeatScan
+//
+//	Perform a recorded scan on a root, bounded by the version of the root.
+func (mariInst *Mari) repeatScan(rootPtr *unsafe.Pointer, scan *txScan) ([]*KeyValuePair, error) {
+	version := loadINodeFromPointer(rootPtr).version
+	if scan.totalResults > 0 {
+		return mariInst.iterateRecursive(rootPtr, 0, version, scan.startKey, nil, scan.totalResults, 0, nil, []*KeyValuePair{})
+	}
+
+	return mariInst.rangeRecursive(rootPtr, 0, version, scan.startKey, scan.endKey, 0)
+}
+
+// sameKvPair
+//
+//	Determine if two reads of a key observed the same write, where nil means the key did not exist.
+func sameKvPair(first, second *KeyValuePair) bool {
+	if first == nil || second == nil {
+		return first == nil && second == nil
+	}
+
+	return first.Version == second.Version && bytes.Equal(first.Key, second.Key)
+}
+
+// GetForUpdate
+//
+//	Get the value for a key in a read-write transaction, and record the version observed.
+//	At commit, if another transaction wrote or deleted the key since it was read, the commit fails validation with ErrConflict, regardless of the isolation level.
+//	This gives optimistic concurrency on the keys a transaction depends on, without validating every read as IsolationSerializable does.
+//	UpdateTx retries the transaction on ErrConflict, while Commit returns it for transactions started with Begin.
+//	A key already written by the transaction is not recorded, since the write is validated on its own.
+func (tx *Tx) GetForUpdate(key []byte, transform *Transform) (_ *KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("GetForUpdate", &recoveredErr)
+
+	if !tx.isWrite {
+		return nil, errors.New("attempting to read for update in a read only transaction, use tx.UpdateTx")
+	}
+
+	key = tx.store.normalizeKey(key)
+	kvPair, getErr := tx.get(key)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if kvPair == nil || kvPair.Version != tx.snapshotVersion {
+		read := &txRead{key: bytes.Clone(key), exists: kvPair != nil}
+		if kvPair != nil {
+			read.version = kvPair.Version
+		}
+
+		tx.forUpdate = append(tx.forUpdate, read)
+	}
+
+	if kvPair == nil {
+		return nil, nil
+	}
+
+	expired, expireErr := tx.isExpired(key)
+	if expireErr != nil {
+		return nil, expireErr
+	}
+
+	if expired {
+		return nil, tx.lazyExpire(key)
+	}
+
+	return tx.store.readTransform(transform)(kvPair), nil
+}
+
+// recordRead
+//
+//	With IsolationSerializable, record a key read by a read-write transaction.
+func (tx *Tx) recordRead(key []byte) {
+	if !tx.isWrite || tx.store.isolation != IsolationSerializable {
+		return
+	}
+
+	tx.readSet = append(tx.readSet, bytes.Clone(key))
+}
+
+// recordScan
+//
+//	With IsolationSerializable, record a scan performed by a read-write transaction.
+func (tx *Tx) recordScan(startKey, endKey []byte, totalResults int) {
+	if !tx.isWrite || tx.store.isolation != IsolationSerializable {
+		return
+	}
+
+	tx.scanSet = append(tx.scanSet, &txScan{startKey: bytes.Clone(startKey), endKey: bytes.Clone(endKey), totalResults: totalResults})
+}
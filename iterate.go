@@ -1,88 +1,138 @@
 package mariv2
 
-import (
-	"bytes"
-	"unsafe"
-)
+import "unsafe"
 
 //============================================= Mari Iterate
 
 // iterateRecursive
 //
-//	Essentially create a cursor that begins at the specified start key.
-//	Recursively builds an accumulator of key value pairs until it reaches the max size.
+//	Essentially create a cursor that begins at the specified start key, which is inclusive and can be nil to begin at the smallest key.
+//	Recursively builds an accumulator of key value pairs in sorted order until it reaches the max size, or passes the end key, which is inclusive and can be nil to leave the end unbounded.
+//	The start key is only passed to the child on the start key path, since every key in the children after it is greater, and the end key only to the child on the end key path.
+//	A leaf can be stored above keys that are less than it, so the leaf is inserted into the results of the child sharing its index, and the results are truncated to the max size.
+//	The children of a node share a single load of the memory map, and each child is only read when it is reached, so a scan that reaches its max size reads no further children.
+//	Since a node is written with the version of every path copy through it, children with a version less than the min version are skipped.
+//	A child or leaf newer than the max version can not be reachable from a root at the max version, so reaching one returns ErrSnapshotViolation instead of returning keys outside of the snapshot.
 func (mariInst *Mari) iterateRecursive(
 	node *unsafe.Pointer,
-	minVersion uint64,
-	startKey []byte,
+	minVersion, maxVersion uint64,
+	startKey, endKey []byte,
 	totalResults, level int,
+	arena *scanArena,
 	acc []*KeyValuePair,
-	transform Transform,
 ) ([]*KeyValuePair, error) {
-	genKeyValPair := func(node *INode) *KeyValuePair { return &KeyValuePair{Key: node.leaf.key, Value: node.leaf.value} }
 	currNode := loadINodeFromPointer(node)
+	leaf := currNode.leaf
+	if currNode.version > maxVersion || leaf.version > maxVersion {
+		return nil, ErrSnapshotViolation
+	}
+
+	leafPending := len(leaf.key) > 0 && leaf.version >= minVersion && keyInBounds(leaf.key, startKey, endKey, level)
+	appendLeaf := func() {
+		acc = append(acc, arena.newPair(leaf.version, leaf.timestamp, leaf.key, leaf.value))
+		leafPending = false
+	}
+
+	if leafPending && len(leaf.key) == level {
+		appendLeaf()
+	}
 
-	var startKeyPos int
-	if level > 0 {
+	if len(startKey) <= level {
+		startKey = nil
+	}
+
+	fromPos := 0
+	if startKey != nil {
+		fromPos = getPosition(currNode.bitmap, getIndexForLevel(startKey, level), level)
+	}
+
+	lastIndex, toPos := 255, len(currNode.children)
+	if endKey != nil {
 		switch {
-		case totalResults == len(acc):
-			return acc, nil
-		case len(startKey) == level:
-			if currNode.leaf.version >= minVersion {
-				acc = append(acc, transform(genKeyValPair(currNode)))
-			}
-			startKeyPos = 0
-		case startKey != nil && len(startKey) > level:
-			if bytes.Compare(currNode.leaf.key, startKey) == 1 || bytes.Equal(currNode.leaf.key, startKey) {
-				if currNode.leaf.version >= minVersion {
-					acc = append(acc, transform(genKeyValPair(currNode)))
-				}
+		case len(endKey) > level:
+			lastIndex = int(getIndexForLevel(endKey, level))
+			toPos = getPosition(currNode.bitmap, byte(lastIndex), level)
+			if isBitSet(currNode.bitmap, byte(lastIndex)) {
+				toPos++
 			}
-
-			startKeyIndex := getIndexForLevel(startKey, level)
-			startKeyPos = getPosition(currNode.bitmap, startKeyIndex, level)
 		default:
-			if currNode.leaf.version >= minVersion && len(currNode.leaf.key) > 0 {
-				acc = append(acc, transform(genKeyValPair(currNode)))
-			}
-
-			startKeyPos = 0
+			lastIndex, toPos = -1, 0
 		}
-	} else {
-		startKeyIdx := getIndexForLevel(startKey, level)
-		startKeyPos = getPosition(currNode.bitmap, startKeyIdx, level)
 	}
 
-	if len(currNode.children) > 0 {
-		var iterErr error
-		var childNode *INode
-		var childPtr *unsafe.Pointer
+	var mMap MMap
+	if fromPos < toPos {
+		mMap = mariInst.data.Load().(MMap)
+	}
 
-		currPos := startKeyPos
-		for totalResults > len(acc) && currPos < len(currNode.children) {
-			childOffset := currNode.children[currPos]
+	pos := 0
+	for index := range lastIndex + 1 {
+		if totalResults <= len(acc) {
+			return acc[:totalResults], nil
+		}
+
+		if leafPending && byte(index) > leaf.key[level] {
+			appendLeaf()
+		}
 
-			childNode, iterErr = mariInst.getChildNode(childOffset, currNode.version)
-			if iterErr != nil {
-				return nil, iterErr
+		if !isBitSet(currNode.bitmap, byte(index)) {
+			continue
+		}
+
+		childPos := pos
+		pos++
+
+		var childStartKey []byte
+		if startKey != nil {
+			startKeyIndex := getIndexForLevel(startKey, level)
+			if byte(index) < startKeyIndex {
+				continue
 			}
-			childPtr = storeINodeAsPointer(childNode)
-
-			switch {
-			case currPos == startKeyPos && startKey != nil:
-				acc, iterErr = mariInst.iterateRecursive(childPtr, minVersion, startKey, totalResults, level+1, acc, transform)
-				if iterErr != nil {
-					return nil, iterErr
-				}
-			default:
-				acc, iterErr = mariInst.iterateRecursive(childPtr, minVersion, nil, totalResults, level+1, acc, transform)
-				if iterErr != nil {
-					return nil, iterErr
-				}
+
+			if byte(index) == startKeyIndex {
+				childStartKey = startKey
 			}
+		}
+
+		var childEndKey []byte
+		if endKey != nil && index == lastIndex {
+			childEndKey = endKey
+		}
+
+		childNode, iterErr := mariInst.getChildNodeFromMMap(mMap, currNode, childPos)
+		if iterErr != nil {
+			return nil, iterErr
+		}
 
-			currPos++
+		if childNode.version < minVersion {
+			continue
 		}
+
+		childStart := len(acc)
+		childPtr := storeINodeAsPointer(childNode)
+		acc, iterErr = mariInst.iterateRecursive(childPtr, minVersion, maxVersion, childStartKey, childEndKey, totalResults, level+1, arena, acc)
+		if iterErr != nil {
+			return nil, iterErr
+		}
+
+		if leafPending && byte(index) == leaf.key[level] {
+			childKvPairs := acc[childStart:]
+			leafPos := childStart + searchKeyAfter(childKvPairs, leaf.key, level)
+
+			kvPair := arena.newPair(leaf.version, leaf.timestamp, leaf.key, leaf.value)
+			acc = append(acc, nil)
+			copy(acc[leafPos+1:], acc[leafPos:])
+			acc[leafPos] = kvPair
+			leafPending = false
+		}
+	}
+
+	if leafPending {
+		appendLeaf()
+	}
+
+	if totalResults < len(acc) {
+		return acc[:totalResults], nil
 	}
 
 	return acc, nil
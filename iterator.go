@@ -0,0 +1,245 @@
+package mariv2
+
+import (
+	"bytes"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Iterator
+
+// NewIterator
+//
+//	Open an iterator over the key-value pairs from the start key onward, in sorted order.
+//	The iterator pins the latest version by holding a read only transaction started with Begin, so every key is read from the same snapshot no matter how long the iteration takes.
+//	Keys are read from the snapshot in batches of DefaultIteratorBatchSize, so the iterator can be used for streaming without loading the entire range into memory.
+//	The iterator must be closed to release the snapshot, since resizing and compaction are blocked while it is open.
+//	A warning is logged with the stack that opened the iterator if it is left open past the iterator max age.
+func (mariInst *Mari) NewIterator(startKey []byte, opts *RangeOpts) (*Iterator, error) {
+	tx, beginErr := mariInst.Begin(true)
+	if beginErr != nil {
+		return nil, beginErr
+	}
+
+	iter := &Iterator{
+		store:     mariInst,
+		tx:        tx,
+		version:   tx.snapshotVersion,
+		nextKey:   mariInst.normalizeKey(startKey),
+		transform: mariInst.readTransform(nil),
+		openedAt:  time.Now(),
+	}
+
+	if opts != nil && opts.MinVersion != nil {
+		iter.minVersion = *opts.MinVersion
+	}
+
+	iter.includeReserved = includeReserved(opts)
+
+	if opts != nil && opts.Transform != nil {
+		iter.transform = mariInst.readTransform(opts.Transform)
+	}
+
+	if mariInst.iteratorMaxAge > 0 {
+		iter.stack = debug.Stack()
+	}
+
+	mariInst.iterators.pin(iter)
+	return iter, nil
+}
+
+// Next
+//
+//	Advance the iterator to the next key-value pair, reading the next batch from the snapshot when the current batch is exhausted.
+//	The transform is applied as the iterator advances, and key-value pairs dropped by the transform are skipped.
+//	Returns false when there are no more key-value pairs, when the iterator is closed, or on error, which is returned by Err.
+func (iter *Iterator) Next() bool {
+	defer iter.tx.store.recoverPanic("Next", &iter.err)
+
+	if atomic.LoadUint32(&iter.closed) == 1 || iter.err != nil {
+		return false
+	}
+
+	for {
+		if iter.pos == len(iter.batch) {
+			if iter.exhausted {
+				return false
+			}
+
+			batch, iterErr := iter.tx.iterateUser(iter.nextKey, DefaultIteratorBatchSize, &RangeOpts{MinVersion: &iter.minVersion, IncludeReserved: &iter.includeReserved})
+			if iterErr != nil {
+				iter.err = iterErr
+				return false
+			}
+
+			iter.exhausted = len(batch) < DefaultIteratorBatchSize
+			if len(batch) == 0 {
+				return false
+			}
+
+			iter.batch, iter.pos = batch, 0
+			iter.nextKey = append(bytes.Clone(batch[len(batch)-1].Key), 0)
+			iter.tx.store.tiering.recordAccesses(batch)
+			iter.tx.store.accessTracker.trackPairs(batch)
+		}
+
+		kvPair := iter.transform(iter.batch[iter.pos])
+		iter.pos++
+
+		if kvPair != nil {
+			iter.current = kvPair
+			return true
+		}
+	}
+}
+
+// KeyValue
+//
+//	Get the key-value pair the iterator is positioned at, with the transform applied.
+//	Returns nil before the first call to Next.
+func (iter *Iterator) KeyValue() *KeyValuePair {
+	return iter.current
+}
+
+// Err
+//
+//	Get the error that stopped the iteration, if any.
+func (iter *Iterator) Err() error {
+	return iter.err
+}
+
+// Version
+//
+//	Get the version pinned by the iterator.
+func (iter *Iterator) Version() uint64 {
+	return iter.version
+}
+
+// Close
+//
+//	Release the snapshot pinned by the iterator and unpin its version.
+//	Closing an iterator more than once returns ErrIteratorClosed, so a double release is detected instead of releasing the snapshot of another transaction.
+func (iter *Iterator) Close() error {
+	if !atomic.CompareAndSwapUint32(&iter.closed, 0, 1) {
+		return ErrIteratorClosed
+	}
+
+	iter.store.iterators.unpin(iter)
+	iter.batch, iter.current = nil, nil
+
+	return iter.tx.Rollback()
+}
+
+// PinnedVersions
+//
+//	Get the versions pinned by open iterators, mapped to the total iterators pinning each version.
+func (mariInst *Mari) PinnedVersions() map[uint64]int {
+	iterators := mariInst.iterators
+	iterators.lock.Lock()
+	defer iterators.lock.Unlock()
+
+	pinned := make(map[uint64]int, len(iterators.pins))
+	for version, total := range iterators.pins {
+		pinned[version] = total
+	}
+
+	return pinned
+}
+
+// handleIteratorLeaks
+//
+//	Run in a separate go routine.
+//	Periodically log a warning for each iterator left open past the iterator max age, with the stack that opened it.
+//	Each iterator is only reported once.
+func (mariInst *Mari) handleIteratorLeaks() {
+	defer mariInst.workers.Done()
+
+	if mariInst.iteratorMaxAge <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(max(mariInst.iteratorMaxAge/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			for _, iter := range mariInst.iterators.leaked(mariInst.iteratorMaxAge) {
+				mariInst.logger.Warn("iterator open past max age, close iterators to release their snapshot",
+					"version", iter.version,
+					"age", time.Since(iter.openedAt),
+					"stack", string(iter.stack),
+				)
+			}
+		}
+	}
+}
+
+// closeIterators
+//
+//	Close every iterator left open when the instance is closed, logging a warning for each.
+func (mariInst *Mari) closeIterators() {
+	iterators := mariInst.iterators
+	iterators.lock.Lock()
+	open := make([]*Iterator, 0, len(iterators.open))
+	for iter := range iterators.open {
+		open = append(open, iter)
+	}
+	iterators.lock.Unlock()
+
+	for _, iter := range open {
+		mariInst.logger.Warn("iterator not closed before the instance was closed",
+			"version", iter.version,
+			"age", time.Since(iter.openedAt),
+			"stack", string(iter.stack),
+		)
+
+		iter.Close()
+	}
+}
+
+// pin
+//
+//	Track an open iterator and increment the reference count of its version.
+func (iterators *openIterators) pin(iter *Iterator) {
+	iterators.lock.Lock()
+	defer iterators.lock.Unlock()
+
+	iterators.open[iter] = struct{}{}
+	iterators.pins[iter.version]++
+}
+
+// unpin
+//
+//	Stop tracking a closed iterator and decrement the reference count of its version, removing the version once it is no longer pinned.
+func (iterators *openIterators) unpin(iter *Iterator) {
+	iterators.lock.Lock()
+	defer iterators.lock.Unlock()
+
+	delete(iterators.open, iter)
+	iterators.pins[iter.version]--
+	if iterators.pins[iter.version] <= 0 {
+		delete(iterators.pins, iter.version)
+	}
+}
+
+// leaked
+//
+//	Get the open iterators older than the max age that have not been reported yet, and mark them as reported.
+func (iterators *openIterators) leaked(maxAge time.Duration) []*Iterator {
+	iterators.lock.Lock()
+	defer iterators.lock.Unlock()
+
+	var leaked []*Iterator
+	for iter := range iterators.open {
+		if !iter.reported && time.Since(iter.openedAt) > maxAge {
+			iter.reported = true
+			leaked = append(leaked, iter)
+		}
+	}
+
+	return leaked
+}
@@ -0,0 +1,134 @@
+package mariv2
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+)
+
+//============================================= Mari Key Lock
+
+// LockKey
+//
+//	Acquire an advisory lock on a key, for callers coordinating multi-step updates to the key within the process.
+//	Blocks until the lock is acquired, or returns the error of the context if it is done first.
+//	The lock is never persisted and only applies to this instance, and locking a key already held by the caller blocks until the context is done.
+//	While the lock is held, transactions not started through the lock that write the key wait until it is released, so the holder has priority on the key.
+func (mariInst *Mari) LockKey(ctx context.Context, key []byte) (*KeyLock, error) {
+	if stateErr := mariInst.checkOpen("LockKey"); stateErr != nil {
+		return nil, stateErr
+	}
+
+	key = mariInst.normalizeKey(key)
+	for {
+		released, acquired := mariInst.keyLocks.tryLock(mariInst, string(key))
+		if acquired != nil {
+			return acquired, nil
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Key
+//
+//	Get the locked key.
+func (keyLock *KeyLock) Key() []byte {
+	return []byte(keyLock.key)
+}
+
+// UpdateTx
+//
+//	Perform a read-write transaction through the lock, which can write the locked key while other transactions wait for it.
+//	Returns ErrKeyLockReleased if the lock has been released.
+func (keyLock *KeyLock) UpdateTx(txOps func(tx *Tx) error) error {
+	if atomic.LoadUint32(&keyLock.unlocked) == 1 {
+		return ErrKeyLockReleased
+	}
+
+	return keyLock.store.UpdateTx(func(tx *Tx) error {
+		tx.keyLock = keyLock
+		return txOps(tx)
+	})
+}
+
+// Unlock
+//
+//	Release the lock, waking the callers and transactions waiting for the key.
+//	Releasing a lock more than once returns ErrKeyLockReleased.
+func (keyLock *KeyLock) Unlock() error {
+	if !atomic.CompareAndSwapUint32(&keyLock.unlocked, 0, 1) {
+		return ErrKeyLockReleased
+	}
+
+	keyLock.store.keyLocks.unlock(keyLock)
+	return nil
+}
+
+// tryLock
+//
+//	Acquire the lock on a key if it is free, otherwise get the channel closed when the current holder releases it.
+func (locks *keyLocks) tryLock(mariInst *Mari, key string) (chan struct{}, *KeyLock) {
+	locks.lock.Lock()
+	defer locks.lock.Unlock()
+
+	if held, ok := locks.held[key]; ok {
+		return held.released, nil
+	}
+
+	keyLock := &KeyLock{store: mariInst, key: key, released: make(chan struct{})}
+	locks.held[key] = keyLock
+	atomic.AddInt64(&locks.total, 1)
+	return nil, keyLock
+}
+
+// unlock
+//
+//	Remove the lock from the table and wake its waiters.
+func (locks *keyLocks) unlock(keyLock *KeyLock) {
+	locks.lock.Lock()
+	defer locks.lock.Unlock()
+
+	if locks.held[keyLock.key] == keyLock {
+		delete(locks.held, keyLock.key)
+		atomic.AddInt64(&locks.total, -1)
+	}
+
+	close(keyLock.released)
+}
+
+// blocking
+//
+//	Get the channel closed when the lock blocking the transaction is released, if the transaction writes a key held by a lock it was not started through.
+//	Returns nil if the transaction can commit.
+func (locks *keyLocks) blocking(tx *Tx) chan struct{} {
+	if atomic.LoadInt64(&locks.total) == 0 {
+		return nil
+	}
+
+	locks.lock.Lock()
+	defer locks.lock.Unlock()
+
+	for _, write := range tx.writeSet {
+		if write.isPrefix {
+			for key, held := range locks.held {
+				if held != tx.keyLock && strings.HasPrefix(key, string(write.key)) {
+					return held.released
+				}
+			}
+
+			continue
+		}
+
+		held, ok := locks.held[string(write.key)]
+		if ok && held != tx.keyLock {
+			return held.released
+		}
+	}
+
+	return nil
+}
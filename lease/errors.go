@@ -0,0 +1,15 @@
+package lease
+
+import "errors"
+
+// ErrHeld is returned when a lease is acquired while another holder has a lease on the name that has not expired
+var ErrHeld = errors.New("lease is held by another holder")
+
+// ErrLost is returned when a lease is renewed, released or fenced after it expired or another lease was acquired on the name
+var ErrLost = errors.New("lease expired or was acquired by another holder")
+
+// ErrInvalidTTL is returned when a lease is acquired or renewed with a ttl that is not greater than 0
+var ErrInvalidTTL = errors.New("lease ttl must be greater than 0")
+
+// ErrInvalidHolder is returned when a lease is acquired with an empty holder
+var ErrInvalidHolder = errors.New("lease holder must be non-empty")
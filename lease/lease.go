@@ -0,0 +1,223 @@
+package lease
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Mari Lease
+
+// Acquire
+//
+//	Acquire a lease on a name for a holder, which expires after the ttl unless it is renewed.
+//	If another holder has a lease on the name that has not expired, ErrHeld is returned. If the holder already has the lease, it is extended and keeps its token.
+//	The lease is recorded in a read-write transaction, so concurrent acquires of the same name conflict and only one succeeds.
+//	The fencing token is the version the transaction commits on, or one more than the last token on the name if that is greater, since compaction resets the versions.
+func Acquire(mariInst *mariv2.Mari, name, holder string, ttl time.Duration) (*Lease, error) {
+	if holder == "" {
+		return nil, ErrInvalidHolder
+	}
+
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	lease := &Lease{mariInst: mariInst, Name: name, Holder: holder}
+	updateErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		now := time.Now()
+		current, getErr := getRecord(tx, name)
+		if getErr != nil {
+			return getErr
+		}
+
+		switch {
+		case current.holder == holder && current.expiresAt > now.UnixNano():
+			lease.Token = current.token
+		case current.holder != "" && current.expiresAt > now.UnixNano():
+			return ErrHeld
+		default:
+			lease.Token = max(current.token+1, tx.SnapshotVersion()+1)
+		}
+
+		lease.ExpiresAt = now.Add(ttl)
+		return putRecord(tx, name, &record{token: lease.Token, expiresAt: lease.ExpiresAt.UnixNano(), holder: holder})
+	})
+
+	if updateErr != nil {
+		return nil, updateErr
+	}
+
+	return lease, nil
+}
+
+// Lock
+//
+//	Acquire a lease on a name, waiting DefaultRetryInterval between attempts while another holder has it, until the context is done.
+func Lock(ctx context.Context, mariInst *mariv2.Mari, name, holder string, ttl time.Duration) (*Lease, error) {
+	ticker := time.NewTicker(DefaultRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		lease, acquireErr := Acquire(mariInst, name, holder, ttl)
+		if !errors.Is(acquireErr, ErrHeld) {
+			return lease, acquireErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Current
+//
+//	Get the lease on a name that has not expired, or nil if the name is free.
+func Current(mariInst *mariv2.Mari, name string) (*Lease, error) {
+	var lease *Lease
+	readErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+		current, getErr := getRecord(tx, name)
+		if getErr != nil {
+			return getErr
+		}
+
+		if current.holder == "" || current.expiresAt <= time.Now().UnixNano() {
+			return nil
+		}
+
+		lease = &Lease{mariInst: mariInst, Name: name, Holder: current.holder, Token: current.token, ExpiresAt: time.Unix(0, current.expiresAt)}
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return lease, nil
+}
+
+// Fence
+//
+//	Check in a read-write transaction that the lease with the token is still held and has not expired, returning ErrLost if it is not.
+//	The record is written again unchanged, so the transaction conflicts with a concurrent acquire of the name, and writes fenced by the token are only committed while the lease is held.
+func Fence(tx *mariv2.Tx, name string, token uint64) error {
+	current, getErr := getRecord(tx, name)
+	if getErr != nil {
+		return getErr
+	}
+
+	if current.holder == "" || current.token != token || current.expiresAt <= time.Now().UnixNano() {
+		return ErrLost
+	}
+
+	return putRecord(tx, name, current)
+}
+
+// Renew
+//
+//	Extend the lease to expire after the ttl from now, keeping its token.
+//	If the lease expired or another lease was acquired on the name, ErrLost is returned.
+func (lease *Lease) Renew(ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	var expiresAt time.Time
+	updateErr := lease.mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		current, getErr := lease.held(tx)
+		if getErr != nil {
+			return getErr
+		}
+
+		expiresAt = time.Now().Add(ttl)
+		current.expiresAt = expiresAt.UnixNano()
+		return putRecord(tx, lease.Name, current)
+	})
+
+	if updateErr != nil {
+		return updateErr
+	}
+
+	lease.ExpiresAt = expiresAt
+	return nil
+}
+
+// Release
+//
+//	Release the lease so the name can be acquired immediately.
+//	The token is kept in the record, so the next lease on the name has a greater token.
+//	If the lease expired or another lease was acquired on the name, ErrLost is returned.
+func (lease *Lease) Release() error {
+	return lease.mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		current, getErr := lease.held(tx)
+		if getErr != nil {
+			return getErr
+		}
+
+		return putRecord(tx, lease.Name, &record{token: current.token})
+	})
+}
+
+// Fence
+//
+//	Check in a read-write transaction that the lease is still held, as Fence with the name and token of the lease.
+func (lease *Lease) Fence(tx *mariv2.Tx) error {
+	return Fence(tx, lease.Name, lease.Token)
+}
+
+// held
+//
+//	Get the record of the name if it is still the lease, returning ErrLost otherwise.
+func (lease *Lease) held(tx *mariv2.Tx) (*record, error) {
+	current, getErr := getRecord(tx, lease.Name)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if current.holder != lease.Holder || current.token != lease.Token || current.expiresAt <= time.Now().UnixNano() {
+		return nil, ErrLost
+	}
+
+	return current, nil
+}
+
+// getRecord
+//
+//	Read the record of a name from the system keyspace, which is empty if the name was never acquired.
+func getRecord(tx *mariv2.Tx, name string) (*record, error) {
+	kvPair, getErr := tx.GetSystem(Bucket, []byte(name))
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if kvPair == nil {
+		return &record{}, nil
+	}
+
+	if len(kvPair.Value) < recordHeaderSize {
+		return nil, errors.New("lease record is shorter than its header")
+	}
+
+	return &record{
+		token:     binary.BigEndian.Uint64(kvPair.Value[:8]),
+		expiresAt: int64(binary.BigEndian.Uint64(kvPair.Value[8:recordHeaderSize])),
+		holder:    string(kvPair.Value[recordHeaderSize:]),
+	}, nil
+}
+
+// putRecord
+//
+//	Write the record of a name to the system keyspace.
+func putRecord(tx *mariv2.Tx, name string, current *record) error {
+	value := make([]byte, recordHeaderSize, recordHeaderSize+len(current.holder))
+	binary.BigEndian.PutUint64(value[:8], current.token)
+	binary.BigEndian.PutUint64(value[8:recordHeaderSize], uint64(current.expiresAt))
+	value = append(value, current.holder...)
+
+	return tx.PutSystem(Bucket, []byte(name), value)
+}
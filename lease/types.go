@@ -0,0 +1,40 @@
+package lease
+
+import (
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+// Lease is an expiring, exclusive claim on a name by a holder, with a fencing token that increases every time the name is acquired
+type Lease struct {
+	// mariInst: the instance the lease is recorded in
+	mariInst *mariv2.Mari
+	// Name: the name the lease is held on
+	Name string
+	// Holder: the id of the holder of the lease
+	Holder string
+	// Token: the fencing token of the lease, which is greater than the token of every previous lease on the name
+	Token uint64
+	// ExpiresAt: the time the lease expires unless it is renewed
+	ExpiresAt time.Time
+}
+
+// record is the state of a lease on a name, persisted in the system keyspace
+type record struct {
+	// token: the fencing token of the last lease acquired on the name, which is kept when the lease is released so tokens never decrease
+	token uint64
+	// expiresAt: the time the lease expires, in unix nanoseconds, or 0 if it was released
+	expiresAt int64
+	// holder: the id of the holder of the lease, or empty if it was released
+	holder string
+}
+
+// Bucket is the bucket of the system keyspace where the leases are recorded, keyed by name
+const Bucket = "lease"
+
+// DefaultRetryInterval is the interval Lock waits between attempts to acquire a lease held by another holder
+const DefaultRetryInterval = 50 * time.Millisecond
+
+// recordHeaderSize is the size of the token and expiration of a serialized record, which is followed by the holder
+const recordHeaderSize = 16
@@ -0,0 +1,113 @@
+package mariv2
+
+import (
+	"errors"
+)
+
+//============================================= Mari Legacy Format
+
+// upgradeLegacyFile
+//
+//	Rewrite a file in the legacy layout of the first release to the current format, in the same way compaction rewrites the current version.
+//	Legacy files have 24 bytes of metadata and leaf nodes without a timestamp, and the meta index of the format version overlaps the version of the root at offset 24, which is always 0.
+//	Only the current version is kept, and every key-value pair is given the timestamp of the upgrade, since the commits that wrote them were not timestamped.
+//	The upgraded file is written with the format and key normalizer of a new file without normalized keys, so an instance opened with a key normalizer is still rejected after the upgrade.
+func (mariInst *Mari) upgradeLegacyFile() error {
+	mariInst.legacyTimestamp = mariInst.clock.Now()
+	defer func() { mariInst.legacyTimestamp = 0 }()
+
+	var upgradeErr error
+	_, rootOffset, upgradeErr := mariInst.loadMetaRootOffset()
+	if upgradeErr != nil {
+		return upgradeErr
+	}
+
+	currRoot, upgradeErr := mariInst.readINodeFromMemMap(rootOffset)
+	if upgradeErr != nil {
+		return upgradeErr
+	}
+
+	compact, upgradeErr := mariInst.newCompaction(currRoot.version)
+	if upgradeErr != nil {
+		return upgradeErr
+	}
+
+	var endOff uint64
+	if compact.direct != nil {
+		endOff, upgradeErr = mariInst.serializeCurrentVersionDirect(compact, currRoot)
+	} else {
+		currRootPtr := storeINodeAsPointer(currRoot)
+		endOff, _, upgradeErr = mariInst.serializeCurrentVersionToNewFile(compact, currRootPtr, 0, 0, InitRootOffset)
+	}
+
+	if upgradeErr != nil {
+		compact.removeTempFile()
+		return upgradeErr
+	}
+
+	newMeta := &MetaData{
+		version:            0,
+		rootOffset:         uint64(InitRootOffset),
+		nextStartOffset:    endOff,
+		formatVersion:      mariInst.targetFormatVersion(),
+		timestamp:          mariInst.legacyTimestamp,
+		historyStartOffset: endOff,
+	}
+
+	serializedMeta := newMeta.serializeMetaData()
+	if compact.direct != nil {
+		upgradeErr = compact.direct.finish(serializedMeta, endOff)
+	} else {
+		_, upgradeErr = compact.writeMetaToTempMemMap(serializedMeta)
+	}
+
+	if upgradeErr != nil {
+		compact.removeTempFile()
+		return upgradeErr
+	}
+
+	upgradeErr = mariInst.swapTempFileWithMari(compact)
+	if upgradeErr != nil {
+		compact.removeTempFile()
+		return upgradeErr
+	}
+
+	mariInst.logger.Info("upgraded legacy file format", "file", mariInst.file.Name(), "formatVersion", newMeta.formatVersion)
+	return nil
+}
+
+// deserializeLegacyLNode
+//
+//	Deserialize the byte representation of a leaf node in the legacy layout, where the key length directly follows the end offset.
+//	The leaf node is given the timestamp passed in, since legacy leaf nodes were written without one.
+func deserializeLegacyLNode(snode []byte, timestamp uint64) (*LNode, error) {
+	var deserializeErr error
+	if len(snode) < LegacyNodeKeyIdx {
+		return nil, errors.New("leaf node is shorter than its header")
+	}
+
+	version, deserializeErr := deserializeUint64(snode[NodeVersionIdx:NodeStartOffsetIdx])
+	if deserializeErr != nil {
+		return nil, deserializeErr
+	}
+
+	startOffset, deserializeErr := deserializeUint64(snode[NodeStartOffsetIdx:NodeEndOffsetIdx])
+	if deserializeErr != nil {
+		return nil, deserializeErr
+	}
+
+	keyLength := uint8(snode[LegacyNodeKeyLength])
+	if LegacyNodeKeyIdx+int(keyLength) > len(snode) {
+		return nil, errors.New("leaf node key length extends past the end of the node")
+	}
+
+	keyEnd := LegacyNodeKeyIdx + int(keyLength)
+	return &LNode{
+		version:     version,
+		startOffset: startOffset,
+		timestamp:   timestamp,
+		keyLength:   keyLength,
+		key:         snode[LegacyNodeKeyIdx:keyEnd:keyEnd],
+		value:       snode[keyEnd:len(snode):len(snode)],
+	}, nil
+}
@@ -0,0 +1,76 @@
+package mariv2
+
+import "sync/atomic"
+
+//============================================= Mari Lifecycle
+
+// State
+//
+//	Get the lifecycle state of the instance.
+func (mariInst *Mari) State() State {
+	return State(atomic.LoadUint32(&mariInst.state))
+}
+
+// String
+//
+//	Get the name of the state, for errors and logging.
+func (state State) String() string {
+	switch state {
+	case StateOpening:
+		return "opening"
+	case StateRunning:
+		return "running"
+	case StateCompacting:
+		return "compacting"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// transition
+//
+//	Move the instance from one state to another, only if it is still in the expected state.
+func (mariInst *Mari) transition(from, to State) bool {
+	return atomic.CompareAndSwapUint32(&mariInst.state, uint32(from), uint32(to))
+}
+
+// beginClose
+//
+//	Move a running or compacting instance to closing. Returns false if the instance is already closing or closed, so only one Close proceeds.
+func (mariInst *Mari) beginClose() bool {
+	for {
+		state := mariInst.State()
+		if state != StateRunning && state != StateCompacting {
+			return false
+		}
+
+		if mariInst.transition(state, StateClosing) {
+			return true
+		}
+	}
+}
+
+// isClosing
+//
+//	Determine if the instance is closing or closed.
+func (mariInst *Mari) isClosing() bool {
+	state := mariInst.State()
+	return state == StateClosing || state == StateClosed
+}
+
+// checkOpen
+//
+//	Return a StateError for an operation invoked while the instance is closing or closed.
+//	Operations check with the resize read lock held, so the memory map is never read after Close unmaps it.
+func (mariInst *Mari) checkOpen(op string) error {
+	state := mariInst.State()
+	if state == StateClosing || state == StateClosed {
+		return &StateError{Op: op, State: state}
+	}
+
+	return nil
+}
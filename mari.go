@@ -1,9 +1,13 @@
 package mariv2
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync/atomic"
+	"time"
 )
 
 //============================================= Mari
@@ -11,32 +15,63 @@ import (
 // Open initializes Mari
 //
 //	This will create the memory mapped file or read it in if it already exists.
-//	Then, the meta data is initialized and written to the first 0-23 bytes in the memory map.
+//	An anonymous instance always creates a new file, without a name, so it is reclaimed by the filesystem when closed.
+//	A file can only be open in one instance per process. Opening it again returns an AlreadyOpenError with the open instance.
+//	Then, the meta data is initialized and written to the first 0-63 bytes in the memory map.
+//	Files written with an unsupported format version are rejected with ErrUnsupportedFormat, and files written in the legacy layout of the first release are upgraded.
+//	Files written without subtree counts are opened without them, until compaction rewrites the file.
+//	Depending on the open validation mode, the file is checked for corruption before the instance is returned.
+//	In degraded mode, corrupt subtrees found by validation are quarantined, and the instance is opened with the rest of the keyspace readable.
 //	An initial root MariINode will also be written to the memory map as well.
 func Open(opts InitOpts) (*Mari, error) {
 	fileWithFilePath := filepath.Join(opts.Filepath, opts.FileName)
 
 	mariInst := &Mari{
 		filepath:          opts.Filepath,
-		opened:            true,
+		instanceLabel:     opts.FileName,
+		state:             uint32(StateOpening),
 		signalCompactChan: make(chan bool),
-		signalFlushChan:   make(chan bool),
+		signalFlushChan:   make(chan bool, 1),
+		signalDirtyChan:   make(chan bool, 1),
+		signalExpireChan:  make(chan bool, 1),
 		signalResizeChan:  make(chan bool),
+		clock:             newHLC(0),
+		versions:          &versionIndex{},
+		prepared:          &preparedTxs{keys: make(map[string]string)},
+		keyLocks:          &keyLocks{held: make(map[string]*KeyLock)},
+		subscribers:       &versionSubscribers{chans: make(map[chan uint64]struct{})},
+		commitStream:      &commitStream{chans: make(map[chan *CommitEvent]struct{})},
+		iterators:         &openIterators{open: make(map[*Iterator]struct{}), pins: make(map[uint64]int)},
+		readPins:          newReadPins(),
+		quarantine:        &quarantine{regions: make(map[uint64]*QuarantineError)},
+		commitSyncs:       newCommitSyncs(),
+		dirty:             &dirtyRegion{},
+		closeChan:         make(chan struct{}),
 	}
 
+	nodePoolSize := DefaultNodePoolSize
 	if opts.NodePoolSize != nil {
-		nodePoolSize := *opts.NodePoolSize
-		mariInst.pool = newPool(nodePoolSize)
-	} else {
-		mariInst.pool = newPool(DefaultNodePoolSize)
+		nodePoolSize = *opts.NodePoolSize
+	}
+
+	nodePoolMaxRetained := nodePoolSize
+	if opts.NodePoolMaxRetained != nil {
+		nodePoolMaxRetained = *opts.NodePoolMaxRetained
 	}
 
+	disableNodePool := opts.DisableNodePool != nil && *opts.DisableNodePool
+	mariInst.pool = newPool(nodePoolSize, nodePoolMaxRetained, disableNodePool)
+
 	if opts.AppendOnly != nil {
 		mariInst.appendOnly = *opts.AppendOnly
 	} else {
 		mariInst.appendOnly = false
 	}
 
+	if opts.Follower != nil && *opts.Follower {
+		atomic.StoreUint32(&mariInst.isFollower, 1)
+	}
+
 	if opts.CompactTrigger != nil {
 		mariInst.compactTrigger = *opts.CompactTrigger
 	} else {
@@ -45,16 +80,281 @@ func Open(opts InitOpts) (*Mari, error) {
 		}
 	}
 
-	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if opts.SubtreeCounts != nil {
+		mariInst.enableSubtreeCounts = *opts.SubtreeCounts
+	} else {
+		mariInst.enableSubtreeCounts = true
+	}
+
+	mariInst.transform = Pipeline(opts.Transforms...)
+
+	if opts.ValueChecksums != nil {
+		mariInst.enableValueChecksums = *opts.ValueChecksums
+	}
+
+	if mariInst.enableValueChecksums && !mariInst.enableSubtreeCounts {
+		return nil, errors.New("value checksums require subtree counts")
+	}
+
+	if opts.ExpirationInterval != nil && *opts.ExpirationInterval > 0 {
+		mariInst.expirationInterval = *opts.ExpirationInterval
+	} else {
+		mariInst.expirationInterval = DefaultExpirationInterval
+	}
+
+	if opts.ExpirationJitter != nil && *opts.ExpirationJitter > 0 {
+		mariInst.expirationJitter = *opts.ExpirationJitter
+	}
+
+	if opts.IteratorMaxAge != nil {
+		mariInst.iteratorMaxAge = *opts.IteratorMaxAge
+	} else {
+		mariInst.iteratorMaxAge = DefaultIteratorMaxAge
+	}
+
+	if opts.ProfileTransactions != nil {
+		mariInst.profileTransactions = *opts.ProfileTransactions
+	}
+
+	if opts.OpLogSampleRate != nil {
+		if *opts.OpLogSampleRate < 0 || *opts.OpLogSampleRate > 1 {
+			return nil, errors.New("op log sample rate must be between 0 and 1")
+		}
+
+		mariInst.opLogSampleRate = *opts.OpLogSampleRate
+	}
+
+	if opts.Logger != nil {
+		mariInst.logger = opts.Logger
+	} else {
+		mariInst.logger = slog.Default()
+	}
+
+	storageErr := mariInst.initStorage(opts)
+	if storageErr != nil {
+		return nil, storageErr
+	}
+
+	if opts.PoolDebug != nil && *opts.PoolDebug {
+		mariInst.pool.audit = newPoolAudit(mariInst.logger)
+	}
+
+	mariInst.closeTimeout = -1
+	if opts.CloseTimeout != nil && *opts.CloseTimeout >= 0 {
+		mariInst.closeTimeout = *opts.CloseTimeout
+	}
+
+	if opts.ReadTxWarnThreshold != nil {
+		mariInst.readTxWarnThreshold = *opts.ReadTxWarnThreshold
+	}
+
+	if opts.ReadAtLeastTimeout != nil {
+		mariInst.readAtLeastTimeout = *opts.ReadAtLeastTimeout
+	} else {
+		mariInst.readAtLeastTimeout = DefaultReadAtLeastTimeout
+	}
+
+	mariInst.amplification = &amplification{}
+	mariInst.slowOps = &slowOps{}
+	mariInst.contention = &contention{conflicts: make(map[string]uint64), warnThreshold: DefaultContentionWarnThreshold}
+	if opts.ContentionWarnThreshold != nil {
+		mariInst.contention.warnThreshold = *opts.ContentionWarnThreshold
+	}
+
+	if opts.ContentionPrefixLength != nil && *opts.ContentionPrefixLength > 0 {
+		mariInst.contention.prefixLength = *opts.ContentionPrefixLength
+	}
+
+	if opts.ReadTxAbortThreshold != nil {
+		mariInst.readTxAbortThreshold = *opts.ReadTxAbortThreshold
+	}
+
+	if opts.Degraded != nil {
+		mariInst.degraded = *opts.Degraded
+	}
+
+	openValidation := OpenValidationFast
+	if opts.OpenValidation != nil {
+		openValidation = *opts.OpenValidation
+	}
+
+	if opts.FileMode != nil {
+		mariInst.fileMode = *opts.FileMode
+	} else {
+		mariInst.fileMode = DefaultFileMode
+	}
+
+	if opts.SyncDirectory != nil {
+		mariInst.syncDirectory = *opts.SyncDirectory
+	}
+
+	if opts.Anonymous != nil {
+		mariInst.anonymous = *opts.Anonymous
+	}
+
+	if opts.RemoveOnClose != nil {
+		mariInst.removeOnClose = *opts.RemoveOnClose
+	}
+
+	if opts.DisableFlush != nil {
+		mariInst.disableFlush = *opts.DisableFlush
+	}
+
+	if opts.SyncCommits != nil {
+		mariInst.syncCommits = *opts.SyncCommits
+	}
+
+	if opts.Isolation != nil {
+		mariInst.isolation = *opts.Isolation
+	}
+
+	if opts.EmptyValues != nil {
+		mariInst.emptyValues = *opts.EmptyValues
+	}
+
+	if opts.Tombstones != nil {
+		mariInst.tombstones = *opts.Tombstones
+	}
+
+	maxKeySize := MaxKeySize
+	if mariInst.tombstones {
+		maxKeySize = MaxTombstoneKeySize
+	}
+
+	mariInst.maxKeySize = maxKeySize
+	if opts.MaxKeySize != nil {
+		if *opts.MaxKeySize < 1 || *opts.MaxKeySize > maxKeySize {
+			return nil, fmt.Errorf("max key size must be between 1 and %d bytes", maxKeySize)
+		}
+
+		mariInst.maxKeySize = *opts.MaxKeySize
+	}
+
+	mariInst.maxValueSize = MaxValueSize
+	if opts.MaxValueSize != nil {
+		if *opts.MaxValueSize < 1 || *opts.MaxValueSize > MaxValueSize {
+			return nil, fmt.Errorf("max value size must be between 1 and %d bytes", MaxValueSize)
+		}
+
+		mariInst.maxValueSize = *opts.MaxValueSize
+	}
+
+	mariInst.keyNormalizer = opts.KeyNormalizer
+	mariInst.validators = mariInst.newValidators(opts.Validators)
+	mariInst.quotas = mariInst.newQuotas(opts.Quotas)
+	mariInst.repairSources = opts.RepairSources
+	mariInst.repairChan = make(chan *repairRequest, MaxPendingRepairs)
+	mariInst.commitHooks = opts.CommitHooks
+
+	if opts.IOLimiter != nil {
+		mariInst.ioLimiter = opts.IOLimiter
+	} else {
+		mariInst.ioLimiter = NewIOLimiter(0, 0)
+	}
+
+	if opts.ValueCacheSize != nil && *opts.ValueCacheSize > 0 {
+		mariInst.valueCache = newValueCache(*opts.ValueCacheSize)
+	}
+
+	if opts.NegativeCacheSize != nil && *opts.NegativeCacheSize > 0 {
+		mariInst.missCache = newValueCache(*opts.NegativeCacheSize)
+	}
+
+	if residencySupported && opts.ResidencySampleInterval != nil && *opts.ResidencySampleInterval > 0 {
+		mariInst.residency = newResidency(*opts.ResidencySampleInterval)
+	}
+
+	mariInst.metricsSink = opts.MetricsSink
+	if opts.MetricsInterval != nil && *opts.MetricsInterval > 0 {
+		mariInst.metricsInterval = *opts.MetricsInterval
+	} else {
+		mariInst.metricsInterval = DefaultMetricsInterval
+	}
+
+	if opts.ReadOpsPerSecond != nil {
+		mariInst.readThrottle = newOpsThrottle(*opts.ReadOpsPerSecond)
+	}
+
+	if opts.WriteOpsPerSecond != nil {
+		mariInst.writeThrottle = newOpsThrottle(*opts.WriteOpsPerSecond)
+	}
+
+	if opts.SoftMemoryLimit != nil {
+		var shedScansOver int
+		if opts.ShedScansOver != nil {
+			shedScansOver = *opts.ShedScansOver
+		}
+
+		mariInst.memory = newMemoryLimiter(*opts.SoftMemoryLimit, shedScansOver)
+	}
+
+	if opts.HotSetPrefixLength != nil && *opts.HotSetPrefixLength > 0 {
+		mariInst.hotSet = &hotSet{reads: make(map[string]uint64), prefixLength: *opts.HotSetPrefixLength}
+	}
+
+	if opts.WarmOnOpen != nil {
+		mariInst.warmOnOpen = *opts.WarmOnOpen
+	}
+
+	if opts.DirectCompaction != nil {
+		mariInst.directCompaction = *opts.DirectCompaction
+	}
+
+	if opts.FlushStrategy != nil {
+		mariInst.flushStrategy = *opts.FlushStrategy
+	}
+
+	if opts.FlushInterval != nil && *opts.FlushInterval > 0 {
+		mariInst.flushInterval = *opts.FlushInterval
+	} else {
+		mariInst.flushInterval = DefaultFlushInterval
+	}
+
+	targetCommitLatency := DefaultTargetCommitLatency
+	if opts.TargetCommitLatency != nil && *opts.TargetCommitLatency > 0 {
+		targetCommitLatency = *opts.TargetCommitLatency
+	}
+
+	mariInst.adaptive = newAdaptiveSync(targetCommitLatency)
+
+	if opts.FlushDirtyBytes != nil && *opts.FlushDirtyBytes > 0 {
+		mariInst.flushDirtyBytes = uint64(*opts.FlushDirtyBytes)
+	} else {
+		mariInst.flushDirtyBytes = DefaultFlushDirtyBytes
+	}
 
 	var openErr error
-	mariInst.file, openErr = os.OpenFile(fileWithFilePath, flag, 0600)
+	if !mariInst.anonymous {
+		mariInst.registryPath, openErr = openInstances.register(fileWithFilePath, mariInst)
+		if openErr != nil {
+			return nil, openErr
+		}
+
+		defer func() {
+			if openErr != nil {
+				openInstances.unregister(mariInst.registryPath, mariInst)
+			}
+		}()
+	}
+
+	if opts.AuditLog != nil {
+		mariInst.audit, openErr = openAuditLog(*opts.AuditLog, mariInst.fileMode)
+		if openErr != nil {
+			return nil, openErr
+		}
+
+		defer func() {
+			if openErr != nil {
+				mariInst.audit.close()
+			}
+		}()
+	}
+
+	mariInst.file, openErr = mariInst.openFile(fileWithFilePath)
 	if openErr != nil {
 		return nil, openErr
 	}
 
-	mariInst.filepath = opts.Filepath
-
 	atomic.StoreUint32(&mariInst.isResizing, 0)
 	mariInst.data.Store(MMap{})
 
@@ -63,24 +363,215 @@ func Open(opts InitOpts) (*Mari, error) {
 		return nil, openErr
 	}
 
-	go mariInst.compactHandler()
-	go mariInst.handleFlush()
-	go mariInst.handleResize()
+	openErr = mariInst.validateOnOpen(openValidation)
+	if openErr != nil {
+		mariInst.munmap()
+		mariInst.file.Close()
+		return nil, openErr
+	}
+
+	if mariInst.valueCache != nil || mariInst.missCache != nil {
+		_, version, versionErr := mariInst.loadMetaVersion()
+		if versionErr != nil {
+			openErr = versionErr
+			mariInst.munmap()
+			mariInst.file.Close()
+			return nil, openErr
+		}
+
+		mariInst.valueCache.reset(version)
+		mariInst.missCache.reset(version)
+	}
+
+	openErr = mariInst.recoverPrepared()
+	if openErr != nil {
+		mariInst.munmap()
+		mariInst.file.Close()
+		return nil, openErr
+	}
+
+	openErr = mariInst.recoverTTL()
+	if openErr != nil {
+		mariInst.munmap()
+		mariInst.file.Close()
+		return nil, openErr
+	}
+
+	openErr = mariInst.openAccessTracker(opts)
+	if openErr != nil {
+		mariInst.munmap()
+		mariInst.file.Close()
+		return nil, openErr
+	}
+
+	openErr = mariInst.openTiering(opts, fileWithFilePath)
+	if openErr != nil {
+		mariInst.munmap()
+		mariInst.file.Close()
+		return nil, openErr
+	}
+
+	mariInst.workers.Add(3)
+	go mariInst.runLabeled(ProfileSubsystemCompaction, mariInst.compactHandler)
+	go mariInst.runLabeled(ProfileSubsystemFlush, mariInst.handleFlush)
+	go mariInst.runLabeled(ProfileSubsystemResize, mariInst.handleResize)
+
+	mariInst.workers.Add(1)
+	go mariInst.runLabeled(ProfileSubsystemExpiration, mariInst.handleExpiration)
+
+	mariInst.workers.Add(1)
+	go mariInst.runLabeled(ProfileSubsystemIteratorLeaks, mariInst.handleIteratorLeaks)
+
+	mariInst.workers.Add(1)
+	go mariInst.runLabeled(ProfileSubsystemReadGuard, mariInst.handleReadGuard)
+
+	if mariInst.residency != nil {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemResidency, mariInst.handleResidency)
+	}
+
+	if mariInst.metricsSink != nil {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemMetrics, mariInst.handleMetrics)
+	}
+
+	if len(mariInst.repairSources) > 0 {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemRepair, mariInst.handleRepairs)
+	}
+
+	if mariInst.tiering != nil && mariInst.tiering.coldAfter > 0 {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemTiering, mariInst.handleTiering)
+	}
+
+	if mariInst.accessTracker != nil {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemAccess, mariInst.handleAccess)
+	}
+
+	if mariInst.warmOnOpen {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemWarm, mariInst.handleWarm)
+	}
+
+	if mariInst.flushStrategy != FlushStrategySync && !mariInst.disableFlush {
+		mariInst.workers.Add(1)
+		go mariInst.runLabeled(ProfileSubsystemFlush, mariInst.handleDirtyPages)
+	}
+
+	mariInst.transition(StateOpening, StateRunning)
+	return mariInst, nil
+}
+
+// OpenTemp
+//
+//	Open a scratch instance in a new file in the temp directory, named with the prefix followed by a random string.
+//	The instance is opened with RemoveOnClose, so the file is removed on Close, and with DisableFlush, since the file does not need to survive a crash.
+func OpenTemp(prefix string) (*Mari, error) {
+	file, createErr := os.CreateTemp("", prefix+"*")
+	if createErr != nil {
+		return nil, createErr
+	}
+
+	fileName := file.Name()
+	createErr = file.Close()
+	if createErr != nil {
+		os.Remove(fileName)
+		return nil, createErr
+	}
+
+	removeOnClose := true
+	disableFlush := true
+	opts := InitOpts{
+		Filepath:      filepath.Dir(fileName),
+		FileName:      filepath.Base(fileName),
+		RemoveOnClose: &removeOnClose,
+		DisableFlush:  &disableFlush,
+	}
+
+	mariInst, openErr := Open(opts)
+	if openErr != nil {
+		os.Remove(fileName)
+		return nil, openErr
+	}
 
 	return mariInst, nil
 }
 
 // Close
 //
-//	Close Mari, unmapping the file from memory and closing the file.
+//	Close Mari, stopping the background workers, unmapping the file from memory and closing the file.
+//	Iterators still open are released, then the instance is fenced, waiting for active transactions, compaction and resizing to finish.
+//	If they are still active after the close timeout, ErrBusy is returned and the instance stays open.
+//	The instance is closing while it waits, so new operations return a StateError, and the file is only unmapped once nothing can read it.
+//	Closing an instance that is already closing or closed returns nil.
+//	If the instance was opened with RemoveOnClose, the file and its cold file are removed once it is closed. The audit log is closed, but never removed.
+//	The file is released from the process wide registry, so it can be opened again.
 func (mariInst *Mari) Close() error {
-	var closeErr error
-	if !mariInst.opened {
+	if !mariInst.beginClose() {
 		return nil
 	}
-	mariInst.opened = false
 
-	closeErr = mariInst.file.Sync()
+	mariInst.closeIterators()
+
+	fenceErr := mariInst.fence()
+	if fenceErr != nil {
+		mariInst.transition(StateClosing, StateRunning)
+		return fenceErr
+	}
+
+	mariInst.rwResizeLock.Unlock()
+	defer openInstances.unregister(mariInst.registryPath, mariInst)
+
+	close(mariInst.closeChan)
+	mariInst.workers.Wait()
+	mariInst.closeSubscribers()
+	mariInst.commitStream.close()
+
+	closeErr := errors.Join(mariInst.closeFile(), mariInst.audit.close(), mariInst.closeTiering(), mariInst.flushRing.close())
+	atomic.StoreUint32(&mariInst.state, uint32(StateClosed))
+	mariInst.commitSyncs.markSynced(atomic.LoadUint64(&mariInst.commitSeq), closeErr)
+	if closeErr != nil {
+		return closeErr
+	}
+
+	if mariInst.removeOnClose && !mariInst.anonymous {
+		return errors.Join(os.Remove(mariInst.file.Name()), mariInst.removeTiering())
+	}
+
+	return nil
+}
+
+// fence
+//
+//	Acquire the resize lock exclusively, so no transaction or background worker is using the memory map.
+//	Without a close timeout, waits until every holder releases the lock, otherwise ErrBusy is returned once the timeout passes.
+func (mariInst *Mari) fence() error {
+	if mariInst.closeTimeout < 0 {
+		mariInst.rwResizeLock.Lock()
+		return nil
+	}
+
+	deadline := time.Now().Add(mariInst.closeTimeout)
+	for !mariInst.rwResizeLock.TryLock() {
+		if !time.Now().Before(deadline) {
+			return ErrBusy
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return nil
+}
+
+// closeFile
+//
+//	Sync and unmap the file and close it, without stopping the background workers.
+//	Used on compaction, where the file is swapped while the instance stays open.
+func (mariInst *Mari) closeFile() error {
+	var closeErr error
+	closeErr = syncFile(mariInst.file, mariInst.disableFlush)
 	if closeErr != nil {
 		return closeErr
 	}
@@ -104,6 +595,10 @@ func (mariInst *Mari) Close() error {
 //
 //	Determine the memory mapped file size.
 func (mariInst *Mari) FileSize() (int, error) {
+	if stateErr := mariInst.checkOpen("FileSize"); stateErr != nil {
+		return 0, stateErr
+	}
+
 	stat, statErr := mariInst.file.Stat()
 	if statErr != nil {
 		return 0, statErr
@@ -115,7 +610,9 @@ func (mariInst *Mari) FileSize() (int, error) {
 
 // Remove
 //
-//	Close Mari and remove the source file.
+//	Close Mari and remove the source file, and the cold file if values were moved to one.
+//	The file is only removed once the instance is fenced and unmapped, and is kept if Close returns ErrBusy.
+//	An anonymous file has no name, and a file opened with RemoveOnClose is removed by Close, so both are only closed.
 func (mariInst *Mari) Remove() error {
 	var removeErr error
 
@@ -124,12 +621,16 @@ func (mariInst *Mari) Remove() error {
 		return removeErr
 	}
 
+	if mariInst.anonymous || mariInst.removeOnClose {
+		return nil
+	}
+
 	removeErr = os.Remove(mariInst.file.Name())
 	if removeErr != nil {
 		return removeErr
 	}
 
-	return nil
+	return mariInst.removeTiering()
 }
 
 // initializeFile
@@ -137,6 +638,7 @@ func (mariInst *Mari) Remove() error {
 //	Initialize the memory mapped file to persist the hamt.
 //	If file size is 0, initiliaze the file size to 64MB and set the initial metadata and root values into the map.
 //	Otherwise, just map the already initialized file into the memory map.
+//	A file in the legacy layout, which has a format version of 0, is upgraded to the current format before it is used.
 func (mariInst *Mari) initializeFile() error {
 	var initErr error
 
@@ -151,11 +653,18 @@ func (mariInst *Mari) initializeFile() error {
 		if initErr != nil {
 			return initErr
 		}
-		endOffset, initErr := mariInst.initRoot()
+		mariInst.subtreeCounts = mariInst.enableSubtreeCounts
+		mariInst.valueChecksums = mariInst.enableValueChecksums
+		timestamp := mariInst.clock.Now()
+		endOffset, initErr := mariInst.initRoot(timestamp)
 		if initErr != nil {
 			return initErr
 		}
-		initErr = mariInst.initMeta(endOffset)
+		initErr = mariInst.initMeta(endOffset, timestamp)
+		if initErr != nil {
+			return initErr
+		}
+		initErr = mariInst.syncDir(mariInst.file.Name())
 		if initErr != nil {
 			return initErr
 		}
@@ -164,6 +673,47 @@ func (mariInst *Mari) initializeFile() error {
 		if initErr != nil {
 			return initErr
 		}
+
+		formatVersion, initErr := mariInst.loadMetaFormatVersion()
+		if initErr != nil {
+			return initErr
+		}
+		if formatVersion == FormatVersionLegacy {
+			initErr = mariInst.upgradeLegacyFile()
+			if initErr != nil {
+				mariInst.munmap()
+				mariInst.file.Close()
+				return initErr
+			}
+
+			formatVersion, initErr = mariInst.loadMetaFormatVersion()
+			if initErr != nil {
+				return initErr
+			}
+		}
+		if formatVersion > CurrentFormatVersion {
+			mariInst.munmap()
+			mariInst.file.Close()
+			return fmt.Errorf("%w: found %d, expected at most %d", ErrUnsupportedFormat, formatVersion, CurrentFormatVersion)
+		}
+		mariInst.subtreeCounts = formatVersion >= FormatVersionSubtreeCounts
+		mariInst.valueChecksums = formatVersion == FormatVersionValueChecksums
+
+		keyNormalizer, initErr := mariInst.loadMetaKeyNormalizer()
+		if initErr != nil {
+			return initErr
+		}
+		if keyNormalizer != mariInst.keyNormalizerID() {
+			mariInst.munmap()
+			mariInst.file.Close()
+			return fmt.Errorf("%w: found %d, expected %d", ErrKeyNormalizerMismatch, keyNormalizer, mariInst.keyNormalizerID())
+		}
+
+		_, timestamp, initErr := mariInst.loadMetaTimestamp()
+		if initErr != nil {
+			return initErr
+		}
+		mariInst.clock.Update(timestamp)
 	}
 
 	return nil
@@ -0,0 +1,162 @@
+package mariv2
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+//============================================= Mari Memory Limit
+
+// newMemoryLimiter
+//
+//	Create the soft memory limit, rejecting scans over shedScansOver results while over the limit if it is greater than 0.
+//	A limit of 0 or less does not limit, so nil is returned.
+func newMemoryLimiter(limit int64, shedScansOver int) *memoryLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &memoryLimiter{limit: limit, shedScansOver: shedScansOver}
+}
+
+// MemoryUsage
+//
+//	Get the bytes held in memory by the value cache, the negative cache, the node pool, and the results of scans in flight, which are the bytes counted against SoftMemoryLimit.
+//	The bytes are estimated from the keys and values held and the size of the nodes, so they do not include the pages of the memory map, which are managed by the kernel.
+func (mariInst *Mari) MemoryUsage() int64 {
+	return mariInst.valueCache.size() + mariInst.missCache.size() + mariInst.pool.bytes() + mariInst.memory.inFlight()
+}
+
+// checkMemory
+//
+//	With SoftMemoryLimit, shrink the caches when the memory held is over the limit, evicting the least recently used entries of the negative cache, then of the value cache, until usage is at MemoryShrinkTarget of the limit.
+//	If usage is still over the limit after shrinking, like when the memory is held by scans in flight, the instance is under memory pressure, so the node pool drops the nodes put back, and scans over ShedScansOver results are rejected, until usage is under the limit again.
+func (mariInst *Mari) checkMemory() {
+	limiter := mariInst.memory
+	if limiter == nil {
+		return
+	}
+
+	usage := mariInst.MemoryUsage()
+	if usage > limiter.limit {
+		excess := usage - int64(float64(limiter.limit)*MemoryShrinkTarget)
+		freed := mariInst.missCache.shrink(excess)
+		freed += mariInst.valueCache.shrink(excess - freed)
+		if freed > 0 {
+			atomic.AddUint64(&limiter.shrinks, 1)
+			usage -= freed
+		}
+	}
+
+	pressured := usage > limiter.limit
+	if pressured && atomic.CompareAndSwapUint32(&limiter.pressured, 0, 1) {
+		mariInst.pool.setShedding(true)
+		mariInst.logger.Warn("over soft memory limit after shrinking caches", "usage", usage, "limit", limiter.limit)
+	} else if !pressured && atomic.CompareAndSwapUint32(&limiter.pressured, 1, 0) {
+		mariInst.pool.setShedding(false)
+		mariInst.logger.Info("under soft memory limit", "usage", usage, "limit", limiter.limit)
+	}
+}
+
+// shedScan
+//
+//	Check the memory held before a scan returning the total results, rejecting the scan with ErrMemoryPressure if the instance is under memory pressure and the results are over ShedScansOver.
+func (mariInst *Mari) shedScan(totalResults int) error {
+	limiter := mariInst.memory
+	if limiter == nil || limiter.shedScansOver <= 0 || totalResults <= limiter.shedScansOver {
+		return nil
+	}
+
+	mariInst.checkMemory()
+	if atomic.LoadUint32(&limiter.pressured) == 0 {
+		return nil
+	}
+
+	atomic.AddUint64(&limiter.shedScans, 1)
+	return ErrMemoryPressure
+}
+
+// holdScan
+//
+//	Count the keys and values of the results of a scan against the soft memory limit until the returned release is called, checking the memory held with the results.
+//	The results are released once the scan returns them, since the memory is then held by the caller.
+func (mariInst *Mari) holdScan(kvPairs []*KeyValuePair) func() {
+	held := mariInst.holdPairs(kvPairs)
+	mariInst.checkMemory()
+	return func() { mariInst.releasePairs(held) }
+}
+
+// holdPairs
+//
+//	Count the keys and values of key-value pairs against the soft memory limit, returning the bytes held, which are released with releasePairs.
+func (mariInst *Mari) holdPairs(kvPairs []*KeyValuePair) int64 {
+	limiter := mariInst.memory
+	if limiter == nil {
+		return 0
+	}
+
+	var held int64
+	for _, kvPair := range kvPairs {
+		held += int64(len(kvPair.Key) + len(kvPair.Value))
+	}
+
+	atomic.AddInt64(&limiter.scanBytes, held)
+	return held
+}
+
+// releasePairs
+//
+//	Release the bytes of key-value pairs held with holdPairs.
+func (mariInst *Mari) releasePairs(held int64) {
+	if mariInst.memory == nil {
+		return
+	}
+
+	atomic.AddInt64(&mariInst.memory.scanBytes, -held)
+}
+
+// inFlight
+//
+//	Get the bytes of the results of scans in flight, which is 0 if memory is not limited.
+func (limiter *memoryLimiter) inFlight() int64 {
+	if limiter == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&limiter.scanBytes)
+}
+
+// stats
+//
+//	Snapshot the soft memory limit, the memory held, and the shrinks and scans rejected, which are all 0 if memory is not limited.
+func (limiter *memoryLimiter) stats(usage int64) MemoryStats {
+	if limiter == nil {
+		return MemoryStats{Usage: usage}
+	}
+
+	return MemoryStats{
+		Limit:     limiter.limit,
+		Usage:     usage,
+		Pressured: atomic.LoadUint32(&limiter.pressured) == 1,
+		Shrinks:   atomic.LoadUint64(&limiter.shrinks),
+		ShedScans: atomic.LoadUint64(&limiter.shedScans),
+	}
+}
+
+// bytes
+//
+//	Get an estimate of the bytes held by the nodes retained in the node pool.
+func (p *Pool) bytes() int64 {
+	return atomic.LoadInt64(&p.size) * int64(unsafe.Sizeof(INode{})+unsafe.Sizeof(LNode{})) / 2
+}
+
+// setShedding
+//
+//	Set whether nodes put back into the node pool are dropped instead of retained, so the pool drains while the instance is under memory pressure.
+func (p *Pool) setShedding(shedding bool) {
+	if shedding {
+		atomic.StoreUint32(&p.shedding, 1)
+	} else {
+		atomic.StoreUint32(&p.shedding, 0)
+	}
+}
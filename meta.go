@@ -11,12 +11,16 @@ import (
 // initMeta
 //
 //	Initialize and serialize the metadata in a new Mari.
-//	Version starts at 0 and increments, and root offset starts at 24.
-func (mariInst *Mari) initMeta(nextStart uint64) error {
+//	Version starts at 0 and increments, and root offset starts at 64.
+func (mariInst *Mari) initMeta(nextStart, timestamp uint64) error {
 	newMeta := &MetaData{
-		version:         0,
-		rootOffset:      uint64(InitRootOffset),
-		nextStartOffset: nextStart,
+		version:            0,
+		rootOffset:         uint64(InitRootOffset),
+		nextStartOffset:    nextStart,
+		formatVersion:      mariInst.targetFormatVersion(),
+		timestamp:          timestamp,
+		historyStartOffset: nextStart,
+		keyNormalizer:      mariInst.keyNormalizerID(),
 	}
 
 	serializedMeta := newMeta.serializeMetaData()
@@ -27,73 +31,123 @@ func (mariInst *Mari) initMeta(nextStart uint64) error {
 	return nil
 }
 
+// targetFormatVersion
+//
+//	Get the format version that new and compacted files are written with, which depends on whether subtree counts and value checksums are enabled.
+func (mariInst *Mari) targetFormatVersion() uint64 {
+	if mariInst.enableValueChecksums {
+		return FormatVersionValueChecksums
+	}
+	if mariInst.enableSubtreeCounts {
+		return FormatVersionSubtreeCounts
+	}
+	return FormatVersionBase
+}
+
+// loadMetaPointer
+//
+//	Get the uint64 pointer for a metadata field from the memory map, bounds checked so an unmapped or truncated memory map is reported instead of panicking.
+func (mariInst *Mari) loadMetaPointer(op string, idx uint64) (*uint64, error) {
+	mMap := mariInst.data.Load().(MMap)
+	loadErr := checkRegion(mMap, op, idx, OffsetSize64, ErrOutOfBounds)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	return (*uint64)(unsafe.Pointer(&mMap[idx])), nil
+}
+
 // loadMetaRootOffsetPointer
 //
 //	Get the uint64 pointer from the memory map.
-func (mariInst *Mari) loadMetaRootOffset() (ptr *uint64, rOff uint64, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			ptr = nil
-			rOff = 0
-			err = errors.New("error getting root offset from mmap")
-		}
-	}()
+func (mariInst *Mari) loadMetaRootOffset() (*uint64, uint64, error) {
+	rootOffsetPtr, loadErr := mariInst.loadMetaPointer("load root offset", MetaRootOffsetIdx)
+	if loadErr != nil {
+		return nil, 0, loadErr
+	}
 
-	mMap := mariInst.data.Load().(MMap)
-	rootOffsetPtr := (*uint64)(unsafe.Pointer(&mMap[MetaRootOffsetIdx]))
-	rootOffset := atomic.LoadUint64(rootOffsetPtr)
-	return rootOffsetPtr, rootOffset, nil
+	return rootOffsetPtr, atomic.LoadUint64(rootOffsetPtr), nil
 }
 
 // loadMetaEndMmapPointer
 //
 //	Get the uint64 pointer from the memory map.
-func (mariInst *Mari) loadMetaEndSerialized() (ptr *uint64, sOff uint64, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			ptr = nil
-			sOff = 0
-			err = errors.New("error getting end of serialized data from mmap")
-		}
-	}()
+func (mariInst *Mari) loadMetaEndSerialized() (*uint64, uint64, error) {
+	endSerializedPtr, loadErr := mariInst.loadMetaPointer("load end of serialized data", MetaEndSerializedOffset)
+	if loadErr != nil {
+		return nil, 0, loadErr
+	}
 
-	mMap := mariInst.data.Load().(MMap)
-	endSerializedPtr := (*uint64)(unsafe.Pointer(&mMap[MetaEndSerializedOffset]))
-	endSerialized := atomic.LoadUint64(endSerializedPtr)
-	return endSerializedPtr, endSerialized, nil
+	return endSerializedPtr, atomic.LoadUint64(endSerializedPtr), nil
 }
 
 // loadMetaVersionPointer
 //
 //	Get the uint64 pointer from the memory map.
-func (mariInst *Mari) loadMetaVersion() (ptr *uint64, v uint64, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			ptr = nil
-			v = 0
-			err = errors.New("error getting version from mmap")
-		}
-	}()
+func (mariInst *Mari) loadMetaVersion() (*uint64, uint64, error) {
+	versionPtr, loadErr := mariInst.loadMetaPointer("load version", MetaVersionIdx)
+	if loadErr != nil {
+		return nil, 0, loadErr
+	}
 
-	mMap := mariInst.data.Load().(MMap)
-	versionPtr := (*uint64)(unsafe.Pointer(&mMap[MetaVersionIdx]))
-	version := atomic.LoadUint64(versionPtr)
-	return versionPtr, version, nil
+	return versionPtr, atomic.LoadUint64(versionPtr), nil
+}
+
+// loadMetaTimestamp
+//
+//	Get the uint64 pointer from the memory map.
+func (mariInst *Mari) loadMetaTimestamp() (*uint64, uint64, error) {
+	timestampPtr, loadErr := mariInst.loadMetaPointer("load timestamp", MetaTimestampIdx)
+	if loadErr != nil {
+		return nil, 0, loadErr
+	}
+
+	return timestampPtr, atomic.LoadUint64(timestampPtr), nil
+}
+
+// loadMetaFormatVersion
+//
+//	Get the file format version from the memory map.
+func (mariInst *Mari) loadMetaFormatVersion() (uint64, error) {
+	formatVersionPtr, loadErr := mariInst.loadMetaPointer("load format version", MetaFormatVersionIdx)
+	if loadErr != nil {
+		return 0, loadErr
+	}
+
+	return atomic.LoadUint64(formatVersionPtr), nil
+}
+
+// loadMetaHistoryStart
+//
+//	Get the offset of the first path copy after the initial or compacted root from the memory map.
+func (mariInst *Mari) loadMetaHistoryStart() (uint64, error) {
+	historyStartPtr, loadErr := mariInst.loadMetaPointer("load history start", MetaHistoryStartIdx)
+	if loadErr != nil {
+		return 0, loadErr
+	}
+
+	return atomic.LoadUint64(historyStartPtr), nil
+}
+
+// loadMetaKeyNormalizer
+//
+//	Get the id of the key normalizer the file was created with from the memory map.
+func (mariInst *Mari) loadMetaKeyNormalizer() (uint64, error) {
+	keyNormalizerPtr, loadErr := mariInst.loadMetaPointer("load key normalizer", MetaKeyNormalizerIdx)
+	if loadErr != nil {
+		return 0, loadErr
+	}
+
+	return atomic.LoadUint64(keyNormalizerPtr), nil
 }
 
 // storeMetaPointer
 //
 //	Store the pointer associated with the particular metadata (root offset, end serialized, version) back in the memory map.
-func (mariInst *Mari) storeMetaPointer(ptr *uint64, val uint64) (err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			err = errors.New("error storing meta value in mmap")
-		}
-	}()
+func (mariInst *Mari) storeMetaPointer(ptr *uint64, val uint64) error {
+	if ptr == nil {
+		return errors.New("error storing meta value in mmap, pointer is nil")
+	}
 
 	atomic.StoreUint64(ptr, val)
 	return nil
@@ -102,19 +156,19 @@ func (mariInst *Mari) storeMetaPointer(ptr *uint64, val uint64) (err error) {
 // writeMetaToMemMap
 //
 //	Copy the serialized metadata into the memory map.
-func (mariInst *Mari) writeMetaToMemMap(sMeta []byte) (ok bool, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			ok = false
-			err = errors.New("error writing metadata to mmap")
-		}
-	}()
-
+func (mariInst *Mari) writeMetaToMemMap(sMeta []byte) (bool, error) {
 	mMap := mariInst.data.Load().(MMap)
-	copy(mMap[MetaVersionIdx:MetaEndSerializedOffset+OffsetSize64], sMeta)
+	writeErr := checkRegion(mMap, "write metadata", MetaVersionIdx, MetaSize, ErrOutOfBounds)
+	if writeErr != nil {
+		return false, writeErr
+	}
+
+	writeErr = mariInst.writeRegion(mMap, sMeta, MetaVersionIdx)
+	if writeErr != nil {
+		return false, writeErr
+	}
 
-	flushErr := mariInst.flushRegionToDisk(MetaVersionIdx, MetaEndSerializedOffset+OffsetSize64)
+	flushErr := mariInst.flushRegionToDisk(MetaVersionIdx, MetaSize)
 	if flushErr != nil {
 		return false, flushErr
 	}
@@ -0,0 +1,197 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+//============================================= Mari Metrics
+
+// NewStatsDSink
+//
+//	Create a sink that pushes stats to the StatsD server at the address over UDP, like "127.0.0.1:8125".
+//	Every metric is named with the prefix joined by a dot, like "mari.version", and tagged with the tags, like "env:prod", and the instance.
+//	Totals that only increase while the instance is open, like the contention retries, are sent as counters of the increase since the last push, and the rest as gauges.
+func NewStatsDSink(addr, prefix string, tags []string) (*StatsDSink, error) {
+	conn, dialErr := net.Dial("udp", addr)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+
+	if prefix != "" {
+		prefix += "."
+	}
+
+	return &StatsDSink{conn: conn, prefix: prefix, tags: tags, totals: make(map[string]uint64)}, nil
+}
+
+// Push
+//
+//	Send the stats of the instance as StatsD lines, batched into packets of at most StatsDMaxPacketSize bytes.
+//	If a total is lower than the last push, the instance was reopened, so the entire total is counted.
+func (sink *StatsDSink) Push(instance string, stats *Stats) error {
+	gauges, counters := statsMetrics(stats)
+
+	tags := append(append([]string{}, sink.tags...), "instance:"+instance)
+	suffix := "|#" + strings.Join(tags, ",") + "\n"
+
+	var lines []string
+	for _, gauge := range gauges {
+		lines = append(lines, fmt.Sprintf("%s%s:%g|g%s", sink.prefix, gauge.name, gauge.value, suffix))
+	}
+
+	sink.lock.Lock()
+	for _, counter := range counters {
+		key := instance + "\x00" + counter.name
+		last := sink.totals[key]
+		sink.totals[key] = counter.total
+		if counter.total == last {
+			continue
+		}
+
+		increase := counter.total
+		if counter.total > last {
+			increase -= last
+		}
+
+		lines = append(lines, fmt.Sprintf("%s%s:%d|c%s", sink.prefix, counter.name, increase, suffix))
+	}
+	sink.lock.Unlock()
+
+	var packet bytes.Buffer
+	var pushErrs []error
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line) > StatsDMaxPacketSize {
+			_, writeErr := sink.conn.Write(packet.Bytes())
+			pushErrs = append(pushErrs, writeErr)
+			packet.Reset()
+		}
+
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, writeErr := sink.conn.Write(packet.Bytes())
+		pushErrs = append(pushErrs, writeErr)
+	}
+
+	return errors.Join(pushErrs...)
+}
+
+// Close
+//
+//	Close the UDP connection to the server. The sink must not be used by any instance once it is closed.
+func (sink *StatsDSink) Close() error {
+	return sink.conn.Close()
+}
+
+// handleMetrics
+//
+//	Push the stats to the metrics sink on every interval, until the instance is closed.
+//	Pushes that fail are logged and skipped, so an unreachable pipeline does not stop the instance.
+func (mariInst *Mari) handleMetrics() {
+	defer mariInst.workers.Done()
+
+	ticker := time.NewTicker(mariInst.metricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			stats, statsErr := mariInst.Stats()
+			if statsErr != nil {
+				continue
+			}
+
+			pushErr := mariInst.metricsSink.Push(mariInst.instanceLabel, stats)
+			if pushErr != nil {
+				mariInst.logger.Warn("error pushing metrics", "error", pushErr)
+			}
+		}
+	}
+}
+
+// statsGauge is a point in time value from the stats
+type statsGauge struct {
+	name  string
+	value float64
+}
+
+// statsCounter is a total from the stats that only increases while the instance is open
+type statsCounter struct {
+	name  string
+	total uint64
+}
+
+// statsMetrics
+//
+//	Flatten the stats into gauges, which are point in time values, and counters, which are totals that only increase while the instance is open.
+func statsMetrics(stats *Stats) ([]statsGauge, []statsCounter) {
+	groupedSync := 0.0
+	if stats.GroupedSync {
+		groupedSync = 1
+	}
+
+	memoryPressured := 0.0
+	if stats.Memory.Pressured {
+		memoryPressured = 1
+	}
+
+	gauges := []statsGauge{
+		{"version", float64(stats.Version)},
+		{"next_start_offset", float64(stats.NextStartOffset)},
+		{"file_size", float64(stats.FileSize)},
+		{"allocated_size", float64(stats.AllocatedSize)},
+		{"cold_file_size", float64(stats.ColdFileSize)},
+		{"active_read_txs", float64(stats.ActiveReadTxs)},
+		{"background_io.available", float64(stats.BackgroundIO.Available)},
+		{"grouped_sync", groupedSync},
+		{"sync_latency_p99_ms", float64(stats.SyncLatencyP99) / float64(time.Millisecond)},
+		{"value_cache.entries", float64(stats.ValueCache.Entries)},
+		{"negative_cache.entries", float64(stats.NegativeCache.Entries)},
+		{"write_amplification.ratio", stats.WriteAmplification.Ratio},
+		{"residency.mapped_bytes", float64(stats.Residency.MappedBytes)},
+		{"residency.resident_bytes", float64(stats.Residency.ResidentBytes)},
+		{"residency.resident_ratio", stats.Residency.ResidentRatio},
+		{"memory.usage", float64(stats.Memory.Usage)},
+		{"memory.pressured", memoryPressured},
+	}
+
+	counters := []statsCounter{
+		{"long_read_txs", stats.LongReadTxs},
+		{"read_repairs", stats.ReadRepairs},
+		{"tiered_values", stats.TieredValues},
+		{"cold_reads", stats.ColdReads},
+		{"background_io.bytes", stats.BackgroundIO.Bytes},
+		{"contention.retries", stats.Contention.Retries},
+		{"contention.aborts", stats.Contention.Aborts},
+		{"write_amplification.commits", stats.WriteAmplification.Commits},
+		{"write_amplification.written_bytes", stats.WriteAmplification.WrittenBytes},
+		{"write_amplification.payload_bytes", stats.WriteAmplification.PayloadBytes},
+		{"residency.major_faults", stats.Residency.MajorFaults},
+		{"throttle.reads_throttled", stats.Throttle.ReadsThrottled},
+		{"throttle.writes_throttled", stats.Throttle.WritesThrottled},
+		{"memory.shrinks", stats.Memory.Shrinks},
+		{"memory.shed_scans", stats.Memory.ShedScans},
+	}
+
+	for _, cache := range []struct {
+		name  string
+		stats ValueCacheStats
+	}{{"value_cache", stats.ValueCache}, {"negative_cache", stats.NegativeCache}} {
+		counters = append(counters,
+			statsCounter{cache.name + ".hits", cache.stats.Hits},
+			statsCounter{cache.name + ".misses", cache.stats.Misses},
+			statsCounter{cache.name + ".evictions", cache.stats.Evictions},
+			statsCounter{cache.name + ".invalidations", cache.stats.Invalidations},
+		)
+	}
+
+	return gauges, counters
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidID is returned when a migration has an id of 0
+var ErrInvalidID = errors.New("migration id must be greater than 0")
+
+// ErrDuplicateID is returned when more than one migration has the same id
+var ErrDuplicateID = errors.New("migration id is not unique")
+
+// ErrNilUp is returned when a migration has no function to apply it
+var ErrNilUp = errors.New("migration function is nil")
+
+// ErrOutOfOrder is returned when a migration that has not been applied has a lower id than a migration already applied
+var ErrOutOfOrder = errors.New("migration id is lower than the id of an applied migration")
+
+func (migrationErr *MigrationError) Error() string {
+	return fmt.Sprintf("migration %d (%s) failed: %s", migrationErr.ID, migrationErr.Name, migrationErr.Err.Error())
+}
+
+func (migrationErr *MigrationError) Unwrap() error {
+	return migrationErr.Err
+}
@@ -0,0 +1,198 @@
+package migrations
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Mari Migrations
+
+// Open
+//
+//	Open a Mari instance and apply the migrations that have not been applied to it yet, in ascending order of id.
+//	If a migration fails, the instance is closed and a MigrationError is returned, leaving the migrations before it applied.
+func Open(opts mariv2.InitOpts, migrations []*Migration) (*mariv2.Mari, error) {
+	mariInst, openErr := mariv2.Open(opts)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	_, runErr := Run(mariInst, migrations)
+	if runErr != nil {
+		mariInst.Close()
+		return nil, runErr
+	}
+
+	return mariInst, nil
+}
+
+// Run
+//
+//	Apply the migrations that have not been applied to the instance yet, in ascending order of id, and return the ids of the migrations applied.
+//	Each migration is run in its own read-write transaction, which also records its id in the system keyspace, so a migration is either applied and recorded, or neither.
+//	A migration applied concurrently by another call to Run is skipped, and every migration is validated before any are applied.
+//	A migration that has not been applied, with a lower id than an applied migration, is rejected with ErrOutOfOrder, since it would not be applied in order.
+func Run(mariInst *mariv2.Mari, migrations []*Migration) ([]uint64, error) {
+	sorted, validateErr := validate(migrations)
+	if validateErr != nil {
+		return nil, validateErr
+	}
+
+	applied, appliedErr := Applied(mariInst)
+	if appliedErr != nil {
+		return nil, appliedErr
+	}
+
+	isApplied := make(map[uint64]bool, len(applied))
+	var lastApplied uint64
+	for _, appliedMigration := range applied {
+		isApplied[appliedMigration.ID] = true
+		lastApplied = max(lastApplied, appliedMigration.ID)
+	}
+
+	var pending []*Migration
+	for _, migration := range sorted {
+		if isApplied[migration.ID] {
+			continue
+		}
+
+		if migration.ID < lastApplied {
+			return nil, fmt.Errorf("%w: migration %d (%s), last applied %d", ErrOutOfOrder, migration.ID, migration.Name, lastApplied)
+		}
+
+		pending = append(pending, migration)
+	}
+
+	var ran []uint64
+	for _, migration := range pending {
+		wasApplied, applyErr := apply(mariInst, migration)
+		if applyErr != nil {
+			return ran, &MigrationError{ID: migration.ID, Name: migration.Name, Err: applyErr}
+		}
+
+		if wasApplied {
+			ran = append(ran, migration.ID)
+		}
+	}
+
+	return ran, nil
+}
+
+// Applied
+//
+//	Get the migrations recorded as applied to the instance, in ascending order of id.
+func Applied(mariInst *mariv2.Mari) ([]*AppliedMigration, error) {
+	var applied []*AppliedMigration
+	readErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+		kvPairs, rangeErr := tx.RangeSystem(Bucket)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		applied = make([]*AppliedMigration, 0, len(kvPairs))
+		for _, kvPair := range kvPairs {
+			appliedMigration, decodeErr := decodeApplied(kvPair)
+			if decodeErr != nil {
+				return decodeErr
+			}
+
+			applied = append(applied, appliedMigration)
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return applied, nil
+}
+
+// apply
+//
+//	Run a migration and record it as applied in the same read-write transaction.
+//	If the migration was recorded by a concurrent call to Run, it is not run again, and false is returned.
+func apply(mariInst *mariv2.Mari, migration *Migration) (bool, error) {
+	var wasApplied bool
+	updateErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		wasApplied = false
+
+		kvPair, getErr := tx.GetSystem(Bucket, encodeID(migration.ID))
+		if getErr != nil || kvPair != nil {
+			return getErr
+		}
+
+		upErr := migration.Up(tx)
+		if upErr != nil {
+			return upErr
+		}
+
+		wasApplied = true
+		return tx.PutSystem(Bucket, encodeID(migration.ID), encodeApplied(migration.Name, time.Now()))
+	})
+
+	if updateErr != nil {
+		return false, updateErr
+	}
+
+	return wasApplied, nil
+}
+
+// validate
+//
+//	Check that every migration has a unique id greater than 0 and a function to apply it, and return the migrations sorted by id.
+func validate(migrations []*Migration) ([]*Migration, error) {
+	seen := make(map[uint64]bool, len(migrations))
+	for _, migration := range migrations {
+		switch {
+		case migration == nil || migration.Up == nil:
+			return nil, ErrNilUp
+		case migration.ID == 0:
+			return nil, fmt.Errorf("%w: migration (%s)", ErrInvalidID, migration.Name)
+		case seen[migration.ID]:
+			return nil, fmt.Errorf("%w: migration %d (%s)", ErrDuplicateID, migration.ID, migration.Name)
+		}
+
+		seen[migration.ID] = true
+	}
+
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(first, second *Migration) int { return cmp.Compare(first.ID, second.ID) })
+	return sorted, nil
+}
+
+// encodeID
+//
+//	Encode a migration id as the key it is recorded under. The id is big endian, so applied migrations are sorted by id in the system keyspace.
+func encodeID(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// encodeApplied
+//
+//	Encode the time a migration was applied, followed by its name, as the value it is recorded with.
+func encodeApplied(name string, appliedAt time.Time) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(appliedAt.UnixNano())), name...)
+}
+
+// decodeApplied
+//
+//	Decode an applied migration from the key-value pair it is recorded with.
+func decodeApplied(kvPair *mariv2.KeyValuePair) (*AppliedMigration, error) {
+	if len(kvPair.Key) != 8 || len(kvPair.Value) < 8 {
+		return nil, errors.New("applied migration record is corrupt")
+	}
+
+	return &AppliedMigration{
+		ID:        binary.BigEndian.Uint64(kvPair.Key),
+		Name:      string(kvPair.Value[8:]),
+		AppliedAt: time.Unix(0, int64(binary.BigEndian.Uint64(kvPair.Value))),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+// Migration is a transactional change to the data of an instance, like a schema change, applied once per instance
+type Migration struct {
+	// ID: the unique id of the migration. Migrations are applied in ascending order of id, and ids must be greater than 0
+	ID uint64
+	// Name: a description of the migration, recorded with its id when applied
+	Name string
+	// Up: the function that applies the migration, run in a read-write transaction. Like any read-write transaction, it can be run again if the transaction conflicts, so it should only change the instance through the transaction
+	Up func(tx *mariv2.Tx) error
+}
+
+// AppliedMigration is a migration recorded as applied in the system keyspace of an instance
+type AppliedMigration struct {
+	// ID: the id of the migration
+	ID uint64
+	// Name: the name of the migration when it was applied
+	Name string
+	// AppliedAt: the time the migration was applied
+	AppliedAt time.Time
+}
+
+// MigrationError is returned when a migration fails, and wraps the error of the migration
+type MigrationError struct {
+	// ID: the id of the failed migration
+	ID uint64
+	// Name: the name of the failed migration
+	Name string
+	// Err: the error returned by the migration, or by the transaction it was run in
+	Err error
+}
+
+// Bucket is the bucket of the system keyspace where applied migrations are recorded
+const Bucket = "migrations"
@@ -23,6 +23,13 @@ func (mapped MMap) Flush() error {
 	return unix.Msync(mapped, unix.MS_SYNC)
 }
 
+// FlushAsync
+//
+//	Schedules the byte slice from the mmap to be written to disk, without waiting for the write.
+func (mapped MMap) FlushAsync() error {
+	return unix.Msync(mapped, unix.MS_ASYNC)
+}
+
 // Unmap
 //
 //	Unmaps the byte slice from the memory mapped file.
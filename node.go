@@ -1,7 +1,6 @@
 package mariv2
 
 import (
-	"errors"
 	"sync/atomic"
 	"unsafe"
 )
@@ -20,8 +19,12 @@ func (mariInst *Mari) copyINode(node *INode) *INode {
 	nodeCopy.version = node.version
 	nodeCopy.bitmap = node.bitmap
 	nodeCopy.leaf = node.leaf
+	nodeCopy.count = node.count
+	nodeCopy.trace = node.trace
 	nodeCopy.children = make([]*INode, len(node.children))
 
+	node.trace.recordCopy()
+
 	copy(nodeCopy.children, node.children)
 	return nodeCopy
 }
@@ -30,16 +33,15 @@ func (mariInst *Mari) copyINode(node *INode) *INode {
 //
 //	Determine the end offset of a serialized MariINode.
 //	This will be the start offset through the children index, plus (number of children * 8 bytes).
-func (node *INode) determineEndOffsetINode() uint16 {
+//	The number of children is the length of the child array, which is kept equal to the population of the bitmap, so the bitmap is not counted again.
+//	If the subtree count is serialized, the children are shifted by 8 bytes.
+func (node *INode) determineEndOffsetINode(withCount bool) uint16 {
 	nodeEndOffset := uint16(0)
-	encodedChildrenLength := func() int {
-		var totalChildren int
-		for _, subBitmap := range node.bitmap {
-			totalChildren += calculateHammingWeight(subBitmap)
-		}
+	encodedChildrenLength := len(node.children) * NodeChildPtrSize
 
-		return totalChildren * NodeChildPtrSize
-	}()
+	if withCount {
+		nodeEndOffset += OffsetSize64
+	}
 
 	if encodedChildrenLength != 0 {
 		nodeEndOffset += uint16(NodeChildrenIdx + encodedChildrenLength)
@@ -54,7 +56,8 @@ func (node *INode) determineEndOffsetINode() uint16 {
 //
 //	Determine the end offset of a serialized MariLNode.
 //	This will be the start offset through the key index, plus the length of the key and the length of the value.
-func (node *LNode) determineEndOffsetLNode() uint16 {
+//	If the value checksum is serialized, the node is extended by the size of the checksum.
+func (node *LNode) determineEndOffsetLNode(withChecksum bool) uint16 {
 	nodeEndOffset := uint16(0)
 	if node.key != nil {
 		nodeEndOffset += uint16(NodeKeyIdx + int(node.keyLength) + len(node.value))
@@ -62,6 +65,10 @@ func (node *LNode) determineEndOffsetLNode() uint16 {
 		nodeEndOffset += NodeKeyIdx
 	}
 
+	if withChecksum {
+		nodeEndOffset += NodeChecksumSize
+	}
+
 	return nodeEndOffset - 1
 }
 
@@ -75,22 +82,45 @@ func (node *LNode) getEndOffsetLNode() uint64 {
 
 // getChildNode
 //
-//	Get the child node of an internal node.
+//	Get the child node at a position in the children of an internal node.
 //	If the version is the same, set child as that node since it exists in the path.
 //	Otherwise, read the node from the memory map.
-func (mariInst *Mari) getChildNode(childOffset *INode, version uint64) (*INode, error) {
+//	The trace of the node is passed to the child, so every node below a traced root is recorded.
+//	In degraded mode, a quarantined or corrupt child is returned as a QuarantineError.
+func (mariInst *Mari) getChildNode(node *INode, pos int) (*INode, error) {
+	return mariInst.getChildNodeFromMMap(mariInst.data.Load().(MMap), node, pos)
+}
+
+// getChildNodeFromMMap
+//
+//	Get the child of a node at a position from a loaded memory map, so scans that visit the children of a node in order share a single load of the memory map.
+//	Each child is only read when it is reached, so a scan that stops early never reads the children after it.
+func (mariInst *Mari) getChildNodeFromMMap(mMap MMap, node *INode, pos int) (*INode, error) {
 	var childNode *INode
 	var desErr error
 
-	if childOffset.version == version && childOffset.startOffset == 0 {
+	childOffset := node.children[pos]
+	if childOffset.version == node.version && childOffset.startOffset == 0 {
 		childNode = childOffset
 	} else {
-		childNode, desErr = mariInst.readINodeFromMemMap(childOffset.startOffset)
+		if mariInst.degraded {
+			quarantined := mariInst.loadQuarantined(childOffset.startOffset)
+			if quarantined != nil {
+				return nil, quarantined
+			}
+		}
+
+		childNode, desErr = mariInst.readINodeFromMMap(mMap, childOffset.startOffset)
 		if desErr != nil {
-			return nil, desErr
+			return nil, mariInst.quarantineOnCorrupt(childOffset.startOffset, nil, desErr)
 		}
+
+		node.trace.recordRead(childNode)
 	}
 
+	node.trace.recordVisit()
+	childNode.trace = node.trace
+
 	return childNode, nil
 }
 
@@ -104,9 +134,11 @@ func getSerializedNodeSize(data []byte) uint64 {
 // initRoot
 //
 //	Initialize the version 0 root where operations will begin traversing.
-func (mariInst *Mari) initRoot() (uint64, error) {
+//	The root leaf is stamped with the creation timestamp.
+func (mariInst *Mari) initRoot(timestamp uint64) (uint64, error) {
 	root := mariInst.pool.getINode()
 	root.startOffset = uint64(InitRootOffset)
+	root.leaf.timestamp = timestamp
 
 	endOffset, writeNodeErr := mariInst.writeINodeToMemMap(root)
 	if writeNodeErr != nil {
@@ -134,10 +166,11 @@ func (mariInst *Mari) newInternalNode(version uint64) *INode {
 // newLeafNode
 //
 //	Creates a new leaf node when path copying Mari, which stores a key value pair.
-//	It will also include the version of Mari.
-func (mariInst *Mari) newLeafNode(key, value []byte, version uint64) *LNode {
+//	It will also include the version of Mari, and the timestamp if the leaf is being moved. New leaves have a timestamp of 0 until they are committed.
+func (mariInst *Mari) newLeafNode(key, value []byte, version, timestamp uint64) *LNode {
 	lNode := mariInst.pool.getLNode()
 	lNode.version = version
+	lNode.timestamp = timestamp
 	lNode.keyLength = uint8(len(key))
 	lNode.key = key
 	lNode.value = value
@@ -148,33 +181,54 @@ func (mariInst *Mari) newLeafNode(key, value []byte, version uint64) *LNode {
 // readINodeFromMemMap
 //
 //	Reads an internal node in Mari from the serialized memory map.
-func (mariInst *Mari) readINodeFromMemMap(startOffset uint64) (node *INode, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			node = nil
-			err = errors.New("error reading node from mem map")
-		}
-	}()
+//	The header and the node are bounds checked against the memory map before slicing, and the node must record the offset it was read from.
+//	An invalid node is returned as a RegionError wrapping ErrCorrupt, with the offset of the node.
+func (mariInst *Mari) readINodeFromMemMap(startOffset uint64) (*INode, error) {
+	return mariInst.readINodeFromMMap(mariInst.data.Load().(MMap), startOffset)
+}
 
+// readINodeFromMMap
+//
+//	Reads an internal node and its leaf from a loaded memory map, so nodes read together share a single load of the memory map.
+func (mariInst *Mari) readINodeFromMMap(mMap MMap, startOffset uint64) (*INode, error) {
 	var readErr error
+
+	readErr = checkRegion(mMap, "read internal node header", startOffset, NodeBitmapIdx, ErrCorrupt)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	endOffsetIdx := startOffset + NodeEndOffsetIdx
+	endOffset, readErr := deserializeUint16(mMap[endOffsetIdx : endOffsetIdx+OffsetSize16])
+	if readErr != nil {
+		return nil, readErr
+	}
 
-	mMap := mariInst.data.Load().(MMap)
-	sEndOffset := mMap[endOffsetIdx : endOffsetIdx+OffsetSize16]
+	nodeLength := uint64(endOffset) + 1
+	if nodeLength < NodeChildrenIdx {
+		return nil, &RegionError{Op: "read internal node", Offset: startOffset, Length: nodeLength, MapSize: uint64(len(mMap)), Reason: "node is shorter than the internal node header", Err: ErrCorrupt}
+	}
 
-	endOffset, readErr := deserializeUint16(sEndOffset)
+	readErr = checkRegion(mMap, "read internal node", startOffset, nodeLength, ErrCorrupt)
 	if readErr != nil {
 		return nil, readErr
 	}
 
-	sNode := mMap[startOffset : startOffset+uint64(endOffset)+1]
-	node, readErr = deserializeINode(sNode)
+	sNode, readErr := mariInst.readRegion(mMap, startOffset, nodeLength)
 	if readErr != nil {
 		return nil, readErr
 	}
 
-	leaf, readErr := mariInst.readLNodeFromMemMap(node.leaf.startOffset)
+	node, readErr := deserializeINode(sNode)
+	if readErr != nil {
+		return nil, &RegionError{Op: "read internal node", Offset: startOffset, Length: nodeLength, MapSize: uint64(len(mMap)), Reason: readErr.Error(), Err: ErrCorrupt}
+	}
+
+	if node.startOffset != startOffset {
+		return nil, &RegionError{Op: "read internal node", Offset: startOffset, Length: nodeLength, MapSize: uint64(len(mMap)), Reason: "node does not record the offset it was read from", Err: ErrCorrupt}
+	}
+
+	leaf, readErr := mariInst.readLNodeFromMMap(mMap, node.leaf.startOffset)
 	if readErr != nil {
 		return nil, readErr
 	}
@@ -186,30 +240,65 @@ func (mariInst *Mari) readINodeFromMemMap(startOffset uint64) (node *INode, err
 // readLNodeFromMemMap
 //
 //	Reads a leaf node in Mari from the serialized memory map.
-func (mariInst *Mari) readLNodeFromMemMap(startOffset uint64) (node *LNode, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			node = nil
-			err = errors.New("error reading node from mem map")
-		}
-	}()
+//	The header and the node are bounds checked against the memory map before slicing, and the key length must fit within the node.
+//	If the file has value checksums, the checksum is read with the node but is only validated by tx.GetVerified and Verify.
+//	While a legacy layout file is upgraded, leaf nodes are read without a timestamp.
+//	An invalid node is returned as a RegionError wrapping ErrCorrupt, with the offset of the node.
+func (mariInst *Mari) readLNodeFromMemMap(startOffset uint64) (*LNode, error) {
+	return mariInst.readLNodeFromMMap(mariInst.data.Load().(MMap), startOffset)
+}
 
+// readLNodeFromMMap
+//
+//	Reads a leaf node from a loaded memory map.
+func (mariInst *Mari) readLNodeFromMMap(mMap MMap, startOffset uint64) (*LNode, error) {
 	var readErr error
+
+	readErr = checkRegion(mMap, "read leaf node header", startOffset, NodeTimestampIdx, ErrCorrupt)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	endOffsetIdx := startOffset + NodeEndOffsetIdx
-	mMap := mariInst.data.Load().(MMap)
-	sEndOffset := mMap[endOffsetIdx : endOffsetIdx+OffsetSize16]
+	endOffset, readErr := deserializeUint16(mMap[endOffsetIdx : endOffsetIdx+OffsetSize16])
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	minLength := uint64(NodeKeyIdx)
+	switch {
+	case mariInst.legacyTimestamp > 0:
+		minLength = LegacyNodeKeyIdx
+	case mariInst.valueChecksums:
+		minLength += NodeChecksumSize
+	}
 
-	endOffset, readErr := deserializeUint16(sEndOffset)
+	nodeLength := uint64(endOffset) + 1
+	if nodeLength < minLength {
+		return nil, &RegionError{Op: "read leaf node", Offset: startOffset, Length: nodeLength, MapSize: uint64(len(mMap)), Reason: "node is shorter than the leaf node header", Err: ErrCorrupt}
+	}
+
+	readErr = checkRegion(mMap, "read leaf node", startOffset, nodeLength, ErrCorrupt)
 	if readErr != nil {
 		return nil, readErr
 	}
 
-	sNode := mMap[startOffset : startOffset+uint64(endOffset)+1]
-	node, readErr = deserializeLNode(sNode)
+	sNode, readErr := mariInst.readRegion(mMap, startOffset, nodeLength)
 	if readErr != nil {
 		return nil, readErr
 	}
+
+	var node *LNode
+	if mariInst.legacyTimestamp > 0 {
+		node, readErr = deserializeLegacyLNode(sNode, mariInst.legacyTimestamp)
+	} else {
+		node, readErr = deserializeLNode(sNode, mariInst.valueChecksums)
+	}
+
+	if readErr != nil {
+		return nil, &RegionError{Op: "read leaf node", Offset: startOffset, Length: nodeLength, MapSize: uint64(len(mMap)), Reason: readErr.Error(), Err: ErrCorrupt}
+	}
+
 	return node, nil
 }
 
@@ -224,23 +313,24 @@ func storeINodeAsPointer(node *INode) *unsafe.Pointer {
 // writeINodeToMemMap
 //
 //	Serializes and writes an internal node instance to the memory map.
-func (mariInst *Mari) writeINodeToMemMap(node *INode) (offset uint64, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			offset = 0
-			err = errors.New("error writing new path to mmap")
-		}
-	}()
-
+//	If the node does not fit in the memory map, a RegionError wrapping ErrOutOfBounds is returned.
+func (mariInst *Mari) writeINodeToMemMap(node *INode) (uint64, error) {
 	var writeErr error
-	sNode, writeErr := node.serializeINode(false)
+	sNode, writeErr := node.serializeINode(false, mariInst.subtreeCounts)
 	if writeErr != nil {
 		return 0, writeErr
 	}
 
 	mMap := mariInst.data.Load().(MMap)
-	copy(mMap[node.startOffset:node.leaf.startOffset+1], sNode)
+	writeErr = checkRegion(mMap, "write internal node", node.startOffset, uint64(len(sNode)), ErrOutOfBounds)
+	if writeErr != nil {
+		return 0, writeErr
+	}
+
+	writeErr = mariInst.writeRegion(mMap, sNode, node.startOffset)
+	if writeErr != nil {
+		return 0, writeErr
+	}
 
 	writeErr = mariInst.flushRegionToDisk(node.startOffset, node.getEndOffsetINode())
 	if writeErr != nil {
@@ -257,24 +347,25 @@ func (mariInst *Mari) writeINodeToMemMap(node *INode) (offset uint64, err error)
 // writeLNodeToMemMap
 //
 //	Serializes and writes a MariNode instance to the memory map.
-func (mariInst *Mari) writeLNodeToMemMap(node *LNode) (offset uint64, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			offset = 0
-			err = errors.New("error writing new path to mmap")
-		}
-	}()
-
+//	If the node does not fit in the memory map, a RegionError wrapping ErrOutOfBounds is returned.
+func (mariInst *Mari) writeLNodeToMemMap(node *LNode) (uint64, error) {
 	var writeErr error
-	sNode, writeErr := node.serializeLNode()
+	sNode, writeErr := node.serializeLNode(mariInst.valueChecksums)
 	if writeErr != nil {
 		return 0, writeErr
 	}
 
 	endOffset := node.getEndOffsetLNode()
 	mMap := mariInst.data.Load().(MMap)
-	copy(mMap[node.startOffset:endOffset+1], sNode)
+	writeErr = checkRegion(mMap, "write leaf node", node.startOffset, uint64(len(sNode)), ErrOutOfBounds)
+	if writeErr != nil {
+		return 0, writeErr
+	}
+
+	writeErr = mariInst.writeRegion(mMap, sNode, node.startOffset)
+	if writeErr != nil {
+		return 0, writeErr
+	}
 
 	writeErr = mariInst.flushRegionToDisk(node.startOffset, endOffset)
 	if writeErr != nil {
@@ -285,20 +376,19 @@ func (mariInst *Mari) writeLNodeToMemMap(node *LNode) (offset uint64, err error)
 
 // writeNodesToMemMap
 //
-//	Write a list of serialized nodes to the memory map. If the mem map is too small for the incoming nodes, dynamically resize.
-func (mariInst *Mari) writeNodesToMemMap(snodes []byte, offset uint64) (ok bool, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			ok = false
-			err = errors.New("error writing new path to mmap")
-		}
-	}()
+//	Write a list of serialized nodes to the memory map.
+//	If the nodes do not fit in the memory map, a RegionError wrapping ErrOutOfBounds is returned.
+func (mariInst *Mari) writeNodesToMemMap(snodes []byte, offset uint64) (bool, error) {
+	mMap := mariInst.data.Load().(MMap)
+	writeErr := checkRegion(mMap, "write path", offset, uint64(len(snodes)), ErrOutOfBounds)
+	if writeErr != nil {
+		return false, writeErr
+	}
 
-	lenSNodes := uint64(len(snodes))
-	endOffset := offset + lenSNodes
+	writeErr = mariInst.writeRegion(mMap, snodes, offset)
+	if writeErr != nil {
+		return false, writeErr
+	}
 
-	mMap := mariInst.data.Load().(MMap)
-	copy(mMap[offset:endOffset], snodes)
 	return true, nil
 }
@@ -0,0 +1,58 @@
+package mariv2
+
+import "bytes"
+
+//============================================= Mari Key Normalizer
+
+// ID
+//
+//	Get the id of the normalizer, which is persisted in the file.
+func (LowerASCIINormalizer) ID() uint64 {
+	return KeyNormalizerLowerASCII
+}
+
+// Normalize
+//
+//	Lowercase the ASCII letters in the key. Bytes outside of A-Z are left as is, so keys that are not ASCII are not modified.
+//	If the key has no uppercase ASCII letters, it is returned without copying.
+func (LowerASCIINormalizer) Normalize(key []byte) []byte {
+	var normalized []byte
+	for idx, b := range key {
+		if 'A' <= b && b <= 'Z' {
+			if normalized == nil {
+				normalized = bytes.Clone(key)
+			}
+
+			normalized[idx] = b + 'a' - 'A'
+		}
+	}
+
+	if normalized == nil {
+		return key
+	}
+
+	return normalized
+}
+
+// keyNormalizerID
+//
+//	Get the id of the key normalizer of the instance, which is 0 if keys are not normalized.
+func (mariInst *Mari) keyNormalizerID() uint64 {
+	if mariInst.keyNormalizer == nil {
+		return 0
+	}
+
+	return mariInst.keyNormalizer.ID()
+}
+
+// normalizeKey
+//
+//	Apply the key normalizer of the instance to a key passed to a write or lookup.
+//	Keys under ReservedKeyPrefix hold state persisted by Mari, so they are never normalized, and nil stays nil so unbounded scans stay unbounded.
+func (mariInst *Mari) normalizeKey(key []byte) []byte {
+	if mariInst.keyNormalizer == nil || key == nil || isReservedKey(key) {
+		return key
+	}
+
+	return mariInst.keyNormalizer.Normalize(key)
+}
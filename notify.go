@@ -0,0 +1,83 @@
+package mariv2
+
+//============================================= Mari Notify
+
+// VersionChan
+//
+//	Subscribe to the version of every successful commit, so external components can react to new versions without polling Stats.
+//	The channel is buffered with the latest version only, so a slow subscriber skips to the newest version instead of blocking commits.
+//	Compaction resets the version, and subscribers are notified with the version of the compacted root.
+//	The returned cancel function unsubscribes and closes the channel. All channels are closed when the instance is closed.
+func (mariInst *Mari) VersionChan() (<-chan uint64, func()) {
+	subscribers := mariInst.subscribers
+	subscribers.lock.Lock()
+	defer subscribers.lock.Unlock()
+
+	versionChan := make(chan uint64, 1)
+	if subscribers.closed {
+		close(versionChan)
+		return versionChan, func() {}
+	}
+
+	subscribers.chans[versionChan] = struct{}{}
+
+	cancel := func() {
+		subscribers.lock.Lock()
+		defer subscribers.lock.Unlock()
+
+		if _, ok := subscribers.chans[versionChan]; ok {
+			delete(subscribers.chans, versionChan)
+			close(versionChan)
+		}
+	}
+
+	return versionChan, cancel
+}
+
+// notifyVersion
+//
+//	Send the latest committed version to every subscriber, replacing a version that has not been received yet.
+//	The version is loaded from the metadata while holding the subscriber lock, so concurrent commits notify versions in order.
+//	The resize read or write lock must be held by the caller.
+func (mariInst *Mari) notifyVersion() {
+	subscribers := mariInst.subscribers
+	subscribers.lock.Lock()
+	defer subscribers.lock.Unlock()
+
+	if len(subscribers.chans) == 0 {
+		return
+	}
+
+	_, version, loadErr := mariInst.loadMetaVersion()
+	if loadErr != nil || (subscribers.notified && version == subscribers.lastVersion) {
+		return
+	}
+
+	subscribers.notified = true
+	subscribers.lastVersion = version
+
+	for versionChan := range subscribers.chans {
+		select {
+		case <-versionChan:
+		default:
+		}
+
+		versionChan <- version
+	}
+}
+
+// closeSubscribers
+//
+//	Close every subscribed channel, and close channels subscribed afterwards immediately.
+func (mariInst *Mari) closeSubscribers() {
+	subscribers := mariInst.subscribers
+	subscribers.lock.Lock()
+	defer subscribers.lock.Unlock()
+
+	for versionChan := range subscribers.chans {
+		close(versionChan)
+	}
+
+	subscribers.chans = make(map[chan uint64]struct{})
+	subscribers.closed = true
+}
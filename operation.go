@@ -19,26 +19,56 @@ import (
 //	If the leaf node does not contain the same key, the operation creates a new internal node, and inserts the new leaf node for the incoming key and value as well as the existing child node into the new internal node.
 //	Attempts to compare and swap the current leaf node with the new internal node containing the existing child node and the new leaf node for the incoming key and value.
 //	If the node is an internal node, the operation traverses down the tree to the internal node and the above steps are repeated until the key-value pair is inserted.
-func (mariInst *Mari) putRecursive(node *unsafe.Pointer, key, value []byte, level int) (bool, error) {
+//	When the leaf of a node is replaced by a shorter key or moved for a longer key, it is relocated into the child at its index, creating the child if it does not exist.
+//	The leaf for the key-value pair is stamped with kvVersion and kvTimestamp. Existing leaves that are moved down a level keep their original version and timestamp, so a leaf version is the version the key-value pair was last written.
+//	The subtree count of the copy is updated from the change in its leaf and the change in the count of each modified child.
+func (mariInst *Mari) putRecursive(node *unsafe.Pointer, key, value []byte, kvVersion, kvTimestamp uint64, level int) (bool, error) {
 	var putErr error
 
 	currNode := loadINodeFromPointer(node)
 	nodeCopy := mariInst.copyINode(currNode)
-	nodeCopy.leaf.version = nodeCopy.version
 
-	putNewINode := func(node *INode, currIdx byte, uKey, uVal []byte) (*INode, error) {
+	var childrenCountDelta int64
+	putNewINode := func(node *INode, currIdx byte, uKey, uVal []byte, uVersion, uTimestamp uint64) (*INode, error) {
 		node.bitmap = setBit(node.bitmap, currIdx)
 		pos := getPosition(node.bitmap, currIdx, level)
 
 		newINode := mariInst.newInternalNode(node.version)
 		iNodePtr := storeINodeAsPointer(newINode)
-		_, putINodeErr := mariInst.putRecursive(iNodePtr, uKey, uVal, level+1)
+		_, putINodeErr := mariInst.putRecursive(iNodePtr, uKey, uVal, uVersion, uTimestamp, level+1)
 		if putINodeErr != nil {
 			return nil, putINodeErr
 		}
 
 		updatedINode := loadINodeFromPointer(iNodePtr)
 		node.children = extendTable(node.children, node.bitmap, pos, updatedINode)
+		childrenCountDelta += int64(updatedINode.count)
+
+		return node, nil
+	}
+
+	relocateLeaf := func(node *INode, leaf *LNode) (*INode, error) {
+		leafIdx := getIndexForLevel(leaf.key, level)
+		if !isBitSet(node.bitmap, leafIdx) {
+			return putNewINode(node, leafIdx, leaf.key, leaf.value, leaf.version, leaf.timestamp)
+		}
+
+		leafPos := getPosition(node.bitmap, leafIdx, level)
+		childNode, getChildErr := mariInst.getChildNode(node, leafPos)
+		if getChildErr != nil {
+			return nil, getChildErr
+		}
+
+		childNode.version = node.version
+		childPtr := storeINodeAsPointer(childNode)
+		_, relocateErr := mariInst.putRecursive(childPtr, leaf.key, leaf.value, leaf.version, leaf.timestamp, level+1)
+		if relocateErr != nil {
+			return nil, relocateErr
+		}
+
+		updatedCNode := loadINodeFromPointer(childPtr)
+		node.children[leafPos] = updatedCNode
+		childrenCountDelta += int64(updatedCNode.count) - int64(childNode.count)
 
 		return node, nil
 	}
@@ -47,20 +77,16 @@ func (mariInst *Mari) putRecursive(node *unsafe.Pointer, key, value []byte, leve
 		switch {
 		case bytes.Equal(nodeCopy.leaf.key, key):
 			if !bytes.Equal(nodeCopy.leaf.value, value) {
-				nodeCopy.leaf = mariInst.newLeafNode(key, value, nodeCopy.version)
+				nodeCopy.leaf = mariInst.newLeafNode(key, value, kvVersion, kvTimestamp)
 			}
 		default:
 			currentLeaf := nodeCopy.leaf
-			nodeCopy.leaf = mariInst.newLeafNode(key, value, nodeCopy.version)
+			nodeCopy.leaf = mariInst.newLeafNode(key, value, kvVersion, kvTimestamp)
 
 			if len(currentLeaf.key) > len(key) {
-				idx := getIndexForLevel(currentLeaf.key, level)
-
-				if !isBitSet(nodeCopy.bitmap, idx) {
-					nodeCopy, putErr = putNewINode(nodeCopy, idx, currentLeaf.key, currentLeaf.value)
-					if putErr != nil {
-						return false, putErr
-					}
+				nodeCopy, putErr = relocateLeaf(nodeCopy, currentLeaf)
+				if putErr != nil {
+					return false, putErr
 				}
 			}
 		}
@@ -68,78 +94,52 @@ func (mariInst *Mari) putRecursive(node *unsafe.Pointer, key, value []byte, leve
 		index := getIndexForLevel(key, level)
 
 		switch {
+		case bytes.Equal(nodeCopy.leaf.key, key):
+			if !bytes.Equal(nodeCopy.leaf.value, value) {
+				nodeCopy.leaf = mariInst.newLeafNode(key, value, kvVersion, kvTimestamp)
+			}
 		case !isBitSet(nodeCopy.bitmap, index):
 			if level > 0 {
 				popCount := populationCount(nodeCopy.bitmap)
 				currentLeaf := nodeCopy.leaf
 
 				switch {
-				case bytes.Equal(currentLeaf.key, key):
-					if !bytes.Equal(currentLeaf.value, value) {
-						nodeCopy.leaf = mariInst.newLeafNode(key, value, nodeCopy.version)
-					}
 				case len(currentLeaf.key) == 0 && popCount == 0:
-					nodeCopy.leaf = mariInst.newLeafNode(key, value, nodeCopy.version)
+					nodeCopy.leaf = mariInst.newLeafNode(key, value, kvVersion, kvTimestamp)
 				case len(currentLeaf.key) == 0 && popCount > 0:
-					nodeCopy, putErr = putNewINode(nodeCopy, index, key, value)
+					nodeCopy, putErr = putNewINode(nodeCopy, index, key, value, kvVersion, kvTimestamp)
 					if putErr != nil {
 						return false, putErr
 					}
 				default:
 					switch {
 					case len(key) > len(currentLeaf.key) && len(currentLeaf.key) > 0:
-						nodeCopy, putErr = putNewINode(nodeCopy, index, key, value)
+						nodeCopy, putErr = putNewINode(nodeCopy, index, key, value, kvVersion, kvTimestamp)
 						if putErr != nil {
 							return false, putErr
 						}
 					case len(currentLeaf.key) > len(key):
-						nodeCopy.leaf = mariInst.newLeafNode(key, value, nodeCopy.version)
-						newIdx := getIndexForLevel(currentLeaf.key, level)
-
-						if !isBitSet(nodeCopy.bitmap, newIdx) {
-							nodeCopy, putErr = putNewINode(nodeCopy, newIdx, currentLeaf.key, currentLeaf.value)
-							if putErr != nil {
-								return false, putErr
-							}
+						nodeCopy.leaf = mariInst.newLeafNode(key, value, kvVersion, kvTimestamp)
+						nodeCopy, putErr = relocateLeaf(nodeCopy, currentLeaf)
+						if putErr != nil {
+							return false, putErr
 						}
 					default:
-						nodeCopy.leaf = mariInst.newLeafNode(nil, nil, nodeCopy.version)
+						nodeCopy.leaf = mariInst.newLeafNode(nil, nil, nodeCopy.version, 0)
 
-						nodeCopy, putErr = putNewINode(nodeCopy, index, key, value)
+						nodeCopy, putErr = putNewINode(nodeCopy, index, key, value, kvVersion, kvTimestamp)
 						if putErr != nil {
 							return false, putErr
 						}
 
-						newIdx := getIndexForLevel(currentLeaf.key, level)
-
-						if !isBitSet(nodeCopy.bitmap, newIdx) {
-							nodeCopy, putErr = putNewINode(nodeCopy, newIdx, currentLeaf.key, currentLeaf.value)
-							if putErr != nil {
-								return false, putErr
-							}
-						} else {
-							newPos := getPosition(nodeCopy.bitmap, newIdx, level)
-
-							childOffset := nodeCopy.children[newPos]
-							childNode, getChildErr := mariInst.getChildNode(childOffset, nodeCopy.version)
-							if getChildErr != nil {
-								return false, getChildErr
-							}
-
-							childNode.version = nodeCopy.version
-							childPtr := storeINodeAsPointer(childNode)
-							_, putErr = mariInst.putRecursive(childPtr, currentLeaf.key, currentLeaf.value, level+1)
-							if putErr != nil {
-								return false, putErr
-							}
-
-							updatedCNode := loadINodeFromPointer(childPtr)
-							nodeCopy.children[newPos] = updatedCNode
+						nodeCopy, putErr = relocateLeaf(nodeCopy, currentLeaf)
+						if putErr != nil {
+							return false, putErr
 						}
 					}
 				}
 			} else {
-				nodeCopy, putErr = putNewINode(nodeCopy, index, key, value)
+				nodeCopy, putErr = putNewINode(nodeCopy, index, key, value, kvVersion, kvTimestamp)
 				if putErr != nil {
 					return false, putErr
 				}
@@ -147,8 +147,7 @@ func (mariInst *Mari) putRecursive(node *unsafe.Pointer, key, value []byte, leve
 		default:
 			pos := getPosition(nodeCopy.bitmap, index, level)
 
-			childOffset := nodeCopy.children[pos]
-			childNode, getChildErr := mariInst.getChildNode(childOffset, nodeCopy.version)
+			childNode, getChildErr := mariInst.getChildNode(nodeCopy, pos)
 			if getChildErr != nil {
 				return false, getChildErr
 			}
@@ -156,65 +155,73 @@ func (mariInst *Mari) putRecursive(node *unsafe.Pointer, key, value []byte, leve
 			childNode.version = nodeCopy.version
 			childPtr := storeINodeAsPointer(childNode)
 
-			_, putErr = mariInst.putRecursive(childPtr, key, value, level+1)
+			_, putErr = mariInst.putRecursive(childPtr, key, value, kvVersion, kvTimestamp, level+1)
 			if putErr != nil {
 				return false, putErr
 			}
 
-			nodeCopy.children[pos] = loadINodeFromPointer(childPtr)
+			updatedCNode := loadINodeFromPointer(childPtr)
+			nodeCopy.children[pos] = updatedCNode
+			childrenCountDelta += int64(updatedCNode.count) - int64(childNode.count)
 		}
 	}
 
+	nodeCopy.count = uint64(int64(currNode.count) + childrenCountDelta + leafCount(nodeCopy.leaf) - leafCount(currNode.leaf))
 	return mariInst.compareAndSwap(node, currNode, nodeCopy), nil
 }
 
 // getRecursive
 //
 //	Attempts to recursively retrieve a value for a given key within the ordered array mapped trie.
+//	The leaf for the key is located with getLeafRecursive, and the key-value pair is passed through the transform.
+//	Since the trie utilizes path copying, any threads modifying the trie are modifying copies so it the get operation returns the value at the point in time of the get operation.
+func (mariInst *Mari) getRecursive(node *unsafe.Pointer, key []byte, level int, transform Transform) (*KeyValuePair, error) {
+	leaf, getErr := mariInst.getLeafRecursive(node, key, level)
+	if getErr != nil || leaf == nil {
+		return nil, getErr
+	}
+
+	return transform(&KeyValuePair{
+		Version:   leaf.version,
+		Timestamp: leaf.timestamp,
+		Key:       leaf.key,
+		Value:     leaf.value,
+	}), nil
+}
+
+// getLeafRecursive
+//
+//	Attempts to recursively locate the leaf for a given key within the ordered array mapped trie.
 //	For each node traversed to at each level the operation travels to, the sparse index is calculated for the hashed key.
 //	If the bit is not set in the bitmap, return nil since the key has not been inserted yet into the trie.
 //	Otherwise, determine the position in the child node array for the sparse index.
-//	If the child node is a leaf node and the key to be searched for is the same as the key of the child node, the value has been found.
-//	Since the trie utilizes path copying, any threads modifying the trie are modifying copies so it the get operation returns the value at the point in time of the get operation.
-//	If the node is node a leaf node, but instead an internal node, recurse down the path to the next level to the child node in the position of the child node array and repeat the above.
-func (mariInst *Mari) getRecursive(node *unsafe.Pointer, key []byte, level int, transform Transform) (*KeyValuePair, error) {
+//	If the leaf of the node has the key to be searched for, the leaf has been found.
+//	If not, recurse down the path to the next level to the child node in the position of the child node array and repeat the above.
+func (mariInst *Mari) getLeafRecursive(node *unsafe.Pointer, key []byte, level int) (*LNode, error) {
 	currNode := loadINodeFromPointer(node)
 
-	getKeyVal := func() *KeyValuePair {
-		return &KeyValuePair{
-			// Version: currNode.leaf.version,
-			Key:   currNode.leaf.key,
-			Value: currNode.leaf.value,
-		}
+	if bytes.Equal(key, currNode.leaf.key) {
+		return currNode.leaf, nil
 	}
 
 	if len(key) == level {
-		if bytes.Equal(key, currNode.leaf.key) {
-			return transform(getKeyVal()), nil
-		}
 		return nil, nil
-	} else {
-		if bytes.Equal(key, currNode.leaf.key) {
-			return transform(getKeyVal()), nil
-		}
-
-		index := getIndexForLevel(key, level)
-
-		switch {
-		case !isBitSet(currNode.bitmap, index):
-			return nil, nil
-		default:
-			pos := getPosition(currNode.bitmap, index, level)
-			childOffset := currNode.children[pos]
+	}
 
-			childNode, getChildErr := mariInst.getChildNode(childOffset, currNode.version)
-			if getChildErr != nil {
-				return nil, getChildErr
-			}
+	index := getIndexForLevel(key, level)
 
-			childPtr := storeINodeAsPointer(childNode)
-			return mariInst.getRecursive(childPtr, key, level+1, transform)
+	switch {
+	case !isBitSet(currNode.bitmap, index):
+		return nil, nil
+	default:
+		pos := getPosition(currNode.bitmap, index, level)
+		childNode, getChildErr := mariInst.getChildNode(currNode, pos)
+		if getChildErr != nil {
+			return nil, getChildErr
 		}
+
+		childPtr := storeINodeAsPointer(childNode)
+		return mariInst.getLeafRecursive(childPtr, key, level+1)
 	}
 }
 
@@ -234,7 +241,8 @@ func (mariInst *Mari) deleteRecursive(node *unsafe.Pointer, key []byte, level in
 	nodeCopy := mariInst.copyINode(currNode)
 
 	deleteKeyVal := func() bool {
-		nodeCopy.leaf = mariInst.newLeafNode(nil, nil, nodeCopy.version)
+		nodeCopy.leaf = mariInst.newLeafNode(nil, nil, nodeCopy.version, 0)
+		nodeCopy.count = currNode.count - 1
 		return mariInst.compareAndSwap(node, currNode, nodeCopy)
 	}
 
@@ -255,9 +263,7 @@ func (mariInst *Mari) deleteRecursive(node *unsafe.Pointer, key []byte, level in
 			return true, nil
 		default:
 			pos := getPosition(nodeCopy.bitmap, index, level)
-			childOffset := nodeCopy.children[pos]
-
-			childNode, getChildErr := mariInst.getChildNode(childOffset, nodeCopy.version)
+			childNode, getChildErr := mariInst.getChildNode(nodeCopy, pos)
 			if getChildErr != nil {
 				return false, getChildErr
 			}
@@ -272,8 +278,9 @@ func (mariInst *Mari) deleteRecursive(node *unsafe.Pointer, key []byte, level in
 
 			updatedChildNode := loadINodeFromPointer(childPtr)
 			nodeCopy.children[pos] = updatedChildNode
+			nodeCopy.count = uint64(int64(currNode.count) + int64(updatedChildNode.count) - int64(childNode.count))
 
-			if updatedChildNode.leaf.version == nodeCopy.version {
+			if len(updatedChildNode.leaf.key) == 0 {
 				childNodePopCount := populationCount(updatedChildNode.bitmap)
 
 				if childNodePopCount == 0 {
@@ -286,3 +293,13 @@ func (mariInst *Mari) deleteRecursive(node *unsafe.Pointer, key []byte, level in
 		}
 	}
 }
+
+// leafCount
+//
+//	Get 1 if the leaf holds a key-value pair, otherwise 0.
+func leafCount(leaf *LNode) int64 {
+	if len(leaf.key) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package mariv2
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+//============================================= Mari Operation Log
+
+// sampleOp
+//
+//	Start sampling an operation on the transaction with the probability of OpLogSampleRate, tracing the nodes it visits from the root of the transaction.
+//	Returns nil if the operation is not sampled, or if the transaction is already traced by Explain, so the trace of Explain is not split.
+//	The value cache is bypassed while a transaction is traced, so a sampled tx.Get reports the nodes a lookup in the trie visits.
+func (tx *Tx) sampleOp(op string, key []byte) *sampledOp {
+	rate := tx.store.opLogSampleRate
+	if rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return nil
+	}
+
+	root := loadINodeFromPointer(tx.root)
+	if root.trace != nil {
+		return nil
+	}
+
+	sampled := &sampledOp{op: op, key: key, trace: &TxTrace{active: true}, startedAt: time.Now()}
+	root.trace = sampled.trace
+	return sampled
+}
+
+// finish
+//
+//	Stop tracing a sampled operation and log it through the instance logger, with the hash of its key, its latency, the nodes it visited and read, and the total and bytes of the key-value pairs it returned.
+//	The key is logged as a hash, so keys holding personal data are not written to the logs, while the operations on a key can still be correlated.
+func (sampled *sampledOp) finish(tx *Tx, results, resultBytes int, opErr error) {
+	if sampled == nil {
+		return
+	}
+
+	latency := time.Since(sampled.startedAt)
+	sampled.trace.active = false
+	loadINodeFromPointer(tx.root).trace = nil
+
+	attrs := []any{
+		"op", sampled.op,
+		"keyHash", keyHash(sampled.key),
+		"latency", latency,
+		"nodesVisited", sampled.trace.NodesVisited,
+		"nodesRead", sampled.trace.NodesRead,
+		"bytesRead", sampled.trace.BytesRead,
+		"pathCopies", sampled.trace.PathCopies,
+		"results", results,
+		"resultBytes", resultBytes,
+		"version", tx.snapshotVersion,
+	}
+
+	if opErr != nil {
+		attrs = append(attrs, "error", opErr.Error())
+	}
+
+	tx.store.logger.Info("sampled operation", attrs...)
+}
+
+// finishPairs
+//
+//	Finish a sampled operation that returned key-value pairs, counting the bytes of their keys and values.
+func (sampled *sampledOp) finishPairs(tx *Tx, kvPairs []*KeyValuePair, opErr error) {
+	if sampled == nil {
+		return
+	}
+
+	var resultBytes int
+	for _, kvPair := range kvPairs {
+		resultBytes += len(kvPair.Key) + len(kvPair.Value)
+	}
+
+	sampled.finish(tx, len(kvPairs), resultBytes, opErr)
+}
+
+// keyHash
+//
+//	Get the 64 bit FNV-1a hash of a key as hex, which is empty for a nil key.
+func keyHash(key []byte) string {
+	if key == nil {
+		return ""
+	}
+
+	hash := fnv.New64a()
+	hash.Write(key)
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
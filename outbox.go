@@ -0,0 +1,125 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+//============================================= Mari Outbox
+
+// AppendOutbox
+//
+//	Append an event to the outbox in a read-write transaction, so it is committed atomically with the other writes of the transaction.
+//	The id is a hybrid logical clock timestamp, so entries are read in the order they were appended.
+//	Transactions that commit concurrently can commit out of id order, so consumers read every entry not yet acked rather than resuming after the last id.
+func (tx *Tx) AppendOutbox(event []byte) (uint64, error) {
+	if !tx.isWrite {
+		return 0, errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
+	}
+
+	id := tx.store.clock.Now()
+	putErr := tx.PutSystem(OutboxBucket, encodeOutboxID(id), event)
+	if putErr != nil {
+		return 0, putErr
+	}
+
+	return id, nil
+}
+
+// PutWithOutbox
+//
+//	Put a key-value pair and append an event describing it to the outbox in one read-write transaction, so the event is published if and only if the write is committed.
+func (mariInst *Mari) PutWithOutbox(key, value, event []byte) (uint64, error) {
+	var id uint64
+	updateErr := mariInst.UpdateTx(func(tx *Tx) error {
+		putErr := tx.Put(key, value)
+		if putErr != nil {
+			return putErr
+		}
+
+		var appendErr error
+		id, appendErr = tx.AppendOutbox(event)
+		return appendErr
+	})
+
+	if updateErr != nil {
+		return 0, updateErr
+	}
+
+	return id, nil
+}
+
+// ReadOutbox
+//
+//	Read up to limit entries of the outbox that have not been acked, in id order.
+//	Entries remain in the outbox until they are acked, so a consumer that fails before acking reads them again, which delivers each event at least once.
+func (mariInst *Mari) ReadOutbox(limit int) ([]*OutboxEntry, error) {
+	if limit <= 0 {
+		return nil, errors.New("outbox read limit must be greater than 0")
+	}
+
+	bucketPrefix, bucketErr := systemBucket(OutboxBucket)
+	if bucketErr != nil {
+		return nil, bucketErr
+	}
+
+	var entries []*OutboxEntry
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		kvPairs, iterErr := tx.iterate(bucketPrefix, limit, nil)
+		if iterErr != nil {
+			return iterErr
+		}
+
+		for _, kvPair := range kvPairs {
+			if !bytes.HasPrefix(kvPair.Key, bucketPrefix) {
+				break
+			}
+
+			id := kvPair.Key[len(bucketPrefix):]
+			if len(id) != 8 {
+				return errors.New("outbox entry key is not a big endian id")
+			}
+
+			entries = append(entries, &OutboxEntry{ID: binary.BigEndian.Uint64(id), Version: kvPair.Version, Event: bytes.Clone(kvPair.Value)})
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return entries, nil
+}
+
+// AckOutbox
+//
+//	Remove published entries from the outbox in one read-write transaction.
+//	Acking an entry that was already acked is a no-op.
+func (mariInst *Mari) AckOutbox(ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return mariInst.UpdateTx(func(tx *Tx) error {
+		for _, id := range ids {
+			deleteErr := tx.DeleteSystem(OutboxBucket, encodeOutboxID(id))
+			if deleteErr != nil {
+				return deleteErr
+			}
+		}
+
+		return nil
+	})
+}
+
+// encodeOutboxID
+//
+//	Encode the id of an outbox entry as a big endian key, so entries are sorted by id.
+func encodeOutboxID(id uint64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, id)
+	return encoded
+}
@@ -1,8 +1,15 @@
 package mariv2
 
 import (
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
 //============================================= Mari Node Pool
@@ -11,60 +18,89 @@ import (
 //
 //	Creates a new node pool for recycling nodes instead of letting garbage collection handle them.
 //	Should help performance when there are a large number of go routines attempting to allocate/deallocate nodes.
-func newPool(maxSize int64) *Pool {
+//	The pool is pre-allocated with the initial size, up to the max retained, and a disabled pool allocates every node.
+func newPool(initialSize, maxSize int64, disabled bool) *Pool {
 	size := int64(0)
-	np := &Pool{maxSize: maxSize, size: size}
+	np := &Pool{initialSize: initialSize, maxSize: maxSize, disabled: disabled, size: size}
 
 	iPool := &sync.Pool{
-		New: func() interface{} { return np.resetINode(&INode{}) },
+		New: func() interface{} {
+			atomic.AddUint64(&np.allocations, 1)
+			return np.resetINode(&INode{})
+		},
 	}
 
 	lPool := &sync.Pool{
-		New: func() interface{} { return np.resetLNode(&LNode{}) },
+		New: func() interface{} {
+			atomic.AddUint64(&np.allocations, 1)
+			return np.resetLNode(&LNode{})
+		},
 	}
 
 	np.iPool = iPool
 	np.lPool = lPool
-	np.initializePools()
+	if !disabled {
+		np.initializePools()
+	}
+
 	return np
 }
 
 // getINode
 //
 //	Attempt to get a pre-allocated internal node from the node pool and decrement the total allocated nodes.
-//	If the pool is empty, a new node is allocated
+//	If the pool is empty or disabled, a new node is allocated
 func (p *Pool) getINode() *INode {
+	atomic.AddUint64(&p.gets, 1)
+	if p.disabled {
+		atomic.AddUint64(&p.allocations, 1)
+		node := p.resetINode(&INode{})
+		p.audit.checkout(unsafe.Pointer(node), PoolNodeInternal)
+		return node
+	}
+
 	node := p.iPool.Get().(*INode)
 	if atomic.LoadInt64(&p.size) > 0 {
 		atomic.AddInt64(&p.size, -1)
 	}
 
+	p.audit.checkout(unsafe.Pointer(node), PoolNodeInternal)
 	return node
 }
 
 // getLNode
 //
 //	Attempt to get a pre-allocated leaf node from the node pool and decrement the total allocated nodes.
-//	If the pool is empty, a new node is allocated
+//	If the pool is empty or disabled, a new node is allocated
 func (p *Pool) getLNode() *LNode {
+	atomic.AddUint64(&p.gets, 1)
+	if p.disabled {
+		atomic.AddUint64(&p.allocations, 1)
+		node := p.resetLNode(&LNode{})
+		p.audit.checkout(unsafe.Pointer(node), PoolNodeLeaf)
+		return node
+	}
+
 	node := p.lPool.Get().(*LNode)
 	if atomic.LoadInt64(&p.size) > 0 {
 		atomic.AddInt64(&p.size, -1)
 	}
 
+	p.audit.checkout(unsafe.Pointer(node), PoolNodeLeaf)
 	return node
 }
 
 // initializePool
 //
-//	When Mari is opened, initialize the pool with the max size of nodes.
+//	When Mari is opened, initialize the pool with the initial size of nodes, up to the max size.
 func (p *Pool) initializePools() {
-	for range make([]int, p.maxSize/2) {
+	initialSize := min(p.initialSize, p.maxSize)
+	for range make([]int, initialSize/2) {
 		p.iPool.Put(p.resetINode(&INode{}))
 		atomic.AddInt64(&p.size, 1)
 	}
 
-	for range make([]int, p.maxSize/2) {
+	for range make([]int, initialSize/2) {
 		p.lPool.Put(p.resetLNode(&LNode{}))
 		atomic.AddInt64(&p.size, 1)
 	}
@@ -73,22 +109,168 @@ func (p *Pool) initializePools() {
 // putINode
 //
 //	Attempt to put an internal node back into the pool once a path has been copied + serialized.
-//	If the pool is at max capacity, drop the node and let the garbage collector take care of it.
+//	If the pool is at max capacity, disabled, or shedding under memory pressure, drop the node and let the garbage collector take care of it.
 func (p *Pool) putINode(node *INode) {
-	if atomic.LoadInt64(&p.size) < p.maxSize {
-		p.iPool.Put(p.resetINode(node))
-		atomic.AddInt64(&p.size, 1)
+	p.audit.checkin(unsafe.Pointer(node), PoolNodeInternal)
+	if p.disabled || atomic.LoadInt64(&p.size) >= p.maxSize || atomic.LoadUint32(&p.shedding) == 1 {
+		atomic.AddUint64(&p.drops, 1)
+		return
 	}
+
+	p.iPool.Put(p.resetINode(node))
+	atomic.AddInt64(&p.size, 1)
+	atomic.AddUint64(&p.puts, 1)
 }
 
 // putLNode
 //
 //	Attempt to put a leaf node back into the pool once a path has been copied + serialized.
-//	If the pool is at max capacity, drop the node and let the garbage collector take care of it.
+//	If the pool is at max capacity, disabled, or shedding under memory pressure, drop the node and let the garbage collector take care of it.
 func (p *Pool) putLNode(node *LNode) {
-	if atomic.LoadInt64(&p.size) < p.maxSize {
-		p.lPool.Put(p.resetLNode(node))
-		atomic.AddInt64(&p.size, 1)
+	p.audit.checkin(unsafe.Pointer(node), PoolNodeLeaf)
+	if p.disabled || atomic.LoadInt64(&p.size) >= p.maxSize || atomic.LoadUint32(&p.shedding) == 1 {
+		atomic.AddUint64(&p.drops, 1)
+		return
+	}
+
+	p.lPool.Put(p.resetLNode(node))
+	atomic.AddInt64(&p.size, 1)
+	atomic.AddUint64(&p.puts, 1)
+}
+
+// newPoolAudit
+//
+//	Create the tracker of nodes taken from and put back into the node pool, logging double returns to the logger.
+func newPoolAudit(logger *slog.Logger) *poolAudit {
+	return &poolAudit{logger: logger, checkedOut: make(map[unsafe.Pointer]*poolEvent), returned: make(map[unsafe.Pointer]*poolEvent)}
+}
+
+// checkout
+//
+//	Track a node taken from the pool with the stack of the caller, which is a no-op without PoolDebug.
+//	The node is no longer tracked as put back, since it is owned by the caller again.
+func (audit *poolAudit) checkout(node unsafe.Pointer, kind string) {
+	if audit == nil {
+		return
+	}
+
+	event := newPoolEvent(kind)
+
+	audit.lock.Lock()
+	defer audit.lock.Unlock()
+
+	delete(audit.returned, node)
+	audit.checkedOut[node] = event
+}
+
+// checkin
+//
+//	Track a node put back into the pool with the stack of the caller, which is a no-op without PoolDebug.
+//	A node put back while already put back is recorded and logged as a double return, since the pool can hand it out to two owners at once.
+//	Nodes that were never taken from the pool, like nodes read from the memory map, are only counted.
+func (audit *poolAudit) checkin(node unsafe.Pointer, kind string) {
+	if audit == nil {
+		return
+	}
+
+	event := newPoolEvent(kind)
+
+	audit.lock.Lock()
+	defer audit.lock.Unlock()
+
+	if _, ok := audit.checkedOut[node]; ok {
+		delete(audit.checkedOut, node)
+		if len(audit.returned) < PoolAuditMaxReturned {
+			audit.returned[node] = event
+		}
+
+		return
+	}
+
+	prev, ok := audit.returned[node]
+	if !ok {
+		audit.untracked++
+		return
+	}
+
+	doubleReturn := &PoolCheckout{Kind: kind, Age: event.at.Sub(prev.at), Stack: formatStack(event.stack), PrevStack: formatStack(prev.stack)}
+	audit.doubleReturns = append(audit.doubleReturns, doubleReturn)
+	audit.logger.Warn("node put back into the pool twice", "kind", kind, "stack", doubleReturn.Stack, "prevStack", doubleReturn.PrevStack)
+}
+
+// report
+//
+//	Report the nodes taken from the pool at least the min age ago that were not put back, oldest first, and every double return detected.
+func (audit *poolAudit) report(minAge time.Duration) *PoolAudit {
+	if audit == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	audit.lock.Lock()
+	defer audit.lock.Unlock()
+
+	var outstanding []*poolEvent
+	for _, event := range audit.checkedOut {
+		if now.Sub(event.at) >= minAge {
+			outstanding = append(outstanding, event)
+		}
+	}
+
+	slices.SortFunc(outstanding, func(first, second *poolEvent) int { return first.at.Compare(second.at) })
+
+	report := &PoolAudit{DoubleReturns: slices.Clone(audit.doubleReturns), Untracked: audit.untracked}
+	for _, event := range outstanding {
+		report.Outstanding = append(report.Outstanding, &PoolCheckout{Kind: event.kind, Age: now.Sub(event.at), Stack: formatStack(event.stack)})
+	}
+
+	return report
+}
+
+// newPoolEvent
+//
+//	Capture the stack of the caller taking or putting back a node, skipping the frames of the pool itself.
+func newPoolEvent(kind string) *poolEvent {
+	stack := make([]uintptr, PoolAuditStackDepth)
+	return &poolEvent{kind: kind, at: time.Now(), stack: stack[:runtime.Callers(4, stack)]}
+}
+
+// formatStack
+//
+//	Symbolize the program counters of a tracked stack, with the function and location of each frame on its own line.
+//	Used for the stacks of nodes tracked with PoolDebug and of read only transactions open past the warning threshold.
+func formatStack(stack []uintptr) string {
+	var builder strings.Builder
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		builder.WriteString(frame.Function)
+		builder.WriteString("\n\t")
+		builder.WriteString(frame.File)
+		builder.WriteString(":")
+		builder.WriteString(strconv.Itoa(frame.Line))
+		builder.WriteString("\n")
+
+		if !more {
+			return builder.String()
+		}
+	}
+}
+
+// stats
+//
+//	Snapshot the occupancy and counters of the pool.
+func (p *Pool) stats() *PoolStats {
+	return &PoolStats{
+		Disabled:    p.disabled,
+		InitialSize: p.initialSize,
+		MaxRetained: p.maxSize,
+		Retained:    atomic.LoadInt64(&p.size),
+		Gets:        atomic.LoadUint64(&p.gets),
+		Allocations: atomic.LoadUint64(&p.allocations),
+		Puts:        atomic.LoadUint64(&p.puts),
+		Drops:       atomic.LoadUint64(&p.drops),
 	}
 }
 
@@ -101,10 +283,13 @@ func (p *Pool) resetINode(node *INode) *INode {
 	node.endOffset = 0
 	node.bitmap = [8]uint32{0, 0, 0, 0, 0, 0, 0, 0}
 	node.children = make([]*INode, 0)
+	node.count = 0
+	node.trace = nil
 	node.leaf = &LNode{
 		version:     0,
 		startOffset: 0,
 		endOffset:   0,
+		timestamp:   0,
 		keyLength:   0,
 		key:         nil,
 		value:       nil,
@@ -119,9 +304,12 @@ func (p *Pool) resetLNode(node *LNode) *LNode {
 	node.version = 0
 	node.startOffset = 0
 	node.endOffset = 0
+	node.timestamp = 0
 	node.keyLength = 0
 	node.key = nil
 	node.value = nil
+	node.checksum = 0
+	node.checksummed = false
 
 	return node
 }
@@ -0,0 +1,93 @@
+package mariv2
+
+import (
+	"cmp"
+	"os"
+	"slices"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+//============================================= Mari Prefetch
+
+// Prefetch
+//
+//	Warm the pages of the memory map holding keys, so latency critical reads of them later do not wait on page faults.
+//	Each key is looked up in a read only transaction, which reads the internal nodes on its path, and the pages of its value are advised to the kernel as needed soon, so they are read ahead in the background.
+//	Keys not found are skipped. Prefetching is only a hint, so the pages may be evicted again before they are read, and a failed advise is ignored.
+func (mariInst *Mari) Prefetch(keys [][]byte) error {
+	return mariInst.ReadTx(func(tx *Tx) error {
+		values := make([][]byte, 0, len(keys))
+		for _, key := range keys {
+			kvPair, getErr := tx.get(mariInst.normalizeKey(key))
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil {
+				values = append(values, kvPair.Value)
+			}
+		}
+
+		mariInst.data.Load().(MMap).adviseWillNeed(values)
+		return nil
+	})
+}
+
+// PrefetchRange
+//
+//	Warm the pages of the memory map holding the keys between the start and end key, inclusive, the same as Prefetch.
+//	A nil start or end key leaves the range open on that side. The nodes of the whole range are read, so large ranges should be prefetched in idle moments.
+func (mariInst *Mari) PrefetchRange(startKey, endKey []byte) error {
+	return mariInst.ReadTx(func(tx *Tx) error {
+		kvPairs, rangeErr := tx.rangeKvPairs(mariInst.normalizeKey(startKey), mariInst.normalizeKey(endKey), nil)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		values := make([][]byte, len(kvPairs))
+		for idx, kvPair := range kvPairs {
+			values[idx] = kvPair.Value
+		}
+
+		mariInst.data.Load().(MMap).adviseWillNeed(values)
+		return nil
+	})
+}
+
+// adviseWillNeed
+//
+//	Advise the kernel that the pages holding the values will be read soon.
+//	The values are expanded to page boundaries and merged, so overlapping and adjacent values are advised with a single call. Values not within the memory map are skipped.
+func (mapped MMap) adviseWillNeed(values [][]byte) {
+	if len(mapped) == 0 {
+		return
+	}
+
+	pageSize := os.Getpagesize()
+	base := uintptr(unsafe.Pointer(unsafe.SliceData(mapped)))
+
+	var regions [][2]int
+	for _, value := range values {
+		addr := uintptr(unsafe.Pointer(unsafe.SliceData(value)))
+		if len(value) == 0 || addr < base || addr+uintptr(len(value)) > base+uintptr(len(mapped)) {
+			continue
+		}
+
+		start := int(addr-base) &^ (pageSize - 1)
+		end := min((int(addr-base)+len(value)+pageSize-1)&^(pageSize-1), len(mapped))
+		regions = append(regions, [2]int{start, end})
+	}
+
+	slices.SortFunc(regions, func(first, second [2]int) int { return cmp.Compare(first[0], second[0]) })
+
+	for idx := 0; idx < len(regions); {
+		start, end := regions[idx][0], regions[idx][1]
+		for idx++; idx < len(regions) && regions[idx][0] <= end; idx++ {
+			end = max(end, regions[idx][1])
+		}
+
+		unix.Madvise(mapped[start:end], unix.MADV_WILLNEED)
+	}
+}
@@ -0,0 +1,440 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"unsafe"
+)
+
+//============================================= Mari Prefix
+
+// Count
+//
+//	Get the total keys in the trie, including keys under ReservedKeyPrefix.
+//	If the file is written with subtree counts, this is the count of the root. Otherwise, every leaf is counted.
+func (tx *Tx) Count() (_ int, recoveredErr error) {
+	defer tx.store.recoverPanic("Count", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return 0, guardErr
+	}
+
+	return tx.store.subtreeCount(tx.root)
+}
+
+// CountPrefix
+//
+//	Get the total keys that begin with a prefix.
+//	The path to the prefix is traversed, counting the leaves stored above it that begin with the prefix, and the count of the subtree at the end of the path is added.
+//	If the file is written with subtree counts, this is O(depth).
+//	A nil or empty prefix counts every key, including keys under ReservedKeyPrefix.
+func (tx *Tx) CountPrefix(prefix []byte) (_ int, recoveredErr error) {
+	defer tx.store.recoverPanic("CountPrefix", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return 0, guardErr
+	}
+
+	return tx.store.countPrefixRecursive(tx.root, tx.store.normalizeKey(prefix), 0)
+}
+
+// TopPrefixes
+//
+//	Get the k prefixes of length depth with the most keys, in descending order by count, so operators can see which keyspaces dominate storage.
+//	Keys shorter than depth are not counted, and keys under ReservedKeyPrefix are counted like any other key.
+//	Ties are ordered by prefix.
+func (tx *Tx) TopPrefixes(depth, k int) (_ []*PrefixCount, recoveredErr error) {
+	defer tx.store.recoverPanic("TopPrefixes", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	counts := make(map[string]int)
+	topErr := tx.store.topPrefixesRecursive(tx.root, nil, depth, counts)
+	if topErr != nil {
+		return nil, topErr
+	}
+
+	prefixCounts := make([]*PrefixCount, 0, len(counts))
+	for prefix, count := range counts {
+		prefixCounts = append(prefixCounts, &PrefixCount{Prefix: []byte(prefix), Count: count})
+	}
+
+	sort.Slice(prefixCounts, func(i, j int) bool {
+		if prefixCounts[i].Count != prefixCounts[j].Count {
+			return prefixCounts[i].Count > prefixCounts[j].Count
+		}
+		return bytes.Compare(prefixCounts[i].Prefix, prefixCounts[j].Prefix) == -1
+	})
+
+	if k < len(prefixCounts) {
+		prefixCounts = prefixCounts[:max(k, 0)]
+	}
+
+	return prefixCounts, nil
+}
+
+// DeletePrefix
+//
+//	Delete every key that begins with a prefix, returning the total keys deleted, for fast cleanup of per-tenant or per-day keyspaces.
+//	Instead of deleting each key, the subtree at the end of the path to the prefix is detached from its parent, so only the nodes on the path are copied.
+//	Without ttls or tombstones, the keys are counted with the subtree counts and the delete is recorded in the write set once for the prefix, so commit hooks, changefeeds, and the audit log observe a single prefix delete.
+//	With ttls or tombstones, or in a prepared transaction, every key is enumerated and recorded in the write set, so the ttl index and tombstones are handled like tx.Delete and each key can be locked. This is O(n) in the keys deleted.
+//	If any key is held by a prepared transaction, ErrKeyLocked is returned before anything is deleted.
+//	A prefix under ReservedKeyPrefix returns ErrReservedKey, and a prefix of ReservedKeyPrefix only deletes user keys, one key at a time.
+func (tx *Tx) DeletePrefix(prefix []byte) (_ int, recoveredErr error) {
+	defer tx.store.recoverPanic("DeletePrefix", &recoveredErr)
+
+	if !tx.isWrite {
+		return 0, errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
+	}
+
+	prefix = tx.store.normalizeKey(prefix)
+	if len(prefix) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	if isReservedKey(prefix) {
+		return 0, ErrReservedKey
+	}
+
+	if atomic.LoadUint32(&tx.store.hasTTL) == 0 && !tx.store.tombstones && tx.preparedID == "" && !bytes.HasPrefix(ReservedKeyPrefix, prefix) {
+		return tx.deletePrefix(prefix)
+	}
+
+	kvPairs, rangeErr := tx.store.prefixKvPairs(tx.root, tx.snapshotVersion, prefix, 0)
+	if rangeErr != nil {
+		return 0, rangeErr
+	}
+
+	var scanEnd []byte
+	if prefix[len(prefix)-1] < 0xff {
+		scanEnd = bucketEndKey(prefix)
+	}
+
+	tx.recordScan(prefix, scanEnd, 0)
+
+	kvPairs = excludeReserved(kvPairs)
+	for _, kvPair := range kvPairs {
+		if tx.store.isKeyLocked(kvPair.Key) {
+			return 0, ErrKeyLocked
+		}
+	}
+
+	if len(kvPairs) == 0 {
+		return 0, nil
+	}
+
+	if bytes.HasPrefix(ReservedKeyPrefix, prefix) {
+		for _, kvPair := range kvPairs {
+			delErr := tx.delete(bytes.Clone(kvPair.Key))
+			if delErr != nil {
+				return 0, delErr
+			}
+		}
+
+		return len(kvPairs), nil
+	}
+
+	for _, kvPair := range kvPairs {
+		key := bytes.Clone(kvPair.Key)
+		clearErr := tx.clearTTL(key)
+		if clearErr != nil {
+			return 0, clearErr
+		}
+
+		tombstoneErr := tx.putTombstone(key)
+		if tombstoneErr != nil {
+			return 0, tombstoneErr
+		}
+
+		tx.writeSet = append(tx.writeSet, &txWrite{key: key, isDelete: true})
+	}
+
+	_, delErr := tx.store.deletePrefixRecursive(tx.root, prefix, 0)
+	if delErr != nil {
+		return 0, delErr
+	}
+
+	return len(kvPairs), nil
+}
+
+// deletePrefix
+//
+//	Delete every key that begins with a prefix of user keys, recording the delete once in the write set for the prefix instead of once per key.
+//	The keys are counted on the path to the prefix, so with subtree counts the delete is O(depth) regardless of the keys deleted.
+func (tx *Tx) deletePrefix(prefix []byte) (int, error) {
+	count, countErr := tx.store.countPrefixRecursive(tx.root, prefix, 0)
+	if countErr != nil || count == 0 {
+		return 0, countErr
+	}
+
+	if tx.store.isPrefixLocked(prefix) {
+		return 0, ErrKeyLocked
+	}
+
+	_, delErr := tx.store.deletePrefixRecursive(tx.root, prefix, 0)
+	if delErr != nil {
+		return 0, delErr
+	}
+
+	tx.writeSet = append(tx.writeSet, &txWrite{key: bytes.Clone(prefix), isDelete: true, isPrefix: true})
+	return count, nil
+}
+
+// samePrefixRecursive
+//
+//	Traverse the path to a prefix in two roots, determining if the keys that begin with the prefix are the same in both.
+//	Nodes are copied on write, so a node at the same offset in both roots is the same subtree, and the path is only followed while the nodes differ.
+func (mariInst *Mari) samePrefixRecursive(firstPtr, secondPtr *unsafe.Pointer, prefix []byte, level int) (bool, error) {
+	first, second := loadINodeFromPointer(firstPtr), loadINodeFromPointer(secondPtr)
+	if first.startOffset == second.startOffset {
+		return true, nil
+	}
+
+	if len(prefix) == level {
+		return false, nil
+	}
+
+	if !sameKvPair(prefixLeaf(first, prefix), prefixLeaf(second, prefix)) {
+		return false, nil
+	}
+
+	index := getIndexForLevel(prefix, level)
+	firstSet, secondSet := isBitSet(first.bitmap, index), isBitSet(second.bitmap, index)
+	if !firstSet || !secondSet {
+		return firstSet == secondSet, nil
+	}
+
+	firstChild, getChildErr := mariInst.getChildNode(first, getPosition(first.bitmap, index, level))
+	if getChildErr != nil {
+		return false, getChildErr
+	}
+
+	secondChild, getChildErr := mariInst.getChildNode(second, getPosition(second.bitmap, index, level))
+	if getChildErr != nil {
+		return false, getChildErr
+	}
+
+	return mariInst.samePrefixRecursive(storeINodeAsPointer(firstChild), storeINodeAsPointer(secondChild), prefix, level+1)
+}
+
+// prefixLeaf
+//
+//	Get the leaf of a node as a key-value pair for comparison, if its key begins with the prefix.
+func prefixLeaf(node *INode, prefix []byte) *KeyValuePair {
+	if len(node.leaf.key) == 0 || !bytes.HasPrefix(node.leaf.key, prefix) {
+		return nil
+	}
+
+	return &KeyValuePair{Key: node.leaf.key, Version: node.leaf.version}
+}
+
+// countPrefixRecursive
+//
+//	Traverse the path to the prefix, counting the leaves that begin with the prefix.
+//	Every key in the subtree at the end of the path begins with the prefix, so its count is returned.
+func (mariInst *Mari) countPrefixRecursive(node *unsafe.Pointer, prefix []byte, level int) (int, error) {
+	currNode := loadINodeFromPointer(node)
+	if len(prefix) == level {
+		return mariInst.subtreeCount(node)
+	}
+
+	var count int
+	if len(currNode.leaf.key) > 0 && bytes.HasPrefix(currNode.leaf.key, prefix) {
+		count++
+	}
+
+	index := getIndexForLevel(prefix, level)
+	if !isBitSet(currNode.bitmap, index) {
+		return count, nil
+	}
+
+	pos := getPosition(currNode.bitmap, index, level)
+	childNode, countErr := mariInst.getChildNode(currNode, pos)
+	if countErr != nil {
+		return 0, countErr
+	}
+
+	childCount, countErr := mariInst.countPrefixRecursive(storeINodeAsPointer(childNode), prefix, level+1)
+	if countErr != nil {
+		return 0, countErr
+	}
+
+	return count + childCount, nil
+}
+
+// prefixKvPairs
+//
+//	Traverse the path to the prefix, collecting the leaves that begin with the prefix, followed by every key-value pair in the subtree at the end of the path.
+func (mariInst *Mari) prefixKvPairs(node *unsafe.Pointer, maxVersion uint64, prefix []byte, level int) ([]*KeyValuePair, error) {
+	currNode := loadINodeFromPointer(node)
+	if len(prefix) == level {
+		return mariInst.rangeRecursive(node, 0, maxVersion, nil, nil, level)
+	}
+
+	var kvPairs []*KeyValuePair
+	if len(currNode.leaf.key) > 0 && bytes.HasPrefix(currNode.leaf.key, prefix) {
+		kvPairs = append(kvPairs, &KeyValuePair{Key: currNode.leaf.key})
+	}
+
+	index := getIndexForLevel(prefix, level)
+	if !isBitSet(currNode.bitmap, index) {
+		return kvPairs, nil
+	}
+
+	pos := getPosition(currNode.bitmap, index, level)
+	childNode, getChildErr := mariInst.getChildNode(currNode, pos)
+	if getChildErr != nil {
+		return nil, getChildErr
+	}
+
+	childKvPairs, rangeErr := mariInst.prefixKvPairs(storeINodeAsPointer(childNode), maxVersion, prefix, level+1)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	return append(kvPairs, childKvPairs...), nil
+}
+
+// deletePrefixRecursive
+//
+//	Path copy the path to the prefix, clearing the leaves that begin with the prefix, and remove the subtree at the end of the path from the table of its parent.
+//	The subtree is not traversed, since every key below it begins with the prefix, so its count is subtracted from the counts on the path.
+//	Like a delete, a child left without a leaf or children is removed from the table of its parent.
+func (mariInst *Mari) deletePrefixRecursive(node *unsafe.Pointer, prefix []byte, level int) (bool, error) {
+	currNode := loadINodeFromPointer(node)
+	nodeCopy := mariInst.copyINode(currNode)
+	count := int64(currNode.count)
+
+	if len(nodeCopy.leaf.key) > 0 && bytes.HasPrefix(nodeCopy.leaf.key, prefix) {
+		nodeCopy.leaf = mariInst.newLeafNode(nil, nil, nodeCopy.version, 0)
+		count--
+	}
+
+	index := getIndexForLevel(prefix, level)
+	if isBitSet(nodeCopy.bitmap, index) {
+		pos := getPosition(nodeCopy.bitmap, index, level)
+		childNode, getChildErr := mariInst.getChildNode(nodeCopy, pos)
+		if getChildErr != nil {
+			return false, getChildErr
+		}
+
+		switch {
+		case len(prefix) == level+1:
+			count -= int64(childNode.count)
+			nodeCopy.bitmap = setBit(nodeCopy.bitmap, index)
+			nodeCopy.children = shrinkTable(nodeCopy.children, nodeCopy.bitmap, pos)
+		default:
+			childNode.version = nodeCopy.version
+			childPtr := storeINodeAsPointer(childNode)
+
+			_, delErr := mariInst.deletePrefixRecursive(childPtr, prefix, level+1)
+			if delErr != nil {
+				return false, delErr
+			}
+
+			updatedChildNode := loadINodeFromPointer(childPtr)
+			nodeCopy.children[pos] = updatedChildNode
+			count += int64(updatedChildNode.count) - int64(childNode.count)
+
+			if len(updatedChildNode.leaf.key) == 0 && populationCount(updatedChildNode.bitmap) == 0 {
+				nodeCopy.bitmap = setBit(nodeCopy.bitmap, index)
+				nodeCopy.children = shrinkTable(nodeCopy.children, nodeCopy.bitmap, pos)
+			}
+		}
+	}
+
+	nodeCopy.count = uint64(count)
+	return mariInst.compareAndSwap(node, currNode, nodeCopy), nil
+}
+
+// topPrefixesRecursive
+//
+//	Traverse every path up to depth, adding the count of each subtree at depth to the count for its path.
+//	Leaves stored above depth are added to the count for their own prefix.
+func (mariInst *Mari) topPrefixesRecursive(node *unsafe.Pointer, path []byte, depth int, counts map[string]int) error {
+	currNode := loadINodeFromPointer(node)
+	if len(path) == depth {
+		count, countErr := mariInst.subtreeCount(node)
+		if countErr != nil {
+			return countErr
+		}
+
+		if count > 0 {
+			counts[string(path)] += count
+		}
+		return nil
+	}
+
+	if len(currNode.leaf.key) >= depth && len(currNode.leaf.key) > 0 {
+		counts[string(currNode.leaf.key[:depth])]++
+	}
+
+	pos := 0
+	for index := range 256 {
+		if !isBitSet(currNode.bitmap, byte(index)) {
+			continue
+		}
+
+		childNode, topErr := mariInst.getChildNode(currNode, pos)
+		if topErr != nil {
+			return topErr
+		}
+
+		childPath := append(bytes.Clone(path), byte(index))
+		topErr = mariInst.topPrefixesRecursive(storeINodeAsPointer(childNode), childPath, depth, counts)
+		if topErr != nil {
+			return topErr
+		}
+
+		pos++
+	}
+
+	return nil
+}
+
+// subtreeCount
+//
+//	Get the total keys in the subtree of a node.
+//	If the file is written with subtree counts, the count of the node is returned, otherwise every leaf in the subtree is counted.
+func (mariInst *Mari) subtreeCount(node *unsafe.Pointer) (int, error) {
+	if mariInst.subtreeCounts {
+		return int(loadINodeFromPointer(node).count), nil
+	}
+	return mariInst.populationRecursive(node)
+}
+
+// populationRecursive
+//
+//	Count every leaf in the subtree of a node.
+func (mariInst *Mari) populationRecursive(node *unsafe.Pointer) (int, error) {
+	currNode := loadINodeFromPointer(node)
+
+	var population int
+	if len(currNode.leaf.key) > 0 {
+		population++
+	}
+
+	for pos := range currNode.children {
+		childNode, popErr := mariInst.getChildNode(currNode, pos)
+		if popErr != nil {
+			return 0, popErr
+		}
+
+		childPopulation, popErr := mariInst.populationRecursive(storeINodeAsPointer(childNode))
+		if popErr != nil {
+			return 0, popErr
+		}
+
+		population += childPopulation
+	}
+
+	return population, nil
+}
@@ -0,0 +1,33 @@
+package mariv2
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+//============================================= Mari Profile
+
+// runLabeled
+//
+//	Run a background worker with pprof labels for the instance and subsystem, so cpu and heap profiles of an embedding service attribute the cost of the worker to mari.
+//	Go routines started by the worker inherit the labels.
+func (mariInst *Mari) runLabeled(subsystem string, worker func()) {
+	labels := pprof.Labels(ProfileLabelInstance, mariInst.instanceLabel, ProfileLabelSubsystem, subsystem)
+	pprof.Do(context.Background(), labels, func(context.Context) { worker() })
+}
+
+// runLabeledTx
+//
+//	Run a transaction with pprof labels for the instance and the transaction type, if transaction labels are enabled.
+//	Labels on the calling go routine are replaced while the transaction runs and restored after, since they can not be read without the context they were set with.
+func (mariInst *Mari) runLabeledTx(op string, txFn func() error) error {
+	if !mariInst.profileTransactions {
+		return txFn()
+	}
+
+	var txErr error
+	labels := pprof.Labels(ProfileLabelInstance, mariInst.instanceLabel, ProfileLabelSubsystem, ProfileSubsystemTransaction, ProfileLabelOp, op)
+	pprof.Do(context.Background(), labels, func(context.Context) { txErr = txFn() })
+
+	return txErr
+}
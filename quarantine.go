@@ -0,0 +1,87 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+//============================================= Mari Quarantine
+
+// Quarantined
+//
+//	Get the subtrees quarantined in degraded mode, sorted by prefix.
+//	Subtrees found by a read that have not been located by Verify have a nil prefix, and are sorted first.
+func (mariInst *Mari) Quarantined() []*QuarantineError {
+	mariInst.quarantine.lock.RLock()
+	defer mariInst.quarantine.lock.RUnlock()
+
+	var quarantined []*QuarantineError
+	for _, region := range mariInst.quarantine.regions {
+		regionCopy := *region
+		quarantined = append(quarantined, &regionCopy)
+	}
+
+	sort.Slice(quarantined, func(i, j int) bool {
+		return bytes.Compare(quarantined[i].Prefix, quarantined[j].Prefix) == -1
+	})
+
+	return quarantined
+}
+
+// loadQuarantined
+//
+//	Get the quarantined subtree at an offset, if there is one.
+func (mariInst *Mari) loadQuarantined(offset uint64) *QuarantineError {
+	mariInst.quarantine.lock.RLock()
+	defer mariInst.quarantine.lock.RUnlock()
+
+	region, ok := mariInst.quarantine.regions[offset]
+	if !ok {
+		return nil
+	}
+
+	regionCopy := *region
+	return &regionCopy
+}
+
+// quarantineOnCorrupt
+//
+//	In degraded mode, quarantine the subtree at an offset when reading it found corruption, and return the QuarantineError in place of the read error.
+//	If the subtree is already quarantined and its prefix was not known, the prefix is set.
+//	Otherwise, the error is returned unchanged.
+func (mariInst *Mari) quarantineOnCorrupt(offset uint64, prefix []byte, err error) error {
+	if !mariInst.degraded || !errors.Is(err, ErrCorrupt) {
+		return err
+	}
+
+	mariInst.quarantine.lock.Lock()
+	defer mariInst.quarantine.lock.Unlock()
+
+	region, ok := mariInst.quarantine.regions[offset]
+	if !ok {
+		region = &QuarantineError{Offset: offset, Err: err}
+		mariInst.quarantine.regions[offset] = region
+		mariInst.logger.Warn("quarantined corrupt subtree", "offset", offset, "error", err)
+	}
+
+	if region.Prefix == nil && prefix != nil {
+		region.Prefix = append([]byte{}, prefix...)
+	}
+
+	regionCopy := *region
+	return &regionCopy
+}
+
+// locateQuarantined
+//
+//	Set the prefix of a subtree that was quarantined by a read, once it has been located in the trie.
+//	If the error is not a QuarantineError, it is returned unchanged.
+func (mariInst *Mari) locateQuarantined(prefix []byte, err error) error {
+	var quarantineErr *QuarantineError
+	if !errors.As(err, &quarantineErr) {
+		return err
+	}
+
+	return mariInst.quarantineOnCorrupt(quarantineErr.Offset, prefix, quarantineErr.Err)
+}
@@ -0,0 +1,174 @@
+package mariv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+//============================================= Mari Quorum Reads
+
+// QuorumRead
+//
+//	Read a key from every replica concurrently, returning the freshest read once a quorum of the replicas has replied, for reads that need stronger guarantees than a single asynchronous replica provides.
+//	Reads are ordered by the timestamp of the last leader version each replica applied, since versions are local to each replica while timestamps are hybrid logical clocks shared with the leader.
+//	Replicas that fail to reply are skipped, and if a quorum can no longer be reached, or is not reached before the timeout, a QuorumError with the error of each replica is returned.
+func QuorumRead(ctx context.Context, replicas []ReplicaReader, key []byte, opts QuorumReadOpts) (*ReplicaRead, error) {
+	quorum := opts.Quorum
+	if quorum <= 0 {
+		quorum = len(replicas)/2 + 1
+	}
+
+	if quorum > len(replicas) {
+		return nil, fmt.Errorf("quorum of %d is more than the %d replicas", quorum, len(replicas))
+	}
+
+	timeout := DefaultQuorumReadTimeout
+	if opts.Timeout != nil {
+		timeout = *opts.Timeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type replicaReply struct {
+		read *ReplicaRead
+		err  error
+	}
+
+	replies := make(chan replicaReply, len(replicas))
+	for _, replica := range replicas {
+		go func() {
+			read, readErr := replica.ReadReplica(ctx, key)
+			replies <- replicaReply{read: read, err: readErr}
+		}()
+	}
+
+	var freshest *ReplicaRead
+	var errs []error
+	for replied := 0; replied < quorum; {
+		select {
+		case <-ctx.Done():
+			return nil, &QuorumError{Quorum: quorum, Replied: replied, Errs: append(errs, ctx.Err())}
+		case reply := <-replies:
+			if reply.err != nil {
+				errs = append(errs, reply.err)
+				if len(replicas)-len(errs) < quorum {
+					return nil, &QuorumError{Quorum: quorum, Replied: replied, Errs: errs}
+				}
+
+				continue
+			}
+
+			replied++
+			if freshest == nil || reply.read.Timestamp > freshest.Timestamp {
+				freshest = reply.read
+			}
+		}
+	}
+
+	return freshest, nil
+}
+
+// ReadReplica
+//
+//	Read a key with the leader version and timestamp the instance has applied as of the read, so the instance can be read by QuorumRead in the same process.
+//	A replica reports the last delta or snapshot applied, a replica that has not finished its first snapshot reports 0, and an instance that has applied nothing is the leader, so it reports its latest version.
+//	With value checksums, a value that does not match its checksum is returned as an error instead.
+func (mariInst *Mari) ReadReplica(ctx context.Context, key []byte) (*ReplicaRead, error) {
+	read := &ReplicaRead{}
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		applied, loadErr := tx.loadReplicated()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		snapshot, _, loadErr := tx.loadSnapshotProgress()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		switch {
+		case applied.timestamp != 0:
+			read.Version, read.Timestamp = applied.version, applied.timestamp
+		case snapshot.timestamp == 0:
+			root := loadINodeFromPointer(tx.root)
+			read.Version, read.Timestamp = root.version, root.leaf.timestamp
+		}
+
+		kvPair, fetchErr := tx.fetch(key)
+		if fetchErr != nil || kvPair == nil {
+			return fetchErr
+		}
+
+		read.KvPair = &KeyValuePair{Key: kvPair.Key, Value: kvPair.Value}
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return read, nil
+}
+
+// NewTCPReplicaReader
+//
+//	Create a replica reader that reads keys from a replica serving replication with ServeReplication at the address.
+//	The connection is dialed on the first read and again after a failure, and reads are sent one at a time.
+func NewTCPReplicaReader(addr string) *TCPReplicaReader {
+	return &TCPReplicaReader{sink: NewTCPSink(addr)}
+}
+
+// ReadReplica
+//
+//	Read a key from the replica, with the leader version and timestamp the replica has applied.
+func (reader *TCPReplicaReader) ReadReplica(ctx context.Context, key []byte) (*ReplicaRead, error) {
+	reader.lock.Lock()
+	defer reader.lock.Unlock()
+
+	reply, readErr := reader.sink.roundTrip(ctx, replicationFrameRead, key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return deserializeReplicaRead(reply)
+}
+
+// Close
+//
+//	Close the connection to the replica.
+func (reader *TCPReplicaReader) Close() error {
+	reader.lock.Lock()
+	defer reader.lock.Unlock()
+
+	return reader.sink.Close()
+}
+
+// serializeReplicaRead
+//
+//	Serialize a replica read as the version and timestamp (8 bytes each), followed by the key-value pair serialized as a write set, or nothing if the key does not exist.
+func serializeReplicaRead(read *ReplicaRead) []byte {
+	sRead := serializeUint64(read.Version)
+	sRead = append(sRead, serializeUint64(read.Timestamp)...)
+	return append(sRead, serializeFetched(read.KvPair)...)
+}
+
+// deserializeReplicaRead
+//
+//	Deserialize the byte representation of a replica read.
+func deserializeReplicaRead(sRead []byte) (*ReplicaRead, error) {
+	if len(sRead) < 2*OffsetSize64 {
+		return nil, errors.New("invalid data length for serialized replica read")
+	}
+
+	kvPair, desErr := deserializeFetched(sRead[2*OffsetSize64:])
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	read := &ReplicaRead{KvPair: kvPair}
+	read.Version, _ = deserializeUint64(sRead[:OffsetSize64])
+	read.Timestamp, _ = deserializeUint64(sRead[OffsetSize64 : 2*OffsetSize64])
+	return read, nil
+}
@@ -0,0 +1,365 @@
+package mariv2
+
+import (
+	"bytes"
+	"slices"
+	"sync/atomic"
+	"unsafe"
+)
+
+//============================================= Mari Quotas
+
+// QuotaUsage
+//
+//	Get the keys and bytes under the prefix of every quota at the latest version, with the commits rejected for exceeding it, in the order the quotas were passed.
+//	The bytes are counted by traversing every key under the prefix, so this is meant for reporting, not for every request.
+func (mariInst *Mari) QuotaUsage() ([]*QuotaUsage, error) {
+	usages := make([]*QuotaUsage, 0, len(mariInst.quotas))
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		for _, state := range mariInst.quotas {
+			keys, usageErr := mariInst.quotaKeys(tx.root, state.quota.Prefix)
+			if usageErr != nil {
+				return usageErr
+			}
+
+			prefixBytes, usageErr := mariInst.prefixBytesRecursive(tx.root, state.quota.Prefix, 0)
+			if usageErr != nil {
+				return usageErr
+			}
+
+			usages = append(usages, &QuotaUsage{
+				Prefix:   bytes.Clone(state.quota.Prefix),
+				Keys:     keys,
+				Bytes:    prefixBytes,
+				MaxKeys:  state.quota.MaxKeys,
+				MaxBytes: state.quota.MaxBytes,
+				Rejected: atomic.LoadUint64(&state.rejected),
+			})
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return usages, nil
+}
+
+// newQuotas
+//
+//	Copy the quotas passed in the instance options, normalizing their prefixes with the key normalizer of the instance, so a prefix matches the normalized keys it is compared against.
+//	Quotas that limit neither keys nor bytes are dropped. The bytes under each prefix are counted on the first commit.
+func (mariInst *Mari) newQuotas(quotas []*Quota) []*quotaState {
+	var states []*quotaState
+	for _, quota := range quotas {
+		if quota == nil || (quota.MaxKeys <= 0 && quota.MaxBytes <= 0) {
+			continue
+		}
+
+		normalized := &Quota{Prefix: mariInst.normalizeKey(bytes.Clone(quota.Prefix)), MaxKeys: max(quota.MaxKeys, 0), MaxBytes: max(quota.MaxBytes, 0)}
+		states = append(states, &quotaState{quota: normalized})
+	}
+
+	return states
+}
+
+// checkQuotas
+//
+//	Determine the bytes under the prefix of every quota with the modified path of a transaction, from the bytes counted at the root it was copied from and the keys it writes, and reject the commit with a QuotaError if it puts a prefix over its quota.
+//	Only commits that grow a prefix are rejected, so writes that free space are accepted even if the prefix is over a quota lowered since it was filled. Followers apply the commits of the leader without checking them.
+//	Returns the bytes to record for each quota once the commit succeeds, where -1 leaves the bytes to be counted again on the next commit.
+func (mariInst *Mari) checkQuotas(tx *Tx) ([]int64, error) {
+	if len(mariInst.quotas) == 0 {
+		return nil, nil
+	}
+
+	baseRoot, checkErr := mariInst.readINodeFromMemMap(tx.baseOffset)
+	if checkErr != nil {
+		return nil, checkErr
+	}
+
+	basePtr := storeINodeAsPointer(baseRoot)
+	enforce := atomic.LoadUint32(&mariInst.isFollower) == 0
+
+	quotaBytes := make([]int64, len(mariInst.quotas))
+	for idx, state := range mariInst.quotas {
+		baseBytes, counted := state.countedAt(tx.baseOffset, baseRoot.version)
+		if !quotaWritten(state.quota.Prefix, tx.writeSet) {
+			quotaBytes[idx] = -1
+			if counted {
+				quotaBytes[idx] = baseBytes
+			}
+
+			continue
+		}
+
+		if !counted {
+			baseBytes, checkErr = mariInst.prefixBytesRecursive(basePtr, state.quota.Prefix, 0)
+			if checkErr != nil {
+				return nil, checkErr
+			}
+		}
+
+		delta, checkErr := mariInst.quotaDelta(basePtr, tx.root, state.quota.Prefix, tx.writeSet)
+		if checkErr != nil {
+			return nil, checkErr
+		}
+
+		quotaBytes[idx] = baseBytes + delta
+		if !enforce {
+			continue
+		}
+
+		overBytes := state.quota.MaxBytes > 0 && delta > 0 && quotaBytes[idx] > state.quota.MaxBytes
+		keys, overKeys, checkErr := mariInst.overQuotaKeys(basePtr, tx.root, state.quota)
+		if checkErr != nil {
+			return nil, checkErr
+		}
+
+		if overBytes || overKeys {
+			atomic.AddUint64(&state.rejected, 1)
+			return nil, &QuotaError{Prefix: bytes.Clone(state.quota.Prefix), Keys: keys, Bytes: quotaBytes[idx], MaxKeys: state.quota.MaxKeys, MaxBytes: state.quota.MaxBytes}
+		}
+	}
+
+	return quotaBytes, nil
+}
+
+// recordQuotas
+//
+//	Record the bytes under the prefix of every quota at the root of a successful commit, so the next commit only counts the bytes of the keys it writes.
+//	Called before the root is made visible, so a later commit, which is copied from this root, records its bytes after these.
+func (mariInst *Mari) recordQuotas(quotaBytes []int64, rootOffset, rootVersion uint64) {
+	for idx, state := range mariInst.quotas {
+		if quotaBytes == nil || quotaBytes[idx] < 0 {
+			continue
+		}
+
+		state.lock.Lock()
+		state.counted, state.rootOffset, state.rootVersion, state.bytes = true, rootOffset, rootVersion, quotaBytes[idx]
+		state.lock.Unlock()
+	}
+}
+
+// countedAt
+//
+//	Get the bytes under the prefix of the quota if they were counted at the root, which is false if they were never counted or the root was replaced by a commit that did not record them, like a compaction.
+func (state *quotaState) countedAt(rootOffset, rootVersion uint64) (int64, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if !state.counted || state.rootOffset != rootOffset || state.rootVersion != rootVersion {
+		return 0, false
+	}
+
+	return state.bytes, true
+}
+
+// quotaWritten
+//
+//	Determine if a write set writes a key under a quota prefix, or deletes a prefix that overlaps it. Keys under ReservedKeyPrefix are not limited by quotas.
+func quotaWritten(prefix []byte, writeSet []*txWrite) bool {
+	for _, write := range writeSet {
+		if isReservedKey(write.key) {
+			continue
+		}
+
+		if bytes.HasPrefix(write.key, prefix) || (write.isPrefix && bytes.HasPrefix(prefix, write.key)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quotaDelta
+//
+//	Get the change in bytes under a quota prefix between the root a transaction was copied from and its modified path.
+//	Each key written is compared once between the two roots. A prefix delete that overlaps the quota prefix compares every key under the longer of the two prefixes instead, which covers the keys written under it.
+func (mariInst *Mari) quotaDelta(basePtr, rootPtr *unsafe.Pointer, prefix []byte, writeSet []*txWrite) (int64, error) {
+	var scopes [][]byte
+	for _, write := range writeSet {
+		if !write.isPrefix || isReservedKey(write.key) {
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(write.key, prefix):
+			scopes = append(scopes, write.key)
+		case bytes.HasPrefix(prefix, write.key):
+			scopes = append(scopes, prefix)
+		}
+	}
+
+	covered := func(key []byte) bool {
+		for _, scope := range scopes {
+			if bytes.HasPrefix(key, scope) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var delta int64
+	for idx, scope := range scopes {
+		if slices.ContainsFunc(scopes[:idx], func(prev []byte) bool { return bytes.HasPrefix(scope, prev) }) ||
+			slices.ContainsFunc(scopes[idx+1:], func(next []byte) bool { return len(next) < len(scope) && bytes.HasPrefix(scope, next) }) {
+			continue
+		}
+
+		rootBytes, deltaErr := mariInst.prefixBytesRecursive(rootPtr, scope, 0)
+		if deltaErr != nil {
+			return 0, deltaErr
+		}
+
+		baseBytes, deltaErr := mariInst.prefixBytesRecursive(basePtr, scope, 0)
+		if deltaErr != nil {
+			return 0, deltaErr
+		}
+
+		delta += rootBytes - baseBytes
+	}
+
+	compared := make(map[string]struct{})
+	for _, write := range writeSet {
+		if write.isPrefix || isReservedKey(write.key) || !bytes.HasPrefix(write.key, prefix) || covered(write.key) {
+			continue
+		}
+
+		if _, ok := compared[string(write.key)]; ok {
+			continue
+		}
+
+		compared[string(write.key)] = struct{}{}
+
+		rootBytes, deltaErr := mariInst.leafBytes(rootPtr, write.key)
+		if deltaErr != nil {
+			return 0, deltaErr
+		}
+
+		baseBytes, deltaErr := mariInst.leafBytes(basePtr, write.key)
+		if deltaErr != nil {
+			return 0, deltaErr
+		}
+
+		delta += rootBytes - baseBytes
+	}
+
+	return delta, nil
+}
+
+// overQuotaKeys
+//
+//	Count the keys under a quota prefix with the modified path of a transaction, and determine if the commit grows the prefix over the max keys of the quota.
+//	The keys at the root the transaction was copied from are only counted when the prefix is over the max keys.
+func (mariInst *Mari) overQuotaKeys(basePtr, rootPtr *unsafe.Pointer, quota *Quota) (int, bool, error) {
+	keys, countErr := mariInst.quotaKeys(rootPtr, quota.Prefix)
+	if countErr != nil {
+		return 0, false, countErr
+	}
+
+	if quota.MaxKeys <= 0 || keys <= quota.MaxKeys {
+		return keys, false, nil
+	}
+
+	baseKeys, countErr := mariInst.quotaKeys(basePtr, quota.Prefix)
+	if countErr != nil {
+		return 0, false, countErr
+	}
+
+	return keys, keys > baseKeys, nil
+}
+
+// quotaKeys
+//
+//	Count the keys under a quota prefix, leaving out keys under ReservedKeyPrefix for a prefix that covers them, like the empty prefix.
+func (mariInst *Mari) quotaKeys(rootPtr *unsafe.Pointer, prefix []byte) (int, error) {
+	keys, countErr := mariInst.countPrefixRecursive(rootPtr, prefix, 0)
+	if countErr != nil || !bytes.HasPrefix(ReservedKeyPrefix, prefix) {
+		return keys, countErr
+	}
+
+	reserved, countErr := mariInst.countPrefixRecursive(rootPtr, ReservedKeyPrefix, 0)
+	if countErr != nil {
+		return 0, countErr
+	}
+
+	return keys - reserved, nil
+}
+
+// leafBytes
+//
+//	Get the bytes of the key and value of a key as stored in the memory map, or 0 if the key does not exist.
+func (mariInst *Mari) leafBytes(rootPtr *unsafe.Pointer, key []byte) (int64, error) {
+	leaf, getErr := mariInst.getLeafRecursive(rootPtr, key, 0)
+	if getErr != nil || leaf == nil {
+		return 0, getErr
+	}
+
+	return int64(len(leaf.key) + len(leaf.value)), nil
+}
+
+// prefixBytesRecursive
+//
+//	Traverse the path to the prefix, summing the bytes of the leaves that begin with the prefix, followed by the bytes of every leaf in the subtree at the end of the path.
+//	Leaves under ReservedKeyPrefix are not summed.
+func (mariInst *Mari) prefixBytesRecursive(node *unsafe.Pointer, prefix []byte, level int) (int64, error) {
+	currNode := loadINodeFromPointer(node)
+	if len(prefix) == level {
+		return mariInst.subtreeBytesRecursive(node)
+	}
+
+	var prefixBytes int64
+	if len(currNode.leaf.key) > 0 && bytes.HasPrefix(currNode.leaf.key, prefix) && !isReservedKey(currNode.leaf.key) {
+		prefixBytes += int64(len(currNode.leaf.key) + len(currNode.leaf.value))
+	}
+
+	index := getIndexForLevel(prefix, level)
+	if !isBitSet(currNode.bitmap, index) {
+		return prefixBytes, nil
+	}
+
+	pos := getPosition(currNode.bitmap, index, level)
+	childNode, bytesErr := mariInst.getChildNode(currNode, pos)
+	if bytesErr != nil {
+		return 0, bytesErr
+	}
+
+	childBytes, bytesErr := mariInst.prefixBytesRecursive(storeINodeAsPointer(childNode), prefix, level+1)
+	if bytesErr != nil {
+		return 0, bytesErr
+	}
+
+	return prefixBytes + childBytes, nil
+}
+
+// subtreeBytesRecursive
+//
+//	Sum the bytes of the key and value of every leaf in the subtree of a node, leaving out leaves under ReservedKeyPrefix.
+func (mariInst *Mari) subtreeBytesRecursive(node *unsafe.Pointer) (int64, error) {
+	currNode := loadINodeFromPointer(node)
+
+	var subtreeBytes int64
+	if len(currNode.leaf.key) > 0 && !isReservedKey(currNode.leaf.key) {
+		subtreeBytes += int64(len(currNode.leaf.key) + len(currNode.leaf.value))
+	}
+
+	for pos := range currNode.children {
+		childNode, bytesErr := mariInst.getChildNode(currNode, pos)
+		if bytesErr != nil {
+			return 0, bytesErr
+		}
+
+		childBytes, bytesErr := mariInst.subtreeBytesRecursive(storeINodeAsPointer(childNode))
+		if bytesErr != nil {
+			return 0, bytesErr
+		}
+
+		subtreeBytes += childBytes
+	}
+
+	return subtreeBytes, nil
+}
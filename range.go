@@ -2,6 +2,7 @@ package mariv2
 
 import (
 	"bytes"
+	"sort"
 	"unsafe"
 )
 
@@ -9,110 +10,222 @@ import (
 
 // rangeRecursive
 //
-//	Limit the indexes to check in the range at level 0, and then recursively traverse the paths between the start and end index.
-//	On the start key path, continue to use the start index to check the level to see which index forward should be recursively checked.
-//	The opposite is done for the end key path.
-func (mariInst *Mari) rangeRecursive(node *unsafe.Pointer, minVersion uint64, startKey, endKey []byte, level int, transform Transform) ([]*KeyValuePair, error) {
-	genKeyValPair := func(node *INode) *KeyValuePair { return &KeyValuePair{Key: node.leaf.key, Value: node.leaf.value} }
+//	Recursively traverse the paths between the start and end key, building the sorted results.
+//	The start and end key are only passed to the children on the start and end key paths, since every key in the children between them is within the range.
+//	If the start key is a prefix of the current path, every key below is greater than it, and if the end key is a prefix of the current path, every key below is greater than it so no children are checked.
+//	The children are sorted by the index of the key at the current level, but a leaf can be stored above keys that are less than it, so the leaf is inserted into the sorted results of the children.
+//	Every key below the node shares the path to it, so the leaf is checked against the bounds and inserted with comparisons that skip the shared bytes.
+//	Since a node is written with the version of every path copy through it, children with a version less than the min version are skipped.
+//	A child or leaf newer than the max version can not be reachable from a root at the max version, so reaching one returns ErrSnapshotViolation instead of returning keys outside of the snapshot.
+func (mariInst *Mari) rangeRecursive(node *unsafe.Pointer, minVersion, maxVersion uint64, startKey, endKey []byte, level int) ([]*KeyValuePair, error) {
 	currNode := loadINodeFromPointer(node)
+	if currNode.version > maxVersion || currNode.leaf.version > maxVersion {
+		return nil, ErrSnapshotViolation
+	}
 
-	var sortedKvPairs []*KeyValuePair
-	var startKeyPos, endKeyPos int
-	if level > 0 {
-		switch {
-		case startKey != nil && len(startKey) > level:
-			if currNode.leaf.version >= minVersion && bytes.Compare(currNode.leaf.key, startKey) == 1 {
-				sortedKvPairs = append(sortedKvPairs, transform(genKeyValPair(currNode)))
-			} else {
-				return sortedKvPairs, nil
-			}
+	startKeyPos, endKeyPos := 0, len(currNode.children)
+	var startOnPath, endOnPath bool
 
-			startKeyIndex := getIndexForLevel(startKey, level)
-			startKeyPos = getPosition(currNode.bitmap, startKeyIndex, level)
-			endKeyPos = len(currNode.children)
-		case endKey != nil && len(endKey) > level:
-			if currNode.leaf.version >= minVersion && bytes.Compare(currNode.leaf.key, endKey) == -1 {
-				sortedKvPairs = append(sortedKvPairs, transform(genKeyValPair(currNode)))
-			} else {
-				return sortedKvPairs, nil
-			}
+	if startKey != nil && len(startKey) > level {
+		startKeyIndex := getIndexForLevel(startKey, level)
+		startKeyPos = getPosition(currNode.bitmap, startKeyIndex, level)
+		startOnPath = isBitSet(currNode.bitmap, startKeyIndex)
+	}
 
-			startKeyPos = 0
+	if endKey != nil {
+		switch {
+		case len(endKey) > level:
 			endKeyIndex := getIndexForLevel(endKey, level)
 			endKeyPos = getPosition(currNode.bitmap, endKeyIndex, level)
-		default:
-			if currNode.leaf.version >= minVersion && len(currNode.leaf.key) > 0 {
-				sortedKvPairs = append(sortedKvPairs, transform(genKeyValPair(currNode)))
+			if isBitSet(currNode.bitmap, endKeyIndex) {
+				endKeyPos++
+				endOnPath = true
 			}
-			startKeyPos = 0
-			endKeyPos = len(currNode.children)
-		}
-	} else {
-		switch {
-		case startKey == nil && endKey == nil:
-			startKeyPos = 0
-			endKeyPos = len(currNode.children)
 		default:
-			startKeyIndex := getIndexForLevel(startKey, 0)
-			startKeyPos = getPosition(currNode.bitmap, startKeyIndex, 0)
-			endKeyIndex := getIndexForLevel(endKey, 0)
-			endKeyPos = getPosition(currNode.bitmap, endKeyIndex, 0)
+			endKeyPos = 0
 		}
 	}
 
-	if len(currNode.children) > 0 {
-		var rangeErr error
-		var childNode *INode
-		var childPtr *unsafe.Pointer
-		var kvPairs []*KeyValuePair
+	var sortedKvPairs []*KeyValuePair
+	for pos := startKeyPos; pos < endKeyPos; pos++ {
+		childNode, rangeErr := mariInst.getChildNode(currNode, pos)
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
 
-		switch {
-		case startKeyPos == endKeyPos:
-			childNode, rangeErr = mariInst.getChildNode(currNode.children[startKeyPos], currNode.version)
-			if rangeErr != nil {
-				return nil, rangeErr
+		if childNode.version < minVersion {
+			continue
+		}
+
+		var childStartKey, childEndKey []byte
+		if pos == startKeyPos && startOnPath {
+			childStartKey = startKey
+		}
+
+		if pos == endKeyPos-1 && endOnPath {
+			childEndKey = endKey
+		}
+
+		childPtr := storeINodeAsPointer(childNode)
+		kvPairs, rangeErr := mariInst.rangeRecursive(childPtr, minVersion, maxVersion, childStartKey, childEndKey, level+1)
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
+
+		sortedKvPairs = append(sortedKvPairs, kvPairs...)
+	}
+
+	leaf := currNode.leaf
+	switch {
+	case len(leaf.key) == 0 || leaf.version < minVersion:
+		return sortedKvPairs, nil
+	case !keyInBounds(leaf.key, startKey, endKey, level):
+		return sortedKvPairs, nil
+	}
+
+	leafPos := searchKeyAfter(sortedKvPairs, leaf.key, level)
+
+	kvPair := &KeyValuePair{Version: leaf.version, Timestamp: leaf.timestamp, Key: leaf.key, Value: leaf.value}
+	sortedKvPairs = append(sortedKvPairs, nil)
+	copy(sortedKvPairs[leafPos+1:], sortedKvPairs[leafPos:])
+	sortedKvPairs[leafPos] = kvPair
+
+	return sortedKvPairs, nil
+}
+
+// rangeHistory
+//
+//	Expand the results of a range with the previous retained versions of each key, up to max versions per key, newest first.
+//	A previous version of a key is read from the latest committed root before the version of the key was written, using the version index.
+//	The walk stops when the key did not exist in the previous root, the version is less than the min version, or the previous root is no longer retained.
+//	With an arena, the previous versions are allocated from it and share the key of the latest version.
+//	The resize read lock must be held by the caller.
+func (mariInst *Mari) rangeHistory(kvPairs []*KeyValuePair, minVersion uint64, maxVersions int, arena *scanArena) ([]*KeyValuePair, error) {
+	entries, historyErr := mariInst.indexVersions()
+	if historyErr != nil {
+		return nil, historyErr
+	}
+
+	var historyKvPairs []*KeyValuePair
+	for _, kvPair := range kvPairs {
+		historyKvPairs = append(historyKvPairs, kvPair)
+
+		prevKvPair := kvPair
+		for total := 1; total < maxVersions && prevKvPair.Version > 0; total++ {
+			idx := sort.Search(len(entries), func(i int) bool { return entries[i].version >= prevKvPair.Version }) - 1
+			if idx < 0 {
+				break
 			}
-			childPtr = storeINodeAsPointer(childNode)
 
-			kvPairs, rangeErr = mariInst.rangeRecursive(childPtr, minVersion, startKey, endKey, level+1, transform)
-			if rangeErr != nil {
-				return nil, rangeErr
+			prevRoot, historyErr := mariInst.readINodeFromMemMap(entries[idx].rootOffset)
+			if historyErr != nil {
+				return nil, historyErr
 			}
-			if len(kvPairs) > 0 {
-				sortedKvPairs = append(sortedKvPairs, kvPairs...)
+
+			prevKvPair, historyErr = mariInst.getRecursive(storeINodeAsPointer(prevRoot), kvPair.Key, 0, identityTransform)
+			if historyErr != nil {
+				return nil, historyErr
 			}
-		default:
-			for idx, childOffset := range currNode.children[startKeyPos:endKeyPos] {
-				childNode, rangeErr = mariInst.getChildNode(childOffset, currNode.version)
-				if rangeErr != nil {
-					return nil, rangeErr
-				}
-
-				childPtr = storeINodeAsPointer(childNode)
-				switch {
-				case idx == 0 && startKey != nil:
-					kvPairs, rangeErr = mariInst.rangeRecursive(childPtr, minVersion, startKey, nil, level+1, transform)
-					if rangeErr != nil {
-						return nil, rangeErr
-					}
-				case idx == endKeyPos && endKey != nil:
-					kvPairs, rangeErr = mariInst.rangeRecursive(childPtr, minVersion, nil, endKey, level+1, transform)
-					if rangeErr != nil {
-						return nil, rangeErr
-					}
-				default:
-					kvPairs, rangeErr = mariInst.rangeRecursive(childPtr, minVersion, nil, nil, level+1, transform)
-					if rangeErr != nil {
-						return nil, rangeErr
-					}
-				}
-
-				if len(kvPairs) > 0 {
-					sortedKvPairs = append(sortedKvPairs, kvPairs...)
-				}
+
+			if prevKvPair == nil || prevKvPair.Version < minVersion {
+				break
 			}
+
+			if arena != nil {
+				prevKvPair = arena.newPair(prevKvPair.Version, prevKvPair.Timestamp, nil, prevKvPair.Value)
+				prevKvPair.Key = kvPair.Key
+			}
+
+			historyKvPairs = append(historyKvPairs, prevKvPair)
 		}
 	}
 
-	return sortedKvPairs, nil
+	return historyKvPairs, nil
+}
+
+// excludeEndKey
+//
+//	Drop the results for the end key, which are last since the results are sorted, so the end key of a range is exclusive.
+//	With max versions, every retained version of the end key is dropped.
+func excludeEndKey(kvPairs []*KeyValuePair, endKey []byte) []*KeyValuePair {
+	if endKey == nil {
+		return kvPairs
+	}
+
+	for len(kvPairs) > 0 && bytes.Equal(kvPairs[len(kvPairs)-1].Key, endKey) {
+		kvPairs = kvPairs[:len(kvPairs)-1]
+	}
+
+	return kvPairs
+}
+
+// newScanArena
+//
+//	Create the arena the results of a scan are allocated from if the options share buffers, otherwise nil, in which case the results point into the memory map.
+func newScanArena(opts *RangeOpts) *scanArena {
+	if opts == nil || opts.SharedBuffers == nil || !*opts.SharedBuffers {
+		return nil
+	}
+
+	return &scanArena{}
+}
+
+// newPair
+//
+//	Create a key-value pair for a result of a scan.
+//	Without an arena, the key and value are not copied. Otherwise the pair is taken from the current block of pairs, and the key and value are copied into the current blocks of keys and values.
+func (arena *scanArena) newPair(version, timestamp uint64, key, value []byte) *KeyValuePair {
+	if arena == nil {
+		return &KeyValuePair{Version: version, Timestamp: timestamp, Key: key, Value: value}
+	}
+
+	if len(arena.pairs) == 0 {
+		arena.pairs = make([]KeyValuePair, ScanArenaPairBlockSize)
+	}
+
+	kvPair := &arena.pairs[0]
+	arena.pairs = arena.pairs[1:]
+	*kvPair = KeyValuePair{Version: version, Timestamp: timestamp, Key: arena.internKey(key), Value: arena.copyValue(value)}
+	return kvPair
+}
+
+// internKey
+//
+//	Copy a key into the current block of keys.
+//	A key that is a prefix of the last key copied shares its bytes, and a key that the last key is a prefix of only appends the rest of the key after it.
+//	Since the keys below a node share the path to it, a key stored at a node shares its bytes with the key below it copied just before or after it.
+func (arena *scanArena) internKey(key []byte) []byte {
+	if key == nil || bytes.HasPrefix(arena.lastKey, key) {
+		return arena.lastKey[:len(key):len(key)]
+	}
+
+	start, suffix := len(arena.keys), key
+	switch {
+	case arena.lastKey != nil && bytes.HasPrefix(key, arena.lastKey) && len(arena.keys)+len(key)-len(arena.lastKey) <= cap(arena.keys):
+		start, suffix = len(arena.keys)-len(arena.lastKey), key[len(arena.lastKey):]
+	case len(arena.keys)+len(key) > cap(arena.keys):
+		arena.keys = make([]byte, 0, max(ScanArenaBlockSize, len(key)))
+		start = 0
+	}
+
+	arena.keys = append(arena.keys, suffix...)
+	arena.lastKey = arena.keys[start:len(arena.keys):len(arena.keys)]
+	return arena.lastKey
+}
+
+// copyValue
+//
+//	Copy a value into the current block of values.
+func (arena *scanArena) copyValue(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+
+	if len(arena.values)+len(value) > cap(arena.values) {
+		arena.values = make([]byte, 0, max(ScanArenaBlockSize, len(value)))
+	}
+
+	start := len(arena.values)
+	arena.values = append(arena.values, value...)
+	return arena.values[start:len(arena.values):len(arena.values)]
 }
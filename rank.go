@@ -0,0 +1,193 @@
+package mariv2
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+//============================================= Mari Rank
+
+// Rank
+//
+//	Get the total keys less than a key, which does not need to exist.
+//	The path to the key is traversed, adding the subtree counts of the children before the path at each level, so with subtree counts this is O(depth).
+//	Keys under ReservedKeyPrefix are ranked like any other key.
+func (tx *Tx) Rank(key []byte) (_ int, recoveredErr error) {
+	defer tx.store.recoverPanic("Rank", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return 0, guardErr
+	}
+
+	return tx.store.rankRecursive(tx.root, tx.store.normalizeKey(key), 0)
+}
+
+// SelectNth
+//
+//	Get the n-th smallest key-value pair, starting at 0, which is the inverse of Rank.
+//	Used for percentile lookups and pagination by index, where the selected key is the start key of the page.
+//	The transforms registered with the instance are applied to the selected pair.
+//	If n is out of range, nil is returned.
+func (tx *Tx) SelectNth(n int) (_ *KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("SelectNth", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	if n < 0 {
+		return nil, nil
+	}
+
+	kvPair, selectErr := tx.store.selectRecursive(tx.root, n, 0)
+	if selectErr != nil || kvPair == nil {
+		return nil, selectErr
+	}
+
+	kvPair, selectErr = tx.store.thaw(kvPair)
+	if selectErr != nil {
+		return nil, selectErr
+	}
+
+	return tx.store.transform(kvPair), nil
+}
+
+// rankRecursive
+//
+//	Count the keys less than the key in the subtree of a node on the path to the key.
+//	Every key in a child before the index of the key at the current level is less than it, and every key in a child after it is greater.
+func (mariInst *Mari) rankRecursive(node *unsafe.Pointer, key []byte, level int) (int, error) {
+	currNode := loadINodeFromPointer(node)
+
+	var rank int
+	if len(currNode.leaf.key) > 0 && bytes.Compare(currNode.leaf.key, key) == -1 {
+		rank++
+	}
+
+	if len(key) == level {
+		return rank, nil
+	}
+
+	keyIndex := getIndexForLevel(key, level)
+
+	pos := 0
+	for index := range 256 {
+		if byte(index) > keyIndex {
+			break
+		}
+
+		if !isBitSet(currNode.bitmap, byte(index)) {
+			continue
+		}
+
+		childNode, rankErr := mariInst.getChildNode(currNode, pos)
+		if rankErr != nil {
+			return 0, rankErr
+		}
+
+		childPtr := storeINodeAsPointer(childNode)
+
+		var childRank int
+		if byte(index) == keyIndex {
+			childRank, rankErr = mariInst.rankRecursive(childPtr, key, level+1)
+		} else {
+			childRank, rankErr = mariInst.subtreeCount(childPtr)
+		}
+
+		if rankErr != nil {
+			return 0, rankErr
+		}
+
+		rank += childRank
+		pos++
+	}
+
+	return rank, nil
+}
+
+// selectRecursive
+//
+//	Find the n-th smallest key in the subtree of a node by skipping the subtree counts of the children before it.
+//	The leaf of the node is ordered before the children with a greater index at the current level.
+//	If a child shares the index of the leaf, the leaf is ordered within the child by its rank in the child.
+func (mariInst *Mari) selectRecursive(node *unsafe.Pointer, n, level int) (*KeyValuePair, error) {
+	currNode := loadINodeFromPointer(node)
+	leaf := currNode.leaf
+
+	getKeyVal := func() *KeyValuePair {
+		return &KeyValuePair{Version: leaf.version, Timestamp: leaf.timestamp, Key: leaf.key, Value: leaf.value}
+	}
+
+	leafPlaced := len(leaf.key) == 0
+	if !leafPlaced && len(leaf.key) == level {
+		if n == 0 {
+			return getKeyVal(), nil
+		}
+
+		n--
+		leafPlaced = true
+	}
+
+	pos := 0
+	for index := range 256 {
+		if !leafPlaced && byte(index) > leaf.key[level] {
+			if n == 0 {
+				return getKeyVal(), nil
+			}
+
+			n--
+			leafPlaced = true
+		}
+
+		if !isBitSet(currNode.bitmap, byte(index)) {
+			continue
+		}
+
+		childNode, selectErr := mariInst.getChildNode(currNode, pos)
+		if selectErr != nil {
+			return nil, selectErr
+		}
+
+		pos++
+		childPtr := storeINodeAsPointer(childNode)
+
+		count, selectErr := mariInst.subtreeCount(childPtr)
+		if selectErr != nil {
+			return nil, selectErr
+		}
+
+		if !leafPlaced && byte(index) == leaf.key[level] {
+			leafRank, selectErr := mariInst.rankRecursive(childPtr, leaf.key, level+1)
+			if selectErr != nil {
+				return nil, selectErr
+			}
+
+			switch {
+			case n < leafRank:
+				return mariInst.selectRecursive(childPtr, n, level+1)
+			case n == leafRank:
+				return getKeyVal(), nil
+			case n <= count:
+				return mariInst.selectRecursive(childPtr, n-1, level+1)
+			}
+
+			n -= count + 1
+			leafPlaced = true
+			continue
+		}
+
+		if n < count {
+			return mariInst.selectRecursive(childPtr, n, level+1)
+		}
+
+		n -= count
+	}
+
+	if !leafPlaced && n == 0 {
+		return getKeyVal(), nil
+	}
+
+	return nil, nil
+}
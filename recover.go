@@ -0,0 +1,22 @@
+package mariv2
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+//============================================= Mari Recover
+
+// recoverPanic
+//
+//	Deferred by the exported operations of transactions and iterators, so a panic within Mari is returned as ErrInternal instead of crashing the process.
+//	The panic is a bug in Mari, so it is logged with its stack. The error is only set if the operation panicked.
+func (mariInst *Mari) recoverPanic(op string, opErr *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	mariInst.logger.Error("recovered panic in operation", "op", op, "panic", recovered, "stack", string(debug.Stack()))
+	*opErr = fmt.Errorf("%w: %s: %v", ErrInternal, op, recovered)
+}
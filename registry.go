@@ -0,0 +1,46 @@
+package mariv2
+
+import "path/filepath"
+
+//============================================= Mari Registry
+
+// openInstances is the process wide registry of open instances, so two instances never map the same file
+var openInstances = &instanceRegistry{instances: make(map[string]*Mari)}
+
+// register
+//
+//	Register an instance under the cleaned absolute path of its file.
+//	If another instance has the file open, an AlreadyOpenError with the open instance is returned.
+func (registry *instanceRegistry) register(fileName string, mariInst *Mari) (string, error) {
+	path, absErr := filepath.Abs(fileName)
+	if absErr != nil {
+		return "", absErr
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	existing, ok := registry.instances[path]
+	if ok {
+		return "", &AlreadyOpenError{Path: path, Instance: existing}
+	}
+
+	registry.instances[path] = mariInst
+	return path, nil
+}
+
+// unregister
+//
+//	Remove an instance from the registry, so the file can be opened again.
+func (registry *instanceRegistry) unregister(path string, mariInst *Mari) {
+	if path == "" {
+		return
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if registry.instances[path] == mariInst {
+		delete(registry.instances, path)
+	}
+}
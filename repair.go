@@ -0,0 +1,192 @@
+package mariv2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+//============================================= Mari Read Repair
+
+// Fetch
+//
+//	Get the latest key-value pair for a key without applying any transforms, so an instance can be the repair source of another instance in the same process.
+//	With value checksums, a value that does not match its checksum is returned as an error instead, so a corrupt value is never used to repair another copy.
+func (mariInst *Mari) Fetch(ctx context.Context, key []byte) (*KeyValuePair, error) {
+	var kvPair *KeyValuePair
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		var fetchErr error
+		kvPair, fetchErr = tx.fetch(key)
+		return fetchErr
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return kvPair, nil
+}
+
+// fetch
+//
+//	Get the latest key-value pair for a key as of the snapshot of the transaction, copied out of the memory map and without applying any transforms, or nil if the key does not exist.
+//	With value checksums, a value that does not match its checksum is returned as an error. A value moved to the cold file is read from it.
+func (tx *Tx) fetch(key []byte) (*KeyValuePair, error) {
+	leaf, getErr := tx.store.getLeafRecursive(tx.root, tx.store.normalizeKey(key), 0)
+	if getErr != nil || leaf == nil {
+		return nil, getErr
+	}
+
+	if tx.store.valueChecksums {
+		verifyErr := tx.store.verifyChecksum(leaf)
+		if verifyErr != nil {
+			return nil, verifyErr
+		}
+	}
+
+	return tx.store.thaw(&KeyValuePair{Version: leaf.version, Timestamp: leaf.timestamp, Key: bytes.Clone(leaf.key), Value: bytes.Clone(leaf.value)})
+}
+
+// repairValue
+//
+//	Fetch the value of a leaf that does not match its checksum from the repair sources, in order, returning the first value matching the serialized checksum, or nil if no source has one.
+//	Matching the checksum means the value is the one written to the leaf, so a source ahead of or behind the instance is never used to change the value read.
+//	The repaired value is queued to be rewritten by the repair worker, since the caller holds a transaction and can not commit one of its own.
+func (mariInst *Mari) repairValue(leaf *LNode) []byte {
+	if len(mariInst.repairSources) == 0 {
+		return nil
+	}
+
+	key := bytes.Clone(leaf.key)
+	for idx, source := range mariInst.repairSources {
+		ctx, cancel := context.WithTimeout(context.Background(), RepairTimeout)
+		kvPair, fetchErr := source.Fetch(ctx, key)
+		cancel()
+
+		if fetchErr != nil {
+			mariInst.logger.Warn("error fetching corrupt value from repair source", "key", printableKey(key), "source", idx, "error", fetchErr)
+			continue
+		}
+
+		if kvPair == nil || checksumValue(kvPair.Value) != leaf.checksum {
+			continue
+		}
+
+		atomic.AddUint64(&mariInst.readRepairs, 1)
+		mariInst.logger.Warn("value did not match its checksum, repaired from repair source", "key", printableKey(key), "offset", leaf.startOffset, "source", idx)
+
+		select {
+		case mariInst.repairChan <- &repairRequest{key: key, value: kvPair.Value, offset: leaf.startOffset}:
+		default:
+			mariInst.logger.Warn("repair queue is full, repaired value not rewritten", "key", printableKey(key))
+		}
+
+		return kvPair.Value
+	}
+
+	mariInst.logger.Error("value did not match its checksum, no repair source has a matching value", "key", printableKey(key), "offset", leaf.startOffset)
+	return nil
+}
+
+// handleRepairs
+//
+//	Rewrite the values repaired from a repair source as they are queued, until the instance is closed.
+func (mariInst *Mari) handleRepairs() {
+	defer mariInst.workers.Done()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case request := <-mariInst.repairChan:
+			rewriteErr := mariInst.rewriteRepaired(request)
+			if rewriteErr != nil {
+				mariInst.logger.Warn("error rewriting repaired value", "key", printableKey(request.key), "error", rewriteErr)
+			}
+		}
+	}
+}
+
+// rewriteRepaired
+//
+//	Write a repaired value in a read-write transaction, even if the instance is a follower, so the latest version no longer reaches the corrupt leaf.
+//	The value is only written if the latest version of the key is still the corrupt leaf, since a write after it replaced the value.
+func (mariInst *Mari) rewriteRepaired(request *repairRequest) error {
+	return mariInst.updateTx(func(tx *Tx) error {
+		leaf, getErr := tx.store.getLeafRecursive(tx.root, request.key, 0)
+		if getErr != nil {
+			return getErr
+		}
+
+		if leaf == nil || leaf.startOffset != request.offset {
+			return nil
+		}
+
+		return tx.put(request.key, request.value)
+	})
+}
+
+// NewTCPRepairSource
+//
+//	Create a repair source that fetches keys from a replica serving replication with ServeReplication at the address.
+//	The connection is dialed on the first fetch and again after a failure, and fetches are sent one at a time.
+func NewTCPRepairSource(addr string) *TCPRepairSource {
+	return &TCPRepairSource{sink: NewTCPSink(addr)}
+}
+
+// Fetch
+//
+//	Fetch the latest key-value pair for a key from the replica.
+func (source *TCPRepairSource) Fetch(ctx context.Context, key []byte) (*KeyValuePair, error) {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+
+	reply, fetchErr := source.sink.roundTrip(ctx, replicationFrameFetch, key)
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	return deserializeFetched(reply)
+}
+
+// Close
+//
+//	Close the connection to the replica.
+func (source *TCPRepairSource) Close() error {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+
+	return source.sink.Close()
+}
+
+// serializeFetched
+//
+//	Serialize a fetched key-value pair as a write set of the pair, or nothing if the key does not exist.
+func serializeFetched(kvPair *KeyValuePair) []byte {
+	if kvPair == nil {
+		return nil
+	}
+
+	return serializeWriteSet([]*txWrite{{key: kvPair.Key, value: kvPair.Value}})
+}
+
+// deserializeFetched
+//
+//	Deserialize a fetched key-value pair, which is nil if the key does not exist.
+func deserializeFetched(sKvPair []byte) (*KeyValuePair, error) {
+	if len(sKvPair) == 0 {
+		return nil, nil
+	}
+
+	writeSet, desErr := deserializeWriteSet(sKvPair)
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	if len(writeSet) != 1 {
+		return nil, errors.New("fetched key is not a single key-value pair")
+	}
+
+	return &KeyValuePair{Key: writeSet[0].key, Value: writeSet[0].value}, nil
+}
@@ -0,0 +1,372 @@
+package mariv2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Replication
+
+// Replicate
+//
+//	Ship the version deltas of the instance to a sink in the background, in version order, for replicas, backups, or custom replication topologies.
+//	The deltas are read from a changefeed, so with a cursor, replication resumes after the last delta acked by the sink, and deltas missed while the sink was behind are rebuilt from the retained versions.
+//	A CatchUpSink reports the position of its replica instead, so replication resumes after the last delta the replica applied, and a replica too far behind the retained versions is sent a snapshot first.
+//	A delta the sink fails to ack is logged and shipped again after the retry interval, so the sink receives every delta at least once and never out of order.
+//	If the cursor can not be resumed because compaction reset the versions, ErrChangefeedReset is returned.
+func (mariInst *Mari) Replicate(sink ReplicationSink, opts ReplicationOpts) (*Replication, error) {
+	if sink == nil {
+		return nil, errors.New("replication sink is nil")
+	}
+
+	retryInterval := DefaultReplicationRetryInterval
+	if opts.RetryInterval != nil {
+		retryInterval = *opts.RetryInterval
+	}
+
+	if opts.SnapshotChunkSize <= 0 {
+		opts.SnapshotChunkSize = DefaultSnapshotChunkSize
+	}
+
+	opts.Prefix = mariInst.normalizeKey(opts.Prefix)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	replication := &Replication{
+		mariInst:      mariInst,
+		sink:          sink,
+		opts:          opts,
+		retryInterval: retryInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+	}
+
+	if _, isCatchUp := sink.(CatchUpSink); !isCatchUp {
+		feed, feedErr := mariInst.Changefeed(replication.feedOpts())
+		if feedErr != nil {
+			cancel()
+			return nil, feedErr
+		}
+
+		replication.feed = feed
+	}
+
+	go replication.run()
+	return replication, nil
+}
+
+// Acked
+//
+//	Get the version of the last delta or snapshot acked by the sink, or 0 if nothing has been acked since replication started.
+func (replication *Replication) Acked() uint64 {
+	return atomic.LoadUint64(&replication.acked)
+}
+
+// Err
+//
+//	Why replication stopped, which is nil if it was stopped or the instance was closed.
+//	Only valid once replication has stopped.
+func (replication *Replication) Err() error {
+	select {
+	case <-replication.stopped:
+		return replication.err
+	default:
+		return nil
+	}
+}
+
+// Stop
+//
+//	Stop replication, canceling the delta or snapshot chunk being shipped, and close the sink.
+//	Deltas that were not acked are shipped again by the next replication with the cursor, or from the position of a CatchUpSink.
+func (replication *Replication) Stop() error {
+	var closeErr error
+	replication.stopOnce.Do(func() {
+		replication.cancel()
+		<-replication.stopped
+
+		closeErr = replication.sink.Close()
+	})
+
+	return closeErr
+}
+
+// run
+//
+//	Ship the deltas of the changefeed to the sink until the changefeed stops or replication is stopped.
+//	For a CatchUpSink, the changefeed is opened after the position of the replica, and a changefeed stopped by ErrChangefeedReset means the replica fell behind the retained versions, so the replica is caught up again with a snapshot.
+func (replication *Replication) run() {
+	defer close(replication.stopped)
+
+	catchUpSink, isCatchUp := replication.sink.(CatchUpSink)
+	if !isCatchUp {
+		replication.setErr(replication.stream(replication.feed))
+		return
+	}
+
+	for {
+		feed, catchUpErr := replication.catchUp(catchUpSink)
+		if catchUpErr != nil || feed == nil {
+			replication.setErr(catchUpErr)
+			return
+		}
+
+		streamErr := replication.stream(feed)
+		if !errors.Is(streamErr, ErrChangefeedReset) {
+			replication.setErr(streamErr)
+			return
+		}
+
+		replication.mariInst.logger.Warn("replica fell behind the retained versions, catching up with a snapshot", "acked", replication.Acked())
+	}
+}
+
+// stream
+//
+//	Ship each delta of a changefeed to the sink, returning why the changefeed stopped.
+//	The changefeed is closed when replication is stopped, so a consumer waiting on it is released.
+func (replication *Replication) stream(feed *Changefeed) error {
+	stop := context.AfterFunc(replication.ctx, feed.Close)
+	defer stop()
+	defer feed.Close()
+
+	for delta := range feed.Events() {
+		shipErr := replication.ship(feed, delta)
+		if shipErr != nil {
+			return shipErr
+		}
+	}
+
+	return feed.Err()
+}
+
+// ship
+//
+//	Ship a delta to the sink until it is acked, then ack the version under the cursor of the changefeed.
+//	Returns the error of the context if replication was stopped, or why the version could not be acked.
+func (replication *Replication) ship(feed *Changefeed, delta *CommitEvent) error {
+	for {
+		receiveErr := replication.sink.Receive(replication.ctx, delta)
+		if receiveErr == nil {
+			break
+		}
+
+		if replication.ctx.Err() != nil {
+			return replication.ctx.Err()
+		}
+
+		replication.mariInst.logger.Warn("error shipping delta to replication sink", "version", delta.Version, "error", receiveErr)
+		if !replication.wait() {
+			return replication.ctx.Err()
+		}
+	}
+
+	atomic.StoreUint64(&replication.acked, delta.Version)
+	if replication.opts.Cursor == "" {
+		return nil
+	}
+
+	return feed.Ack(delta.Version)
+}
+
+// wait
+//
+//	Wait the retry interval before shipping again, returning false if replication was stopped while waiting.
+func (replication *Replication) wait() bool {
+	timer := time.NewTimer(replication.retryInterval)
+	defer timer.Stop()
+
+	select {
+	case <-replication.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// setErr
+//
+//	Record why replication stopped, unless it was stopped or the instance was closed.
+func (replication *Replication) setErr(err error) {
+	if replication.ctx.Err() != nil || errors.Is(err, ErrClosed) {
+		return
+	}
+
+	replication.err = err
+}
+
+// feedOpts
+//
+//	Get the options of the changefeed the deltas are read from.
+func (replication *Replication) feedOpts() ChangefeedOpts {
+	return ChangefeedOpts{Cursor: replication.opts.Cursor, Prefix: replication.opts.Prefix, BufferSize: replication.opts.BufferSize}
+}
+
+// ApplyDelta
+//
+//	Apply a version delta received from a leader to a replica, in a single read-write transaction, even if the instance is a follower.
+//	The leader version and timestamp of the delta are recorded in ReplicationBucket with the changes, so a delta with a timestamp at or before the last delta applied is skipped, and deltas shipped again by the leader are only applied once.
+//	The replica commits the delta at a version of its own, with the annotations of the delta, so its own changefeeds can replicate it further.
+func (mariInst *Mari) ApplyDelta(delta *CommitEvent) error {
+	_, applyErr := mariInst.applyDelta(delta)
+	return applyErr
+}
+
+// ReplicatedVersion
+//
+//	Get the leader version of the last delta applied to the replica with ApplyDelta, or 0 if no delta has been applied.
+func (mariInst *Mari) ReplicatedVersion() (uint64, error) {
+	var entry versionEntry
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		var loadErr error
+		entry, loadErr = tx.loadReplicated()
+		return loadErr
+	})
+
+	if readErr != nil {
+		return 0, readErr
+	}
+
+	return entry.version, nil
+}
+
+// applyDelta
+//
+//	Apply a delta, returning whether it was applied or skipped because a later delta was already applied.
+func (mariInst *Mari) applyDelta(delta *CommitEvent) (bool, error) {
+	if delta == nil {
+		return false, errors.New("replication delta is nil")
+	}
+
+	var applied bool
+	updateErr := mariInst.updateTx(func(tx *Tx) error {
+		applied = false
+
+		last, loadErr := tx.loadReplicated()
+		if loadErr != nil {
+			return loadErr
+		}
+
+		if delta.Timestamp <= last.timestamp {
+			return nil
+		}
+
+		for _, change := range delta.Changes {
+			var writeErr error
+			switch {
+			case change.Prefix:
+				_, writeErr = tx.deletePrefix(bytes.Clone(change.Key))
+			case change.Delete:
+				writeErr = tx.delete(bytes.Clone(change.Key))
+			default:
+				writeErr = tx.put(bytes.Clone(change.Key), bytes.Clone(change.Value))
+			}
+
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+
+		for key, value := range delta.Annotations {
+			annotateErr := tx.SetAnnotation(key, value)
+			if annotateErr != nil {
+				return annotateErr
+			}
+		}
+
+		applied = true
+		return tx.PutSystem(ReplicationBucket, replicatedKey, encodeVersionEntry(versionEntry{version: delta.Version, timestamp: delta.Timestamp}))
+	})
+
+	if updateErr != nil {
+		return false, updateErr
+	}
+
+	return applied, nil
+}
+
+// loadReplicated
+//
+//	Get the leader version and timestamp of the last delta applied as of the snapshot of the transaction.
+func (tx *Tx) loadReplicated() (versionEntry, error) {
+	kvPair, getErr := tx.GetSystem(ReplicationBucket, replicatedKey)
+	if getErr != nil || kvPair == nil {
+		return versionEntry{}, getErr
+	}
+
+	if len(kvPair.Value) != 2*OffsetSize64 {
+		return versionEntry{}, errors.New("replicated version is not a version and timestamp")
+	}
+
+	return decodeVersionEntry(kvPair.Value), nil
+}
+
+// serializeDelta
+//
+//	Serialize a delta as the version (8 bytes), the timestamp (8 bytes), and the length of the changes (8 bytes), followed by the changes and the annotations, each serialized as a write set.
+//	The annotations are sorted by key, so a delta always serializes the same.
+func serializeDelta(delta *CommitEvent) []byte {
+	changes := make([]*txWrite, 0, len(delta.Changes))
+	for _, change := range delta.Changes {
+		changes = append(changes, &txWrite{key: change.Key, value: change.Value, isDelete: change.Delete, isPrefix: change.Prefix})
+	}
+
+	annotations := make([]*txWrite, 0, len(delta.Annotations))
+	for _, key := range slices.Sorted(maps.Keys(delta.Annotations)) {
+		annotations = append(annotations, &txWrite{key: []byte(key), value: []byte(delta.Annotations[key])})
+	}
+
+	sChanges := serializeWriteSet(changes)
+	sDelta := serializeUint64(delta.Version)
+	sDelta = append(sDelta, serializeUint64(delta.Timestamp)...)
+	sDelta = append(sDelta, serializeUint64(uint64(len(sChanges)))...)
+	sDelta = append(sDelta, sChanges...)
+	return append(sDelta, serializeWriteSet(annotations)...)
+}
+
+// deserializeDelta
+//
+//	Deserialize the byte representation of a delta.
+func deserializeDelta(sDelta []byte) (*CommitEvent, error) {
+	invalidErr := errors.New("invalid data length for serialized delta")
+	if len(sDelta) < 3*OffsetSize64 {
+		return nil, invalidErr
+	}
+
+	version, _ := deserializeUint64(sDelta[:OffsetSize64])
+	timestamp, _ := deserializeUint64(sDelta[OffsetSize64 : 2*OffsetSize64])
+	changesLength, _ := deserializeUint64(sDelta[2*OffsetSize64 : 3*OffsetSize64])
+	if changesLength > uint64(len(sDelta)-3*OffsetSize64) {
+		return nil, invalidErr
+	}
+
+	changesEnd := 3*OffsetSize64 + int(changesLength)
+	changes, desErr := deserializeWriteSet(sDelta[3*OffsetSize64 : changesEnd])
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	annotations, desErr := deserializeWriteSet(sDelta[changesEnd:])
+	if desErr != nil {
+		return nil, desErr
+	}
+
+	delta := &CommitEvent{Version: version, Timestamp: timestamp}
+	for _, change := range changes {
+		delta.Changes = append(delta.Changes, &Change{Key: change.key, Value: change.value, Delete: change.isDelete, Prefix: change.isPrefix})
+	}
+
+	if len(annotations) > 0 {
+		delta.Annotations = make(map[string]string, len(annotations))
+		for _, annotation := range annotations {
+			delta.Annotations[string(annotation.key)] = string(annotation.value)
+		}
+	}
+
+	return delta, nil
+}
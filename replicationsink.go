@@ -0,0 +1,394 @@
+package mariv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//============================================= Mari Replication Sinks
+
+// NewTCPSink
+//
+//	Create a sink that ships deltas and snapshots to a replica serving replication with ServeReplication at the address.
+//	Each message is sent as a frame of its length (8 bytes) and kind (1 byte) followed by the message, and is acked once the replica replies with a frame of the same kind.
+//	A delta is acked with its timestamp and a snapshot chunk with its checksum, after it is applied, and a position request is replied to with the position of the replica.
+//	The connection is dialed on the first message and again after a failure. The sink is not safe for concurrent use, since it is only used by the go routine of a replication.
+func NewTCPSink(addr string) *TCPSink {
+	return &TCPSink{addr: addr}
+}
+
+// Receive
+//
+//	Send a delta to the replica and wait for its ack. The connection is closed if the context is canceled, or if the delta is not acked.
+func (sink *TCPSink) Receive(ctx context.Context, delta *CommitEvent) error {
+	ack, sendErr := sink.roundTrip(ctx, replicationFrameDelta, serializeDelta(delta))
+	if sendErr != nil {
+		return sendErr
+	}
+
+	acked, _ := deserializeUint64(ack)
+	if len(ack) != OffsetSize64 || acked != delta.Timestamp {
+		return sink.failAck(fmt.Errorf("%w: sent timestamp %d, acked %d", ErrReplicationAck, delta.Timestamp, acked))
+	}
+
+	return nil
+}
+
+// Position
+//
+//	Request the position of the replica.
+func (sink *TCPSink) Position(ctx context.Context) (*ReplicaPosition, error) {
+	sPosition, sendErr := sink.roundTrip(ctx, replicationFramePosition, nil)
+	if sendErr != nil {
+		return nil, sendErr
+	}
+
+	return deserializePosition(sPosition)
+}
+
+// ReceiveSnapshot
+//
+//	Send a snapshot chunk to the replica and wait for its ack. The connection is closed if the context is canceled, or if the chunk is not acked.
+func (sink *TCPSink) ReceiveSnapshot(ctx context.Context, chunk *SnapshotChunk) error {
+	ack, sendErr := sink.roundTrip(ctx, replicationFrameSnapshot, serializeSnapshotChunk(chunk))
+	if sendErr != nil {
+		return sendErr
+	}
+
+	acked, _ := deserializeUint32(ack)
+	if len(ack) != OffsetSize32 || acked != chunk.Checksum {
+		return sink.failAck(fmt.Errorf("%w: sent checksum %08x, acked %08x", ErrReplicationAck, chunk.Checksum, acked))
+	}
+
+	return nil
+}
+
+// Close
+//
+//	Close the connection to the replica.
+func (sink *TCPSink) Close() error {
+	if sink.conn == nil {
+		return nil
+	}
+
+	closeErr := sink.conn.Close()
+	sink.conn = nil
+	return closeErr
+}
+
+// roundTrip
+//
+//	Send a frame to the replica, dialing it if there is no connection, and wait for the reply of the same kind.
+func (sink *TCPSink) roundTrip(ctx context.Context, kind byte, payload []byte) ([]byte, error) {
+	if sink.conn == nil {
+		dialer := net.Dialer{Timeout: DefaultReplicationDialTimeout}
+		conn, dialErr := dialer.DialContext(ctx, "tcp", sink.addr)
+		if dialErr != nil {
+			return nil, dialErr
+		}
+
+		sink.conn = conn
+	}
+
+	conn := sink.conn
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	writeErr := writeReplicationFrame(conn, kind, payload)
+	if writeErr != nil {
+		return nil, sink.failAck(writeErr)
+	}
+
+	replyKind, reply, readErr := readReplicationFrame(conn)
+	if readErr != nil {
+		return nil, sink.failAck(fmt.Errorf("%w: %w", ErrReplicationAck, readErr))
+	}
+
+	if replyKind != kind {
+		return nil, sink.failAck(fmt.Errorf("%w: sent frame of kind %d, replied with kind %d", ErrReplicationAck, kind, replyKind))
+	}
+
+	return reply, nil
+}
+
+// failAck
+//
+//	Close the connection after a failed round trip, so the next message is sent on a new connection instead of reading a stale reply.
+func (sink *TCPSink) failAck(err error) error {
+	sink.Close()
+	return err
+}
+
+// ServeReplication
+//
+//	Accept connections from TCPSinks on the listener, applying each delta and snapshot chunk received and acking it once applied, and from TCPRepairSources and TCPReplicaReaders, replying to each fetch or read with the key-value pair.
+//	A delta or chunk that fails to apply closes its connection without an ack, so the sink ships it again.
+//	Blocks until the listener is closed, then closes the connections still open and returns nil.
+func (mariInst *Mari) ServeReplication(listener net.Listener) error {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+
+	defer func() {
+		lock.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+
+		lock.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, acceptErr := listener.Accept()
+		if errors.Is(acceptErr, net.ErrClosed) {
+			return nil
+		}
+
+		if acceptErr != nil {
+			return acceptErr
+		}
+
+		lock.Lock()
+		conns[conn] = struct{}{}
+		lock.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				lock.Lock()
+				delete(conns, conn)
+				lock.Unlock()
+				conn.Close()
+			}()
+
+			serveErr := mariInst.serveReplicationConn(conn)
+			if serveErr != nil && !errors.Is(serveErr, io.EOF) && !errors.Is(serveErr, net.ErrClosed) {
+				mariInst.logger.Warn("error serving replication", "remote", conn.RemoteAddr().String(), "error", serveErr)
+			}
+		}()
+	}
+}
+
+// serveReplicationConn
+//
+//	Reply to the frames received on a connection until it is closed.
+func (mariInst *Mari) serveReplicationConn(conn net.Conn) error {
+	for {
+		kind, payload, readErr := readReplicationFrame(conn)
+		if readErr != nil {
+			return readErr
+		}
+
+		reply, replyErr := mariInst.replyReplicationFrame(kind, payload)
+		if replyErr != nil {
+			return replyErr
+		}
+
+		writeErr := writeReplicationFrame(conn, kind, reply)
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+}
+
+// replyReplicationFrame
+//
+//	Apply a delta or snapshot chunk, get the position of the replica, fetch a key for a repair, or read a key for a quorum read, returning the reply to the frame.
+func (mariInst *Mari) replyReplicationFrame(kind byte, payload []byte) ([]byte, error) {
+	switch kind {
+	case replicationFrameDelta:
+		delta, desErr := deserializeDelta(payload)
+		if desErr != nil {
+			return nil, desErr
+		}
+
+		applyErr := mariInst.ApplyDelta(delta)
+		if applyErr != nil {
+			return nil, applyErr
+		}
+
+		return serializeUint64(delta.Timestamp), nil
+	case replicationFrameSnapshot:
+		chunk, desErr := deserializeSnapshotChunk(payload)
+		if desErr != nil {
+			return nil, desErr
+		}
+
+		applyErr := mariInst.ApplySnapshotChunk(chunk)
+		if applyErr != nil {
+			return nil, applyErr
+		}
+
+		return serializeUint32(chunk.Checksum), nil
+	case replicationFramePosition:
+		position, positionErr := mariInst.ReplicationPosition()
+		if positionErr != nil {
+			return nil, positionErr
+		}
+
+		return serializePosition(position), nil
+	case replicationFrameFetch:
+		kvPair, fetchErr := mariInst.Fetch(context.Background(), payload)
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+
+		return serializeFetched(kvPair), nil
+	case replicationFrameRead:
+		read, readErr := mariInst.ReadReplica(context.Background(), payload)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		return serializeReplicaRead(read), nil
+	default:
+		return nil, fmt.Errorf("unknown replication frame kind %d", kind)
+	}
+}
+
+// writeReplicationFrame
+//
+//	Write a frame of the length of the payload and its kind (8 bytes), the kind (1 byte), and the payload to a connection.
+func writeReplicationFrame(conn net.Conn, kind byte, payload []byte) error {
+	frame := serializeUint64(uint64(len(payload) + 1))
+	frame = append(frame, kind)
+	_, writeErr := conn.Write(append(frame, payload...))
+	return writeErr
+}
+
+// readReplicationFrame
+//
+//	Read a frame from a connection, returning its kind and payload.
+func readReplicationFrame(conn net.Conn) (byte, []byte, error) {
+	header := make([]byte, OffsetSize64)
+	_, readErr := io.ReadFull(conn, header)
+	if readErr != nil {
+		return 0, nil, readErr
+	}
+
+	length, _ := deserializeUint64(header)
+	if length == 0 || length > MaxReplicationFrameSize {
+		return 0, nil, fmt.Errorf("replication frame of %d bytes is empty or larger than MaxReplicationFrameSize", length)
+	}
+
+	frame := make([]byte, length)
+	_, readErr = io.ReadFull(conn, frame)
+	if readErr != nil {
+		return 0, nil, readErr
+	}
+
+	return frame[0], frame[1:], nil
+}
+
+// NewDirectorySink
+//
+//	Create a sink that ships deltas as files to a directory, creating the directory if it does not exist.
+//	Each delta is written to a temporary file, synced, and renamed to the zero padded timestamp of the delta with ReplicationFileExt, so the files sort in version order and a partially written delta is never read.
+//	The directory can be shared with, or copied to, replicas that apply it with ApplyDirectory. Files are not removed once applied, so pruning them is left to the caller.
+func NewDirectorySink(dir string) (*DirectorySink, error) {
+	mkdirErr := os.MkdirAll(dir, 0o755)
+	if mkdirErr != nil {
+		return nil, mkdirErr
+	}
+
+	return &DirectorySink{dir: dir}, nil
+}
+
+// Receive
+//
+//	Write a delta to the directory, acking it once the file and the directory are synced.
+func (sink *DirectorySink) Receive(ctx context.Context, delta *CommitEvent) error {
+	fileName := filepath.Join(sink.dir, deltaFileName(delta.Timestamp))
+	tempName := fileName + ".tmp"
+
+	file, openErr := os.OpenFile(tempName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if openErr != nil {
+		return openErr
+	}
+
+	_, writeErr := file.Write(serializeDelta(delta))
+	if writeErr == nil {
+		writeErr = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+
+	if writeErr != nil {
+		os.Remove(tempName)
+		return writeErr
+	}
+
+	renameErr := os.Rename(tempName, fileName)
+	if renameErr != nil {
+		os.Remove(tempName)
+		return renameErr
+	}
+
+	return syncDirectory(sink.dir)
+}
+
+// Close
+//
+//	Nothing is held open by the sink.
+func (sink *DirectorySink) Close() error {
+	return nil
+}
+
+// ApplyDirectory
+//
+//	Apply the deltas written to a directory by a DirectorySink, in version order, returning how many were applied.
+//	Deltas at or before the last delta applied are skipped, so the directory can be applied again as new deltas arrive.
+func (mariInst *Mari) ApplyDirectory(dir string) (int, error) {
+	entries, readErr := os.ReadDir(dir)
+	if readErr != nil {
+		return 0, readErr
+	}
+
+	var totalApplied int
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ReplicationFileExt) {
+			continue
+		}
+
+		sDelta, readErr := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if readErr != nil {
+			return totalApplied, readErr
+		}
+
+		delta, desErr := deserializeDelta(sDelta)
+		if desErr != nil {
+			return totalApplied, fmt.Errorf("%s: %w", entry.Name(), desErr)
+		}
+
+		applied, applyErr := mariInst.applyDelta(delta)
+		if applyErr != nil {
+			return totalApplied, applyErr
+		}
+
+		if applied {
+			totalApplied++
+		}
+	}
+
+	return totalApplied, nil
+}
+
+// deltaFileName
+//
+//	Get the name of the file a delta is written to, which is its timestamp padded to the width of a uint64 so names sort in order.
+func deltaFileName(timestamp uint64) string {
+	return fmt.Sprintf("%020d%s", timestamp, ReplicationFileExt)
+}
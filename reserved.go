@@ -0,0 +1,158 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+//============================================= Mari Reserved Keyspace
+
+// isReservedKey
+//
+//	Check if a key is under ReservedKeyPrefix, where Mari persists internal state like prepared transactions and the ttl index.
+func isReservedKey(key []byte) bool {
+	return bytes.HasPrefix(key, ReservedKeyPrefix)
+}
+
+// includeReserved
+//
+//	Check if the options of a scan include keys under ReservedKeyPrefix.
+func includeReserved(opts *RangeOpts) bool {
+	return opts != nil && opts.IncludeReserved != nil && *opts.IncludeReserved
+}
+
+// excludeReserved
+//
+//	Remove the key-value pairs under ReservedKeyPrefix from the results of a scan, in place.
+func excludeReserved(kvPairs []*KeyValuePair) []*KeyValuePair {
+	userKvPairs := kvPairs[:0]
+	for _, kvPair := range kvPairs {
+		if !isReservedKey(kvPair.Key) {
+			userKvPairs = append(userKvPairs, kvPair)
+		}
+	}
+
+	return userKvPairs
+}
+
+// iterateUser
+//
+//	Iterate the key-value pairs from the start key, skipping the keys under ReservedKeyPrefix unless they are included in the options.
+//	Reserved keys are sorted together, so once the iteration reaches them, it continues from the first key after them for the remaining results, instead of scanning past every reserved key.
+func (tx *Tx) iterateUser(startKey []byte, totalResults int, opts *RangeOpts) ([]*KeyValuePair, error) {
+	kvPairs, iterErr := tx.iterate(startKey, totalResults, opts)
+	if iterErr != nil || includeReserved(opts) {
+		return kvPairs, iterErr
+	}
+
+	for idx, kvPair := range kvPairs {
+		if !isReservedKey(kvPair.Key) {
+			continue
+		}
+
+		afterReserved, iterErr := tx.iterate(reservedKeyEnd, totalResults-idx, opts)
+		if iterErr != nil {
+			return nil, iterErr
+		}
+
+		return append(kvPairs[:idx], afterReserved...), nil
+	}
+
+	return kvPairs, nil
+}
+
+// PutSystem
+//
+//	Insert or update a key-value pair in a named bucket of the system keyspace under ReservedKeyPrefix, for state persisted by packages built on Mari, like applied migrations.
+//	System keys never collide with user keys, and are excluded from Iterate and Range unless reserved keys are included.
+//	The bucket must be non-empty and can not contain a null byte.
+func (tx *Tx) PutSystem(bucket string, key, value []byte) (recoveredErr error) {
+	defer tx.store.recoverPanic("PutSystem", &recoveredErr)
+
+	if !tx.isWrite {
+		return errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
+	}
+
+	bucketPrefix, bucketErr := systemBucket(bucket)
+	if bucketErr != nil {
+		return bucketErr
+	}
+
+	return tx.put(append(bucketPrefix, key...), value)
+}
+
+// GetSystem
+//
+//	Get the key-value pair for a key in a named bucket of the system keyspace, without applying any transforms.
+//	The key of the pair is the key within the bucket.
+func (tx *Tx) GetSystem(bucket string, key []byte) (_ *KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("GetSystem", &recoveredErr)
+
+	bucketPrefix, bucketErr := systemBucket(bucket)
+	if bucketErr != nil {
+		return nil, bucketErr
+	}
+
+	kvPair, getErr := tx.get(append(bucketPrefix, key...))
+	if getErr != nil || kvPair == nil {
+		return nil, getErr
+	}
+
+	return &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: kvPair.Key[len(bucketPrefix):], Value: kvPair.Value}, nil
+}
+
+// DeleteSystem
+//
+//	Delete a key-value pair from a named bucket of the system keyspace.
+func (tx *Tx) DeleteSystem(bucket string, key []byte) (recoveredErr error) {
+	defer tx.store.recoverPanic("DeleteSystem", &recoveredErr)
+
+	if !tx.isWrite {
+		return errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
+	}
+
+	bucketPrefix, bucketErr := systemBucket(bucket)
+	if bucketErr != nil {
+		return bucketErr
+	}
+
+	return tx.delete(append(bucketPrefix, key...))
+}
+
+// RangeSystem
+//
+//	Get every key-value pair in a named bucket of the system keyspace, in sorted order by key, without applying any transforms.
+//	The key of each pair is the key within the bucket.
+func (tx *Tx) RangeSystem(bucket string) (_ []*KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("RangeSystem", &recoveredErr)
+
+	bucketPrefix, bucketErr := systemBucket(bucket)
+	if bucketErr != nil {
+		return nil, bucketErr
+	}
+
+	kvPairs, rangeErr := tx.rangeKvPairs(bucketPrefix, bucketEndKey(bucketPrefix), nil)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	bucketKvPairs := make([]*KeyValuePair, len(kvPairs))
+	for idx, kvPair := range kvPairs {
+		bucketKvPairs[idx] = &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: kvPair.Key[len(bucketPrefix):], Value: kvPair.Value}
+	}
+
+	return bucketKvPairs, nil
+}
+
+// systemBucket
+//
+//	Get the prefix of a named bucket of the system keyspace, which is terminated by a null byte so no bucket is the prefix of another.
+func systemBucket(bucket string) ([]byte, error) {
+	if len(bucket) == 0 || strings.IndexByte(bucket, 0) >= 0 {
+		return nil, errors.New("system bucket must be non-empty and can not contain a null byte")
+	}
+
+	bucketPrefix := append(bytes.Clone(systemKeyPrefix), bucket...)
+	return append(bucketPrefix, 0), nil
+}
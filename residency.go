@@ -0,0 +1,95 @@
+package mariv2
+
+import (
+	"time"
+)
+
+//============================================= Mari Residency
+
+// newResidency
+//
+//	Create the residency sampler, taking the major page faults of the process as the baseline for the estimate.
+func newResidency(interval time.Duration) *residency {
+	return &residency{interval: interval, baseFaults: majorFaults()}
+}
+
+// handleResidency
+//
+//	Sample the pages of the serialized data resident in memory on every interval, until the instance is closed.
+//	Samples that fail are logged and skipped, so a transient error does not stop sampling.
+func (mariInst *Mari) handleResidency() {
+	defer mariInst.workers.Done()
+
+	ticker := time.NewTicker(mariInst.residency.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			sampleErr := mariInst.sampleResidency()
+			if sampleErr != nil {
+				mariInst.logger.Warn("error sampling residency", "error", sampleErr)
+			}
+		}
+	}
+}
+
+// sampleResidency
+//
+//	Count the bytes of the serialized data resident in memory, holding the resize lock so the memory map is not unmapped while it is sampled.
+//	Pre-allocated space past the serialized data has never been written, so it is not sampled.
+func (mariInst *Mari) sampleResidency() error {
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	_, endSerialized, sampleErr := mariInst.loadMetaEndSerialized()
+	if sampleErr != nil {
+		return sampleErr
+	}
+
+	mMap := mariInst.data.Load().(MMap)
+	mapped, resident, sampleErr := mMap[:min(endSerialized, uint64(len(mMap)))].residentBytes()
+	if sampleErr != nil {
+		return sampleErr
+	}
+
+	mariInst.residency.record(mapped, resident, majorFaults())
+	return nil
+}
+
+// record
+//
+//	Store a sample as the latest, with the major page faults since the instance was opened.
+func (sampler *residency) record(mapped, resident, faults uint64) {
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+
+	sampler.latest.Samples++
+	sampler.latest.SampledAt = time.Now()
+	sampler.latest.MappedBytes = mapped
+	sampler.latest.ResidentBytes = resident
+	sampler.latest.ResidentRatio = 0
+	if mapped > 0 {
+		sampler.latest.ResidentRatio = float64(resident) / float64(mapped)
+	}
+
+	if faults > sampler.baseFaults {
+		sampler.latest.MajorFaults = faults - sampler.baseFaults
+	}
+}
+
+// stats
+//
+//	Get the latest sample, which is empty if residency is not sampled.
+func (sampler *residency) stats() ResidencyStats {
+	if sampler == nil {
+		return ResidencyStats{}
+	}
+
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+
+	return sampler.latest
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package mariv2
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+//============================================= Mari Residency (linux)
+
+// residencySupported is whether the pages resident in memory can be sampled on the platform
+const residencySupported = true
+
+// residentBytes
+//
+//	Count the bytes of the memory map resident in memory with mincore, where the length is rounded up to the page size.
+//	The kernel sets the low bit of the entry for each page that is resident. x/sys does not wrap mincore on linux, so the syscall is made directly.
+func (mapped MMap) residentBytes() (uint64, uint64, error) {
+	if len(mapped) == 0 {
+		return 0, 0, nil
+	}
+
+	pageSize := os.Getpagesize()
+	pages := (len(mapped) + pageSize - 1) / pageSize
+	vec := make([]byte, pages)
+
+	_, _, errno := unix.Syscall(unix.SYS_MINCORE, uintptr(unsafe.Pointer(unsafe.SliceData(mapped))), uintptr(len(mapped)), uintptr(unsafe.Pointer(unsafe.SliceData(vec))))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+
+	var resident uint64
+	for _, entry := range vec {
+		if entry&1 == 1 {
+			resident++
+		}
+	}
+
+	return uint64(pages * pageSize), resident * uint64(pageSize), nil
+}
+
+// majorFaults
+//
+//	Get the major page faults of the process with getrusage, which are faults that had to read from disk.
+func majorFaults() uint64 {
+	var usage unix.Rusage
+	if unix.Getrusage(unix.RUSAGE_SELF, &usage) != nil {
+		return 0
+	}
+
+	return uint64(usage.Majflt)
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package mariv2
+
+import "errors"
+
+//============================================= Mari Residency (other)
+
+// residencySupported is whether the pages resident in memory can be sampled on the platform
+const residencySupported = false
+
+// residentBytes
+//
+//	Residency is sampled with mincore, which is only used on linux, so an error is returned.
+func (mapped MMap) residentBytes() (uint64, uint64, error) {
+	return 0, 0, errors.New("residency sampling is not supported on this platform")
+}
+
+// majorFaults
+//
+//	Major page faults are only read on linux, so 0 is returned.
+func majorFaults() uint64 {
+	return 0
+}
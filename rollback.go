@@ -0,0 +1,167 @@
+package mariv2
+
+import (
+	"bytes"
+	"strconv"
+	"unsafe"
+)
+
+//============================================= Mari Rollback
+
+// RollbackTo
+//
+//	Restore the user keys to a retained earlier version, recording the rollback as a new version, so a bad deployment can be undone without restoring from a backup.
+//	The rollback is a single read-write transaction, so readers observe either the version before it or the restored keys.
+//	If the version is not retained, ErrVersionNotFound is returned.
+func (mariInst *Mari) RollbackTo(version uint64) error {
+	entry, entryErr := mariInst.versionEntryAt(version)
+	if entryErr != nil {
+		return entryErr
+	}
+
+	return mariInst.rollbackTo(entry)
+}
+
+// rollbackTo
+//
+//	Restore the user keys of a recorded version in a read-write transaction, so the rollback is committed as a new version instead of moving the root back.
+//	Commit hooks, changefeeds, and the audit log observe the rollback as the puts and deletes that undo every change since the version, and the commit is annotated with RollbackAnnotation.
+//	The reserved keyspace, like changefeed cursors and checkpoints, is not rolled back.
+//	The writes are computed from the entire snapshot, so the transaction is retried instead of rebased if another transaction commits first.
+func (mariInst *Mari) rollbackTo(recorded versionEntry) error {
+	return mariInst.UpdateTx(func(tx *Tx) error {
+		tx.noRebase = true
+
+		entry, retainedErr := mariInst.retainedEntry(recorded)
+		if retainedErr != nil {
+			return retainedErr
+		}
+
+		annotateErr := tx.SetAnnotation(RollbackAnnotation, strconv.FormatUint(entry.version, 10))
+		if annotateErr != nil {
+			return annotateErr
+		}
+
+		return tx.restore(entry)
+	})
+}
+
+// restore
+//
+//	Write the differences between the user keys of the transaction and of a retained version, deleting keys added since the version and writing back keys changed or deleted since.
+//	Keys are restored with the expiration they had at the version.
+//	If a key to restore is held by a prepared transaction, ErrKeyLocked is returned.
+func (tx *Tx) restore(entry versionEntry) error {
+	targetRoot, readErr := tx.store.readINodeFromMemMap(entry.rootOffset)
+	if readErr != nil {
+		return readErr
+	}
+
+	targetPtr := storeINodeAsPointer(targetRoot)
+	targetKvPairs, rangeErr := tx.store.rangeRecursive(targetPtr, 0, targetRoot.version, nil, nil, 0)
+	if rangeErr != nil {
+		return rangeErr
+	}
+
+	currKvPairs, rangeErr := tx.store.rangeRecursive(tx.root, 0, tx.snapshotVersion, nil, nil, 0)
+	if rangeErr != nil {
+		return rangeErr
+	}
+
+	targetExpires, rangeErr := tx.store.rangeExpires(targetPtr, targetRoot.version)
+	if rangeErr != nil {
+		return rangeErr
+	}
+
+	currExpires, rangeErr := tx.store.rangeExpires(tx.root, tx.snapshotVersion)
+	if rangeErr != nil {
+		return rangeErr
+	}
+
+	targetKvPairs, currKvPairs = excludeReserved(targetKvPairs), excludeReserved(currKvPairs)
+	for len(targetKvPairs) > 0 || len(currKvPairs) > 0 {
+		var cmp int
+		switch {
+		case len(targetKvPairs) == 0:
+			cmp = 1
+		case len(currKvPairs) == 0:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(targetKvPairs[0].Key, currKvPairs[0].Key)
+		}
+
+		var restoreErr error
+		switch {
+		case cmp > 0:
+			restoreErr = tx.restoreDelete(currKvPairs[0].Key)
+			currKvPairs = currKvPairs[1:]
+		case cmp < 0:
+			target := targetKvPairs[0]
+			restoreErr = tx.restorePut(target.Key, target.Value, targetExpires[string(target.Key)])
+			targetKvPairs = targetKvPairs[1:]
+		default:
+			target, curr := targetKvPairs[0], currKvPairs[0]
+			key := string(target.Key)
+			if !bytes.Equal(target.Value, curr.Value) || targetExpires[key] != currExpires[key] {
+				restoreErr = tx.restorePut(target.Key, target.Value, targetExpires[key])
+			}
+
+			targetKvPairs, currKvPairs = targetKvPairs[1:], currKvPairs[1:]
+		}
+
+		if restoreErr != nil {
+			return restoreErr
+		}
+	}
+
+	return nil
+}
+
+// restorePut
+//
+//	Write back a key-value pair of a retained version, with its expiration time if it had one.
+func (tx *Tx) restorePut(key, value []byte, expiresAt uint64) error {
+	if tx.store.isKeyLocked(key) {
+		return ErrKeyLocked
+	}
+
+	key, value = bytes.Clone(key), bytes.Clone(value)
+	if expiresAt == 0 {
+		return tx.put(key, value)
+	}
+
+	return tx.putExpiring(key, value, expiresAt)
+}
+
+// restoreDelete
+//
+//	Delete a key that did not exist in a retained version.
+func (tx *Tx) restoreDelete(key []byte) error {
+	if tx.store.isKeyLocked(key) {
+		return ErrKeyLocked
+	}
+
+	return tx.delete(bytes.Clone(key))
+}
+
+// rangeExpires
+//
+//	Get the expiration time of every key written with a ttl as of a root, keyed by the key.
+func (mariInst *Mari) rangeExpires(root *unsafe.Pointer, maxVersion uint64) (map[string]uint64, error) {
+	kvPairs, rangeErr := mariInst.rangeRecursive(root, 0, maxVersion, expiresKeyPrefix, bucketEndKey(expiresKeyPrefix), 0)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	expires := make(map[string]uint64, len(kvPairs))
+	for _, kvPair := range kvPairs {
+		expiresAt, decodeErr := deserializeUint64(kvPair.Value)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+
+		expires[string(kvPair.Key[len(expiresKeyPrefix):])] = expiresAt
+	}
+
+	return expires, nil
+}
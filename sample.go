@@ -0,0 +1,82 @@
+package mariv2
+
+import (
+	"math/rand/v2"
+	"unsafe"
+)
+
+//============================================= Mari Sample
+
+// Sample
+//
+//	Get up to n distinct random key-value pairs, useful for cache warming, consistency spot checks, and analytics.
+//	Each pair is found by descending the trie from the root, selecting uniformly at each node between the leaf and the children in the bitmap.
+//	The selection is approximately uniform, favoring keys in sparse subtrees, and does not require a scan of the trie.
+//	If the trie holds fewer than n keys, fewer pairs may be returned.
+//	Keys under ReservedKeyPrefix are not sampled, and the transforms registered with the instance are applied to each sampled pair.
+func (tx *Tx) Sample(n int) (_ []*KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("Sample", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	var kvPairs []*KeyValuePair
+	seen := make(map[string]bool)
+
+	for attempt := 0; attempt < n*DefaultSampleAttempts && len(kvPairs) < n; attempt++ {
+		kvPair, sampleErr := tx.store.sampleRecursive(tx.root)
+		if sampleErr != nil {
+			return nil, sampleErr
+		}
+
+		if kvPair == nil || isReservedKey(kvPair.Key) || seen[string(kvPair.Key)] {
+			continue
+		}
+
+		seen[string(kvPair.Key)] = true
+		kvPair, sampleErr = tx.store.thaw(kvPair)
+		if sampleErr != nil {
+			return nil, sampleErr
+		}
+
+		kvPair = tx.store.transform(kvPair)
+		if kvPair != nil {
+			kvPairs = append(kvPairs, kvPair)
+		}
+	}
+
+	return kvPairs, nil
+}
+
+// sampleRecursive
+//
+//	Select the leaf or one of the children of the current node at random, recursing into the selected child.
+//	If the node has no leaf or children, nil is returned.
+func (mariInst *Mari) sampleRecursive(node *unsafe.Pointer) (*KeyValuePair, error) {
+	currNode := loadINodeFromPointer(node)
+
+	hasLeaf := len(currNode.leaf.key) > 0
+	totalCandidates := len(currNode.children)
+	if hasLeaf {
+		totalCandidates++
+	}
+
+	if totalCandidates == 0 {
+		return nil, nil
+	}
+
+	selected := rand.IntN(totalCandidates)
+	if hasLeaf && selected == totalCandidates-1 {
+		leaf := currNode.leaf
+		return &KeyValuePair{Version: leaf.version, Timestamp: leaf.timestamp, Key: leaf.key, Value: leaf.value}, nil
+	}
+
+	childNode, sampleErr := mariInst.getChildNode(currNode, selected)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	return mariInst.sampleRecursive(storeINodeAsPointer(childNode))
+}
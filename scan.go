@@ -0,0 +1,75 @@
+package mariv2
+
+import (
+	"context"
+)
+
+//============================================= Mari Scan
+
+// scanChunks
+//
+//	Collect the key-value pairs from the start key up to the end key, and up to the total results if positive, in chunks appended to one slice of results.
+//	Each chunk descends from the root starting after the last key of the previous chunk, so a large scan does not build the results of every subtree before merging them, and can be canceled between chunks.
+//	The first chunk is InitialScanChunkSize results and each chunk after doubles, up to the chunk size in the options, so small scans do not read past the keys they need and large scans rarely descend from the root.
+//	The context in the options is checked before each chunk, returning its error once it is done.
+//	With an arena, the results are allocated from it as they are collected, instead of pointing into the memory map.
+//	With shed, the results collected are held against the soft memory limit and checked against ShedScansOver after each chunk, so a scan under memory pressure, including the pressure of its own results, stops with ErrMemoryPressure before collecting the rest.
+func (tx *Tx) scanChunks(minVersion uint64, startKey, endKey []byte, totalResults int, opts *RangeOpts, arena *scanArena, shed bool) ([]*KeyValuePair, error) {
+	maxChunk := DefaultScanChunkSize
+	if opts != nil && opts.ChunkSize != nil && *opts.ChunkSize > 0 {
+		maxChunk = *opts.ChunkSize
+	}
+
+	var ctx context.Context
+	if opts != nil {
+		ctx = opts.Context
+	}
+
+	var held int64
+	if shed {
+		defer func() { tx.store.releasePairs(held) }()
+	}
+
+	chunkSize := min(InitialScanChunkSize, maxChunk)
+	kvPairs := []*KeyValuePair{}
+	for {
+		if ctx != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		limit := chunkSize
+		if totalResults > 0 {
+			limit = min(limit, totalResults-len(kvPairs))
+		}
+
+		prevTotal := len(kvPairs)
+
+		var scanErr error
+		kvPairs, scanErr = tx.store.iterateRecursive(tx.root, minVersion, tx.snapshotVersion, startKey, endKey, prevTotal+limit, 0, arena, kvPairs)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+
+		if shed {
+			held += tx.store.holdPairs(kvPairs[prevTotal:])
+			scanErr = tx.store.shedScan(len(kvPairs))
+			if scanErr != nil {
+				return nil, scanErr
+			}
+		}
+
+		if len(kvPairs)-prevTotal < limit || (totalResults > 0 && len(kvPairs) >= totalResults) {
+			return kvPairs, nil
+		}
+
+		startKey = nextKey(kvPairs[len(kvPairs)-1].Key)
+		chunkSize = min(chunkSize*2, maxChunk)
+	}
+}
+
+// nextKey
+//
+//	Get the smallest key greater than a key, which is the key followed by a null byte, without writing to the backing array of the key.
+func nextKey(key []byte) []byte {
+	return append(key[:len(key):len(key)], 0)
+}
@@ -9,7 +9,7 @@ import (
 
 // serializeMetaData
 //
-//	Serialize the metadata at the first 0-23 bytes of the memory map. version is 8 bytes and Root Offset is 8 bytes.
+//	Serialize the metadata at the first 0-63 bytes of the memory map. Every field is 8 bytes, and the remaining bytes are reserved.
 func (meta *MetaData) serializeMetaData() []byte {
 	versionBytes := make([]byte, OffsetSize64)
 	binary.LittleEndian.PutUint64(versionBytes, meta.version)
@@ -21,14 +21,24 @@ func (meta *MetaData) serializeMetaData() []byte {
 	binary.LittleEndian.PutUint64(nextStartOffsetBytes, meta.nextStartOffset)
 
 	offsets := append(rootOffsetBytes, nextStartOffsetBytes...)
-	return append(versionBytes, offsets...)
+	sMeta := append(versionBytes, offsets...)
+	sMeta = append(sMeta, serializeUint64(meta.formatVersion)...)
+	sMeta = append(sMeta, serializeUint64(meta.timestamp)...)
+	sMeta = append(sMeta, serializeUint64(meta.historyStartOffset)...)
+	sMeta = append(sMeta, serializeUint64(meta.keyNormalizer)...)
+
+	return append(sMeta, make([]byte, MetaSize-len(sMeta))...)
 }
 
 // deserializeINode
 //
 //	Deserialize the byte representation of an internal in the memory mapped file.
+//	The subtree count is only present if the serialized node is 8 bytes longer than the children require, so nodes written with and without counts can both be read.
 func deserializeINode(snode []byte) (*INode, error) {
 	var deserializeErr error
+	if len(snode) < NodeChildrenIdx {
+		return nil, errors.New("internal node is shorter than its header")
+	}
 
 	version, deserializeErr := deserializeUint64(snode[NodeVersionIdx:NodeStartOffsetIdx])
 	if deserializeErr != nil {
@@ -59,13 +69,25 @@ func deserializeINode(snode []byte) (*INode, error) {
 		return nil, deserializeErr
 	}
 
-	var totalChildren int
-	for _, subBitmap := range bitmaps {
-		totalChildren += calculateHammingWeight(subBitmap)
+	totalChildren := populationCount(bitmaps)
+
+	var count uint64
+	currOffset := NodeChildrenIdx
+	switch len(snode) {
+	case NodeChildrenIdx + (totalChildren * NodeChildPtrSize):
+		// written without a subtree count
+	case NodeChildrenIdx + OffsetSize64 + (totalChildren * NodeChildPtrSize):
+		count, deserializeErr = deserializeUint64(snode[NodeCountIdx : NodeCountIdx+OffsetSize64])
+		if deserializeErr != nil {
+			return nil, deserializeErr
+		}
+
+		currOffset += OffsetSize64
+	default:
+		return nil, errors.New("internal node length does not match the children in its bitmap")
 	}
 
 	var children []*INode
-	currOffset := NodeChildrenIdx
 	for range make([]int, totalChildren) {
 		offset, deserializeErr := deserializeUint64(snode[currOffset : currOffset+OffsetSize64])
 		if deserializeErr != nil {
@@ -84,14 +106,25 @@ func deserializeINode(snode []byte) (*INode, error) {
 		bitmap:      bitmaps,
 		leaf:        &LNode{startOffset: leafOffset},
 		children:    children,
+		count:       count,
 	}, nil
 }
 
 // deserializeLNode
 //
 //	Deserialize the byte representation of a leaf node in the memory mapped file.
-func deserializeLNode(snode []byte) (*LNode, error) {
+//	The key and value are capped at their length, so appending to a returned value copies it instead of writing into the memory map.
+//	If withChecksum is true, the last bytes of the node are the checksum of the value.
+func deserializeLNode(snode []byte, withChecksum bool) (*LNode, error) {
 	var deserializeErr error
+	if len(snode) < NodeKeyIdx {
+		return nil, errors.New("leaf node is shorter than its header")
+	}
+
+	valueEnd := len(snode)
+	if withChecksum {
+		valueEnd -= NodeChecksumSize
+	}
 
 	version, deserializeErr := deserializeUint64(snode[NodeVersionIdx:NodeStartOffsetIdx])
 	if deserializeErr != nil {
@@ -103,27 +136,48 @@ func deserializeLNode(snode []byte) (*LNode, error) {
 		return nil, deserializeErr
 	}
 
-	endOffset, deserializeErr := deserializeUint16(snode[NodeEndOffsetIdx:NodeKeyLength])
+	endOffset, deserializeErr := deserializeUint16(snode[NodeEndOffsetIdx:NodeTimestampIdx])
+	if deserializeErr != nil {
+		return nil, deserializeErr
+	}
+
+	timestamp, deserializeErr := deserializeUint64(snode[NodeTimestampIdx:NodeKeyLength])
 	if deserializeErr != nil {
 		return nil, deserializeErr
 	}
 
 	keyLength := uint8(snode[NodeKeyLength])
+	if NodeKeyIdx+int(keyLength) > valueEnd {
+		return nil, errors.New("leaf node key length extends past the end of the node")
+	}
+
+	var checksum uint32
+	if withChecksum {
+		checksum, deserializeErr = deserializeUint32(snode[valueEnd:])
+		if deserializeErr != nil {
+			return nil, deserializeErr
+		}
+	}
+
 	return &LNode{
 		version:     version,
 		startOffset: startOffset,
 		endOffset:   endOffset,
+		timestamp:   timestamp,
 		keyLength:   keyLength,
-		key:         snode[NodeKeyIdx : NodeKeyIdx+keyLength],
-		value:       snode[NodeKeyIdx+keyLength:],
+		key:         snode[NodeKeyIdx : NodeKeyIdx+int(keyLength) : NodeKeyIdx+int(keyLength)],
+		value:       snode[NodeKeyIdx+int(keyLength) : valueEnd : valueEnd],
+		checksum:    checksum,
+		checksummed: withChecksum,
 	}, nil
 }
 
 // serializePathToMemMap
 //
 //	Serializes a path copy by starting at the root, getting the latest available offset in the memory map, and recursively serializing.
-func (mariInst *Mari) serializePathToMemMap(root *INode, nextOffsetInMMap uint64) ([]byte, error) {
-	serializedPath, serializeErr := mariInst.serializeRecursive(root, 0, nextOffsetInMMap)
+//	Leaves written in the path copy are stamped with the commit timestamp.
+func (mariInst *Mari) serializePathToMemMap(root *INode, nextOffsetInMMap, timestamp uint64) ([]byte, error) {
+	serializedPath, serializeErr := mariInst.serializeRecursive(root, 0, nextOffsetInMMap, timestamp)
 	if serializeErr != nil {
 		return nil, serializeErr
 	}
@@ -136,15 +190,20 @@ func (mariInst *Mari) serializePathToMemMap(root *INode, nextOffsetInMMap uint64
 //	Traverses the path copy down to the end of the path.
 //	If the node is a leaf, serialize it and return. If the node is a internal node, serialize each of the children recursively if
 //	the version matches the version of the root. If it is an older version, just serialize the existing offset in the memory map.
-func (mariInst *Mari) serializeRecursive(node *INode, level int, offset uint64) ([]byte, error) {
+//	New leaves do not have a timestamp yet, so they are stamped with the commit timestamp. The root leaf is always stamped, so it records when the version was committed.
+func (mariInst *Mari) serializeRecursive(node *INode, level int, offset, timestamp uint64) ([]byte, error) {
 	var serializeErr error
 	node.startOffset = offset
-	sNode, serializeErr := node.serializeINode(true)
+	if level == 0 || node.leaf.timestamp == 0 {
+		node.leaf.timestamp = timestamp
+	}
+
+	sNode, serializeErr := node.serializeINode(true, mariInst.subtreeCounts)
 	if serializeErr != nil {
 		return nil, serializeErr
 	}
 
-	serializedKeyVal, serializeErr := node.leaf.serializeLNode()
+	serializedKeyVal, serializeErr := node.leaf.serializeLNode(mariInst.valueChecksums)
 	if serializeErr != nil {
 		return nil, serializeErr
 	}
@@ -156,7 +215,7 @@ func (mariInst *Mari) serializeRecursive(node *INode, level int, offset uint64)
 			sNode = append(sNode, serializeUint64(child.startOffset)...)
 		} else {
 			sNode = append(sNode, serializeUint64(nextStartOffset)...)
-			childrenOnPath, serializeErr := mariInst.serializeRecursive(child, level+1, nextStartOffset)
+			childrenOnPath, serializeErr := mariInst.serializeRecursive(child, level+1, nextStartOffset, timestamp)
 			if serializeErr != nil {
 				return nil, serializeErr
 			}
@@ -179,32 +238,45 @@ func (mariInst *Mari) serializeRecursive(node *INode, level int, offset uint64)
 // serializeLNode
 //
 //	Serialize a leaf node in the mariInst. Append the key and value together since both are already byte slices.
-func (node *LNode) serializeLNode() ([]byte, error) {
+//	If withChecksum is true, the checksum of the value is appended. A checksum read with the leaf is kept, otherwise it is computed from the value.
+func (node *LNode) serializeLNode(withChecksum bool) ([]byte, error) {
 	var sLNode []byte
 
-	node.endOffset = node.determineEndOffsetLNode()
+	node.endOffset = node.determineEndOffsetLNode(withChecksum)
 	sVersion := serializeUint64(node.version)
 	sStartOffset := serializeUint64(node.startOffset)
 	sEndOffset := serializeUint16(node.endOffset)
+	sTimestamp := serializeUint64(node.timestamp)
 	sKeyLength := byte(node.keyLength)
 
 	sLNode = append(sLNode, sVersion...)
 	sLNode = append(sLNode, sStartOffset...)
 	sLNode = append(sLNode, sEndOffset...)
+	sLNode = append(sLNode, sTimestamp...)
 	sLNode = append(sLNode, sKeyLength)
 	sLNode = append(sLNode, node.key...)
 	sLNode = append(sLNode, node.value...)
 
+	if withChecksum {
+		if !node.checksummed {
+			node.checksum = checksumValue(node.value)
+			node.checksummed = true
+		}
+
+		sLNode = append(sLNode, serializeUint32(node.checksum)...)
+	}
+
 	return sLNode, nil
 }
 
 // serializeINode
 //
 //	Serialize an internal node in the mariInst. This involves scanning the children nodes and serializing the offset in the memory map for each one.
-func (node *INode) serializeINode(serializePath bool) ([]byte, error) {
+//	If withCount is true, the subtree count is serialized between the leaf offset and the children.
+func (node *INode) serializeINode(serializePath, withCount bool) ([]byte, error) {
 	var sINode []byte
 
-	node.endOffset = node.determineEndOffsetINode()
+	node.endOffset = node.determineEndOffsetINode(withCount)
 	node.leaf.startOffset = node.getEndOffsetINode() + 1
 
 	sVersion := serializeUint64(node.version)
@@ -224,6 +296,10 @@ func (node *INode) serializeINode(serializePath bool) ([]byte, error) {
 	sINode = append(sINode, sBitmap...)
 	sINode = append(sINode, sLeafOffset...)
 
+	if withCount {
+		sINode = append(sINode, serializeUint64(node.count)...)
+	}
+
 	if !serializePath {
 		for _, cnode := range node.children {
 			snode := serializeUint64(cnode.startOffset)
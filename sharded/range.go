@@ -0,0 +1,75 @@
+package sharded
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Sharded Range
+
+// Iterate
+//
+//	Perform an ordered iteration across all shards, starting at the start key up to the total number of results.
+//	Each shard is read in its own read transaction, so the iteration is NOT atomic across shards.
+//	A write committed to one shard during the iteration may be observed while a write to another shard committed earlier is not.
+func (shardedInst *Sharded) Iterate(startKey []byte, totalResults int, opts *mariv2.RangeOpts) ([]*mariv2.KeyValuePair, error) {
+	var kvPairs []*mariv2.KeyValuePair
+	for _, shard := range shardedInst.shards {
+		iterErr := shard.ReadTx(func(tx *mariv2.Tx) error {
+			shardKvPairs, iterTxErr := tx.Iterate(startKey, totalResults, opts)
+			if iterTxErr != nil {
+				return iterTxErr
+			}
+
+			kvPairs = append(kvPairs, shardKvPairs...)
+			return nil
+		})
+
+		if iterErr != nil {
+			return nil, iterErr
+		}
+	}
+
+	sortKeyValuePairs(kvPairs)
+	if len(kvPairs) > totalResults {
+		kvPairs = kvPairs[:totalResults]
+	}
+	return kvPairs, nil
+}
+
+// Range
+//
+//	Perform a range operation across all shards, returning the merged and sorted results.
+//	Like Iterate, each shard is read in its own read transaction, so the range is NOT atomic across shards.
+func (shardedInst *Sharded) Range(startKey, endKey []byte, opts *mariv2.RangeOpts) ([]*mariv2.KeyValuePair, error) {
+	var kvPairs []*mariv2.KeyValuePair
+	for _, shard := range shardedInst.shards {
+		rangeErr := shard.ReadTx(func(tx *mariv2.Tx) error {
+			shardKvPairs, rangeTxErr := tx.Range(startKey, endKey, opts)
+			if rangeTxErr != nil {
+				return rangeTxErr
+			}
+
+			kvPairs = append(kvPairs, shardKvPairs...)
+			return nil
+		})
+
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
+	}
+
+	sortKeyValuePairs(kvPairs)
+	return kvPairs, nil
+}
+
+// sortKeyValuePairs
+//
+//	Keys are unique across shards, so the merged results only need to be sorted by key.
+func sortKeyValuePairs(kvPairs []*mariv2.KeyValuePair) {
+	sort.Slice(kvPairs, func(i, j int) bool {
+		return bytes.Compare(kvPairs[i].Key, kvPairs[j].Key) == -1
+	})
+}
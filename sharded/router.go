@@ -0,0 +1,37 @@
+package sharded
+
+import "hash/fnv"
+
+//============================================= Sharded Router
+
+// ShardFor
+//
+//	Determine the shard index that owns a key.
+//	The key is hashed with 64 bit FNV-1a and then mapped to a shard using jump consistent hashing.
+//	The mapping only depends on the key and the shard count, so it is stable across opens.
+//	If the shards normalize keys, the key is normalized before it is hashed, so keys that normalize to the same bytes are owned by the same shard.
+func (shardedInst *Sharded) ShardFor(key []byte) int {
+	if shardedInst.keyNormalizer != nil {
+		key = shardedInst.keyNormalizer.Normalize(key)
+	}
+
+	hasher := fnv.New64a()
+	hasher.Write(key)
+
+	return int(jumpHash(hasher.Sum64(), len(shardedInst.shards)))
+}
+
+// jumpHash
+//
+//	Jump consistent hash (Lamping and Veach), mapping a 64 bit key to a bucket in [0, numBuckets).
+//	When the number of buckets grows from n to n+1, only 1/(n+1) of the keys move to the new bucket.
+func jumpHash(key uint64, numBuckets int) int32 {
+	var bucket, next int64 = -1, 0
+	for next < int64(numBuckets) {
+		bucket = next
+		key = key*2862933555777941757 + 1
+		next = int64(float64(bucket+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int32(bucket)
+}
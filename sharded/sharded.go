@@ -0,0 +1,229 @@
+package sharded
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Sharded Mari
+
+// Open
+//
+//	Open each shard of a sharded Mari instance.
+//	Shards are stored as separate files, so each shard has its own root and writes to separate shards never contend with each other.
+//	If some, but not all, of the shard files already exist, the shard count has changed and opening fails since keys would be routed to the wrong shard.
+func Open(opts InitOpts) (*Sharded, error) {
+	if opts.Shards <= 0 {
+		return nil, errors.New("shard count must be greater than 0")
+	}
+
+	var openErr error
+	openErr = checkShardFiles(opts)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	shardedInst := &Sharded{
+		shards:     make([]*mariv2.Mari, opts.Shards),
+		writeLocks: make([]sync.Mutex, opts.Shards),
+	}
+
+	if opts.ShardOpts != nil {
+		shardedInst.keyNormalizer = opts.ShardOpts.KeyNormalizer
+	}
+
+	for idx := range shardedInst.shards {
+		var shardOpts mariv2.InitOpts
+		if opts.ShardOpts != nil {
+			shardOpts = *opts.ShardOpts
+		}
+
+		shardOpts.Filepath = opts.Filepath
+		shardOpts.FileName = shardFileName(opts.FileName, idx)
+
+		shardedInst.shards[idx], openErr = mariv2.Open(shardOpts)
+		if openErr != nil {
+			shardedInst.closeShards(idx)
+			return nil, openErr
+		}
+	}
+
+	return shardedInst, nil
+}
+
+// Close
+//
+//	Close every shard. All shards are attempted, and the first error encountered is returned.
+func (shardedInst *Sharded) Close() error {
+	return shardedInst.closeShards(len(shardedInst.shards))
+}
+
+// Remove
+//
+//	Close every shard and remove the shard files.
+func (shardedInst *Sharded) Remove() error {
+	var removeErr error
+	for _, shard := range shardedInst.shards {
+		shardErr := shard.Remove()
+		if shardErr != nil && removeErr == nil {
+			removeErr = shardErr
+		}
+	}
+
+	return removeErr
+}
+
+// Shard
+//
+//	Get the underlying Mari instance for a shard index.
+func (shardedInst *Sharded) Shard(idx int) *mariv2.Mari {
+	return shardedInst.shards[idx]
+}
+
+// ShardCount
+//
+//	The total number of shards.
+func (shardedInst *Sharded) ShardCount() int {
+	return len(shardedInst.shards)
+}
+
+// ReadTx
+//
+//	Perform a read only transaction on the shard that owns the key.
+//	Every key accessed in the transaction must be owned by the same shard.
+func (shardedInst *Sharded) ReadTx(key []byte, txOps func(tx *mariv2.Tx) error) error {
+	return shardedInst.shards[shardedInst.ShardFor(key)].ReadTx(txOps)
+}
+
+// UpdateTx
+//
+//	Perform a read-write transaction on the shard that owns the key.
+//	Writers on the same shard are serialized by the shard lock, so only writers on different shards run in parallel.
+//	Every key accessed in the transaction must be owned by the same shard.
+func (shardedInst *Sharded) UpdateTx(key []byte, txOps func(tx *mariv2.Tx) error) error {
+	idx := shardedInst.ShardFor(key)
+
+	shardedInst.writeLocks[idx].Lock()
+	defer shardedInst.writeLocks[idx].Unlock()
+
+	return shardedInst.shards[idx].UpdateTx(txOps)
+}
+
+// Put
+//
+//	Put a single key-value pair in the owning shard.
+func (shardedInst *Sharded) Put(key, value []byte) error {
+	return shardedInst.UpdateTx(key, func(tx *mariv2.Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// Get
+//
+//	Get a single key-value pair from the owning shard.
+func (shardedInst *Sharded) Get(key []byte, transform *mariv2.Transform) (*mariv2.KeyValuePair, error) {
+	var kvPair *mariv2.KeyValuePair
+	getErr := shardedInst.ReadTx(key, func(tx *mariv2.Tx) error {
+		var getTxErr error
+		kvPair, getTxErr = tx.Get(key, transform)
+		return getTxErr
+	})
+
+	if getErr != nil {
+		return nil, getErr
+	}
+	return kvPair, nil
+}
+
+// Delete
+//
+//	Delete a single key-value pair from the owning shard.
+func (shardedInst *Sharded) Delete(key []byte) error {
+	return shardedInst.UpdateTx(key, func(tx *mariv2.Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// Stats
+//
+//	Collect the stats for every shard and aggregate the totals.
+func (shardedInst *Sharded) Stats() (*Stats, error) {
+	stats := &Stats{Shards: make([]*mariv2.Stats, len(shardedInst.shards))}
+	for idx, shard := range shardedInst.shards {
+		shardStats, statsErr := shard.Stats()
+		if statsErr != nil {
+			return nil, statsErr
+		}
+
+		stats.Shards[idx] = shardStats
+		stats.TotalVersion += shardStats.Version
+		stats.TotalSerializedBytes += shardStats.NextStartOffset
+		stats.TotalFileSize += shardStats.FileSize
+	}
+
+	return stats, nil
+}
+
+// checkShardFiles
+//
+//	Verify that either none or all of the shard files exist, and that there are no shards beyond the shard count.
+func checkShardFiles(opts InitOpts) error {
+	exists := func(idx int) (bool, error) {
+		_, statErr := os.Stat(filepath.Join(opts.Filepath, shardFileName(opts.FileName, idx)))
+		switch {
+		case statErr == nil:
+			return true, nil
+		case os.IsNotExist(statErr):
+			return false, nil
+		default:
+			return false, statErr
+		}
+	}
+
+	var totalExisting int
+	for idx := range make([]int, opts.Shards+1) {
+		shardExists, statErr := exists(idx)
+		if statErr != nil {
+			return statErr
+		}
+
+		if shardExists {
+			if idx == opts.Shards {
+				return fmt.Errorf("shard file %d exists beyond the shard count of %d", idx, opts.Shards)
+			}
+			totalExisting++
+		}
+	}
+
+	if totalExisting > 0 && totalExisting != opts.Shards {
+		return fmt.Errorf("found %d of %d shard files, the shard count does not match the existing files", totalExisting, opts.Shards)
+	}
+	return nil
+}
+
+// closeShards
+//
+//	Close the first total shards, returning the first error encountered.
+func (shardedInst *Sharded) closeShards(total int) error {
+	var closeErr error
+	for _, shard := range shardedInst.shards[:total] {
+		shardErr := shard.Close()
+		if shardErr != nil && closeErr == nil {
+			closeErr = shardErr
+		}
+	}
+
+	return closeErr
+}
+
+// shardFileName
+//
+//	The file name for a shard index.
+func shardFileName(fileName string, idx int) string {
+	return fmt.Sprintf("%s-%d", fileName, idx)
+}
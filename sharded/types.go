@@ -0,0 +1,41 @@
+package sharded
+
+import (
+	"sync"
+
+	"github.com/sirgallo/mariv2"
+)
+
+// InitOpts initialize a Sharded instance
+type InitOpts struct {
+	// Filepath: the path to the directory containing the shard files
+	Filepath string
+	// FileName: the base name for the shard files. Each shard is stored in <FileName>-<shard index>
+	FileName string
+	// Shards: the total number of shards. This must remain the same across opens of the same set of files
+	Shards int
+	// ShardOpts: optional base options applied to every shard. Filepath and FileName are always overridden
+	ShardOpts *mariv2.InitOpts
+}
+
+// Sharded manages multiple Mari instances, routing keys to a single owning shard
+type Sharded struct {
+	// shards: the underlying Mari instances, indexed by shard
+	shards []*mariv2.Mari
+	// writeLocks: per shard locks that serialize writers on a shard so they do not contend on the root compare and swap
+	writeLocks []sync.Mutex
+	// keyNormalizer: the key normalizer of the shards, applied to keys before they are routed so keys that normalize to the same bytes are owned by the same shard
+	keyNormalizer mariv2.KeyNormalizer
+}
+
+// Stats contains the aggregated stats for all shards
+type Stats struct {
+	// Shards: the stats for each individual shard, indexed by shard
+	Shards []*mariv2.Stats
+	// TotalVersion: the sum of the versions for all shards, which is the total number of commits since the last compaction of each shard
+	TotalVersion uint64
+	// TotalSerializedBytes: the sum of the serialized bytes in all shards
+	TotalSerializedBytes uint64
+	// TotalFileSize: the sum of the file sizes for all shards
+	TotalFileSize int
+}
@@ -0,0 +1,228 @@
+package mariv2
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+//============================================= Mari Space
+
+// SpaceReport
+//
+//	Walk every node reachable from the root of the latest version and compare the live bytes against the serialized data.
+//	Serialized nodes that are not reachable from the root belong to older versions, and are dead until compaction reclaims them.
+//	The serialized data is split into regions of DefaultSpaceRegionSize, with the live and dead bytes of each region, so fragmentation can be located.
+//	The root is loaded before the end of the serialized data, so a concurrent commit is reported as dead bytes.
+func (mariInst *Mari) SpaceReport() (*SpaceReport, error) {
+	var spaceErr error
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("SpaceReport"); stateErr != nil {
+		return nil, stateErr
+	}
+
+	_, rootOffset, spaceErr := mariInst.loadMetaRootOffset()
+	if spaceErr != nil {
+		return nil, spaceErr
+	}
+
+	root, spaceErr := mariInst.readINodeFromMemMap(rootOffset)
+	if spaceErr != nil {
+		return nil, spaceErr
+	}
+
+	_, endSerialized, spaceErr := mariInst.loadMetaEndSerialized()
+	if spaceErr != nil {
+		return nil, spaceErr
+	}
+
+	fileSize := uint64(len(mariInst.data.Load().(MMap)))
+	report := &SpaceReport{
+		Version:         root.version,
+		FileSize:        fileSize,
+		SerializedBytes: endSerialized,
+		MetaBytes:       MetaSize,
+	}
+
+	if fileSize > endSerialized {
+		report.FreeBytes = fileSize - endSerialized
+	}
+
+	for offset := uint64(0); offset < endSerialized; offset += DefaultSpaceRegionSize {
+		region := SpaceRegion{Offset: offset, Length: min(DefaultSpaceRegionSize, endSerialized-offset)}
+		if offset < MetaSize {
+			region.Length -= min(region.Length, MetaSize-offset)
+		}
+
+		report.Regions = append(report.Regions, region)
+	}
+
+	spaceErr = mariInst.spaceRecursive(storeINodeAsPointer(root), report)
+	if spaceErr != nil {
+		return nil, spaceErr
+	}
+
+	for idx := range report.Regions {
+		region := &report.Regions[idx]
+		region.DeadBytes = region.Length - min(region.Length, region.LiveBytes)
+		region.Fragmentation = fraction(region.DeadBytes, region.Length)
+		report.DeadBytes += region.DeadBytes
+	}
+
+	report.Fragmentation = fraction(report.DeadBytes, report.LiveBytes+report.DeadBytes)
+	return report, nil
+}
+
+// spaceRecursive
+//
+//	Add the internal node and its leaf to the live bytes of the report, then recurse into each child.
+func (mariInst *Mari) spaceRecursive(node *unsafe.Pointer, report *SpaceReport) error {
+	currNode := loadINodeFromPointer(node)
+
+	report.addLive(currNode.startOffset, uint64(currNode.endOffset)+1)
+	report.addLive(currNode.leaf.startOffset, uint64(currNode.leaf.endOffset)+1)
+
+	for pos := range currNode.children {
+		childNode, spaceErr := mariInst.getChildNode(currNode, pos)
+		if spaceErr != nil {
+			return spaceErr
+		}
+
+		spaceErr = mariInst.spaceRecursive(storeINodeAsPointer(childNode), report)
+		if spaceErr != nil {
+			return spaceErr
+		}
+	}
+
+	return nil
+}
+
+// addLive
+//
+//	Add a live node to the report, splitting its bytes across the regions it spans.
+func (report *SpaceReport) addLive(offset, length uint64) {
+	report.LiveNodes++
+	report.LiveBytes += length
+
+	for length > 0 {
+		idx := offset / DefaultSpaceRegionSize
+		if idx >= uint64(len(report.Regions)) {
+			return
+		}
+
+		inRegion := min(length, (idx+1)*DefaultSpaceRegionSize-offset)
+		report.Regions[idx].LiveBytes += inRegion
+
+		offset += inRegion
+		length -= inRegion
+	}
+}
+
+// fraction
+//
+//	Get the fraction of a total, which is 0 if the total is 0.
+func fraction(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(part) / float64(total)
+}
+
+// EstimateCompaction
+//
+//	Estimate the bytes compaction would reclaim and how long it would take to read the live nodes, without copying the latest version.
+//	Up to CompactionEstimateSubtrees of the subtrees below the root are chosen at random and walked, and the live bytes and read time are scaled by the keys in all subtrees over the keys in the walked subtrees.
+//	If the file does not have subtree counts, or the root has no more subtrees than are sampled, every node is walked and the estimate is exact.
+//	The estimate holds the resize lock for reading, so it blocks compaction and resizing while it walks the sampled subtrees.
+func (mariInst *Mari) EstimateCompaction() (*CompactionEstimate, error) {
+	var estimateErr error
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("EstimateCompaction"); stateErr != nil {
+		return nil, stateErr
+	}
+
+	_, rootOffset, estimateErr := mariInst.loadMetaRootOffset()
+	if estimateErr != nil {
+		return nil, estimateErr
+	}
+
+	root, estimateErr := mariInst.readINodeFromMemMap(rootOffset)
+	if estimateErr != nil {
+		return nil, estimateErr
+	}
+
+	_, endSerialized, estimateErr := mariInst.loadMetaEndSerialized()
+	if estimateErr != nil {
+		return nil, estimateErr
+	}
+
+	start := time.Now()
+	rootReport := &SpaceReport{}
+	rootReport.addLive(root.startOffset, uint64(root.endOffset)+1)
+	rootReport.addLive(root.leaf.startOffset, uint64(root.leaf.endOffset)+1)
+
+	positions := rand.Perm(len(root.children))
+	sampled := len(positions) <= CompactionEstimateSubtrees || !mariInst.subtreeCounts
+	if !sampled {
+		positions = positions[:CompactionEstimateSubtrees]
+	}
+
+	sampledReport := &SpaceReport{}
+	var sampledKeys uint64
+	for _, pos := range positions {
+		childNode, estimateErr := mariInst.getChildNode(root, pos)
+		if estimateErr != nil {
+			return nil, estimateErr
+		}
+
+		sampledKeys += childNode.count
+		estimateErr = mariInst.spaceRecursive(storeINodeAsPointer(childNode), sampledReport)
+		if estimateErr != nil {
+			return nil, estimateErr
+		}
+	}
+
+	scale := 1.0
+	if !sampled && sampledKeys > 0 {
+		totalKeys := root.count
+		if len(root.leaf.key) > 0 {
+			totalKeys--
+		}
+
+		scale = float64(totalKeys) / float64(sampledKeys)
+	}
+
+	estimate := &CompactionEstimate{
+		Version:         root.version,
+		SerializedBytes: endSerialized,
+		LiveBytes:       rootReport.LiveBytes + uint64(float64(sampledReport.LiveBytes)*scale),
+		LiveNodes:       rootReport.LiveNodes + uint64(float64(sampledReport.LiveNodes)*scale),
+		Duration:        time.Duration(float64(time.Since(start)) * scale),
+		SampledFraction: fraction(uint64(len(positions)), uint64(len(root.children))),
+	}
+
+	if len(root.children) == 0 {
+		estimate.SampledFraction = 1
+	}
+
+	if endSerialized > MetaSize+estimate.LiveBytes {
+		estimate.ReclaimedBytes = endSerialized - MetaSize - estimate.LiveBytes
+	}
+
+	return estimate, nil
+}
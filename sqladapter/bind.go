@@ -0,0 +1,238 @@
+package sqladapter
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Mari SQL Bind
+
+// boundCondition is a condition with its operands resolved to keys, for the key column, or to numbers, for the version and timestamp
+type boundCondition struct {
+	// column: the name of the compared column
+	column string
+	// op: the comparison
+	op string
+	// keys: the operands of a condition on the key, where the operand of like is the prefix without the wildcard
+	keys [][]byte
+	// numbers: the operands of a condition on the version or timestamp
+	numbers []uint64
+}
+
+// bind
+//
+//	Resolve the operands of every condition, taking placeholders from the arguments.
+//	Keys can be bound as []byte or string, and versions and timestamps as non-negative integers.
+func (parsed *query) bind(args []driver.NamedValue) ([]*boundCondition, error) {
+	if len(args) != parsed.placeholders {
+		return nil, fmt.Errorf("%w: expected %d arguments, got %d", ErrArgument, parsed.placeholders, len(args))
+	}
+
+	bound := make([]*boundCondition, len(parsed.conditions))
+	for idx, parsedCondition := range parsed.conditions {
+		curr := &boundCondition{column: columns[parsedCondition.column], op: parsedCondition.op}
+		for _, parsedOperand := range parsedCondition.operands {
+			value := parsedOperand.literal
+			if parsedOperand.placeholder >= 0 {
+				value = args[parsedOperand.placeholder].Value
+			}
+
+			switch curr.column {
+			case ColumnKey:
+				key, keyErr := bindKey(value, curr.op)
+				if keyErr != nil {
+					return nil, keyErr
+				}
+
+				curr.keys = append(curr.keys, key)
+			default:
+				number, ok := value.(int64)
+				if !ok || number < 0 {
+					return nil, fmt.Errorf("%w: %s must be a non-negative integer, got %v", ErrArgument, curr.column, value)
+				}
+
+				curr.numbers = append(curr.numbers, uint64(number))
+			}
+		}
+
+		bound[idx] = curr
+	}
+
+	return bound, nil
+}
+
+// bindKey
+//
+//	Convert an operand of the key to bytes. The operand of like must be a prefix followed by a single % wildcard, which is removed.
+func bindKey(value any, op string) ([]byte, error) {
+	var key []byte
+	switch typed := value.(type) {
+	case []byte:
+		key = bytes.Clone(typed)
+	case string:
+		key = []byte(typed)
+	default:
+		return nil, fmt.Errorf("%w: key must be []byte or string, got %T", ErrArgument, value)
+	}
+
+	if op != "like" {
+		return key, nil
+	}
+
+	prefix, found := bytes.CutSuffix(key, []byte("%"))
+	if !found || bytes.ContainsAny(prefix, "%_") {
+		return nil, fmt.Errorf("%w: like only matches a prefix, like 'prefix%%', got %q", ErrArgument, key)
+	}
+
+	return prefix, nil
+}
+
+// pushdown
+//
+//	Narrow the range scanned to the tightest start and end key of the conditions on the key, and the highest lower bound on the version.
+//	The end key of a range is exclusive, so an inclusive upper bound is pushed down as the key directly after it.
+//	Exclusive lower bounds are scanned inclusively, and are excluded when the conditions are checked on each key-value pair.
+func pushdown(bound []*boundCondition) ([]byte, []byte, uint64) {
+	var startKey, endKey []byte
+	var minVersion uint64
+
+	raiseStart := func(key []byte) {
+		if startKey == nil || bytes.Compare(key, startKey) == 1 {
+			startKey = key
+		}
+	}
+
+	lowerEnd := func(key []byte) {
+		if endKey == nil || bytes.Compare(key, endKey) == -1 {
+			endKey = key
+		}
+	}
+
+	for _, curr := range bound {
+		switch {
+		case curr.column == ColumnKey:
+			switch curr.op {
+			case "=":
+				raiseStart(curr.keys[0])
+				lowerEnd(nextKey(curr.keys[0]))
+			case ">", ">=":
+				raiseStart(curr.keys[0])
+			case "<":
+				lowerEnd(curr.keys[0])
+			case "<=":
+				lowerEnd(nextKey(curr.keys[0]))
+			case "between":
+				raiseStart(curr.keys[0])
+				lowerEnd(nextKey(curr.keys[1]))
+			case "like":
+				if len(curr.keys[0]) > 0 {
+					raiseStart(curr.keys[0])
+					if prefixEnd := prefixEndKey(curr.keys[0]); prefixEnd != nil {
+						lowerEnd(prefixEnd)
+					}
+				}
+			}
+		case curr.column == ColumnVersion:
+			switch curr.op {
+			case "=", ">=", "between":
+				minVersion = max(minVersion, curr.numbers[0])
+			case ">":
+				minVersion = max(minVersion, curr.numbers[0]+1)
+			}
+		}
+	}
+
+	return startKey, endKey, minVersion
+}
+
+// nextKey
+//
+//	Get the smallest key greater than the key, which is the key followed by a 0x00 byte.
+func nextKey(key []byte) []byte {
+	return append(bytes.Clone(key), 0x00)
+}
+
+// prefixEndKey
+//
+//	Get the smallest key greater than every key with the prefix, or nil if there is none because the prefix is all 0xff bytes.
+func prefixEndKey(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for idx := len(end) - 1; idx >= 0; idx-- {
+		if end[idx] < 0xff {
+			end[idx]++
+			return end[:idx+1]
+		}
+	}
+
+	return nil
+}
+
+// matchAll
+//
+//	Determine if a key-value pair matches every condition.
+func matchAll(bound []*boundCondition, kvPair *mariv2.KeyValuePair) bool {
+	for _, curr := range bound {
+		if !curr.match(kvPair) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match
+//
+//	Determine if a key-value pair matches the condition.
+func (curr *boundCondition) match(kvPair *mariv2.KeyValuePair) bool {
+	if curr.column == ColumnKey {
+		switch curr.op {
+		case "like":
+			return bytes.HasPrefix(kvPair.Key, curr.keys[0])
+		case "between":
+			return bytes.Compare(kvPair.Key, curr.keys[0]) >= 0 && bytes.Compare(kvPair.Key, curr.keys[1]) <= 0
+		default:
+			return compare(bytes.Compare(kvPair.Key, curr.keys[0]), curr.op)
+		}
+	}
+
+	value := kvPair.Version
+	if curr.column == ColumnTimestamp {
+		value = kvPair.Timestamp
+	}
+
+	if curr.op == "between" {
+		return value >= curr.numbers[0] && value <= curr.numbers[1]
+	}
+
+	switch {
+	case value < curr.numbers[0]:
+		return compare(-1, curr.op)
+	case value > curr.numbers[0]:
+		return compare(1, curr.op)
+	default:
+		return compare(0, curr.op)
+	}
+}
+
+// compare
+//
+//	Determine if the result of a three way comparison satisfies the comparison operator.
+func compare(result int, op string) bool {
+	switch op {
+	case "=":
+		return result == 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	default:
+		return false
+	}
+}
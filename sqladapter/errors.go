@@ -0,0 +1,12 @@
+package sqladapter
+
+import "errors"
+
+// ErrReadOnly is returned when executing a statement or starting a read-write transaction, since the table is read only
+var ErrReadOnly = errors.New("mari table is read only")
+
+// ErrSyntax is returned, wrapped with the reason, when a statement is not a supported select on the table
+var ErrSyntax = errors.New("unsupported statement")
+
+// ErrArgument is returned, wrapped with the reason, when an argument bound to a placeholder has the wrong type for its column
+var ErrArgument = errors.New("invalid argument")
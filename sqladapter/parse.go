@@ -0,0 +1,302 @@
+package sqladapter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//============================================= Mari SQL Parse
+
+// parse
+//
+//	Parse a select statement on the table, which has the form:
+//
+//	  select <* | column, ...> from mari [where <condition> [and <condition> ...]] [limit <n>]
+//
+//	A condition compares the key, version, or timestamp column with =, <, <=, >, or >=, or with between ? and ?, and the key can be matched to a prefix with like 'prefix%'.
+//	Operands are ? placeholders, string literals for the key, or integer literals for the version and timestamp. Keywords are case insensitive.
+func parse(statement string) (*query, error) {
+	tokens, tokenizeErr := tokenize(statement)
+	if tokenizeErr != nil {
+		return nil, tokenizeErr
+	}
+
+	parser := &parser{tokens: tokens}
+	return parser.parseSelect()
+}
+
+// parser consumes the tokens of a statement in order
+type parser struct {
+	// tokens: the tokens of the statement
+	tokens []string
+	// pos: the index of the next token
+	pos int
+	// placeholders: the ? placeholders parsed so far
+	placeholders int
+}
+
+// parseSelect
+//
+//	Parse the columns, table, conditions, and limit of the statement, in that order.
+func (parser *parser) parseSelect() (*query, error) {
+	parsed := &query{limit: -1}
+
+	expectErr := parser.expectKeyword("select")
+	if expectErr != nil {
+		return nil, expectErr
+	}
+
+	if parser.peek() == "*" {
+		parser.pos++
+		parsed.columns = []int{0, 1, 2, 3}
+	} else {
+		for {
+			column, columnErr := parser.parseColumn()
+			if columnErr != nil {
+				return nil, columnErr
+			}
+
+			parsed.columns = append(parsed.columns, column)
+			if parser.peek() != "," {
+				break
+			}
+
+			parser.pos++
+		}
+	}
+
+	expectErr = parser.expectKeyword("from")
+	if expectErr != nil {
+		return nil, expectErr
+	}
+
+	if table := parser.next(); !strings.EqualFold(table, Table) {
+		return nil, fmt.Errorf("%w: table %q does not exist, the only table is %s", ErrSyntax, table, Table)
+	}
+
+	if parser.peekKeyword("where") {
+		parser.pos++
+		for {
+			parsedCondition, conditionErr := parser.parseCondition()
+			if conditionErr != nil {
+				return nil, conditionErr
+			}
+
+			parsed.conditions = append(parsed.conditions, parsedCondition)
+			if !parser.peekKeyword("and") {
+				break
+			}
+
+			parser.pos++
+		}
+	}
+
+	if parser.peekKeyword("limit") {
+		parser.pos++
+		limit, limitErr := strconv.Atoi(parser.next())
+		if limitErr != nil || limit < 0 {
+			return nil, fmt.Errorf("%w: limit must be a non-negative integer", ErrSyntax)
+		}
+
+		parsed.limit = limit
+	}
+
+	if parser.peek() == ";" {
+		parser.pos++
+	}
+
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, parser.peek())
+	}
+
+	parsed.placeholders = parser.placeholders
+	return parsed, nil
+}
+
+// parseColumn
+//
+//	Parse the name of a column, returning its index in the table.
+func (parser *parser) parseColumn() (int, error) {
+	name := parser.next()
+	column := slices.IndexFunc(columns, func(column string) bool { return strings.EqualFold(column, name) })
+	if column == -1 {
+		return 0, fmt.Errorf("%w: column %q does not exist, the columns are %s", ErrSyntax, name, strings.Join(columns, ", "))
+	}
+
+	return column, nil
+}
+
+// parseCondition
+//
+//	Parse a comparison of the key, version, or timestamp column.
+//	The value column can not be compared, since it is not ordered in the trie.
+func (parser *parser) parseCondition() (*condition, error) {
+	column, columnErr := parser.parseColumn()
+	if columnErr != nil {
+		return nil, columnErr
+	}
+
+	if columns[column] == ColumnValue {
+		return nil, fmt.Errorf("%w: the value column can not be compared", ErrSyntax)
+	}
+
+	parsed := &condition{column: column, op: strings.ToLower(parser.next())}
+	switch parsed.op {
+	case "=", "<", "<=", ">", ">=":
+	case "between", "like":
+		if parsed.op == "like" && columns[column] != ColumnKey {
+			return nil, fmt.Errorf("%w: only the key column can be matched with like", ErrSyntax)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported comparison %q", ErrSyntax, parsed.op)
+	}
+
+	first, operandErr := parser.parseOperand(column)
+	if operandErr != nil {
+		return nil, operandErr
+	}
+
+	parsed.operands = []*operand{first}
+	if parsed.op == "between" {
+		expectErr := parser.expectKeyword("and")
+		if expectErr != nil {
+			return nil, expectErr
+		}
+
+		second, operandErr := parser.parseOperand(column)
+		if operandErr != nil {
+			return nil, operandErr
+		}
+
+		parsed.operands = append(parsed.operands, second)
+	}
+
+	return parsed, nil
+}
+
+// parseOperand
+//
+//	Parse a ? placeholder, or a literal of the type of the column, which is a string for the key and an integer for the version and timestamp.
+func (parser *parser) parseOperand(column int) (*operand, error) {
+	token := parser.next()
+	switch {
+	case token == "?":
+		parser.placeholders++
+		return &operand{placeholder: parser.placeholders - 1}, nil
+	case columns[column] == ColumnKey && strings.HasPrefix(token, "'"):
+		return &operand{placeholder: -1, literal: strings.ReplaceAll(token[1:len(token)-1], "''", "'")}, nil
+	case columns[column] != ColumnKey:
+		number, parseErr := strconv.ParseInt(token, 10, 64)
+		if parseErr == nil {
+			return &operand{placeholder: -1, literal: number}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: invalid operand %q for column %s", ErrSyntax, token, columns[column])
+}
+
+// expectKeyword
+//
+//	Consume the next token, which must be the keyword.
+func (parser *parser) expectKeyword(keyword string) error {
+	token := parser.next()
+	if !strings.EqualFold(token, keyword) {
+		return fmt.Errorf("%w: expected %s, got %q", ErrSyntax, keyword, token)
+	}
+
+	return nil
+}
+
+// peekKeyword
+//
+//	Determine if the next token is the keyword, without consuming it.
+func (parser *parser) peekKeyword(keyword string) bool {
+	return strings.EqualFold(parser.peek(), keyword)
+}
+
+// peek
+//
+//	Get the next token without consuming it, or an empty string at the end of the statement.
+func (parser *parser) peek() string {
+	if parser.pos >= len(parser.tokens) {
+		return ""
+	}
+
+	return parser.tokens[parser.pos]
+}
+
+// next
+//
+//	Consume the next token, or return an empty string at the end of the statement.
+func (parser *parser) next() string {
+	token := parser.peek()
+	if token != "" {
+		parser.pos++
+	}
+
+	return token
+}
+
+// tokenize
+//
+//	Split a statement into words, numbers, string literals with their quotes, and symbols.
+//	A quote in a string literal is escaped by doubling it, like 'it''s'.
+func tokenize(statement string) ([]string, error) {
+	var tokens []string
+	runes := []rune(statement)
+
+	for idx := 0; idx < len(runes); {
+		curr := runes[idx]
+		switch {
+		case unicode.IsSpace(curr):
+			idx++
+		case curr == '\'':
+			end := idx + 1
+			for ; end < len(runes); end++ {
+				if runes[end] != '\'' {
+					continue
+				}
+
+				if end+1 < len(runes) && runes[end+1] == '\'' {
+					end++
+					continue
+				}
+
+				break
+			}
+
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string literal", ErrSyntax)
+			}
+
+			tokens = append(tokens, string(runes[idx:end+1]))
+			idx = end + 1
+		case curr == '<' || curr == '>':
+			if idx+1 < len(runes) && runes[idx+1] == '=' {
+				tokens = append(tokens, string(runes[idx:idx+2]))
+				idx += 2
+			} else {
+				tokens = append(tokens, string(curr))
+				idx++
+			}
+		case strings.ContainsRune("*,?=;", curr):
+			tokens = append(tokens, string(curr))
+			idx++
+		case curr == '_' || curr == '-' || unicode.IsLetter(curr) || unicode.IsDigit(curr):
+			end := idx + 1
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+
+			tokens = append(tokens, string(runes[idx:end]))
+			idx = end
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q", ErrSyntax, curr)
+		}
+	}
+
+	return tokens, nil
+}
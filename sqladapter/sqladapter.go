@@ -0,0 +1,215 @@
+package sqladapter
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+
+	"github.com/sirgallo/mariv2"
+)
+
+//============================================= Mari SQL Adapter
+
+// Open
+//
+//	Expose a Mari instance as the read only table mari, with the columns key, value, version, and timestamp, queried through database/sql.
+//	The instance is not closed when the database is closed.
+func Open(mariInst *mariv2.Mari) *sql.DB {
+	return sql.OpenDB(NewConnector(mariInst))
+}
+
+// NewConnector
+//
+//	Create a connector for a Mari instance, for use with sql.OpenDB.
+func NewConnector(mariInst *mariv2.Mari) driver.Connector {
+	return &connector{mariInst: mariInst}
+}
+
+// Connect
+//
+//	Open a connection to the instance. Connections hold no state, so this never fails.
+func (dbConnector *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{mariInst: dbConnector.mariInst}, nil
+}
+
+// Driver
+//
+//	Get the driver of the connector, which can only be opened through the connector.
+func (dbConnector *connector) Driver() driver.Driver {
+	return dbConnector
+}
+
+// Open
+//
+//	Instances can not be opened by name, so the connector must be used with sql.OpenDB.
+func (dbConnector *connector) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("mari instances can not be opened by name, use sqladapter.Open")
+}
+
+// Prepare
+//
+//	Parse a select statement on the table.
+func (dbConn *conn) Prepare(statement string) (driver.Stmt, error) {
+	parsed, parseErr := parse(statement)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	return &stmt{mariInst: dbConn.mariInst, query: parsed}, nil
+}
+
+// Close
+//
+//	Close the connection. The instance stays open.
+func (dbConn *conn) Close() error {
+	return nil
+}
+
+// Begin
+//
+//	Start a transaction, which only groups statements for database/sql. Every statement still runs in its own read only transaction on the instance.
+func (dbConn *conn) Begin() (driver.Tx, error) {
+	return readTx{}, nil
+}
+
+// Commit
+//
+//	Nothing is written on the table, so there is nothing to commit.
+func (tx readTx) Commit() error {
+	return nil
+}
+
+// Rollback
+//
+//	Nothing is written on the table, so there is nothing to roll back.
+func (tx readTx) Rollback() error {
+	return nil
+}
+
+// Close
+//
+//	Close the statement. Statements hold no resources, since the rows are read when the statement is run.
+func (statement *stmt) Close() error {
+	return nil
+}
+
+// NumInput
+//
+//	Get the total ? placeholders in the statement, so database/sql can check the arguments.
+func (statement *stmt) NumInput() int {
+	return statement.query.placeholders
+}
+
+// Exec
+//
+//	The table is read only, so ErrReadOnly is returned.
+func (statement *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, ErrReadOnly
+}
+
+// Query
+//
+//	Run the statement with the arguments bound to its placeholders in order.
+func (statement *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	namedArgs := make([]driver.NamedValue, len(args))
+	for idx, arg := range args {
+		namedArgs[idx] = driver.NamedValue{Ordinal: idx + 1, Value: arg}
+	}
+
+	return statement.QueryContext(context.Background(), namedArgs)
+}
+
+// QueryContext
+//
+//	Run the statement in a read only transaction on the latest version.
+//	The conditions on the key are pushed down as the start and end key of a range, and the lower bounds on the version as its min version, so only the matching part of the trie is walked.
+//	Every condition is then checked on each key-value pair, and the keys and values are copied out of the memory map so the rows outlive the transaction.
+func (statement *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	bound, bindErr := statement.query.bind(args)
+	if bindErr != nil {
+		return nil, bindErr
+	}
+
+	startKey, endKey, minVersion := pushdown(bound)
+	results := &rows{columns: statement.query.columns}
+	if statement.query.limit == 0 || (startKey != nil && endKey != nil && bytes.Compare(startKey, endKey) >= 0) {
+		return results, nil
+	}
+
+	sharedBuffers := true
+	opts := &mariv2.RangeOpts{MinVersion: &minVersion, SharedBuffers: &sharedBuffers}
+	readErr := statement.mariInst.ReadTx(func(tx *mariv2.Tx) error {
+		kvPairs, rangeErr := tx.Range(startKey, endKey, opts)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for _, kvPair := range kvPairs {
+			if statement.query.limit >= 0 && len(results.kvPairs) == statement.query.limit {
+				break
+			}
+
+			if matchAll(bound, kvPair) {
+				results.kvPairs = append(results.kvPairs, kvPair)
+			}
+		}
+
+		return ctx.Err()
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return results, nil
+}
+
+// Columns
+//
+//	Get the names of the selected columns.
+func (results *rows) Columns() []string {
+	names := make([]string, len(results.columns))
+	for idx, column := range results.columns {
+		names[idx] = columns[column]
+	}
+
+	return names
+}
+
+// Close
+//
+//	Release the rows.
+func (results *rows) Close() error {
+	results.kvPairs = nil
+	return nil
+}
+
+// Next
+//
+//	Write the selected columns of the next key-value pair to dest, returning io.EOF once every row has been read.
+func (results *rows) Next(dest []driver.Value) error {
+	if results.pos >= len(results.kvPairs) {
+		return io.EOF
+	}
+
+	kvPair := results.kvPairs[results.pos]
+	results.pos++
+
+	for idx, column := range results.columns {
+		switch columns[column] {
+		case ColumnKey:
+			dest[idx] = kvPair.Key
+		case ColumnValue:
+			dest[idx] = kvPair.Value
+		case ColumnVersion:
+			dest[idx] = int64(kvPair.Version)
+		case ColumnTimestamp:
+			dest[idx] = int64(kvPair.Timestamp)
+		}
+	}
+
+	return nil
+}
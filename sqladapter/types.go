@@ -0,0 +1,86 @@
+package sqladapter
+
+import (
+	"github.com/sirgallo/mariv2"
+)
+
+// Table is the name of the read only table a Mari instance is exposed as
+const Table = "mari"
+
+// ColumnKey is the column of the key of each key-value pair, returned as []byte
+const ColumnKey = "key"
+
+// ColumnValue is the column of the value of each key-value pair, returned as []byte
+const ColumnValue = "value"
+
+// ColumnVersion is the column of the version each key-value pair was written in, returned as int64
+const ColumnVersion = "version"
+
+// ColumnTimestamp is the column of the hybrid logical clock timestamp each key-value pair was written at, returned as int64
+const ColumnTimestamp = "timestamp"
+
+// columns are the columns of the table, in the order returned by select *
+var columns = []string{ColumnKey, ColumnValue, ColumnVersion, ColumnTimestamp}
+
+// connector opens connections to a Mari instance for database/sql
+type connector struct {
+	// mariInst: the instance queried by every connection
+	mariInst *mariv2.Mari
+}
+
+// conn is a connection to a Mari instance. Every query runs in its own read only transaction, so the connection holds no state
+type conn struct {
+	// mariInst: the instance queried by the connection
+	mariInst *mariv2.Mari
+}
+
+// stmt is a parsed select statement
+type stmt struct {
+	// mariInst: the instance queried by the statement
+	mariInst *mariv2.Mari
+	// query: the parsed statement
+	query *query
+}
+
+// readTx is a transaction on a connection, which only exists to satisfy database/sql since every query is read only
+type readTx struct{}
+
+// rows are the results of a select statement, read in a single read only transaction and copied out of the memory map
+type rows struct {
+	// columns: the indexes of the selected columns in the table
+	columns []int
+	// kvPairs: the key-value pairs matching the statement, in key order
+	kvPairs []*mariv2.KeyValuePair
+	// pos: the index of the next key-value pair to return
+	pos int
+}
+
+// query is a select statement of columns from the table, filtered by conditions joined with and, up to a limit
+type query struct {
+	// columns: the indexes of the selected columns in the table
+	columns []int
+	// conditions: the conditions every returned key-value pair must match
+	conditions []*condition
+	// limit: the max key-value pairs returned, or -1 if there is no limit
+	limit int
+	// placeholders: the total ? placeholders in the statement
+	placeholders int
+}
+
+// condition is a comparison of a column to one or two operands, like key >= ? or key between ? and ?
+type condition struct {
+	// column: the index of the compared column in the table
+	column int
+	// op: the comparison, which is one of =, <, <=, >, >=, between, or like
+	op string
+	// operands: the values the column is compared to, which are two for between and one otherwise
+	operands []*operand
+}
+
+// operand is a literal value or a ? placeholder bound when the statement is run
+type operand struct {
+	// placeholder: the index of the argument bound to the placeholder, or -1 for a literal
+	placeholder int
+	// literal: the value of a literal, which is a string or an int64
+	literal any
+}
@@ -0,0 +1,321 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+//============================================= Mari Stats
+
+// Stats
+//
+//	Take a point in time snapshot of the instance metadata.
+//	The values are loaded individually from the memory map, so a concurrent commit may be partially reflected.
+func (mariInst *Mari) Stats() (*Stats, error) {
+	var statsErr error
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Stats"); stateErr != nil {
+		return nil, stateErr
+	}
+
+	_, version, statsErr := mariInst.loadMetaVersion()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	_, rootOffset, statsErr := mariInst.loadMetaRootOffset()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	_, nextStartOffset, statsErr := mariInst.loadMetaEndSerialized()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	_, timestamp, statsErr := mariInst.loadMetaTimestamp()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	formatVersion, statsErr := mariInst.loadMetaFormatVersion()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	fSize, statsErr := mariInst.FileSize()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	allocated, statsErr := allocatedSize(mariInst.file)
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	return &Stats{
+		Version:            version,
+		RootOffset:         rootOffset,
+		NextStartOffset:    nextStartOffset,
+		Timestamp:          timestamp,
+		FormatVersion:      formatVersion,
+		FileSize:           fSize,
+		AllocatedSize:      int(allocated),
+		ActiveReadTxs:      atomic.LoadInt64(&mariInst.activeReadTxs),
+		LongReadTxs:        atomic.LoadUint64(&mariInst.longReadTxs),
+		ReadRepairs:        atomic.LoadUint64(&mariInst.readRepairs),
+		TieredValues:       atomic.LoadUint64(&mariInst.tieredValues),
+		ColdReads:          atomic.LoadUint64(&mariInst.coldReads),
+		ColdFileSize:       mariInst.tiering.fileSize(),
+		BackgroundIO:       mariInst.ioLimiter.stats(),
+		Contention:         mariInst.contention.stats(),
+		ValueCache:         mariInst.valueCache.stats(),
+		NegativeCache:      mariInst.missCache.stats(),
+		WriteAmplification: mariInst.amplification.stats(),
+		Residency:          mariInst.residency.stats(),
+		Throttle:           mariInst.throttleStats(),
+		Memory:             mariInst.memory.stats(mariInst.MemoryUsage()),
+		GroupedSync:        mariInst.adaptive.isGrouped(),
+		SyncLatencyP99:     mariInst.adaptive.p99(),
+	}, nil
+}
+
+// PoolStats
+//
+//	Get the occupancy of the node pool, and the nodes taken, allocated, put back and dropped since the instance was opened.
+func (mariInst *Mari) PoolStats() *PoolStats {
+	return mariInst.pool.stats()
+}
+
+// PoolAudit
+//
+//	With PoolDebug, report the nodes taken from the node pool at least minAge ago that were never put back, and the nodes put back twice, with their stacks.
+//	Nodes held by operations in flight are outstanding, so leaks are best checked with a min age longer than any operation, or once the instance is idle.
+//	Returns nil without PoolDebug.
+func (mariInst *Mari) PoolAudit(minAge time.Duration) *PoolAudit {
+	return mariInst.pool.audit.report(minAge)
+}
+
+// MarshalJSON
+//
+//	Encode the stats as JSON with camel case field names, so they can be served or logged without extra formatting.
+//	Durations are encoded as strings, like "1.5ms", and the hot keys as strings, which are quoted with Go escapes if they are not valid UTF-8.
+func (stats Stats) MarshalJSON() ([]byte, error) {
+	type keyContentionJSON struct {
+		Key       string `json:"key"`
+		Conflicts uint64 `json:"conflicts"`
+	}
+
+	type contentionJSON struct {
+		Retries uint64              `json:"retries"`
+		Aborts  uint64              `json:"aborts"`
+		HotKeys []keyContentionJSON `json:"hotKeys"`
+	}
+
+	type backgroundIOJSON struct {
+		Rate      int64  `json:"rate"`
+		Available int64  `json:"available"`
+		Bytes     uint64 `json:"bytes"`
+		Waited    string `json:"waited"`
+	}
+
+	type cacheJSON struct {
+		Hits          uint64 `json:"hits"`
+		Misses        uint64 `json:"misses"`
+		Evictions     uint64 `json:"evictions"`
+		Invalidations uint64 `json:"invalidations"`
+		Entries       int    `json:"entries"`
+	}
+
+	type writeAmplificationJSON struct {
+		Commits      uint64  `json:"commits"`
+		WrittenBytes uint64  `json:"writtenBytes"`
+		PayloadBytes uint64  `json:"payloadBytes"`
+		Ratio        float64 `json:"ratio"`
+	}
+
+	type residencyJSON struct {
+		Samples       uint64  `json:"samples"`
+		SampledAt     string  `json:"sampledAt"`
+		MappedBytes   uint64  `json:"mappedBytes"`
+		ResidentBytes uint64  `json:"residentBytes"`
+		ResidentRatio float64 `json:"residentRatio"`
+		MajorFaults   uint64  `json:"majorFaults"`
+	}
+
+	type throttleJSON struct {
+		ReadRate        int64  `json:"readRate"`
+		WriteRate       int64  `json:"writeRate"`
+		ReadsThrottled  uint64 `json:"readsThrottled"`
+		WritesThrottled uint64 `json:"writesThrottled"`
+	}
+
+	type memoryJSON struct {
+		Limit     int64  `json:"limit"`
+		Usage     int64  `json:"usage"`
+		Pressured bool   `json:"pressured"`
+		Shrinks   uint64 `json:"shrinks"`
+		ShedScans uint64 `json:"shedScans"`
+	}
+
+	sampledAt := ""
+	if !stats.Residency.SampledAt.IsZero() {
+		sampledAt = stats.Residency.SampledAt.Format(time.RFC3339Nano)
+	}
+
+	hotKeys := make([]keyContentionJSON, len(stats.Contention.HotKeys))
+	for idx, hotKey := range stats.Contention.HotKeys {
+		hotKeys[idx] = keyContentionJSON{Key: printableKey(hotKey.Key), Conflicts: hotKey.Conflicts}
+	}
+
+	return json.Marshal(struct {
+		Version            uint64                 `json:"version"`
+		RootOffset         uint64                 `json:"rootOffset"`
+		NextStartOffset    uint64                 `json:"nextStartOffset"`
+		Timestamp          uint64                 `json:"timestamp"`
+		FormatVersion      uint64                 `json:"formatVersion"`
+		FileSize           int                    `json:"fileSize"`
+		AllocatedSize      int                    `json:"allocatedSize"`
+		ActiveReadTxs      int64                  `json:"activeReadTxs"`
+		LongReadTxs        uint64                 `json:"longReadTxs"`
+		ReadRepairs        uint64                 `json:"readRepairs"`
+		TieredValues       uint64                 `json:"tieredValues"`
+		ColdReads          uint64                 `json:"coldReads"`
+		ColdFileSize       int64                  `json:"coldFileSize"`
+		BackgroundIO       backgroundIOJSON       `json:"backgroundIO"`
+		GroupedSync        bool                   `json:"groupedSync"`
+		SyncLatencyP99     string                 `json:"syncLatencyP99"`
+		Contention         contentionJSON         `json:"contention"`
+		ValueCache         cacheJSON              `json:"valueCache"`
+		NegativeCache      cacheJSON              `json:"negativeCache"`
+		WriteAmplification writeAmplificationJSON `json:"writeAmplification"`
+		Residency          residencyJSON          `json:"residency"`
+		Throttle           throttleJSON           `json:"throttle"`
+		Memory             memoryJSON             `json:"memory"`
+	}{
+		Version:            stats.Version,
+		RootOffset:         stats.RootOffset,
+		NextStartOffset:    stats.NextStartOffset,
+		Timestamp:          stats.Timestamp,
+		FormatVersion:      stats.FormatVersion,
+		FileSize:           stats.FileSize,
+		AllocatedSize:      stats.AllocatedSize,
+		ActiveReadTxs:      stats.ActiveReadTxs,
+		LongReadTxs:        stats.LongReadTxs,
+		ReadRepairs:        stats.ReadRepairs,
+		TieredValues:       stats.TieredValues,
+		ColdReads:          stats.ColdReads,
+		ColdFileSize:       stats.ColdFileSize,
+		BackgroundIO:       backgroundIOJSON{Rate: stats.BackgroundIO.Rate, Available: stats.BackgroundIO.Available, Bytes: stats.BackgroundIO.Bytes, Waited: stats.BackgroundIO.Waited.String()},
+		GroupedSync:        stats.GroupedSync,
+		SyncLatencyP99:     stats.SyncLatencyP99.String(),
+		Contention:         contentionJSON{Retries: stats.Contention.Retries, Aborts: stats.Contention.Aborts, HotKeys: hotKeys},
+		ValueCache:         cacheJSON(stats.ValueCache),
+		NegativeCache:      cacheJSON(stats.NegativeCache),
+		WriteAmplification: writeAmplificationJSON(stats.WriteAmplification),
+		Residency: residencyJSON{
+			Samples:       stats.Residency.Samples,
+			SampledAt:     sampledAt,
+			MappedBytes:   stats.Residency.MappedBytes,
+			ResidentBytes: stats.Residency.ResidentBytes,
+			ResidentRatio: stats.Residency.ResidentRatio,
+			MajorFaults:   stats.Residency.MajorFaults,
+		},
+		Throttle: throttleJSON(stats.Throttle),
+		Memory:   memoryJSON(stats.Memory),
+	})
+}
+
+// String
+//
+//	Format the stats as a table of metrics, one per line, for command line output and logging.
+func (stats Stats) String() string {
+	var buf bytes.Buffer
+	table := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	row := func(name string, value any) {
+		fmt.Fprintf(table, "%s\t%v\n", name, value)
+	}
+
+	row("version", stats.Version)
+	row("root offset", stats.RootOffset)
+	row("next start offset", stats.NextStartOffset)
+	row("timestamp", stats.Timestamp)
+	row("format version", stats.FormatVersion)
+	row("file size", stats.FileSize)
+	row("allocated size", stats.AllocatedSize)
+	row("active read txs", stats.ActiveReadTxs)
+	row("long read txs", stats.LongReadTxs)
+	row("read repairs", stats.ReadRepairs)
+	row("tiered values", stats.TieredValues)
+	row("cold reads", stats.ColdReads)
+	row("cold file size", stats.ColdFileSize)
+	row("background io rate", stats.BackgroundIO.Rate)
+	row("background io available", stats.BackgroundIO.Available)
+	row("background io bytes", stats.BackgroundIO.Bytes)
+	row("background io waited", stats.BackgroundIO.Waited)
+	row("grouped sync", stats.GroupedSync)
+	row("sync latency p99", stats.SyncLatencyP99)
+	row("contention retries", stats.Contention.Retries)
+	row("contention aborts", stats.Contention.Aborts)
+	for _, hotKey := range stats.Contention.HotKeys {
+		row(fmt.Sprintf("contention hot key %q", hotKey.Key), hotKey.Conflicts)
+	}
+
+	for _, cache := range []struct {
+		name  string
+		stats ValueCacheStats
+	}{{"value cache", stats.ValueCache}, {"negative cache", stats.NegativeCache}} {
+		row(cache.name+" hits", cache.stats.Hits)
+		row(cache.name+" misses", cache.stats.Misses)
+		row(cache.name+" evictions", cache.stats.Evictions)
+		row(cache.name+" invalidations", cache.stats.Invalidations)
+		row(cache.name+" entries", cache.stats.Entries)
+	}
+
+	row("write amplification commits", stats.WriteAmplification.Commits)
+	row("write amplification written bytes", stats.WriteAmplification.WrittenBytes)
+	row("write amplification payload bytes", stats.WriteAmplification.PayloadBytes)
+	row("write amplification ratio", fmt.Sprintf("%.2f", stats.WriteAmplification.Ratio))
+	row("residency samples", stats.Residency.Samples)
+	row("residency mapped bytes", stats.Residency.MappedBytes)
+	row("residency resident bytes", stats.Residency.ResidentBytes)
+	row("residency resident ratio", fmt.Sprintf("%.2f", stats.Residency.ResidentRatio))
+	row("residency major faults", stats.Residency.MajorFaults)
+	row("throttle read rate", stats.Throttle.ReadRate)
+	row("throttle write rate", stats.Throttle.WriteRate)
+	row("throttle reads throttled", stats.Throttle.ReadsThrottled)
+	row("throttle writes throttled", stats.Throttle.WritesThrottled)
+	row("memory limit", stats.Memory.Limit)
+	row("memory usage", stats.Memory.Usage)
+	row("memory pressured", stats.Memory.Pressured)
+	row("memory shrinks", stats.Memory.Shrinks)
+	row("memory shed scans", stats.Memory.ShedScans)
+
+	table.Flush()
+	return buf.String()
+}
+
+// printableKey
+//
+//	Get a key as a string for output, quoted with Go escapes if it is not valid UTF-8, so binary keys are not mangled.
+func printableKey(key []byte) string {
+	if utf8.Valid(key) {
+		return string(key)
+	}
+
+	return strconv.Quote(string(key))
+}
@@ -0,0 +1,390 @@
+package mariv2
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Storage
+
+// LatencyStorage
+//
+//	Get middleware that delays every read, write, and flush of the storage, to test how an instance behaves on slow disks.
+//	A delay of 0 leaves the operation undelayed.
+func LatencyStorage(read, write, flush time.Duration) StorageMiddleware {
+	return func(next Storage) Storage {
+		return &latencyStorage{next: next, read: read, write: write, flush: flush}
+	}
+}
+
+// FaultStorage
+//
+//	Get middleware that calls the injector before every operation on the storage, failing the operation with the error it returns instead of delegating it.
+//	A failed write or flush fails the commit, and a failed read fails the transaction reading the node.
+func FaultStorage(inject func(op StorageOp, offset, length uint64) error) StorageMiddleware {
+	return func(next Storage) Storage {
+		return &faultStorage{next: next, inject: inject}
+	}
+}
+
+// MetricsStorage
+//
+//	Get middleware that records the count, bytes, errors, and latency of every operation on the storage in the metrics.
+//	Nodes already in memory, like the path copies of an open transaction, are not read from the storage, so only reads of serialized nodes are recorded.
+func MetricsStorage(metrics *StorageMetrics) StorageMiddleware {
+	return func(next Storage) Storage {
+		return &metricsStorage{next: next, metrics: metrics}
+	}
+}
+
+// ReadOnlyStorage
+//
+//	Get middleware that rejects every write with ErrReadOnlyStorage, so an existing file can be served without being modified.
+//	Read-write transactions fail to commit, and a new file can not be created, since its root and metadata must be written.
+func ReadOnlyStorage() StorageMiddleware {
+	return func(next Storage) Storage {
+		return &readOnlyStorage{next: next}
+	}
+}
+
+// Stats
+//
+//	Take a snapshot of the recorded operations.
+func (metrics *StorageMetrics) Stats() StorageStats {
+	return StorageStats{
+		Reads:      atomic.LoadUint64(&metrics.reads),
+		ReadBytes:  atomic.LoadUint64(&metrics.readBytes),
+		Writes:     atomic.LoadUint64(&metrics.writes),
+		WriteBytes: atomic.LoadUint64(&metrics.writeBytes),
+		Flushes:    atomic.LoadUint64(&metrics.flushes),
+		Errors:     atomic.LoadUint64(&metrics.errors),
+		ReadTime:   time.Duration(atomic.LoadUint64(&metrics.readNanos)),
+		WriteTime:  time.Duration(atomic.LoadUint64(&metrics.writeNanos)),
+		FlushTime:  time.Duration(atomic.LoadUint64(&metrics.flushNanos)),
+	}
+}
+
+// String
+//
+//	Get the name of the operation.
+func (op StorageOp) String() string {
+	switch op {
+	case StorageOpRead:
+		return "read"
+	case StorageOpWrite:
+		return "write"
+	case StorageOpFlush:
+		return "flush"
+	default:
+		return "unknown"
+	}
+}
+
+// initStorage
+//
+//	Wrap the memory mapped storage with the flush backend, then with the storage middleware, in order.
+//	With FlushBackendIOURing, an io_uring is set up for the flushes, and ErrIOURingUnavailable is returned if it can not be.
+//	Without middleware or a flush backend, the storage is left nil, so nodes are read and written on the memory map without an indirection.
+func (mariInst *Mari) initStorage(opts InitOpts) error {
+	iouring := opts.FlushBackend != nil && *opts.FlushBackend == FlushBackendIOURing
+	if len(opts.Storage) == 0 && !iouring {
+		return nil
+	}
+
+	var storage Storage = &mmapStorage{store: mariInst}
+	if iouring {
+		ring, ringErr := newIOURing(IOURingEntries)
+		if ringErr != nil {
+			return ringErr
+		}
+
+		mariInst.flushRing = ring
+		storage = &iouringStorage{next: storage, store: mariInst, ring: ring}
+	}
+
+	for _, wrap := range opts.Storage {
+		storage = wrap(storage)
+	}
+
+	mariInst.storage = storage
+	return nil
+}
+
+// readRegion
+//
+//	Read a region of the memory map that was already bounds checked, through the storage if it is wrapped with middleware.
+func (mariInst *Mari) readRegion(mMap MMap, offset, length uint64) ([]byte, error) {
+	if mariInst.storage == nil {
+		return mMap[offset : offset+length : offset+length], nil
+	}
+
+	return mariInst.storage.Read(offset, length)
+}
+
+// writeRegion
+//
+//	Write a region of the memory map that was already bounds checked, through the storage if it is wrapped with middleware.
+func (mariInst *Mari) writeRegion(mMap MMap, data []byte, offset uint64) error {
+	if mariInst.storage == nil {
+		copy(mMap[offset:], data)
+		return nil
+	}
+
+	return mariInst.storage.Write(data, offset)
+}
+
+// flushRegion
+//
+//	Synchronously flush a region of the memory map, through the storage if it is wrapped with middleware.
+func (mariInst *Mari) flushRegion(mMap MMap, startOffset, endOffset uint64) error {
+	if mariInst.storage == nil {
+		return mMap[startOffset:endOffset].Flush()
+	}
+
+	return mariInst.storage.Flush(startOffset, endOffset-startOffset)
+}
+
+// Read
+//
+//	Delegate the read to the memory mapped storage.
+func (storage *iouringStorage) Read(offset, length uint64) ([]byte, error) {
+	return storage.next.Read(offset, length)
+}
+
+// Write
+//
+//	Delegate the write to the memory mapped storage.
+func (storage *iouringStorage) Write(data []byte, offset uint64) error {
+	return storage.next.Write(data, offset)
+}
+
+// Flush
+//
+//	Flush a region of the memory map through the io_uring, bounds checked against the current memory map.
+//	The region is added to the pending batch. If no flush is submitting batches, this flush submits them until none is pending, otherwise it waits for the batch to be submitted by the flush that is, so concurrent flushes share one system call and one fdatasync.
+func (storage *iouringStorage) Flush(offset, length uint64) error {
+	mMap := storage.store.data.Load().(MMap)
+	flushErr := checkRegion(mMap, "storage flush", offset, length, ErrOutOfBounds)
+	if flushErr != nil {
+		return flushErr
+	}
+
+	storage.lock.Lock()
+	if storage.pending == nil {
+		storage.pending = &flushBatch{done: make(chan struct{})}
+	}
+
+	batch := storage.pending
+	batch.ranges = append(batch.ranges, syncRange{offset: offset, length: length})
+	if storage.submitting {
+		storage.lock.Unlock()
+		<-batch.done
+		return batch.err
+	}
+
+	storage.submitting = true
+	for storage.pending != nil {
+		submitted := storage.pending
+		storage.pending = nil
+		storage.lock.Unlock()
+
+		submitted.err = storage.ring.sync(int(storage.store.file.Fd()), spanSyncRanges(submitted.ranges, IOURingEntries-1))
+		close(submitted.done)
+		storage.lock.Lock()
+	}
+
+	storage.submitting = false
+	storage.lock.Unlock()
+	return batch.err
+}
+
+// spanSyncRanges
+//
+//	Get the ranges of a batch if there are at most limit, otherwise the single range spanning them, so the batch fits the submission queue.
+func spanSyncRanges(ranges []syncRange, limit int) []syncRange {
+	if len(ranges) <= limit {
+		return ranges
+	}
+
+	start, end := ranges[0].offset, ranges[0].offset+ranges[0].length
+	for _, region := range ranges[1:] {
+		start, end = min(start, region.offset), max(end, region.offset+region.length)
+	}
+
+	return []syncRange{{offset: start, length: end - start}}
+}
+
+// Read
+//
+//	Get a view of a region of the memory map, bounds checked against the current memory map.
+func (storage *mmapStorage) Read(offset, length uint64) ([]byte, error) {
+	mMap := storage.store.data.Load().(MMap)
+	readErr := checkRegion(mMap, "storage read", offset, length, ErrOutOfBounds)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	return mMap[offset : offset+length : offset+length], nil
+}
+
+// Write
+//
+//	Copy data into a region of the memory map, bounds checked against the current memory map.
+func (storage *mmapStorage) Write(data []byte, offset uint64) error {
+	mMap := storage.store.data.Load().(MMap)
+	writeErr := checkRegion(mMap, "storage write", offset, uint64(len(data)), ErrOutOfBounds)
+	if writeErr != nil {
+		return writeErr
+	}
+
+	copy(mMap[offset:], data)
+	return nil
+}
+
+// Flush
+//
+//	Synchronously flush a region of the memory map with msync.
+func (storage *mmapStorage) Flush(offset, length uint64) error {
+	mMap := storage.store.data.Load().(MMap)
+	flushErr := checkRegion(mMap, "storage flush", offset, length, ErrOutOfBounds)
+	if flushErr != nil {
+		return flushErr
+	}
+
+	return mMap[offset : offset+length].Flush()
+}
+
+// Read
+//
+//	Delay the read, then delegate it.
+func (storage *latencyStorage) Read(offset, length uint64) ([]byte, error) {
+	delay(storage.read)
+	return storage.next.Read(offset, length)
+}
+
+// Write
+//
+//	Delay the write, then delegate it.
+func (storage *latencyStorage) Write(data []byte, offset uint64) error {
+	delay(storage.write)
+	return storage.next.Write(data, offset)
+}
+
+// Flush
+//
+//	Delay the flush, then delegate it.
+func (storage *latencyStorage) Flush(offset, length uint64) error {
+	delay(storage.flush)
+	return storage.next.Flush(offset, length)
+}
+
+// Read
+//
+//	Fail the read with the injected error, or delegate it.
+func (storage *faultStorage) Read(offset, length uint64) ([]byte, error) {
+	injectErr := storage.inject(StorageOpRead, offset, length)
+	if injectErr != nil {
+		return nil, injectErr
+	}
+
+	return storage.next.Read(offset, length)
+}
+
+// Write
+//
+//	Fail the write with the injected error, or delegate it.
+func (storage *faultStorage) Write(data []byte, offset uint64) error {
+	injectErr := storage.inject(StorageOpWrite, offset, uint64(len(data)))
+	if injectErr != nil {
+		return injectErr
+	}
+
+	return storage.next.Write(data, offset)
+}
+
+// Flush
+//
+//	Fail the flush with the injected error, or delegate it.
+func (storage *faultStorage) Flush(offset, length uint64) error {
+	injectErr := storage.inject(StorageOpFlush, offset, length)
+	if injectErr != nil {
+		return injectErr
+	}
+
+	return storage.next.Flush(offset, length)
+}
+
+// Read
+//
+//	Delegate the read, recording its bytes and latency.
+func (storage *metricsStorage) Read(offset, length uint64) ([]byte, error) {
+	start := time.Now()
+	data, readErr := storage.next.Read(offset, length)
+	storage.metrics.record(&storage.metrics.reads, &storage.metrics.readBytes, &storage.metrics.readNanos, length, start, readErr)
+	return data, readErr
+}
+
+// Write
+//
+//	Delegate the write, recording its bytes and latency.
+func (storage *metricsStorage) Write(data []byte, offset uint64) error {
+	start := time.Now()
+	writeErr := storage.next.Write(data, offset)
+	storage.metrics.record(&storage.metrics.writes, &storage.metrics.writeBytes, &storage.metrics.writeNanos, uint64(len(data)), start, writeErr)
+	return writeErr
+}
+
+// Flush
+//
+//	Delegate the flush, recording its latency.
+func (storage *metricsStorage) Flush(offset, length uint64) error {
+	start := time.Now()
+	flushErr := storage.next.Flush(offset, length)
+	storage.metrics.record(&storage.metrics.flushes, nil, &storage.metrics.flushNanos, length, start, flushErr)
+	return flushErr
+}
+
+// record
+//
+//	Add an operation to its count, bytes, and latency, counting it as an error if it failed.
+func (metrics *StorageMetrics) record(count, bytes, nanos *uint64, length uint64, start time.Time, opErr error) {
+	atomic.AddUint64(count, 1)
+	if bytes != nil {
+		atomic.AddUint64(bytes, length)
+	}
+
+	atomic.AddUint64(nanos, uint64(time.Since(start)))
+	if opErr != nil {
+		atomic.AddUint64(&metrics.errors, 1)
+	}
+}
+
+// Read
+//
+//	Delegate the read.
+func (storage *readOnlyStorage) Read(offset, length uint64) ([]byte, error) {
+	return storage.next.Read(offset, length)
+}
+
+// Write
+//
+//	Reject the write with ErrReadOnlyStorage.
+func (storage *readOnlyStorage) Write(data []byte, offset uint64) error {
+	return ErrReadOnlyStorage
+}
+
+// Flush
+//
+//	Delegate the flush, since nothing is written that needs to be flushed.
+func (storage *readOnlyStorage) Flush(offset, length uint64) error {
+	return storage.next.Flush(offset, length)
+}
+
+// delay
+//
+//	Sleep for the delay, if it is positive.
+func delay(duration time.Duration) {
+	if duration > 0 {
+		time.Sleep(duration)
+	}
+}
@@ -0,0 +1,311 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+)
+
+//============================================= Mari Sync
+
+// DefaultConflictResolver
+//
+//	Keep the key-value pair with the later commit timestamp, so the last writer wins. Ties are broken by the higher version and then by comparing values.
+//	The resolver only depends on the two pairs and not which side is local, so both instances resolve a conflict to the same value and converge.
+var DefaultConflictResolver ConflictResolver = func(local, remote *KeyValuePair) (*KeyValuePair, error) {
+	switch {
+	case remote.Timestamp > local.Timestamp:
+		return remote, nil
+	case remote.Timestamp < local.Timestamp:
+		return local, nil
+	case remote.Version > local.Version:
+		return remote, nil
+	case remote.Version < local.Version:
+		return local, nil
+	case bytes.Compare(remote.Value, local.Value) == 1:
+		return remote, nil
+	default:
+		return local, nil
+	}
+}
+
+// LocalWinsResolver
+//
+//	Always keep the local key-value pair. Instances only converge if the remote instance uses RemoteWinsResolver.
+var LocalWinsResolver ConflictResolver = func(local, remote *KeyValuePair) (*KeyValuePair, error) {
+	return local, nil
+}
+
+// RemoteWinsResolver
+//
+//	Always keep the remote key-value pair. Instances only converge if the remote instance uses LocalWinsResolver.
+var RemoteWinsResolver ConflictResolver = func(local, remote *KeyValuePair) (*KeyValuePair, error) {
+	return remote, nil
+}
+
+// Sync
+//
+//	Exchange changes between two instances in both directions, resolving keys written on both since the last sync.
+//	The sync state is updated to the versions of the snapshots the changes were read from, so writes committed during the sync are included in the next sync.
+//	Changes applied by the sync are also sent back on the next sync, but are skipped on the other instance since the values already match.
+//	Deletes are not propagated, and compaction resets versions, so the sync state must be reset to zero after either instance is compacted.
+func Sync(local, remote *Mari, state *SyncState, opts *SyncOpts) (*SyncResult, error) {
+	var syncErr error
+
+	localChanges, syncErr := local.ChangesSince(state.LocalVersion)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+
+	remoteChanges, syncErr := remote.ChangesSince(state.RemoteVersion)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+
+	localResult, syncErr := local.ApplyChangeset(remoteChanges, state.LocalVersion, opts)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+
+	remoteResult, syncErr := remote.ApplyChangeset(localChanges, state.RemoteVersion, opts)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+
+	state.LocalVersion = localChanges.ToVersion
+	state.RemoteVersion = remoteChanges.ToVersion
+
+	return &SyncResult{
+		Applied:   localResult.Applied + remoteResult.Applied,
+		Conflicts: localResult.Conflicts + remoteResult.Conflicts,
+		Skipped:   localResult.Skipped + remoteResult.Skipped,
+	}, nil
+}
+
+// ChangesSince
+//
+//	Collect every key-value pair written after a version in a single read only snapshot.
+//	Keys and values are copied out of the memory map, so the changeset remains valid after the memory map is resized or the instance is closed.
+//	Keys under ReservedKeyPrefix hold state local to the instance, so they are not included. Tombstones are stored under it too, so deletes are not included even with Tombstones.
+//	Values moved to the cold file are read from it with the version and timestamp they were written at, and a key whose value was only moved since the version is not a change, so tiering never makes a stale value win a conflict.
+func (mariInst *Mari) ChangesSince(version uint64) (*Changeset, error) {
+	changeset := &Changeset{FromVersion: version}
+	changesErr := mariInst.ReadTx(func(tx *Tx) error {
+		root := loadINodeFromPointer(tx.root)
+		changeset.ToVersion = root.version
+		changeset.Timestamp = root.leaf.timestamp
+
+		minVersion := version + 1
+		guardErr := tx.checkReadGuard()
+		if guardErr != nil {
+			return guardErr
+		}
+
+		kvPairs, rangeErr := tx.scanChunks(minVersion, nil, nil, 0, nil, nil, false)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		changeset.Changes = make([]*KeyValuePair, 0, len(kvPairs))
+		for _, kvPair := range kvPairs {
+			if isReservedKey(kvPair.Key) {
+				continue
+			}
+
+			kvPair, rangeErr = mariInst.thawChange(kvPair, minVersion)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if kvPair == nil {
+				continue
+			}
+
+			changeset.Changes = append(changeset.Changes, &KeyValuePair{
+				Version:   kvPair.Version,
+				Timestamp: kvPair.Timestamp,
+				Key:       bytes.Clone(kvPair.Key),
+				Value:     bytes.Clone(kvPair.Value),
+			})
+		}
+
+		return nil
+	})
+
+	if changesErr != nil {
+		return nil, changesErr
+	}
+	return changeset, nil
+}
+
+// ApplyChangeset
+//
+//	Apply a changeset from another instance in batched read-write transactions.
+//	A key is in conflict if it was also written locally after localSince with a different value, in which case the resolver determines the value to keep.
+//	Changes that already match the local value are skipped.
+//	The changeset timestamp is merged into the hybrid logical clock first, so the applied changes are committed after the remote writes in timestamp order.
+func (mariInst *Mari) ApplyChangeset(remote *Changeset, localSince uint64, opts *SyncOpts) (*SyncResult, error) {
+	resolver := DefaultConflictResolver
+	if opts != nil && opts.Resolver != nil {
+		resolver = *opts.Resolver
+	}
+
+	batchSize := DefaultSyncBatchSize
+	if opts != nil && opts.BatchSize != nil && *opts.BatchSize > 0 {
+		batchSize = *opts.BatchSize
+	}
+
+	mariInst.clock.Update(remote.Timestamp)
+
+	result := &SyncResult{}
+	for start := 0; start < len(remote.Changes); start += batchSize {
+		end := min(start+batchSize, len(remote.Changes))
+
+		var batchResult SyncResult
+		applyErr := mariInst.UpdateTx(func(tx *Tx) error {
+			batchResult = SyncResult{}
+			for _, change := range remote.Changes[start:end] {
+				applied, conflict, applyTxErr := applyChange(tx, change, localSince, resolver)
+				if applyTxErr != nil {
+					return applyTxErr
+				}
+
+				switch {
+				case conflict:
+					batchResult.Conflicts++
+					if applied {
+						batchResult.Applied++
+					}
+				case applied:
+					batchResult.Applied++
+				default:
+					batchResult.Skipped++
+				}
+			}
+
+			return nil
+		})
+
+		if applyErr != nil {
+			return nil, applyErr
+		}
+
+		result.Applied += batchResult.Applied
+		result.Conflicts += batchResult.Conflicts
+		result.Skipped += batchResult.Skipped
+	}
+
+	return result, nil
+}
+
+// applyChange
+//
+//	Apply a single remote change within a transaction, returning whether the local instance was modified and whether the change was in conflict.
+//	A local value moved to the cold file is compared by the version it was written at, so a value only moved since localSince is not in conflict.
+func applyChange(tx *Tx, change *KeyValuePair, localSince uint64, resolver ConflictResolver) (bool, bool, error) {
+	local, getErr := tx.getWritten(change.Key)
+	if getErr != nil {
+		return false, false, getErr
+	}
+
+	switch {
+	case local != nil && bytes.Equal(local.Value, change.Value):
+		return false, false, nil
+	case local != nil && local.Version > localSince:
+		resolved, resolveErr := resolver(local, change)
+		if resolveErr != nil {
+			return false, true, resolveErr
+		}
+
+		switch {
+		case resolved == nil:
+			return true, true, tx.Delete(change.Key)
+		case bytes.Equal(resolved.Value, local.Value):
+			return false, true, nil
+		default:
+			return true, true, tx.Put(change.Key, resolved.Value)
+		}
+	default:
+		return true, false, tx.Put(change.Key, change.Value)
+	}
+}
+
+// MarshalBinary
+//
+//	Serialize a changeset so it can be sent to another instance.
+//	The layout is the from version, the to version, the timestamp, and the total changes (8 bytes each), followed by each change as the version (8 bytes), timestamp (8 bytes), key length (4 bytes), key, value length (4 bytes), and value.
+func (changeset *Changeset) MarshalBinary() ([]byte, error) {
+	sChangeset := serializeUint64(changeset.FromVersion)
+	sChangeset = append(sChangeset, serializeUint64(changeset.ToVersion)...)
+	sChangeset = append(sChangeset, serializeUint64(changeset.Timestamp)...)
+	sChangeset = append(sChangeset, serializeUint64(uint64(len(changeset.Changes)))...)
+
+	for _, change := range changeset.Changes {
+		sChangeset = append(sChangeset, serializeUint64(change.Version)...)
+		sChangeset = append(sChangeset, serializeUint64(change.Timestamp)...)
+		sChangeset = append(sChangeset, serializeUint32(uint32(len(change.Key)))...)
+		sChangeset = append(sChangeset, change.Key...)
+		sChangeset = append(sChangeset, serializeUint32(uint32(len(change.Value)))...)
+		sChangeset = append(sChangeset, change.Value...)
+	}
+
+	return sChangeset, nil
+}
+
+// UnmarshalBinary
+//
+//	Deserialize the byte representation of a changeset. Keys and values are copied, so the input can be reused.
+func (changeset *Changeset) UnmarshalBinary(sChangeset []byte) error {
+	invalidErr := errors.New("invalid data length for serialized changeset")
+	if len(sChangeset) < 4*OffsetSize64 {
+		return invalidErr
+	}
+
+	fromVersion, _ := deserializeUint64(sChangeset[:OffsetSize64])
+	toVersion, _ := deserializeUint64(sChangeset[OffsetSize64 : 2*OffsetSize64])
+	timestamp, _ := deserializeUint64(sChangeset[2*OffsetSize64 : 3*OffsetSize64])
+	totalChanges, _ := deserializeUint64(sChangeset[3*OffsetSize64 : 4*OffsetSize64])
+
+	readBytes := func(offset int) ([]byte, int, error) {
+		if offset+OffsetSize32 > len(sChangeset) {
+			return nil, 0, invalidErr
+		}
+
+		length, _ := deserializeUint32(sChangeset[offset : offset+OffsetSize32])
+		start := offset + OffsetSize32
+		if uint64(start)+uint64(length) > uint64(len(sChangeset)) {
+			return nil, 0, invalidErr
+		}
+
+		end := start + int(length)
+		return bytes.Clone(sChangeset[start:end]), end, nil
+	}
+
+	var changes []*KeyValuePair
+	offset := 4 * OffsetSize64
+	for range totalChanges {
+		if offset+2*OffsetSize64 > len(sChangeset) {
+			return invalidErr
+		}
+
+		version, _ := deserializeUint64(sChangeset[offset : offset+OffsetSize64])
+		timestamp, _ := deserializeUint64(sChangeset[offset+OffsetSize64 : offset+2*OffsetSize64])
+		key, nextOffset, readErr := readBytes(offset + 2*OffsetSize64)
+		if readErr != nil {
+			return readErr
+		}
+
+		value, nextOffset, readErr := readBytes(nextOffset)
+		if readErr != nil {
+			return readErr
+		}
+
+		changes = append(changes, &KeyValuePair{Version: version, Timestamp: timestamp, Key: key, Value: value})
+		offset = nextOffset
+	}
+
+	changeset.FromVersion = fromVersion
+	changeset.ToVersion = toVersion
+	changeset.Timestamp = timestamp
+	changeset.Changes = changes
+	return nil
+}
@@ -0,0 +1,156 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const ACCESS_INPUT_SIZE = 20
+
+var accessOpts mariv2.InitOpts
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testaccess"))
+	os.Remove(filepath.Join(os.TempDir(), "testaccess"+mariv2.ColdFileExt))
+
+	nodePoolSize := int64(1000)
+	accessPrefixLength := 5
+	accessSampleRate := float64(1)
+	accessRecordInterval := time.Hour
+	accessOpts = mariv2.InitOpts{
+		Filepath:             os.TempDir(),
+		FileName:             "testaccess",
+		NodePoolSize:         &nodePoolSize,
+		AccessPrefixLength:   &accessPrefixLength,
+		AccessSampleRate:     &accessSampleRate,
+		AccessRecordInterval: &accessRecordInterval,
+	}
+
+	fmt.Println("access test mari initialized")
+}
+
+func TestMariAccessTracking(t *testing.T) {
+	defer os.Remove(filepath.Join(os.TempDir(), "testaccess"))
+	defer os.Remove(filepath.Join(os.TempDir(), "testaccess"+mariv2.ColdFileExt))
+
+	writeMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testaccess"})
+	if openErr != nil {
+		t.Fatalf("error opening mari: %s", openErr.Error())
+	}
+
+	putErr := writeMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range ACCESS_INPUT_SIZE {
+			for _, prefix := range []string{"used:", "idle:"} {
+				putTxErr := tx.Put([]byte(fmt.Sprintf("%s%03d", prefix, idx)), bytes.Repeat([]byte("v"), 512))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put: %s", putErr.Error())
+	}
+
+	closeErr := writeMariInst.Close()
+	if closeErr != nil {
+		t.Fatalf("error closing mari: %s", closeErr.Error())
+	}
+
+	time.Sleep(3500 * time.Millisecond)
+
+	t.Run("Test Access Report", func(t *testing.T) {
+		accessMariInst, openErr := mariv2.Open(accessOpts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer accessMariInst.Close()
+
+		readErr := accessMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getErr := tx.Get([]byte("used:000"), nil)
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		report, reportErr := accessMariInst.AccessReport(time.Hour)
+		if reportErr != nil {
+			t.Fatalf("error reporting access: %s", reportErr.Error())
+		}
+
+		if len(report.Active) != 1 || !bytes.Equal(report.Active[0].Prefix, []byte("used:")) || report.ActiveKeys != ACCESS_INPUT_SIZE {
+			t.Errorf("expected the read prefix to be active: actual(%v, %d)", report.Active, report.ActiveKeys)
+		}
+
+		if len(report.Unused) != 1 || !bytes.Equal(report.Unused[0].Prefix, []byte("idle:")) || !report.Unused[0].LastAccess.IsZero() || report.UnusedKeys != ACCESS_INPUT_SIZE {
+			t.Errorf("expected the prefix never accessed to be unused: actual(%v, %d)", report.Unused, report.UnusedKeys)
+		}
+
+		recorded, recordErr := accessMariInst.RecordAccessTimes()
+		if recordErr != nil || recorded != 1 {
+			t.Fatalf("expected the sampled prefix to be recorded: actual(%d, %v)", recorded, recordErr)
+		}
+
+		recorded, recordErr = accessMariInst.RecordAccessTimes()
+		if recordErr != nil || recorded != 0 {
+			t.Errorf("expected nothing new to be recorded: actual(%d, %v)", recorded, recordErr)
+		}
+	})
+
+	t.Run("Test Recorded Access Times", func(t *testing.T) {
+		reopenedMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testaccess"})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer reopenedMariInst.Close()
+
+		accesses, accessErr := reopenedMariInst.AccessTimes()
+		if accessErr != nil {
+			t.Fatalf("error getting access times: %s", accessErr.Error())
+		}
+
+		if len(accesses) != 1 || !bytes.Equal(accesses[0].Prefix, []byte("used:")) || time.Since(accesses[0].LastAccess) > time.Minute {
+			t.Errorf("expected the recorded access to outlive the instance: actual(%v)", accesses)
+		}
+
+		report, reportErr := reopenedMariInst.AccessReport(time.Hour)
+		if reportErr != nil || report != nil {
+			t.Errorf("expected no report without access tracking: actual(%v, %v)", report, reportErr)
+		}
+	})
+
+	t.Run("Test Tier With Recorded Access", func(t *testing.T) {
+		coldAfter := 3 * time.Second
+		opts := accessOpts
+		opts.ColdAfter = &coldAfter
+
+		tieringMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer tieringMariInst.Close()
+
+		moved, tierErr := tieringMariInst.TierColdValues()
+		if tierErr != nil {
+			t.Fatalf("error moving cold values: %s", tierErr.Error())
+		}
+
+		if moved != ACCESS_INPUT_SIZE {
+			t.Errorf("expected only the values of the prefix not accessed before the open to be moved: actual(%d)", moved)
+		}
+	})
+}
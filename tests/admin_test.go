@@ -0,0 +1,164 @@
+package maritests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var adminMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testadmin"))
+
+	nodePoolSize := int64(1000)
+	warnThreshold := 10 * time.Millisecond
+	opts := mariv2.InitOpts{
+		Filepath:            os.TempDir(),
+		FileName:            "testadmin",
+		NodePoolSize:        &nodePoolSize,
+		ReadTxWarnThreshold: &warnThreshold,
+	}
+
+	var openErr error
+	adminMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := adminMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range 10 {
+			putTxErr := tx.Put([]byte(fmt.Sprintf("admin:%d", idx)), []byte(fmt.Sprintf("<value %d>", idx)))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("admin test mari initialized")
+}
+
+func TestMariAdmin(t *testing.T) {
+	defer adminMariInst.Remove()
+
+	server := httptest.NewServer(adminMariInst.AdminHandler())
+	defer server.Close()
+
+	get := func(t *testing.T, path string) (int, string) {
+		resp, getErr := http.Get(server.URL + path)
+		if getErr != nil {
+			t.Fatalf("error on admin request: %s", getErr.Error())
+		}
+
+		defer resp.Body.Close()
+		body, readErr := io.ReadAll(resp.Body)
+		if readErr != nil {
+			t.Fatalf("error reading admin response: %s", readErr.Error())
+		}
+
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("Test Admin Page", func(t *testing.T) {
+		status, body := get(t, "/?depth=6")
+		if status != http.StatusOK {
+			t.Fatalf("expected the admin page to be served: actual(%d)", status)
+		}
+
+		for _, section := range []string{"stats", "versions", "prefixes of length 6", "slow transactions"} {
+			if !strings.Contains(body, section) {
+				t.Errorf("expected the admin page to show %s", section)
+			}
+		}
+
+		if !strings.Contains(body, "<td>admin:</td><td>10</td>") {
+			t.Errorf("expected the admin page to count the keys under the prefix: actual(%s)", body)
+		}
+
+		_, body = get(t, fmt.Sprintf("/?depth=%d", 1000))
+		if !strings.Contains(body, fmt.Sprintf("prefixes of length %d", mariv2.AdminMaxPrefixDepth)) {
+			t.Errorf("expected the depth to be capped at %d: actual(%s)", mariv2.AdminMaxPrefixDepth, body)
+		}
+	})
+
+	t.Run("Test Admin Lookup", func(t *testing.T) {
+		_, body := get(t, "/?key="+url.QueryEscape("admin:3"))
+		if !strings.Contains(body, "&lt;value 3&gt;") {
+			t.Errorf("expected the value to be looked up and escaped: actual(%s)", body)
+		}
+
+		_, body = get(t, "/?key=missing")
+		if !strings.Contains(body, "key not found") {
+			t.Errorf("expected a missing key to be reported: actual(%s)", body)
+		}
+	})
+
+	t.Run("Test Admin Stats JSON", func(t *testing.T) {
+		status, body := get(t, "/stats.json")
+		if status != http.StatusOK {
+			t.Fatalf("expected the stats to be served: actual(%d)", status)
+		}
+
+		var stats struct {
+			Version uint64 `json:"version"`
+		}
+
+		unmarshalErr := json.Unmarshal([]byte(body), &stats)
+		if unmarshalErr != nil {
+			t.Fatalf("error decoding stats: %s", unmarshalErr.Error())
+		}
+
+		if stats.Version == 0 {
+			t.Error("expected the stats to include the version")
+		}
+	})
+
+	t.Run("Test Admin Read Only", func(t *testing.T) {
+		resp, postErr := http.Post(server.URL+"/?key=admin:3", "text/plain", strings.NewReader("value"))
+		if postErr != nil {
+			t.Fatalf("error on admin request: %s", postErr.Error())
+		}
+
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("expected writes to be rejected: actual(%d)", resp.StatusCode)
+		}
+	})
+
+	t.Run("Test Admin Slow Ops", func(t *testing.T) {
+		readErr := adminMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		slowOps := adminMariInst.SlowOps()
+		if len(slowOps) == 0 || slowOps[0].Op != mariv2.ProfileOpRead {
+			t.Fatalf("expected the long read transaction to be recorded: actual(%v)", slowOps)
+		}
+
+		_, body := get(t, "/")
+		if !strings.Contains(body, "<td>read</td>") {
+			t.Errorf("expected the admin page to show the slow transaction: actual(%s)", body)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var auditMariInst *mariv2.Mari
+var auditLogPath = filepath.Join(os.TempDir(), "testaudit.log")
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testaudit"))
+	os.Remove(auditLogPath)
+
+	var openErr error
+	auditMariInst, openErr = openAuditInst()
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("audit test mari initialized")
+}
+
+// openAuditInst opens the audit test instance with the audit log
+func openAuditInst() (*mariv2.Mari, error) {
+	nodePoolSize := int64(1000)
+	return mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testaudit", NodePoolSize: &nodePoolSize, AuditLog: &auditLogPath})
+}
+
+func TestMariAuditLog(t *testing.T) {
+	defer func() {
+		auditMariInst.Remove()
+		os.Remove(auditLogPath)
+	}()
+
+	t.Run("Test Audit Operations", func(t *testing.T) {
+		updateErr := auditMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			tx.SetAnnotation("actor", "alice")
+			tx.SetAnnotation("request", "1")
+
+			putErr := tx.Put([]byte("audit:first"), []byte("value"))
+			if putErr != nil {
+				return putErr
+			}
+
+			return tx.PutWithTTL([]byte("audit:ttl"), []byte("expiring"), time.Hour)
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		updateErr = auditMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Delete([]byte("audit:first"))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari delete: %s", updateErr.Error())
+		}
+
+		readErr := auditMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			return tx.SetAnnotation("actor", "reader")
+		})
+
+		if readErr == nil {
+			t.Error("expected error on annotation of a read only transaction")
+		}
+
+		closeErr := auditMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error on mari close: %s", closeErr.Error())
+		}
+
+		entries, readLogErr := mariv2.ReadAuditLog(auditLogPath)
+		if readLogErr != nil {
+			t.Fatalf("error reading audit log: %s", readLogErr.Error())
+		}
+
+		if len(entries) != 3 {
+			t.Fatalf("expected an entry for each operation on a user key: actual(%d)", len(entries))
+		}
+
+		first, ttl, deleted := entries[0], entries[1], entries[2]
+		if first.Op != mariv2.AuditOpPut || !bytes.Equal(first.Key, []byte("audit:first")) || first.ValueSize != len("value") {
+			t.Errorf("expected the put: actual(%+v)", first)
+		}
+
+		if first.Annotations["actor"] != "alice" || first.Annotations["request"] != "1" || ttl.Annotations["actor"] != "alice" {
+			t.Errorf("expected the annotations of the transaction: actual(%v, %v)", first.Annotations, ttl.Annotations)
+		}
+
+		if first.Version != ttl.Version || first.Timestamp == 0 {
+			t.Errorf("expected the operations of a transaction to share the commit: actual(%+v, %+v)", first, ttl)
+		}
+
+		if deleted.Op != mariv2.AuditOpDelete || deleted.Version != first.Version+1 || deleted.Timestamp <= first.Timestamp || deleted.Annotations != nil {
+			t.Errorf("expected the delete in the next commit without annotations: actual(%+v)", deleted)
+		}
+	})
+
+	t.Run("Test Audit Reopen", func(t *testing.T) {
+		var openErr error
+		auditMariInst, openErr = openAuditInst()
+		if openErr != nil {
+			t.Fatalf("error on mari open: %s", openErr.Error())
+		}
+
+		putErr := auditMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("audit:reopened"), []byte("value"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		auditMariInst.Close()
+
+		entries, readLogErr := mariv2.ReadAuditLog(auditLogPath)
+		if readLogErr != nil {
+			t.Fatalf("error reading audit log: %s", readLogErr.Error())
+		}
+
+		if len(entries) != 4 || !bytes.Equal(entries[3].Key, []byte("audit:reopened")) || entries[3].Version != entries[2].Version+1 {
+			t.Errorf("expected the audit log to be appended to after reopen: actual(%d)", len(entries))
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var beginMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testbegin"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testbegin", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	beginMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("begin test mari initialized")
+}
+
+func TestMariBegin(t *testing.T) {
+	defer beginMariInst.Remove()
+
+	begin := func(readonly bool) *mariv2.Tx {
+		tx, beginErr := beginMariInst.Begin(readonly)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+		return tx
+	}
+
+	get := func(tx *mariv2.Tx, key string) *mariv2.KeyValuePair {
+		kvPair, getErr := tx.Get([]byte(key), nil)
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+		return kvPair
+	}
+
+	t.Run("Test Commit", func(t *testing.T) {
+		tx := begin(false)
+		putErr := tx.Put([]byte("hello"), []byte("world"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("error on mari commit: %s", commitErr.Error())
+		}
+
+		tx = begin(true)
+		defer tx.Rollback()
+
+		if kvPair := get(tx, "hello"); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("world")) {
+			t.Errorf("committed value not found: actual(%v)", kvPair)
+		}
+	})
+
+	t.Run("Test Rollback", func(t *testing.T) {
+		tx := begin(false)
+		putErr := tx.Put([]byte("discarded"), []byte("value"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			t.Fatalf("error on mari rollback: %s", rollbackErr.Error())
+		}
+
+		tx = begin(true)
+		defer tx.Commit()
+
+		if kvPair := get(tx, "discarded"); kvPair != nil {
+			t.Errorf("rolled back value found: actual(%v)", kvPair)
+		}
+	})
+
+	t.Run("Test Read Snapshot", func(t *testing.T) {
+		readTx := begin(true)
+
+		updateErr := beginMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("hello"), []byte("updated"))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		if kvPair := get(readTx, "hello"); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("world")) {
+			t.Errorf("read transaction did not read from its snapshot: actual(%v)", kvPair)
+		}
+
+		commitErr := readTx.Commit()
+		if commitErr != nil {
+			t.Fatalf("error on mari commit: %s", commitErr.Error())
+		}
+	})
+
+	t.Run("Test Conflict", func(t *testing.T) {
+		first, second := begin(false), begin(false)
+		first.Put([]byte("conflict"), []byte("first"))
+		second.Put([]byte("conflict"), []byte("second"))
+
+		commitErr := first.Commit()
+		if commitErr != nil {
+			t.Fatalf("error on mari commit: %s", commitErr.Error())
+		}
+
+		commitErr = second.Commit()
+		if !errors.Is(commitErr, mariv2.ErrTxConflict) {
+			t.Errorf("expected conflict on commit: actual(%v)", commitErr)
+		}
+
+		tx := begin(true)
+		defer tx.Rollback()
+
+		if kvPair := get(tx, "conflict"); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("first")) {
+			t.Errorf("expected first commit to win: actual(%v)", kvPair)
+		}
+	})
+
+	t.Run("Test Release Errors", func(t *testing.T) {
+		tx := begin(true)
+		tx.Rollback()
+
+		if releaseErr := tx.Commit(); !errors.Is(releaseErr, mariv2.ErrTxDone) {
+			t.Errorf("expected error on commit after rollback: actual(%v)", releaseErr)
+		}
+
+		if releaseErr := tx.Rollback(); !errors.Is(releaseErr, mariv2.ErrTxDone) {
+			t.Errorf("expected error on rollback after rollback: actual(%v)", releaseErr)
+		}
+
+		readErr := beginMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			if releaseErr := tx.Commit(); !errors.Is(releaseErr, mariv2.ErrTxNotManaged) {
+				t.Errorf("expected error on commit in closure: actual(%v)", releaseErr)
+			}
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Update Error Releases Lock", func(t *testing.T) {
+		updateErr := beginMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return errors.New("abort")
+		})
+
+		if updateErr == nil {
+			t.Fatal("expected error from update")
+		}
+
+		putDone := make(chan error, 1)
+		go func() {
+			putDone <- beginMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				value := make([]byte, mariv2.MaxValueSize)
+				for idx := range 70 * 1000 * 1000 / mariv2.MaxValueSize {
+					putErr := tx.Put([]byte(fmt.Sprintf("resize:%d", idx)), value)
+					if putErr != nil {
+						return putErr
+					}
+				}
+
+				return nil
+			})
+		}()
+
+		select {
+		case putErr := <-putDone:
+			if putErr != nil {
+				t.Fatalf("error on mari put: %s", putErr.Error())
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("resize blocked after failed update, resize lock not released")
+		}
+	})
+}
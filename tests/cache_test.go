@@ -0,0 +1,210 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var cacheMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testcache"))
+
+	nodePoolSize := int64(1000)
+	valueCacheSize := 2
+	negativeCacheSize := 2
+
+	var openErr error
+	cacheMariInst, openErr = mariv2.Open(mariv2.InitOpts{
+		Filepath:          os.TempDir(),
+		FileName:          "testcache",
+		NodePoolSize:      &nodePoolSize,
+		ValueCacheSize:    &valueCacheSize,
+		NegativeCacheSize: &negativeCacheSize,
+	})
+
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("cache test mari initialized")
+}
+
+func TestMariValueCache(t *testing.T) {
+	defer cacheMariInst.Remove()
+
+	put := func(t *testing.T, key, value string) {
+		putErr := cacheMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte(key), []byte(value))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+	}
+
+	get := func(t *testing.T, tx *mariv2.Tx, key string) []byte {
+		kvPair, getErr := tx.Get([]byte(key), nil)
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+
+		if kvPair == nil {
+			return nil
+		}
+
+		return kvPair.Value
+	}
+
+	read := func(t *testing.T, key string) []byte {
+		var value []byte
+		cacheMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			value = bytes.Clone(get(t, tx, key))
+			return nil
+		})
+
+		return value
+	}
+
+	allStats := func(t *testing.T) *mariv2.Stats {
+		cacheStats, statsErr := cacheMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		return cacheStats
+	}
+
+	stats := func(t *testing.T) mariv2.ValueCacheStats {
+		return allStats(t).ValueCache
+	}
+
+	t.Run("Test Cache Hit", func(t *testing.T) {
+		put(t, "hit", "first")
+
+		before := stats(t)
+		for idx := 0; idx < 3; idx++ {
+			if value := read(t, "hit"); !bytes.Equal(value, []byte("first")) {
+				t.Fatalf("expected the value put: actual(%s)", value)
+			}
+		}
+
+		after := stats(t)
+		if after.Misses-before.Misses != 1 || after.Hits-before.Hits != 2 {
+			t.Errorf("expected a miss then hits: actual(%d, %d)", after.Misses-before.Misses, after.Hits-before.Hits)
+		}
+	})
+
+	t.Run("Test Invalidation On Commit", func(t *testing.T) {
+		put(t, "invalidate", "first")
+		read(t, "invalidate")
+
+		before := stats(t)
+		put(t, "invalidate", "second")
+
+		if value := read(t, "invalidate"); !bytes.Equal(value, []byte("second")) {
+			t.Fatalf("expected the value of the latest commit: actual(%s)", value)
+		}
+
+		if stats(t).Invalidations-before.Invalidations != 1 {
+			t.Error("expected the cached key to be invalidated by the commit")
+		}
+
+		deleteErr := cacheMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Delete([]byte("invalidate"))
+		})
+
+		if deleteErr != nil {
+			t.Fatalf("error on mari delete: %s", deleteErr.Error())
+		}
+
+		if value := read(t, "invalidate"); value != nil {
+			t.Errorf("expected the deleted key to be missing: actual(%s)", value)
+		}
+	})
+
+	t.Run("Test Snapshot Reads", func(t *testing.T) {
+		put(t, "snapshot", "first")
+
+		tx, beginErr := cacheMariInst.Begin(true)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		defer tx.Rollback()
+
+		put(t, "snapshot", "second")
+		if value := read(t, "snapshot"); !bytes.Equal(value, []byte("second")) {
+			t.Fatalf("expected the value of the latest commit: actual(%s)", value)
+		}
+
+		if value := get(t, tx, "snapshot"); !bytes.Equal(value, []byte("first")) {
+			t.Errorf("expected the value at the snapshot of the transaction: actual(%s)", value)
+		}
+
+		writeErr := cacheMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			putErr := tx.Put([]byte("snapshot"), []byte("third"))
+			if putErr != nil {
+				return putErr
+			}
+
+			if value := get(t, tx, "snapshot"); !bytes.Equal(value, []byte("third")) {
+				return fmt.Errorf("expected the write of the transaction: actual(%s)", value)
+			}
+
+			return nil
+		})
+
+		if writeErr != nil {
+			t.Fatal(writeErr.Error())
+		}
+	})
+
+	t.Run("Test Eviction", func(t *testing.T) {
+		for _, key := range []string{"evict:first", "evict:second", "evict:third"} {
+			put(t, key, key)
+			read(t, key)
+		}
+
+		cacheStats := stats(t)
+		if cacheStats.Entries != 2 || cacheStats.Evictions == 0 {
+			t.Errorf("expected the cache to be bounded: actual(%d, %d)", cacheStats.Entries, cacheStats.Evictions)
+		}
+
+		before := stats(t)
+		if value := read(t, "evict:first"); !bytes.Equal(value, []byte("evict:first")) {
+			t.Fatalf("expected the evicted key to be read from the trie: actual(%s)", value)
+		}
+
+		if stats(t).Misses-before.Misses != 1 {
+			t.Error("expected a miss on the least recently used key")
+		}
+	})
+	t.Run("Test Negative Cache", func(t *testing.T) {
+		before := allStats(t).NegativeCache
+		for idx := 0; idx < 3; idx++ {
+			if value := read(t, "negative:polled"); value != nil {
+				t.Fatalf("expected the key to be missing: actual(%s)", value)
+			}
+		}
+
+		after := allStats(t).NegativeCache
+		if after.Misses-before.Misses != 1 || after.Hits-before.Hits != 2 {
+			t.Errorf("expected a miss then hits: actual(%d, %d)", after.Misses-before.Misses, after.Hits-before.Hits)
+		}
+
+		put(t, "negative:polled", "present")
+		if value := read(t, "negative:polled"); !bytes.Equal(value, []byte("present")) {
+			t.Fatalf("expected the key written after the miss: actual(%s)", value)
+		}
+
+		if allStats(t).NegativeCache.Invalidations-after.Invalidations != 1 {
+			t.Error("expected the missing key to be invalidated by the commit")
+		}
+	})
+}
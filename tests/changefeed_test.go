@@ -0,0 +1,264 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var changefeedMariInst *mariv2.Mari
+var changefeedOpts mariv2.InitOpts
+var changefeedCompactNow atomic.Bool
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testchangefeed"))
+
+	nodePoolSize := int64(1000)
+	compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return changefeedCompactNow.CompareAndSwap(true, false) })
+	changefeedOpts = mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testchangefeed", NodePoolSize: &nodePoolSize, CompactTrigger: &compactTrigger}
+
+	var openErr error
+	changefeedMariInst, openErr = mariv2.Open(changefeedOpts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("changefeed test mari initialized")
+}
+
+func TestMariChangefeed(t *testing.T) {
+	defer func() { changefeedMariInst.Remove() }()
+
+	nextEvent := func(t *testing.T, feed *mariv2.Changefeed) *mariv2.CommitEvent {
+		select {
+		case event, ok := <-feed.Events():
+			if !ok {
+				t.Fatalf("changefeed stopped: %v", feed.Err())
+			}
+
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a changefeed event")
+			return nil
+		}
+	}
+
+	commit := func(t *testing.T, ops func(tx *mariv2.Tx) error) {
+		updateErr := changefeedMariInst.UpdateTx(ops)
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+	}
+
+	t.Run("Test Prefix And Op Filters", func(t *testing.T) {
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("filter:a:old"), []byte("old")) })
+
+		feed, feedErr := changefeedMariInst.Changefeed(mariv2.ChangefeedOpts{Prefix: []byte("filter:a:"), Ops: []mariv2.AuditOp{mariv2.AuditOpPut}})
+		if feedErr != nil {
+			t.Fatalf("error opening changefeed: %s", feedErr.Error())
+		}
+
+		defer feed.Close()
+
+		commit(t, func(tx *mariv2.Tx) error {
+			putErr := tx.Put([]byte("filter:a:1"), []byte("one"))
+			if putErr != nil {
+				return putErr
+			}
+
+			return tx.Put([]byte("filter:b:1"), []byte("one"))
+		})
+
+		commit(t, func(tx *mariv2.Tx) error { return tx.Delete([]byte("filter:a:old")) })
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("filter:a:2"), []byte("two")) })
+
+		first := nextEvent(t, feed)
+		if len(first.Changes) != 1 || !bytes.Equal(first.Changes[0].Key, []byte("filter:a:1")) || first.Changes[0].Delete {
+			t.Fatalf("expected only the put matching the prefix: actual(%v)", first.Changes)
+		}
+
+		second := nextEvent(t, feed)
+		if second.Version != first.Version+2 || len(second.Changes) != 1 || !bytes.Equal(second.Changes[0].Key, []byte("filter:a:2")) {
+			t.Fatalf("expected the delete to be filtered: actual(%d, %v)", second.Version, second.Changes)
+		}
+
+		_, opErr := changefeedMariInst.Changefeed(mariv2.ChangefeedOpts{Ops: []mariv2.AuditOp{"scan"}})
+		if opErr == nil {
+			t.Fatal("expected an error for an unknown op")
+		}
+	})
+
+	t.Run("Test Missed Events Are Rebuilt", func(t *testing.T) {
+		feed, feedErr := changefeedMariInst.Changefeed(mariv2.ChangefeedOpts{Prefix: []byte("gap:")})
+		if feedErr != nil {
+			t.Fatalf("error opening changefeed: %s", feedErr.Error())
+		}
+
+		defer feed.Close()
+
+		for idx := range 20 {
+			commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte(fmt.Sprintf("gap:%02d", idx)), []byte("value")) })
+		}
+
+		var lastVersion uint64
+		for idx := range 20 {
+			event := nextEvent(t, feed)
+			if lastVersion != 0 && event.Version != lastVersion+1 {
+				t.Fatalf("expected contiguous versions: expected(%d), actual(%d)", lastVersion+1, event.Version)
+			}
+
+			expectedKey := []byte(fmt.Sprintf("gap:%02d", idx))
+			if len(event.Changes) != 1 || !bytes.Equal(event.Changes[0].Key, expectedKey) || !bytes.Equal(event.Changes[0].Value, []byte("value")) {
+				t.Fatalf("expected the put of %s: actual(%v)", expectedKey, event.Changes)
+			}
+
+			lastVersion = event.Version
+		}
+	})
+
+	t.Run("Test Resume From Cursor", func(t *testing.T) {
+		opts := mariv2.ChangefeedOpts{Cursor: "consumer", Prefix: []byte("resume:")}
+		feed, feedErr := changefeedMariInst.Changefeed(opts)
+		if feedErr != nil {
+			t.Fatalf("error opening changefeed: %s", feedErr.Error())
+		}
+
+		commit(t, func(tx *mariv2.Tx) error {
+			for idx := range 500 {
+				putErr := tx.Put([]byte(fmt.Sprintf("resume:%03d", idx)), []byte("value"))
+				if putErr != nil {
+					return putErr
+				}
+			}
+
+			return nil
+		})
+
+		event := nextEvent(t, feed)
+		if len(event.Changes) != 500 {
+			t.Fatalf("expected every put: actual(%d)", len(event.Changes))
+		}
+
+		ackErr := feed.Ack(event.Version)
+		if ackErr != nil {
+			t.Fatalf("error acking version: %s", ackErr.Error())
+		}
+
+		feed.Close()
+
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("resume:new"), []byte("new")) })
+		commit(t, func(tx *mariv2.Tx) error {
+			for idx := range 500 {
+				deleteErr := tx.Delete([]byte(fmt.Sprintf("resume:%03d", idx)))
+				if deleteErr != nil {
+					return deleteErr
+				}
+			}
+
+			return nil
+		})
+
+		closeErr := changefeedMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		var openErr error
+		changefeedMariInst, openErr = mariv2.Open(changefeedOpts)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		feed, feedErr = changefeedMariInst.Changefeed(opts)
+		if feedErr != nil {
+			t.Fatalf("error reopening changefeed: %s", feedErr.Error())
+		}
+
+		defer feed.Close()
+
+		putEvent := nextEvent(t, feed)
+		if putEvent.Version <= event.Version || len(putEvent.Changes) != 1 || !bytes.Equal(putEvent.Changes[0].Value, []byte("new")) {
+			t.Fatalf("expected the put after the acked version: actual(%d, %v)", putEvent.Version, putEvent.Changes)
+		}
+
+		deleteEvent := nextEvent(t, feed)
+		if len(deleteEvent.Changes) != 500 {
+			t.Fatalf("expected every delete: actual(%d)", len(deleteEvent.Changes))
+		}
+
+		for idx, change := range deleteEvent.Changes {
+			if !change.Delete || !bytes.Equal(change.Key, []byte(fmt.Sprintf("resume:%03d", idx))) {
+				t.Fatalf("expected the delete of resume:%03d: actual(%s, %t)", idx, change.Key, change.Delete)
+			}
+		}
+
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("resume:live"), []byte("live")) })
+
+		liveEvent := nextEvent(t, feed)
+		if liveEvent.Version <= deleteEvent.Version || !bytes.Equal(liveEvent.Changes[0].Key, []byte("resume:live")) {
+			t.Fatalf("expected the live put: actual(%d, %v)", liveEvent.Version, liveEvent.Changes)
+		}
+	})
+
+	t.Run("Test Cursor Reset By Compaction", func(t *testing.T) {
+		stats, statsErr := changefeedMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for version := stats.Version; stats.Version >= version; {
+			if time.Now().After(deadline) {
+				t.Fatal("file was not compacted")
+			}
+
+			changefeedCompactNow.Store(true)
+			commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("compact"), []byte("value")) })
+			time.Sleep(10 * time.Millisecond)
+
+			stats, statsErr = changefeedMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+		}
+
+		_, feedErr := changefeedMariInst.Changefeed(mariv2.ChangefeedOpts{Cursor: "consumer"})
+		if !errors.Is(feedErr, mariv2.ErrChangefeedReset) {
+			t.Fatalf("expected ErrChangefeedReset: actual(%v)", feedErr)
+		}
+
+		resetErr := changefeedMariInst.ResetChangefeed("consumer")
+		if resetErr != nil {
+			t.Fatalf("error resetting cursor: %s", resetErr.Error())
+		}
+
+		feed, feedErr := changefeedMariInst.Changefeed(mariv2.ChangefeedOpts{Cursor: "consumer"})
+		if feedErr != nil {
+			t.Fatalf("error opening changefeed after reset: %s", feedErr.Error())
+		}
+
+		feed.Close()
+		if feed.Err() != nil {
+			t.Fatalf("expected no error after close: actual(%s)", feed.Err().Error())
+		}
+
+		noCursor, feedErr := changefeedMariInst.Changefeed(mariv2.ChangefeedOpts{})
+		if feedErr != nil {
+			t.Fatalf("error opening changefeed: %s", feedErr.Error())
+		}
+
+		defer noCursor.Close()
+
+		ackErr := noCursor.Ack(0)
+		if ackErr == nil {
+			t.Fatal("expected an error acking without a cursor")
+		}
+	})
+}
@@ -0,0 +1,323 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var checkpointMariInst *mariv2.Mari
+var checkpointCompactNow atomic.Bool
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testcheckpoint"))
+
+	nodePoolSize := int64(1000)
+	compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return checkpointCompactNow.CompareAndSwap(true, false) })
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testcheckpoint", NodePoolSize: &nodePoolSize, CompactTrigger: &compactTrigger}
+
+	var openErr error
+	checkpointMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("checkpoint test mari initialized")
+}
+
+func TestMariCheckpoint(t *testing.T) {
+	defer checkpointMariInst.Remove()
+
+	commit := func(t *testing.T, txOps func(tx *mariv2.Tx) error) {
+		updateErr := checkpointMariInst.UpdateTx(txOps)
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+	}
+
+	get := func(t *testing.T, key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		readErr := checkpointMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getErr error
+			kvPair, getErr = tx.Get(key, nil)
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		return kvPair
+	}
+
+	var expiresAt time.Time
+
+	t.Run("Test Read At Checkpoint", func(t *testing.T) {
+		commit(t, func(tx *mariv2.Tx) error {
+			putErr := tx.Put([]byte("config"), []byte("v1"))
+			if putErr != nil {
+				return putErr
+			}
+
+			return tx.PutWithTTL([]byte("session"), []byte("token"), time.Hour)
+		})
+
+		readErr := checkpointMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getErr error
+			expiresAt, getErr = tx.ExpiresAt([]byte("session"))
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error getting expiration: %s", readErr.Error())
+		}
+
+		stats, statsErr := checkpointMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		version, checkpointErr := checkpointMariInst.Checkpoint("pre-migration")
+		if checkpointErr != nil {
+			t.Fatalf("error taking checkpoint: %s", checkpointErr.Error())
+		}
+
+		if version != stats.Version {
+			t.Fatalf("checkpoint did not tag the latest version: actual(%d), expected(%d)", version, stats.Version)
+		}
+
+		commit(t, func(tx *mariv2.Tx) error {
+			putErr := tx.Put([]byte("config"), []byte("v2"))
+			if putErr != nil {
+				return putErr
+			}
+
+			putErr = tx.Put([]byte("added"), []byte("value"))
+			if putErr != nil {
+				return putErr
+			}
+
+			return tx.Delete([]byte("session"))
+		})
+
+		readErr = checkpointMariInst.ReadTxAtCheckpoint("pre-migration", func(tx *mariv2.Tx) error {
+			if tx.SnapshotVersion() != version {
+				t.Errorf("read the wrong version: actual(%d), expected(%d)", tx.SnapshotVersion(), version)
+			}
+
+			kvPair, getErr := tx.Get([]byte("config"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v1")) {
+				t.Errorf("expected the value at the checkpoint: actual(%v)", kvPair)
+			}
+
+			kvPair, getErr = tx.Get([]byte("added"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil {
+				t.Errorf("expected the key added after the checkpoint to be missing: actual(%s)", kvPair.Value)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error reading at checkpoint: %s", readErr.Error())
+		}
+
+		readErr = checkpointMariInst.ReadTxAtCheckpoint("missing", func(tx *mariv2.Tx) error { return nil })
+		if !errors.Is(readErr, mariv2.ErrCheckpointNotFound) {
+			t.Fatalf("expected ErrCheckpointNotFound: actual(%v)", readErr)
+		}
+	})
+
+	t.Run("Test Rollback To Checkpoint", func(t *testing.T) {
+		stats, statsErr := checkpointMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		commitChan, cancel := checkpointMariInst.CommitChan(1)
+		defer cancel()
+
+		rollbackErr := checkpointMariInst.RollbackToCheckpoint("pre-migration")
+		if rollbackErr != nil {
+			t.Fatalf("error rolling back: %s", rollbackErr.Error())
+		}
+
+		rolledBack, statsErr := checkpointMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		if rolledBack.Version != stats.Version+1 {
+			t.Fatalf("expected the rollback to be committed as a new version: actual(%d), expected(%d)", rolledBack.Version, stats.Version+1)
+		}
+
+		select {
+		case event := <-commitChan:
+			if event.Annotations[mariv2.RollbackAnnotation] == "" || len(event.Changes) != 3 {
+				t.Fatalf("expected the annotated rollback to undo every change: actual(%v, %v)", event.Annotations, event.Changes)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the rollback commit")
+		}
+
+		if kvPair := get(t, []byte("config")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v1")) {
+			t.Fatalf("expected the value to be rolled back: actual(%v)", kvPair)
+		}
+
+		if kvPair := get(t, []byte("added")); kvPair != nil {
+			t.Fatalf("expected the added key to be deleted: actual(%s)", kvPair.Value)
+		}
+
+		if kvPair := get(t, []byte("session")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("token")) {
+			t.Fatalf("expected the deleted key to be restored: actual(%v)", kvPair)
+		}
+
+		readErr := checkpointMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			restored, getErr := tx.ExpiresAt([]byte("session"))
+			if getErr != nil {
+				return getErr
+			}
+
+			if !restored.Equal(expiresAt) {
+				t.Errorf("expected the expiration to be restored: actual(%s), expected(%s)", restored, expiresAt)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error getting expiration: %s", readErr.Error())
+		}
+
+		rollbackErr = checkpointMariInst.RollbackToCheckpoint("missing")
+		if !errors.Is(rollbackErr, mariv2.ErrCheckpointNotFound) {
+			t.Fatalf("expected ErrCheckpointNotFound: actual(%v)", rollbackErr)
+		}
+	})
+
+	t.Run("Test Rollback To Version", func(t *testing.T) {
+		stats, statsErr := checkpointMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		for idx := range 10 {
+			commit(t, func(tx *mariv2.Tx) error {
+				return tx.Put([]byte(fmt.Sprintf("deploy:%d", idx)), []byte("bad"))
+			})
+		}
+
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("config"), []byte("v3")) })
+
+		rollbackErr := checkpointMariInst.RollbackTo(stats.Version)
+		if rollbackErr != nil {
+			t.Fatalf("error rolling back: %s", rollbackErr.Error())
+		}
+
+		readErr := checkpointMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range([]byte("deploy:"), []byte("deploy;"), nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 0 {
+				t.Errorf("expected the keys written after the version to be deleted: actual(%d)", len(kvPairs))
+			}
+
+			kvPair, getErr := tx.Get([]byte("config"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v1")) {
+				t.Errorf("expected the value at the version: actual(%v)", kvPair)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		rollbackErr = checkpointMariInst.RollbackTo(stats.Version + 1000)
+		if !errors.Is(rollbackErr, mariv2.ErrVersionNotFound) {
+			t.Fatalf("expected ErrVersionNotFound: actual(%v)", rollbackErr)
+		}
+	})
+
+	t.Run("Test Checkpoints Reset By Compaction", func(t *testing.T) {
+		checkpoints, listErr := checkpointMariInst.Checkpoints()
+		if listErr != nil {
+			t.Fatalf("error listing checkpoints: %s", listErr.Error())
+		}
+
+		if len(checkpoints) != 1 || checkpoints[0].Name != "pre-migration" || !checkpoints[0].Retained {
+			t.Fatalf("expected the retained checkpoint: actual(%+v)", checkpoints)
+		}
+
+		stats, statsErr := checkpointMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for version := stats.Version; stats.Version >= version; {
+			if time.Now().After(deadline) {
+				t.Fatal("file was not compacted")
+			}
+
+			checkpointCompactNow.Store(true)
+			commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("compact"), []byte("value")) })
+			time.Sleep(10 * time.Millisecond)
+
+			stats, statsErr = checkpointMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+		}
+
+		checkpoints, listErr = checkpointMariInst.Checkpoints()
+		if listErr != nil {
+			t.Fatalf("error listing checkpoints: %s", listErr.Error())
+		}
+
+		if len(checkpoints) != 1 || checkpoints[0].Retained {
+			t.Fatalf("expected the checkpoint to no longer be retained: actual(%+v)", checkpoints)
+		}
+
+		readErr := checkpointMariInst.ReadTxAtCheckpoint("pre-migration", func(tx *mariv2.Tx) error { return nil })
+		if !errors.Is(readErr, mariv2.ErrVersionNotFound) {
+			t.Fatalf("expected ErrVersionNotFound: actual(%v)", readErr)
+		}
+
+		deleteErr := checkpointMariInst.DeleteCheckpoint("pre-migration")
+		if deleteErr != nil {
+			t.Fatalf("error deleting checkpoint: %s", deleteErr.Error())
+		}
+
+		checkpoints, listErr = checkpointMariInst.Checkpoints()
+		if listErr != nil {
+			t.Fatalf("error listing checkpoints: %s", listErr.Error())
+		}
+
+		if len(checkpoints) != 0 {
+			t.Fatalf("expected no checkpoints: actual(%+v)", checkpoints)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package maritests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const CHECKSUM_INPUT_SIZE = 1000
+
+var checksumOpts mariv2.InitOpts
+var checksumKeyValPairs []KeyVal
+var checksumLastKeyVal KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testchecksum"))
+
+	valueChecksums := true
+	nodePoolSize := int64(1000)
+	checksumOpts = mariv2.InitOpts{
+		Filepath:       os.TempDir(),
+		FileName:       "testchecksum",
+		NodePoolSize:   &nodePoolSize,
+		ValueChecksums: &valueChecksums,
+	}
+
+	checksumMariInst, openErr := mariv2.Open(checksumOpts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	checksumKeyValPairs = make([]KeyVal, CHECKSUM_INPUT_SIZE)
+	putErr := checksumMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range checksumKeyValPairs {
+			randomBytes, _ := GenerateRandomBytes(32)
+			checksumKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+
+			putTxErr := tx.Put(randomBytes, randomBytes)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	randomBytes, _ := GenerateRandomBytes(32)
+	checksumLastKeyVal = KeyVal{Key: randomBytes, Value: []byte("checksummed value")}
+	putErr = checksumMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put(checksumLastKeyVal.Key, checksumLastKeyVal.Value)
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	closeErr := checksumMariInst.Close()
+	if closeErr != nil {
+		panic(closeErr.Error())
+	}
+
+	fmt.Println("checksum test mari initialized")
+}
+
+func TestMariValueChecksums(t *testing.T) {
+	defer os.Remove(filepath.Join(os.TempDir(), "testchecksum"))
+
+	t.Run("Test Get Verified", func(t *testing.T) {
+		checksumMariInst, openErr := mariv2.Open(checksumOpts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer checksumMariInst.Close()
+
+		getErr := checksumMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, val := range append(checksumKeyValPairs, checksumLastKeyVal) {
+				kvPair, getTxErr := tx.GetVerified(val.Key)
+				if getTxErr != nil {
+					return getTxErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+					return fmt.Errorf("actual value not equal to expected for key %x", val.Key)
+				}
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Errorf("error getting verified values: %s", getErr.Error())
+		}
+
+		verifyErr := checksumMariInst.Verify()
+		if verifyErr != nil {
+			t.Errorf("error verifying mari: %s", verifyErr.Error())
+		}
+	})
+
+	t.Run("Test Get Verified Checksum Mismatch", func(t *testing.T) {
+		file, openErr := os.OpenFile(filepath.Join(os.TempDir(), "testchecksum"), os.O_RDWR, 0600)
+		if openErr != nil {
+			t.Fatalf("error opening file: %s", openErr.Error())
+		}
+
+		sEndSerialized := make([]byte, mariv2.OffsetSize64)
+		_, readErr := file.ReadAt(sEndSerialized, mariv2.MetaEndSerializedOffset)
+		if readErr != nil {
+			t.Fatalf("error reading end of serialized data: %s", readErr.Error())
+		}
+
+		serialized := make([]byte, binary.LittleEndian.Uint64(sEndSerialized))
+		_, readErr = file.ReadAt(serialized, 0)
+		if readErr != nil {
+			t.Fatalf("error reading serialized data: %s", readErr.Error())
+		}
+
+		// the value is written once, in the leaf of the last version
+		valueOffset := int64(bytes.LastIndex(serialized, checksumLastKeyVal.Value))
+		_, writeErr := file.WriteAt([]byte{^checksumLastKeyVal.Value[0]}, valueOffset)
+		if writeErr != nil {
+			t.Fatalf("error corrupting value: %s", writeErr.Error())
+		}
+
+		file.Close()
+
+		checksumMariInst, openErr := mariv2.Open(checksumOpts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer checksumMariInst.Close()
+
+		getErr := checksumMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getTxErr := tx.Get(checksumLastKeyVal.Key, nil)
+			if getTxErr != nil {
+				return getTxErr
+			}
+
+			if kvPair == nil || bytes.Equal(kvPair.Value, checksumLastKeyVal.Value) {
+				return errors.New("expected get to return the corrupted value without validation")
+			}
+
+			_, getTxErr = tx.GetVerified(checksumLastKeyVal.Key)
+			return getTxErr
+		})
+
+		if !errors.Is(getErr, mariv2.ErrChecksumMismatch) || !errors.Is(getErr, mariv2.ErrCorrupt) {
+			t.Fatalf("expected checksum mismatch error, got: %v", getErr)
+		}
+
+		var regionErr *mariv2.RegionError
+		if !errors.As(getErr, &regionErr) || regionErr.Offset > uint64(valueOffset) {
+			t.Errorf("expected region error with the offset of the leaf, got: %v", getErr)
+		}
+
+		verifyErr := checksumMariInst.Verify()
+		if !errors.Is(verifyErr, mariv2.ErrChecksumMismatch) {
+			t.Errorf("expected checksum mismatch error on verify, got: %v", verifyErr)
+		}
+
+		t.Log("checksum mismatch error:", getErr)
+	})
+
+	t.Run("Test Get Verified Without Checksums", func(t *testing.T) {
+		os.Remove(filepath.Join(os.TempDir(), "testnochecksum"))
+		defer os.Remove(filepath.Join(os.TempDir(), "testnochecksum"))
+
+		nodePoolSize := int64(1000)
+		opts := mariv2.InitOpts{
+			Filepath:     os.TempDir(),
+			FileName:     "testnochecksum",
+			NodePoolSize: &nodePoolSize,
+		}
+
+		noChecksumMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer noChecksumMariInst.Close()
+
+		getErr := noChecksumMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			putTxErr := tx.Put(checksumLastKeyVal.Key, checksumLastKeyVal.Value)
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			_, getTxErr := tx.GetVerified(checksumLastKeyVal.Key)
+			return getTxErr
+		})
+
+		if !errors.Is(getErr, mariv2.ErrNoValueChecksums) {
+			t.Errorf("expected no value checksums error, got: %v", getErr)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var cloneMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testclone"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testclone", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	cloneMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("clone test mari initialized")
+}
+
+func TestMariClone(t *testing.T) {
+	defer cloneMariInst.Remove()
+
+	keys := make([][]byte, mariv2.SnapshotLoadBatchSize+10)
+	putErr := cloneMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range keys {
+			keys[idx] = []byte(fmt.Sprintf("clone:%05d", idx))
+			putTxErr := tx.Put(keys[idx], []byte("v1"))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return tx.PutWithTTL(keys[2], []byte("v1"), time.Hour)
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put: %s", putErr.Error())
+	}
+
+	stats, statsErr := cloneMariInst.Stats()
+	if statsErr != nil {
+		t.Fatalf("error getting stats: %s", statsErr.Error())
+	}
+
+	snapshotVersion := stats.Version
+
+	putErr = cloneMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		putTxErr := tx.Put(keys[0], []byte("v2"))
+		if putTxErr != nil {
+			return putTxErr
+		}
+
+		return tx.Delete(keys[1])
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put: %s", putErr.Error())
+	}
+
+	t.Run("Test Load Snapshot Into Memory", func(t *testing.T) {
+		clone, loadErr := cloneMariInst.LoadSnapshotIntoMemory(snapshotVersion)
+		if loadErr != nil {
+			t.Fatalf("error loading snapshot into memory: %s", loadErr.Error())
+		}
+
+		defer clone.Close()
+
+		getErr := clone.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeTxErr := tx.Range(nil, nil, nil)
+			if rangeTxErr != nil {
+				return rangeTxErr
+			}
+
+			if len(kvPairs) != len(keys) {
+				return fmt.Errorf("expected every key of the version: expected(%d), actual(%d)", len(keys), len(kvPairs))
+			}
+
+			for idx, kvPair := range kvPairs {
+				if !bytes.Equal(kvPair.Key, keys[idx]) || !bytes.Equal(kvPair.Value, []byte("v1")) {
+					return fmt.Errorf("expected the pair of the version: key(%s), actual(%s=%s)", keys[idx], kvPair.Key, kvPair.Value)
+				}
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Fatal(getErr.Error())
+		}
+
+		updateErr := clone.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(keys[0], []byte("v3"))
+		})
+
+		if !errors.Is(updateErr, mariv2.ErrNotLeader) {
+			t.Errorf("expected the clone to be read only, got: %v", updateErr)
+		}
+	})
+
+	t.Run("Test Load Snapshot Version Not Found", func(t *testing.T) {
+		_, loadErr := cloneMariInst.LoadSnapshotIntoMemory(snapshotVersion + 100)
+		if !errors.Is(loadErr, mariv2.ErrVersionNotFound) {
+			t.Errorf("expected version not found, got: %v", loadErr)
+		}
+	})
+	t.Run("Test Clone To File", func(t *testing.T) {
+		cloneFile := filepath.Join(os.TempDir(), "testcloneto")
+		os.Remove(cloneFile)
+
+		stats, statsErr := cloneMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		cloneErr := cloneMariInst.CloneTo(cloneFile)
+		if cloneErr != nil {
+			t.Fatalf("error cloning to file: %s", cloneErr.Error())
+		}
+
+		cloneErr = cloneMariInst.CloneTo(cloneFile)
+		if !errors.Is(cloneErr, os.ErrExist) {
+			t.Errorf("expected cloning to an existing file to fail: actual(%v)", cloneErr)
+		}
+
+		putErr := cloneMariInst.UpdateTx(func(tx *mariv2.Tx) error { return tx.Put(keys[0], []byte("v3")) })
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		clone, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testcloneto"})
+		if openErr != nil {
+			t.Fatalf("error opening clone: %s", openErr.Error())
+		}
+
+		defer clone.Remove()
+
+		cloneStats, statsErr := clone.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if cloneStats.Version != stats.Version {
+			t.Errorf("expected the clone at the latest version: actual(%d), expected(%d)", cloneStats.Version, stats.Version)
+		}
+
+		readErr := clone.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get(keys[0], nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v2")) {
+				t.Errorf("expected the value when cloned: actual(%v)", kvPair)
+			}
+
+			kvPair, getErr = tx.Get(keys[1], nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil {
+				t.Errorf("expected the deleted key to be missing: actual(%s)", kvPair.Value)
+			}
+
+			expiresAt, getErr := tx.ExpiresAt(keys[2])
+			if getErr != nil {
+				return getErr
+			}
+
+			if expiresAt.IsZero() {
+				t.Error("expected the ttl to be cloned")
+			}
+
+			kvPairs, rangeErr := tx.Range(nil, nil, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != len(keys)-1 {
+				t.Errorf("cloned keys not equal to expected: actual(%d), expected(%d)", len(kvPairs), len(keys)-1)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error reading clone: %s", readErr.Error())
+		}
+	})
+}
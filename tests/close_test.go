@@ -0,0 +1,151 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var busyMariInst *mariv2.Mari
+var waitMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testclosebusy"))
+	os.Remove(filepath.Join(os.TempDir(), "testclosewait"))
+
+	nodePoolSize := int64(1000)
+	closeTimeout := time.Duration(0)
+
+	var openErr error
+	busyMariInst, openErr = mariv2.Open(mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testclosebusy",
+		NodePoolSize: &nodePoolSize,
+		CloseTimeout: &closeTimeout,
+	})
+
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	waitMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testclosewait", NodePoolSize: &nodePoolSize})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("close test mari initialized")
+}
+
+func TestMariClose(t *testing.T) {
+	t.Run("Test Close Busy", func(t *testing.T) {
+		if busyMariInst.State() != mariv2.StateRunning {
+			t.Fatalf("expected an opened instance to be running: actual(%s)", busyMariInst.State())
+		}
+
+		tx, beginErr := busyMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		putErr := tx.Put([]byte("hello"), []byte("world"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		removeErr := busyMariInst.Remove()
+		if !errors.Is(removeErr, mariv2.ErrBusy) {
+			t.Fatalf("expected remove with an active transaction to fail: actual(%v)", removeErr)
+		}
+
+		if busyMariInst.State() != mariv2.StateRunning {
+			t.Errorf("expected the instance to be running after a busy remove: actual(%s)", busyMariInst.State())
+		}
+
+		if _, statErr := os.Stat(filepath.Join(os.TempDir(), "testclosebusy")); statErr != nil {
+			t.Fatalf("expected the file to be kept: %s", statErr.Error())
+		}
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("error on mari commit after a busy remove: %s", commitErr.Error())
+		}
+
+		removeErr = busyMariInst.Remove()
+		if removeErr != nil {
+			t.Fatalf("error on mari remove: %s", removeErr.Error())
+		}
+
+		readErr := busyMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getErr := tx.Get([]byte("hello"), nil)
+			return getErr
+		})
+
+		var stateErr *mariv2.StateError
+		if !errors.As(readErr, &stateErr) || stateErr.Op != "ReadTx" || stateErr.State != mariv2.StateClosed || !errors.Is(readErr, mariv2.ErrClosed) {
+			t.Errorf("expected state error on read after close: actual(%v)", readErr)
+		}
+
+		if busyMariInst.State() != mariv2.StateClosed {
+			t.Errorf("expected the instance to be closed: actual(%s)", busyMariInst.State())
+		}
+
+		if closeErr := busyMariInst.Close(); closeErr != nil {
+			t.Errorf("expected close of a closed instance to return nil: actual(%v)", closeErr)
+		}
+
+		_, sizeErr := busyMariInst.FileSize()
+		if !errors.Is(sizeErr, mariv2.ErrClosed) {
+			t.Errorf("expected error on file size after close: actual(%v)", sizeErr)
+		}
+
+		_, beginErr = busyMariInst.Begin(true)
+		if !errors.Is(beginErr, mariv2.ErrClosed) {
+			t.Errorf("expected error on begin after close: actual(%v)", beginErr)
+		}
+	})
+
+	t.Run("Test Close Wait", func(t *testing.T) {
+		started := make(chan struct{})
+		committed := make(chan error, 1)
+		go func() {
+			committed <- waitMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+				return tx.Put([]byte("hello"), []byte("world"))
+			})
+		}()
+
+		<-started
+
+		removeErr := waitMariInst.Remove()
+		if removeErr != nil {
+			t.Fatalf("error on mari remove: %s", removeErr.Error())
+		}
+
+		select {
+		case commitErr := <-committed:
+			if commitErr != nil {
+				t.Fatalf("expected the active transaction to commit before remove: %s", commitErr.Error())
+			}
+		default:
+			t.Fatal("expected remove to wait for the active transaction")
+		}
+
+		if _, statErr := os.Stat(filepath.Join(os.TempDir(), "testclosewait")); !os.IsNotExist(statErr) {
+			t.Errorf("expected the file to be removed: actual(%v)", statErr)
+		}
+
+		updateErr := waitMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("hello"), []byte("again"))
+		})
+
+		if !errors.Is(updateErr, mariv2.ErrClosed) {
+			t.Errorf("expected error on update after close: actual(%v)", updateErr)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package maritests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirgallo/mariv2/cluster"
+)
+
+const CLUSTER_NODE_COUNT = 5
+const CLUSTER_KEY_COUNT = 10000
+
+type testClusterNode struct {
+	id      string
+	healthy atomic.Bool
+}
+
+func (node *testClusterNode) ID() string { return node.id }
+
+func (node *testClusterNode) Check(ctx context.Context) error {
+	if !node.healthy.Load() {
+		return errors.New("node is down")
+	}
+	return nil
+}
+
+func newTestClusterNodes(total int) []*testClusterNode {
+	nodes := make([]*testClusterNode, total)
+	for idx := range nodes {
+		nodes[idx] = &testClusterNode{id: fmt.Sprintf("node-%d", idx)}
+		nodes[idx].healthy.Store(true)
+	}
+
+	return nodes
+}
+
+func TestClusterRouter(t *testing.T) {
+	testNodes := newTestClusterNodes(CLUSTER_NODE_COUNT)
+	nodes := make([]cluster.Node, len(testNodes))
+	for idx, node := range testNodes {
+		nodes[idx] = node
+	}
+
+	router, routerErr := cluster.NewRouter(cluster.RouterOpts{}, nodes...)
+	if routerErr != nil {
+		t.Fatalf("error creating router: %s", routerErr.Error())
+	}
+	defer router.Close()
+
+	keys := make([][]byte, CLUSTER_KEY_COUNT)
+	owners := make(map[string]string)
+	for idx := range keys {
+		keys[idx], _ = GenerateRandomBytes(32)
+	}
+
+	t.Run("Test Route Distribution", func(t *testing.T) {
+		counts := make(map[string]int)
+		for _, key := range keys {
+			node, routeErr := router.Route(key)
+			if routeErr != nil {
+				t.Fatalf("error routing key: %s", routeErr.Error())
+			}
+
+			owners[string(key)] = node.ID()
+			counts[node.ID()]++
+		}
+
+		for _, node := range testNodes {
+			if counts[node.ID()] < CLUSTER_KEY_COUNT/CLUSTER_NODE_COUNT/2 {
+				t.Errorf("node %s received too few keys: %d", node.ID(), counts[node.ID()])
+			}
+		}
+	})
+
+	t.Run("Test Remove Node Only Moves Owned Keys", func(t *testing.T) {
+		removedID := testNodes[0].ID()
+		removeErr := router.RemoveNode(removedID)
+		if removeErr != nil {
+			t.Fatalf("error removing node: %s", removeErr.Error())
+		}
+
+		for _, key := range keys {
+			node, _ := router.Route(key)
+			prevOwner := owners[string(key)]
+			if prevOwner != removedID && node.ID() != prevOwner {
+				t.Errorf("key moved from %s to %s when removing %s", prevOwner, node.ID(), removedID)
+			}
+		}
+
+		addErr := router.AddNode(testNodes[0])
+		if addErr != nil {
+			t.Fatalf("error adding node: %s", addErr.Error())
+		}
+
+		if router.AddNode(testNodes[0]) != cluster.ErrNodeExists {
+			t.Error("expected error adding duplicate node")
+		}
+	})
+
+	t.Run("Test Unhealthy Node Is Skipped", func(t *testing.T) {
+		testNodes[1].healthy.Store(false)
+		router.CheckHealth(context.Background())
+
+		for _, key := range keys {
+			node, routeErr := router.Route(key)
+			if routeErr != nil {
+				t.Fatalf("error routing key: %s", routeErr.Error())
+			}
+
+			if node.ID() == testNodes[1].ID() {
+				t.Errorf("key routed to unhealthy node %s", node.ID())
+			}
+		}
+
+		replicas := router.RouteN(keys[0], CLUSTER_NODE_COUNT)
+		if len(replicas) != CLUSTER_NODE_COUNT-1 {
+			t.Errorf("expected %d healthy replicas, got %d", CLUSTER_NODE_COUNT-1, len(replicas))
+		}
+
+		testNodes[1].healthy.Store(true)
+		router.CheckHealth(context.Background())
+		for _, status := range router.Nodes() {
+			if !status.Healthy {
+				t.Errorf("node %s still unhealthy after recovery", status.ID)
+			}
+		}
+	})
+
+	t.Run("Test No Healthy Nodes", func(t *testing.T) {
+		for _, node := range testNodes {
+			node.healthy.Store(false)
+		}
+
+		router.CheckHealth(context.Background())
+		_, routeErr := router.Route(keys[0])
+		if routeErr != cluster.ErrNoHealthyNodes {
+			t.Errorf("expected no healthy nodes error, got %v", routeErr)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package maritests
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const CORRUPT_LEAF_OFFSET = uint64(1) << 62
+
+var corruptOpts mariv2.InitOpts
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testcorrupt"))
+
+	nodePoolSize := int64(1000)
+	corruptOpts = mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testcorrupt",
+		NodePoolSize: &nodePoolSize,
+	}
+
+	corruptMariInst, openErr := mariv2.Open(corruptOpts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := corruptMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put([]byte("hello"), []byte("world"))
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	closeErr := corruptMariInst.Close()
+	if closeErr != nil {
+		panic(closeErr.Error())
+	}
+
+	fmt.Println("corrupt test mari initialized")
+}
+
+func TestMariCorrupt(t *testing.T) {
+	t.Run("Test Corrupt Leaf Offset", func(t *testing.T) {
+		file, openErr := os.OpenFile(filepath.Join(os.TempDir(), "testcorrupt"), os.O_RDWR, 0600)
+		if openErr != nil {
+			t.Fatalf("error opening file: %s", openErr.Error())
+		}
+
+		sRootOffset := make([]byte, mariv2.OffsetSize64)
+		_, readErr := file.ReadAt(sRootOffset, mariv2.MetaRootOffsetIdx)
+		if readErr != nil {
+			t.Fatalf("error reading root offset: %s", readErr.Error())
+		}
+
+		rootOffset := binary.LittleEndian.Uint64(sRootOffset)
+		sLeafOffset := binary.LittleEndian.AppendUint64(nil, CORRUPT_LEAF_OFFSET)
+		_, writeErr := file.WriteAt(sLeafOffset, int64(rootOffset+mariv2.NodeLeafOffsetIdx))
+		if writeErr != nil {
+			t.Fatalf("error corrupting leaf offset: %s", writeErr.Error())
+		}
+
+		file.Close()
+
+		defer os.Remove(filepath.Join(os.TempDir(), "testcorrupt"))
+
+		_, reopenErr := mariv2.Open(corruptOpts)
+		if !errors.Is(reopenErr, mariv2.ErrCorrupt) {
+			t.Fatalf("expected corrupt error, got: %v", reopenErr)
+		}
+
+		var regionErr *mariv2.RegionError
+		if !errors.As(reopenErr, &regionErr) {
+			t.Fatalf("expected region error, got: %v", reopenErr)
+		}
+
+		if regionErr.Offset != CORRUPT_LEAF_OFFSET {
+			t.Errorf("expected offset %d, got: %d", CORRUPT_LEAF_OFFSET, regionErr.Offset)
+		}
+
+		t.Log("corrupt error:", reopenErr)
+	})
+}
@@ -0,0 +1,203 @@
+package maritests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const COUNT_INPUT_SIZE = 1000
+
+var countMariInst *mariv2.Mari
+var countKeyValPairs []KeyVal
+var countCompactNow atomic.Bool
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testcount"))
+	os.Remove(filepath.Join(os.TempDir(), "testcountlegacy"))
+
+	var openErr error
+	countMariInst, openErr = openCountInst("testcount", true)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	countKeyValPairs = make([]KeyVal, COUNT_INPUT_SIZE)
+	for idx := range countKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		countKeyValPairs[idx] = KeyVal{Key: append([]byte(fmt.Sprintf("%d:", idx%10)), randomBytes...), Value: randomBytes}
+	}
+
+	fmt.Println("count test mari initialized")
+}
+
+func openCountInst(fileName string, subtreeCounts bool) (*mariv2.Mari, error) {
+	nodePoolSize := int64(1000)
+	compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return countCompactNow.CompareAndSwap(true, false) })
+	opts := mariv2.InitOpts{
+		Filepath:       os.TempDir(),
+		FileName:       fileName,
+		NodePoolSize:   &nodePoolSize,
+		CompactTrigger: &compactTrigger,
+		SubtreeCounts:  &subtreeCounts,
+	}
+
+	return mariv2.Open(opts)
+}
+
+func TestMariCount(t *testing.T) {
+	defer countMariInst.Remove()
+
+	put := func(mariInst *mariv2.Mari, kvPairs []KeyVal) {
+		putErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, val := range kvPairs {
+				putTxErr := tx.Put(val.Key, val.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+	}
+
+	checkCounts := func(mariInst *mariv2.Mari, expected int) {
+		readErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+			count, countErr := tx.Count()
+			if countErr != nil {
+				return countErr
+			}
+
+			if count != expected {
+				t.Errorf("count not equal to expected: actual(%d), expected(%d)", count, expected)
+			}
+
+			for _, prefix := range []string{"", "1", "1:", "3:", "9:", "10:"} {
+				prefixCount, countErr := tx.CountPrefix([]byte(prefix))
+				if countErr != nil {
+					return countErr
+				}
+
+				kvPairs, rangeErr := tx.Range(nil, nil, nil)
+				if rangeErr != nil {
+					return rangeErr
+				}
+
+				var expPrefixCount int
+				for _, kvPair := range kvPairs {
+					if len(kvPair.Key) >= len(prefix) && string(kvPair.Key[:len(prefix)]) == prefix {
+						expPrefixCount++
+					}
+				}
+
+				if prefixCount != expPrefixCount {
+					t.Errorf("count for prefix %q not equal to expected: actual(%d), expected(%d)", prefix, prefixCount, expPrefixCount)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari count: %s", readErr.Error())
+		}
+	}
+
+	half := COUNT_INPUT_SIZE / 2
+
+	t.Run("Test Count After Put", func(t *testing.T) {
+		chunks, chunkErr := Chunk(countKeyValPairs[:half], 100)
+		if chunkErr != nil {
+			t.Fatalf("error chunking input: %s", chunkErr.Error())
+		}
+
+		for _, chunk := range chunks {
+			put(countMariInst, chunk)
+		}
+
+		checkCounts(countMariInst, half)
+
+		put(countMariInst, countKeyValPairs[:10])
+		checkCounts(countMariInst, half)
+	})
+
+	t.Run("Test Count After Delete", func(t *testing.T) {
+		delErr := countMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, val := range countKeyValPairs[:100] {
+				delTxErr := tx.Delete(val.Key)
+				if delTxErr != nil {
+					return delTxErr
+				}
+			}
+
+			return tx.Delete([]byte("does not exist"))
+		})
+
+		if delErr != nil {
+			t.Fatalf("error on mari delete: %s", delErr.Error())
+		}
+
+		checkCounts(countMariInst, half-100)
+	})
+
+	t.Run("Test Count Without Subtree Counts", func(t *testing.T) {
+		legacyInst, openErr := openCountInst("testcountlegacy", false)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+		defer func() { legacyInst.Remove() }()
+
+		put(legacyInst, countKeyValPairs[half:])
+
+		stats, statsErr := legacyInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		if stats.FormatVersion != mariv2.FormatVersionBase {
+			t.Errorf("unexpected format version: actual(%d), expected(%d)", stats.FormatVersion, mariv2.FormatVersionBase)
+		}
+
+		checkCounts(legacyInst, COUNT_INPUT_SIZE-half)
+
+		legacyInst.Close()
+		legacyInst, openErr = openCountInst("testcountlegacy", true)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		put(legacyInst, countKeyValPairs[:1])
+		checkCounts(legacyInst, COUNT_INPUT_SIZE-half+1)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for stats.FormatVersion != mariv2.FormatVersionSubtreeCounts {
+			if time.Now().After(deadline) {
+				t.Fatal("file was not upgraded to subtree counts on compaction")
+			}
+
+			countCompactNow.Store(true)
+			put(legacyInst, countKeyValPairs[1:2])
+
+			time.Sleep(10 * time.Millisecond)
+
+			stats, statsErr = legacyInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+		}
+
+		checkCounts(legacyInst, COUNT_INPUT_SIZE-half+2)
+
+		put(legacyInst, countKeyValPairs[2:3])
+		checkCounts(legacyInst, COUNT_INPUT_SIZE-half+3)
+	})
+}
@@ -0,0 +1,152 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var emptyStoreMariInst *mariv2.Mari
+var emptyRejectMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testemptystore"))
+	os.Remove(filepath.Join(os.TempDir(), "testemptyreject"))
+
+	nodePoolSize := int64(1000)
+	reject := mariv2.EmptyValuesReject
+
+	var openErr error
+	emptyStoreMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testemptystore", NodePoolSize: &nodePoolSize})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	emptyRejectMariInst, openErr = mariv2.Open(mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testemptyreject",
+		NodePoolSize: &nodePoolSize,
+		EmptyValues:  &reject,
+	})
+
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("empty test mari initialized")
+}
+
+func TestMariEmpty(t *testing.T) {
+	defer emptyStoreMariInst.Remove()
+	defer emptyRejectMariInst.Remove()
+
+	t.Run("Test Empty Keys", func(t *testing.T) {
+		for _, emptyMariInst := range []*mariv2.Mari{emptyStoreMariInst, emptyRejectMariInst} {
+			for _, key := range [][]byte{nil, {}} {
+				putErr := emptyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+					return tx.Put(key, []byte("value"))
+				})
+
+				if !errors.Is(putErr, mariv2.ErrEmptyKey) {
+					t.Errorf("expected error on put of an empty key: actual(%v)", putErr)
+				}
+
+				ttlErr := emptyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+					return tx.PutWithTTL(key, []byte("value"), time.Minute)
+				})
+
+				if !errors.Is(ttlErr, mariv2.ErrEmptyKey) {
+					t.Errorf("expected error on put with ttl of an empty key: actual(%v)", ttlErr)
+				}
+
+				deleteErr := emptyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+					return tx.Delete(key)
+				})
+
+				if !errors.Is(deleteErr, mariv2.ErrEmptyKey) {
+					t.Errorf("expected error on delete of an empty key: actual(%v)", deleteErr)
+				}
+
+				getErr := emptyMariInst.ReadTx(func(tx *mariv2.Tx) error {
+					kvPair, getTxErr := tx.Get(key, nil)
+					if getTxErr != nil || kvPair != nil {
+						return fmt.Errorf("expected nil on get of an empty key: %v, %v", getTxErr, kvPair)
+					}
+
+					return nil
+				})
+
+				if getErr != nil {
+					t.Error(getErr.Error())
+				}
+			}
+		}
+	})
+
+	t.Run("Test Store Empty Values", func(t *testing.T) {
+		putErr := emptyStoreMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			putTxErr := tx.Put([]byte("nil"), nil)
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			return tx.Put([]byte("empty"), []byte{})
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put of empty values: %s", putErr.Error())
+		}
+
+		getErr := emptyStoreMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, key := range []string{"nil", "empty"} {
+				kvPair, getTxErr := tx.Get([]byte(key), nil)
+				if getTxErr != nil {
+					return getTxErr
+				}
+
+				if kvPair == nil || kvPair.Value == nil || len(kvPair.Value) != 0 {
+					return fmt.Errorf("expected an empty, non-nil value for key %s: actual(%v)", key, kvPair)
+				}
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Error(getErr.Error())
+		}
+	})
+
+	t.Run("Test Reject Empty Values", func(t *testing.T) {
+		for _, value := range [][]byte{nil, {}} {
+			putErr := emptyRejectMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				return tx.Put([]byte("rejected"), value)
+			})
+
+			if !errors.Is(putErr, mariv2.ErrEmptyValue) {
+				t.Errorf("expected error on put of an empty value: actual(%v)", putErr)
+			}
+
+			ttlErr := emptyRejectMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				return tx.PutWithTTL([]byte("rejected"), value, time.Minute)
+			})
+
+			if !errors.Is(ttlErr, mariv2.ErrEmptyValue) {
+				t.Errorf("expected error on put with ttl of an empty value: actual(%v)", ttlErr)
+			}
+		}
+
+		putErr := emptyRejectMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.PutWithTTL([]byte("accepted"), []byte("value"), time.Minute)
+		})
+
+		if putErr != nil {
+			t.Fatalf("expected the ttl index to accept its internal empty values: %s", putErr.Error())
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package maritests
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const EXPLAIN_INPUT_SIZE = 1000
+
+var explainMariInst *mariv2.Mari
+var explainKeyValPairs []KeyVal
+var explainLogs *SyncBuffer
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testexplain"))
+
+	explainLogs = &SyncBuffer{}
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testexplain",
+		NodePoolSize: &nodePoolSize,
+		Logger:       slog.New(slog.NewTextHandler(explainLogs, nil)),
+	}
+
+	var openErr error
+	explainMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	explainKeyValPairs = make([]KeyVal, EXPLAIN_INPUT_SIZE)
+	putErr := explainMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range explainKeyValPairs {
+			randomBytes, _ := GenerateRandomBytes(32)
+			explainKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+
+			putTxErr := tx.Put(randomBytes, randomBytes)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("explain test mari initialized")
+}
+
+func TestMariExplain(t *testing.T) {
+	defer explainMariInst.Remove()
+
+	t.Run("Test Explain Reads", func(t *testing.T) {
+		var getTrace, rangeTrace *mariv2.TxTrace
+		readErr := explainMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var explainErr error
+			getTrace, explainErr = tx.Explain(func(tx *mariv2.Tx) error {
+				_, getErr := tx.Get(explainKeyValPairs[0].Key, nil)
+				return getErr
+			})
+
+			if explainErr != nil {
+				return explainErr
+			}
+
+			rangeTrace, explainErr = tx.Explain(func(tx *mariv2.Tx) error {
+				_, rangeErr := tx.Range(nil, nil, nil)
+				return rangeErr
+			})
+
+			return explainErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		if getTrace.NodesRead == 0 || getTrace.BytesRead == 0 || len(getTrace.OffsetsRead) != getTrace.NodesRead {
+			t.Errorf("expected get to read nodes from the memory map: actual(%+v)", getTrace)
+		}
+
+		if getTrace.NodesVisited < getTrace.NodesRead || getTrace.PathCopies != 0 {
+			t.Errorf("unexpected get trace: actual(%+v)", getTrace)
+		}
+
+		if rangeTrace.NodesRead <= getTrace.NodesRead || rangeTrace.BytesRead <= getTrace.BytesRead {
+			t.Errorf("expected range to read more than get: range(%d), get(%d)", rangeTrace.NodesRead, getTrace.NodesRead)
+		}
+
+		if !strings.Contains(explainLogs.String(), "transaction trace") {
+			t.Error("expected trace to be logged")
+		}
+	})
+
+	t.Run("Test Explain Writes", func(t *testing.T) {
+		var putTrace, untracedTrace *mariv2.TxTrace
+		updateErr := explainMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			var explainErr error
+			putTrace, explainErr = tx.Explain(func(tx *mariv2.Tx) error {
+				return tx.Put(explainKeyValPairs[0].Key, []byte("updated"))
+			})
+
+			if explainErr != nil {
+				return explainErr
+			}
+
+			putTxErr := tx.Put(explainKeyValPairs[1].Key, []byte("updated"))
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			untracedTrace, explainErr = tx.Explain(func(tx *mariv2.Tx) error { return nil })
+			return explainErr
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		if putTrace.PathCopies == 0 {
+			t.Errorf("expected put to path copy nodes: actual(%+v)", putTrace)
+		}
+
+		if untracedTrace.NodesVisited != 0 || untracedTrace.PathCopies != 0 {
+			t.Errorf("expected operations outside of explain not to be traced: actual(%+v)", untracedTrace)
+		}
+	})
+}
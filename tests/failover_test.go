@@ -0,0 +1,174 @@
+package maritests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const FAILOVER_LEASE_DURATION = 200 * time.Millisecond
+
+var failoverLeaseInst, failoverInstA, failoverInstB *mariv2.Mari
+
+func init() {
+	openFailoverInst := func(fileName string, follower bool) *mariv2.Mari {
+		os.Remove(filepath.Join(os.TempDir(), fileName))
+
+		nodePoolSize := int64(1000)
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: fileName, NodePoolSize: &nodePoolSize, Follower: &follower}
+		inst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			panic(openErr.Error())
+		}
+
+		return inst
+	}
+
+	failoverLeaseInst = openFailoverInst("testfailoverlease", false)
+	failoverInstA = openFailoverInst("testfailovera", true)
+	failoverInstB = openFailoverInst("testfailoverb", true)
+
+	fmt.Println("failover test mari initialized")
+}
+
+func TestMariFailover(t *testing.T) {
+	defer failoverLeaseInst.Remove()
+	defer failoverInstA.Remove()
+	defer failoverInstB.Remove()
+
+	ctx := context.Background()
+	leaseStore := mariv2.NewKeyLeaseStore(failoverLeaseInst, []byte("leader"))
+
+	var promotedTerm uint64
+	failoverA, failoverErr := failoverInstA.NewFailover(mariv2.FailoverOpts{ID: "a", Store: leaseStore, LeaseDuration: FAILOVER_LEASE_DURATION})
+	if failoverErr != nil {
+		t.Fatalf("error creating failover: %s", failoverErr.Error())
+	}
+
+	failoverB, failoverErr := failoverInstB.NewFailover(mariv2.FailoverOpts{
+		ID:            "b",
+		Store:         leaseStore,
+		LeaseDuration: FAILOVER_LEASE_DURATION,
+		OnPromote:     func(term uint64) { promotedTerm = term },
+	})
+	if failoverErr != nil {
+		t.Fatalf("error creating failover: %s", failoverErr.Error())
+	}
+
+	put := func(inst *mariv2.Mari) error {
+		return inst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("hello"), []byte("world"))
+		})
+	}
+
+	t.Run("Test Follower Rejects Writes", func(t *testing.T) {
+		if put(failoverInstA) != mariv2.ErrNotLeader {
+			t.Error("expected follower to reject read-write transaction")
+		}
+	})
+
+	t.Run("Test Lease Acquire", func(t *testing.T) {
+		if tickErr := failoverA.Tick(ctx); tickErr != nil {
+			t.Fatalf("error on tick: %s", tickErr.Error())
+		}
+
+		if tickErr := failoverB.Tick(ctx); tickErr != nil {
+			t.Fatalf("error on tick: %s", tickErr.Error())
+		}
+
+		if !failoverInstA.IsLeader() || failoverInstB.IsLeader() {
+			t.Errorf("expected a to be the only leader: a(%t), b(%t)", failoverInstA.IsLeader(), failoverInstB.IsLeader())
+		}
+
+		if putErr := put(failoverInstA); putErr != nil {
+			t.Errorf("error on leader put: %s", putErr.Error())
+		}
+
+		if put(failoverInstB) != mariv2.ErrNotLeader {
+			t.Error("expected follower to reject read-write transaction")
+		}
+	})
+
+	t.Run("Test Promote On Lease Lapse", func(t *testing.T) {
+		time.Sleep(FAILOVER_LEASE_DURATION + 50*time.Millisecond)
+
+		if tickErr := failoverB.Tick(ctx); tickErr != nil {
+			t.Fatalf("error on tick: %s", tickErr.Error())
+		}
+
+		if tickErr := failoverA.Tick(ctx); tickErr != nil {
+			t.Fatalf("error on tick: %s", tickErr.Error())
+		}
+
+		if failoverInstA.IsLeader() || !failoverInstB.IsLeader() {
+			t.Errorf("expected b to be the only leader: a(%t), b(%t)", failoverInstA.IsLeader(), failoverInstB.IsLeader())
+		}
+
+		if promotedTerm != 2 || failoverB.Term() != 2 {
+			t.Errorf("expected promotion at term 2: hook(%d), term(%d)", promotedTerm, failoverB.Term())
+		}
+	})
+
+	t.Run("Test Resign", func(t *testing.T) {
+		if resignErr := failoverB.Resign(ctx); resignErr != nil {
+			t.Fatalf("error on resign: %s", resignErr.Error())
+		}
+
+		if tickErr := failoverA.Tick(ctx); tickErr != nil {
+			t.Fatalf("error on tick: %s", tickErr.Error())
+		}
+
+		if !failoverInstA.IsLeader() || failoverInstB.IsLeader() {
+			t.Errorf("expected a to be the only leader after resign: a(%t), b(%t)", failoverInstA.IsLeader(), failoverInstB.IsLeader())
+		}
+	})
+
+	t.Run("Test Background Renewal", func(t *testing.T) {
+		term := failoverA.Term()
+		failoverA.Start()
+		failoverA.Start()
+
+		for deadline := time.Now().Add(2 * FAILOVER_LEASE_DURATION); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if failoverA.Term() != term {
+				t.Fatalf("term changed while renewing: actual(%d), expected(%d)", failoverA.Term(), term)
+			}
+		}
+
+		if tickErr := failoverB.Tick(ctx); tickErr != nil {
+			t.Fatalf("error on tick: %s", tickErr.Error())
+		}
+
+		failoverA.Stop()
+		if !failoverInstA.IsLeader() || failoverInstB.IsLeader() {
+			t.Errorf("expected a to keep the lease while renewing: a(%t), b(%t)", failoverInstA.IsLeader(), failoverInstB.IsLeader())
+		}
+	})
+
+	t.Run("Test Stop Without Start", func(t *testing.T) {
+		stopped := make(chan struct{})
+		go func() {
+			failoverB.Stop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("expected stop to return when the coordinator was never started")
+		}
+
+		term := failoverB.Term()
+		failoverB.Start()
+		failoverB.Stop()
+		time.Sleep(FAILOVER_LEASE_DURATION)
+
+		if failoverB.Term() != term || failoverInstB.IsLeader() {
+			t.Errorf("expected a stopped coordinator not to check the lease once started: term(%d), expected(%d)", failoverB.Term(), term)
+		}
+	})
+}
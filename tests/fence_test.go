@@ -0,0 +1,145 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var fenceMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testfence"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testfence", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	fenceMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("fence test mari initialized")
+}
+
+func TestMariFence(t *testing.T) {
+	defer fenceMariInst.Remove()
+
+	fencedPut := func(token uint64, key string) error {
+		return fenceMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			fenceErr := tx.CheckFencingToken(token)
+			if fenceErr != nil {
+				return fenceErr
+			}
+
+			return tx.Put([]byte(key), []byte("value"))
+		})
+	}
+
+	exists := func(t *testing.T, key string) bool {
+		var found bool
+		readErr := fenceMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte(key), nil)
+			found = kvPair != nil
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		return found
+	}
+
+	t.Run("Test Issued Tokens Increase", func(t *testing.T) {
+		var prev uint64
+		for range 5 {
+			token, issueErr := fenceMariInst.NextFencingToken()
+			if issueErr != nil {
+				t.Fatalf("error issuing fencing token: %s", issueErr.Error())
+			}
+
+			if token <= prev {
+				t.Fatalf("fencing token did not increase: actual(%d), previous(%d)", token, prev)
+			}
+
+			prev = token
+		}
+
+		highest, loadErr := fenceMariInst.FencingToken()
+		if loadErr != nil {
+			t.Fatalf("error getting fencing token: %s", loadErr.Error())
+		}
+
+		if highest != prev {
+			t.Fatalf("expected the last issued token: actual(%d), expected(%d)", highest, prev)
+		}
+	})
+
+	t.Run("Test Stale Token Rejected", func(t *testing.T) {
+		oldLeader, issueErr := fenceMariInst.NextFencingToken()
+		if issueErr != nil {
+			t.Fatalf("error issuing fencing token: %s", issueErr.Error())
+		}
+
+		putErr := fencedPut(oldLeader, "old:before")
+		if putErr != nil {
+			t.Fatalf("error on fenced put: %s", putErr.Error())
+		}
+
+		newLeader, issueErr := fenceMariInst.NextFencingToken()
+		if issueErr != nil {
+			t.Fatalf("error issuing fencing token: %s", issueErr.Error())
+		}
+
+		putErr = fencedPut(oldLeader, "old:after")
+		if !errors.Is(putErr, mariv2.ErrStaleFencingToken) {
+			t.Fatalf("expected ErrStaleFencingToken: actual(%v)", putErr)
+		}
+
+		if exists(t, "old:after") {
+			t.Fatal("write of the stale leader was committed")
+		}
+
+		putErr = fencedPut(newLeader, "new")
+		if putErr != nil {
+			t.Fatalf("error on fenced put: %s", putErr.Error())
+		}
+	})
+
+	t.Run("Test External Token Raises Highest", func(t *testing.T) {
+		highest, loadErr := fenceMariInst.FencingToken()
+		if loadErr != nil {
+			t.Fatalf("error getting fencing token: %s", loadErr.Error())
+		}
+
+		putErr := fencedPut(highest+100, "external:new")
+		if putErr != nil {
+			t.Fatalf("error on fenced put: %s", putErr.Error())
+		}
+
+		putErr = fencedPut(highest+99, "external:old")
+		if !errors.Is(putErr, mariv2.ErrStaleFencingToken) {
+			t.Fatalf("expected ErrStaleFencingToken: actual(%v)", putErr)
+		}
+
+		next, issueErr := fenceMariInst.NextFencingToken()
+		if issueErr != nil {
+			t.Fatalf("error issuing fencing token: %s", issueErr.Error())
+		}
+
+		if next <= highest+100 {
+			t.Fatalf("expected the issued token to be greater than the external token: actual(%d), expected over (%d)", next, highest+100)
+		}
+
+		readErr := fenceMariInst.ReadTx(func(tx *mariv2.Tx) error { return tx.CheckFencingToken(next) })
+		if readErr == nil {
+			t.Fatal("expected an error checking a fencing token in a read only transaction")
+		}
+	})
+}
@@ -0,0 +1,426 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const FILE_INPUT_SIZE = 1000
+
+var fileDir string
+var fileKeyValPairs []KeyVal
+var fileCompactNow atomic.Bool
+
+func init() {
+	var dirErr error
+	fileDir, dirErr = os.MkdirTemp("", "testfile")
+	if dirErr != nil {
+		panic(dirErr.Error())
+	}
+
+	fileKeyValPairs = make([]KeyVal, FILE_INPUT_SIZE)
+	for idx := range fileKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		fileKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("file test mari initialized")
+}
+
+func TestMariFile(t *testing.T) {
+	defer os.RemoveAll(fileDir)
+
+	openFileInst := func(opts mariv2.InitOpts) (*mariv2.Mari, error) {
+		nodePoolSize := int64(1000)
+		compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return fileCompactNow.CompareAndSwap(true, false) })
+
+		opts.Filepath = fileDir
+		opts.NodePoolSize = &nodePoolSize
+		opts.CompactTrigger = &compactTrigger
+		return mariv2.Open(opts)
+	}
+
+	putAndGet := func(t *testing.T, fileMariInst *mariv2.Mari, keyValPairs []KeyVal) {
+		putErr := fileMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, val := range keyValPairs {
+				putTxErr := tx.Put(val.Key, val.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		getErr := fileMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, val := range keyValPairs {
+				kvPair, getTxErr := tx.Get(val.Key, nil)
+				if getTxErr != nil {
+					return getTxErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+					return fmt.Errorf("actual value not equal to expected for key %x", val.Key)
+				}
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+	}
+
+	compactAndWait := func(t *testing.T, fileMariInst *mariv2.Mari) {
+		stats, statsErr := fileMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for version := stats.Version; stats.Version >= version; {
+			if time.Now().After(deadline) {
+				t.Fatal("file was not compacted")
+			}
+
+			fileCompactNow.Store(true)
+			putAndGet(t, fileMariInst, fileKeyValPairs[:1])
+			time.Sleep(10 * time.Millisecond)
+
+			stats, statsErr = fileMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+		}
+	}
+
+	t.Run("Test File Mode And Directory Sync", func(t *testing.T) {
+		fileMode := os.FileMode(0640)
+		syncDirectory := true
+		fileMariInst, openErr := openFileInst(mariv2.InitOpts{FileName: "testfilemode", FileMode: &fileMode, SyncDirectory: &syncDirectory})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer fileMariInst.Remove()
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+
+		info, statErr := os.Stat(filepath.Join(fileDir, "testfilemode"))
+		if statErr != nil {
+			t.Fatalf("error getting file info: %s", statErr.Error())
+		}
+
+		if info.Mode().Perm() != fileMode {
+			t.Errorf("unexpected file mode: actual(%s), expected(%s)", info.Mode().Perm(), fileMode)
+		}
+	})
+
+	t.Run("Test Duplicate Open", func(t *testing.T) {
+		fileMariInst, openErr := openFileInst(mariv2.InitOpts{FileName: "testfileduplicate"})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer func() { fileMariInst.Remove() }()
+
+		_, openErr = mariv2.Open(mariv2.InitOpts{Filepath: fileDir + "/./", FileName: "testfileduplicate"})
+
+		var alreadyOpenErr *mariv2.AlreadyOpenError
+		if !errors.As(openErr, &alreadyOpenErr) || !errors.Is(openErr, mariv2.ErrAlreadyOpen) {
+			t.Fatalf("expected already open error, got: %v", openErr)
+		}
+
+		if alreadyOpenErr.Instance != fileMariInst {
+			t.Errorf("expected the error to carry the open instance")
+		}
+
+		putAndGet(t, alreadyOpenErr.Instance, fileKeyValPairs[:FILE_INPUT_SIZE/2])
+
+		closeErr := fileMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		fileMariInst, openErr = openFileInst(mariv2.InitOpts{FileName: "testfileduplicate"})
+		if openErr != nil {
+			t.Fatalf("error reopening mari after close: %s", openErr.Error())
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs[FILE_INPUT_SIZE/2:])
+	})
+
+	t.Run("Test Sync Commits", func(t *testing.T) {
+		syncCommits := true
+		fileMariInst, openErr := openFileInst(mariv2.InitOpts{FileName: "testfilesync", SyncCommits: &syncCommits})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer fileMariInst.Remove()
+
+		var commitWG sync.WaitGroup
+		commitErrs := make(chan error, FILE_INPUT_SIZE)
+		for _, val := range fileKeyValPairs {
+			commitWG.Add(1)
+			go func(val KeyVal) {
+				defer commitWG.Done()
+				commitErrs <- fileMariInst.UpdateTx(func(tx *mariv2.Tx) error { return tx.Put(val.Key, val.Value) })
+			}(val)
+		}
+
+		commitWG.Wait()
+		close(commitErrs)
+		for commitErr := range commitErrs {
+			if commitErr != nil {
+				t.Fatalf("error on synced commit: %s", commitErr.Error())
+			}
+		}
+
+		tx, beginErr := fileMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error beginning transaction: %s", beginErr.Error())
+		}
+
+		putErr := tx.Put(fileKeyValPairs[0].Key, fileKeyValPairs[1].Value)
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("error on synced commit: %s", commitErr.Error())
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+	})
+
+	t.Run("Test Batch Flush Strategy", func(t *testing.T) {
+		syncCommits := true
+		flushStrategy := mariv2.FlushStrategyBatch
+		flushInterval := 10 * time.Millisecond
+		opts := mariv2.InitOpts{FileName: "testfilebatch", SyncCommits: &syncCommits, FlushStrategy: &flushStrategy, FlushInterval: &flushInterval}
+		fileMariInst, openErr := openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs[:FILE_INPUT_SIZE/2])
+		time.Sleep(5 * flushInterval)
+		putAndGet(t, fileMariInst, fileKeyValPairs[FILE_INPUT_SIZE/2:])
+
+		closeErr := fileMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		fileMariInst, openErr = openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		defer fileMariInst.Remove()
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+	})
+
+	t.Run("Test Background Flush Strategy", func(t *testing.T) {
+		syncCommits := true
+		flushStrategy := mariv2.FlushStrategyBackground
+		flushInterval := time.Hour
+		flushDirtyBytes := int64(1)
+		opts := mariv2.InitOpts{
+			FileName:        "testfilebackground",
+			SyncCommits:     &syncCommits,
+			FlushStrategy:   &flushStrategy,
+			FlushInterval:   &flushInterval,
+			FlushDirtyBytes: &flushDirtyBytes,
+		}
+
+		fileMariInst, openErr := openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs[:FILE_INPUT_SIZE/2])
+
+		closeErr := fileMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		fileMariInst, openErr = openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		defer fileMariInst.Remove()
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+	})
+
+	t.Run("Test Adaptive Flush Strategy", func(t *testing.T) {
+		syncCommits := true
+		flushStrategy := mariv2.FlushStrategyAdaptive
+		flushInterval := 10 * time.Millisecond
+		targetCommitLatency := time.Nanosecond
+		opts := mariv2.InitOpts{
+			FileName:            "testfileadaptive",
+			SyncCommits:         &syncCommits,
+			FlushStrategy:       &flushStrategy,
+			FlushInterval:       &flushInterval,
+			TargetCommitLatency: &targetCommitLatency,
+		}
+
+		fileMariInst, openErr := openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		for _, val := range fileKeyValPairs[:2*mariv2.AdaptiveSyncMinSamples] {
+			putAndGet(t, fileMariInst, []KeyVal{val})
+		}
+
+		stats, statsErr := fileMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		if !stats.GroupedSync {
+			t.Errorf("expected commits to be grouped once syncs exceeded the target latency: %+v", stats)
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs[:FILE_INPUT_SIZE/2])
+
+		closeErr := fileMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		fileMariInst, openErr = openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		defer fileMariInst.Remove()
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+	})
+
+	t.Run("Test Direct Compaction", func(t *testing.T) {
+		directCompaction := true
+		opts := mariv2.InitOpts{FileName: "testfiledirect", DirectCompaction: &directCompaction}
+		fileMariInst, openErr := openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+		compactAndWait(t, fileMariInst)
+		putAndGet(t, fileMariInst, fileKeyValPairs[:FILE_INPUT_SIZE/2])
+
+		verifyErr := fileMariInst.Verify()
+		if verifyErr != nil {
+			t.Fatalf("error verifying compacted mari: %s", verifyErr.Error())
+		}
+
+		closeErr := fileMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		fileMariInst, openErr = openFileInst(opts)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		defer fileMariInst.Remove()
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+	})
+
+	t.Run("Test Open Temp", func(t *testing.T) {
+		tempMariInst, openErr := mariv2.OpenTemp("testfiletemp")
+		if openErr != nil {
+			t.Fatalf("error opening temp mari: %s", openErr.Error())
+		}
+
+		putAndGet(t, tempMariInst, fileKeyValPairs)
+
+		matches, _ := filepath.Glob(filepath.Join(os.TempDir(), "testfiletemp*"))
+		if len(matches) != 1 {
+			t.Errorf("expected the temp file to exist while open, got: %v", matches)
+		}
+
+		closeErr := tempMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing temp mari: %s", closeErr.Error())
+		}
+
+		matches, _ = filepath.Glob(filepath.Join(os.TempDir(), "testfiletemp*"))
+		if len(matches) != 0 {
+			t.Errorf("expected the temp file to be removed on close, got: %v", matches)
+		}
+
+		removeErr := tempMariInst.Remove()
+		if removeErr != nil {
+			t.Errorf("error removing closed temp mari: %s", removeErr.Error())
+		}
+	})
+
+	t.Run("Test Anonymous File", func(t *testing.T) {
+		anonymous := true
+		fileMariInst, openErr := openFileInst(mariv2.InitOpts{FileName: "testfileanonymous", Anonymous: &anonymous})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		putAndGet(t, fileMariInst, fileKeyValPairs[:FILE_INPUT_SIZE/2])
+
+		entries, readErr := os.ReadDir(fileDir)
+		if readErr != nil {
+			t.Fatalf("error reading directory: %s", readErr.Error())
+		}
+
+		if len(entries) != 0 {
+			t.Errorf("expected no files in the directory for an anonymous instance, got: %d", len(entries))
+		}
+
+		compactAndWait(t, fileMariInst)
+
+		putAndGet(t, fileMariInst, fileKeyValPairs)
+
+		entries, readErr = os.ReadDir(fileDir)
+		if readErr != nil {
+			t.Fatalf("error reading directory: %s", readErr.Error())
+		}
+
+		if len(entries) != 0 {
+			t.Errorf("expected no files in the directory after compaction, got: %d", len(entries))
+		}
+
+		removeErr := fileMariInst.Remove()
+		if removeErr != nil {
+			t.Errorf("error removing anonymous mari: %s", removeErr.Error())
+		}
+
+		_, statErr := os.Stat(fileDir)
+		if statErr != nil {
+			t.Errorf("expected the directory to remain after remove: %s", statErr.Error())
+		}
+	})
+}
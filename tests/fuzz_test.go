@@ -0,0 +1,252 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var fuzzMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testfuzz"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testfuzz", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	fuzzMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("fuzz test mari initialized")
+}
+
+// fuzzSeeds are the edge cases of keys and values every fuzz target starts from
+var fuzzSeeds = [][]byte{nil, {}, {0}, {0xff}, []byte("a"), []byte("ab"), []byte("hello"), bytes.Repeat([]byte{0xff}, 64), bytes.Repeat([]byte("0"), mariv2.MaxKeySize+1)}
+
+// checkInternal fails the fuzz target if an operation recovered from a panic
+func checkInternal(t *testing.T, opErr error) {
+	if errors.Is(opErr, mariv2.ErrInternal) {
+		t.Fatalf("expected no panic within mari: %s", opErr.Error())
+	}
+}
+
+func FuzzMariPutGet(f *testing.F) {
+	for _, key := range fuzzSeeds {
+		for _, value := range fuzzSeeds[:3] {
+			f.Add(key, value)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, key, value []byte) {
+		putErr := fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(key, value)
+		})
+
+		checkInternal(t, putErr)
+
+		if len(key) == 0 && !errors.Is(putErr, mariv2.ErrEmptyKey) {
+			t.Fatalf("expected error on put of an empty key: actual(%v)", putErr)
+		}
+
+		getErr := fuzzMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getTxErr := tx.Get(key, nil)
+			checkInternal(t, getTxErr)
+
+			if getTxErr != nil || putErr != nil {
+				return nil
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, value) {
+				return fmt.Errorf("expected the value put for key %x: actual(%v)", key, kvPair)
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Fatal(getErr.Error())
+		}
+
+		deleteErr := fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Delete(key)
+		})
+
+		checkInternal(t, deleteErr)
+	})
+}
+
+func FuzzMariIterate(f *testing.F) {
+	for _, key := range fuzzSeeds {
+		f.Add(key, 0)
+		f.Add(key, 3)
+		f.Add(key, -1)
+	}
+
+	f.Fuzz(func(t *testing.T, startKey []byte, totalResults int) {
+		putErr := fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(startKey, []byte("start"))
+		})
+
+		checkInternal(t, putErr)
+
+		fuzzMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, iterErr := tx.Iterate(startKey, totalResults, nil)
+			checkInternal(t, iterErr)
+
+			if iterErr == nil && len(kvPairs) > max(totalResults, 0) {
+				t.Fatalf("expected at most %d results: actual(%d)", totalResults, len(kvPairs))
+			}
+
+			return nil
+		})
+	})
+}
+
+func FuzzMariRange(f *testing.F) {
+	for _, startKey := range fuzzSeeds {
+		for _, endKey := range fuzzSeeds {
+			f.Add(startKey, endKey)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, startKey, endKey []byte) {
+		putErr := fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(startKey, []byte("start"))
+		})
+
+		checkInternal(t, putErr)
+
+		fuzzMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range(startKey, endKey, nil)
+			checkInternal(t, rangeErr)
+
+			for _, kvPair := range kvPairs {
+				if (startKey != nil && bytes.Compare(kvPair.Key, startKey) < 0) || (endKey != nil && bytes.Compare(kvPair.Key, endKey) > 0) {
+					t.Fatalf("expected keys within the range: actual(%x)", kvPair.Key)
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+func TestMariInvalidArguments(t *testing.T) {
+	if readErr := fuzzMariInst.ReadTx(nil); !errors.Is(readErr, mariv2.ErrNilTxOps) {
+		t.Errorf("expected error on read with a nil transaction function: actual(%v)", readErr)
+	}
+
+	if updateErr := fuzzMariInst.UpdateTx(nil); !errors.Is(updateErr, mariv2.ErrNilTxOps) {
+		t.Errorf("expected error on update with a nil transaction function: actual(%v)", updateErr)
+	}
+
+	readErr := fuzzMariInst.ReadTx(func(tx *mariv2.Tx) error {
+		kvPair, getErr := tx.Get([]byte("missing"), nil)
+		if getErr != nil || kvPair != nil {
+			return fmt.Errorf("expected nil on get of a missing key: %v, %v", getErr, kvPair)
+		}
+
+		kvPairs, iterErr := tx.Iterate(nil, -1, nil)
+		if iterErr != nil || len(kvPairs) != 0 {
+			return fmt.Errorf("expected no results on iterate with negative total results: %v, %d", iterErr, len(kvPairs))
+		}
+
+		_, explainErr := tx.Explain(nil)
+		if !errors.Is(explainErr, mariv2.ErrNilTxOps) {
+			return fmt.Errorf("expected error on explain with a nil function: actual(%v)", explainErr)
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		t.Error(readErr.Error())
+	}
+
+	putErr := fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put(bytes.Repeat([]byte("0"), mariv2.MaxKeySize+1), []byte("value"))
+	})
+
+	if !errors.Is(putErr, mariv2.ErrKeyTooLarge) {
+		t.Errorf("expected error on put of a key longer than the max key size: actual(%v)", putErr)
+	}
+
+	putErr = fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put([]byte("large"), bytes.Repeat([]byte("0"), mariv2.MaxValueSize+1))
+	})
+
+	if !errors.Is(putErr, mariv2.ErrValueTooLarge) {
+		t.Errorf("expected error on put of a value longer than the max value size: actual(%v)", putErr)
+	}
+
+	largestKey, largestValue := bytes.Repeat([]byte("k"), mariv2.MaxKeySize), bytes.Repeat([]byte("v"), mariv2.MaxValueSize)
+	putErr = fuzzMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put(largestKey, largestValue)
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on put of the largest key and value: %s", putErr.Error())
+	}
+
+	readErr = fuzzMariInst.ReadTx(func(tx *mariv2.Tx) error {
+		kvPair, getErr := tx.Get(largestKey, nil)
+		if getErr != nil || kvPair == nil || !bytes.Equal(kvPair.Value, largestValue) {
+			return fmt.Errorf("expected the largest value to be read back: %v, %v", getErr, kvPair != nil)
+		}
+
+		return nil
+	})
+
+	if readErr != nil {
+		t.Error(readErr.Error())
+	}
+
+	os.Remove(filepath.Join(os.TempDir(), "testmaxsize"))
+
+	maxKeySize, maxValueSize := 8, 16
+	limitedMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testmaxsize", MaxKeySize: &maxKeySize, MaxValueSize: &maxValueSize})
+	if openErr != nil {
+		t.Fatalf("error opening mari: %s", openErr.Error())
+	}
+
+	defer limitedMariInst.Remove()
+
+	putErr = limitedMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put([]byte("12345678"), bytes.Repeat([]byte("0"), 16))
+	})
+
+	if putErr != nil {
+		t.Errorf("error on put within the configured sizes: %s", putErr.Error())
+	}
+
+	putErr = limitedMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put([]byte("123456789"), []byte("value"))
+	})
+
+	if !errors.Is(putErr, mariv2.ErrKeyTooLarge) {
+		t.Errorf("expected error on put of a key longer than the configured max key size: actual(%v)", putErr)
+	}
+
+	putErr = limitedMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.PutWithTTL([]byte("key"), bytes.Repeat([]byte("0"), 17), time.Minute)
+	})
+
+	if !errors.Is(putErr, mariv2.ErrValueTooLarge) {
+		t.Errorf("expected error on put of a value longer than the configured max value size: actual(%v)", putErr)
+	}
+
+	invalidSize := mariv2.MaxValueSize + 1
+	_, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testmaxsizeinvalid", MaxValueSize: &invalidSize})
+	if openErr == nil {
+		t.Error("expected error opening with a max value size over MaxValueSize")
+	}
+}
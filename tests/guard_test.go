@@ -0,0 +1,141 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var guardMariInst *mariv2.Mari
+var guardLogs *SyncBuffer
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testguard"))
+
+	guardLogs = &SyncBuffer{}
+	warnThreshold, abortThreshold := 50*time.Millisecond, 200*time.Millisecond
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:             os.TempDir(),
+		FileName:             "testguard",
+		NodePoolSize:         &nodePoolSize,
+		Logger:               slog.New(slog.NewTextHandler(guardLogs, nil)),
+		ReadTxWarnThreshold:  &warnThreshold,
+		ReadTxAbortThreshold: &abortThreshold,
+	}
+
+	var openErr error
+	guardMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := guardMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put([]byte("hello"), []byte("world"))
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("guard test mari initialized")
+}
+
+func TestMariReadGuard(t *testing.T) {
+	defer guardMariInst.Remove()
+
+	stats := func() *mariv2.Stats {
+		stats, statsErr := guardMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+		return stats
+	}
+
+	t.Run("Test Warn On Long Read", func(t *testing.T) {
+		readErr := guardMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			time.Sleep(100 * time.Millisecond)
+			_, getErr := tx.Get([]byte("hello"), nil)
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		logs := guardLogs.String()
+		if !strings.Contains(logs, "long running read transaction") || !strings.Contains(logs, "TestMariReadGuard") {
+			t.Errorf("expected warning with stack for long read: actual(%s)", logs)
+		}
+
+		if longReadTxs := stats().LongReadTxs; longReadTxs != 1 {
+			t.Errorf("unexpected long read transactions: actual(%d), expected(%d)", longReadTxs, 1)
+		}
+	})
+
+	t.Run("Test Abort On Long Read", func(t *testing.T) {
+		readErr := guardMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			time.Sleep(250 * time.Millisecond)
+			_, getErr := tx.Get([]byte("hello"), nil)
+			return getErr
+		})
+
+		if !errors.Is(readErr, mariv2.ErrReadTxTimeout) {
+			t.Errorf("expected read to be aborted: actual(%v)", readErr)
+		}
+
+		updateErr := guardMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			time.Sleep(250 * time.Millisecond)
+			_, getErr := tx.Get([]byte("hello"), nil)
+			return getErr
+		})
+
+		if updateErr != nil {
+			t.Errorf("expected read-write transaction not to be aborted: actual(%v)", updateErr)
+		}
+	})
+
+	t.Run("Test Active Read Transactions", func(t *testing.T) {
+		tx, beginErr := guardMariInst.Begin(true)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		if active := stats().ActiveReadTxs; active != 1 {
+			t.Errorf("unexpected active read transactions: actual(%d), expected(%d)", active, 1)
+		}
+
+		tx.Rollback()
+		if active := stats().ActiveReadTxs; active != 0 {
+			t.Errorf("unexpected active read transactions after rollback: actual(%d), expected(%d)", active, 0)
+		}
+	})
+
+	t.Run("Test Warn On Open Read", func(t *testing.T) {
+		logOffset := len(guardLogs.String())
+		tx, beginErr := guardMariInst.Begin(true)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		defer tx.Rollback()
+
+		time.Sleep(150 * time.Millisecond)
+
+		logs := guardLogs.String()[logOffset:]
+		if !strings.Contains(logs, "long running read transaction still open") || strings.Count(logs, "still open") != 1 {
+			t.Errorf("expected a single warning for the open read before it finishes: actual(%s)", logs)
+		}
+
+		if !strings.Contains(logs[strings.Index(logs, "still open"):], "TestMariReadGuard") {
+			t.Errorf("expected the warning to have the stack that started the read: actual(%s)", logs)
+		}
+	})
+}
@@ -0,0 +1,502 @@
+package maritests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const HLC_INPUT_SIZE = 100
+
+var hlcMariInst *mariv2.Mari
+var hlcKeyValPairs []KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testhlc"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testhlc", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	hlcMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	hlcKeyValPairs = make([]KeyVal, HLC_INPUT_SIZE)
+	for idx := range hlcKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		hlcKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("hlc test mari initialized")
+}
+
+func TestMariHLC(t *testing.T) {
+	defer hlcMariInst.Remove()
+
+	get := func(key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		getErr := hlcMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(key, nil)
+			return getTxErr
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+		return kvPair
+	}
+
+	timestamps := make([]uint64, HLC_INPUT_SIZE)
+
+	t.Run("Test Commit Timestamps Increase", func(t *testing.T) {
+		var prev uint64
+		for idx, val := range hlcKeyValPairs {
+			putErr := hlcMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				return tx.Put(val.Key, val.Value)
+			})
+
+			if putErr != nil {
+				t.Fatalf("error on mari put: %s", putErr.Error())
+			}
+
+			stats, statsErr := hlcMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error getting stats: %s", statsErr.Error())
+			}
+
+			if stats.Timestamp <= prev {
+				t.Fatalf("commit timestamp did not increase: actual(%d), previous(%d)", stats.Timestamp, prev)
+			}
+
+			prev = stats.Timestamp
+			timestamps[idx] = stats.Timestamp
+		}
+	})
+
+	t.Run("Test Key Timestamp Is Last Write", func(t *testing.T) {
+		for idx, val := range hlcKeyValPairs {
+			kvPair := get(val.Key)
+			if kvPair.Timestamp != timestamps[idx] {
+				t.Errorf("key timestamp not equal to commit timestamp: actual(%d), expected(%d)", kvPair.Timestamp, timestamps[idx])
+			}
+		}
+
+		physical := mariv2.HLCTime(timestamps[0])
+		if time.Since(physical) > time.Minute || time.Until(physical) > time.Second {
+			t.Errorf("timestamp physical time not near wall clock: %s", physical)
+		}
+	})
+
+	t.Run("Test Read As Of", func(t *testing.T) {
+		key := hlcKeyValPairs[0].Key
+		putErr := hlcMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(key, []byte("updated"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		var kvPair *mariv2.KeyValuePair
+		readErr := hlcMariInst.ReadTxAsOf(timestamps[HLC_INPUT_SIZE-1], func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(key, nil)
+			return getTxErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on read as of: %s", readErr.Error())
+		}
+
+		if kvPair == nil || !bytes.Equal(kvPair.Value, hlcKeyValPairs[0].Value) {
+			t.Errorf("expected value as of timestamp: actual(%v)", kvPair)
+		}
+
+		readErr = hlcMariInst.ReadTxAsOf(timestamps[0], func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(hlcKeyValPairs[1].Key, nil)
+			return getTxErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on read as of: %s", readErr.Error())
+		}
+
+		if kvPair != nil {
+			t.Errorf("expected key written after timestamp to be missing: actual(%v)", kvPair)
+		}
+
+		readErr = hlcMariInst.ReadTxAtVersion(1, func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(key, nil)
+			return getTxErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on read at version: %s", readErr.Error())
+		}
+
+		if kvPair == nil || kvPair.Version != 1 {
+			t.Errorf("expected first write at version 1: actual(%v)", kvPair)
+		}
+
+		readErr = hlcMariInst.ReadTxAsOf(0, func(tx *mariv2.Tx) error { return nil })
+		if !errors.Is(readErr, mariv2.ErrVersionNotFound) {
+			t.Errorf("expected version not found before creation: actual(%v)", readErr)
+		}
+	})
+
+	t.Run("Test Range History", func(t *testing.T) {
+		key := hlcKeyValPairs[0].Key
+		rangeHistory := func(startKey, endKey []byte, opts *mariv2.RangeOpts) []*mariv2.KeyValuePair {
+			var kvPairs []*mariv2.KeyValuePair
+			readErr := hlcMariInst.ReadTx(func(tx *mariv2.Tx) error {
+				var rangeTxErr error
+				kvPairs, rangeTxErr = tx.Range(startKey, endKey, opts)
+				return rangeTxErr
+			})
+
+			if readErr != nil {
+				t.Fatalf("error on mari range: %s", readErr.Error())
+			}
+			return kvPairs
+		}
+
+		endKey := append(bytes.Clone(key), 0x00)
+		maxVersions := 3
+		kvPairs := rangeHistory(key, endKey, &mariv2.RangeOpts{MaxVersions: &maxVersions})
+		if len(kvPairs) != 2 {
+			t.Fatalf("expected 2 versions of key: actual(%d)", len(kvPairs))
+		}
+
+		if !bytes.Equal(kvPairs[0].Value, []byte("updated")) || !bytes.Equal(kvPairs[1].Value, hlcKeyValPairs[0].Value) {
+			t.Errorf("versions not returned newest first: actual(%s, %s)", kvPairs[0].Value, kvPairs[1].Value)
+		}
+
+		if kvPairs[1].Version != 1 || kvPairs[1].Timestamp != timestamps[0] {
+			t.Errorf("previous version not equal to first write: actual(%v)", kvPairs[1])
+		}
+
+		sharedBuffers := true
+		sharedKvPairs := rangeHistory(key, endKey, &mariv2.RangeOpts{MaxVersions: &maxVersions, SharedBuffers: &sharedBuffers})
+		if len(sharedKvPairs) != len(kvPairs) {
+			t.Fatalf("expected shared buffers to return the same versions: actual(%d), expected(%d)", len(sharedKvPairs), len(kvPairs))
+		}
+
+		for idx, kvPair := range sharedKvPairs {
+			if !bytes.Equal(kvPair.Key, kvPairs[idx].Key) || !bytes.Equal(kvPair.Value, kvPairs[idx].Value) || kvPair.Version != kvPairs[idx].Version {
+				t.Errorf("shared buffer version not equal to range: actual(%v), expected(%v)", kvPair, kvPairs[idx])
+			}
+		}
+
+		if &sharedKvPairs[0].Key[0] != &sharedKvPairs[1].Key[0] {
+			t.Errorf("expected versions of a key to share one copy of the key")
+		}
+
+		minVersion := uint64(2)
+		kvPairs = rangeHistory(key, endKey, &mariv2.RangeOpts{MaxVersions: &maxVersions, MinVersion: &minVersion})
+		if len(kvPairs) != 1 {
+			t.Errorf("expected versions before min version to be excluded: actual(%d)", len(kvPairs))
+		}
+
+		maxVersions = 1
+		kvPairs = rangeHistory(key, endKey, &mariv2.RangeOpts{MaxVersions: &maxVersions})
+		if len(kvPairs) != 1 {
+			t.Errorf("expected only latest version: actual(%d)", len(kvPairs))
+		}
+
+		maxVersions = 5
+		kvPairs = rangeHistory(nil, nil, &mariv2.RangeOpts{MaxVersions: &maxVersions})
+		if len(kvPairs) != HLC_INPUT_SIZE+1 {
+			t.Errorf("unexpected total versions in range: actual(%d), expected(%d)", len(kvPairs), HLC_INPUT_SIZE+1)
+		}
+
+		for idx := 1; idx < len(kvPairs); idx++ {
+			order := bytes.Compare(kvPairs[idx-1].Key, kvPairs[idx].Key)
+			if order == 1 || (order == 0 && kvPairs[idx-1].Version <= kvPairs[idx].Version) {
+				t.Fatalf("range history not ordered by key then newest version at %d", idx)
+			}
+		}
+	})
+
+	t.Run("Test Versions", func(t *testing.T) {
+		stats, statsErr := hlcMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		versions, versionsErr := hlcMariInst.Versions()
+		if versionsErr != nil {
+			t.Fatalf("error listing versions: %s", versionsErr.Error())
+		}
+
+		if uint64(len(versions)) != stats.Version+1 {
+			t.Fatalf("expected every version to be retained: actual(%d), expected(%d)", len(versions), stats.Version+1)
+		}
+
+		var totalSize uint64
+		for idx, version := range versions {
+			if version.Version != uint64(idx) || version.Size == 0 || version.Pinned {
+				t.Fatalf("unexpected version: %+v", version)
+			}
+
+			if idx > 0 && idx <= HLC_INPUT_SIZE && version.Timestamp != timestamps[idx-1] {
+				t.Fatalf("expected the commit timestamp of version %d: actual(%d), expected(%d)", idx, version.Timestamp, timestamps[idx-1])
+			}
+
+			totalSize += version.Size
+		}
+
+		if versions[0].RootOffset+totalSize != stats.NextStartOffset {
+			t.Errorf("expected the versions to cover the serialized data: actual(%d), expected(%d)", versions[0].RootOffset+totalSize, stats.NextStartOffset)
+		}
+
+		reader, beginErr := hlcMariInst.Begin(true)
+		if beginErr != nil {
+			t.Fatalf("error beginning read transaction: %s", beginErr.Error())
+		}
+
+		iter, iterErr := hlcMariInst.NewIterator(nil, nil)
+		if iterErr != nil {
+			t.Fatalf("error opening iterator: %s", iterErr.Error())
+		}
+
+		pinnedVersions, versionsErr := hlcMariInst.Versions()
+		iter.Close()
+		reader.Rollback()
+
+		if versionsErr != nil {
+			t.Fatalf("error listing versions: %s", versionsErr.Error())
+		}
+
+		latest := pinnedVersions[len(pinnedVersions)-1]
+		if !latest.Pinned || latest.Readers != 2 || latest.Iterators != 1 || pinnedVersions[0].Pinned {
+			t.Fatalf("expected only the latest version to be pinned by the reader and the iterator: actual(%+v)", latest)
+		}
+
+		versions, _ = hlcMariInst.Versions()
+		if versions[len(versions)-1].Pinned {
+			t.Errorf("expected the latest version to be unpinned once closed: actual(%+v)", versions[len(versions)-1])
+		}
+	})
+
+	t.Run("Test Clock Survives Reopen", func(t *testing.T) {
+		stats, statsErr := hlcMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		hlcMariInst.Close()
+
+		var openErr error
+		nodePoolSize := int64(1000)
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testhlc", NodePoolSize: &nodePoolSize}
+		hlcMariInst, openErr = mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		kvPair := get(hlcKeyValPairs[1].Key)
+		if kvPair == nil || kvPair.Timestamp != timestamps[1] {
+			t.Errorf("key timestamp not retained after reopen: actual(%v), expected(%d)", kvPair, timestamps[1])
+		}
+
+		putErr := hlcMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(hlcKeyValPairs[1].Key, []byte("reopened"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		if kvPair := get(hlcKeyValPairs[1].Key); kvPair.Timestamp <= stats.Timestamp {
+			t.Errorf("timestamp after reopen not greater than before: actual(%d), before(%d)", kvPair.Timestamp, stats.Timestamp)
+		}
+	})
+
+	t.Run("Test Reject Unsupported Format", func(t *testing.T) {
+		legacyFile := filepath.Join(os.TempDir(), "testhlclegacy")
+		defer os.Remove(legacyFile)
+
+		sFile := make([]byte, os.Getpagesize())
+		binary.LittleEndian.PutUint64(sFile[mariv2.MetaFormatVersionIdx:], mariv2.CurrentFormatVersion+1)
+
+		writeErr := os.WriteFile(legacyFile, sFile, 0600)
+		if writeErr != nil {
+			t.Fatalf("error writing unsupported file: %s", writeErr.Error())
+		}
+
+		nodePoolSize := int64(1000)
+		_, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testhlclegacy", NodePoolSize: &nodePoolSize})
+		if !errors.Is(openErr, mariv2.ErrUnsupportedFormat) {
+			t.Errorf("expected unsupported format error: actual(%v)", openErr)
+		}
+	})
+
+	t.Run("Test Upgrade Legacy Format", func(t *testing.T) {
+		legacyFile := filepath.Join(os.TempDir(), "testhlcbaseline")
+		defer os.Remove(legacyFile)
+
+		legacyKeyValPairs := []KeyVal{
+			{Key: []byte("apple"), Value: []byte("red")},
+			{Key: []byte("banana"), Value: []byte("yellow")},
+			{Key: []byte("cherry"), Value: []byte("dark red")},
+		}
+
+		writeErr := writeLegacyFile(legacyFile, legacyKeyValPairs)
+		if writeErr != nil {
+			t.Fatalf("error writing legacy file: %s", writeErr.Error())
+		}
+
+		before := time.Now()
+		nodePoolSize := int64(1000)
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testhlcbaseline", NodePoolSize: &nodePoolSize}
+		legacyMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening legacy file: %s", openErr.Error())
+		}
+
+		stats, statsErr := legacyMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.FormatVersion != mariv2.FormatVersionSubtreeCounts {
+			t.Errorf("legacy file not upgraded to the format of a new file: actual(%d)", stats.FormatVersion)
+		}
+
+		getAll := func(mariInst *mariv2.Mari) {
+			readErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+				for _, kv := range legacyKeyValPairs {
+					kvPair, getErr := tx.Get(kv.Key, nil)
+					if getErr != nil {
+						return getErr
+					}
+
+					if kvPair == nil || !bytes.Equal(kvPair.Value, kv.Value) {
+						t.Errorf("legacy key %q not equal to expected: actual(%v), expected(%q)", kv.Key, kvPair, kv.Value)
+						continue
+					}
+
+					if time.UnixMilli(int64(kvPair.Timestamp >> mariv2.HLCLogicalBits)).Before(before.Truncate(time.Millisecond)) {
+						t.Errorf("legacy key %q not given the timestamp of the upgrade: actual(%d)", kv.Key, kvPair.Timestamp)
+					}
+				}
+
+				count, countErr := tx.Count()
+				if countErr != nil {
+					return countErr
+				}
+
+				if count != len(legacyKeyValPairs) {
+					t.Errorf("count of upgraded file not equal to legacy keys: actual(%d), expected(%d)", count, len(legacyKeyValPairs))
+				}
+
+				return nil
+			})
+
+			if readErr != nil {
+				t.Fatalf("error reading upgraded file: %s", readErr.Error())
+			}
+		}
+
+		getAll(legacyMariInst)
+
+		putErr := legacyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("date"), []byte("brown"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		closeErr := legacyMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		legacyKeyValPairs = append(legacyKeyValPairs, KeyVal{Key: []byte("date"), Value: []byte("brown")})
+
+		legacyMariInst, openErr = mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error reopening upgraded file: %s", openErr.Error())
+		}
+
+		defer legacyMariInst.Close()
+		getAll(legacyMariInst)
+	})
+}
+
+// writeLegacyFile
+//
+//	Write a file in the layout of the first release, with 24 bytes of metadata and leaf nodes without a timestamp.
+//	The empty root of version 0 is at offset 24, followed by a version 1 root with a child for each key, so the keys must start with different bytes.
+func writeLegacyFile(path string, kvPairs []KeyVal) error {
+	const nodeChildrenIdx, leafKeyIdx = 58, 19
+
+	appendINode := func(sFile []byte, version uint64, bitmap [8]uint32, children []uint64) []byte {
+		start := uint64(len(sFile))
+		end := nodeChildrenIdx + 8*len(children) - 1
+
+		sFile = binary.LittleEndian.AppendUint64(sFile, version)
+		sFile = binary.LittleEndian.AppendUint64(sFile, start)
+		sFile = binary.LittleEndian.AppendUint16(sFile, uint16(end))
+		for _, subBitmap := range bitmap {
+			sFile = binary.LittleEndian.AppendUint32(sFile, subBitmap)
+		}
+
+		sFile = binary.LittleEndian.AppendUint64(sFile, start+uint64(end)+1)
+		for _, child := range children {
+			sFile = binary.LittleEndian.AppendUint64(sFile, child)
+		}
+
+		return sFile
+	}
+
+	appendLNode := func(sFile []byte, version uint64, key, value []byte) []byte {
+		start := uint64(len(sFile))
+		sFile = binary.LittleEndian.AppendUint64(sFile, version)
+		sFile = binary.LittleEndian.AppendUint64(sFile, start)
+		sFile = binary.LittleEndian.AppendUint16(sFile, uint16(leafKeyIdx+len(key)+len(value)-1))
+		sFile = append(sFile, byte(len(key)))
+		sFile = append(sFile, key...)
+		return append(sFile, value...)
+	}
+
+	sFile := make([]byte, 24)
+	sFile = appendINode(sFile, 0, [8]uint32{}, nil)
+	sFile = appendLNode(sFile, 0, nil, nil)
+
+	var bitmap [8]uint32
+	var children []uint64
+	rootOffset := uint64(len(sFile))
+	childOffset := rootOffset + nodeChildrenIdx + uint64(8*len(kvPairs)) + leafKeyIdx
+	for _, kv := range kvPairs {
+		bitmap[kv.Key[0]>>5] |= 1 << (kv.Key[0] & 0x1F)
+		children = append(children, childOffset)
+		childOffset += nodeChildrenIdx + leafKeyIdx + uint64(len(kv.Key)+len(kv.Value))
+	}
+
+	sFile = appendINode(sFile, 1, bitmap, children)
+	sFile = appendLNode(sFile, 1, nil, nil)
+	for _, kv := range kvPairs {
+		sFile = appendINode(sFile, 1, [8]uint32{}, nil)
+		sFile = appendLNode(sFile, 1, kv.Key, kv.Value)
+	}
+
+	binary.LittleEndian.PutUint64(sFile[0:], 1)
+	binary.LittleEndian.PutUint64(sFile[8:], rootOffset)
+	binary.LittleEndian.PutUint64(sFile[16:], uint64(len(sFile)))
+
+	return os.WriteFile(path, append(sFile, make([]byte, os.Getpagesize())...), 0600)
+}
@@ -0,0 +1,175 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var hooksMariInst *mariv2.Mari
+var hookEvents []*mariv2.CommitEvent
+var hookLock sync.Mutex
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testhooks"))
+
+	nodePoolSize := int64(1000)
+	hook := func(event *mariv2.CommitEvent) {
+		hookLock.Lock()
+		defer hookLock.Unlock()
+
+		hookEvents = append(hookEvents, event)
+	}
+
+	var openErr error
+	hooksMariInst, openErr = mariv2.Open(mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testhooks",
+		NodePoolSize: &nodePoolSize,
+		CommitHooks:  []mariv2.CommitHook{hook},
+	})
+
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("hooks test mari initialized")
+}
+
+func TestMariCommitHooks(t *testing.T) {
+	defer hooksMariInst.Remove()
+
+	lastHookEvent := func() *mariv2.CommitEvent {
+		hookLock.Lock()
+		defer hookLock.Unlock()
+
+		if len(hookEvents) == 0 {
+			return nil
+		}
+
+		return hookEvents[len(hookEvents)-1]
+	}
+
+	t.Run("Test Annotated Commit", func(t *testing.T) {
+		eventChan, cancel := hooksMariInst.CommitChan(1)
+		defer cancel()
+
+		updateErr := hooksMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			tx.SetAnnotation("request", "42")
+			if tx.Annotations()["request"] != "42" {
+				return fmt.Errorf("expected the annotation on the transaction: actual(%v)", tx.Annotations())
+			}
+
+			putErr := tx.Put([]byte("hooks:first"), []byte("value"))
+			if putErr != nil {
+				return putErr
+			}
+
+			return tx.Delete([]byte("hooks:second"))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		event := lastHookEvent()
+		if event == nil || event.Annotations["request"] != "42" || len(event.Changes) != 2 {
+			t.Fatalf("expected the hook to be called with the annotated commit: actual(%+v)", event)
+		}
+
+		if !bytes.Equal(event.Changes[0].Key, []byte("hooks:first")) || !bytes.Equal(event.Changes[0].Value, []byte("value")) || event.Changes[0].Delete {
+			t.Errorf("expected the put: actual(%+v)", event.Changes[0])
+		}
+
+		if !bytes.Equal(event.Changes[1].Key, []byte("hooks:second")) || !event.Changes[1].Delete {
+			t.Errorf("expected the delete: actual(%+v)", event.Changes[1])
+		}
+
+		streamed := <-eventChan
+		if streamed != event {
+			t.Errorf("expected the same event on the commit stream: actual(%+v)", streamed)
+		}
+
+		readErr := hooksMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			if tx.SnapshotVersion() < streamed.Version {
+				return fmt.Errorf("expected the commit to be visible once streamed: actual(%d)", tx.SnapshotVersion())
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+	})
+
+	t.Run("Test Manual Commit", func(t *testing.T) {
+		tx, beginErr := hooksMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		tx.SetAnnotation("actor", "manual")
+		tx.Put([]byte("hooks:manual"), []byte("value"))
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("error on mari commit: %s", commitErr.Error())
+		}
+
+		if event := lastHookEvent(); event == nil || event.Annotations["actor"] != "manual" {
+			t.Errorf("expected the hook to be called on commit: actual(%+v)", event)
+		}
+	})
+
+	t.Run("Test Stream Order", func(t *testing.T) {
+		eventChan, cancel := hooksMariInst.CommitChan(100)
+
+		var wg sync.WaitGroup
+		for idx := 0; idx < 50; idx++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				hooksMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+					return tx.Put([]byte(fmt.Sprintf("hooks:order:%d", idx)), []byte("value"))
+				})
+			}()
+		}
+
+		wg.Wait()
+		cancel()
+
+		var total int
+		var prevVersion uint64
+		for event := range eventChan {
+			if total > 0 && event.Version != prevVersion+1 {
+				t.Fatalf("expected events in version order: actual(%d after %d)", event.Version, prevVersion)
+			}
+
+			prevVersion = event.Version
+			total++
+		}
+
+		if total != 50 {
+			t.Errorf("expected an event for each commit: actual(%d)", total)
+		}
+	})
+
+	t.Run("Test Stream Closed", func(t *testing.T) {
+		eventChan, _ := hooksMariInst.CommitChan(1)
+
+		closeErr := hooksMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error on mari close: %s", closeErr.Error())
+		}
+
+		if _, ok := <-eventChan; ok {
+			t.Error("expected the commit stream to be closed with the instance")
+		}
+	})
+}
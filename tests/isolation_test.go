@@ -0,0 +1,553 @@
+package maritests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var snapshotMariInst *mariv2.Mari
+var serializableMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testisolationsnapshot"))
+	os.Remove(filepath.Join(os.TempDir(), "testisolationserializable"))
+
+	nodePoolSize := int64(1000)
+	serializable := mariv2.IsolationSerializable
+
+	var openErr error
+	snapshotMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testisolationsnapshot", NodePoolSize: &nodePoolSize})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	serializableMariInst, openErr = mariv2.Open(mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testisolationserializable",
+		NodePoolSize: &nodePoolSize,
+		Isolation:    &serializable,
+	})
+
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("isolation test mari initialized")
+}
+
+func TestMariIsolation(t *testing.T) {
+	defer snapshotMariInst.Remove()
+	defer serializableMariInst.Remove()
+
+	put := func(t *testing.T, isoMariInst *mariv2.Mari, key, value string) {
+		putErr := isoMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte(key), []byte(value))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+	}
+
+	get := func(t *testing.T, isoMariInst *mariv2.Mari, key string) []byte {
+		var value []byte
+		getErr := isoMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getTxErr := tx.Get([]byte(key), nil)
+			if kvPair != nil {
+				value = bytes.Clone(kvPair.Value)
+			}
+
+			return getTxErr
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+
+		return value
+	}
+
+	// writeSkew reads both keys, then writes the first key while a concurrent transaction that also read both keys writes the second
+	writeSkew := func(t *testing.T, isoMariInst *mariv2.Mari) error {
+		put(t, isoMariInst, "skew:x", "on")
+		put(t, isoMariInst, "skew:y", "on")
+
+		tx, beginErr := isoMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		kvPairs, rangeErr := tx.Range([]byte("skew:"), []byte("skew:~"), nil)
+		if rangeErr != nil || len(kvPairs) != 2 {
+			t.Fatalf("error on mari range: %v, %d", rangeErr, len(kvPairs))
+		}
+
+		updateErr := isoMariInst.UpdateTx(func(updateTx *mariv2.Tx) error {
+			_, getErr := updateTx.Get([]byte("skew:x"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			return updateTx.Put([]byte("skew:y"), []byte("off"))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari put: %s", updateErr.Error())
+		}
+
+		putErr := tx.Put([]byte("skew:x"), []byte("off"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		return tx.Commit()
+	}
+
+	// attempts runs a transaction that reads one key and writes another, committing a write to the key read during the first attempt
+	attempts := func(t *testing.T, isoMariInst *mariv2.Mari) int {
+		var total int
+		updateErr := isoMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			total++
+
+			_, getErr := tx.Get([]byte("attempts:read"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if total == 1 {
+				put(t, isoMariInst, "attempts:read", "changed")
+			}
+
+			return tx.Put([]byte("attempts:write"), []byte(fmt.Sprintf("%d", total)))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		return total
+	}
+
+	t.Run("Test Snapshot Disjoint Writes", func(t *testing.T) {
+		tx, beginErr := snapshotMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		putErr := tx.Put([]byte("disjoint:first"), []byte("first"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		put(t, snapshotMariInst, "disjoint:second", "second")
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("expected disjoint writes to commit: %s", commitErr.Error())
+		}
+
+		if !bytes.Equal(get(t, snapshotMariInst, "disjoint:first"), []byte("first")) || !bytes.Equal(get(t, snapshotMariInst, "disjoint:second"), []byte("second")) {
+			t.Error("expected both writes after commit")
+		}
+	})
+
+	t.Run("Test Snapshot Write Skew", func(t *testing.T) {
+		commitErr := writeSkew(t, snapshotMariInst)
+		if commitErr != nil {
+			t.Fatalf("expected write skew to commit with snapshot isolation: %s", commitErr.Error())
+		}
+
+		if !bytes.Equal(get(t, snapshotMariInst, "skew:x"), []byte("off")) || !bytes.Equal(get(t, snapshotMariInst, "skew:y"), []byte("off")) {
+			t.Error("expected both writes after commit")
+		}
+
+		if total := attempts(t, snapshotMariInst); total != 1 {
+			t.Errorf("expected the transaction to be replayed without retrying: actual(%d)", total)
+		}
+	})
+
+	t.Run("Test Serializable Write Skew", func(t *testing.T) {
+		commitErr := writeSkew(t, serializableMariInst)
+		if !errors.Is(commitErr, mariv2.ErrTxConflict) {
+			t.Fatalf("expected write skew to conflict with serializable isolation: actual(%v)", commitErr)
+		}
+
+		if !bytes.Equal(get(t, serializableMariInst, "skew:x"), []byte("on")) {
+			t.Error("expected the conflicting write to be discarded")
+		}
+
+		if total := attempts(t, serializableMariInst); total != 2 {
+			t.Errorf("expected the transaction to be retried once: actual(%d)", total)
+		}
+
+		if !bytes.Equal(get(t, serializableMariInst, "attempts:write"), []byte("2")) {
+			t.Error("expected the write of the retried transaction")
+		}
+	})
+
+	t.Run("Test Get For Update", func(t *testing.T) {
+		put(t, snapshotMariInst, "forupdate:key", "first")
+
+		tx, beginErr := snapshotMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		kvPair, getErr := tx.GetForUpdate([]byte("forupdate:key"), nil)
+		if getErr != nil || kvPair == nil || !bytes.Equal(kvPair.Value, []byte("first")) {
+			t.Fatalf("error on mari get for update: %v, %v", getErr, kvPair)
+		}
+
+		putErr := tx.Put([]byte("forupdate:other"), []byte("derived"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		put(t, snapshotMariInst, "forupdate:unrelated", "unrelated")
+		put(t, snapshotMariInst, "forupdate:key", "second")
+
+		commitErr := tx.Commit()
+		if !errors.Is(commitErr, mariv2.ErrConflict) || !errors.Is(commitErr, mariv2.ErrTxConflict) {
+			t.Fatalf("expected conflict on a key read for update: actual(%v)", commitErr)
+		}
+
+		if get(t, snapshotMariInst, "forupdate:other") != nil {
+			t.Error("expected the conflicting write to be discarded")
+		}
+
+		var total int
+		updateErr := snapshotMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			total++
+
+			_, getTxErr := tx.GetForUpdate([]byte("forupdate:key"), nil)
+			if getTxErr != nil {
+				return getTxErr
+			}
+
+			if total == 1 {
+				put(t, snapshotMariInst, "forupdate:key", "third")
+			}
+
+			return tx.Put([]byte("forupdate:other"), []byte("derived"))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		if total != 2 {
+			t.Errorf("expected the transaction to be retried once: actual(%d)", total)
+		}
+
+		readErr := snapshotMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getTxErr := tx.GetForUpdate([]byte("forupdate:key"), nil)
+			return getTxErr
+		})
+
+		if readErr == nil {
+			t.Error("expected error on get for update in a read only transaction")
+		}
+	})
+
+	t.Run("Test Update If Version Unchanged", func(t *testing.T) {
+		stats, statsErr := snapshotMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		updateErr := snapshotMariInst.UpdateTxIf(stats.Timestamp, func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("conditional:key"), []byte("first"))
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on conditional update: %s", updateErr.Error())
+		}
+
+		updateErr = snapshotMariInst.UpdateTxIf(stats.Timestamp, func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("conditional:key"), []byte("stale"))
+		})
+
+		if !errors.Is(updateErr, mariv2.ErrStaleVersion) {
+			t.Fatalf("expected ErrStaleVersion for a version that advanced: actual(%v)", updateErr)
+		}
+
+		var timestamp uint64
+		readErr := snapshotMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			timestamp = tx.SnapshotTimestamp()
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		var attempts int
+		updateErr = snapshotMariInst.UpdateTxIf(timestamp, func(tx *mariv2.Tx) error {
+			attempts++
+			if attempts == 1 {
+				put(t, snapshotMariInst, "conditional:other", "concurrent")
+			}
+
+			return tx.Put([]byte("conditional:key"), []byte("raced"))
+		})
+
+		if !errors.Is(updateErr, mariv2.ErrStaleVersion) {
+			t.Fatalf("expected ErrStaleVersion for a concurrent commit: actual(%v)", updateErr)
+		}
+
+		if attempts != 1 {
+			t.Errorf("expected the transaction function to run once: actual(%d)", attempts)
+		}
+
+		if !bytes.Equal(get(t, snapshotMariInst, "conditional:key"), []byte("first")) {
+			t.Error("expected the stale writes to be discarded")
+		}
+	})
+
+	t.Run("Test Update If Across Compaction", func(t *testing.T) {
+		os.Remove(filepath.Join(os.TempDir(), "testupdateifcompact"))
+
+		var compactNow atomic.Bool
+		compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return compactNow.CompareAndSwap(true, false) })
+		compactMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testupdateifcompact", CompactTrigger: &compactTrigger})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer compactMariInst.Remove()
+
+		stats := func() *mariv2.Stats {
+			stats, statsErr := compactMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+
+			return stats
+		}
+
+		put(t, compactMariInst, "plan", "first")
+		put(t, compactMariInst, "plan", "second")
+		read := stats()
+
+		for idx := range 4 {
+			put(t, compactMariInst, "plan", fmt.Sprintf("later %d", idx))
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for version := stats().Version; stats().Version >= version; {
+			if time.Now().After(deadline) {
+				t.Fatal("file was not compacted")
+			}
+
+			compactNow.Store(true)
+			put(t, compactMariInst, "compact", "value")
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		compacted := stats()
+		updateErr := compactMariInst.UpdateTxIf(compacted.Timestamp, func(tx *mariv2.Tx) error { return nil })
+		if updateErr != nil {
+			t.Fatalf("expected compaction alone not to make the snapshot stale: actual(%v)", updateErr)
+		}
+
+		for stats().Version < read.Version {
+			put(t, compactMariInst, "plan", "after compaction")
+		}
+
+		if version := stats().Version; version != read.Version {
+			t.Fatalf("expected the version to be reached again after compaction: actual(%d), expected(%d)", version, read.Version)
+		}
+
+		updateErr = compactMariInst.UpdateTxIf(read.Timestamp, func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("plan"), []byte("lost update"))
+		})
+
+		if !errors.Is(updateErr, mariv2.ErrStaleVersion) {
+			t.Errorf("expected ErrStaleVersion for a snapshot read before compaction: actual(%v)", updateErr)
+		}
+	})
+
+	t.Run("Test Contention Stats", func(t *testing.T) {
+		stats := func(isoMariInst *mariv2.Mari) mariv2.ContentionStats {
+			isoStats, statsErr := isoMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+
+			return isoStats.Contention
+		}
+
+		before := stats(snapshotMariInst)
+		for total := 0; total < 3; total++ {
+			tx, beginErr := snapshotMariInst.Begin(false)
+			if beginErr != nil {
+				t.Fatalf("error on mari begin: %s", beginErr.Error())
+			}
+
+			putErr := tx.Put([]byte("contention:hot"), []byte("first"))
+			if putErr != nil {
+				t.Fatalf("error on mari put: %s", putErr.Error())
+			}
+
+			put(t, snapshotMariInst, "contention:hot", fmt.Sprintf("second %d", total))
+
+			commitErr := tx.Commit()
+			if !errors.Is(commitErr, mariv2.ErrTxConflict) {
+				t.Fatalf("expected conflict on a concurrently written key: actual(%v)", commitErr)
+			}
+		}
+
+		attempts(t, serializableMariInst)
+
+		after := stats(snapshotMariInst)
+		if after.Aborts-before.Aborts != 3 {
+			t.Errorf("expected an abort for each conflicting commit: actual(%d)", after.Aborts-before.Aborts)
+		}
+
+		if len(after.HotKeys) == 0 || !bytes.Equal(after.HotKeys[0].Key, []byte("contention:hot")) || after.HotKeys[0].Conflicts != 3 {
+			t.Errorf("expected the conflicting key to be the hottest key: actual(%v)", after.HotKeys)
+		}
+
+		if stats(serializableMariInst).Retries == 0 {
+			t.Error("expected retries of the conflicting transaction to be counted")
+		}
+	})
+
+	t.Run("Test Stats Output", func(t *testing.T) {
+		isoStats, statsErr := snapshotMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		sStats, marshalErr := json.Marshal(isoStats)
+		if marshalErr != nil {
+			t.Fatalf("error on stats marshal: %s", marshalErr.Error())
+		}
+
+		var decoded struct {
+			Version        uint64 `json:"version"`
+			SyncLatencyP99 string `json:"syncLatencyP99"`
+			Contention     struct {
+				HotKeys []struct {
+					Key       string `json:"key"`
+					Conflicts uint64 `json:"conflicts"`
+				} `json:"hotKeys"`
+			} `json:"contention"`
+		}
+
+		unmarshalErr := json.Unmarshal(sStats, &decoded)
+		if unmarshalErr != nil {
+			t.Fatalf("error on stats unmarshal: %s", unmarshalErr.Error())
+		}
+
+		if decoded.Version != isoStats.Version || decoded.SyncLatencyP99 != isoStats.SyncLatencyP99.String() {
+			t.Errorf("expected the stats in the json: actual(%s)", sStats)
+		}
+
+		if len(decoded.Contention.HotKeys) == 0 || decoded.Contention.HotKeys[0].Key != "contention:hot" || decoded.Contention.HotKeys[0].Conflicts != 3 {
+			t.Errorf("expected the hot keys as strings in the json: actual(%s)", sStats)
+		}
+
+		table := isoStats.String()
+		for _, expected := range []string{fmt.Sprintf("version %d", isoStats.Version), "contention hot key \"contention:hot\"", "write amplification ratio"} {
+			if !strings.Contains(strings.Join(strings.Fields(table), " "), expected) {
+				t.Errorf("expected %q in the stats table: actual(%s)", expected, table)
+			}
+		}
+	})
+
+	t.Run("Test Write Amplification Stats", func(t *testing.T) {
+		stats := func() mariv2.WriteAmplificationStats {
+			isoStats, statsErr := snapshotMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+
+			return isoStats.WriteAmplification
+		}
+
+		before := stats()
+		for idx := 0; idx < 10; idx++ {
+			put(t, snapshotMariInst, fmt.Sprintf("amplification:single:%d", idx), "value")
+		}
+
+		single := stats()
+		if single.Commits-before.Commits != 10 {
+			t.Errorf("expected a commit counted for each transaction: actual(%d)", single.Commits-before.Commits)
+		}
+
+		singlePayload := single.PayloadBytes - before.PayloadBytes
+		if singlePayload != 10*uint64(len("amplification:single:0")+len("value")) {
+			t.Errorf("expected the payload of the keys and values written: actual(%d)", singlePayload)
+		}
+
+		if single.WrittenBytes-before.WrittenBytes <= singlePayload {
+			t.Errorf("expected the path copies to be larger than the payload: actual(%d)", single.WrittenBytes-before.WrittenBytes)
+		}
+
+		putErr := snapshotMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for idx := 0; idx < 10; idx++ {
+				tx.Put([]byte(fmt.Sprintf("amplification:batch:%d", idx)), []byte("first"))
+				if putTxErr := tx.Put([]byte(fmt.Sprintf("amplification:batch:%d", idx)), []byte("value")); putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		batch := stats()
+		batchPayload := batch.PayloadBytes - single.PayloadBytes
+		if batch.Commits-single.Commits != 1 || batchPayload != 10*uint64(len("amplification:batch:0")+len("value")) {
+			t.Errorf("expected a single commit counting the last write to each key: actual(%d, %d)", batch.Commits-single.Commits, batchPayload)
+		}
+
+		singleRatio := float64(single.WrittenBytes-before.WrittenBytes) / float64(singlePayload)
+		batchRatio := float64(batch.WrittenBytes-single.WrittenBytes) / float64(batchPayload)
+		if batchRatio >= singleRatio {
+			t.Errorf("expected batching to lower write amplification: actual(%f, %f)", batchRatio, singleRatio)
+		}
+
+		if batch.Ratio != float64(batch.WrittenBytes)/float64(batch.PayloadBytes) {
+			t.Errorf("expected the ratio of bytes written to payload: actual(%f)", batch.Ratio)
+		}
+	})
+
+	t.Run("Test Serializable Disjoint Writes", func(t *testing.T) {
+		tx, beginErr := serializableMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		_, getErr := tx.Get([]byte("disjoint:read"), nil)
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+
+		putErr := tx.Put([]byte("disjoint:first"), []byte("first"))
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		put(t, serializableMariInst, "disjoint:second", "second")
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("expected writes disjoint from the read set to commit: %s", commitErr.Error())
+		}
+	})
+}
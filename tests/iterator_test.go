@@ -0,0 +1,286 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const ITERATOR_INPUT_SIZE = 1000
+
+var iterMariInst *mariv2.Mari
+var iterSortedKeys [][]byte
+var iterLogs *SyncBuffer
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testiterator"))
+
+	iterLogs = &SyncBuffer{}
+	logger := slog.New(slog.NewTextHandler(iterLogs, nil))
+	maxAge := 100 * time.Millisecond
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:       os.TempDir(),
+		FileName:       "testiterator",
+		NodePoolSize:   &nodePoolSize,
+		IteratorMaxAge: &maxAge,
+		Logger:         logger,
+	}
+
+	var openErr error
+	iterMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	keys := make(map[string]bool)
+	for len(keys) < ITERATOR_INPUT_SIZE {
+		key := make([]byte, 1+rand.IntN(8))
+		for idx := range key {
+			key[idx] = "abcd"[rand.IntN(4)]
+		}
+
+		keys[string(key)] = true
+	}
+
+	for key := range keys {
+		iterSortedKeys = append(iterSortedKeys, []byte(key))
+	}
+
+	putErr := iterMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for _, key := range iterSortedKeys {
+			putTxErr := tx.Put(key, key)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	sort.Slice(iterSortedKeys, func(i, j int) bool { return bytes.Compare(iterSortedKeys[i], iterSortedKeys[j]) == -1 })
+
+	fmt.Println("iterator test mari initialized")
+}
+
+func TestMariIterator(t *testing.T) {
+	defer iterMariInst.Remove()
+
+	collect := func(startKey []byte) [][]byte {
+		iter, iterErr := iterMariInst.NewIterator(startKey, nil)
+		if iterErr != nil {
+			t.Fatalf("error opening iterator: %s", iterErr.Error())
+		}
+		defer iter.Close()
+
+		var keys [][]byte
+		for iter.Next() {
+			keys = append(keys, iter.KeyValue().Key)
+		}
+
+		if iter.Err() != nil {
+			t.Fatalf("error on iterator: %s", iter.Err().Error())
+		}
+
+		return keys
+	}
+
+	t.Run("Test Iterate All", func(t *testing.T) {
+		keys := collect(nil)
+		if len(keys) != len(iterSortedKeys) {
+			t.Fatalf("iterated keys not equal to expected: actual(%d), expected(%d)", len(keys), len(iterSortedKeys))
+		}
+
+		for idx, key := range keys {
+			if !bytes.Equal(key, iterSortedKeys[idx]) {
+				t.Fatalf("iterated key not equal to expected at %d: actual(%s), expected(%s)", idx, key, iterSortedKeys[idx])
+			}
+		}
+	})
+
+	t.Run("Test Iterate From Start Key", func(t *testing.T) {
+		for _, startKey := range []string{"b", "bcd", "ccccccccc", "e"} {
+			expected := sort.Search(len(iterSortedKeys), func(i int) bool {
+				return bytes.Compare(iterSortedKeys[i], []byte(startKey)) >= 0
+			})
+
+			keys := collect([]byte(startKey))
+			if len(keys) != len(iterSortedKeys)-expected {
+				t.Fatalf("iterated keys from %q not equal to expected: actual(%d), expected(%d)", startKey, len(keys), len(iterSortedKeys)-expected)
+			}
+
+			if len(keys) > 0 && !bytes.Equal(keys[0], iterSortedKeys[expected]) {
+				t.Errorf("first key from %q not equal to expected: actual(%s), expected(%s)", startKey, keys[0], iterSortedKeys[expected])
+			}
+		}
+	})
+
+	t.Run("Test Pinned Snapshot", func(t *testing.T) {
+		first, iterErr := iterMariInst.NewIterator(nil, nil)
+		if iterErr != nil {
+			t.Fatalf("error opening iterator: %s", iterErr.Error())
+		}
+
+		second, iterErr := iterMariInst.NewIterator(nil, nil)
+		if iterErr != nil {
+			t.Fatalf("error opening iterator: %s", iterErr.Error())
+		}
+
+		if pinned := iterMariInst.PinnedVersions(); pinned[first.Version()] != 2 {
+			t.Errorf("expected version to be pinned twice: actual(%v)", pinned)
+		}
+
+		putErr := iterMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("aaaaaaaaaa"), []byte("new"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		var total int
+		for first.Next() {
+			total++
+		}
+
+		if total != len(iterSortedKeys) {
+			t.Errorf("iterator did not read from its pinned version: actual(%d), expected(%d)", total, len(iterSortedKeys))
+		}
+
+		first.Close()
+		second.Close()
+
+		if pinned := iterMariInst.PinnedVersions(); len(pinned) != 0 {
+			t.Errorf("expected no pinned versions after close: actual(%v)", pinned)
+		}
+
+		if closeErr := first.Close(); !errors.Is(closeErr, mariv2.ErrIteratorClosed) {
+			t.Errorf("expected error on second close: actual(%v)", closeErr)
+		}
+
+		if first.Next() {
+			t.Error("expected closed iterator not to advance")
+		}
+	})
+
+	t.Run("Test Snapshot Consistent Scans", func(t *testing.T) {
+		tx, beginErr := iterMariInst.Begin(true)
+		if beginErr != nil {
+			t.Fatalf("error beginning transaction: %s", beginErr.Error())
+		}
+
+		snapshotVersion := tx.SnapshotVersion()
+		before, rangeErr := tx.Range(nil, nil, nil)
+		if rangeErr != nil {
+			t.Fatalf("error on mari range: %s", rangeErr.Error())
+		}
+
+		putErr := iterMariInst.UpdateTx(func(updateTx *mariv2.Tx) error {
+			putTxErr := updateTx.Put([]byte("aaaaaaaaab"), []byte("new"))
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			return updateTx.Put(iterSortedKeys[0], []byte("updated"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		after, rangeErr := tx.Range(nil, nil, nil)
+		if rangeErr != nil {
+			t.Fatalf("error on mari range: %s", rangeErr.Error())
+		}
+
+		iterated, iterErr := tx.Iterate(nil, len(before)+1, nil)
+		if iterErr != nil {
+			t.Fatalf("error on mari iterate: %s", iterErr.Error())
+		}
+
+		for _, kvPairs := range [][]*mariv2.KeyValuePair{after, iterated} {
+			if len(kvPairs) != len(before) {
+				t.Fatalf("scan observed keys committed after the snapshot: actual(%d), expected(%d)", len(kvPairs), len(before))
+			}
+
+			for idx, kvPair := range kvPairs {
+				if kvPair.Version > snapshotVersion {
+					t.Fatalf("scan observed version %d newer than the snapshot %d", kvPair.Version, snapshotVersion)
+				}
+
+				if !bytes.Equal(kvPair.Key, before[idx].Key) || !bytes.Equal(kvPair.Value, before[idx].Value) {
+					t.Fatalf("scan not equal to the scan at the start of the transaction at %d: actual(%s), expected(%s)", idx, kvPair.Key, before[idx].Key)
+				}
+			}
+		}
+
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			t.Fatalf("error committing transaction: %s", commitErr.Error())
+		}
+
+		readErr := iterMariInst.ReadTx(func(readTx *mariv2.Tx) error {
+			if readTx.SnapshotVersion() <= snapshotVersion {
+				return fmt.Errorf("expected a newer snapshot: actual(%d), previous(%d)", readTx.SnapshotVersion(), snapshotVersion)
+			}
+
+			kvPairs, rangeErr := readTx.Range(nil, nil, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != len(before)+1 {
+				return fmt.Errorf("expected the new key in a later snapshot: actual(%d), expected(%d)", len(kvPairs), len(before)+1)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Leak Detection", func(t *testing.T) {
+		iter, iterErr := iterMariInst.NewIterator(nil, nil)
+		if iterErr != nil {
+			t.Fatalf("error opening iterator: %s", iterErr.Error())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(iterLogs.String(), "iterator open past max age") {
+			if time.Now().After(deadline) {
+				t.Fatal("expected warning for iterator open past max age")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if !strings.Contains(iterLogs.String(), "TestMariIterator") {
+			t.Error("expected warning to include the stack that opened the iterator")
+		}
+
+		iterMariInst.Close()
+		if !strings.Contains(iterLogs.String(), "iterator not closed before the instance was closed") {
+			t.Error("expected warning for iterator left open on close")
+		}
+
+		if closeErr := iter.Close(); !errors.Is(closeErr, mariv2.ErrIteratorClosed) {
+			t.Errorf("expected iterator to be released on instance close: actual(%v)", closeErr)
+		}
+	})
+}
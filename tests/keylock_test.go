@@ -0,0 +1,151 @@
+package maritests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var keyLockMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testkeylock"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testkeylock", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	keyLockMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("key lock test mari initialized")
+}
+
+func TestMariKeyLock(t *testing.T) {
+	defer keyLockMariInst.Remove()
+
+	key := []byte("locked")
+
+	t.Run("Test Lock Wait", func(t *testing.T) {
+		keyLock, lockErr := keyLockMariInst.LockKey(context.Background(), key)
+		if lockErr != nil {
+			t.Fatalf("error locking key: %s", lockErr.Error())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, lockErr = keyLockMariInst.LockKey(ctx, key)
+		if !errors.Is(lockErr, context.DeadlineExceeded) {
+			t.Fatalf("expected the second lock to wait until the deadline: actual(%v)", lockErr)
+		}
+
+		acquired := make(chan *mariv2.KeyLock)
+		go func() {
+			next, _ := keyLockMariInst.LockKey(context.Background(), key)
+			acquired <- next
+		}()
+
+		unlockErr := keyLock.Unlock()
+		if unlockErr != nil {
+			t.Fatalf("error unlocking key: %s", unlockErr.Error())
+		}
+
+		next := <-acquired
+		if next == nil || !bytes.Equal(next.Key(), key) {
+			t.Fatal("expected the waiting lock to be acquired on release")
+		}
+
+		next.Unlock()
+	})
+
+	t.Run("Test Holder Priority", func(t *testing.T) {
+		keyLock, lockErr := keyLockMariInst.LockKey(context.Background(), key)
+		if lockErr != nil {
+			t.Fatalf("error locking key: %s", lockErr.Error())
+		}
+
+		committed := make(chan error, 1)
+		go func() {
+			committed <- keyLockMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				return tx.Put(key, []byte("waiter"))
+			})
+		}()
+
+		select {
+		case <-committed:
+			t.Fatal("expected the transaction to wait for the key lock")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		putErr := keyLock.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(key, []byte("holder"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put through the lock: %s", putErr.Error())
+		}
+
+		tx, beginErr := keyLockMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		tx.Put(key, []byte("manual"))
+		commitErr := tx.Commit()
+		if !errors.Is(commitErr, mariv2.ErrKeyLockHeld) {
+			t.Errorf("expected commit of a locked key to fail: actual(%v)", commitErr)
+		}
+
+		keyLock.Unlock()
+
+		commitErr = <-committed
+		if commitErr != nil {
+			t.Fatalf("error on mari put after unlock: %s", commitErr.Error())
+		}
+
+		getErr := keyLockMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getTxErr := tx.Get(key, nil)
+			if getTxErr != nil {
+				return getTxErr
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, []byte("waiter")) {
+				return fmt.Errorf("expected the waiting transaction to commit after the holder: actual(%v)", kvPair)
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+	})
+
+	t.Run("Test Released Lock", func(t *testing.T) {
+		keyLock, lockErr := keyLockMariInst.LockKey(context.Background(), key)
+		if lockErr != nil {
+			t.Fatalf("error locking key: %s", lockErr.Error())
+		}
+
+		keyLock.Unlock()
+
+		if unlockErr := keyLock.Unlock(); !errors.Is(unlockErr, mariv2.ErrKeyLockReleased) {
+			t.Errorf("expected error on second unlock: actual(%v)", unlockErr)
+		}
+
+		updateErr := keyLock.UpdateTx(func(tx *mariv2.Tx) error { return tx.Put(key, []byte("released")) })
+		if !errors.Is(updateErr, mariv2.ErrKeyLockReleased) {
+			t.Errorf("expected error on update through a released lock: actual(%v)", updateErr)
+		}
+	})
+}
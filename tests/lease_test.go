@@ -0,0 +1,237 @@
+package maritests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+	"github.com/sirgallo/mariv2/lease"
+)
+
+var leaseMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testlease"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testlease", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	leaseMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("lease test mari initialized")
+}
+
+func TestMariLease(t *testing.T) {
+	defer leaseMariInst.Remove()
+
+	t.Run("Test Acquire And Release", func(t *testing.T) {
+		first, acquireErr := lease.Acquire(leaseMariInst, "leader", "a", time.Minute)
+		if acquireErr != nil {
+			t.Fatalf("error acquiring lease: %s", acquireErr.Error())
+		}
+
+		_, heldErr := lease.Acquire(leaseMariInst, "leader", "b", time.Minute)
+		if !errors.Is(heldErr, lease.ErrHeld) {
+			t.Fatalf("expected ErrHeld: actual(%v)", heldErr)
+		}
+
+		again, acquireErr := lease.Acquire(leaseMariInst, "leader", "a", time.Minute)
+		if acquireErr != nil || again.Token != first.Token {
+			t.Fatalf("expected the holder to keep its token: actual(%v, %v)", again, acquireErr)
+		}
+
+		current, currentErr := lease.Current(leaseMariInst, "leader")
+		if currentErr != nil || current == nil || current.Holder != "a" || current.Token != first.Token {
+			t.Fatalf("expected the current lease: actual(%v, %v)", current, currentErr)
+		}
+
+		releaseErr := first.Release()
+		if releaseErr != nil {
+			t.Fatalf("error releasing lease: %s", releaseErr.Error())
+		}
+
+		current, currentErr = lease.Current(leaseMariInst, "leader")
+		if currentErr != nil || current != nil {
+			t.Fatalf("expected the name to be free: actual(%v, %v)", current, currentErr)
+		}
+
+		second, acquireErr := lease.Acquire(leaseMariInst, "leader", "b", time.Minute)
+		if acquireErr != nil {
+			t.Fatalf("error acquiring released lease: %s", acquireErr.Error())
+		}
+
+		if second.Token <= first.Token {
+			t.Fatalf("expected a greater token: first(%d), second(%d)", first.Token, second.Token)
+		}
+
+		lostErr := first.Release()
+		if !errors.Is(lostErr, lease.ErrLost) {
+			t.Fatalf("expected ErrLost releasing a lost lease: actual(%v)", lostErr)
+		}
+
+		_, ttlErr := lease.Acquire(leaseMariInst, "other", "a", 0)
+		if !errors.Is(ttlErr, lease.ErrInvalidTTL) {
+			t.Fatalf("expected ErrInvalidTTL: actual(%v)", ttlErr)
+		}
+	})
+
+	t.Run("Test Expire And Renew", func(t *testing.T) {
+		expiring, acquireErr := lease.Acquire(leaseMariInst, "expiring", "a", 50*time.Millisecond)
+		if acquireErr != nil {
+			t.Fatalf("error acquiring lease: %s", acquireErr.Error())
+		}
+
+		renewErr := expiring.Renew(time.Minute)
+		if renewErr != nil {
+			t.Fatalf("error renewing lease: %s", renewErr.Error())
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		_, heldErr := lease.Acquire(leaseMariInst, "expiring", "b", time.Minute)
+		if !errors.Is(heldErr, lease.ErrHeld) {
+			t.Fatalf("expected the renewed lease to be held: actual(%v)", heldErr)
+		}
+
+		renewErr = expiring.Renew(50 * time.Millisecond)
+		if renewErr != nil {
+			t.Fatalf("error renewing lease: %s", renewErr.Error())
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		taken, acquireErr := lease.Acquire(leaseMariInst, "expiring", "b", time.Minute)
+		if acquireErr != nil {
+			t.Fatalf("error acquiring expired lease: %s", acquireErr.Error())
+		}
+
+		if taken.Token <= expiring.Token {
+			t.Fatalf("expected a greater token: expired(%d), taken(%d)", expiring.Token, taken.Token)
+		}
+
+		renewErr = expiring.Renew(time.Minute)
+		if !errors.Is(renewErr, lease.ErrLost) {
+			t.Fatalf("expected ErrLost renewing an expired lease: actual(%v)", renewErr)
+		}
+	})
+
+	t.Run("Test Fenced Writes", func(t *testing.T) {
+		holder, acquireErr := lease.Acquire(leaseMariInst, "fenced", "a", time.Minute)
+		if acquireErr != nil {
+			t.Fatalf("error acquiring lease: %s", acquireErr.Error())
+		}
+
+		fencedPut := func(fenced *lease.Lease, value string) error {
+			return leaseMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				fenceErr := fenced.Fence(tx)
+				if fenceErr != nil {
+					return fenceErr
+				}
+
+				return tx.Put([]byte("fenced:value"), []byte(value))
+			})
+		}
+
+		putErr := fencedPut(holder, "a")
+		if putErr != nil {
+			t.Fatalf("error on fenced put: %s", putErr.Error())
+		}
+
+		releaseErr := holder.Release()
+		if releaseErr != nil {
+			t.Fatalf("error releasing lease: %s", releaseErr.Error())
+		}
+
+		putErr = fencedPut(holder, "stale")
+		if !errors.Is(putErr, lease.ErrLost) {
+			t.Fatalf("expected ErrLost for a fenced put after release: actual(%v)", putErr)
+		}
+
+		readErr := leaseMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("fenced:value"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if string(kvPair.Value) != "a" {
+				return fmt.Errorf("expected the fenced write to be rejected: actual(%s)", kvPair.Value)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatal(readErr.Error())
+		}
+	})
+
+	t.Run("Test Concurrent Lock", func(t *testing.T) {
+		var holdersLock sync.Mutex
+		var wg sync.WaitGroup
+		holding := 0
+		tokens := make(map[uint64]bool)
+
+		for idx := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				locked, lockErr := lease.Lock(ctx, leaseMariInst, "mutex", fmt.Sprintf("worker-%d", idx), time.Minute)
+				if lockErr != nil {
+					t.Errorf("error locking: %s", lockErr.Error())
+					return
+				}
+
+				holdersLock.Lock()
+				holding++
+				if holding > 1 || tokens[locked.Token] {
+					t.Errorf("expected an exclusive lock with a unique token: holding(%d), token(%d)", holding, locked.Token)
+				}
+
+				tokens[locked.Token] = true
+				holdersLock.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				holdersLock.Lock()
+				holding--
+				holdersLock.Unlock()
+
+				releaseErr := locked.Release()
+				if releaseErr != nil {
+					t.Errorf("error releasing lock: %s", releaseErr.Error())
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		blocker, acquireErr := lease.Acquire(leaseMariInst, "mutex", "blocker", time.Minute)
+		if acquireErr != nil {
+			t.Fatalf("error acquiring lease: %s", acquireErr.Error())
+		}
+
+		defer blocker.Release()
+
+		_, lockErr := lease.Lock(ctx, leaseMariInst, "mutex", "waiter", time.Minute)
+		if !errors.Is(lockErr, context.DeadlineExceeded) {
+			t.Fatalf("expected the lock to wait until the deadline: actual(%v)", lockErr)
+		}
+	})
+}
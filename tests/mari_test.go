@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/sirgallo/mariv2"
@@ -265,14 +266,15 @@ func TestMari(t *testing.T) {
 			t.Errorf("error on mari range: %s", rangeErr.Error())
 		}
 
-		t.Log("keys in kv pairs", func() []string {
+		keys := func() []string {
 			var keys []string
 			for _, kv := range kvPairs {
 				keys = append(keys, string(kv.Key))
 			}
 
 			return keys
-		}())
+		}()
+		t.Log("keys in kv pairs", keys)
 
 		isSorted := IsSorted(kvPairs)
 		t.Logf("is sorted: %t", isSorted)
@@ -280,6 +282,25 @@ func TestMari(t *testing.T) {
 		if !isSorted {
 			t.Errorf("key value pairs are not in sorted order: %t", isSorted)
 		}
+
+		expKeys := []string{"hello", "key", "new", "sup", "woah"}
+		if fmt.Sprint(keys) != fmt.Sprint(expKeys) {
+			t.Errorf("range keys do not match expected keys: actual(%v), expected(%v)", keys, expKeys)
+		}
+
+		rangeErr = mariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var txRangeErr error
+			kvPairs, txRangeErr = tx.Range(nil, nil, nil)
+			return txRangeErr
+		})
+
+		if rangeErr != nil {
+			t.Errorf("error on mari range: %s", rangeErr.Error())
+		}
+
+		if len(kvPairs) != 16 || !IsSorted(kvPairs) {
+			t.Errorf("expected all 16 keys in sorted order: actual(%d)", len(kvPairs))
+		}
 	})
 
 	t.Run("Test Transform on Iterate Operation", func(t *testing.T) {
@@ -328,6 +349,60 @@ func TestMari(t *testing.T) {
 		}
 	})
 
+	t.Run("Test Range Of Long Keys", func(t *testing.T) {
+		var expected []string
+		putErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, suffix := range []string{"", "a", "ab", "abcdefgh", "abcdefghi", "abcdefgz", "b", "zzzzzzzzzzzzzzzz"} {
+				for _, prefix := range []string{"long:shared-prefix:", "long:shared-prefiy:"} {
+					key := prefix + suffix
+					putTxErr := tx.Put([]byte(key), []byte(suffix))
+					if putTxErr != nil {
+						return putTxErr
+					}
+
+					if key >= "long:shared-prefix:abcdefgh" && key < "long:shared-prefiy:ab" {
+						expected = append(expected, key)
+					}
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		sort.Strings(expected)
+
+		var rangeKvPairs, iterKvPairs []*mariv2.KeyValuePair
+		rangeErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var txErr error
+			rangeKvPairs, txErr = tx.Range([]byte("long:shared-prefix:abcdefgh"), []byte("long:shared-prefiy:ab"), nil)
+			if txErr != nil {
+				return txErr
+			}
+
+			iterKvPairs, txErr = tx.Iterate([]byte("long:shared-prefix:abcdefgh"), len(expected), nil)
+			return txErr
+		})
+
+		if rangeErr != nil {
+			t.Fatalf("error on mari range: %s", rangeErr.Error())
+		}
+
+		for _, kvPairs := range [][]*mariv2.KeyValuePair{rangeKvPairs, iterKvPairs} {
+			var keys []string
+			for _, kvPair := range kvPairs {
+				keys = append(keys, string(kvPair.Key))
+			}
+
+			if fmt.Sprint(keys) != fmt.Sprint(expected) {
+				t.Errorf("keys do not match expected keys: actual(%v), expected(%v)", keys, expected)
+			}
+		}
+	})
+
 	t.Run("Test Mari Delete", func(t *testing.T) {
 		delErr = mariInst.UpdateTx(func(tx *mariv2.Tx) error {
 			delTxErr := tx.Delete([]byte("hello"))
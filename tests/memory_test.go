@@ -0,0 +1,164 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const MEMORY_INPUT_SIZE = 200
+
+var memoryMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testmemory"))
+
+	disableNodePool := true
+	valueCacheSize := MEMORY_INPUT_SIZE
+	softMemoryLimit := int64(16 * 1024)
+	shedScansOver := 10
+
+	var openErr error
+	memoryMariInst, openErr = mariv2.Open(mariv2.InitOpts{
+		Filepath:        os.TempDir(),
+		FileName:        "testmemory",
+		DisableNodePool: &disableNodePool,
+		ValueCacheSize:  &valueCacheSize,
+		SoftMemoryLimit: &softMemoryLimit,
+		ShedScansOver:   &shedScansOver,
+	})
+
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := memoryMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range MEMORY_INPUT_SIZE {
+			putTxErr := tx.Put([]byte(fmt.Sprintf("memory:%03d", idx)), bytes.Repeat([]byte{byte(idx)}, 100))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("memory test mari initialized")
+}
+
+func TestMariSoftMemoryLimit(t *testing.T) {
+	defer memoryMariInst.Remove()
+
+	t.Run("Test Shrink Caches", func(t *testing.T) {
+		readErr := memoryMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for idx := range MEMORY_INPUT_SIZE {
+				kvPair, getErr := tx.Get([]byte(fmt.Sprintf("memory:%03d", idx)), nil)
+				if getErr != nil {
+					return getErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Value, bytes.Repeat([]byte{byte(idx)}, 100)) {
+					return fmt.Errorf("expected the value of key %d to be read", idx)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		stats, statsErr := memoryMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.Memory.Shrinks == 0 || stats.ValueCache.Evictions == 0 {
+			t.Errorf("expected the value cache to be shrunk: actual(%+v)", stats.Memory)
+		}
+
+		if stats.Memory.Usage > stats.Memory.Limit || stats.Memory.Pressured {
+			t.Errorf("expected the value cache to be shrunk under the limit: actual(%+v)", stats.Memory)
+		}
+
+		if stats.ValueCache.Entries == 0 || stats.ValueCache.Entries == MEMORY_INPUT_SIZE {
+			t.Errorf("expected the value cache to keep the most recent reads: actual(%d)", stats.ValueCache.Entries)
+		}
+	})
+
+	t.Run("Test Shed Large Scans", func(t *testing.T) {
+		putErr := memoryMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for idx := range 10 * MEMORY_INPUT_SIZE {
+				putTxErr := tx.Put([]byte(fmt.Sprintf("shed:%05d", idx)), []byte(fmt.Sprintf("value %d", idx)))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		readErr := memoryMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			chunkSize := 16
+			trace, rangeErr := tx.Explain(func(tx *mariv2.Tx) error {
+				_, rangeErr := tx.Range(nil, nil, &mariv2.RangeOpts{ChunkSize: &chunkSize})
+				return rangeErr
+			})
+
+			if !errors.Is(rangeErr, mariv2.ErrMemoryPressure) {
+				return fmt.Errorf("expected a range over the limit to be rejected: actual(%v)", rangeErr)
+			}
+
+			if trace.NodesVisited >= 10*MEMORY_INPUT_SIZE {
+				return fmt.Errorf("expected the range to stop before visiting every key: actual(%d)", trace.NodesVisited)
+			}
+
+			kvPairs, rangeErr := tx.Range([]byte("memory:000"), []byte("memory:005"), nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 5 {
+				return fmt.Errorf("expected a small range to be served: actual(%d)", len(kvPairs))
+			}
+
+			kvPairs, iterErr := tx.Iterate(nil, 50, nil)
+			if iterErr != nil {
+				return iterErr
+			}
+
+			if len(kvPairs) != 50 {
+				return fmt.Errorf("expected an iteration under the limit to be served once the range is released: actual(%d)", len(kvPairs))
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatal(readErr.Error())
+		}
+
+		stats, statsErr := memoryMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.Memory.ShedScans != 1 || stats.Memory.Pressured {
+			t.Errorf("expected one scan to be rejected: actual(%+v)", stats.Memory)
+		}
+	})
+}
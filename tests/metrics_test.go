@@ -0,0 +1,139 @@
+package maritests
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var metricsMariInst *mariv2.Mari
+var metricsListener net.PacketConn
+var metricsSink *mariv2.StatsDSink
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testmetrics"))
+
+	var listenErr error
+	metricsListener, listenErr = net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		panic(listenErr.Error())
+	}
+
+	metricsSink, listenErr = mariv2.NewStatsDSink(metricsListener.LocalAddr().String(), "mari", []string{"env:test"})
+	if listenErr != nil {
+		panic(listenErr.Error())
+	}
+
+	nodePoolSize := int64(1000)
+	metricsInterval := 10 * time.Millisecond
+	opts := mariv2.InitOpts{
+		Filepath:        os.TempDir(),
+		FileName:        "testmetrics",
+		NodePoolSize:    &nodePoolSize,
+		MetricsSink:     metricsSink,
+		MetricsInterval: &metricsInterval,
+	}
+
+	var openErr error
+	metricsMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("metrics test mari initialized")
+}
+
+// metricsPusher is a sink that sends every push to a channel
+type metricsPusher struct {
+	pushes chan *mariv2.Stats
+}
+
+func (pusher *metricsPusher) Push(instance string, stats *mariv2.Stats) error {
+	if instance != "testmetricspusher" {
+		return fmt.Errorf("unexpected instance %s", instance)
+	}
+
+	select {
+	case pusher.pushes <- stats:
+	default:
+	}
+
+	return nil
+}
+
+func TestMariMetrics(t *testing.T) {
+	defer metricsListener.Close()
+	defer metricsSink.Close()
+	defer metricsMariInst.Remove()
+
+	t.Run("Test StatsD Sink", func(t *testing.T) {
+		putErr := metricsMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("metrics"), []byte("value"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		lines := make(map[string]string)
+		buf := make([]byte, mariv2.StatsDMaxPacketSize)
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			metricsListener.SetReadDeadline(deadline)
+			n, _, readErr := metricsListener.ReadFrom(buf)
+			if readErr != nil {
+				t.Fatalf("error reading metrics: %s", readErr.Error())
+			}
+
+			if n > mariv2.StatsDMaxPacketSize {
+				t.Fatalf("expected packets of at most %d bytes, got %d", mariv2.StatsDMaxPacketSize, n)
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(string(buf[:n])), "\n") {
+				name, _, _ := strings.Cut(line, ":")
+				lines[name] = line
+			}
+
+			if _, ok := lines["mari.write_amplification.commits"]; ok {
+				break
+			}
+		}
+
+		if lines["mari.write_amplification.commits"] != "mari.write_amplification.commits:1|c|#env:test,instance:testmetrics" {
+			t.Errorf("expected a counter for the commit, got: %q", lines["mari.write_amplification.commits"])
+		}
+
+		if !strings.HasPrefix(lines["mari.version"], "mari.version:1|g|#env:test,instance:testmetrics") {
+			t.Errorf("expected a gauge for the version, got: %q", lines["mari.version"])
+		}
+	})
+
+	t.Run("Test Custom Sink", func(t *testing.T) {
+		os.Remove(filepath.Join(os.TempDir(), "testmetricspusher"))
+
+		pusher := &metricsPusher{pushes: make(chan *mariv2.Stats, 1)}
+		metricsInterval := 10 * time.Millisecond
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testmetricspusher", MetricsSink: pusher, MetricsInterval: &metricsInterval}
+
+		pusherMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer pusherMariInst.Remove()
+
+		select {
+		case stats := <-pusher.pushes:
+			if stats.FileSize == 0 {
+				t.Errorf("expected stats of the instance, got: %+v", stats)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected stats to be pushed to the sink")
+		}
+	})
+}
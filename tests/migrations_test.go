@@ -0,0 +1,168 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+	"github.com/sirgallo/mariv2/migrations"
+)
+
+var migrationsMariInst *mariv2.Mari
+var migrationsOpts mariv2.InitOpts
+
+// migration creates a migration that puts a key, counting how many times it is applied
+func migration(id uint64, key string, applied map[uint64]int) *migrations.Migration {
+	return &migrations.Migration{
+		ID:   id,
+		Name: fmt.Sprintf("put %s", key),
+		Up: func(tx *mariv2.Tx) error {
+			applied[id]++
+			return tx.Put([]byte(key), []byte(fmt.Sprintf("%d", id)))
+		},
+	}
+}
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testmigrations"))
+
+	nodePoolSize := int64(1000)
+	migrationsOpts = mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testmigrations", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	migrationsMariInst, openErr = migrations.Open(migrationsOpts, []*migrations.Migration{migration(2, "second", map[uint64]int{}), migration(1, "first", map[uint64]int{})})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("migrations test mari initialized")
+}
+
+func TestMariMigrations(t *testing.T) {
+	defer func() { migrationsMariInst.Remove() }()
+
+	appliedIDs := func(t *testing.T) []uint64 {
+		applied, appliedErr := migrations.Applied(migrationsMariInst)
+		if appliedErr != nil {
+			t.Fatalf("error on applied migrations: %s", appliedErr.Error())
+		}
+
+		var ids []uint64
+		for _, appliedMigration := range applied {
+			ids = append(ids, appliedMigration.ID)
+		}
+
+		return ids
+	}
+
+	t.Run("Test Apply On Open", func(t *testing.T) {
+		if ids := appliedIDs(t); !slices.Equal(ids, []uint64{1, 2}) {
+			t.Fatalf("expected the migrations to be applied on open: actual(%v)", ids)
+		}
+
+		readErr := migrationsMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range(nil, nil, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 2 {
+				return fmt.Errorf("expected only the keys put by the migrations: actual(%d)", len(kvPairs))
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+	})
+
+	t.Run("Test Apply Pending", func(t *testing.T) {
+		applied := map[uint64]int{}
+		ran, runErr := migrations.Run(migrationsMariInst, []*migrations.Migration{migration(1, "first", applied), migration(2, "second", applied), migration(3, "third", applied)})
+		if runErr != nil {
+			t.Fatalf("error on run migrations: %s", runErr.Error())
+		}
+
+		if !slices.Equal(ran, []uint64{3}) || applied[1] != 0 || applied[2] != 0 || applied[3] != 1 {
+			t.Errorf("expected only the pending migration to be applied: actual(%v, %v)", ran, applied)
+		}
+	})
+
+	t.Run("Test Invalid Migrations", func(t *testing.T) {
+		applied := map[uint64]int{}
+		_, runErr := migrations.Run(migrationsMariInst, []*migrations.Migration{migration(5, "fifth", applied)})
+		if runErr != nil {
+			t.Fatalf("error on run migrations: %s", runErr.Error())
+		}
+
+		invalid := map[error][]*migrations.Migration{
+			migrations.ErrInvalidID:   {migration(0, "zero", applied)},
+			migrations.ErrDuplicateID: {migration(6, "sixth", applied), migration(6, "sixth", applied)},
+			migrations.ErrNilUp:       {{ID: 6, Name: "nil"}},
+			migrations.ErrOutOfOrder:  {migration(4, "fourth", applied), migration(6, "sixth", applied)},
+		}
+
+		for expectedErr, invalidMigrations := range invalid {
+			_, runErr := migrations.Run(migrationsMariInst, invalidMigrations)
+			if !errors.Is(runErr, expectedErr) {
+				t.Errorf("expected %v on run of invalid migrations: actual(%v)", expectedErr, runErr)
+			}
+		}
+
+		if applied[4] != 0 || applied[6] != 0 {
+			t.Errorf("expected no migrations to be applied when validation fails: actual(%v)", applied)
+		}
+	})
+
+	t.Run("Test Failed Migration", func(t *testing.T) {
+		closeErr := migrationsMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error on mari close: %s", closeErr.Error())
+		}
+
+		applied := map[uint64]int{}
+		failed := errors.New("failed")
+		failing := []*migrations.Migration{
+			migration(6, "sixth", applied),
+			{ID: 7, Name: "failing", Up: func(tx *mariv2.Tx) error {
+				tx.Put([]byte("failing"), []byte("7"))
+				return failed
+			}},
+		}
+
+		_, openErr := migrations.Open(migrationsOpts, failing)
+
+		var migrationErr *migrations.MigrationError
+		if !errors.As(openErr, &migrationErr) || migrationErr.ID != 7 || !errors.Is(openErr, failed) {
+			t.Fatalf("expected migration error on open: actual(%v)", openErr)
+		}
+
+		migrationsMariInst, openErr = mariv2.Open(migrationsOpts)
+		if openErr != nil {
+			t.Fatalf("error on mari open: %s", openErr.Error())
+		}
+
+		if ids := appliedIDs(t); !slices.Equal(ids, []uint64{1, 2, 3, 5, 6}) {
+			t.Errorf("expected the migrations before the failed migration to stay applied: actual(%v)", ids)
+		}
+
+		readErr := migrationsMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("failing"), nil)
+			if getErr != nil || kvPair != nil {
+				return fmt.Errorf("expected the writes of the failed migration to be discarded: %v, %v", getErr, kvPair)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var normalizeMariInst *mariv2.Mari
+
+// reverseNormalizer is a key normalizer defined outside of mari, used to check that files are not opened with a different normalizer
+type reverseNormalizer struct{}
+
+func (reverseNormalizer) ID() uint64 { return mariv2.KeyNormalizerCustomID }
+
+func (reverseNormalizer) Normalize(key []byte) []byte {
+	normalized := bytes.Clone(key)
+	for idx, jdx := 0, len(normalized)-1; idx < jdx; idx, jdx = idx+1, jdx-1 {
+		normalized[idx], normalized[jdx] = normalized[jdx], normalized[idx]
+	}
+
+	return normalized
+}
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testnormalize"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testnormalize", NodePoolSize: &nodePoolSize, KeyNormalizer: mariv2.LowerASCIINormalizer{}}
+
+	var openErr error
+	normalizeMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("normalize test mari initialized")
+}
+
+func TestMariKeyNormalizer(t *testing.T) {
+	defer func() { normalizeMariInst.Remove() }()
+
+	t.Run("Test Lower ASCII", func(t *testing.T) {
+		putErr := normalizeMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			putTxErr := tx.Put([]byte("Hello"), []byte("first"))
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			putTxErr = tx.Put([]byte("HELLO"), []byte("second"))
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			return tx.Put([]byte("Caf\xc3\x89"), []byte("unicode"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		readErr := normalizeMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, key := range []string{"hello", "hElLo", "HELLO"} {
+				kvPair, getErr := tx.Get([]byte(key), nil)
+				if getErr != nil {
+					return getErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Key, []byte("hello")) || !bytes.Equal(kvPair.Value, []byte("second")) {
+					return fmt.Errorf("expected key %s to normalize to the same key: actual(%v)", key, kvPair)
+				}
+			}
+
+			kvPairs, rangeErr := tx.Range([]byte("A"), []byte("Z"), nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 2 || !bytes.Equal(kvPairs[0].Key, []byte("caf\xc3\x89")) || !bytes.Equal(kvPairs[1].Key, []byte("hello")) {
+				return fmt.Errorf("expected the range to be normalized, leaving bytes outside of ASCII as is: actual(%v)", kvPairs)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+
+		deleteErr := normalizeMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Delete([]byte("HeLLo"))
+		})
+
+		if deleteErr != nil {
+			t.Fatalf("error on mari delete: %s", deleteErr.Error())
+		}
+
+		readErr = normalizeMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("hello"), nil)
+			if getErr != nil || kvPair != nil {
+				return fmt.Errorf("expected the normalized key to be deleted: %v, %v", getErr, kvPair)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+	})
+
+	t.Run("Test Reject Mismatched Normalizer", func(t *testing.T) {
+		closeErr := normalizeMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error on mari close: %s", closeErr.Error())
+		}
+
+		nodePoolSize := int64(1000)
+		for _, keyNormalizer := range []mariv2.KeyNormalizer{nil, reverseNormalizer{}} {
+			_, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testnormalize", NodePoolSize: &nodePoolSize, KeyNormalizer: keyNormalizer})
+			if !errors.Is(openErr, mariv2.ErrKeyNormalizerMismatch) {
+				t.Errorf("expected error on open with a different key normalizer: actual(%v)", openErr)
+			}
+		}
+
+		var openErr error
+		normalizeMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testnormalize", NodePoolSize: &nodePoolSize, KeyNormalizer: mariv2.LowerASCIINormalizer{}})
+		if openErr != nil {
+			t.Fatalf("error on mari open with the same key normalizer: %s", openErr.Error())
+		}
+
+		readErr := normalizeMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("CAF\xc3\x89"), nil)
+			if getErr != nil || kvPair == nil || !bytes.Equal(kvPair.Value, []byte("unicode")) {
+				return fmt.Errorf("expected the normalized key after reopen: %v, %v", getErr, kvPair)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var notifyMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testnotify"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testnotify", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	notifyMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("notify test mari initialized")
+}
+
+func TestMariNotify(t *testing.T) {
+	defer notifyMariInst.Remove()
+
+	put := func(key string) {
+		putErr := notifyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte(key), []byte(key))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+	}
+
+	receive := func(versionChan <-chan uint64) (uint64, bool) {
+		select {
+		case version, ok := <-versionChan:
+			return version, ok
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for version")
+			return 0, false
+		}
+	}
+
+	versionChan, cancel := notifyMariInst.VersionChan()
+
+	t.Run("Test Version On Commit", func(t *testing.T) {
+		put("hello")
+
+		version, ok := receive(versionChan)
+		if !ok || version != 1 {
+			t.Errorf("unexpected version after commit: actual(%d), open(%t)", version, ok)
+		}
+	})
+
+	t.Run("Test Slow Subscriber Receives Latest", func(t *testing.T) {
+		for idx := range 10 {
+			put(fmt.Sprintf("key%d", idx))
+		}
+
+		version, _ := receive(versionChan)
+		if version != 11 {
+			t.Errorf("expected latest version: actual(%d), expected(%d)", version, 11)
+		}
+
+		select {
+		case version := <-versionChan:
+			t.Errorf("expected no pending version: actual(%d)", version)
+		default:
+		}
+	})
+
+	t.Run("Test Read At Least", func(t *testing.T) {
+		var committed *mariv2.Tx
+		putErr := notifyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			committed = tx
+			return tx.Put([]byte("token"), []byte("first"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		if version := committed.CommitVersion(); version != 12 {
+			t.Fatalf("unexpected commit version: actual(%d), expected(%d)", version, 12)
+		}
+
+		token := committed.CommitTimestamp()
+		if token == 0 {
+			t.Fatal("expected a commit timestamp once committed")
+		}
+
+		readValue := func(timestamp uint64) (string, error) {
+			var value string
+			readErr := notifyMariInst.ReadTxAtLeast(timestamp, func(tx *mariv2.Tx) error {
+				kvPair, getErr := tx.Get([]byte("token"), nil)
+				if getErr != nil {
+					return getErr
+				}
+
+				value = string(kvPair.Value)
+				return nil
+			})
+
+			return value, readErr
+		}
+
+		value, readErr := readValue(token)
+		if readErr != nil || value != "first" {
+			t.Fatalf("expected the committed value: actual(%s, %v)", value, readErr)
+		}
+
+		type result struct {
+			value string
+			err   error
+		}
+
+		results := make(chan result, 1)
+		go func() {
+			value, readErr := readValue(token + 1)
+			results <- result{value, readErr}
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+
+		putErr = notifyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("token"), []byte("second"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		select {
+		case waited := <-results:
+			if waited.err != nil || waited.value != "second" {
+				t.Fatalf("expected the read to wait for the next commit: actual(%s, %v)", waited.value, waited.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the read at least the next commit")
+		}
+
+		receive(versionChan)
+
+		os.Remove(filepath.Join(os.TempDir(), "testreadatleast"))
+
+		timeout := 20 * time.Millisecond
+		timeoutMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testreadatleast", ReadAtLeastTimeout: &timeout})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer timeoutMariInst.Remove()
+
+		readErr = timeoutMariInst.ReadTxAtLeast(mariv2.HLCFromTime(time.Now().Add(time.Hour)), func(tx *mariv2.Tx) error { return nil })
+		if !errors.Is(readErr, mariv2.ErrVersionNotReached) {
+			t.Errorf("expected ErrVersionNotReached: actual(%v)", readErr)
+		}
+	})
+
+	t.Run("Test Read At Least Across Compaction", func(t *testing.T) {
+		os.Remove(filepath.Join(os.TempDir(), "testreadatleastcompact"))
+
+		var compactNow atomic.Bool
+		timeout := 20 * time.Millisecond
+		compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return compactNow.CompareAndSwap(true, false) })
+		compactMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testreadatleastcompact", ReadAtLeastTimeout: &timeout, CompactTrigger: &compactTrigger})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer compactMariInst.Remove()
+
+		commit := func(value string) *mariv2.Tx {
+			var committed *mariv2.Tx
+			putErr := compactMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				committed = tx
+				return tx.Put([]byte("token"), []byte(value))
+			})
+
+			if putErr != nil {
+				t.Fatalf("error on mari put: %s", putErr.Error())
+			}
+
+			return committed
+		}
+
+		for idx := range 4 {
+			commit(fmt.Sprintf("before %d", idx))
+		}
+
+		committed := commit("latest")
+
+		deadline := time.Now().Add(5 * time.Second)
+		for version := committed.CommitVersion(); ; {
+			stats, statsErr := compactMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+
+			if stats.Version < version {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("file was not compacted")
+			}
+
+			compactNow.Store(true)
+			version = commit("latest").CommitVersion()
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		var value string
+		readErr := compactMariInst.ReadTxAtLeast(committed.CommitTimestamp(), func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("token"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			value = string(kvPair.Value)
+			return nil
+		})
+
+		if readErr != nil || value != "latest" {
+			t.Errorf("expected a token issued before compaction to be reached: actual(%s, %v)", value, readErr)
+		}
+	})
+
+	t.Run("Test Cancel And Close", func(t *testing.T) {
+		cancel()
+		if _, ok := receive(versionChan); ok {
+			t.Error("expected channel to be closed on cancel")
+		}
+
+		openChan, _ := notifyMariInst.VersionChan()
+		notifyMariInst.Close()
+		if _, ok := receive(openChan); ok {
+			t.Error("expected channel to be closed on close")
+		}
+
+		closedChan, _ := notifyMariInst.VersionChan()
+		if _, ok := receive(closedChan); ok {
+			t.Error("expected channel subscribed after close to be closed")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package maritests
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var opLogMariInst *mariv2.Mari
+var opLogLogs *SyncBuffer
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testoplog"))
+
+	opLogLogs = &SyncBuffer{}
+	nodePoolSize := int64(1000)
+	sampleRate := float64(1)
+	opts := mariv2.InitOpts{
+		Filepath:        os.TempDir(),
+		FileName:        "testoplog",
+		NodePoolSize:    &nodePoolSize,
+		OpLogSampleRate: &sampleRate,
+		Logger:          slog.New(slog.NewTextHandler(opLogLogs, nil)),
+	}
+
+	var openErr error
+	opLogMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := opLogMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range 100 {
+			putTxErr := tx.Put([]byte(fmt.Sprintf("oplog:%d", idx)), []byte(fmt.Sprintf("value %d", idx)))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("op log test mari initialized")
+}
+
+func TestMariOpLog(t *testing.T) {
+	defer opLogMariInst.Remove()
+
+	sampledLines := func(op string) []string {
+		var lines []string
+		for _, line := range strings.Split(opLogLogs.String(), "\n") {
+			if strings.Contains(line, "sampled operation") && strings.Contains(line, "op="+op+" ") {
+				lines = append(lines, line)
+			}
+		}
+
+		return lines
+	}
+
+	t.Run("Test Sampled Writes", func(t *testing.T) {
+		lines := sampledLines("put")
+		if len(lines) != 100 {
+			t.Fatalf("expected every put to be sampled: actual(%d)", len(lines))
+		}
+
+		if strings.Contains(lines[0], "oplog:") {
+			t.Errorf("expected the key to be logged as a hash: actual(%s)", lines[0])
+		}
+	})
+
+	t.Run("Test Sampled Reads", func(t *testing.T) {
+		readErr := opLogMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getErr := tx.Get([]byte("oplog:1"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			_, rangeErr := tx.Range([]byte("oplog:1"), []byte("oplog:2"), nil)
+			return rangeErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		getLines := sampledLines("get")
+		if len(getLines) != 1 {
+			t.Fatalf("expected the get to be sampled: actual(%d)", len(getLines))
+		}
+
+		for _, attr := range []string{"keyHash=", "latency=", "results=1 ", "nodesVisited="} {
+			if !strings.Contains(getLines[0], attr) {
+				t.Errorf("expected the sampled get to log %s: actual(%s)", attr, getLines[0])
+			}
+		}
+
+		if strings.Contains(getLines[0], "nodesVisited=0 ") {
+			t.Errorf("expected the sampled get to trace the nodes it visited: actual(%s)", getLines[0])
+		}
+
+		rangeLines := sampledLines("range")
+		if len(rangeLines) != 1 || !strings.Contains(rangeLines[0], "results=11 ") {
+			t.Errorf("expected the range to be sampled with its results: actual(%v)", rangeLines)
+		}
+	})
+
+	t.Run("Test Explain Not Sampled", func(t *testing.T) {
+		before := len(sampledLines("get"))
+		readErr := opLogMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, explainErr := tx.Explain(func(tx *mariv2.Tx) error {
+				_, getErr := tx.Get([]byte("oplog:1"), nil)
+				return getErr
+			})
+
+			return explainErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		if len(sampledLines("get")) != before {
+			t.Error("expected an explained operation not to be sampled")
+		}
+	})
+
+	t.Run("Test Invalid Sample Rate", func(t *testing.T) {
+		sampleRate := float64(2)
+		_, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testoplog_invalid", OpLogSampleRate: &sampleRate})
+		if openErr == nil {
+			t.Error("expected a sample rate above 1 to be rejected")
+		}
+	})
+}
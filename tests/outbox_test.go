@@ -0,0 +1,152 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var outboxMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testoutbox"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testoutbox", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	outboxMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("outbox test mari initialized")
+}
+
+func TestMariOutbox(t *testing.T) {
+	defer outboxMariInst.Remove()
+
+	t.Run("Test Append With Records", func(t *testing.T) {
+		firstID, putErr := outboxMariInst.PutWithOutbox([]byte("order:1"), []byte("new"), []byte("created:1"))
+		if putErr != nil {
+			t.Fatalf("error on put with outbox: %s", putErr.Error())
+		}
+
+		updateErr := outboxMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			putTxErr := tx.Put([]byte("order:2"), []byte("new"))
+			if putTxErr != nil {
+				return putTxErr
+			}
+
+			_, appendErr := tx.AppendOutbox([]byte("created:2"))
+			return appendErr
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		rollbackErr := errors.New("rollback")
+		failedErr := outboxMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			_, appendErr := tx.AppendOutbox([]byte("created:3"))
+			if appendErr != nil {
+				return appendErr
+			}
+
+			return rollbackErr
+		})
+
+		if !errors.Is(failedErr, rollbackErr) {
+			t.Fatalf("expected the transaction to fail: actual(%v)", failedErr)
+		}
+
+		entries, readErr := outboxMariInst.ReadOutbox(10)
+		if readErr != nil {
+			t.Fatalf("error reading outbox: %s", readErr.Error())
+		}
+
+		if len(entries) != 2 || entries[0].ID != firstID || entries[1].ID <= firstID {
+			t.Fatalf("expected the two committed entries in id order: actual(%v)", entries)
+		}
+
+		if !bytes.Equal(entries[0].Event, []byte("created:1")) || !bytes.Equal(entries[1].Event, []byte("created:2")) {
+			t.Fatalf("unexpected events: actual(%s, %s)", entries[0].Event, entries[1].Event)
+		}
+
+		readErr = outboxMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range(nil, nil, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 2 {
+				return fmt.Errorf("expected only the records in user scans: actual(%d)", len(kvPairs))
+			}
+
+			_, appendErr := tx.AppendOutbox([]byte("read only"))
+			if appendErr == nil {
+				return errors.New("expected an error appending in a read only transaction")
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatal(readErr.Error())
+		}
+	})
+
+	t.Run("Test Read And Ack", func(t *testing.T) {
+		entries, readErr := outboxMariInst.ReadOutbox(1)
+		if readErr != nil {
+			t.Fatalf("error reading outbox: %s", readErr.Error())
+		}
+
+		if len(entries) != 1 || !bytes.Equal(entries[0].Event, []byte("created:1")) {
+			t.Fatalf("expected the first entry within the limit: actual(%v)", entries)
+		}
+
+		ackErr := outboxMariInst.AckOutbox(entries[0].ID)
+		if ackErr != nil {
+			t.Fatalf("error acking outbox: %s", ackErr.Error())
+		}
+
+		ackErr = outboxMariInst.AckOutbox(entries[0].ID)
+		if ackErr != nil {
+			t.Fatalf("error acking an acked entry: %s", ackErr.Error())
+		}
+
+		entries, readErr = outboxMariInst.ReadOutbox(10)
+		if readErr != nil {
+			t.Fatalf("error reading outbox: %s", readErr.Error())
+		}
+
+		if len(entries) != 1 || !bytes.Equal(entries[0].Event, []byte("created:2")) {
+			t.Fatalf("expected the unacked entry to remain: actual(%v)", entries)
+		}
+
+		ackErr = outboxMariInst.AckOutbox(entries[0].ID)
+		if ackErr != nil {
+			t.Fatalf("error acking outbox: %s", ackErr.Error())
+		}
+
+		entries, readErr = outboxMariInst.ReadOutbox(10)
+		if readErr != nil {
+			t.Fatalf("error reading outbox: %s", readErr.Error())
+		}
+
+		if len(entries) != 0 {
+			t.Fatalf("expected an empty outbox: actual(%d)", len(entries))
+		}
+
+		_, limitErr := outboxMariInst.ReadOutbox(0)
+		if limitErr == nil {
+			t.Fatal("expected an error for a limit of 0")
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const POOL_INPUT_SIZE = 1000
+
+var poolKeyValPairs []KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testpooldisabled"))
+	os.Remove(filepath.Join(os.TempDir(), "testpoolretained"))
+	os.Remove(filepath.Join(os.TempDir(), "testpooldebug"))
+
+	poolKeyValPairs = make([]KeyVal, POOL_INPUT_SIZE)
+	for idx := range poolKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		poolKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("pool test mari initialized")
+}
+
+func TestMariPool(t *testing.T) {
+	putAndGet := func(t *testing.T, poolMariInst *mariv2.Mari) {
+		for _, val := range poolKeyValPairs {
+			putErr := poolMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				return tx.Put(val.Key, val.Value)
+			})
+
+			if putErr != nil {
+				t.Fatalf("error on mari put: %s", putErr.Error())
+			}
+		}
+
+		getErr := poolMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, val := range poolKeyValPairs {
+				kvPair, getTxErr := tx.Get(val.Key, nil)
+				if getTxErr != nil {
+					return getTxErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+					return fmt.Errorf("actual value not equal to expected for key %x", val.Key)
+				}
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+	}
+
+	t.Run("Test Disabled Pool", func(t *testing.T) {
+		disableNodePool := true
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testpooldisabled", DisableNodePool: &disableNodePool}
+		poolMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer poolMariInst.Remove()
+
+		putAndGet(t, poolMariInst)
+
+		poolStats := poolMariInst.PoolStats()
+		if !poolStats.Disabled || poolStats.Retained != 0 || poolStats.Puts != 0 {
+			t.Errorf("expected no nodes retained by a disabled pool: %+v", poolStats)
+		}
+
+		if poolStats.Gets == 0 || poolStats.Allocations != poolStats.Gets {
+			t.Errorf("expected every node to be allocated by a disabled pool: %+v", poolStats)
+		}
+	})
+
+	t.Run("Test Max Retained", func(t *testing.T) {
+		nodePoolSize := int64(0)
+		nodePoolMaxRetained := int64(10)
+		opts := mariv2.InitOpts{
+			Filepath:            os.TempDir(),
+			FileName:            "testpoolretained",
+			NodePoolSize:        &nodePoolSize,
+			NodePoolMaxRetained: &nodePoolMaxRetained,
+		}
+
+		poolMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer poolMariInst.Remove()
+
+		poolStats := poolMariInst.PoolStats()
+		if poolStats.Retained != 0 {
+			t.Errorf("expected no nodes pre-allocated: %+v", poolStats)
+		}
+
+		putAndGet(t, poolMariInst)
+
+		poolStats = poolMariInst.PoolStats()
+		if poolStats.Retained > nodePoolMaxRetained {
+			t.Errorf("expected at most %d nodes retained: %+v", nodePoolMaxRetained, poolStats)
+		}
+
+		if poolStats.Puts == 0 || poolStats.Drops == 0 {
+			t.Errorf("expected nodes put back until the pool was full, then dropped: %+v", poolStats)
+		}
+	})
+
+	t.Run("Test Pool Debug", func(t *testing.T) {
+		poolDebug := true
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testpooldebug", PoolDebug: &poolDebug}
+		poolMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer poolMariInst.Remove()
+
+		putAndGet(t, poolMariInst)
+
+		audit := poolMariInst.PoolAudit(0)
+		if audit == nil {
+			t.Fatal("expected a pool audit with pool debug")
+		}
+
+		if len(audit.DoubleReturns) != 0 {
+			t.Fatalf("expected no nodes put back twice: actual(%d), first(%s)", len(audit.DoubleReturns), audit.DoubleReturns[0].Stack)
+		}
+
+		if len(audit.Outstanding) == 0 {
+			t.Fatal("expected the root taken when the file was initialized to be outstanding")
+		}
+
+		for _, checkout := range audit.Outstanding {
+			if (checkout.Kind != mariv2.PoolNodeInternal && checkout.Kind != mariv2.PoolNodeLeaf) || !strings.Contains(checkout.Stack, "mariv2.") {
+				t.Fatalf("expected the kind and stack of each outstanding node: actual(%s, %s)", checkout.Kind, checkout.Stack)
+			}
+		}
+
+		if recent := poolMariInst.PoolAudit(time.Hour); len(recent.Outstanding) != 0 {
+			t.Errorf("expected no nodes outstanding for an hour: actual(%d)", len(recent.Outstanding))
+		}
+
+		if mariInst.PoolAudit(0) != nil {
+			t.Error("expected no pool audit without pool debug")
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var prefetchMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testprefetch"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testprefetch", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	prefetchMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("prefetch test mari initialized")
+}
+
+func TestMariPrefetch(t *testing.T) {
+	defer prefetchMariInst.Remove()
+
+	keys := make([][]byte, 100)
+	putErr := prefetchMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range keys {
+			keys[idx] = []byte(fmt.Sprintf("prefetch:%03d", idx))
+			putTxErr := tx.Put(keys[idx], bytes.Repeat([]byte{byte(idx + 1)}, 1024))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put: %s", putErr.Error())
+	}
+
+	t.Run("Test Prefetch Keys", func(t *testing.T) {
+		prefetchErr := prefetchMariInst.Prefetch(append(keys, []byte("prefetch:missing"), nil))
+		if prefetchErr != nil {
+			t.Fatalf("error on mari prefetch: %s", prefetchErr.Error())
+		}
+
+		getErr := prefetchMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getTxErr := tx.Get(keys[42], nil)
+			if getTxErr != nil {
+				return getTxErr
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, bytes.Repeat([]byte{43}, 1024)) {
+				return fmt.Errorf("expected the value of a prefetched key: actual(%v)", kvPair)
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Fatal(getErr.Error())
+		}
+	})
+
+	t.Run("Test Prefetch Range", func(t *testing.T) {
+		prefetchErr := prefetchMariInst.PrefetchRange([]byte("prefetch:010"), []byte("prefetch:050"))
+		if prefetchErr != nil {
+			t.Fatalf("error on mari prefetch range: %s", prefetchErr.Error())
+		}
+
+		prefetchErr = prefetchMariInst.PrefetchRange(nil, nil)
+		if prefetchErr != nil {
+			t.Fatalf("error on mari prefetch of an open range: %s", prefetchErr.Error())
+		}
+
+		prefetchErr = prefetchMariInst.PrefetchRange([]byte("prefetch:050"), []byte("prefetch:010"))
+		if prefetchErr == nil {
+			t.Error("expected error on prefetch of a range with the start key after the end key")
+		}
+	})
+
+	t.Run("Test Residency Stats", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("residency is only sampled on linux")
+		}
+
+		os.Remove(filepath.Join(os.TempDir(), "testresidency"))
+
+		interval := 10 * time.Millisecond
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testresidency", ResidencySampleInterval: &interval}
+
+		residencyMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer residencyMariInst.Remove()
+
+		putErr := residencyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, key := range keys {
+				putTxErr := tx.Put(key, bytes.Repeat([]byte{1}, 1024))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		var residency mariv2.ResidencyStats
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(interval) {
+			stats, statsErr := residencyMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error getting stats: %s", statsErr.Error())
+			}
+
+			residency = stats.Residency
+			if residency.Samples > 0 && residency.MappedBytes >= 100*1024 {
+				break
+			}
+		}
+
+		if residency.Samples == 0 || residency.MappedBytes < 100*1024 {
+			t.Fatalf("expected a sample of the serialized data: %+v", residency)
+		}
+
+		if residency.ResidentBytes == 0 || residency.ResidentBytes > residency.MappedBytes || residency.ResidentRatio <= 0 || residency.ResidentRatio > 1 {
+			t.Errorf("expected the written pages to be resident: %+v", residency)
+		}
+
+		stats, _ := prefetchMariInst.Stats()
+		if stats.Residency.Samples != 0 {
+			t.Errorf("expected no samples without a sample interval: %+v", stats.Residency)
+		}
+	})
+
+	t.Run("Test Hot Set Warming", func(t *testing.T) {
+		os.Remove(filepath.Join(os.TempDir(), "testhotset"))
+
+		prefixLength := len("user:")
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testhotset", HotSetPrefixLength: &prefixLength}
+
+		hotSetMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		putErr := hotSetMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for idx := range 100 {
+				for _, prefix := range []string{"user:", "item:", "cart:"} {
+					putTxErr := tx.Put([]byte(fmt.Sprintf("%s%03d", prefix, idx)), bytes.Repeat([]byte{1}, 512))
+					if putTxErr != nil {
+						return putTxErr
+					}
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		readErr := hotSetMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for idx := range 100 {
+				for _, key := range []string{fmt.Sprintf("user:%03d", idx), fmt.Sprintf("user:%03d", idx), fmt.Sprintf("item:%03d", idx)} {
+					_, getErr := tx.Get([]byte(key), nil)
+					if getErr != nil {
+						return getErr
+					}
+				}
+			}
+
+			_, rangeErr := tx.Range([]byte("cart:000"), []byte("cart:009"), nil)
+			return rangeErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		recorded, recordErr := hotSetMariInst.RecordHotSet(2)
+		if recordErr != nil {
+			t.Fatalf("error recording hot set: %s", recordErr.Error())
+		}
+
+		if len(recorded) != 2 || string(recorded[0].Prefix) != "user:" || recorded[0].Reads != 200 || string(recorded[1].Prefix) != "item:" {
+			t.Fatalf("expected the two most read prefixes: actual(%v)", recorded)
+		}
+
+		closeErr := hotSetMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		warmOnOpen := true
+		hotSetMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testhotset", WarmOnOpen: &warmOnOpen})
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		defer hotSetMariInst.Remove()
+
+		manifest, manifestErr := hotSetMariInst.HotSet()
+		if manifestErr != nil {
+			t.Fatalf("error reading hot set: %s", manifestErr.Error())
+		}
+
+		if len(manifest) != 2 || string(manifest[0].Prefix) != "user:" || manifest[0].Reads != 200 {
+			t.Fatalf("expected the recorded manifest after reopening: actual(%v)", manifest)
+		}
+
+		warmed, warmErr := hotSetMariInst.WarmHotSet()
+		if warmErr != nil || warmed != 2 {
+			t.Fatalf("expected both prefixes to be warmed: actual(%d, %v)", warmed, warmErr)
+		}
+
+		recorded, recordErr = hotSetMariInst.RecordHotSet(2)
+		if recordErr != nil || recorded != nil {
+			t.Fatalf("expected nothing recorded without a prefix length: actual(%v, %v)", recorded, recordErr)
+		}
+	})
+
+	t.Run("Test Prefetch Closed", func(t *testing.T) {
+		closeErr := prefetchMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error on mari close: %s", closeErr.Error())
+		}
+
+		if prefetchErr := prefetchMariInst.Prefetch(keys); !errors.Is(prefetchErr, mariv2.ErrClosed) {
+			t.Errorf("expected error on prefetch after close: actual(%v)", prefetchErr)
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var prefixMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testprefix"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testprefix", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	prefixMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := prefixMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		keyspaces := map[string]int{"user:": 30, "order:": 10, "item:": 5}
+		for keyspace, total := range keyspaces {
+			for idx := range total {
+				key := []byte(fmt.Sprintf("%s%d", keyspace, idx))
+				putTxErr := tx.Put(key, key)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+		}
+
+		return tx.Put([]byte("us"), []byte("short"))
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("prefix test mari initialized")
+}
+
+func TestMariPrefix(t *testing.T) {
+	defer prefixMariInst.Remove()
+
+	t.Run("Test Count Prefix", func(t *testing.T) {
+		expected := map[string]int{"user:": 30, "u": 31, "user:1": 11, "order:": 10, "item:4": 1, "nope": 0, "": 46}
+
+		readErr := prefixMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for prefix, expCount := range expected {
+				count, countErr := tx.CountPrefix([]byte(prefix))
+				if countErr != nil {
+					return countErr
+				}
+
+				if count != expCount {
+					t.Errorf("count for prefix %q not equal to expected: actual(%d), expected(%d)", prefix, count, expCount)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari count prefix: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Top Prefixes", func(t *testing.T) {
+		var top2, top5 []*mariv2.PrefixCount
+		readErr := prefixMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var topErr error
+			top2, topErr = tx.TopPrefixes(2, 2)
+			if topErr != nil {
+				return topErr
+			}
+
+			top5, topErr = tx.TopPrefixes(5, 10)
+			return topErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari top prefixes: %s", readErr.Error())
+		}
+
+		format := func(prefixCounts []*mariv2.PrefixCount) string {
+			var formatted string
+			for _, prefixCount := range prefixCounts {
+				formatted += fmt.Sprintf("%s=%d ", prefixCount.Prefix, prefixCount.Count)
+			}
+			return formatted
+		}
+
+		if actual, expected := format(top2), "us=31 or=10 "; actual != expected {
+			t.Errorf("top prefixes not equal to expected: actual(%s), expected(%s)", actual, expected)
+		}
+
+		if actual, expected := format(top5), "user:=30 order=10 item:=5 "; actual != expected {
+			t.Errorf("top prefixes not equal to expected: actual(%s), expected(%s)", actual, expected)
+		}
+	})
+	t.Run("Test Delete Prefix", func(t *testing.T) {
+		stats, statsErr := prefixMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		updateErr := prefixMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			deleted, delErr := tx.DeletePrefix([]byte("user:1"))
+			if delErr != nil {
+				return delErr
+			}
+
+			if deleted != 11 {
+				t.Errorf("deleted keys not equal to expected: actual(%d), expected(%d)", deleted, 11)
+			}
+
+			deleted, delErr = tx.DeletePrefix([]byte("order:"))
+			if delErr != nil {
+				return delErr
+			}
+
+			if deleted != 10 {
+				t.Errorf("deleted keys not equal to expected: actual(%d), expected(%d)", deleted, 10)
+			}
+
+			deleted, delErr = tx.DeletePrefix([]byte("nope"))
+			if delErr != nil {
+				return delErr
+			}
+
+			if deleted != 0 {
+				t.Errorf("expected no keys to be deleted: actual(%d)", deleted)
+			}
+
+			_, delErr = tx.DeletePrefix(mariv2.ReservedKeyPrefix)
+			if !errors.Is(delErr, mariv2.ErrReservedKey) {
+				t.Errorf("expected ErrReservedKey: actual(%v)", delErr)
+			}
+
+			return nil
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari delete prefix: %s", updateErr.Error())
+		}
+
+		expected := map[string]int{"user:": 19, "user:1": 0, "user:2": 11, "us": 20, "order:": 0, "item:": 5, "": 25}
+		readErr := prefixMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for prefix, expCount := range expected {
+				count, countErr := tx.CountPrefix([]byte(prefix))
+				if countErr != nil {
+					return countErr
+				}
+
+				if count != expCount {
+					t.Errorf("count for prefix %q not equal to expected: actual(%d), expected(%d)", prefix, count, expCount)
+				}
+			}
+
+			kvPairs, rangeErr := tx.Range([]byte("user:"), []byte("user;"), nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 19 {
+				t.Errorf("expected the remaining keys in range: actual(%d), expected(%d)", len(kvPairs), 19)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		readErr = prefixMariInst.ReadTxAtVersion(stats.Version, func(tx *mariv2.Tx) error {
+			count, countErr := tx.CountPrefix([]byte("user:1"))
+			if countErr != nil {
+				return countErr
+			}
+
+			if count != 11 {
+				t.Errorf("expected the deleted keys at the earlier version: actual(%d), expected(%d)", count, 11)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error reading at version: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Delete Prefix Recorded Once", func(t *testing.T) {
+		conflictTx, beginErr := prefixMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		deleted, delErr := conflictTx.DeletePrefix([]byte("item:"))
+		if delErr != nil || deleted != 5 {
+			t.Fatalf("expected the keys with the prefix to be deleted: actual(%d, %v)", deleted, delErr)
+		}
+
+		putErr := prefixMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("item:9"), []byte("item:9"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		commitErr := conflictTx.Commit()
+		if !errors.Is(commitErr, mariv2.ErrTxConflict) {
+			t.Errorf("expected a put under the prefix to conflict with the prefix delete: actual(%v)", commitErr)
+		}
+
+		eventChan, cancel := prefixMariInst.CommitChan(16)
+		defer cancel()
+
+		rebaseTx, beginErr := prefixMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error on mari begin: %s", beginErr.Error())
+		}
+
+		deleted, delErr = rebaseTx.DeletePrefix([]byte("item:"))
+		if delErr != nil || deleted != 6 {
+			t.Fatalf("expected the keys with the prefix to be deleted: actual(%d, %v)", deleted, delErr)
+		}
+
+		putErr = prefixMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("other:1"), []byte("other:1"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		commitErr = rebaseTx.Commit()
+		if commitErr != nil {
+			t.Fatalf("expected a put outside the prefix to be rebased: actual(%v)", commitErr)
+		}
+
+		var changes []*mariv2.Change
+		for range 2 {
+			select {
+			case event := <-eventChan:
+				changes = append(changes, event.Changes...)
+			case <-time.After(time.Second):
+				t.Fatalf("expected an event for each commit")
+			}
+		}
+
+		last := changes[len(changes)-1]
+		if len(changes) != 2 || string(last.Key) != "item:" || !last.Delete || !last.Prefix {
+			t.Errorf("expected the prefix delete as a single change: actual(%v)", last)
+		}
+
+		readErr := prefixMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for prefix, expCount := range map[string]int{"item:": 0, "other:": 1} {
+				count, countErr := tx.CountPrefix([]byte(prefix))
+				if countErr != nil {
+					return countErr
+				}
+
+				if count != expCount {
+					t.Errorf("count for prefix %q not equal to expected: actual(%d), expected(%d)", prefix, count, expCount)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var profileMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testprofile"))
+
+	profileTransactions := true
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:            os.TempDir(),
+		FileName:            "testprofile",
+		NodePoolSize:        &nodePoolSize,
+		ProfileTransactions: &profileTransactions,
+	}
+
+	var openErr error
+	profileMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("profile test mari initialized")
+}
+
+func TestMariProfileLabels(t *testing.T) {
+	defer profileMariInst.Remove()
+
+	goroutines := func() string {
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		return buf.String()
+	}
+
+	t.Run("Test Worker Labels", func(t *testing.T) {
+		profile := goroutines()
+		for _, subsystem := range []string{mariv2.ProfileSubsystemCompaction, mariv2.ProfileSubsystemFlush, mariv2.ProfileSubsystemExpiration} {
+			label := fmt.Sprintf("%q:%q", mariv2.ProfileLabelSubsystem, subsystem)
+			if !strings.Contains(profile, label) || !strings.Contains(profile, `"mari.instance":"testprofile"`) {
+				t.Errorf("expected worker to be labeled: %s", label)
+			}
+		}
+	})
+
+	t.Run("Test Transaction Labels", func(t *testing.T) {
+		var profile string
+		readErr := profileMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			profile = goroutines()
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		label := fmt.Sprintf("%q:%q", mariv2.ProfileLabelOp, mariv2.ProfileOpRead)
+		if !strings.Contains(profile, label) {
+			t.Errorf("expected transaction to be labeled: %s", label)
+		}
+
+		if strings.Contains(goroutines(), label) {
+			t.Error("expected transaction labels to be removed after the transaction")
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var putMariInst *mariv2.Mari
+var putPrefixKeys = []string{"a", "ab", "abc", "abd", "b"}
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testput"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testput", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	putMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("put test mari initialized")
+}
+
+func TestMariPutPrefixKeys(t *testing.T) {
+	defer putMariInst.Remove()
+
+	var permutations [][]string
+	var permute func(keys []string, idx int)
+	permute = func(keys []string, idx int) {
+		if idx == len(keys) {
+			permutations = append(permutations, append([]string(nil), keys...))
+			return
+		}
+
+		for swapIdx := idx; swapIdx < len(keys); swapIdx++ {
+			keys[idx], keys[swapIdx] = keys[swapIdx], keys[idx]
+			permute(keys, idx+1)
+			keys[idx], keys[swapIdx] = keys[swapIdx], keys[idx]
+		}
+	}
+
+	permute(append([]string(nil), putPrefixKeys...), 0)
+
+	putAll := func(value string) error {
+		return putMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for idx, keys := range permutations {
+				for _, key := range keys {
+					putErr := tx.Put([]byte(fmt.Sprintf("p%03d:%s", idx, key)), []byte(value+key))
+					if putErr != nil {
+						return putErr
+					}
+				}
+			}
+
+			return nil
+		})
+	}
+
+	checkAll := func(t *testing.T, value string) {
+		readErr := putMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for idx := range permutations {
+				prefix := fmt.Sprintf("p%03d:", idx)
+				kvPairs, rangeErr := tx.Range([]byte(prefix), []byte(prefix+"~"), nil)
+				if rangeErr != nil {
+					return rangeErr
+				}
+
+				var keys []string
+				for _, kvPair := range kvPairs {
+					key := string(kvPair.Key[len(prefix):])
+					keys = append(keys, key)
+					if !bytes.Equal(kvPair.Value, []byte(value+key)) {
+						t.Errorf("value for %q not equal to expected: actual(%q), expected(%q)", kvPair.Key, kvPair.Value, value+key)
+					}
+				}
+
+				if fmt.Sprint(keys) != fmt.Sprint(putPrefixKeys) {
+					t.Errorf("keys put in order %v not equal to expected: actual(%v), expected(%v)", permutations[idx], keys, putPrefixKeys)
+				}
+
+				for _, key := range putPrefixKeys {
+					kvPair, getErr := tx.Get([]byte(prefix+key), nil)
+					if getErr != nil {
+						return getErr
+					}
+
+					if kvPair == nil || !bytes.Equal(kvPair.Value, []byte(value+key)) {
+						t.Errorf("get for %q put in order %v not equal to expected: actual(%v), expected(%q)", prefix+key, permutations[idx], kvPair, value+key)
+					}
+				}
+			}
+
+			count, countErr := tx.Count()
+			if countErr != nil {
+				return countErr
+			}
+
+			if count != len(permutations)*len(putPrefixKeys) {
+				t.Errorf("count not equal to keys put: actual(%d), expected(%d)", count, len(permutations)*len(putPrefixKeys))
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error reading prefix keys: %s", readErr.Error())
+		}
+	}
+
+	t.Run("Test Put Keys That Are Prefixes In Every Order", func(t *testing.T) {
+		putErr := putAll("first:")
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		checkAll(t, "first:")
+	})
+
+	t.Run("Test Overwrite Keys That Are Prefixes", func(t *testing.T) {
+		putErr := putAll("second:")
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		checkAll(t, "second:")
+	})
+}
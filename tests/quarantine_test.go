@@ -0,0 +1,239 @@
+package maritests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const QUARANTINE_INPUT_SIZE = 1000
+
+var quarantineFile []byte
+var quarantineKeyValPairs []KeyVal
+var quarantineLastKeyVal KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testquarantine"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testquarantine",
+		NodePoolSize: &nodePoolSize,
+	}
+
+	quarantineMariInst, openErr := mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	quarantineKeyValPairs = make([]KeyVal, QUARANTINE_INPUT_SIZE)
+	putErr := quarantineMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range quarantineKeyValPairs {
+			randomBytes, _ := GenerateRandomBytes(32)
+			quarantineKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+
+			putTxErr := tx.Put(randomBytes, randomBytes)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	randomBytes, _ := GenerateRandomBytes(32)
+	quarantineLastKeyVal = KeyVal{Key: randomBytes, Value: []byte("last")}
+	putErr = quarantineMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put(quarantineLastKeyVal.Key, quarantineLastKeyVal.Value)
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	closeErr := quarantineMariInst.Close()
+	if closeErr != nil {
+		panic(closeErr.Error())
+	}
+
+	var readErr error
+	quarantineFile, readErr = os.ReadFile(filepath.Join(os.TempDir(), "testquarantine"))
+	if readErr != nil {
+		panic(readErr.Error())
+	}
+
+	os.Remove(filepath.Join(os.TempDir(), "testquarantine"))
+	fmt.Println("quarantine test mari initialized")
+}
+
+func TestMariQuarantine(t *testing.T) {
+	// the key is written once, in the leaf of the last version
+	endSerialized := binary.LittleEndian.Uint64(quarantineFile[mariv2.MetaEndSerializedOffset:])
+	keyOffset := uint64(bytes.LastIndex(quarantineFile[:endSerialized], quarantineLastKeyVal.Key))
+	leafOffset := keyOffset - mariv2.NodeKeyIdx
+
+	openCorrupted := func(t *testing.T, name string, corrupt func(file []byte), openValidation mariv2.OpenValidation) (*mariv2.Mari, error) {
+		file := append([]byte{}, quarantineFile...)
+		corrupt(file)
+
+		writeErr := os.WriteFile(filepath.Join(os.TempDir(), name), file, 0600)
+		if writeErr != nil {
+			t.Fatalf("error writing corrupted file: %s", writeErr.Error())
+		}
+
+		degraded := true
+		nodePoolSize := int64(1000)
+		opts := mariv2.InitOpts{
+			Filepath:       os.TempDir(),
+			FileName:       name,
+			NodePoolSize:   &nodePoolSize,
+			OpenValidation: &openValidation,
+			Degraded:       &degraded,
+		}
+
+		return mariv2.Open(opts)
+	}
+
+	getUnaffected := func(t *testing.T, quarantineMariInst *mariv2.Mari, prefix []byte) {
+		var checked int
+		getErr := quarantineMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, val := range quarantineKeyValPairs {
+				if bytes.HasPrefix(val.Key, prefix) {
+					continue
+				}
+
+				kvPair, getTxErr := tx.Get(val.Key, nil)
+				if getTxErr != nil {
+					return getTxErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+					return fmt.Errorf("actual value not equal to expected for key %x", val.Key)
+				}
+
+				checked++
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Errorf("error getting keys outside of the quarantined prefix: %s", getErr.Error())
+		}
+
+		t.Log("keys read outside of the quarantined prefix:", checked)
+	}
+
+	t.Run("Test Quarantine On Open", func(t *testing.T) {
+		defer os.Remove(filepath.Join(os.TempDir(), "testquarantineopen"))
+
+		quarantineMariInst, openErr := openCorrupted(t, "testquarantineopen", func(file []byte) {
+			file[keyOffset] = ^file[keyOffset]
+		}, mariv2.OpenValidationFull)
+
+		if openErr != nil {
+			t.Fatalf("error opening mari in degraded mode: %s", openErr.Error())
+		}
+
+		defer quarantineMariInst.Close()
+
+		quarantined := quarantineMariInst.Quarantined()
+		if len(quarantined) != 1 {
+			t.Fatalf("expected 1 quarantined subtree, got: %d", len(quarantined))
+		}
+
+		prefix := quarantined[0].Prefix
+		if len(prefix) == 0 || !bytes.HasPrefix(quarantineLastKeyVal.Key, prefix) {
+			t.Fatalf("expected quarantined prefix of the corrupted key, got: %x", prefix)
+		}
+
+		getErr := quarantineMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getTxErr := tx.Get(quarantineLastKeyVal.Key, nil)
+			return getTxErr
+		})
+
+		if !errors.Is(getErr, mariv2.ErrQuarantined) || !errors.Is(getErr, mariv2.ErrCorrupt) {
+			t.Errorf("expected quarantine error, got: %v", getErr)
+		}
+
+		var quarantineErr *mariv2.QuarantineError
+		if !errors.As(getErr, &quarantineErr) || !bytes.Equal(quarantineErr.Prefix, prefix) {
+			t.Errorf("expected quarantine error with the quarantined prefix, got: %v", getErr)
+		}
+
+		getUnaffected(t, quarantineMariInst, prefix)
+
+		verifyErr := quarantineMariInst.Verify()
+		if !errors.Is(verifyErr, mariv2.ErrQuarantined) {
+			t.Errorf("expected quarantine error on verify, got: %v", verifyErr)
+		}
+	})
+
+	t.Run("Test Quarantine On Read", func(t *testing.T) {
+		defer os.Remove(filepath.Join(os.TempDir(), "testquarantineread"))
+
+		quarantineMariInst, openErr := openCorrupted(t, "testquarantineread", func(file []byte) {
+			binary.LittleEndian.PutUint16(file[leafOffset+mariv2.NodeEndOffsetIdx:], 0)
+		}, mariv2.OpenValidationFast)
+
+		if openErr != nil {
+			t.Fatalf("error opening mari in degraded mode: %s", openErr.Error())
+		}
+
+		defer quarantineMariInst.Close()
+
+		if len(quarantineMariInst.Quarantined()) != 0 {
+			t.Fatalf("expected no quarantined subtrees before reading")
+		}
+
+		getErr := quarantineMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getTxErr := tx.Get(quarantineLastKeyVal.Key, nil)
+			return getTxErr
+		})
+
+		var quarantineErr *mariv2.QuarantineError
+		if !errors.As(getErr, &quarantineErr) {
+			t.Fatalf("expected quarantine error, got: %v", getErr)
+		}
+
+		if quarantineErr.Prefix != nil {
+			t.Errorf("expected unknown prefix before verify, got: %x", quarantineErr.Prefix)
+		}
+
+		putErr := quarantineMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(quarantineLastKeyVal.Key, []byte("update"))
+		})
+
+		if !errors.Is(putErr, mariv2.ErrQuarantined) {
+			t.Errorf("expected quarantine error on put, got: %v", putErr)
+		}
+
+		verifyErr := quarantineMariInst.Verify()
+		if !errors.Is(verifyErr, mariv2.ErrQuarantined) {
+			t.Errorf("expected quarantine error on verify, got: %v", verifyErr)
+		}
+
+		quarantined := quarantineMariInst.Quarantined()
+		if len(quarantined) != 1 {
+			t.Fatalf("expected 1 quarantined subtree, got: %d", len(quarantined))
+		}
+
+		prefix := quarantined[0].Prefix
+		if len(prefix) == 0 || !bytes.HasPrefix(quarantineLastKeyVal.Key, prefix) {
+			t.Fatalf("expected verify to locate the prefix of the corrupted key, got: %x", prefix)
+		}
+
+		getUnaffected(t, quarantineMariInst, prefix)
+	})
+}
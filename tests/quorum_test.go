@@ -0,0 +1,196 @@
+package maritests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var quorumLeaderMariInst *mariv2.Mari
+var quorumStaleMariInst *mariv2.Mari
+var quorumFreshMariInst *mariv2.Mari
+
+func init() {
+	for _, fileName := range []string{"testquorumleader", "testquorumstale", "testquorumfresh"} {
+		os.Remove(filepath.Join(os.TempDir(), fileName))
+	}
+
+	nodePoolSize := int64(1000)
+	follower := true
+
+	var openErr error
+	quorumLeaderMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testquorumleader", NodePoolSize: &nodePoolSize})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	quorumStaleMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testquorumstale", NodePoolSize: &nodePoolSize, Follower: &follower})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	quorumFreshMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testquorumfresh", NodePoolSize: &nodePoolSize, Follower: &follower})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("quorum test mari initialized")
+}
+
+type applySink struct {
+	replica *mariv2.Mari
+}
+
+func (sink *applySink) Receive(ctx context.Context, delta *mariv2.CommitEvent) error {
+	return sink.replica.ApplyDelta(delta)
+}
+
+func (sink *applySink) Close() error {
+	return nil
+}
+
+type unavailableReader struct {
+	block bool
+}
+
+func (reader *unavailableReader) ReadReplica(ctx context.Context, key []byte) (*mariv2.ReplicaRead, error) {
+	if reader.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return nil, errors.New("replica unavailable")
+}
+
+func TestMariQuorumRead(t *testing.T) {
+	defer quorumLeaderMariInst.Remove()
+	defer quorumStaleMariInst.Remove()
+	defer quorumFreshMariInst.Remove()
+
+	key := []byte("quorum:key")
+	put := func(t *testing.T, value string, replications ...*mariv2.Replication) {
+		putErr := quorumLeaderMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(key, []byte(value))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		stats, statsErr := quorumLeaderMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for _, replication := range replications {
+			for replication.Acked() < stats.Version {
+				if time.Now().After(deadline) {
+					t.Fatalf("expected version %d to be replicated: actual(%d)", stats.Version, replication.Acked())
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+
+	staleReplication, replicateErr := quorumLeaderMariInst.Replicate(&applySink{replica: quorumStaleMariInst}, mariv2.ReplicationOpts{})
+	if replicateErr != nil {
+		t.Fatalf("error starting replication: %s", replicateErr.Error())
+	}
+
+	freshReplication, replicateErr := quorumLeaderMariInst.Replicate(&applySink{replica: quorumFreshMariInst}, mariv2.ReplicationOpts{})
+	if replicateErr != nil {
+		t.Fatalf("error starting replication: %s", replicateErr.Error())
+	}
+
+	defer freshReplication.Stop()
+
+	put(t, "first", staleReplication, freshReplication)
+	staleReplication.Stop()
+	put(t, "second", freshReplication)
+
+	t.Run("Test Freshest Read", func(t *testing.T) {
+		read, readErr := mariv2.QuorumRead(context.Background(), []mariv2.ReplicaReader{quorumStaleMariInst, quorumFreshMariInst}, key, mariv2.QuorumReadOpts{Quorum: 2})
+		if readErr != nil {
+			t.Fatalf("error on quorum read: %s", readErr.Error())
+		}
+
+		if read.KvPair == nil || !bytes.Equal(read.KvPair.Value, []byte("second")) {
+			t.Fatalf("expected the value of the freshest replica: actual(%v)", read.KvPair)
+		}
+
+		leaderRead, readErr := quorumLeaderMariInst.ReadReplica(context.Background(), key)
+		if readErr != nil {
+			t.Fatalf("error reading the leader: %s", readErr.Error())
+		}
+
+		if leaderRead.Version != read.Version || leaderRead.Timestamp != read.Timestamp {
+			t.Errorf("expected the replica to report the leader version and timestamp: expected(%d, %d), actual(%d, %d)", leaderRead.Version, leaderRead.Timestamp, read.Version, read.Timestamp)
+		}
+	})
+
+	t.Run("Test Quorum Read Over TCP", func(t *testing.T) {
+		listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+		if listenErr != nil {
+			t.Fatalf("error listening: %s", listenErr.Error())
+		}
+
+		go quorumFreshMariInst.ServeReplication(listener)
+		defer listener.Close()
+
+		reader := mariv2.NewTCPReplicaReader(listener.Addr().String())
+		defer reader.Close()
+
+		read, readErr := mariv2.QuorumRead(context.Background(), []mariv2.ReplicaReader{quorumStaleMariInst, reader}, key, mariv2.QuorumReadOpts{Quorum: 2})
+		if readErr != nil {
+			t.Fatalf("error on quorum read: %s", readErr.Error())
+		}
+
+		if read.KvPair == nil || !bytes.Equal(read.KvPair.Value, []byte("second")) {
+			t.Fatalf("expected the value of the freshest replica: actual(%v)", read.KvPair)
+		}
+
+		read, readErr = reader.ReadReplica(context.Background(), []byte("quorum:missing"))
+		if readErr != nil || read.KvPair != nil {
+			t.Errorf("expected a missing key to be read as nil: actual(%v, %v)", read, readErr)
+		}
+	})
+
+	t.Run("Test Quorum Not Reached", func(t *testing.T) {
+		failed := &unavailableReader{}
+		_, readErr := mariv2.QuorumRead(context.Background(), []mariv2.ReplicaReader{quorumFreshMariInst, failed, failed}, key, mariv2.QuorumReadOpts{})
+
+		var quorumErr *mariv2.QuorumError
+		if !errors.Is(readErr, mariv2.ErrQuorumNotReached) || !errors.As(readErr, &quorumErr) {
+			t.Fatalf("expected a majority of unavailable replicas to fail the read: actual(%v)", readErr)
+		}
+
+		if quorumErr.Quorum != 2 || len(quorumErr.Errs) != 2 {
+			t.Errorf("expected a quorum of 2 with 2 errors: actual(%d, %d)", quorumErr.Quorum, len(quorumErr.Errs))
+		}
+
+		timeout := 50 * time.Millisecond
+		_, readErr = mariv2.QuorumRead(context.Background(), []mariv2.ReplicaReader{quorumFreshMariInst, &unavailableReader{block: true}}, key, mariv2.QuorumReadOpts{Timeout: &timeout})
+		if !errors.Is(readErr, mariv2.ErrQuorumNotReached) || !errors.Is(readErr, context.DeadlineExceeded) {
+			t.Errorf("expected the read to time out: actual(%v)", readErr)
+		}
+
+		read, readErr := mariv2.QuorumRead(context.Background(), []mariv2.ReplicaReader{quorumStaleMariInst, failed, quorumFreshMariInst}, key, mariv2.QuorumReadOpts{})
+		if readErr != nil {
+			t.Fatalf("expected a majority to reach the quorum: actual(%s)", readErr.Error())
+		}
+
+		if read.KvPair == nil {
+			t.Errorf("expected the key to be read")
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var quotaMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testquota"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testquota",
+		NodePoolSize: &nodePoolSize,
+		Quotas: []*mariv2.Quota{
+			{Prefix: []byte("keys:"), MaxKeys: 10},
+			{Prefix: []byte("bytes:"), MaxBytes: 100},
+			{Prefix: []byte("begin:"), MaxKeys: 1},
+		},
+	}
+
+	var openErr error
+	quotaMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("quota test mari initialized")
+}
+
+func TestMariQuota(t *testing.T) {
+	defer quotaMariInst.Remove()
+
+	put := func(keys ...string) error {
+		return quotaMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, key := range keys {
+				putErr := tx.Put([]byte(key), []byte("value"))
+				if putErr != nil {
+					return putErr
+				}
+			}
+
+			return nil
+		})
+	}
+
+	t.Run("Test Max Keys", func(t *testing.T) {
+		var keys []string
+		for idx := range 10 {
+			keys = append(keys, fmt.Sprintf("keys:%02d", idx))
+		}
+
+		putErr := put(keys...)
+		if putErr != nil {
+			t.Fatalf("expected the keys to fit the quota: %s", putErr.Error())
+		}
+
+		putErr = put("keys:10")
+		var quotaErr *mariv2.QuotaError
+		if !errors.As(putErr, &quotaErr) || !errors.Is(putErr, mariv2.ErrQuotaExceeded) {
+			t.Fatalf("expected a quota error: actual(%v)", putErr)
+		}
+
+		if string(quotaErr.Prefix) != "keys:" || quotaErr.Keys != 11 || quotaErr.MaxKeys != 10 {
+			t.Errorf("expected the quota error to carry the usage: actual(%+v)", quotaErr)
+		}
+
+		putErr = put("keys:00", "other:00")
+		if putErr != nil {
+			t.Errorf("expected writes that do not add keys to be accepted: %s", putErr.Error())
+		}
+
+		delErr := quotaMariInst.UpdateTx(func(tx *mariv2.Tx) error { return tx.Delete([]byte("keys:00")) })
+		if delErr != nil {
+			t.Fatalf("error deleting key: %s", delErr.Error())
+		}
+
+		putErr = put("keys:10")
+		if putErr != nil {
+			t.Errorf("expected the deleted key to free the quota: %s", putErr.Error())
+		}
+	})
+
+	t.Run("Test Max Bytes", func(t *testing.T) {
+		// each key-value pair is 7 bytes of key and 43 bytes of value
+		value := make([]byte, 43)
+		putValue := func(key string, value []byte) error {
+			return quotaMariInst.UpdateTx(func(tx *mariv2.Tx) error { return tx.Put([]byte(key), value) })
+		}
+
+		for _, key := range []string{"bytes:a", "bytes:b"} {
+			putErr := putValue(key, value)
+			if putErr != nil {
+				t.Fatalf("expected the key to fit the quota: %s", putErr.Error())
+			}
+		}
+
+		putErr := putValue("bytes:c", value)
+		var quotaErr *mariv2.QuotaError
+		if !errors.As(putErr, &quotaErr) || quotaErr.Bytes != 150 || quotaErr.MaxBytes != 100 {
+			t.Fatalf("expected a quota error on the bytes: actual(%v)", putErr)
+		}
+
+		putErr = putValue("bytes:a", make([]byte, 44))
+		if !errors.Is(putErr, mariv2.ErrQuotaExceeded) {
+			t.Errorf("expected a larger value to be rejected: actual(%v)", putErr)
+		}
+
+		putErr = putValue("bytes:a", make([]byte, 20))
+		if putErr != nil {
+			t.Fatalf("expected a smaller value to be accepted: %s", putErr.Error())
+		}
+
+		putErr = putValue("bytes:c", make([]byte, 16))
+		if putErr != nil {
+			t.Errorf("expected the freed bytes to be reused: %s", putErr.Error())
+		}
+
+		delErr := quotaMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			_, delErr := tx.DeletePrefix([]byte("bytes:"))
+			if delErr != nil {
+				return delErr
+			}
+
+			return tx.Put([]byte("bytes:d"), value)
+		})
+
+		if delErr != nil {
+			t.Fatalf("expected the prefix delete to free the quota: %s", delErr.Error())
+		}
+
+		putErr = putValue("bytes:e", value)
+		if putErr != nil {
+			t.Errorf("expected the bytes deleted by prefix to be freed: %s", putErr.Error())
+		}
+	})
+
+	t.Run("Test Concurrent Commits", func(t *testing.T) {
+		first, beginErr := quotaMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error beginning transaction: %s", beginErr.Error())
+		}
+
+		second, beginErr := quotaMariInst.Begin(false)
+		if beginErr != nil {
+			t.Fatalf("error beginning transaction: %s", beginErr.Error())
+		}
+
+		for idx, tx := range []*mariv2.Tx{first, second} {
+			putErr := tx.Put([]byte(fmt.Sprintf("begin:%d", idx)), []byte("value"))
+			if putErr != nil {
+				t.Fatalf("error on put: %s", putErr.Error())
+			}
+		}
+
+		commitErr := first.Commit()
+		if commitErr != nil {
+			t.Fatalf("expected the first commit to fit the quota: %s", commitErr.Error())
+		}
+
+		commitErr = second.Commit()
+		if !errors.Is(commitErr, mariv2.ErrQuotaExceeded) {
+			t.Errorf("expected the second commit to be rejected once rebased: actual(%v)", commitErr)
+		}
+	})
+
+	t.Run("Test Quota Usage", func(t *testing.T) {
+		usages, usageErr := quotaMariInst.QuotaUsage()
+		if usageErr != nil {
+			t.Fatalf("error getting quota usage: %s", usageErr.Error())
+		}
+
+		if len(usages) != 3 {
+			t.Fatalf("expected the usage of every quota: actual(%d)", len(usages))
+		}
+
+		expected := []mariv2.QuotaUsage{
+			{Prefix: []byte("keys:"), Keys: 10, Bytes: 10 * (7 + 5), MaxKeys: 10, Rejected: 1},
+			{Prefix: []byte("bytes:"), Keys: 2, Bytes: 100, MaxBytes: 100, Rejected: 2},
+			{Prefix: []byte("begin:"), Keys: 1, Bytes: 7 + 5, MaxKeys: 1, Rejected: 1},
+		}
+
+		for idx, usage := range usages {
+			want := expected[idx]
+			if string(usage.Prefix) != string(want.Prefix) || usage.Keys != want.Keys || usage.Bytes != want.Bytes || usage.MaxKeys != want.MaxKeys || usage.MaxBytes != want.MaxBytes || usage.Rejected != want.Rejected {
+				t.Errorf("expected the usage of %s: actual(%+v), expected(%+v)", want.Prefix, usage, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package maritests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var rangeMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testrange"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testrange", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	rangeMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := rangeMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for _, key := range []string{"a", "ab", "abc", "b", "ba", "c", "ca", "cab"} {
+			putTxErr := tx.Put([]byte(key), []byte(key))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("range test mari initialized")
+}
+
+func TestMariRange(t *testing.T) {
+	defer rangeMariInst.Remove()
+
+	rangeKeys := func(startKey, endKey []byte) ([]string, error) {
+		var keys []string
+		readErr := rangeMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range(startKey, endKey, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			for _, kvPair := range kvPairs {
+				keys = append(keys, string(kvPair.Key))
+			}
+
+			return nil
+		})
+
+		return keys, readErr
+	}
+
+	t.Run("Test Inclusive Start And Exclusive End", func(t *testing.T) {
+		expected := map[[2]string][]string{
+			{"ab", "ca"}:   {"ab", "abc", "b", "ba", "c"},
+			{"b", "b"}:     nil,
+			{"b", "b\x00"}: {"b"},
+			{"aa", "bb"}:   {"ab", "abc", "b", "ba"},
+			{"a", "cab"}:   {"a", "ab", "abc", "b", "ba", "c", "ca"},
+			{"cb", "d"}:    nil,
+			{"abc", "ba"}:  {"abc", "b"},
+		}
+
+		for bounds, expKeys := range expected {
+			keys, rangeErr := rangeKeys([]byte(bounds[0]), []byte(bounds[1]))
+			if rangeErr != nil {
+				t.Fatalf("error on mari range: %s", rangeErr.Error())
+			}
+
+			if fmt.Sprint(keys) != fmt.Sprint(expKeys) {
+				t.Errorf("range keys for %q not equal to expected: actual(%v), expected(%v)", bounds, keys, expKeys)
+			}
+		}
+
+		_, rangeErr := rangeKeys([]byte("ca"), []byte("ab"))
+		if rangeErr == nil {
+			t.Errorf("expected an error for a start key larger than the end key")
+		}
+	})
+
+	t.Run("Test Unbounded Start And End", func(t *testing.T) {
+		keys, rangeErr := rangeKeys(nil, []byte("b"))
+		if rangeErr != nil {
+			t.Fatalf("error on mari range: %s", rangeErr.Error())
+		}
+
+		expKeys := []string{"a", "ab", "abc"}
+		if fmt.Sprint(keys) != fmt.Sprint(expKeys) {
+			t.Errorf("range keys without a start key not equal to expected: actual(%v), expected(%v)", keys, expKeys)
+		}
+
+		keys, rangeErr = rangeKeys([]byte("c"), nil)
+		if rangeErr != nil {
+			t.Fatalf("error on mari range: %s", rangeErr.Error())
+		}
+
+		expKeys = []string{"c", "ca", "cab"}
+		if fmt.Sprint(keys) != fmt.Sprint(expKeys) {
+			t.Errorf("range keys without an end key not equal to expected: actual(%v), expected(%v)", keys, expKeys)
+		}
+
+		keys, rangeErr = rangeKeys(nil, nil)
+		if rangeErr != nil {
+			t.Fatalf("error on mari range: %s", rangeErr.Error())
+		}
+
+		if len(keys) != 8 {
+			t.Errorf("expected every key without bounds: actual(%v)", keys)
+		}
+	})
+	t.Run("Test Iterate Start Keys", func(t *testing.T) {
+		putErr := rangeMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, key := range []string{"kb", "kd", "kda", "xz", "xab", "xyz"} {
+				putTxErr := tx.Put([]byte(key), []byte(key))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		expected := []struct {
+			startKey     []byte
+			totalResults int
+			keys         []string
+		}{
+			{nil, 3, []string{"a", "ab", "abc"}},
+			{[]byte("aa"), 2, []string{"ab", "abc"}},
+			{[]byte("abd"), 3, []string{"b", "ba", "c"}},
+			{[]byte("b"), 5, []string{"b", "ba", "c", "ca", "cab"}},
+			{[]byte("kcz"), 3, []string{"kd", "kda", "xab"}},
+			{[]byte("x"), 3, []string{"xab", "xyz", "xz"}},
+			{[]byte("xb"), 10, []string{"xyz", "xz"}},
+			{[]byte("xz"), 10, []string{"xz"}},
+			{[]byte("xzz"), 10, nil},
+		}
+
+		for _, iterate := range expected {
+			var keys []string
+			readErr := rangeMariInst.ReadTx(func(tx *mariv2.Tx) error {
+				kvPairs, iterateErr := tx.Iterate(iterate.startKey, iterate.totalResults, nil)
+				if iterateErr != nil {
+					return iterateErr
+				}
+
+				for _, kvPair := range kvPairs {
+					keys = append(keys, string(kvPair.Key))
+				}
+
+				return nil
+			})
+
+			if readErr != nil {
+				t.Fatalf("error on mari iterate from %q: %s", iterate.startKey, readErr.Error())
+			}
+
+			if fmt.Sprint(keys) != fmt.Sprint(iterate.keys) {
+				t.Errorf("iterate keys from %q not equal to expected: actual(%v), expected(%v)", iterate.startKey, keys, iterate.keys)
+			}
+		}
+	})
+
+	t.Run("Test Bitmap Positions", func(t *testing.T) {
+		putErr := rangeMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, key := range []string{"\x05", "\x1f", " ", "0", "5x", "9", "?", "@"} {
+				putTxErr := tx.Put([]byte(key), []byte(key))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		expected := map[[2]string][]string{
+			{"0", "9"}:    {"0", "5x"},
+			{" ", "?"}:    {" ", "0", "5x", "9"},
+			{"\x1f", "0"}: {"\x1f", " "},
+			{"?", "a"}:    {"?", "@"},
+		}
+
+		for bounds, expKeys := range expected {
+			keys, rangeErr := rangeKeys([]byte(bounds[0]), []byte(bounds[1]))
+			if rangeErr != nil {
+				t.Fatalf("error on mari range: %s", rangeErr.Error())
+			}
+
+			if fmt.Sprint(keys) != fmt.Sprint(expKeys) {
+				t.Errorf("range keys for %q not equal to expected: actual(%q), expected(%q)", bounds, keys, expKeys)
+			}
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const RANK_INPUT_SIZE = 500
+
+var rankMariInst *mariv2.Mari
+var rankSortedKeys [][]byte
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testrank"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testrank", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	rankMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	keys := make(map[string]bool)
+	for len(keys) < RANK_INPUT_SIZE {
+		key := make([]byte, 1+rand.IntN(6))
+		for idx := range key {
+			key[idx] = "abc"[rand.IntN(3)]
+		}
+
+		keys[string(key)] = true
+	}
+
+	for key := range keys {
+		rankSortedKeys = append(rankSortedKeys, []byte(key))
+	}
+
+	putErr := rankMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for _, key := range rankSortedKeys {
+			putTxErr := tx.Put(key, key)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	sort.Slice(rankSortedKeys, func(i, j int) bool { return bytes.Compare(rankSortedKeys[i], rankSortedKeys[j]) == -1 })
+
+	fmt.Println("rank test mari initialized")
+}
+
+func TestMariRank(t *testing.T) {
+	defer rankMariInst.Remove()
+
+	t.Run("Test Select Nth", func(t *testing.T) {
+		readErr := rankMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for idx, key := range rankSortedKeys {
+				kvPair, selectErr := tx.SelectNth(idx)
+				if selectErr != nil {
+					return selectErr
+				}
+
+				if kvPair == nil || !bytes.Equal(kvPair.Key, key) {
+					t.Fatalf("selected key not equal to expected at %d: actual(%v), expected(%s)", idx, kvPair, key)
+				}
+			}
+
+			kvPair, selectErr := tx.SelectNth(len(rankSortedKeys))
+			if selectErr != nil {
+				return selectErr
+			}
+
+			if kvPair != nil {
+				t.Errorf("expected nil when selecting out of range: actual(%v)", kvPair)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari select nth: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Rank", func(t *testing.T) {
+		readErr := rankMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for idx, key := range rankSortedKeys {
+				rank, rankErr := tx.Rank(key)
+				if rankErr != nil {
+					return rankErr
+				}
+
+				if rank != idx {
+					t.Fatalf("rank of %s not equal to expected: actual(%d), expected(%d)", key, rank, idx)
+				}
+			}
+
+			for _, key := range []string{"", "aaaaaaa", "abcd", "b", "bcbcbcb", "d", "ca"} {
+				expected := sort.Search(len(rankSortedKeys), func(i int) bool {
+					return bytes.Compare(rankSortedKeys[i], []byte(key)) >= 0
+				})
+
+				rank, rankErr := tx.Rank([]byte(key))
+				if rankErr != nil {
+					return rankErr
+				}
+
+				if rank != expected {
+					t.Errorf("rank of %q not equal to expected: actual(%d), expected(%d)", key, rank, expected)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari rank: %s", readErr.Error())
+		}
+	})
+}
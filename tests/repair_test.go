@@ -0,0 +1,187 @@
+package maritests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var repairOpts mariv2.InitOpts
+var repairSourceMariInst *mariv2.Mari
+var repairStaleMariInst *mariv2.Mari
+var repairKeyVal = KeyVal{Key: []byte("repair:key"), Value: []byte("replicated value")}
+
+func init() {
+	for _, fileName := range []string{"testrepair", "testrepairsource", "testrepairstale"} {
+		os.Remove(filepath.Join(os.TempDir(), fileName))
+	}
+
+	valueChecksums := true
+	nodePoolSize := int64(1000)
+	openWith := func(fileName string, value []byte) *mariv2.Mari {
+		mariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: fileName, NodePoolSize: &nodePoolSize, ValueChecksums: &valueChecksums})
+		if openErr != nil {
+			panic(openErr.Error())
+		}
+
+		putErr := mariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(repairKeyVal.Key, value)
+		})
+
+		if putErr != nil {
+			panic(putErr.Error())
+		}
+
+		return mariInst
+	}
+
+	repairSourceMariInst = openWith("testrepairsource", repairKeyVal.Value)
+	repairStaleMariInst = openWith("testrepairstale", []byte("stale value"))
+
+	closeErr := openWith("testrepair", repairKeyVal.Value).Close()
+	if closeErr != nil {
+		panic(closeErr.Error())
+	}
+
+	repairOpts = mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testrepair", NodePoolSize: &nodePoolSize, ValueChecksums: &valueChecksums}
+	fmt.Println("repair test mari initialized")
+}
+
+func TestMariReadRepair(t *testing.T) {
+	defer os.Remove(filepath.Join(os.TempDir(), "testrepair"))
+	defer repairSourceMariInst.Remove()
+	defer repairStaleMariInst.Remove()
+
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("error listening: %s", listenErr.Error())
+	}
+
+	go repairSourceMariInst.ServeReplication(listener)
+	defer listener.Close()
+
+	tcpSource := mariv2.NewTCPRepairSource(listener.Addr().String())
+	defer tcpSource.Close()
+
+	file, openErr := os.OpenFile(filepath.Join(os.TempDir(), "testrepair"), os.O_RDWR, 0600)
+	if openErr != nil {
+		t.Fatalf("error opening file: %s", openErr.Error())
+	}
+
+	sEndSerialized := make([]byte, mariv2.OffsetSize64)
+	_, readErr := file.ReadAt(sEndSerialized, mariv2.MetaEndSerializedOffset)
+	if readErr != nil {
+		t.Fatalf("error reading end of serialized data: %s", readErr.Error())
+	}
+
+	serialized := make([]byte, binary.LittleEndian.Uint64(sEndSerialized))
+	_, readErr = file.ReadAt(serialized, 0)
+	if readErr != nil {
+		t.Fatalf("error reading serialized data: %s", readErr.Error())
+	}
+
+	valueOffset := int64(bytes.LastIndex(serialized, repairKeyVal.Value))
+	_, writeErr := file.WriteAt([]byte{^repairKeyVal.Value[0]}, valueOffset)
+	if writeErr != nil {
+		t.Fatalf("error corrupting value: %s", writeErr.Error())
+	}
+
+	file.Close()
+
+	getVerified := func(mariInst *mariv2.Mari) (*mariv2.KeyValuePair, error) {
+		var kvPair *mariv2.KeyValuePair
+		readErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getErr error
+			kvPair, getErr = tx.GetVerified(repairKeyVal.Key)
+			return getErr
+		})
+
+		return kvPair, readErr
+	}
+
+	t.Run("Test No Matching Source", func(t *testing.T) {
+		opts := repairOpts
+		opts.RepairSources = []mariv2.RepairSource{repairStaleMariInst}
+
+		repairMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer repairMariInst.Close()
+
+		_, getErr := getVerified(repairMariInst)
+		if !errors.Is(getErr, mariv2.ErrChecksumMismatch) {
+			t.Errorf("expected a stale value not to repair the corrupt value: actual(%v)", getErr)
+		}
+	})
+
+	t.Run("Test Repair From Replica", func(t *testing.T) {
+		opts := repairOpts
+		opts.RepairSources = []mariv2.RepairSource{repairStaleMariInst, tcpSource}
+
+		repairMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer repairMariInst.Close()
+
+		kvPair, getErr := getVerified(repairMariInst)
+		if getErr != nil {
+			t.Fatalf("expected the corrupt value to be repaired: actual(%s)", getErr.Error())
+		}
+
+		if !bytes.Equal(kvPair.Value, repairKeyVal.Value) {
+			t.Errorf("expected the value of the replica: actual(%s)", kvPair.Value)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			stats, statsErr := repairMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error getting stats: %s", statsErr.Error())
+			}
+
+			if stats.Version > 1 {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("expected the repaired value to be rewritten")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		kvPair, getErr = getVerified(repairMariInst)
+		if getErr != nil || !bytes.Equal(kvPair.Value, repairKeyVal.Value) {
+			t.Fatalf("expected the rewritten value to match its checksum: actual(%v)", getErr)
+		}
+
+		stats, statsErr := repairMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.ReadRepairs != 1 {
+			t.Errorf("expected one read repair: actual(%d)", stats.ReadRepairs)
+		}
+	})
+
+	t.Run("Test Fetch Missing Key", func(t *testing.T) {
+		kvPair, fetchErr := tcpSource.Fetch(context.Background(), []byte("repair:missing"))
+		if fetchErr != nil || kvPair != nil {
+			t.Errorf("expected a missing key to be fetched as nil: actual(%v, %v)", kvPair, fetchErr)
+		}
+	})
+}
@@ -0,0 +1,403 @@
+package maritests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var replicationMariInst *mariv2.Mari
+var replicaMariInst *mariv2.Mari
+var catchUpMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testreplication"))
+	os.Remove(filepath.Join(os.TempDir(), "testreplica"))
+	os.Remove(filepath.Join(os.TempDir(), "testcatchup"))
+
+	nodePoolSize := int64(1000)
+	follower := true
+
+	var openErr error
+	replicationMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testreplication", NodePoolSize: &nodePoolSize})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	replicaMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testreplica", NodePoolSize: &nodePoolSize, Follower: &follower})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	catchUpMariInst, openErr = mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testcatchup", NodePoolSize: &nodePoolSize, Follower: &follower})
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("replication test mari initialized")
+}
+
+type flakySink struct {
+	lock     sync.Mutex
+	failures int
+	received []uint64
+}
+
+func (sink *flakySink) Receive(ctx context.Context, delta *mariv2.CommitEvent) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.failures > 0 {
+		sink.failures--
+		return errors.New("sink unavailable")
+	}
+
+	sink.received = append(sink.received, delta.Version)
+	return nil
+}
+
+func (sink *flakySink) Close() error {
+	return nil
+}
+
+type interruptedSink struct {
+	replica  *mariv2.Mari
+	lock     sync.Mutex
+	failAt   int
+	chunks   int
+	resumed  []bool
+	received []uint64
+}
+
+func (sink *interruptedSink) Position(ctx context.Context) (*mariv2.ReplicaPosition, error) {
+	return sink.replica.ReplicationPosition()
+}
+
+func (sink *interruptedSink) ReceiveSnapshot(ctx context.Context, chunk *mariv2.SnapshotChunk) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	sink.chunks++
+	if sink.chunks == sink.failAt {
+		return errors.New("transfer interrupted")
+	}
+
+	sink.resumed = append(sink.resumed, chunk.After != nil)
+	return sink.replica.ApplySnapshotChunk(chunk)
+}
+
+func (sink *interruptedSink) Receive(ctx context.Context, delta *mariv2.CommitEvent) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	sink.received = append(sink.received, delta.Version)
+	return sink.replica.ApplyDelta(delta)
+}
+
+func (sink *interruptedSink) Close() error {
+	return nil
+}
+
+func TestMariReplication(t *testing.T) {
+	defer replicationMariInst.Remove()
+	defer replicaMariInst.Remove()
+	defer catchUpMariInst.Remove()
+
+	commit := func(t *testing.T, txOps func(tx *mariv2.Tx) error) uint64 {
+		updateErr := replicationMariInst.UpdateTx(txOps)
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		stats, statsErr := replicationMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		return stats.Version
+	}
+
+	waitReplicated := func(t *testing.T, inst *mariv2.Mari, version uint64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			replicated, replicatedErr := inst.ReplicatedVersion()
+			if replicatedErr != nil {
+				t.Fatalf("error getting replicated version: %s", replicatedErr.Error())
+			}
+
+			if replicated >= version {
+				return
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the replica: actual(%d), expected(%d)", replicated, version)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitAcked := func(t *testing.T, replication *mariv2.Replication, version uint64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for replication.Acked() < version {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the deltas to be acked: actual(%d), expected(%d)", replication.Acked(), version)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	get := func(t *testing.T, inst *mariv2.Mari, key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		readErr := inst.ReadTx(func(tx *mariv2.Tx) error {
+			var getErr error
+			kvPair, getErr = tx.Get(key, nil)
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		return kvPair
+	}
+
+	t.Run("Test TCP Sink", func(t *testing.T) {
+		listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+		if listenErr != nil {
+			t.Fatalf("error listening: %s", listenErr.Error())
+		}
+
+		serveErr := make(chan error, 1)
+		go func() { serveErr <- replicaMariInst.ServeReplication(listener) }()
+
+		replication, replicateErr := replicationMariInst.Replicate(mariv2.NewTCPSink(listener.Addr().String()), mariv2.ReplicationOpts{Cursor: "replica"})
+		if replicateErr != nil {
+			t.Fatalf("error starting replication: %s", replicateErr.Error())
+		}
+
+		commit(t, func(tx *mariv2.Tx) error {
+			for idx := range 10 {
+				putErr := tx.Put([]byte(fmt.Sprintf("replicated:%d", idx)), []byte("v1"))
+				if putErr != nil {
+					return putErr
+				}
+			}
+
+			return nil
+		})
+
+		version := commit(t, func(tx *mariv2.Tx) error {
+			putErr := tx.Put([]byte("replicated:0"), []byte("v2"))
+			if putErr != nil {
+				return putErr
+			}
+
+			return tx.Delete([]byte("replicated:1"))
+		})
+
+		waitReplicated(t, replicaMariInst, version)
+
+		if kvPair := get(t, replicaMariInst, []byte("replicated:0")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v2")) {
+			t.Errorf("expected the put to be replicated: actual(%v)", kvPair)
+		}
+
+		if kvPair := get(t, replicaMariInst, []byte("replicated:1")); kvPair != nil {
+			t.Errorf("expected the delete to be replicated: actual(%s)", kvPair.Value)
+		}
+
+		if kvPair := get(t, replicaMariInst, []byte("replicated:9")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v1")) {
+			t.Errorf("expected the first commit to be replicated: actual(%v)", kvPair)
+		}
+
+		waitAcked(t, replication, version)
+
+		version = commit(t, func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("replicated:delta"), []byte("value"))
+		})
+
+		waitAcked(t, replication, version)
+		if kvPair := get(t, replicaMariInst, []byte("replicated:delta")); kvPair == nil {
+			t.Error("expected the delta after catching up to be replicated")
+		}
+
+		applyErr := replicaMariInst.ApplyDelta(&mariv2.CommitEvent{Version: 1, Timestamp: 1, Changes: []*mariv2.Change{{Key: []byte("replicated:0"), Value: []byte("stale")}}})
+		if applyErr != nil {
+			t.Fatalf("error applying delta: %s", applyErr.Error())
+		}
+
+		if kvPair := get(t, replicaMariInst, []byte("replicated:0")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("v2")) {
+			t.Errorf("expected the stale delta to be skipped: actual(%v)", kvPair)
+		}
+
+		stopErr := replication.Stop()
+		if stopErr != nil {
+			t.Fatalf("error stopping replication: %s", stopErr.Error())
+		}
+
+		listener.Close()
+		if closeErr := <-serveErr; closeErr != nil {
+			t.Fatalf("error serving replication: %s", closeErr.Error())
+		}
+	})
+
+	t.Run("Test Directory Sink", func(t *testing.T) {
+		dir := filepath.Join(os.TempDir(), "testreplicationdir")
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+
+		sink, sinkErr := mariv2.NewDirectorySink(dir)
+		if sinkErr != nil {
+			t.Fatalf("error creating sink: %s", sinkErr.Error())
+		}
+
+		replication, replicateErr := replicationMariInst.Replicate(sink, mariv2.ReplicationOpts{Cursor: "replica"})
+		if replicateErr != nil {
+			t.Fatalf("error starting replication: %s", replicateErr.Error())
+		}
+
+		defer replication.Stop()
+
+		var version uint64
+		for idx := range 3 {
+			version = commit(t, func(tx *mariv2.Tx) error {
+				return tx.Put([]byte(fmt.Sprintf("shipped:%d", idx)), []byte("value"))
+			})
+		}
+
+		waitAcked(t, replication, version)
+
+		applied, applyErr := replicaMariInst.ApplyDirectory(dir)
+		if applyErr != nil {
+			t.Fatalf("error applying directory: %s", applyErr.Error())
+		}
+
+		if applied != 3 {
+			t.Errorf("expected every shipped delta to be applied: actual(%d), expected(3)", applied)
+		}
+
+		waitReplicated(t, replicaMariInst, version)
+		if kvPair := get(t, replicaMariInst, []byte("shipped:2")); kvPair == nil {
+			t.Error("expected the shipped delta to be applied")
+		}
+
+		applied, applyErr = replicaMariInst.ApplyDirectory(dir)
+		if applyErr != nil {
+			t.Fatalf("error applying directory: %s", applyErr.Error())
+		}
+
+		if applied != 0 {
+			t.Errorf("expected applied deltas to be skipped: actual(%d)", applied)
+		}
+	})
+
+	t.Run("Test Sink Retry", func(t *testing.T) {
+		retryInterval := 10 * time.Millisecond
+		sink := &flakySink{failures: 3}
+		replication, replicateErr := replicationMariInst.Replicate(sink, mariv2.ReplicationOpts{RetryInterval: &retryInterval})
+		if replicateErr != nil {
+			t.Fatalf("error starting replication: %s", replicateErr.Error())
+		}
+
+		var versions []uint64
+		for idx := range 3 {
+			versions = append(versions, commit(t, func(tx *mariv2.Tx) error {
+				return tx.Put([]byte(fmt.Sprintf("retried:%d", idx)), []byte("value"))
+			}))
+		}
+
+		waitAcked(t, replication, versions[len(versions)-1])
+
+		stopErr := replication.Stop()
+		if stopErr != nil {
+			t.Fatalf("error stopping replication: %s", stopErr.Error())
+		}
+
+		sink.lock.Lock()
+		defer sink.lock.Unlock()
+
+		if fmt.Sprint(sink.received) != fmt.Sprint(versions) {
+			t.Errorf("expected every delta once and in order: actual(%v), expected(%v)", sink.received, versions)
+		}
+	})
+
+	t.Run("Test Catch Up Snapshot", func(t *testing.T) {
+		applyErr := catchUpMariInst.ApplyDelta(&mariv2.CommitEvent{Version: 1, Timestamp: 1, Changes: []*mariv2.Change{{Key: []byte("snapshot:stale"), Value: []byte("value")}}})
+		if applyErr != nil {
+			t.Fatalf("error applying delta: %s", applyErr.Error())
+		}
+
+		snapshotVersion := commit(t, func(tx *mariv2.Tx) error {
+			for idx := range 7 {
+				putErr := tx.Put([]byte(fmt.Sprintf("snapshot:%d", idx)), []byte("value"))
+				if putErr != nil {
+					return putErr
+				}
+			}
+
+			return nil
+		})
+
+		retryInterval := 10 * time.Millisecond
+		sink := &interruptedSink{replica: catchUpMariInst, failAt: 3}
+		replication, replicateErr := replicationMariInst.Replicate(sink, mariv2.ReplicationOpts{Prefix: []byte("snapshot:"), RetryInterval: &retryInterval, SnapshotChunkSize: 2})
+		if replicateErr != nil {
+			t.Fatalf("error starting replication: %s", replicateErr.Error())
+		}
+
+		defer replication.Stop()
+
+		waitReplicated(t, catchUpMariInst, snapshotVersion)
+
+		sink.lock.Lock()
+		resumed := fmt.Sprint(sink.resumed)
+		sink.lock.Unlock()
+
+		if resumed != "[false true true true]" {
+			t.Errorf("expected the interrupted transfer to resume after the last chunk applied: actual(%s)", resumed)
+		}
+
+		if kvPair := get(t, catchUpMariInst, []byte("snapshot:stale")); kvPair != nil {
+			t.Errorf("expected the snapshot to delete keys the leader does not have: actual(%s)", kvPair.Value)
+		}
+
+		for idx := range 7 {
+			if kvPair := get(t, catchUpMariInst, []byte(fmt.Sprintf("snapshot:%d", idx))); kvPair == nil {
+				t.Errorf("expected snapshot:%d to be sent in the snapshot", idx)
+			}
+		}
+
+		version := commit(t, func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("snapshot:delta"), []byte("value"))
+		})
+
+		waitAcked(t, replication, version)
+		if kvPair := get(t, catchUpMariInst, []byte("snapshot:delta")); kvPair == nil {
+			t.Error("expected the delta after the snapshot to be replicated")
+		}
+
+		position, positionErr := catchUpMariInst.ReplicationPosition()
+		if positionErr != nil {
+			t.Fatalf("error getting replication position: %s", positionErr.Error())
+		}
+
+		if position.Version != version || position.SnapshotVersion != 0 {
+			t.Errorf("expected the replica to be positioned after the delta: actual(%+v), expected(%d)", position, version)
+		}
+
+		corruptErr := catchUpMariInst.ApplySnapshotChunk(&mariv2.SnapshotChunk{Version: version, Timestamp: 1, Pairs: []*mariv2.KeyValuePair{{Key: []byte("snapshot:0"), Value: []byte("corrupt")}}, Checksum: 1})
+		if !errors.Is(corruptErr, mariv2.ErrSnapshotChecksum) {
+			t.Errorf("expected a chunk that does not match its checksum to be rejected: actual(%v)", corruptErr)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var reservedMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testreserved"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testreserved", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	reservedMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("reserved test mari initialized")
+}
+
+func TestMariReserved(t *testing.T) {
+	defer reservedMariInst.Remove()
+
+	userKeys := [][]byte{{0}, []byte("a"), []byte("b"), []byte("c")}
+	putErr := reservedMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for _, key := range userKeys {
+			putTxErr := tx.PutWithTTL(key, []byte("value"), time.Hour)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put with ttl: %s", putErr.Error())
+	}
+
+	keys := func(kvPairs []*mariv2.KeyValuePair) [][]byte {
+		var scanned [][]byte
+		for _, kvPair := range kvPairs {
+			scanned = append(scanned, kvPair.Key)
+		}
+
+		return scanned
+	}
+
+	t.Run("Test Reject Reserved Writes", func(t *testing.T) {
+		reservedKey := append(bytes.Clone(mariv2.ReservedKeyPrefix), []byte("user")...)
+
+		writes := map[string]func(tx *mariv2.Tx) error{
+			"put":          func(tx *mariv2.Tx) error { return tx.Put(reservedKey, []byte("value")) },
+			"put with ttl": func(tx *mariv2.Tx) error { return tx.PutWithTTL(reservedKey, []byte("value"), time.Hour) },
+			"delete":       func(tx *mariv2.Tx) error { return tx.Delete(reservedKey) },
+		}
+
+		for name, write := range writes {
+			if writeErr := reservedMariInst.UpdateTx(write); !errors.Is(writeErr, mariv2.ErrReservedKey) {
+				t.Errorf("expected error on %s of a reserved key: actual(%v)", name, writeErr)
+			}
+		}
+	})
+
+	t.Run("Test Exclude Reserved Keys", func(t *testing.T) {
+		readErr := reservedMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, iterErr := tx.Iterate(nil, 3, nil)
+			if iterErr != nil {
+				return iterErr
+			}
+
+			if !slices.EqualFunc(keys(kvPairs), userKeys[:3], bytes.Equal) {
+				return fmt.Errorf("expected iterate to skip the reserved keys: actual(%q)", keys(kvPairs))
+			}
+
+			kvPairs, iterErr = tx.Iterate(mariv2.ReservedKeyPrefix, 2, nil)
+			if iterErr != nil {
+				return iterErr
+			}
+
+			if !slices.EqualFunc(keys(kvPairs), userKeys[1:3], bytes.Equal) {
+				return fmt.Errorf("expected iterate from a reserved key to start after the reserved keys: actual(%q)", keys(kvPairs))
+			}
+
+			kvPairs, rangeErr := tx.Range(nil, nil, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if !slices.EqualFunc(keys(kvPairs), userKeys, bytes.Equal) {
+				return fmt.Errorf("expected range to exclude the reserved keys: actual(%q)", keys(kvPairs))
+			}
+
+			includeReserved := true
+			kvPairs, rangeErr = tx.Range(nil, nil, &mariv2.RangeOpts{IncludeReserved: &includeReserved})
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) <= len(userKeys) || !bytes.HasPrefix(kvPairs[1].Key, mariv2.ReservedKeyPrefix) {
+				return fmt.Errorf("expected range to include the reserved keys when requested: actual(%q)", keys(kvPairs))
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+
+		iter, iterErr := reservedMariInst.NewIterator(nil, nil)
+		if iterErr != nil {
+			t.Fatalf("error on mari new iterator: %s", iterErr.Error())
+		}
+
+		defer iter.Close()
+
+		var iterated [][]byte
+		for iter.Next() {
+			iterated = append(iterated, iter.KeyValue().Key)
+		}
+
+		if iter.Err() != nil || !slices.EqualFunc(iterated, userKeys, bytes.Equal) {
+			t.Errorf("expected the iterator to skip the reserved keys: %v, %q", iter.Err(), iterated)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const SAMPLE_INPUT_SIZE = 100
+
+var sampleMariInst *mariv2.Mari
+var sampleKeyValPairs map[string][]byte
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testsample"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testsample", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	sampleMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	sampleKeyValPairs = make(map[string][]byte)
+	putErr := sampleMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for range SAMPLE_INPUT_SIZE {
+			randomBytes, _ := GenerateRandomBytes(32)
+			sampleKeyValPairs[string(randomBytes)] = randomBytes
+
+			putTxErr := tx.Put(randomBytes, randomBytes)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("sample test mari initialized")
+}
+
+func TestMariSample(t *testing.T) {
+	defer sampleMariInst.Remove()
+
+	sample := func(n int) []*mariv2.KeyValuePair {
+		var kvPairs []*mariv2.KeyValuePair
+		sampleErr := sampleMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var sampleTxErr error
+			kvPairs, sampleTxErr = tx.Sample(n)
+			return sampleTxErr
+		})
+
+		if sampleErr != nil {
+			t.Fatalf("error on mari sample: %s", sampleErr.Error())
+		}
+		return kvPairs
+	}
+
+	t.Run("Test Sample Distinct Keys", func(t *testing.T) {
+		kvPairs := sample(10)
+		if len(kvPairs) != 10 {
+			t.Errorf("expected 10 sampled keys: actual(%d)", len(kvPairs))
+		}
+
+		seen := make(map[string]bool)
+		for _, kvPair := range kvPairs {
+			value, ok := sampleKeyValPairs[string(kvPair.Key)]
+			if !ok || !bytes.Equal(value, kvPair.Value) {
+				t.Fatalf("sampled key value pair not in input: %v", kvPair)
+			}
+
+			if seen[string(kvPair.Key)] {
+				t.Fatalf("sampled key returned more than once: %v", kvPair)
+			}
+			seen[string(kvPair.Key)] = true
+		}
+	})
+
+	t.Run("Test Sample More Than Total Keys", func(t *testing.T) {
+		kvPairs := sample(2 * SAMPLE_INPUT_SIZE)
+		if len(kvPairs) > SAMPLE_INPUT_SIZE {
+			t.Errorf("sampled more keys than exist: actual(%d)", len(kvPairs))
+		}
+	})
+
+	t.Run("Test Sample Coverage", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for range 100 {
+			for _, kvPair := range sample(10) {
+				seen[string(kvPair.Key)] = true
+			}
+		}
+
+		t.Logf("distinct keys sampled: %d", len(seen))
+		if len(seen) < SAMPLE_INPUT_SIZE/2 {
+			t.Errorf("expected samples to cover most keys: actual(%d)", len(seen))
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package maritests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const SCAN_INPUT_SIZE = 5000
+
+var scanMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testscan"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testscan",
+		NodePoolSize: &nodePoolSize,
+	}
+
+	var openErr error
+	scanMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	putErr := scanMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range SCAN_INPUT_SIZE {
+			putTxErr := tx.Put([]byte(fmt.Sprintf("scan:%05d", idx)), []byte(fmt.Sprintf("value %d", idx)))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		for _, key := range []string{"nested", "nested:a", "nested:ab", "nested:abc", "nested:b"} {
+			putTxErr := tx.Put([]byte(key), []byte(key))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("scan test mari initialized")
+}
+
+func TestMariScanChunks(t *testing.T) {
+	defer scanMariInst.Remove()
+
+	checkKeys := func(t *testing.T, kvPairs []*mariv2.KeyValuePair, expected []string) {
+		if len(kvPairs) != len(expected) {
+			t.Fatalf("expected %d results: actual(%d)", len(expected), len(kvPairs))
+		}
+
+		for idx, kvPair := range kvPairs {
+			if !bytes.Equal(kvPair.Key, []byte(expected[idx])) {
+				t.Fatalf("expected key %s at %d: actual(%s)", expected[idx], idx, kvPair.Key)
+			}
+		}
+	}
+
+	scanKeys := func(from, to int) []string {
+		var keys []string
+		for idx := from; idx <= to; idx++ {
+			keys = append(keys, fmt.Sprintf("scan:%05d", idx))
+		}
+
+		return keys
+	}
+
+	t.Run("Test Range Chunks", func(t *testing.T) {
+		for _, chunkSize := range []int{1, 7, 64, 100000} {
+			var kvPairs []*mariv2.KeyValuePair
+			readErr := scanMariInst.ReadTx(func(tx *mariv2.Tx) error {
+				var rangeErr error
+				kvPairs, rangeErr = tx.Range([]byte("scan:00100"), []byte("scan:04322"), &mariv2.RangeOpts{ChunkSize: &chunkSize})
+				return rangeErr
+			})
+
+			if readErr != nil {
+				t.Fatalf("error on mari range: %s", readErr.Error())
+			}
+
+			checkKeys(t, kvPairs, scanKeys(100, 4321))
+		}
+	})
+
+	t.Run("Test Range Chunks Nested Keys", func(t *testing.T) {
+		chunkSize := 1
+		var kvPairs []*mariv2.KeyValuePair
+		readErr := scanMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var rangeErr error
+			kvPairs, rangeErr = tx.Range([]byte("nested"), []byte("nested:abc"), &mariv2.RangeOpts{ChunkSize: &chunkSize})
+			return rangeErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari range: %s", readErr.Error())
+		}
+
+		checkKeys(t, kvPairs, []string{"nested", "nested:a", "nested:ab"})
+	})
+
+	t.Run("Test Shared Buffers", func(t *testing.T) {
+		sharedBuffers := true
+		var kvPairs, iterKvPairs []*mariv2.KeyValuePair
+		readErr := scanMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var rangeErr error
+			kvPairs, rangeErr = tx.Range([]byte("nested"), []byte("nested:b"), &mariv2.RangeOpts{SharedBuffers: &sharedBuffers})
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			iterKvPairs, rangeErr = tx.Iterate([]byte("scan:00000"), 1000, &mariv2.RangeOpts{SharedBuffers: &sharedBuffers})
+			return rangeErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari range: %s", readErr.Error())
+		}
+
+		expected := []string{"nested", "nested:a", "nested:ab", "nested:abc"}
+		checkKeys(t, kvPairs, expected)
+		for idx, kvPair := range kvPairs {
+			if !bytes.Equal(kvPair.Value, []byte(expected[idx])) {
+				t.Errorf("expected value %s at %d: actual(%s)", expected[idx], idx, kvPair.Value)
+			}
+		}
+
+		if &kvPairs[0].Key[0] != &kvPairs[2].Key[0] || &kvPairs[1].Key[0] != &kvPairs[2].Key[0] {
+			t.Error("expected keys that are prefixes of the key copied with them to share its bytes")
+		}
+
+		checkKeys(t, iterKvPairs, scanKeys(0, 999))
+		for idx, kvPair := range iterKvPairs {
+			if !bytes.Equal(kvPair.Value, []byte(fmt.Sprintf("value %d", idx))) {
+				t.Fatalf("expected value %d at %d: actual(%s)", idx, idx, kvPair.Value)
+			}
+		}
+	})
+
+	t.Run("Test Iterate Chunks", func(t *testing.T) {
+		chunkSize := 3
+		var kvPairs []*mariv2.KeyValuePair
+		readErr := scanMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var iterErr error
+			kvPairs, iterErr = tx.Iterate([]byte("scan:04990"), 100, &mariv2.RangeOpts{ChunkSize: &chunkSize})
+			return iterErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari iterate: %s", readErr.Error())
+		}
+
+		checkKeys(t, kvPairs, scanKeys(4990, 4999))
+	})
+
+	t.Run("Test Scan Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		readErr := scanMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, rangeErr := tx.Range(nil, nil, &mariv2.RangeOpts{Context: ctx})
+			if !errors.Is(rangeErr, context.Canceled) {
+				return fmt.Errorf("expected the range to be canceled: actual(%v)", rangeErr)
+			}
+
+			_, iterErr := tx.Iterate(nil, SCAN_INPUT_SIZE, &mariv2.RangeOpts{Context: ctx})
+			if !errors.Is(iterErr, context.Canceled) {
+				return fmt.Errorf("expected the iteration to be canceled: actual(%v)", iterErr)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatal(readErr.Error())
+		}
+	})
+}
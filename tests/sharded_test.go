@@ -0,0 +1,147 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+	"github.com/sirgallo/mariv2/sharded"
+)
+
+const SHARDED_INPUT_SIZE = 10000
+const SHARDED_SHARD_COUNT = 4
+
+var shardedInst *sharded.Sharded
+var shardedKeyValPairs []KeyVal
+
+func init() {
+	for idx := range make([]int, SHARDED_SHARD_COUNT+1) {
+		os.Remove(filepath.Join(os.TempDir(), fmt.Sprintf("testsharded-%d", idx)))
+	}
+
+	var initShardedErr error
+	nodePoolSize := int64(1000)
+	opts := sharded.InitOpts{
+		Filepath:  os.TempDir(),
+		FileName:  "testsharded",
+		Shards:    SHARDED_SHARD_COUNT,
+		ShardOpts: &mariv2.InitOpts{NodePoolSize: &nodePoolSize},
+	}
+
+	shardedInst, initShardedErr = sharded.Open(opts)
+	if initShardedErr != nil {
+		panic(initShardedErr.Error())
+	}
+
+	shardedKeyValPairs = make([]KeyVal, SHARDED_INPUT_SIZE)
+	for idx := range shardedKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		shardedKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("sharded test mari initialized")
+}
+
+func TestMariSharded(t *testing.T) {
+	defer shardedInst.Remove()
+
+	t.Run("Test Sharded Put", func(t *testing.T) {
+		for _, val := range shardedKeyValPairs {
+			putErr := shardedInst.Put(val.Key, val.Value)
+			if putErr != nil {
+				t.Errorf("error on sharded put: %s", putErr.Error())
+			}
+		}
+	})
+
+	t.Run("Test Sharded Get", func(t *testing.T) {
+		for _, val := range shardedKeyValPairs {
+			kvPair, getErr := shardedInst.Get(val.Key, nil)
+			if getErr != nil {
+				t.Errorf("error on sharded get: %s", getErr.Error())
+			}
+
+			if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+				t.Errorf("actual value not equal to expected: actual(%v), expected(%v)", kvPair, val)
+			}
+		}
+	})
+
+	t.Run("Test Sharded Routing Is Stable", func(t *testing.T) {
+		for _, val := range shardedKeyValPairs[:100] {
+			idx := shardedInst.ShardFor(val.Key)
+			if idx < 0 || idx >= SHARDED_SHARD_COUNT {
+				t.Errorf("shard index out of bounds: %d", idx)
+			}
+
+			if idx != shardedInst.ShardFor(val.Key) {
+				t.Errorf("shard routing changed for key %s", val.Key)
+			}
+		}
+	})
+
+	t.Run("Test Sharded Iterate", func(t *testing.T) {
+		kvPairs, iterErr := shardedInst.Iterate([]byte("0"), SHARDED_INPUT_SIZE/2, nil)
+		if iterErr != nil {
+			t.Errorf("error on sharded iterate: %s", iterErr.Error())
+		}
+
+		if len(kvPairs) != SHARDED_INPUT_SIZE/2 {
+			t.Errorf("iterate returned incorrect total: actual(%d), expected(%d)", len(kvPairs), SHARDED_INPUT_SIZE/2)
+		}
+
+		if !IsSorted(kvPairs) {
+			t.Error("key value pairs are not in sorted order")
+		}
+	})
+
+	t.Run("Test Sharded Range", func(t *testing.T) {
+		kvPairs, rangeErr := shardedInst.Range([]byte("0"), []byte("z"), nil)
+		if rangeErr != nil {
+			t.Errorf("error on sharded range: %s", rangeErr.Error())
+		}
+
+		if !IsSorted(kvPairs) {
+			t.Error("key value pairs are not in sorted order")
+		}
+		t.Log("total elements returned on range:", len(kvPairs))
+	})
+
+	t.Run("Test Sharded Stats", func(t *testing.T) {
+		stats, statsErr := shardedInst.Stats()
+		if statsErr != nil {
+			t.Errorf("error on sharded stats: %s", statsErr.Error())
+		}
+
+		if stats.TotalVersion != SHARDED_INPUT_SIZE {
+			t.Errorf("total version does not match total commits: actual(%d), expected(%d)", stats.TotalVersion, SHARDED_INPUT_SIZE)
+		}
+
+		for idx, shardStats := range stats.Shards {
+			if shardStats.Version == 0 {
+				t.Errorf("shard %d did not receive any writes", idx)
+			}
+		}
+	})
+
+	t.Run("Test Sharded Delete", func(t *testing.T) {
+		for _, val := range shardedKeyValPairs {
+			delErr := shardedInst.Delete(val.Key)
+			if delErr != nil {
+				t.Errorf("error on sharded delete: %s", delErr.Error())
+			}
+		}
+
+		kvPair, getErr := shardedInst.Get(shardedKeyValPairs[0].Key, nil)
+		if getErr != nil {
+			t.Errorf("error on sharded get: %s", getErr.Error())
+		}
+
+		if kvPair != nil {
+			t.Errorf("key still exists after delete: %v", kvPair)
+		}
+	})
+}
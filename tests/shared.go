@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"errors"
 	mrand "math/rand"
+	"sync"
 
 	"github.com/sirgallo/mariv2"
 )
@@ -21,6 +22,24 @@ const READ_CHUNK_SIZE = INPUT_SIZE / NUM_READER_GO_ROUTINES
 const PCHUNK_SIZE_READ = (INPUT_SIZE - PWRITE_INPUT_SIZE) / NUM_READER_GO_ROUTINES
 const PCHUNK_SIZE_WRITE = PWRITE_INPUT_SIZE / NUM_WRITER_GO_ROUTINES
 
+// SyncBuffer is a buffer that can be written by a logger while being read by a test
+type SyncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (buf *SyncBuffer) Write(p []byte) (int, error) {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+	return buf.buf.Write(p)
+}
+
+func (buf *SyncBuffer) String() string {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+	return buf.buf.String()
+}
+
 type KeyVal struct {
 	Key   []byte
 	Value []byte
@@ -0,0 +1,213 @@
+package maritests
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const SPACE_INPUT_SIZE = 1000
+const SPACE_UPDATE_CHUNKS = 10
+
+var spaceMariInst *mariv2.Mari
+var spaceKeyValPairs []KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testspace"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testspace",
+		NodePoolSize: &nodePoolSize,
+	}
+
+	var openErr error
+	spaceMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	spaceKeyValPairs = make([]KeyVal, SPACE_INPUT_SIZE)
+	putErr := spaceMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range spaceKeyValPairs {
+			randomBytes, _ := GenerateRandomBytes(32)
+			spaceKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+
+			putTxErr := tx.Put(randomBytes, randomBytes)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("space test mari initialized")
+}
+
+func TestMariSpaceReport(t *testing.T) {
+	defer spaceMariInst.Remove()
+
+	checkReport := func(t *testing.T, report *mariv2.SpaceReport) {
+		if report.MetaBytes+report.LiveBytes+report.DeadBytes != report.SerializedBytes {
+			t.Errorf("expected meta, live, and dead bytes to equal the serialized bytes: meta(%d), live(%d), dead(%d), serialized(%d)", report.MetaBytes, report.LiveBytes, report.DeadBytes, report.SerializedBytes)
+		}
+
+		if report.SerializedBytes+report.FreeBytes != report.FileSize {
+			t.Errorf("expected serialized and free bytes to equal the file size: serialized(%d), free(%d), file size(%d)", report.SerializedBytes, report.FreeBytes, report.FileSize)
+		}
+
+		var regionLive, regionLength uint64
+		for _, region := range report.Regions {
+			regionLive += region.LiveBytes
+			regionLength += region.Length
+		}
+
+		if regionLive != report.LiveBytes || regionLength != report.SerializedBytes-report.MetaBytes {
+			t.Errorf("expected regions to cover the serialized data: region live(%d), region length(%d)", regionLive, regionLength)
+		}
+	}
+
+	var initialReport *mariv2.SpaceReport
+
+	t.Run("Test Space Report", func(t *testing.T) {
+		var reportErr error
+		initialReport, reportErr = spaceMariInst.SpaceReport()
+		if reportErr != nil {
+			t.Fatalf("error getting space report: %s", reportErr.Error())
+		}
+
+		checkReport(t, initialReport)
+
+		if initialReport.LiveNodes < 2*SPACE_INPUT_SIZE {
+			t.Errorf("expected an internal node and a leaf for each key: actual(%d)", initialReport.LiveNodes)
+		}
+
+		t.Logf("live(%d), dead(%d), fragmentation(%f), regions(%d)", initialReport.LiveBytes, initialReport.DeadBytes, initialReport.Fragmentation, len(initialReport.Regions))
+	})
+
+	t.Run("Test Allocated Size", func(t *testing.T) {
+		stats, statsErr := spaceMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.AllocatedSize == 0 || stats.AllocatedSize > stats.FileSize {
+			t.Errorf("expected the allocated size to be at most the file size: allocated(%d), file size(%d)", stats.AllocatedSize, stats.FileSize)
+		}
+
+		t.Logf("file size(%d), allocated(%d)", stats.FileSize, stats.AllocatedSize)
+	})
+
+	t.Run("Test Space Report After Updates", func(t *testing.T) {
+		chunks, chunkErr := Chunk(spaceKeyValPairs, SPACE_INPUT_SIZE/SPACE_UPDATE_CHUNKS)
+		if chunkErr != nil {
+			t.Fatalf("error chunking key value pairs: %s", chunkErr.Error())
+		}
+
+		for _, chunk := range chunks {
+			putErr := spaceMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				for _, val := range chunk {
+					updated, _ := GenerateRandomBytes(len(val.Value))
+					putTxErr := tx.Put(val.Key, updated)
+					if putTxErr != nil {
+						return putTxErr
+					}
+				}
+
+				return nil
+			})
+
+			if putErr != nil {
+				t.Fatalf("error updating keys: %s", putErr.Error())
+			}
+		}
+
+		report, reportErr := spaceMariInst.SpaceReport()
+		if reportErr != nil {
+			t.Fatalf("error getting space report: %s", reportErr.Error())
+		}
+
+		checkReport(t, report)
+
+		if report.LiveBytes != initialReport.LiveBytes {
+			t.Errorf("expected values of the same length to keep the live bytes: initial(%d), actual(%d)", initialReport.LiveBytes, report.LiveBytes)
+		}
+
+		if report.DeadBytes <= initialReport.DeadBytes || report.Fragmentation <= initialReport.Fragmentation {
+			t.Errorf("expected dead bytes from the old versions: initial(%d), actual(%d)", initialReport.DeadBytes, report.DeadBytes)
+		}
+
+		t.Logf("live(%d), dead(%d), fragmentation(%f), regions(%d)", report.LiveBytes, report.DeadBytes, report.Fragmentation, len(report.Regions))
+	})
+
+	t.Run("Test Estimate Compaction", func(t *testing.T) {
+		report, reportErr := spaceMariInst.SpaceReport()
+		if reportErr != nil {
+			t.Fatalf("error getting space report: %s", reportErr.Error())
+		}
+
+		estimate, estimateErr := spaceMariInst.EstimateCompaction()
+		if estimateErr != nil {
+			t.Fatalf("error estimating compaction: %s", estimateErr.Error())
+		}
+
+		if estimate.Version != report.Version || estimate.SerializedBytes != report.SerializedBytes {
+			t.Errorf("expected the estimate of the latest version: estimate(%+v), report(%+v)", estimate, report)
+		}
+
+		if estimate.SampledFraction <= 0 || estimate.SampledFraction >= 1 {
+			t.Errorf("expected the subtrees below the root to be sampled: actual(%f)", estimate.SampledFraction)
+		}
+
+		if math.Abs(float64(estimate.LiveBytes)-float64(report.LiveBytes)) > 0.25*float64(report.LiveBytes) {
+			t.Errorf("expected estimated live bytes near the actual live bytes: estimate(%d), actual(%d)", estimate.LiveBytes, report.LiveBytes)
+		}
+
+		if estimate.ReclaimedBytes == 0 || estimate.Duration <= 0 {
+			t.Errorf("expected reclaimed bytes and a duration: %+v", estimate)
+		}
+
+		t.Logf("estimated live(%d), actual live(%d), reclaimed(%d), duration(%s)", estimate.LiveBytes, report.LiveBytes, estimate.ReclaimedBytes, estimate.Duration)
+
+		smallMariInst, openErr := mariv2.OpenTemp("testestimate")
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer smallMariInst.Close()
+
+		for range 3 {
+			putErr := smallMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				return tx.Put([]byte("estimate"), []byte("value"))
+			})
+
+			if putErr != nil {
+				t.Fatalf("error on mari put: %s", putErr.Error())
+			}
+		}
+
+		report, reportErr = smallMariInst.SpaceReport()
+		if reportErr != nil {
+			t.Fatalf("error getting space report: %s", reportErr.Error())
+		}
+
+		estimate, estimateErr = smallMariInst.EstimateCompaction()
+		if estimateErr != nil {
+			t.Fatalf("error estimating compaction: %s", estimateErr.Error())
+		}
+
+		if estimate.SampledFraction != 1 || estimate.LiveBytes != report.LiveBytes || estimate.LiveNodes != report.LiveNodes || estimate.ReclaimedBytes != report.DeadBytes {
+			t.Errorf("expected an exact estimate when every subtree is walked: estimate(%+v), report(%+v)", estimate, report)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package maritests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+	"github.com/sirgallo/mariv2/sqladapter"
+)
+
+var sqlMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testsqladapter"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testsqladapter", NodePoolSize: &nodePoolSize}
+
+	var openErr error
+	sqlMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	for _, prefix := range []string{"order", "user"} {
+		putErr := sqlMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for idx := range 10 {
+				putTxErr := tx.Put([]byte(fmt.Sprintf("%s:%02d", prefix, idx)), []byte(fmt.Sprintf("%s value %d", prefix, idx)))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			panic(putErr.Error())
+		}
+	}
+
+	fmt.Println("sql adapter test mari initialized")
+}
+
+func TestMariSQLAdapter(t *testing.T) {
+	defer sqlMariInst.Remove()
+
+	db := sqladapter.Open(sqlMariInst)
+	defer db.Close()
+
+	queryKeys := func(t *testing.T, statement string, args ...any) []string {
+		rows, queryErr := db.Query(statement, args...)
+		if queryErr != nil {
+			t.Fatalf("error on query %q: %s", statement, queryErr.Error())
+		}
+
+		defer rows.Close()
+
+		var keys []string
+		for rows.Next() {
+			var key []byte
+			scanErr := rows.Scan(&key)
+			if scanErr != nil {
+				t.Fatalf("error scanning row: %s", scanErr.Error())
+			}
+
+			keys = append(keys, string(key))
+		}
+
+		if rowsErr := rows.Err(); rowsErr != nil {
+			t.Fatalf("error reading rows: %s", rowsErr.Error())
+		}
+
+		return keys
+	}
+
+	t.Run("Test Select Columns", func(t *testing.T) {
+		var key, value []byte
+		var version, timestamp int64
+		scanErr := db.QueryRow("SELECT * FROM mari WHERE key = ?", "user:03").Scan(&key, &value, &version, &timestamp)
+		if scanErr != nil {
+			t.Fatalf("error on query: %s", scanErr.Error())
+		}
+
+		if string(key) != "user:03" || string(value) != "user value 3" || version != 2 || timestamp == 0 {
+			t.Errorf("unexpected row: key(%s), value(%s), version(%d), timestamp(%d)", key, value, version, timestamp)
+		}
+	})
+
+	t.Run("Test Key Range Pushdown", func(t *testing.T) {
+		if keys := queryKeys(t, "select key from mari where key > ? and key <= ?", "order:07", "user:01"); !slices.Equal(keys, []string{"order:08", "order:09", "user:00", "user:01"}) {
+			t.Errorf("unexpected keys for exclusive and inclusive bounds: %v", keys)
+		}
+
+		if keys := queryKeys(t, "select key from mari where key between 'user:02' and 'user:04'"); !slices.Equal(keys, []string{"user:02", "user:03", "user:04"}) {
+			t.Errorf("unexpected keys for between: %v", keys)
+		}
+
+		if keys := queryKeys(t, "select key from mari where key like ? limit 3", "user:%"); !slices.Equal(keys, []string{"user:00", "user:01", "user:02"}) {
+			t.Errorf("unexpected keys for like with limit: %v", keys)
+		}
+
+		if keys := queryKeys(t, "select key from mari where key > 'user' and key < 'order'"); len(keys) != 0 {
+			t.Errorf("expected no keys for an empty range: %v", keys)
+		}
+	})
+
+	t.Run("Test Version Filter", func(t *testing.T) {
+		keys := queryKeys(t, "select key from mari where version >= 2 and key < ?;", []byte("user:02"))
+		if !slices.Equal(keys, []string{"user:00", "user:01"}) {
+			t.Errorf("unexpected keys for version filter: %v", keys)
+		}
+
+		var count int
+		rows, queryErr := db.Query("select version from mari where version = ?", 1)
+		if queryErr != nil {
+			t.Fatalf("error on query: %s", queryErr.Error())
+		}
+
+		for rows.Next() {
+			count++
+		}
+
+		rows.Close()
+		if count != 10 {
+			t.Errorf("expected the keys of the first version: actual(%d)", count)
+		}
+	})
+
+	t.Run("Test Read Only And Syntax Errors", func(t *testing.T) {
+		_, execErr := db.Exec("select key from mari")
+		if !errors.Is(execErr, sqladapter.ErrReadOnly) {
+			t.Errorf("expected read only error, got: %v", execErr)
+		}
+
+		for _, statement := range []string{
+			"delete from mari",
+			"select key from users",
+			"select missing from mari",
+			"select key from mari where value = 'x'",
+			"select key from mari where key like 'a%b'",
+			"select key from mari where version like 1",
+			"select key from mari limit -1",
+		} {
+			_, queryErr := db.Query(statement)
+			if !errors.Is(queryErr, sqladapter.ErrSyntax) && !errors.Is(queryErr, sqladapter.ErrArgument) {
+				t.Errorf("expected error for %q, got: %v", statement, queryErr)
+			}
+		}
+
+		_, queryErr := db.Query("select key from mari where version > ?", "one")
+		if !errors.Is(queryErr, sqladapter.ErrArgument) {
+			t.Errorf("expected argument error, got: %v", queryErr)
+		}
+	})
+}
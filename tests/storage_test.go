@@ -0,0 +1,247 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var storageMariInst *mariv2.Mari
+var storageMetrics mariv2.StorageMetrics
+var storageFaultWrites atomic.Bool
+var errStorageFault = errors.New("injected write fault")
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "teststorage"))
+
+	nodePoolSize := int64(1000)
+	injectFault := func(op mariv2.StorageOp, offset, length uint64) error {
+		if op == mariv2.StorageOpWrite && storageFaultWrites.Load() {
+			return errStorageFault
+		}
+
+		return nil
+	}
+
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "teststorage",
+		NodePoolSize: &nodePoolSize,
+		Storage: []mariv2.StorageMiddleware{
+			mariv2.LatencyStorage(0, time.Microsecond, 0),
+			mariv2.FaultStorage(injectFault),
+			mariv2.MetricsStorage(&storageMetrics),
+		},
+	}
+
+	var openErr error
+	storageMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("storage test mari initialized")
+}
+
+func TestMariStorage(t *testing.T) {
+	get := func(t *testing.T, inst *mariv2.Mari, key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		readErr := inst.ReadTx(func(tx *mariv2.Tx) error {
+			var getErr error
+			kvPair, getErr = tx.Get(key, nil)
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		return kvPair
+	}
+
+	t.Run("Test Storage Metrics", func(t *testing.T) {
+		before := storageMetrics.Stats()
+		putErr := storageMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for idx := range 100 {
+				putTxErr := tx.Put([]byte(fmt.Sprintf("storage:%03d", idx)), []byte("value"))
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		if kvPair := get(t, storageMariInst, []byte("storage:042")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("value")) {
+			t.Fatalf("expected the value written through the storage: actual(%v)", kvPair)
+		}
+
+		after := storageMetrics.Stats()
+		if after.Writes <= before.Writes || after.WriteBytes <= before.WriteBytes {
+			t.Errorf("expected the commit to be recorded as writes: before(%+v), after(%+v)", before, after)
+		}
+
+		if after.Reads <= before.Reads || after.ReadBytes <= before.ReadBytes {
+			t.Errorf("expected the get to be recorded as reads: before(%+v), after(%+v)", before, after)
+		}
+
+		if after.WriteTime < time.Duration(after.Writes-before.Writes)*time.Microsecond {
+			t.Errorf("expected the injected write latency to be recorded: actual(%s)", after.WriteTime)
+		}
+
+		if after.Errors != 0 {
+			t.Errorf("expected no storage errors: actual(%d)", after.Errors)
+		}
+	})
+
+	t.Run("Test Storage Faults", func(t *testing.T) {
+		storageFaultWrites.Store(true)
+		putErr := storageMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("storage:000"), []byte("faulted"))
+		})
+
+		storageFaultWrites.Store(false)
+		if !errors.Is(putErr, errStorageFault) {
+			t.Fatalf("expected the injected fault to fail the commit: actual(%v)", putErr)
+		}
+
+		if storageMetrics.Stats().Errors == 0 {
+			t.Error("expected the fault to be recorded as a storage error")
+		}
+
+		if kvPair := get(t, storageMariInst, []byte("storage:000")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("value")) {
+			t.Fatalf("expected the failed commit to be discarded: actual(%v)", kvPair)
+		}
+
+		putErr = storageMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("storage:000"), []byte("recovered"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		if kvPair := get(t, storageMariInst, []byte("storage:000")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("recovered")) {
+			t.Fatalf("expected the commit after the fault: actual(%v)", kvPair)
+		}
+	})
+
+	t.Run("Test Read Only Storage", func(t *testing.T) {
+		closeErr := storageMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		readOnly, openErr := mariv2.Open(mariv2.InitOpts{
+			Filepath: os.TempDir(),
+			FileName: "teststorage",
+			Storage:  []mariv2.StorageMiddleware{mariv2.ReadOnlyStorage()},
+		})
+
+		if openErr != nil {
+			t.Fatalf("error opening read only mari: %s", openErr.Error())
+		}
+
+		defer readOnly.Remove()
+
+		if kvPair := get(t, readOnly, []byte("storage:000")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("recovered")) {
+			t.Fatalf("expected reads through the read only storage: actual(%v)", kvPair)
+		}
+
+		putErr := readOnly.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("storage:000"), []byte("rejected"))
+		})
+
+		if !errors.Is(putErr, mariv2.ErrReadOnlyStorage) {
+			t.Fatalf("expected the write to be rejected: actual(%v)", putErr)
+		}
+
+		if kvPair := get(t, readOnly, []byte("storage:000")); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("recovered")) {
+			t.Fatalf("expected the rejected commit to be discarded: actual(%v)", kvPair)
+		}
+	})
+
+	t.Run("Test IO Uring Flush Backend", func(t *testing.T) {
+		os.Remove(filepath.Join(os.TempDir(), "teststorageiouring"))
+
+		var metrics mariv2.StorageMetrics
+		backend := mariv2.FlushBackendIOURing
+		syncCommits := true
+		opts := mariv2.InitOpts{
+			Filepath:     os.TempDir(),
+			FileName:     "teststorageiouring",
+			FlushBackend: &backend,
+			SyncCommits:  &syncCommits,
+			Storage:      []mariv2.StorageMiddleware{mariv2.MetricsStorage(&metrics)},
+		}
+
+		uringInst, openErr := mariv2.Open(opts)
+		if errors.Is(openErr, mariv2.ErrIOURingUnavailable) {
+			t.Skipf("io_uring is not available: %s", openErr.Error())
+		}
+
+		if openErr != nil {
+			t.Fatalf("error opening mari with the io_uring flush backend: %s", openErr.Error())
+		}
+
+		var wg sync.WaitGroup
+		putErrs := make(chan error, 8)
+		for writer := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for idx := range 50 {
+					putErr := uringInst.UpdateTx(func(tx *mariv2.Tx) error {
+						return tx.Put([]byte(fmt.Sprintf("uring:%d:%02d", writer, idx)), []byte("value"))
+					})
+
+					if putErr != nil {
+						putErrs <- putErr
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(putErrs)
+		for putErr := range putErrs {
+			t.Fatalf("error on put flushed through io_uring: %s", putErr.Error())
+		}
+
+		if stats := metrics.Stats(); stats.Flushes == 0 || stats.Errors != 0 {
+			t.Errorf("expected the commits to be flushed through the storage: actual(%+v)", stats)
+		}
+
+		closeErr := uringInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		reopened, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "teststorageiouring"})
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		defer reopened.Remove()
+
+		for writer := range 8 {
+			if kvPair := get(t, reopened, []byte(fmt.Sprintf("uring:%d:49", writer))); kvPair == nil || !bytes.Equal(kvPair.Value, []byte("value")) {
+				t.Errorf("expected the commits flushed through io_uring to be read back: actual(%v)", kvPair)
+			}
+		}
+	})
+}
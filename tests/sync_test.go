@@ -0,0 +1,186 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const SYNC_INPUT_SIZE = 1000
+
+var syncInstA, syncInstB *mariv2.Mari
+var syncKeyValPairs []KeyVal
+
+func init() {
+	openSyncInst := func(fileName string) *mariv2.Mari {
+		os.Remove(filepath.Join(os.TempDir(), fileName))
+
+		nodePoolSize := int64(1000)
+		opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: fileName, NodePoolSize: &nodePoolSize}
+		inst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			panic(openErr.Error())
+		}
+
+		return inst
+	}
+
+	syncInstA = openSyncInst("testsynca")
+	syncInstB = openSyncInst("testsyncb")
+
+	syncKeyValPairs = make([]KeyVal, SYNC_INPUT_SIZE)
+	for idx := range syncKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		syncKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("sync test mari initialized")
+}
+
+func TestMariSync(t *testing.T) {
+	defer syncInstA.Remove()
+	defer syncInstB.Remove()
+
+	state := &mariv2.SyncState{}
+	put := func(inst *mariv2.Mari, key, value []byte) {
+		putErr := inst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(key, value)
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+	}
+
+	get := func(inst *mariv2.Mari, key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		getErr := inst.ReadTx(func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(key, nil)
+			return getTxErr
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+		return kvPair
+	}
+
+	t.Run("Test Key Version Is Last Write", func(t *testing.T) {
+		first := syncKeyValPairs[0]
+		put(syncInstA, first.Key, first.Value)
+		writtenAt := get(syncInstA, first.Key).Version
+
+		for _, val := range syncKeyValPairs[1 : SYNC_INPUT_SIZE/2] {
+			put(syncInstA, val.Key, val.Value)
+		}
+
+		if kvPair := get(syncInstA, first.Key); kvPair.Version != writtenAt {
+			t.Errorf("key version changed without a write: actual(%d), expected(%d)", kvPair.Version, writtenAt)
+		}
+	})
+
+	t.Run("Test Sync Disjoint Writes", func(t *testing.T) {
+		for _, val := range syncKeyValPairs[SYNC_INPUT_SIZE/2:] {
+			put(syncInstB, val.Key, val.Value)
+		}
+
+		result, syncErr := mariv2.Sync(syncInstA, syncInstB, state, nil)
+		if syncErr != nil {
+			t.Fatalf("error on sync: %s", syncErr.Error())
+		}
+
+		if result.Applied != SYNC_INPUT_SIZE || result.Conflicts != 0 {
+			t.Errorf("unexpected sync result: %+v", result)
+		}
+
+		for _, val := range syncKeyValPairs {
+			for _, inst := range []*mariv2.Mari{syncInstA, syncInstB} {
+				kvPair := get(inst, val.Key)
+				if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+					t.Fatalf("actual value not equal to expected: actual(%v), expected(%v)", kvPair, val)
+				}
+			}
+		}
+	})
+
+	t.Run("Test Sync Skips Echoed Changes", func(t *testing.T) {
+		result, syncErr := mariv2.Sync(syncInstA, syncInstB, state, nil)
+		if syncErr != nil {
+			t.Fatalf("error on sync: %s", syncErr.Error())
+		}
+
+		if result.Applied != 0 || result.Conflicts != 0 {
+			t.Errorf("expected echoed changes to be skipped: %+v", result)
+		}
+	})
+
+	t.Run("Test Sync Resolves Conflicts", func(t *testing.T) {
+		key := syncKeyValPairs[0].Key
+		put(syncInstA, key, []byte("written on a"))
+		time.Sleep(5 * time.Millisecond)
+		put(syncInstB, key, []byte("written on b"))
+
+		var resolverCalls int
+		resolver := mariv2.ConflictResolver(func(local, remote *mariv2.KeyValuePair) (*mariv2.KeyValuePair, error) {
+			resolverCalls++
+			return mariv2.DefaultConflictResolver(local, remote)
+		})
+
+		result, syncErr := mariv2.Sync(syncInstA, syncInstB, state, &mariv2.SyncOpts{Resolver: &resolver})
+		if syncErr != nil {
+			t.Fatalf("error on sync: %s", syncErr.Error())
+		}
+
+		if result.Conflicts != 2 || resolverCalls != 2 {
+			t.Errorf("expected a conflict on each instance: result(%+v), calls(%d)", result, resolverCalls)
+		}
+
+		valueA, valueB := get(syncInstA, key).Value, get(syncInstB, key).Value
+		if !bytes.Equal(valueA, valueB) {
+			t.Errorf("instances did not converge: a(%s), b(%s)", valueA, valueB)
+		}
+
+		if !bytes.Equal(valueA, []byte("written on b")) {
+			t.Errorf("expected the last write to win: actual(%s)", valueA)
+		}
+	})
+
+	t.Run("Test Changeset Binary Round Trip", func(t *testing.T) {
+		changeset, changesErr := syncInstA.ChangesSince(0)
+		if changesErr != nil {
+			t.Fatalf("error getting changes: %s", changesErr.Error())
+		}
+
+		sChangeset, marshalErr := changeset.MarshalBinary()
+		if marshalErr != nil {
+			t.Fatalf("error marshaling changeset: %s", marshalErr.Error())
+		}
+
+		decoded := &mariv2.Changeset{}
+		unmarshalErr := decoded.UnmarshalBinary(sChangeset)
+		if unmarshalErr != nil {
+			t.Fatalf("error unmarshaling changeset: %s", unmarshalErr.Error())
+		}
+
+		if decoded.ToVersion != changeset.ToVersion || decoded.Timestamp != changeset.Timestamp || len(decoded.Changes) != len(changeset.Changes) {
+			t.Fatalf("decoded changeset does not match: actual(%d, %d), expected(%d, %d)", decoded.ToVersion, len(decoded.Changes), changeset.ToVersion, len(changeset.Changes))
+		}
+
+		for idx, change := range changeset.Changes {
+			decodedChange := decoded.Changes[idx]
+			if decodedChange.Version != change.Version || decodedChange.Timestamp != change.Timestamp || !bytes.Equal(decodedChange.Key, change.Key) || !bytes.Equal(decodedChange.Value, change.Value) {
+				t.Errorf("decoded change does not match: actual(%v), expected(%v)", decodedChange, change)
+			}
+		}
+
+		if decoded.UnmarshalBinary(sChangeset[:len(sChangeset)-1]) == nil {
+			t.Error("expected error unmarshaling truncated changeset")
+		}
+	})
+}
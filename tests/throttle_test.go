@@ -0,0 +1,137 @@
+package maritests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var throttleMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testthrottle"))
+
+	nodePoolSize := int64(1000)
+	readOps, writeOps := int64(5), int64(3)
+	opts := mariv2.InitOpts{
+		Filepath:          os.TempDir(),
+		FileName:          "testthrottle",
+		NodePoolSize:      &nodePoolSize,
+		ReadOpsPerSecond:  &readOps,
+		WriteOpsPerSecond: &writeOps,
+	}
+
+	var openErr error
+	throttleMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("throttle test mari initialized")
+}
+
+func TestMariThrottle(t *testing.T) {
+	defer throttleMariInst.Remove()
+
+	put := func() error {
+		return throttleMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("throttle"), []byte(time.Now().String()))
+		})
+	}
+
+	read := func() error {
+		return throttleMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			_, getErr := tx.Get([]byte("throttle"), nil)
+			return getErr
+		})
+	}
+
+	t.Run("Test Write Limit", func(t *testing.T) {
+		for idx := range 3 {
+			putErr := put()
+			if putErr != nil {
+				t.Fatalf("error on put %d within the limit: %s", idx, putErr.Error())
+			}
+		}
+
+		putErr := put()
+		var throttledErr *mariv2.ThrottledError
+		if !errors.As(putErr, &throttledErr) || !errors.Is(putErr, mariv2.ErrThrottled) {
+			t.Fatalf("expected a ThrottledError: actual(%v)", putErr)
+		}
+
+		if throttledErr.Op != "UpdateTx" || throttledErr.RetryAfter <= 0 || throttledErr.RetryAfter > time.Second {
+			t.Fatalf("unexpected throttled error: actual(%s, %s)", throttledErr.Op, throttledErr.RetryAfter)
+		}
+
+		_, beginErr := throttleMariInst.Begin(false)
+		if !errors.Is(beginErr, mariv2.ErrThrottled) {
+			t.Fatalf("expected Begin to be throttled: actual(%v)", beginErr)
+		}
+
+		time.Sleep(throttledErr.RetryAfter)
+
+		putErr = put()
+		if putErr != nil {
+			t.Fatalf("error on put after waiting: %s", putErr.Error())
+		}
+	})
+
+	t.Run("Test Read Limit", func(t *testing.T) {
+		for idx := range 5 {
+			readErr := read()
+			if readErr != nil {
+				t.Fatalf("error on read %d within the limit: %s", idx, readErr.Error())
+			}
+		}
+
+		readErr := read()
+		if !errors.Is(readErr, mariv2.ErrThrottled) {
+			t.Fatalf("expected the read to be throttled: actual(%v)", readErr)
+		}
+
+		_, versionErr := throttleMariInst.Stats()
+		if versionErr != nil {
+			t.Fatalf("expected stats not to be throttled: %s", versionErr.Error())
+		}
+
+		readErr = throttleMariInst.ReadTxAtVersion(1, func(tx *mariv2.Tx) error { return nil })
+		if !errors.Is(readErr, mariv2.ErrThrottled) {
+			t.Fatalf("expected reads at a version to be throttled: actual(%v)", readErr)
+		}
+	})
+
+	t.Run("Test Throttle Stats", func(t *testing.T) {
+		stats, statsErr := throttleMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		expected := mariv2.ThrottleStats{ReadRate: 5, WriteRate: 3, ReadsThrottled: 2, WritesThrottled: 2}
+		if stats.Throttle != expected {
+			t.Fatalf("unexpected throttle stats: expected(%+v), actual(%+v)", expected, stats.Throttle)
+		}
+
+		encoded, encodeErr := json.Marshal(stats)
+		if encodeErr != nil {
+			t.Fatalf("error encoding stats: %s", encodeErr.Error())
+		}
+
+		var decoded struct {
+			Throttle struct {
+				ReadsThrottled uint64 `json:"readsThrottled"`
+			} `json:"throttle"`
+		}
+
+		decodeErr := json.Unmarshal(encoded, &decoded)
+		if decodeErr != nil || decoded.Throttle.ReadsThrottled != 2 {
+			t.Fatalf("expected the throttle stats in the JSON: actual(%s)", encoded)
+		}
+	})
+}
@@ -0,0 +1,328 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const TIERING_INPUT_SIZE = 100
+
+var tieringOpts mariv2.InitOpts
+var tieringEvents struct {
+	lock   sync.Mutex
+	events []*mariv2.CommitEvent
+}
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testtiering"))
+	os.Remove(filepath.Join(os.TempDir(), "testtiering"+mariv2.ColdFileExt))
+	os.Remove(filepath.Join(os.TempDir(), "testtieringremote"))
+	os.Remove(filepath.Join(os.TempDir(), "testtieringfollower"))
+
+	nodePoolSize := int64(1000)
+	coldAfter := time.Second
+	tieringInterval := time.Hour
+	tieringOpts = mariv2.InitOpts{
+		Filepath:        os.TempDir(),
+		FileName:        "testtiering",
+		NodePoolSize:    &nodePoolSize,
+		ColdAfter:       &coldAfter,
+		TieringInterval: &tieringInterval,
+		CommitHooks: []mariv2.CommitHook{func(event *mariv2.CommitEvent) {
+			tieringEvents.lock.Lock()
+			defer tieringEvents.lock.Unlock()
+
+			tieringEvents.events = append(tieringEvents.events, event)
+		}},
+	}
+
+	fmt.Println("tiering test mari initialized")
+}
+
+func tieringValue(idx int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("cold value %d ", idx)), 64)
+}
+
+func TestMariTiering(t *testing.T) {
+	tieringMariInst, openErr := mariv2.Open(tieringOpts)
+	if openErr != nil {
+		t.Fatalf("error opening mari: %s", openErr.Error())
+	}
+
+	putErr := tieringMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range TIERING_INPUT_SIZE {
+			putTxErr := tx.Put([]byte(fmt.Sprintf("tier:%03d", idx)), tieringValue(idx))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		putTxErr := tx.Put([]byte("tier:small"), []byte("small"))
+		if putTxErr != nil {
+			return putTxErr
+		}
+
+		return tx.PutWithTTL([]byte("tier:ttl"), tieringValue(-1), time.Hour)
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put: %s", putErr.Error())
+	}
+
+	getValue := func(t *testing.T, mariInst *mariv2.Mari, key string) []byte {
+		var value []byte
+		readErr := mariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte(key), nil)
+			if getErr != nil || kvPair == nil {
+				return getErr
+			}
+
+			value = bytes.Clone(kvPair.Value)
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		return value
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+
+	t.Run("Test Tier Cold Values", func(t *testing.T) {
+		tieringEvents.lock.Lock()
+		tieringEvents.events = nil
+		tieringEvents.lock.Unlock()
+
+		getValue(t, tieringMariInst, "tier:000")
+		moved, tierErr := tieringMariInst.TierColdValues()
+		if tierErr != nil {
+			t.Fatalf("error moving cold values: %s", tierErr.Error())
+		}
+
+		if moved != TIERING_INPUT_SIZE {
+			t.Fatalf("expected every value not read and over the min size to be moved: actual(%d)", moved)
+		}
+
+		stats, statsErr := tieringMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		rawSize := 0
+		for idx := range TIERING_INPUT_SIZE {
+			rawSize += len(tieringValue(idx))
+		}
+
+		if stats.TieredValues != TIERING_INPUT_SIZE || stats.ColdFileSize <= 0 || stats.ColdFileSize >= int64(rawSize) {
+			t.Errorf("expected the moved values to be compressed in the cold file: actual(%d, %d)", stats.TieredValues, stats.ColdFileSize)
+		}
+
+		tieringEvents.lock.Lock()
+		events := tieringEvents.events
+		tieringEvents.lock.Unlock()
+
+		if len(events) != 1 || len(events[0].Changes) != 0 || events[0].Annotations[mariv2.TieringAnnotation] == "" {
+			t.Errorf("expected the tiering commit to be annotated without changes: actual(%v)", events)
+		}
+
+		getValue(t, tieringMariInst, "tier:000")
+		moved, tierErr = tieringMariInst.TierColdValues()
+		if tierErr != nil || moved != 0 {
+			t.Errorf("expected values already moved not to be moved again: actual(%d, %v)", moved, tierErr)
+		}
+	})
+
+	t.Run("Test Read Cold Values", func(t *testing.T) {
+		for _, idx := range []int{0, 1, 50, TIERING_INPUT_SIZE - 1} {
+			value := getValue(t, tieringMariInst, fmt.Sprintf("tier:%03d", idx))
+			if !bytes.Equal(value, tieringValue(idx)) {
+				t.Errorf("expected the value of tier:%03d: actual(%q)", idx, value)
+			}
+		}
+
+		var kvPairs []*mariv2.KeyValuePair
+		readErr := tieringMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var rangeErr error
+			kvPairs, rangeErr = tx.Range([]byte("tier:000"), []byte("tier:999"), nil)
+			return rangeErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari range: %s", readErr.Error())
+		}
+
+		if len(kvPairs) != TIERING_INPUT_SIZE {
+			t.Fatalf("expected %d results: actual(%d)", TIERING_INPUT_SIZE, len(kvPairs))
+		}
+
+		for idx, kvPair := range kvPairs {
+			if !bytes.Equal(kvPair.Value, tieringValue(idx)) {
+				t.Fatalf("expected the value of %s: actual(%q)", kvPair.Key, kvPair.Value)
+			}
+		}
+
+		stats, statsErr := tieringMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.ColdReads == 0 {
+			t.Error("expected cold reads to be counted")
+		}
+	})
+
+	t.Run("Test Write Cold Key", func(t *testing.T) {
+		putErr := tieringMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("tier:001"), []byte("rewritten"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		if value := getValue(t, tieringMariInst, "tier:001"); !bytes.Equal(value, []byte("rewritten")) {
+			t.Errorf("expected the value written after the key was moved: actual(%q)", value)
+		}
+
+		if value := getValue(t, tieringMariInst, "tier:small"); !bytes.Equal(value, []byte("small")) {
+			t.Errorf("expected values under the min size to be kept: actual(%q)", value)
+		}
+
+		if value := getValue(t, tieringMariInst, "tier:ttl"); !bytes.Equal(value, tieringValue(-1)) {
+			t.Errorf("expected a value with a ttl to keep its ttl: actual(%q)", value)
+		}
+	})
+
+	t.Run("Test Sync Clone And Catch Up", func(t *testing.T) {
+		nodePoolSize := int64(1000)
+		follower := true
+		remoteMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testtieringremote", NodePoolSize: &nodePoolSize})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer remoteMariInst.Remove()
+
+		followerMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testtieringfollower", NodePoolSize: &nodePoolSize, Follower: &follower})
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer followerMariInst.Remove()
+
+		putErr := tieringMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("tier:late"), tieringValue(-2))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		state := &mariv2.SyncState{}
+		_, syncErr := mariv2.Sync(tieringMariInst, remoteMariInst, state, nil)
+		if syncErr != nil {
+			t.Fatalf("error syncing: %s", syncErr.Error())
+		}
+
+		if value := getValue(t, remoteMariInst, "tier:050"); !bytes.Equal(value, tieringValue(50)) {
+			t.Errorf("expected cold values to be synced: actual(%q)", value)
+		}
+
+		time.Sleep(1200 * time.Millisecond)
+		putErr = remoteMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte("tier:late"), []byte("remote"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		getValue(t, tieringMariInst, "tier:000")
+		moved, tierErr := tieringMariInst.TierColdValues()
+		if tierErr != nil || moved != 1 {
+			t.Fatalf("expected the late value to be moved: actual(%d, %v)", moved, tierErr)
+		}
+
+		_, syncErr = mariv2.Sync(tieringMariInst, remoteMariInst, state, nil)
+		if syncErr != nil {
+			t.Fatalf("error syncing: %s", syncErr.Error())
+		}
+
+		for _, mariInst := range []*mariv2.Mari{tieringMariInst, remoteMariInst} {
+			if value := getValue(t, mariInst, "tier:late"); !bytes.Equal(value, []byte("remote")) {
+				t.Errorf("expected moving a value not to be synced as a write: actual(%q)", value)
+			}
+		}
+
+		stats, statsErr := tieringMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		clone, cloneErr := tieringMariInst.LoadSnapshotIntoMemory(stats.Version)
+		if cloneErr != nil {
+			t.Fatalf("error loading snapshot: %s", cloneErr.Error())
+		}
+
+		defer clone.Close()
+
+		if value := getValue(t, clone, "tier:050"); !bytes.Equal(value, tieringValue(50)) {
+			t.Errorf("expected cold values to be cloned: actual(%q)", value)
+		}
+
+		replication, replicateErr := tieringMariInst.Replicate(&interruptedSink{replica: followerMariInst}, mariv2.ReplicationOpts{})
+		if replicateErr != nil {
+			t.Fatalf("error starting replication: %s", replicateErr.Error())
+		}
+
+		defer replication.Stop()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for getValue(t, followerMariInst, "tier:050") == nil {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the follower to catch up")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if value := getValue(t, followerMariInst, "tier:050"); !bytes.Equal(value, tieringValue(50)) {
+			t.Errorf("expected cold values to be sent in the snapshot: actual(%q)", value)
+		}
+	})
+
+	t.Run("Test Reopen Without Tiering", func(t *testing.T) {
+		closeErr := tieringMariInst.Close()
+		if closeErr != nil {
+			t.Fatalf("error closing mari: %s", closeErr.Error())
+		}
+
+		reopenedMariInst, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testtiering"})
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		if value := getValue(t, reopenedMariInst, "tier:050"); !bytes.Equal(value, tieringValue(50)) {
+			t.Errorf("expected cold values to be read after a reopen: actual(%q)", value)
+		}
+
+		removeErr := reopenedMariInst.Remove()
+		if removeErr != nil {
+			t.Fatalf("error removing mari: %s", removeErr.Error())
+		}
+
+		_, statErr := os.Stat(filepath.Join(os.TempDir(), "testtiering"+mariv2.ColdFileExt))
+		if !os.IsNotExist(statErr) {
+			t.Errorf("expected the cold file to be removed: actual(%v)", statErr)
+		}
+	})
+}
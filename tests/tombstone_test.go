@@ -0,0 +1,207 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var tombstoneMariInst *mariv2.Mari
+var tombstoneCompactNow atomic.Bool
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testtombstone"))
+
+	nodePoolSize := int64(1000)
+	tombstones := true
+	compactTrigger := mariv2.CompactionTrigger(func(*mariv2.MetaData) bool { return tombstoneCompactNow.CompareAndSwap(true, false) })
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testtombstone", NodePoolSize: &nodePoolSize, Tombstones: &tombstones, CompactTrigger: &compactTrigger}
+
+	var openErr error
+	tombstoneMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("tombstone test mari initialized")
+}
+
+func TestMariTombstones(t *testing.T) {
+	defer tombstoneMariInst.Remove()
+
+	commit := func(t *testing.T, txOps func(tx *mariv2.Tx) error) uint64 {
+		var committed *mariv2.Tx
+		updateErr := tombstoneMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			committed = tx
+			return txOps(tx)
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		return committed.CommitVersion()
+	}
+
+	getTombstone := func(t *testing.T, key string) *mariv2.KeyValuePair {
+		var tombstone *mariv2.KeyValuePair
+		readErr := tombstoneMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getErr error
+			tombstone, getErr = tx.GetTombstone([]byte(key))
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error getting tombstone: %s", readErr.Error())
+		}
+
+		return tombstone
+	}
+
+	var deleteVersion uint64
+
+	t.Run("Test Delete Writes Tombstone", func(t *testing.T) {
+		commit(t, func(tx *mariv2.Tx) error {
+			for _, key := range []string{"user:1", "user:2", "user:3"} {
+				putErr := tx.Put([]byte(key), []byte("value"))
+				if putErr != nil {
+					return putErr
+				}
+			}
+
+			return nil
+		})
+
+		deleteVersion = commit(t, func(tx *mariv2.Tx) error { return tx.Delete([]byte("user:2")) })
+
+		tombstone := getTombstone(t, "user:2")
+		if tombstone == nil || !tombstone.Deleted || tombstone.Version != deleteVersion || tombstone.Value != nil {
+			t.Fatalf("expected the tombstone at the delete version %d: actual(%+v)", deleteVersion, tombstone)
+		}
+
+		commit(t, func(tx *mariv2.Tx) error { return tx.Delete([]byte("user:missing")) })
+		if tombstone := getTombstone(t, "user:missing"); tombstone != nil {
+			t.Fatalf("expected no tombstone for a missing key: actual(%+v)", tombstone)
+		}
+	})
+
+	t.Run("Test Range Includes Tombstones", func(t *testing.T) {
+		readErr := tombstoneMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range([]byte("user:"), []byte("user;"), nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 2 {
+				t.Errorf("expected tombstones to be excluded by default: actual(%d)", len(kvPairs))
+			}
+
+			includeTombstones := true
+			kvPairs, rangeErr = tx.Range([]byte("user:"), []byte("user;"), &mariv2.RangeOpts{IncludeTombstones: &includeTombstones})
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			expected := []string{"user:1", "user:2", "user:3"}
+			if len(kvPairs) != len(expected) {
+				t.Fatalf("expected the live keys and tombstones: actual(%d)", len(kvPairs))
+			}
+
+			for idx, kvPair := range kvPairs {
+				if !bytes.Equal(kvPair.Key, []byte(expected[idx])) || kvPair.Deleted != (idx == 1) {
+					t.Errorf("unexpected result at %d: actual(%s, %t)", idx, kvPair.Key, kvPair.Deleted)
+				}
+			}
+
+			kvPairs, rangeErr = tx.Range([]byte("user:"), []byte("user;"), &mariv2.RangeOpts{MinVersion: &deleteVersion, IncludeTombstones: &includeTombstones})
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 1 || !kvPairs[0].Deleted {
+				t.Errorf("expected only the delete since the version: actual(%d)", len(kvPairs))
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari range: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Put Clears Tombstone", func(t *testing.T) {
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("user:2"), []byte("again")) })
+
+		if tombstone := getTombstone(t, "user:2"); tombstone != nil {
+			t.Fatalf("expected the tombstone to be cleared: actual(%+v)", tombstone)
+		}
+
+		commit(t, func(tx *mariv2.Tx) error { return tx.Delete([]byte("user:3")) })
+	})
+
+	t.Run("Test Tombstones Purged By Compaction", func(t *testing.T) {
+		if tombstone := getTombstone(t, "user:3"); tombstone == nil {
+			t.Fatal("expected a tombstone before compaction")
+		}
+
+		stats, statsErr := tombstoneMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error on mari stats: %s", statsErr.Error())
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for version := stats.Version; stats.Version >= version; {
+			if time.Now().After(deadline) {
+				t.Fatal("file was not compacted")
+			}
+
+			tombstoneCompactNow.Store(true)
+			commit(t, func(tx *mariv2.Tx) error { return tx.Put([]byte("compact"), []byte("value")) })
+			time.Sleep(10 * time.Millisecond)
+
+			stats, statsErr = tombstoneMariInst.Stats()
+			if statsErr != nil {
+				t.Fatalf("error on mari stats: %s", statsErr.Error())
+			}
+		}
+
+		for tombstone := getTombstone(t, "user:3"); tombstone != nil; tombstone = getTombstone(t, "user:3") {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the tombstone to be purged after compaction: actual(%+v)", tombstone)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("Test Max Key Size", func(t *testing.T) {
+		tombstones := true
+		maxKeySize := mariv2.MaxKeySize
+		_, openErr := mariv2.Open(mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testtombstonekeys", Tombstones: &tombstones, MaxKeySize: &maxKeySize})
+		if openErr == nil {
+			t.Fatal("expected an error opening with a max key size over MaxTombstoneKeySize")
+		}
+
+		putErr := tombstoneMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(bytes.Repeat([]byte("k"), mariv2.MaxTombstoneKeySize+1), []byte("value"))
+		})
+
+		if putErr == nil {
+			t.Fatal("expected an error putting a key over MaxTombstoneKeySize")
+		}
+
+		longKey := bytes.Repeat([]byte("k"), mariv2.MaxTombstoneKeySize)
+		commit(t, func(tx *mariv2.Tx) error { return tx.Put(longKey, []byte("value")) })
+		commit(t, func(tx *mariv2.Tx) error { return tx.Delete(longKey) })
+		if tombstone := getTombstone(t, string(longKey)); tombstone == nil {
+			t.Fatal("expected a tombstone for the longest key")
+		}
+	})
+}
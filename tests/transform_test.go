@@ -0,0 +1,233 @@
+package maritests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const TRANSFORM_INPUT_SIZE = 1000
+
+var transformMariInst *mariv2.Mari
+var transformKeyValPairs []KeyVal
+var transformPrefix = []byte("encoded:")
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testtransform"))
+
+	// the pipeline decodes the stored values, then drops keys with an odd first byte
+	decode := func(kvPair *mariv2.KeyValuePair) *mariv2.KeyValuePair {
+		kvPair.Value = bytes.TrimPrefix(kvPair.Value, transformPrefix)
+		return kvPair
+	}
+
+	filter := func(kvPair *mariv2.KeyValuePair) *mariv2.KeyValuePair {
+		if kvPair.Key[0]%2 == 1 {
+			return nil
+		}
+		return kvPair
+	}
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testtransform",
+		NodePoolSize: &nodePoolSize,
+		Transforms:   []mariv2.Transform{decode, nil, filter},
+	}
+
+	var openErr error
+	transformMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	transformKeyValPairs = make([]KeyVal, TRANSFORM_INPUT_SIZE)
+	putErr := transformMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for idx := range transformKeyValPairs {
+			randomBytes, _ := GenerateRandomBytes(32)
+			transformKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+
+			putTxErr := tx.Put(randomBytes, append(append([]byte{}, transformPrefix...), randomBytes...))
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	fmt.Println("transform test mari initialized")
+}
+
+func TestMariTransform(t *testing.T) {
+	defer transformMariInst.Remove()
+
+	var expectedKeys int
+	for _, val := range transformKeyValPairs {
+		if val.Key[0]%2 == 0 {
+			expectedKeys++
+		}
+	}
+
+	checkKvPairs := func(t *testing.T, kvPairs []*mariv2.KeyValuePair) {
+		if len(kvPairs) != expectedKeys {
+			t.Errorf("expected the filtered keys to be dropped: actual(%d), expected(%d)", len(kvPairs), expectedKeys)
+		}
+
+		for _, kvPair := range kvPairs {
+			if kvPair.Key[0]%2 == 1 || !bytes.Equal(kvPair.Key, kvPair.Value) {
+				t.Fatalf("expected decoded value for key %x, got: %x", kvPair.Key, kvPair.Value)
+			}
+		}
+	}
+
+	t.Run("Test Registered Pipeline On Get", func(t *testing.T) {
+		getErr := transformMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			for _, val := range transformKeyValPairs {
+				kvPair, getTxErr := tx.Get(val.Key, nil)
+				if getTxErr != nil {
+					return getTxErr
+				}
+
+				switch {
+				case val.Key[0]%2 == 1 && kvPair != nil:
+					return fmt.Errorf("expected key %x to be dropped", val.Key)
+				case val.Key[0]%2 == 0 && (kvPair == nil || !bytes.Equal(kvPair.Value, val.Value)):
+					return fmt.Errorf("actual value not equal to expected for key %x", val.Key)
+				}
+			}
+
+			return nil
+		})
+
+		if getErr != nil {
+			t.Errorf("error getting transformed values: %s", getErr.Error())
+		}
+	})
+
+	t.Run("Test Registered Pipeline On Scans", func(t *testing.T) {
+		readErr := transformMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, iterTxErr := tx.Iterate(nil, TRANSFORM_INPUT_SIZE, nil)
+			if iterTxErr != nil {
+				return iterTxErr
+			}
+
+			checkKvPairs(t, kvPairs)
+
+			kvPairs, rangeTxErr := tx.Range(nil, nil, nil)
+			if rangeTxErr != nil {
+				return rangeTxErr
+			}
+
+			checkKvPairs(t, kvPairs)
+			return nil
+		})
+
+		if readErr != nil {
+			t.Errorf("error scanning transformed values: %s", readErr.Error())
+		}
+
+		iter, iterErr := transformMariInst.NewIterator(nil, nil)
+		if iterErr != nil {
+			t.Fatalf("error opening iterator: %s", iterErr.Error())
+		}
+
+		defer iter.Close()
+
+		var kvPairs []*mariv2.KeyValuePair
+		for iter.Next() {
+			kvPairs = append(kvPairs, iter.KeyValue())
+		}
+
+		if iter.Err() != nil {
+			t.Fatalf("error iterating transformed values: %s", iter.Err().Error())
+		}
+
+		checkKvPairs(t, kvPairs)
+	})
+
+	t.Run("Test Read Transform After Pipeline", func(t *testing.T) {
+		transform := mariv2.Pipeline(mariv2.CopyTransform, mariv2.KeysOnlyTransform)
+		rangeOpts := &mariv2.RangeOpts{Transform: &transform}
+
+		readErr := transformMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeTxErr := tx.Range(nil, nil, rangeOpts)
+			if rangeTxErr != nil {
+				return rangeTxErr
+			}
+
+			if len(kvPairs) != expectedKeys {
+				return fmt.Errorf("expected the filtered keys to be dropped: actual(%d), expected(%d)", len(kvPairs), expectedKeys)
+			}
+
+			for _, kvPair := range kvPairs {
+				if kvPair.Value != nil {
+					return fmt.Errorf("expected only the key for key %x, got value: %x", kvPair.Key, kvPair.Value)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Errorf("error ranging with transform: %s", readErr.Error())
+		}
+	})
+
+	t.Run("Test Projection Transforms", func(t *testing.T) {
+		sliceTransform := mariv2.SliceTransform(4, 12)
+		readErr := transformMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeTxErr := tx.Range(nil, nil, &mariv2.RangeOpts{Transform: &sliceTransform})
+			if rangeTxErr != nil {
+				return rangeTxErr
+			}
+
+			for _, kvPair := range kvPairs {
+				if !bytes.Equal(kvPair.Value, kvPair.Key[4:12]) {
+					return fmt.Errorf("expected the value projected to the byte range for key %x, got: %x", kvPair.Key, kvPair.Value)
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Errorf("error ranging with slice transform: %s", readErr.Error())
+		}
+
+		jsonKey := []byte("json")
+		putErr := transformMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(jsonKey, []byte(`{"name":"mari","email":"mari@example.com","bio":"a wide value"}`))
+		})
+
+		if putErr != nil {
+			t.Fatalf("error putting json value: %s", putErr.Error())
+		}
+
+		fieldsTransform := mariv2.JSONFieldsTransform("name", "email", "missing")
+		var kvPair *mariv2.KeyValuePair
+		getErr := transformMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(jsonKey, &fieldsTransform)
+			return getTxErr
+		})
+
+		if getErr != nil {
+			t.Fatalf("error getting json value: %s", getErr.Error())
+		}
+
+		expected := `{"email":"mari@example.com","name":"mari"}`
+		if kvPair == nil || string(kvPair.Value) != expected {
+			t.Errorf("expected the value projected to the selected fields: actual(%v), expected(%s)", kvPair, expected)
+		}
+	})
+}
@@ -0,0 +1,377 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const TTL_INPUT_SIZE = 100
+
+var ttlMariInst *mariv2.Mari
+var lazyTTLMariInst *mariv2.Mari
+var ttlKeyValPairs []KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testttl"))
+
+	var openErr error
+	ttlMariInst, openErr = openTTLInst()
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	os.Remove(filepath.Join(os.TempDir(), "testlazyttl"))
+
+	expirationInterval, expirationJitter := time.Hour, time.Minute
+	lazyOpts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testlazyttl", ExpirationInterval: &expirationInterval, ExpirationJitter: &expirationJitter}
+	lazyTTLMariInst, openErr = mariv2.Open(lazyOpts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	ttlKeyValPairs = make([]KeyVal, TTL_INPUT_SIZE)
+	for idx := range ttlKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		ttlKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("ttl test mari initialized")
+}
+
+func openTTLInst() (*mariv2.Mari, error) {
+	nodePoolSize := int64(1000)
+	expirationInterval := 50 * time.Millisecond
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testttl", NodePoolSize: &nodePoolSize, ExpirationInterval: &expirationInterval}
+	return mariv2.Open(opts)
+}
+
+func TestMariTTL(t *testing.T) {
+	defer ttlMariInst.Remove()
+
+	get := func(key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		getErr := ttlMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(key, nil)
+			return getTxErr
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+		return kvPair
+	}
+
+	putWithTTL := func(kvPairs []KeyVal, ttl time.Duration) {
+		putErr := ttlMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, val := range kvPairs {
+				putTxErr := tx.PutWithTTL(val.Key, val.Value, ttl)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put with ttl: %s", putErr.Error())
+		}
+	}
+
+	quarter := TTL_INPUT_SIZE / 4
+
+	t.Run("Test Expire Due Keys", func(t *testing.T) {
+		putWithTTL(ttlKeyValPairs[:quarter], 20*time.Millisecond)
+		putWithTTL(ttlKeyValPairs[quarter:2*quarter], time.Hour)
+
+		readErr := ttlMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			expiresAt, expiresTxErr := tx.ExpiresAt(ttlKeyValPairs[quarter].Key)
+			if expiresTxErr != nil {
+				return expiresTxErr
+			}
+
+			if time.Until(expiresAt) < 59*time.Minute {
+				t.Errorf("unexpected expiration time: %s", expiresAt)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari expires at: %s", readErr.Error())
+		}
+
+		time.Sleep(40 * time.Millisecond)
+
+		ttlMariInst.Expire()
+
+		for _, val := range ttlKeyValPairs[:quarter] {
+			if kvPair := get(val.Key); kvPair != nil {
+				t.Fatalf("expired key still present: %v", kvPair)
+			}
+		}
+
+		for _, val := range ttlKeyValPairs[quarter : 2*quarter] {
+			if kvPair := get(val.Key); kvPair == nil {
+				t.Fatalf("key deleted before ttl elapsed: %v", val)
+			}
+		}
+	})
+
+	t.Run("Test Put Clears TTL", func(t *testing.T) {
+		putWithTTL(ttlKeyValPairs[2*quarter:3*quarter], 20*time.Millisecond)
+
+		putErr := ttlMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, val := range ttlKeyValPairs[2*quarter : 3*quarter] {
+				putTxErr := tx.Put(val.Key, val.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		time.Sleep(40 * time.Millisecond)
+
+		totalExpired, expireErr := ttlMariInst.Expire()
+		if expireErr != nil {
+			t.Fatalf("error on mari expire: %s", expireErr.Error())
+		}
+
+		if totalExpired != 0 {
+			t.Errorf("expected no keys to expire after put: actual(%d)", totalExpired)
+		}
+
+		for _, val := range ttlKeyValPairs[2*quarter : 3*quarter] {
+			if kvPair := get(val.Key); kvPair == nil {
+				t.Fatalf("key with cleared ttl was deleted: %v", val)
+			}
+		}
+	})
+
+	t.Run("Test Expiration Worker", func(t *testing.T) {
+		putWithTTL(ttlKeyValPairs[3*quarter:], 20*time.Millisecond)
+
+		swept := func() bool {
+			var expires time.Time
+			readErr := ttlMariInst.ReadTx(func(tx *mariv2.Tx) error {
+				var expiresErr error
+				expires, expiresErr = tx.ExpiresAt(ttlKeyValPairs[len(ttlKeyValPairs)-1].Key)
+				return expiresErr
+			})
+
+			if readErr != nil {
+				t.Fatalf("error on mari expires at: %s", readErr.Error())
+			}
+
+			return expires.IsZero()
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for !swept() {
+			if time.Now().After(deadline) {
+				t.Fatal("expiration worker did not delete the expired key")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		for _, val := range ttlKeyValPairs[3*quarter:] {
+			if kvPair := get(val.Key); kvPair != nil {
+				t.Fatalf("expired key still present: %v", kvPair)
+			}
+		}
+	})
+
+	t.Run("Test TTL Survives Reopen", func(t *testing.T) {
+		putWithTTL(ttlKeyValPairs[:1], 20*time.Millisecond)
+
+		ttlMariInst.Close()
+
+		var openErr error
+		ttlMariInst, openErr = openTTLInst()
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		time.Sleep(40 * time.Millisecond)
+
+		ttlMariInst.Expire()
+
+		if kvPair := get(ttlKeyValPairs[0].Key); kvPair != nil {
+			t.Errorf("expired key still present after reopen: %v", kvPair)
+		}
+
+		if kvPair := get(ttlKeyValPairs[quarter].Key); kvPair == nil {
+			t.Errorf("key deleted before ttl elapsed after reopen: %v", ttlKeyValPairs[quarter])
+		}
+	})
+}
+
+func TestMariLazyExpire(t *testing.T) {
+	defer lazyTTLMariInst.Remove()
+
+	expiresAt := func(t *testing.T, key []byte) time.Time {
+		var expires time.Time
+		readErr := lazyTTLMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var expiresErr error
+			expires, expiresErr = tx.ExpiresAt(key)
+			return expiresErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari expires at: %s", readErr.Error())
+		}
+
+		return expires
+	}
+
+	putErr := lazyTTLMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for _, key := range []string{"lazy:1", "lazy:2", "lazy:3"} {
+			putTxErr := tx.PutWithTTL([]byte(key), []byte("expiring"), 20*time.Millisecond)
+			if putTxErr != nil {
+				return putTxErr
+			}
+		}
+
+		return tx.PutWithTTL([]byte("lazy:4"), []byte("live"), time.Hour)
+	})
+
+	if putErr != nil {
+		t.Fatalf("error on mari put with ttl: %s", putErr.Error())
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	t.Run("Test Update Deletes Expired Key On Read", func(t *testing.T) {
+		updateErr := lazyTTLMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("lazy:1"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil {
+				t.Errorf("expected the expired key to be treated as deleted: actual(%s)", kvPair.Value)
+			}
+
+			return nil
+		})
+
+		if updateErr != nil {
+			t.Fatalf("error on mari update: %s", updateErr.Error())
+		}
+
+		if expires := expiresAt(t, []byte("lazy:1")); !expires.IsZero() {
+			t.Fatalf("expected the expired key to be deleted with its ttl: actual(%s)", expires)
+		}
+
+		if expires := expiresAt(t, []byte("lazy:2")); expires.IsZero() {
+			t.Fatal("expected the unread expired key to wait for a sweep")
+		}
+	})
+
+	t.Run("Test Read Excludes Expired Keys", func(t *testing.T) {
+		readErr := lazyTTLMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPairs, rangeErr := tx.Range([]byte("lazy:"), []byte("lazy;"), nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 1 || !bytes.Equal(kvPairs[0].Key, []byte("lazy:4")) {
+				t.Errorf("expected only the live key in range: actual(%d)", len(kvPairs))
+			}
+
+			kvPairs, rangeErr = tx.Iterate([]byte("lazy:"), 4, nil)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			if len(kvPairs) != 1 || !bytes.Equal(kvPairs[0].Key, []byte("lazy:4")) {
+				t.Errorf("expected only the live key in iterate: actual(%d)", len(kvPairs))
+			}
+
+			kvPair, getErr := tx.Get([]byte("lazy:3"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil {
+				t.Errorf("expected the expired key to be treated as deleted: actual(%s)", kvPair.Value)
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari read: %s", readErr.Error())
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for !expiresAt(t, []byte("lazy:3")).IsZero() {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the read to signal a sweep before the next interval")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("Test Max TTL Key Size", func(t *testing.T) {
+		longKey := bytes.Repeat([]byte("t"), mariv2.MaxTTLKeySize+1)
+		putErr := lazyTTLMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.PutWithTTL(longKey, []byte("value"), time.Hour)
+		})
+
+		if !errors.Is(putErr, mariv2.ErrKeyTooLarge) || !strings.Contains(putErr.Error(), fmt.Sprintf("%d bytes", len(longKey))) {
+			t.Fatalf("expected ErrKeyTooLarge naming the length of the key: actual(%v)", putErr)
+		}
+
+		readErr := lazyTTLMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get(longKey, nil)
+			if getErr == nil && kvPair != nil {
+				t.Error("expected nothing to be written for a key over MaxTTLKeySize")
+			}
+
+			return getErr
+		})
+
+		if readErr != nil {
+			t.Fatalf("error on mari get: %s", readErr.Error())
+		}
+
+		putErr = lazyTTLMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(longKey, []byte("value"))
+		})
+
+		if putErr != nil {
+			t.Fatalf("expected a put without a ttl to accept the key: %s", putErr.Error())
+		}
+
+		maxKey := longKey[:mariv2.MaxTTLKeySize]
+		putErr = lazyTTLMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.PutWithTTL(maxKey, []byte("value"), time.Hour)
+		})
+
+		if putErr != nil {
+			t.Fatalf("error on mari put with ttl of a key at MaxTTLKeySize: %s", putErr.Error())
+		}
+
+		if expiresAt(t, maxKey).IsZero() {
+			t.Error("expected the key at MaxTTLKeySize to expire")
+		}
+	})
+}
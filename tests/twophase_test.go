@@ -0,0 +1,258 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const TWO_PHASE_INPUT_SIZE = 100
+
+var twoPhaseMariInst *mariv2.Mari
+var twoPhaseKeyValPairs []KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testtwophase"))
+
+	var openErr error
+	twoPhaseMariInst, openErr = openTwoPhaseInst()
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	twoPhaseKeyValPairs = make([]KeyVal, TWO_PHASE_INPUT_SIZE)
+	for idx := range twoPhaseKeyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		twoPhaseKeyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	fmt.Println("two phase commit test mari initialized")
+}
+
+func openTwoPhaseInst() (*mariv2.Mari, error) {
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{Filepath: os.TempDir(), FileName: "testtwophase", NodePoolSize: &nodePoolSize}
+	return mariv2.Open(opts)
+}
+
+func TestMariTwoPhaseCommit(t *testing.T) {
+	defer twoPhaseMariInst.Remove()
+
+	get := func(key []byte) *mariv2.KeyValuePair {
+		var kvPair *mariv2.KeyValuePair
+		getErr := twoPhaseMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			var getTxErr error
+			kvPair, getTxErr = tx.Get(key, nil)
+			return getTxErr
+		})
+
+		if getErr != nil {
+			t.Fatalf("error on mari get: %s", getErr.Error())
+		}
+		return kvPair
+	}
+
+	put := func(key, value []byte) error {
+		return twoPhaseMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put(key, value)
+		})
+	}
+
+	prepare := func(id string, kvPairs []KeyVal) error {
+		return twoPhaseMariInst.PrepareTx(id, func(tx *mariv2.Tx) error {
+			for _, val := range kvPairs {
+				putTxErr := tx.Put(val.Key, val.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+	}
+
+	half := TWO_PHASE_INPUT_SIZE / 2
+	deletedKey := []byte("deleted on commit")
+
+	t.Run("Test Prepare Holds Writes", func(t *testing.T) {
+		putErr := put(deletedKey, deletedKey)
+		if putErr != nil {
+			t.Fatalf("error on mari put: %s", putErr.Error())
+		}
+
+		prepareErr := twoPhaseMariInst.PrepareTx("tx-commit", func(tx *mariv2.Tx) error {
+			for _, val := range twoPhaseKeyValPairs[:half] {
+				putTxErr := tx.Put(val.Key, val.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			if kvPair, _ := tx.Get(twoPhaseKeyValPairs[0].Key, nil); kvPair == nil {
+				t.Error("expected prepared transaction to read its own writes")
+			}
+
+			return tx.Delete(deletedKey)
+		})
+
+		if prepareErr != nil {
+			t.Fatalf("error on prepare: %s", prepareErr.Error())
+		}
+
+		for _, val := range twoPhaseKeyValPairs[:half] {
+			if kvPair := get(val.Key); kvPair != nil {
+				t.Fatalf("prepared write visible before commit: %v", kvPair)
+			}
+		}
+
+		if kvPair := get(deletedKey); kvPair == nil {
+			t.Error("prepared delete applied before commit")
+		}
+	})
+
+	t.Run("Test Prepared Keys Are Locked", func(t *testing.T) {
+		putErr := put(twoPhaseKeyValPairs[0].Key, []byte("conflict"))
+		if !errors.Is(putErr, mariv2.ErrKeyLocked) {
+			t.Errorf("expected key locked error on put: actual(%v)", putErr)
+		}
+
+		prepareErr := prepare("tx-conflict", twoPhaseKeyValPairs[:1])
+		if !errors.Is(prepareErr, mariv2.ErrKeyLocked) {
+			t.Errorf("expected key locked error on prepare: actual(%v)", prepareErr)
+		}
+
+		prepareErr = prepare("tx-commit", twoPhaseKeyValPairs[half:])
+		if !errors.Is(prepareErr, mariv2.ErrTxPrepared) {
+			t.Errorf("expected already prepared error: actual(%v)", prepareErr)
+		}
+	})
+
+	t.Run("Test Prepared Survives Reopen", func(t *testing.T) {
+		twoPhaseMariInst.Close()
+
+		var openErr error
+		twoPhaseMariInst, openErr = openTwoPhaseInst()
+		if openErr != nil {
+			t.Fatalf("error reopening mari: %s", openErr.Error())
+		}
+
+		ids, preparedErr := twoPhaseMariInst.PreparedTxs()
+		if preparedErr != nil {
+			t.Fatalf("error listing prepared transactions: %s", preparedErr.Error())
+		}
+
+		if len(ids) != 1 || ids[0] != "tx-commit" {
+			t.Errorf("unexpected prepared transactions: %v", ids)
+		}
+
+		putErr := put(twoPhaseKeyValPairs[0].Key, []byte("conflict"))
+		if !errors.Is(putErr, mariv2.ErrKeyLocked) {
+			t.Errorf("expected key lock to be recovered: actual(%v)", putErr)
+		}
+	})
+
+	t.Run("Test Commit Prepared", func(t *testing.T) {
+		commitErr := twoPhaseMariInst.CommitPrepared("tx-commit")
+		if commitErr != nil {
+			t.Fatalf("error on commit prepared: %s", commitErr.Error())
+		}
+
+		for _, val := range twoPhaseKeyValPairs[:half] {
+			kvPair := get(val.Key)
+			if kvPair == nil || !bytes.Equal(kvPair.Value, val.Value) {
+				t.Fatalf("actual value not equal to expected: actual(%v), expected(%v)", kvPair, val)
+			}
+		}
+
+		if kvPair := get(deletedKey); kvPair != nil {
+			t.Errorf("prepared delete not applied on commit: %v", kvPair)
+		}
+
+		putErr := put(twoPhaseKeyValPairs[0].Key, []byte("unlocked"))
+		if putErr != nil {
+			t.Errorf("expected key to be unlocked after commit: %s", putErr.Error())
+		}
+
+		ids, _ := twoPhaseMariInst.PreparedTxs()
+		if len(ids) != 0 {
+			t.Errorf("expected no prepared transactions: %v", ids)
+		}
+	})
+
+	t.Run("Test Rollback Prepared", func(t *testing.T) {
+		prepareErr := prepare("tx-rollback", twoPhaseKeyValPairs[half:])
+		if prepareErr != nil {
+			t.Fatalf("error on prepare: %s", prepareErr.Error())
+		}
+
+		rollbackErr := twoPhaseMariInst.RollbackPrepared("tx-rollback")
+		if rollbackErr != nil {
+			t.Fatalf("error on rollback prepared: %s", rollbackErr.Error())
+		}
+
+		for _, val := range twoPhaseKeyValPairs[half:] {
+			if kvPair := get(val.Key); kvPair != nil {
+				t.Fatalf("rolled back write visible: %v", kvPair)
+			}
+		}
+
+		putErr := put(twoPhaseKeyValPairs[half].Key, twoPhaseKeyValPairs[half].Value)
+		if putErr != nil {
+			t.Errorf("expected key to be unlocked after rollback: %s", putErr.Error())
+		}
+
+		rollbackErr = twoPhaseMariInst.RollbackPrepared("tx-rollback")
+		if !errors.Is(rollbackErr, mariv2.ErrPreparedTxNotFound) {
+			t.Errorf("expected prepared transaction not found: actual(%v)", rollbackErr)
+		}
+	})
+
+	t.Run("Test Write Before Prepare Is Rejected", func(t *testing.T) {
+		key, prepared := []byte("raced key"), []byte("prepared value")
+
+		written, resume := make(chan struct{}), make(chan struct{})
+		racedErr := make(chan error, 1)
+		go func() {
+			var attempts int
+			racedErr <- twoPhaseMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+				putTxErr := tx.Put(key, []byte("raced value"))
+				if putTxErr != nil {
+					return putTxErr
+				}
+
+				attempts++
+				if attempts == 1 {
+					close(written)
+					<-resume
+				}
+
+				return nil
+			})
+		}()
+
+		<-written
+		prepareErr := prepare("tx-race", []KeyVal{{Key: key, Value: prepared}})
+		close(resume)
+		if prepareErr != nil {
+			t.Fatalf("error on prepare: %s", prepareErr.Error())
+		}
+
+		if putErr := <-racedErr; !errors.Is(putErr, mariv2.ErrKeyLocked) {
+			t.Errorf("expected a write of the key before it was locked to fail at commit: actual(%v)", putErr)
+		}
+
+		commitErr := twoPhaseMariInst.CommitPrepared("tx-race")
+		if commitErr != nil {
+			t.Fatalf("error on commit prepared: %s", commitErr.Error())
+		}
+
+		if kvPair := get(key); kvPair == nil || !bytes.Equal(kvPair.Value, prepared) {
+			t.Errorf("expected the prepared value to be committed: actual(%v)", kvPair)
+		}
+	})
+}
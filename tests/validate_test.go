@@ -0,0 +1,118 @@
+package maritests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirgallo/mariv2"
+)
+
+var validateMariInst *mariv2.Mari
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testvalidate"))
+
+	nodePoolSize := int64(1000)
+	opts := mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testvalidate",
+		NodePoolSize: &nodePoolSize,
+		Validators: []*mariv2.Validator{
+			{Prefix: []byte("json:"), Validate: mariv2.ValidJSON(2)},
+			{Prefix: []byte("user:"), Validate: func(key, value []byte) error {
+				if !bytes.HasPrefix(value, []byte("user")) {
+					return errors.New("expected a user")
+				}
+
+				return nil
+			}},
+		},
+	}
+
+	var openErr error
+	validateMariInst, openErr = mariv2.Open(opts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	fmt.Println("validate test mari initialized")
+}
+
+func TestMariValidators(t *testing.T) {
+	defer validateMariInst.Remove()
+
+	put := func(key, value string) error {
+		return validateMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.Put([]byte(key), []byte(value))
+		})
+	}
+
+	t.Run("Test Valid Writes", func(t *testing.T) {
+		for key, value := range map[string]string{
+			"json:object": `{"name": {"first": "a"}}`,
+			"json:array":  `[1, 2, 3]`,
+			"json:number": `42`,
+			"user:1":      "user one",
+			"other":       "not validated",
+		} {
+			putErr := put(key, value)
+			if putErr != nil {
+				t.Errorf("expected %s to be written: actual(%s)", key, putErr.Error())
+			}
+		}
+	})
+
+	t.Run("Test Invalid Writes", func(t *testing.T) {
+		for key, value := range map[string]string{
+			"json:broken":  `{"name": `,
+			"json:nested":  `{"a": {"b": {"c": 1}}}`,
+			"json:two":     `{} {}`,
+			"json:empty":   ``,
+			"user:invalid": "group one",
+		} {
+			putErr := put(key, value)
+
+			var validationErr *mariv2.ValidationError
+			if !errors.Is(putErr, mariv2.ErrInvalidValue) || !errors.As(putErr, &validationErr) {
+				t.Errorf("expected %s to be rejected by a validator: actual(%v)", key, putErr)
+				continue
+			}
+
+			if string(validationErr.Key) != key {
+				t.Errorf("expected the error to carry the key: actual(%s)", validationErr.Key)
+			}
+		}
+
+		readErr := validateMariInst.ReadTx(func(tx *mariv2.Tx) error {
+			kvPair, getErr := tx.Get([]byte("user:invalid"), nil)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair != nil {
+				return errors.New("expected the rejected write not to be committed")
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			t.Error(readErr.Error())
+		}
+	})
+
+	t.Run("Test Validate With TTL", func(t *testing.T) {
+		putErr := validateMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			return tx.PutWithTTL([]byte("user:ttl"), []byte("group"), time.Minute)
+		})
+
+		if !errors.Is(putErr, mariv2.ErrInvalidValue) {
+			t.Errorf("expected a write with a ttl to be validated: actual(%v)", putErr)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package maritests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirgallo/mariv2"
+)
+
+const VERIFY_INPUT_SIZE = 1000
+const VERIFY_DELETE_SIZE = 100
+
+var verifyOpts mariv2.InitOpts
+var verifyLastKeyVal KeyVal
+
+func init() {
+	os.Remove(filepath.Join(os.TempDir(), "testverify"))
+
+	nodePoolSize := int64(1000)
+	verifyOpts = mariv2.InitOpts{
+		Filepath:     os.TempDir(),
+		FileName:     "testverify",
+		NodePoolSize: &nodePoolSize,
+	}
+
+	verifyMariInst, openErr := mariv2.Open(verifyOpts)
+	if openErr != nil {
+		panic(openErr.Error())
+	}
+
+	keyValPairs := make([]KeyVal, VERIFY_INPUT_SIZE)
+	for idx := range keyValPairs {
+		randomBytes, _ := GenerateRandomBytes(32)
+		keyValPairs[idx] = KeyVal{Key: randomBytes, Value: randomBytes}
+	}
+
+	chunks, chunkErr := Chunk(keyValPairs, VERIFY_INPUT_SIZE/4)
+	if chunkErr != nil {
+		panic(chunkErr.Error())
+	}
+
+	for _, chunk := range chunks {
+		putErr := verifyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+			for _, val := range chunk {
+				putTxErr := tx.Put(val.Key, val.Value)
+				if putTxErr != nil {
+					return putTxErr
+				}
+			}
+
+			return nil
+		})
+
+		if putErr != nil {
+			panic(putErr.Error())
+		}
+	}
+
+	delErr := verifyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		for _, val := range keyValPairs[:VERIFY_DELETE_SIZE] {
+			delTxErr := tx.Delete(val.Key)
+			if delTxErr != nil {
+				return delTxErr
+			}
+		}
+
+		return nil
+	})
+
+	if delErr != nil {
+		panic(delErr.Error())
+	}
+
+	randomBytes, _ := GenerateRandomBytes(32)
+	verifyLastKeyVal = KeyVal{Key: randomBytes, Value: []byte("last")}
+	putErr := verifyMariInst.UpdateTx(func(tx *mariv2.Tx) error {
+		return tx.Put(verifyLastKeyVal.Key, verifyLastKeyVal.Value)
+	})
+
+	if putErr != nil {
+		panic(putErr.Error())
+	}
+
+	closeErr := verifyMariInst.Close()
+	if closeErr != nil {
+		panic(closeErr.Error())
+	}
+
+	fmt.Println("verify test mari initialized")
+}
+
+func TestMariVerify(t *testing.T) {
+	defer os.Remove(filepath.Join(os.TempDir(), "testverify"))
+
+	t.Run("Test Verify", func(t *testing.T) {
+		openValidation := mariv2.OpenValidationFull
+		opts := verifyOpts
+		opts.OpenValidation = &openValidation
+
+		verifyMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari with full validation: %s", openErr.Error())
+		}
+
+		defer verifyMariInst.Close()
+
+		verifyErr := verifyMariInst.Verify()
+		if verifyErr != nil {
+			t.Errorf("error verifying mari: %s", verifyErr.Error())
+		}
+	})
+
+	t.Run("Test Background IO Limit", func(t *testing.T) {
+		opts := verifyOpts
+		opts.IOLimiter = mariv2.NewIOLimiter(1<<20, 4096)
+
+		verifyMariInst, openErr := mariv2.Open(opts)
+		if openErr != nil {
+			t.Fatalf("error opening mari: %s", openErr.Error())
+		}
+
+		defer verifyMariInst.Close()
+
+		verifyErr := verifyMariInst.Verify()
+		if verifyErr != nil {
+			t.Errorf("error verifying mari: %s", verifyErr.Error())
+		}
+
+		stats, statsErr := verifyMariInst.Stats()
+		if statsErr != nil {
+			t.Fatalf("error getting stats: %s", statsErr.Error())
+		}
+
+		if stats.BackgroundIO.Rate != 1<<20 || stats.BackgroundIO.Bytes == 0 {
+			t.Errorf("expected verify to be counted by the limiter: %+v", stats.BackgroundIO)
+		}
+
+		if stats.BackgroundIO.Waited == 0 {
+			t.Errorf("expected verify past the burst to wait on the limiter: %+v", stats.BackgroundIO)
+		}
+	})
+
+	t.Run("Test Verify File", func(t *testing.T) {
+		for _, deep := range []bool{false, true} {
+			report, verifyErr := mariv2.VerifyFile(verifyOpts, deep)
+			if verifyErr != nil {
+				t.Fatalf("error verifying file: %s", verifyErr.Error())
+			}
+
+			if !report.OK || len(report.Issues) != 0 || report.Deep != deep {
+				t.Errorf("expected ok report, got: %+v", report)
+			}
+
+			if report.Version == 0 || report.FileSize == 0 {
+				t.Errorf("expected report with version and file size, got: %+v", report)
+			}
+		}
+
+		opts := verifyOpts
+		opts.FileName = "testverifymissing"
+
+		_, verifyErr := mariv2.VerifyFile(opts, true)
+		if !errors.Is(verifyErr, os.ErrNotExist) {
+			t.Errorf("expected not exist error, got: %v", verifyErr)
+		}
+
+		_, statErr := os.Stat(filepath.Join(os.TempDir(), "testverifymissing"))
+		if !errors.Is(statErr, os.ErrNotExist) {
+			t.Errorf("expected verify not to create the file, got: %v", statErr)
+		}
+	})
+
+	t.Run("Test Open Validation Modes", func(t *testing.T) {
+		file, openErr := os.OpenFile(filepath.Join(os.TempDir(), "testverify"), os.O_RDWR, 0600)
+		if openErr != nil {
+			t.Fatalf("error opening file: %s", openErr.Error())
+		}
+
+		sEndSerialized := make([]byte, mariv2.OffsetSize64)
+		_, readErr := file.ReadAt(sEndSerialized, mariv2.MetaEndSerializedOffset)
+		if readErr != nil {
+			t.Fatalf("error reading end of serialized data: %s", readErr.Error())
+		}
+
+		serialized := make([]byte, binary.LittleEndian.Uint64(sEndSerialized))
+		_, readErr = file.ReadAt(serialized, 0)
+		if readErr != nil {
+			t.Fatalf("error reading serialized data: %s", readErr.Error())
+		}
+
+		// the key is written once, in the leaf of the last version, which is below the root
+		keyOffset := int64(bytes.LastIndex(serialized, verifyLastKeyVal.Key))
+		_, writeErr := file.WriteAt([]byte{^verifyLastKeyVal.Key[0]}, keyOffset)
+		if writeErr != nil {
+			t.Fatalf("error corrupting key: %s", writeErr.Error())
+		}
+
+		file.Close()
+
+		for _, openValidation := range []mariv2.OpenValidation{mariv2.OpenValidationFast, mariv2.OpenValidationRoot} {
+			opts := verifyOpts
+			opts.OpenValidation = &openValidation
+
+			verifyMariInst, openErr := mariv2.Open(opts)
+			if openErr != nil {
+				t.Fatalf("error opening mari with validation %d: %s", openValidation, openErr.Error())
+			}
+
+			verifyErr := verifyMariInst.Verify()
+			if !errors.Is(verifyErr, mariv2.ErrCorrupt) {
+				t.Errorf("expected corrupt error on verify, got: %v", verifyErr)
+			}
+
+			verifyMariInst.Close()
+		}
+
+		openValidation := mariv2.OpenValidationFull
+		opts := verifyOpts
+		opts.OpenValidation = &openValidation
+
+		_, openErr = mariv2.Open(opts)
+		if !errors.Is(openErr, mariv2.ErrCorrupt) {
+			t.Fatalf("expected corrupt error on open, got: %v", openErr)
+		}
+
+		var regionErr *mariv2.RegionError
+		if !errors.As(openErr, &regionErr) {
+			t.Fatalf("expected region error, got: %v", openErr)
+		}
+
+		t.Log("corrupt error:", openErr)
+
+		report, verifyErr := mariv2.VerifyFile(verifyOpts, true)
+		if verifyErr != nil {
+			t.Fatalf("error verifying file: %s", verifyErr.Error())
+		}
+
+		if report.OK || len(report.Issues) != 1 || report.Issues[0].Prefix == "" || report.Issues[0].ChecksumMismatch {
+			t.Fatalf("expected report with the corrupt subtree, got: %+v", report)
+		}
+
+		t.Logf("corrupt issue: %+v", report.Issues[0])
+	})
+}
@@ -0,0 +1,80 @@
+package mariv2
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Throttle
+
+// newOpsThrottle
+//
+//	Create a token bucket allowing a rate of transactions per second, with a burst of one second at the rate.
+//	A rate of 0 or less does not limit, so nil is returned.
+func newOpsThrottle(rate int64) *opsThrottle {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &opsThrottle{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// take
+//
+//	Take a token for a transaction, returning a ThrottledError with the time until the next token if the bucket is empty.
+//	Unlike the background I/O limiter, a transaction never waits, so a caller over its limit can not hold up the callers within theirs.
+func (throttle *opsThrottle) take(op string) error {
+	if throttle == nil {
+		return nil
+	}
+
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+
+	now := time.Now()
+	throttle.tokens = min(throttle.tokens+now.Sub(throttle.last).Seconds()*float64(throttle.rate), float64(throttle.rate))
+	throttle.last = now
+
+	if throttle.tokens < 1 {
+		atomic.AddUint64(&throttle.throttled, 1)
+		retryAfter := time.Duration((1 - throttle.tokens) / float64(throttle.rate) * float64(time.Second))
+		return &ThrottledError{Op: op, RetryAfter: retryAfter}
+	}
+
+	throttle.tokens--
+	return nil
+}
+
+// limit
+//
+//	Get the transactions per second allowed, which is 0 if the throttle is disabled.
+func (throttle *opsThrottle) limit() int64 {
+	if throttle == nil {
+		return 0
+	}
+
+	return throttle.rate
+}
+
+// rejected
+//
+//	Get the total transactions rejected, which is 0 if the throttle is disabled.
+func (throttle *opsThrottle) rejected() uint64 {
+	if throttle == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&throttle.throttled)
+}
+
+// throttleStats
+//
+//	Snapshot the limits on transactions per second and the transactions rejected.
+func (mariInst *Mari) throttleStats() ThrottleStats {
+	return ThrottleStats{
+		ReadRate:        mariInst.readThrottle.limit(),
+		WriteRate:       mariInst.writeThrottle.limit(),
+		ReadsThrottled:  mariInst.readThrottle.rejected(),
+		WritesThrottled: mariInst.writeThrottle.rejected(),
+	}
+}
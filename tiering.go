@@ -0,0 +1,589 @@
+package mariv2
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Tiering
+
+// TierColdValues
+//
+//	Move the values that have not been read or written for ColdAfter to the cold file, returning the values moved.
+//	A value is written when the timestamp of its key was issued, and read when it was last returned by Get, Range, Iterate, or an iterator since the instance was opened.
+//	Reads before the instance was opened are only known with AccessPrefixLength, where a value is kept while the last access recorded for its prefix is since ColdAfter. Otherwise, after a restart values are judged by when they were written until they are read again.
+//	Values are compressed and appended to the cold file, which is synced before each value is replaced in the trie by a stub of ColdStubSize bytes, so the memory map only shrinks once compaction drops the versions still holding the value.
+//	Replacing a value commits a new version of its key, like rewriting the same value, annotated with TieringAnnotation.
+//	A key written while its value is being moved keeps the new value, and keys with a ttl keep their ttl. Without ColdAfter, or on a follower, nothing is moved.
+func (mariInst *Mari) TierColdValues() (int, error) {
+	tier := mariInst.tiering
+	if tier == nil || tier.coldAfter <= 0 || atomic.LoadUint32(&mariInst.isFollower) == 1 {
+		return 0, nil
+	}
+
+	tier.lock.Lock()
+	defer tier.lock.Unlock()
+
+	cutoff := time.Now().Add(-tier.coldAfter)
+	tier.accesses.prune(cutoff)
+
+	var moved int
+	var startKey []byte
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return moved, nil
+		default:
+		}
+
+		var candidates []*KeyValuePair
+		var exhausted bool
+		readErr := mariInst.ReadTx(func(tx *Tx) error {
+			kvPairs, scanErr := tx.scanChunks(0, startKey, nil, TieringBatchSize, nil, nil, false)
+			if scanErr != nil {
+				return scanErr
+			}
+
+			exhausted = len(kvPairs) < TieringBatchSize
+			if len(kvPairs) > 0 {
+				startKey = nextKey(bytes.Clone(kvPairs[len(kvPairs)-1].Key))
+			}
+
+			for _, kvPair := range kvPairs {
+				if tier.isCold(kvPair, cutoff, mariInst.accessTracker) {
+					candidates = append(candidates, &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: bytes.Clone(kvPair.Key), Value: bytes.Clone(kvPair.Value)})
+				}
+			}
+
+			return nil
+		})
+
+		if readErr != nil {
+			return moved, readErr
+		}
+
+		if len(candidates) > 0 {
+			batchMoved, moveErr := mariInst.moveCold(candidates)
+			moved += batchMoved
+			if moveErr != nil {
+				return moved, moveErr
+			}
+		}
+
+		if exhausted {
+			return moved, nil
+		}
+	}
+}
+
+// handleTiering
+//
+//	Move cold values to the cold file on the tiering interval until the instance is closed.
+func (mariInst *Mari) handleTiering() {
+	defer mariInst.workers.Done()
+
+	ticker := time.NewTicker(mariInst.tiering.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-ticker.C:
+			moved, tierErr := mariInst.TierColdValues()
+			if tierErr != nil {
+				mariInst.logger.Warn("error moving cold values", "moved", moved, "error", tierErr)
+				continue
+			}
+
+			if moved > 0 {
+				mariInst.logger.Info("moved cold values", "moved", moved)
+			}
+		}
+	}
+}
+
+// openTiering
+//
+//	Open the cold file if values were moved to it before, or if values can be moved with ColdAfter.
+//	The id that starts every stub is read from TieringBucket, and is created on the first open with ColdAfter, so an instance opened without ColdAfter still reads the values moved before.
+func (mariInst *Mari) openTiering(opts InitOpts, fileName string) error {
+	var coldAfter time.Duration
+	if opts.ColdAfter != nil {
+		coldAfter = *opts.ColdAfter
+	}
+
+	var id []byte
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		kvPair, getErr := tx.GetSystem(TieringBucket, []byte("id"))
+		if getErr != nil || kvPair == nil {
+			return getErr
+		}
+
+		id = bytes.Clone(kvPair.Value)
+		return nil
+	})
+
+	if readErr != nil {
+		return readErr
+	}
+
+	if id == nil && (coldAfter <= 0 || mariInst.anonymous || atomic.LoadUint32(&mariInst.isFollower) == 1) {
+		return nil
+	}
+
+	if id == nil {
+		id = make([]byte, ColdIDSize)
+		_, randErr := rand.Read(id)
+		if randErr != nil {
+			return randErr
+		}
+
+		updateErr := mariInst.updateTx(func(tx *Tx) error {
+			return tx.PutSystem(TieringBucket, []byte("id"), id)
+		})
+
+		if updateErr != nil {
+			return updateErr
+		}
+	}
+
+	if len(id) != ColdIDSize {
+		return fmt.Errorf("cold file id is %d bytes, expected %d", len(id), ColdIDSize)
+	}
+
+	file, openErr := os.OpenFile(fileName+ColdFileExt, os.O_RDWR|os.O_CREATE, mariInst.fileMode)
+	if openErr != nil {
+		return openErr
+	}
+
+	stat, statErr := file.Stat()
+	if statErr != nil {
+		file.Close()
+		return statErr
+	}
+
+	tier := &tiering{id: id, file: file, size: stat.Size(), openedAt: time.Now(), coldAfter: coldAfter, minValueSize: DefaultColdMinValueSize, interval: DefaultTieringInterval}
+	if opts.ColdMinValueSize != nil {
+		tier.minValueSize = max(*opts.ColdMinValueSize, ColdStubSize+1)
+	}
+
+	if opts.TieringInterval != nil && *opts.TieringInterval > 0 {
+		tier.interval = *opts.TieringInterval
+	}
+
+	if coldAfter > 0 {
+		tier.accesses = &accessTimes{seed: maphash.MakeSeed(), reads: make(map[uint64]int64)}
+	}
+
+	mariInst.tiering = tier
+	return nil
+}
+
+// moveCold
+//
+//	Append the values to the cold file and sync it, then replace each value in the trie with its stub, returning the values replaced.
+//	The stubs are written in a single read-write transaction that is retried on the latest version instead of rebased, and a key whose version changed since it was scanned is skipped, so a concurrent write is never replaced.
+func (mariInst *Mari) moveCold(candidates []*KeyValuePair) (int, error) {
+	tier := mariInst.tiering
+
+	stubs := make([][]byte, len(candidates))
+	var records []byte
+	offset := atomic.LoadInt64(&tier.size)
+	for idx, candidate := range candidates {
+		record, compressErr := compressColdValue(candidate.Value)
+		if compressErr != nil {
+			return 0, compressErr
+		}
+
+		stub := &coldStub{offset: uint64(offset) + uint64(len(records)), length: uint32(len(record)), checksum: checksumValue(candidate.Value), version: candidate.Version, timestamp: candidate.Timestamp}
+		stubs[idx] = tier.encodeStub(stub)
+		records = append(records, record...)
+	}
+
+	_, writeErr := tier.file.WriteAt(records, offset)
+	if writeErr != nil {
+		return 0, writeErr
+	}
+
+	syncErr := tier.file.Sync()
+	if syncErr != nil {
+		return 0, syncErr
+	}
+
+	atomic.StoreInt64(&tier.size, offset+int64(len(records)))
+
+	var moved int
+	updateErr := mariInst.updateTx(func(tx *Tx) error {
+		tx.noRebase = true
+		moved = 0
+
+		for idx, candidate := range candidates {
+			leaf, getErr := tx.store.getLeafRecursive(tx.root, candidate.Key, 0)
+			if getErr != nil {
+				return getErr
+			}
+
+			if leaf == nil || leaf.version != candidate.Version {
+				continue
+			}
+
+			putErr := tx.putStub(candidate.Key, stubs[idx])
+			if putErr != nil {
+				return putErr
+			}
+
+			moved++
+		}
+
+		if moved == 0 {
+			return nil
+		}
+
+		return tx.SetAnnotation(TieringAnnotation, strconv.Itoa(moved))
+	})
+
+	if updateErr != nil {
+		return 0, updateErr
+	}
+
+	atomic.AddUint64(&mariInst.tieredValues, uint64(moved))
+	return moved, nil
+}
+
+// putStub
+//
+//	Replace the value of a key with its stub, without clearing the ttl of the key like put does.
+func (tx *Tx) putStub(key, stub []byte) error {
+	version := loadINodeFromPointer(tx.root).version
+	_, putErr := tx.store.putRecursive(tx.root, key, stub, version, 0, 0)
+	if putErr != nil {
+		return putErr
+	}
+
+	tx.writeSet = append(tx.writeSet, &txWrite{key: key, value: stub})
+	return nil
+}
+
+// thaw
+//
+//	Replace a stub with the value it points to in the cold file, so cold values are read like any other.
+//	Key-value pairs that are not stubs are returned as is.
+func (mariInst *Mari) thaw(kvPair *KeyValuePair) (*KeyValuePair, error) {
+	if kvPair == nil || !mariInst.tiering.isStub(kvPair.Value) {
+		return kvPair, nil
+	}
+
+	stub := mariInst.tiering.decodeStub(kvPair.Value)
+	record := make([]byte, stub.length)
+	_, readErr := mariInst.tiering.file.ReadAt(record, int64(stub.offset))
+	if readErr != nil {
+		return nil, fmt.Errorf("error reading cold value of key %s: %w", printableKey(kvPair.Key), readErr)
+	}
+
+	value, decompressErr := decompressColdValue(record)
+	if decompressErr != nil {
+		return nil, fmt.Errorf("error decompressing cold value of key %s: %w", printableKey(kvPair.Key), decompressErr)
+	}
+
+	if checksumValue(value) != stub.checksum {
+		return nil, fmt.Errorf("%w: key %s at offset %d of the cold file", ErrColdValueMismatch, printableKey(kvPair.Key), stub.offset)
+	}
+
+	atomic.AddUint64(&mariInst.coldReads, 1)
+	return &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: kvPair.Key, Value: value}, nil
+}
+
+// thawChange
+//
+//	Replace a stub scanned as a change since a version with the value it points to, with the version and timestamp the value was written at.
+//	A stub of a value written before the version was only moved since, so nil is returned since the key did not change.
+func (mariInst *Mari) thawChange(kvPair *KeyValuePair, minVersion uint64) (*KeyValuePair, error) {
+	if !mariInst.tiering.isStub(kvPair.Value) {
+		return kvPair, nil
+	}
+
+	if mariInst.tiering.decodeStub(kvPair.Value).version < minVersion {
+		return nil, nil
+	}
+
+	return mariInst.thawWritten(kvPair)
+}
+
+// thawWritten
+//
+//	Replace a stub with the value it points to, with the version and timestamp the value was written at instead of the version it was moved at.
+//	Only used to compare writes across instances, since reads within the instance see the version of the stub, which transactions are validated against.
+func (mariInst *Mari) thawWritten(kvPair *KeyValuePair) (*KeyValuePair, error) {
+	if kvPair == nil || !mariInst.tiering.isStub(kvPair.Value) {
+		return kvPair, nil
+	}
+
+	stub := mariInst.tiering.decodeStub(kvPair.Value)
+	thawed, thawErr := mariInst.thaw(kvPair)
+	if thawErr != nil {
+		return nil, thawErr
+	}
+
+	thawed.Version, thawed.Timestamp = stub.version, stub.timestamp
+	return thawed, nil
+}
+
+// getWritten
+//
+//	Retrieve the key-value pair for a key like get, with the version and timestamp a value moved to the cold file was written at, so moving a value is not mistaken for a write of the key.
+func (tx *Tx) getWritten(key []byte) (*KeyValuePair, error) {
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	tx.recordRead(key)
+	kvPair, getErr := tx.store.getRecursive(tx.root, key, 0, identityTransform)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	return tx.store.thawWritten(kvPair)
+}
+
+// thawPairs
+//
+//	Replace the stubs of key-value pairs with their cold values in place.
+func (mariInst *Mari) thawPairs(kvPairs []*KeyValuePair) ([]*KeyValuePair, error) {
+	if mariInst.tiering == nil {
+		return kvPairs, nil
+	}
+
+	for idx, kvPair := range kvPairs {
+		thawed, thawErr := mariInst.thaw(kvPair)
+		if thawErr != nil {
+			return nil, thawErr
+		}
+
+		kvPairs[idx] = thawed
+	}
+
+	return kvPairs, nil
+}
+
+// closeTiering
+//
+//	Close the cold file, if it was opened.
+func (mariInst *Mari) closeTiering() error {
+	if mariInst.tiering == nil {
+		return nil
+	}
+
+	return mariInst.tiering.file.Close()
+}
+
+// removeTiering
+//
+//	Remove the cold file, if it was opened, once the instance is closed.
+func (mariInst *Mari) removeTiering() error {
+	if mariInst.tiering == nil {
+		return nil
+	}
+
+	return os.Remove(mariInst.tiering.file.Name())
+}
+
+// fileSize
+//
+//	Get the size of the cold file, or 0 if it was not opened.
+func (tier *tiering) fileSize() int64 {
+	if tier == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&tier.size)
+}
+
+// isCold
+//
+//	Determine whether a key-value pair scanned by a tiering pass should be moved, which is a value of at least the min value size that is not a stub, not reserved, and was neither written nor read since the cutoff.
+//	If the cutoff is before the cold file was opened, the last access recorded for the prefix of the key before the open is also checked, since reads are only tracked from then.
+func (tier *tiering) isCold(kvPair *KeyValuePair, cutoff time.Time, tracker *accessTracker) bool {
+	if len(kvPair.Value) < tier.minValueSize || isReservedKey(kvPair.Key) || tier.isStub(kvPair.Value) {
+		return false
+	}
+
+	if !HLCTime(kvPair.Timestamp).Before(cutoff) {
+		return false
+	}
+
+	if cutoff.Before(tier.openedAt) && tracker.recordedSince(kvPair.Key, cutoff) {
+		return false
+	}
+
+	return !tier.accesses.readSince(kvPair.Key, cutoff)
+}
+
+// isStub
+//
+//	Determine whether a value is a stub of a value moved to the cold file, which is ColdStubSize bytes starting with the id of the instance file.
+func (tier *tiering) isStub(value []byte) bool {
+	return tier != nil && len(value) == ColdStubSize && bytes.HasPrefix(value, tier.id)
+}
+
+// encodeStub
+//
+//	Serialize a stub as the id of the instance file, the offset (8 bytes), length (4 bytes), checksum (4 bytes), version (8 bytes), and timestamp (8 bytes).
+func (tier *tiering) encodeStub(stub *coldStub) []byte {
+	sStub := make([]byte, 0, ColdStubSize)
+	sStub = append(sStub, tier.id...)
+	sStub = append(sStub, serializeUint64(stub.offset)...)
+	sStub = append(sStub, serializeUint32(stub.length)...)
+	sStub = append(sStub, serializeUint32(stub.checksum)...)
+	sStub = append(sStub, serializeUint64(stub.version)...)
+	return append(sStub, serializeUint64(stub.timestamp)...)
+}
+
+// decodeStub
+//
+//	Deserialize a stub, which has already been checked with isStub.
+func (tier *tiering) decodeStub(sStub []byte) *coldStub {
+	sStub = sStub[ColdIDSize:]
+
+	stub := &coldStub{}
+	stub.offset, _ = deserializeUint64(sStub[:8])
+	stub.length, _ = deserializeUint32(sStub[8:12])
+	stub.checksum, _ = deserializeUint32(sStub[12:16])
+	stub.version, _ = deserializeUint64(sStub[16:24])
+	stub.timestamp, _ = deserializeUint64(sStub[24:32])
+	return stub
+}
+
+// recordAccess
+//
+//	Record a read of a key, if values can be moved to the cold file.
+func (tier *tiering) recordAccess(key []byte) {
+	if tier == nil || tier.accesses == nil {
+		return
+	}
+
+	tier.accesses.record(time.Now(), key)
+}
+
+// recordAccesses
+//
+//	Record a read of every key returned by a scan, if values can be moved to the cold file.
+func (tier *tiering) recordAccesses(kvPairs []*KeyValuePair) {
+	if tier == nil || tier.accesses == nil || len(kvPairs) == 0 {
+		return
+	}
+
+	keys := make([][]byte, len(kvPairs))
+	for idx, kvPair := range kvPairs {
+		keys[idx] = kvPair.Key
+	}
+
+	tier.accesses.record(time.Now(), keys...)
+}
+
+// record
+//
+//	Record the time keys were read.
+func (accesses *accessTimes) record(now time.Time, keys ...[]byte) {
+	accesses.lock.Lock()
+	defer accesses.lock.Unlock()
+
+	for _, key := range keys {
+		accesses.reads[maphash.Bytes(accesses.seed, key)] = now.UnixMilli()
+	}
+}
+
+// readSince
+//
+//	Determine whether a key was read at or after a time. A key sharing its hash with a key read since is also considered read, which only keeps its value from being moved.
+func (accesses *accessTimes) readSince(key []byte, since time.Time) bool {
+	if accesses == nil {
+		return false
+	}
+
+	accesses.lock.Lock()
+	defer accesses.lock.Unlock()
+
+	lastRead, ok := accesses.reads[maphash.Bytes(accesses.seed, key)]
+	return ok && lastRead >= since.UnixMilli()
+}
+
+// prune
+//
+//	Drop the keys last read before a time, since they are judged by when they were written again, so the table only holds keys read within ColdAfter.
+func (accesses *accessTimes) prune(before time.Time) {
+	if accesses == nil {
+		return
+	}
+
+	accesses.lock.Lock()
+	defer accesses.lock.Unlock()
+
+	cutoff := before.UnixMilli()
+	for hash, lastRead := range accesses.reads {
+		if lastRead < cutoff {
+			delete(accesses.reads, hash)
+		}
+	}
+}
+
+// compressColdValue
+//
+//	Compress a value with flate, prefixed with the kind of value, or store it as is if it does not compress.
+func compressColdValue(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(coldValueFlate)
+
+	writer, writerErr := flate.NewWriter(&buf, flate.BestCompression)
+	if writerErr != nil {
+		return nil, writerErr
+	}
+
+	_, writeErr := writer.Write(value)
+	if writeErr != nil {
+		return nil, writeErr
+	}
+
+	closeErr := writer.Close()
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	if buf.Len() > len(value) {
+		return append([]byte{coldValueRaw}, value...), nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompressColdValue
+//
+//	Decompress a value read from the cold file by its kind.
+func decompressColdValue(record []byte) ([]byte, error) {
+	if len(record) == 0 {
+		return nil, errors.New("cold value is empty")
+	}
+
+	switch record[0] {
+	case coldValueRaw:
+		return record[1:], nil
+	case coldValueFlate:
+		return io.ReadAll(flate.NewReader(bytes.NewReader(record[1:])))
+	default:
+		return nil, fmt.Errorf("unknown cold value kind %d", record[0])
+	}
+}
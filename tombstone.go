@@ -0,0 +1,166 @@
+package mariv2
+
+import "bytes"
+
+//============================================= Mari Tombstones
+
+// GetTombstone
+//
+//	Get the tombstone of a deleted key, with the version and timestamp of the delete, or nil if the key was not deleted since it was last written or compacted.
+//	Tombstones are only written when the instance is opened with Tombstones.
+func (tx *Tx) GetTombstone(key []byte) (_ *KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("GetTombstone", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	key = tx.store.normalizeKey(key)
+	kvPair, getErr := tx.get(tombstoneKey(key))
+	if getErr != nil || kvPair == nil {
+		return nil, getErr
+	}
+
+	return &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: key, Deleted: true}, nil
+}
+
+// includeTombstones
+//
+//	Check if the options of a range include the tombstones of deleted keys.
+func includeTombstones(opts *RangeOpts) bool {
+	return opts != nil && opts.IncludeTombstones != nil && *opts.IncludeTombstones
+}
+
+// mergeTombstones
+//
+//	Merge the tombstones of the keys deleted between the start and end key into the results of a range, in key order.
+//	A key is either live or has a tombstone, since writing a key clears its tombstone, so a tombstone is placed before the first result with a greater key.
+//	The min version of the options applies to the version of the delete.
+func (tx *Tx) mergeTombstones(kvPairs []*KeyValuePair, startKey, endKey []byte, opts *RangeOpts) ([]*KeyValuePair, error) {
+	tombstoneEnd := bucketEndKey(tombstoneKeyPrefix)
+	if endKey != nil {
+		tombstoneEnd = tombstoneKey(endKey)
+	}
+
+	tombstones, rangeErr := tx.rangeKvPairs(tombstoneKey(startKey), tombstoneEnd, &RangeOpts{MinVersion: opts.MinVersion})
+	if rangeErr != nil || len(tombstones) == 0 {
+		return kvPairs, rangeErr
+	}
+
+	arena := newScanArena(opts)
+	merged := make([]*KeyValuePair, 0, len(kvPairs)+len(tombstones))
+	for _, tombstone := range tombstones {
+		key := tombstone.Key[len(tombstoneKeyPrefix):]
+		for len(kvPairs) > 0 && bytes.Compare(kvPairs[0].Key, key) < 0 {
+			merged = append(merged, kvPairs[0])
+			kvPairs = kvPairs[1:]
+		}
+
+		deleted := arena.newPair(tombstone.Version, tombstone.Timestamp, key, nil)
+		deleted.Deleted = true
+		merged = append(merged, deleted)
+	}
+
+	return append(merged, kvPairs...), nil
+}
+
+// liveTransform
+//
+//	Wrap a transform so it is only applied to live key-value pairs, passing tombstones through unchanged.
+func liveTransform(transform Transform) Transform {
+	return func(kvPair *KeyValuePair) *KeyValuePair {
+		if kvPair.Deleted {
+			return kvPair
+		}
+
+		return transform(kvPair)
+	}
+}
+
+// putTombstone
+//
+//	With Tombstones, write the tombstone of a user key being deleted, if the key exists.
+//	The tombstone is an empty value, so its leaf carries the version and timestamp of the delete, including when the transaction is rebased.
+func (tx *Tx) putTombstone(key []byte) error {
+	if !tx.store.tombstones || isReservedKey(key) {
+		return nil
+	}
+
+	kvPair, getErr := tx.get(key)
+	if getErr != nil || kvPair == nil {
+		return getErr
+	}
+
+	return tx.put(tombstoneKey(key), nil)
+}
+
+// clearTombstone
+//
+//	With Tombstones, delete the tombstone of a user key being written, if it has one.
+func (tx *Tx) clearTombstone(key []byte) error {
+	if !tx.store.tombstones || isReservedKey(key) {
+		return nil
+	}
+
+	kvPair, getErr := tx.get(tombstoneKey(key))
+	if getErr != nil || kvPair == nil {
+		return getErr
+	}
+
+	return tx.delete(tombstoneKey(key))
+}
+
+// purgeTombstones
+//
+//	Delete the tombstones written before the last compaction, which are retained only until compaction.
+//	Compaction writes every leaf at version 0 and every later commit is at a greater version, so the tombstones at version 0 are the ones to purge.
+//	The tombstones are checked in a read only transaction first, so nothing is committed when there are none.
+func (mariInst *Mari) purgeTombstones() error {
+	var compacted []*KeyValuePair
+	readErr := mariInst.ReadTx(func(tx *Tx) error {
+		tombstones, rangeErr := tx.rangeKvPairs(tombstoneKeyPrefix, bucketEndKey(tombstoneKeyPrefix), nil)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for _, tombstone := range tombstones {
+			if tombstone.Version == 0 {
+				compacted = append(compacted, &KeyValuePair{Key: bytes.Clone(tombstone.Key)})
+			}
+		}
+
+		return nil
+	})
+
+	if readErr != nil || len(compacted) == 0 {
+		return readErr
+	}
+
+	return mariInst.UpdateTx(func(tx *Tx) error {
+		for _, tombstone := range compacted {
+			kvPair, getErr := tx.get(tombstone.Key)
+			if getErr != nil {
+				return getErr
+			}
+
+			if kvPair == nil || kvPair.Version != 0 {
+				continue
+			}
+
+			delErr := tx.delete(tombstone.Key)
+			if delErr != nil {
+				return delErr
+			}
+		}
+
+		return nil
+	})
+}
+
+// tombstoneKey
+//
+//	Get the key of the tombstone for a deleted key.
+func tombstoneKey(key []byte) []byte {
+	return append(bytes.Clone(tombstoneKeyPrefix), key...)
+}
@@ -3,8 +3,10 @@ package mariv2
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -15,8 +17,47 @@ import (
 //	Creates a new transaction.
 //	The current root is operated on for "Optimistic Concurrency Control".
 //	If isWrite is false, then write operations in the read only transaction will fail.
+//	The version of the root is pinned as the snapshot of the transaction, which every scan is bounded by.
+//	The root leaf is stamped on every commit, so its timestamp is the commit timestamp of the snapshot.
 func newTx(mariInst *Mari, rootPtr *unsafe.Pointer, isWrite bool) *Tx {
-	return &Tx{store: mariInst, root: rootPtr, isWrite: isWrite}
+	root := loadINodeFromPointer(rootPtr)
+	return &Tx{store: mariInst, root: rootPtr, isWrite: isWrite, snapshotVersion: root.version, snapshotTimestamp: root.leaf.timestamp}
+}
+
+// SnapshotVersion
+//
+//	Get the version pinned when the transaction started.
+//	Every read in the transaction observes the trie as of this version, along with the writes of the transaction itself for read-write transactions, which are written at this version.
+func (tx *Tx) SnapshotVersion() uint64 {
+	return tx.snapshotVersion
+}
+
+// SnapshotTimestamp
+//
+//	Get the hybrid logical clock timestamp the snapshot of the transaction was committed at.
+//	Unlike the version, which compaction resets to 0, the timestamp is kept by compaction and increases with every commit, so it identifies the snapshot across compactions.
+//	Pass it to UpdateTxIf to commit only if nothing was committed since the snapshot.
+func (tx *Tx) SnapshotTimestamp() uint64 {
+	return tx.snapshotTimestamp
+}
+
+// CommitVersion
+//
+//	Get the version a read-write transaction was committed at, or 0 until it is committed.
+//	Compaction resets the version, so it is not a causality token across compactions. Use CommitTimestamp with ReadTxAtLeast instead.
+//	For UpdateTx, capture the transaction passed to the transaction function and get the version once UpdateTx returns, since a retry passes a new transaction.
+func (tx *Tx) CommitVersion() uint64 {
+	return tx.commitVersion
+}
+
+// CommitTimestamp
+//
+//	Get the hybrid logical clock timestamp a read-write transaction was committed at, or 0 until it is committed.
+//	The timestamp can be handed to clients as a causality token, so a later ReadTxAtLeast, on this instance or a follower, observes the commit.
+//	Compaction keeps the timestamp of the latest commit, so a token issued before a compaction is still reached after it.
+//	For UpdateTx, capture the transaction passed to the transaction function and get the timestamp once UpdateTx returns, since a retry passes a new transaction.
+func (tx *Tx) CommitTimestamp() uint64 {
+	return tx.commitTimestamp
 }
 
 // ReadTx
@@ -24,7 +65,12 @@ func newTx(mariInst *Mari, rootPtr *unsafe.Pointer, isWrite bool) *Tx {
 //	Handles all read related operations.
 //	It gets the latest version of the ordered array mapped trie and starts from that offset in the mem-map.
 //	Get is concurrent since it will perform the operation on an existing path, so new paths can be written at the same time with new versions.
+//	If the instance is over ReadOpsPerSecond, the transaction is rejected with a ThrottledError.
 func (mariInst *Mari) ReadTx(txOps func(tx *Tx) error) error {
+	if throttleErr := mariInst.readThrottle.take("ReadTx"); throttleErr != nil {
+		return throttleErr
+	}
+
 	var readTxErr error
 	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
 		runtime.Gosched()
@@ -33,12 +79,29 @@ func (mariInst *Mari) ReadTx(txOps func(tx *Tx) error) error {
 	mariInst.rwResizeLock.RLock()
 	defer mariInst.rwResizeLock.RUnlock()
 
+	if stateErr := mariInst.checkOpen("ReadTx"); stateErr != nil {
+		return stateErr
+	}
+
 	var rootOffset uint64
 	_, rootOffset, readTxErr = mariInst.loadMetaRootOffset()
 	if readTxErr != nil {
 		return readTxErr
 	}
 
+	return mariInst.readTxAtOffset(rootOffset, txOps)
+}
+
+// readTxAtOffset
+//
+//	Perform the read only transaction on the root at an offset in the memory map.
+//	The resize read lock must be held by the caller.
+func (mariInst *Mari) readTxAtOffset(rootOffset uint64, txOps func(tx *Tx) error) error {
+	if txOps == nil {
+		return ErrNilTxOps
+	}
+
+	var readTxErr error
 	var currRoot *INode
 	currRoot, readTxErr = mariInst.readINodeFromMemMap(rootOffset)
 	if readTxErr != nil {
@@ -47,7 +110,11 @@ func (mariInst *Mari) ReadTx(txOps func(tx *Tx) error) error {
 
 	rootPtr := storeINodeAsPointer(currRoot)
 	transaction := newTx(mariInst, rootPtr, false)
-	readTxErr = txOps(transaction)
+
+	mariInst.startReadGuard(transaction)
+	defer mariInst.finishReadGuard(transaction)
+
+	readTxErr = mariInst.runLabeledTx(ProfileOpRead, func() error { return txOps(transaction) })
 	if readTxErr != nil {
 		return readTxErr
 	}
@@ -59,29 +126,87 @@ func (mariInst *Mari) ReadTx(txOps func(tx *Tx) error) error {
 //
 //	Handles all read-write related operations.
 //	If the operation fails, the copied and modified path is discarded and the operation retries back at the root until completed.
+//	If another transaction committed first, the transaction is validated at the isolation level of the instance and its writes are replayed on the latest version, so it is only retried on a conflict.
 //	The operation begins at the latest known version of root, reads from the metadata in the memory map.
 //	The version of the copy is incremented and if the metadata is the same after the path copying has occured, the path is serialized and appended to the memory-map.
 //	The metadata is also being updated to reflect the new version and the new root offset.
+//	With SyncCommits, the transaction returns once the commit is synced to disk, while the next transaction is committed.
+//	The commit hooks are run once the transaction is committed, before waiting for the sync.
+//	If the transaction writes a key held by an advisory lock it was not started through, the commit waits until the lock is released and the transaction is retried.
+//	If the instance is a follower, the transaction is rejected with ErrNotLeader, and if it is over WriteOpsPerSecond, with a ThrottledError.
+//	If the commit would put a key prefix over its quota, the transaction is rejected with a QuotaError instead of being retried.
 func (mariInst *Mari) UpdateTx(txOps func(tx *Tx) error) error {
+	if atomic.LoadUint32(&mariInst.isFollower) == 1 {
+		return ErrNotLeader
+	}
+
+	if throttleErr := mariInst.writeThrottle.take("UpdateTx"); throttleErr != nil {
+		return throttleErr
+	}
+
+	return mariInst.runLabeledTx(ProfileOpUpdate, func() error { return mariInst.updateTx(txOps) })
+}
+
+// UpdateTxIf
+//
+//	Handles read-write related operations like UpdateTx, only if the latest commit is still the expected commit, for whole database optimistic concurrency.
+//	A coordinator reads a snapshot, decides on writes from it, then commits them only if nothing else committed in between.
+//	The expected commit is the timestamp returned by tx.SnapshotTimestamp or Stats, rather than the version, since compaction resets the version and a version read before a compaction can be reached again by later commits.
+//	If the latest commit timestamp is not the expected timestamp when the transaction starts, or another transaction commits before it, ErrStaleVersion is returned instead of rebasing or retrying the transaction.
+func (mariInst *Mari) UpdateTxIf(expectedTimestamp uint64, txOps func(tx *Tx) error) error {
+	if txOps == nil {
+		return ErrNilTxOps
+	}
+
+	return mariInst.UpdateTx(func(tx *Tx) error {
+		tx.noRebase = true
+
+		if tx.snapshotTimestamp != expectedTimestamp {
+			return fmt.Errorf("%w: latest commit timestamp %d, expected %d", ErrStaleVersion, tx.snapshotTimestamp, expectedTimestamp)
+		}
+
+		return txOps(tx)
+	})
+}
+
+// updateTx
+//
+//	Perform the read-write transaction regardless of whether the instance is the leader.
+//	Only used internally, where instance state like the leader lease must be written by a follower.
+func (mariInst *Mari) updateTx(txOps func(tx *Tx) error) error {
+	if txOps == nil {
+		return ErrNilTxOps
+	}
+
 	var updateTxErr error
-	var currRoot, updatedRootCopy *INode
+	var currRoot *INode
 	var rootOffset, version uint64
 	var versionPtr *uint64
 
+	var retries int
+	startedAt := time.Now()
+	defer func() { mariInst.warnContention(retries, startedAt) }()
+
 	for {
 		for atomic.LoadUint32(&mariInst.isResizing) == 1 {
 			runtime.Gosched()
 		}
 		mariInst.rwResizeLock.RLock()
+		if stateErr := mariInst.checkOpen("UpdateTx"); stateErr != nil {
+			mariInst.rwResizeLock.RUnlock()
+			return stateErr
+		}
 
 		versionPtr, version, updateTxErr = mariInst.loadMetaVersion()
 		if updateTxErr != nil {
+			mariInst.rwResizeLock.RUnlock()
 			return updateTxErr
 		}
 
 		if version == atomic.LoadUint64(versionPtr) {
 			_, rootOffset, updateTxErr = mariInst.loadMetaRootOffset()
 			if updateTxErr != nil {
+				mariInst.rwResizeLock.RUnlock()
 				return updateTxErr
 			}
 
@@ -95,13 +220,36 @@ func (mariInst *Mari) UpdateTx(txOps func(tx *Tx) error) error {
 			rootPtr := storeINodeAsPointer(currRoot)
 
 			transaction := newTx(mariInst, rootPtr, true)
+			transaction.snapshotOffset, transaction.baseOffset = rootOffset, rootOffset
 			updateTxErr = txOps(transaction)
 			if updateTxErr != nil {
+				mariInst.rwResizeLock.RUnlock()
 				return updateTxErr
 			}
 
-			updatedRootCopy = loadINodeFromPointer(rootPtr)
-			ok, updateTxErr := mariInst.exclusiveWriteMmap(updatedRootCopy)
+			blocked := mariInst.keyLocks.blocking(transaction)
+			if blocked != nil {
+				mariInst.rwResizeLock.RUnlock()
+				select {
+				case <-blocked:
+					continue
+				case <-mariInst.closeChan:
+					return ErrKeyLockHeld
+				}
+			}
+
+			ok, updateTxErr := transaction.commit()
+			if transaction.conflicted {
+				retries++
+				mariInst.contention.recordRetry()
+			}
+
+			if errors.Is(updateTxErr, ErrConflict) {
+				mariInst.rwResizeLock.RUnlock()
+				runtime.Gosched()
+				continue
+			}
+
 			if updateTxErr != nil {
 				mariInst.rwResizeLock.RUnlock()
 				return updateTxErr
@@ -109,7 +257,8 @@ func (mariInst *Mari) UpdateTx(txOps func(tx *Tx) error) error {
 
 			if ok {
 				mariInst.rwResizeLock.RUnlock()
-				return nil
+				mariInst.runCommitHooks(transaction.commitEvent)
+				return mariInst.waitForCommitSync()
 			}
 		}
 
@@ -118,19 +267,236 @@ func (mariInst *Mari) UpdateTx(txOps func(tx *Tx) error) error {
 	}
 }
 
+// Begin
+//
+//	Start a transaction that is committed or rolled back explicitly, for usage that can not be scoped to a single closure, like streaming responses.
+//	The transaction operates on the latest version at the time it is started, like ReadTx and UpdateTx.
+//	The resize read lock is held until the transaction is committed or rolled back, so resizing and compaction are blocked while it is open.
+//	A read-write transaction is not retried on conflict, instead Commit returns ErrTxConflict and the transaction must be started again.
+//	Transactions committed after it started only conflict as determined by the isolation level of the instance.
+//	If the transaction is read-write and the instance is a follower, ErrNotLeader is returned.
+func (mariInst *Mari) Begin(readonly bool) (*Tx, error) {
+	if !readonly && atomic.LoadUint32(&mariInst.isFollower) == 1 {
+		return nil, ErrNotLeader
+	}
+
+	throttle := mariInst.writeThrottle
+	if readonly {
+		throttle = mariInst.readThrottle
+	}
+
+	if throttleErr := throttle.take("Begin"); throttleErr != nil {
+		return nil, throttleErr
+	}
+
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	if stateErr := mariInst.checkOpen("Begin"); stateErr != nil {
+		mariInst.rwResizeLock.RUnlock()
+		return nil, stateErr
+	}
+
+	var beginErr error
+	_, rootOffset, beginErr := mariInst.loadMetaRootOffset()
+	if beginErr != nil {
+		mariInst.rwResizeLock.RUnlock()
+		return nil, beginErr
+	}
+
+	currRoot, beginErr := mariInst.readINodeFromMemMap(rootOffset)
+	if beginErr != nil {
+		mariInst.rwResizeLock.RUnlock()
+		return nil, beginErr
+	}
+
+	if !readonly {
+		currRoot.version = currRoot.version + 1
+	}
+
+	transaction := newTx(mariInst, storeINodeAsPointer(currRoot), !readonly)
+	transaction.snapshotOffset, transaction.baseOffset = rootOffset, rootOffset
+	transaction.managed = true
+
+	if readonly {
+		mariInst.startReadGuard(transaction)
+	}
+
+	return transaction, nil
+}
+
+// Commit
+//
+//	Commit a transaction started with Begin and release it.
+//	For a read-write transaction, the modified path is serialized and appended to the memory map if no transaction committed since it was started conflicts with it, otherwise ErrTxConflict is returned.
+//	If a key read with GetForUpdate was written since it was read, ErrConflict is returned, which wraps ErrTxConflict.
+//	If the transaction writes a key held by an advisory lock it was not started through, ErrKeyLockHeld is returned.
+//	If the commit would put a key prefix over its quota, a QuotaError is returned.
+//	With SyncCommits, a read-write transaction waits until the commit is synced to disk, after releasing the resize read lock and running the commit hooks.
+//	For a read only transaction, Commit is the same as Rollback.
+//	The transaction can not be used after it is committed or rolled back.
+func (tx *Tx) Commit() error {
+	releaseErr := tx.release()
+	if releaseErr != nil {
+		return releaseErr
+	}
+
+	if !tx.isWrite {
+		tx.store.finishReadGuard(tx)
+		tx.store.rwResizeLock.RUnlock()
+		return nil
+	}
+
+	if tx.store.keyLocks.blocking(tx) != nil {
+		tx.store.rwResizeLock.RUnlock()
+		tx.store.contention.recordAbort()
+		return ErrKeyLockHeld
+	}
+
+	ok, commitErr := tx.commit()
+	tx.store.rwResizeLock.RUnlock()
+	if errors.Is(commitErr, ErrConflict) {
+		tx.store.contention.recordAbort()
+	}
+
+	if commitErr != nil {
+		return commitErr
+	}
+
+	if !ok {
+		tx.store.contention.recordAbort()
+		return ErrTxConflict
+	}
+
+	tx.store.runCommitHooks(tx.commitEvent)
+	return tx.store.waitForCommitSync()
+}
+
+// Rollback
+//
+//	Discard a transaction started with Begin and release it. The modified path of a read-write transaction is never written.
+func (tx *Tx) Rollback() error {
+	releaseErr := tx.release()
+	if releaseErr != nil {
+		return releaseErr
+	}
+
+	if !tx.isWrite {
+		tx.store.finishReadGuard(tx)
+	}
+
+	tx.store.rwResizeLock.RUnlock()
+	return nil
+}
+
+// release
+//
+//	Mark a transaction started with Begin as done, so the resize read lock is only released once.
+func (tx *Tx) release() error {
+	if !tx.managed {
+		return ErrTxNotManaged
+	}
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.done = true
+	return nil
+}
+
 // Put
 //
 //	Inserts or updates key-value pair into the ordered array mapped trie.
 //	The operation begins at the root of the trie and traverses through the tree until the correct location is found, copying the entire path.
-func (tx *Tx) Put(key, value []byte) error {
+//	If the key is held by a prepared transaction, ErrKeyLocked is returned.
+//	A nil or empty key is rejected with ErrEmptyKey, and a nil or empty value is stored as empty, or rejected with ErrEmptyValue with EmptyValuesReject.
+//	Keys under ReservedKeyPrefix are rejected with ErrReservedKey.
+//	Keys and values longer than the max key and value sizes of the instance are rejected with ErrKeyTooLarge and ErrValueTooLarge.
+//	Key-value pairs rejected by a validator of the instance are rejected with a ValidationError.
+func (tx *Tx) Put(key, value []byte) (recoveredErr error) {
+	defer tx.store.recoverPanic("Put", &recoveredErr)
+
 	if !tx.isWrite {
 		return errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
 	}
 
-	_, putErr := tx.store.putRecursive(tx.root, key, value, 0)
+	key = tx.store.normalizeKey(key)
+	checkErr := tx.store.checkKeyValue(key, value)
+	if checkErr != nil {
+		return checkErr
+	}
+
+	if tx.store.isKeyLocked(key) {
+		return ErrKeyLocked
+	}
+
+	sampled := tx.sampleOp("put", key)
+	putErr := tx.put(key, value)
+	sampled.finish(tx, 0, 0, putErr)
+	return putErr
+}
+
+// checkKeyValue
+//
+//	Check a key and value written by Put or PutWithTTL against the empty key and empty value semantics, and the max key and value sizes, of the instance, then run the validators of the key.
+//	Keys and values written internally, like the entries of the ttl index, are not checked, since they can have empty values.
+func (mariInst *Mari) checkKeyValue(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	if len(key) > mariInst.maxKeySize {
+		return fmt.Errorf("%w: %d bytes, expected at most %d", ErrKeyTooLarge, len(key), mariInst.maxKeySize)
+	}
+
+	if len(value) > mariInst.maxValueSize {
+		return fmt.Errorf("%w: %d bytes, expected at most %d", ErrValueTooLarge, len(value), mariInst.maxValueSize)
+	}
+
+	if len(value) == 0 && mariInst.emptyValues == EmptyValuesReject {
+		return ErrEmptyValue
+	}
+
+	return mariInst.validate(key, value)
+}
+
+// put
+//
+//	Insert or update the key-value pair and record it in the write set, without checking prepared transaction locks.
+//	Any ttl previously set on the key is cleared, and a key longer than MaxKeySize or a value longer than MaxValueSize is rejected, since neither can be serialized in a leaf node.
+func (tx *Tx) put(key, value []byte) error {
+	if len(key) > MaxKeySize {
+		return fmt.Errorf("%w: %d bytes, expected at most %d", ErrKeyTooLarge, len(key), MaxKeySize)
+	}
+
+	if len(value) > MaxValueSize {
+		return fmt.Errorf("%w: %d bytes, expected at most %d", ErrValueTooLarge, len(value), MaxValueSize)
+	}
+
+	clearErr := tx.clearTTL(key)
+	if clearErr != nil {
+		return clearErr
+	}
+
+	clearErr = tx.clearTombstone(key)
+	if clearErr != nil {
+		return clearErr
+	}
+
+	version := loadINodeFromPointer(tx.root).version
+	_, putErr := tx.store.putRecursive(tx.root, key, value, version, 0, 0)
 	if putErr != nil {
 		return putErr
 	}
+
+	tx.writeSet = append(tx.writeSet, &txWrite{key: key, value: value})
 	return nil
 }
 
@@ -138,15 +504,72 @@ func (tx *Tx) Put(key, value []byte) error {
 //
 //	Attempts to retrieve the value for a key within the ordered array mapped trie.
 //	The operation begins at the root of the trie and traverses down the path to the key.
-func (tx *Tx) Get(key []byte, transform *Transform) (*KeyValuePair, error) {
-	var newTransform Transform
-	if transform != nil {
-		newTransform = *transform
+//	The transforms registered with the instance are applied, followed by the transform passed to Get.
+//	If nil is passed for the transformer, then only the transforms registered with the instance are applied.
+//	With ValueCacheSize, read only transactions are served from the value cache when the key is cached, and the transforms are applied to the cached key-value pair.
+//	With NegativeCacheSize, read only transactions return nil without descending the trie for a key recently not found.
+//	A key whose ttl has elapsed is treated as deleted, even before it is swept.
+func (tx *Tx) Get(key []byte, transform *Transform) (_ *KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("Get", &recoveredErr)
+
+	key = tx.store.normalizeKey(key)
+	tx.store.hotSet.recordRead(key)
+	tx.store.tiering.recordAccess(key)
+	tx.store.accessTracker.track(key)
+
+	sampled := tx.sampleOp("get", key)
+	kvPair, getErr := tx.getLive(key, transform)
+	if kvPair != nil {
+		sampled.finish(tx, 1, len(kvPair.Key)+len(kvPair.Value), getErr)
 	} else {
-		newTransform = func(kvPair *KeyValuePair) *KeyValuePair { return kvPair }
+		sampled.finish(tx, 0, 0, getErr)
 	}
 
-	return tx.store.getRecursive(tx.root, key, 0, newTransform)
+	return kvPair, getErr
+}
+
+// getLive
+//
+//	Retrieve the key-value pair for a key through the caches, treating it as deleted if its ttl has elapsed, and apply the transforms.
+func (tx *Tx) getLive(key []byte, transform *Transform) (*KeyValuePair, error) {
+	kvPair, getErr := tx.getCached(key)
+	if getErr != nil || kvPair == nil {
+		return nil, getErr
+	}
+
+	expired, expireErr := tx.isExpired(key)
+	if expireErr != nil {
+		return nil, expireErr
+	}
+
+	if expired {
+		return nil, tx.lazyExpire(key)
+	}
+
+	return tx.store.readTransform(transform)(kvPair), nil
+}
+
+// get
+//
+//	Retrieve the key-value pair for a key without applying any transforms, which is used to read the state Mari persists internally.
+//	A nil or empty key can never be written, so nil is returned for it. A value moved to the cold file is read from it.
+func (tx *Tx) get(key []byte) (*KeyValuePair, error) {
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	tx.recordRead(key)
+	kvPair, getErr := tx.store.getRecursive(tx.root, key, 0, identityTransform)
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	return tx.store.thaw(kvPair)
 }
 
 // Delete
@@ -154,15 +577,55 @@ func (tx *Tx) Get(key []byte, transform *Transform) (*KeyValuePair, error) {
 //	Attempts to delete a key-value pair within the ordered array mapped trie.
 //	It starts at the root of the trie and recurses down the path to the key to be deleted.
 //	The operation creates an entire, in-memory copy of the path down to the key.
-func (tx *Tx) Delete(key []byte) error {
+//	If the key is held by a prepared transaction, ErrKeyLocked is returned, and a nil or empty key is rejected with ErrEmptyKey.
+//	Keys under ReservedKeyPrefix are rejected with ErrReservedKey.
+func (tx *Tx) Delete(key []byte) (recoveredErr error) {
+	defer tx.store.recoverPanic("Delete", &recoveredErr)
+
 	if !tx.isWrite {
 		return errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
 	}
 
+	key = tx.store.normalizeKey(key)
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+
+	if isReservedKey(key) {
+		return ErrReservedKey
+	}
+
+	if tx.store.isKeyLocked(key) {
+		return ErrKeyLocked
+	}
+
+	sampled := tx.sampleOp("delete", key)
+	delErr := tx.delete(key)
+	sampled.finish(tx, 0, 0, delErr)
+	return delErr
+}
+
+// delete
+//
+//	Delete the key-value pair and record it in the write set, without checking prepared transaction locks.
+//	Any ttl previously set on the key is cleared, and with Tombstones, a tombstone of the key is written if it exists.
+func (tx *Tx) delete(key []byte) error {
+	clearErr := tx.clearTTL(key)
+	if clearErr != nil {
+		return clearErr
+	}
+
+	tombstoneErr := tx.putTombstone(key)
+	if tombstoneErr != nil {
+		return tombstoneErr
+	}
+
 	_, delErr := tx.store.deleteRecursive(tx.root, key, 0)
 	if delErr != nil {
 		return delErr
 	}
+
+	tx.writeSet = append(tx.writeSet, &txWrite{key: key, isDelete: true})
 	return nil
 }
 
@@ -170,29 +633,81 @@ func (tx *Tx) Delete(key []byte) error {
 //
 //	Creates an ordered iterator starting at the given start key up to the range specified by total results.
 //	Since the array mapped trie is sorted, the iterate function starts at the startKey and recursively builds the result set up the specified end.
+//	The start key is inclusive, and can be nil to start at the smallest key.
 //	A minimum version can be provided which will limit results to the min version forward.
 //	If nil is passed for the minimum version, the earliest version in the structure will be used.
-//	If nil is passed for the transformer, then the kv pair will be returned as is.
-func (tx *Tx) Iterate(startKey []byte, totalResults int, opts *RangeOpts) ([]*KeyValuePair, error) {
+//	Results never include versions newer than the snapshot version of the transaction, no matter how many commits land during the scan.
+//	The transforms registered with the instance are applied, followed by the transform in the options.
+//	If nil is passed for the transformer, then only the transforms registered with the instance are applied.
+//	Key-value pairs dropped by a transform are not replaced, so fewer than totalResults may be returned, and no results are returned if totalResults is not positive.
+//	Keys whose ttl has elapsed are dropped the same way, even before they are swept.
+//	Keys under ReservedKeyPrefix are skipped without counting towards totalResults, unless included in the options.
+//	The results are collected in chunks of up to the chunk size in the options, and the context in the options is checked between chunks.
+//	With ShedScansOver, ErrMemoryPressure is returned without scanning if totalResults is over it while the instance is over its soft memory limit.
+func (tx *Tx) Iterate(startKey []byte, totalResults int, opts *RangeOpts) (kvPairs []*KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("Iterate", &recoveredErr)
+
+	startKey = tx.store.normalizeKey(startKey)
+	tx.store.hotSet.recordRead(startKey)
+
+	sampled := tx.sampleOp("iterate", startKey)
+	defer func() { sampled.finishPairs(tx, kvPairs, recoveredErr) }()
+
+	shedErr := tx.store.shedScan(totalResults)
+	if shedErr != nil {
+		return nil, shedErr
+	}
+
+	kvPairs, iterErr := tx.iterateUser(startKey, totalResults, opts)
+	if iterErr != nil {
+		return nil, iterErr
+	}
+
+	tx.store.tiering.recordAccesses(kvPairs)
+	tx.store.accessTracker.trackPairs(kvPairs)
+	defer tx.store.holdScan(kvPairs)()
+
+	kvPairs, iterErr = tx.excludeExpired(kvPairs)
+	if iterErr != nil {
+		return nil, iterErr
+	}
+
+	var transform *Transform
+	if opts != nil {
+		transform = opts.Transform
+	}
+
+	return applyTransform(kvPairs, tx.store.readTransform(transform)), nil
+}
+
+// iterate
+//
+//	Iterate the key-value pairs from the start key without applying any transforms, reading values moved to the cold file from it.
+func (tx *Tx) iterate(startKey []byte, totalResults int, opts *RangeOpts) ([]*KeyValuePair, error) {
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
 	var minV uint64
-	var transform Transform
 	if opts != nil && opts.MinVersion != nil {
 		minV = *opts.MinVersion
 	} else {
 		minV = 0
 	}
 
-	if opts != nil && opts.Transform != nil {
-		transform = *opts.Transform
-	} else {
-		transform = func(kvPair *KeyValuePair) *KeyValuePair { return kvPair }
+	if totalResults <= 0 {
+		return []*KeyValuePair{}, nil
 	}
 
-	kvPairs, iterErr := tx.store.iterateRecursive(tx.root, minV, startKey, totalResults, 0, []*KeyValuePair{}, transform)
+	tx.recordScan(startKey, nil, totalResults)
+
+	kvPairs, iterErr := tx.scanChunks(minV, startKey, nil, totalResults, opts, newScanArena(opts), false)
 	if iterErr != nil {
 		return nil, iterErr
 	}
-	return kvPairs, nil
+
+	return tx.store.thawPairs(kvPairs)
 }
 
 // Range
@@ -200,31 +715,106 @@ func (tx *Tx) Iterate(startKey []byte, totalResults int, opts *RangeOpts) ([]*Ke
 //	Since the array mapped trie is sorted by nature, the range operation begins at the root of the trie.
 //	It checks the root bitmap and determines which indexes to check in the range.
 //	It then recursively checks each index, traversing the paths and building the sorted results.
+//	The start key is inclusive and the end key is exclusive, and either can be nil to leave that side of the range unbounded.
 //	A minimum version can be provided which will limit results to the min version forward.
 //	If nil is passed for the minimum version, the earliest version in the structure will be used.
-//	If nil is passed for the transformer, then the kv pair will be returned as is.
-func (tx *Tx) Range(startKey, endKey []byte, opts *RangeOpts) ([]*KeyValuePair, error) {
-	if bytes.Compare(startKey, endKey) == 1 {
+//	Results never include versions newer than the snapshot version of the transaction, no matter how many commits land during the scan.
+//	The transforms registered with the instance are applied, followed by the transform in the options.
+//	If nil is passed for the transformer, then only the transforms registered with the instance are applied.
+//	If max versions is provided, the previous retained versions of each key are returned after the latest, newest first, up to max versions per key.
+//	Keys under ReservedKeyPrefix are excluded, unless included in the options, and keys whose ttl has elapsed are excluded, even before they are swept.
+//	The results are collected in chunks of up to the chunk size in the options, and the context in the options is checked between chunks.
+//	With ShedScansOver, the results collected are checked after each chunk, and ErrMemoryPressure is returned as soon as they are over it while the instance is over its soft memory limit, without collecting the rest of the range.
+func (tx *Tx) Range(startKey, endKey []byte, opts *RangeOpts) (kvPairs []*KeyValuePair, recoveredErr error) {
+	defer tx.store.recoverPanic("Range", &recoveredErr)
+
+	startKey = tx.store.normalizeKey(startKey)
+	tx.store.hotSet.recordRead(startKey)
+
+	sampled := tx.sampleOp("range", startKey)
+	defer func() { sampled.finishPairs(tx, kvPairs, recoveredErr) }()
+
+	endKey = tx.store.normalizeKey(endKey)
+	kvPairs, rangeErr := tx.scanRange(startKey, endKey, opts, true)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	kvPairs = excludeEndKey(kvPairs, endKey)
+
+	tx.store.tiering.recordAccesses(kvPairs)
+	tx.store.accessTracker.trackPairs(kvPairs)
+	defer tx.store.holdScan(kvPairs)()
+
+	if !includeReserved(opts) {
+		kvPairs = excludeReserved(kvPairs)
+	}
+
+	kvPairs, rangeErr = tx.excludeExpired(kvPairs)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	if includeTombstones(opts) {
+		kvPairs, rangeErr = tx.mergeTombstones(kvPairs, startKey, endKey, opts)
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
+
+		kvPairs = excludeEndKey(kvPairs, endKey)
+	}
+
+	var transform *Transform
+	if opts != nil {
+		transform = opts.Transform
+	}
+
+	return applyTransform(kvPairs, liveTransform(tx.store.readTransform(transform))), nil
+}
+
+// rangeKvPairs
+//
+//	Get the key-value pairs between the start and end key without applying any transforms, which is used to read the state Mari persists internally.
+//	Unlike Range, both keys are inclusive, so internal scans like the ttl sweep can bound a scan by the last key to include.
+//	Values moved to the cold file are read from it.
+func (tx *Tx) rangeKvPairs(startKey, endKey []byte, opts *RangeOpts) ([]*KeyValuePair, error) {
+	return tx.scanRange(startKey, endKey, opts, false)
+}
+
+// scanRange
+//
+//	Get the key-value pairs between the start and end key, both inclusive, without applying any transforms.
+//	With shed, the scan stops with ErrMemoryPressure once it collects more results than ShedScansOver while the instance is under memory pressure, which Range uses so internal scans are never shed.
+func (tx *Tx) scanRange(startKey, endKey []byte, opts *RangeOpts, shed bool) ([]*KeyValuePair, error) {
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return nil, guardErr
+	}
+
+	if startKey != nil && endKey != nil && bytes.Compare(startKey, endKey) == 1 {
 		return nil, errors.New("start key is larger than end key")
 	}
 
 	var minV uint64
-	var transform Transform
 	if opts != nil && opts.MinVersion != nil {
 		minV = *opts.MinVersion
 	} else {
 		minV = 0
 	}
 
-	if opts != nil && opts.Transform != nil {
-		transform = *opts.Transform
-	} else {
-		transform = func(kvPair *KeyValuePair) *KeyValuePair { return kvPair }
-	}
-
-	kvPairs, rangeErr := tx.store.rangeRecursive(tx.root, minV, startKey, endKey, 0, transform)
+	tx.recordScan(startKey, endKey, 0)
+	arena := newScanArena(opts)
+	kvPairs, rangeErr := tx.scanChunks(minV, startKey, endKey, 0, opts, arena, shed)
 	if rangeErr != nil {
 		return nil, rangeErr
 	}
-	return kvPairs, nil
+
+	if opts != nil && opts.MaxVersions != nil && *opts.MaxVersions > 1 {
+		kvPairs, rangeErr = tx.store.rangeHistory(kvPairs, minV, *opts.MaxVersions, arena)
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
+	}
+
+	return tx.store.thawPairs(kvPairs)
 }
@@ -0,0 +1,131 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+//============================================= Mari Transform
+
+// Pipeline
+//
+//	Compose transforms into a single transform, which applies each transform in order to the result of the previous one.
+//	Nil transforms are skipped, so a pipeline of no transforms returns the key-value pair as is.
+//	If a transform returns nil, the key-value pair is dropped and the remaining transforms are not applied.
+func Pipeline(transforms ...Transform) Transform {
+	var stages []Transform
+	for _, transform := range transforms {
+		if transform != nil {
+			stages = append(stages, transform)
+		}
+	}
+
+	if len(stages) == 0 {
+		return identityTransform
+	}
+
+	if len(stages) == 1 {
+		return stages[0]
+	}
+
+	return func(kvPair *KeyValuePair) *KeyValuePair {
+		for _, stage := range stages {
+			if kvPair == nil {
+				return nil
+			}
+
+			kvPair = stage(kvPair)
+		}
+
+		return kvPair
+	}
+}
+
+// CopyTransform
+//
+//	Copy the key and value out of the memory map, so the key-value pair can be held after the transaction completes and the memory map is resized or compacted.
+func CopyTransform(kvPair *KeyValuePair) *KeyValuePair {
+	return &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: bytes.Clone(kvPair.Key), Value: bytes.Clone(kvPair.Value)}
+}
+
+// KeysOnlyTransform
+//
+//	Drop the value of the key-value pair, for scans that only need the keys and versions.
+func KeysOnlyTransform(kvPair *KeyValuePair) *KeyValuePair {
+	return &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: kvPair.Key}
+}
+
+// SliceTransform
+//
+//	Project the value to the byte range [start, end), for scans that only need a fixed portion of wide values.
+//	An end less than 0 projects to the end of the value, and the range is clamped to the length of each value.
+//	The projected bytes are copied out of the memory map, so only the projection is held by the results.
+func SliceTransform(start, end int) Transform {
+	return func(kvPair *KeyValuePair) *KeyValuePair {
+		valueEnd := len(kvPair.Value)
+		if end >= 0 && end < valueEnd {
+			valueEnd = end
+		}
+
+		valueStart := min(max(start, 0), valueEnd)
+		return &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: kvPair.Key, Value: bytes.Clone(kvPair.Value[valueStart:valueEnd])}
+	}
+}
+
+// JSONFieldsTransform
+//
+//	Project values encoded as JSON objects to the selected top level fields, which are re-encoded as a JSON object.
+//	Fields missing from a value are omitted, and a value that is not a JSON object is projected to nil.
+func JSONFieldsTransform(fields ...string) Transform {
+	return func(kvPair *KeyValuePair) *KeyValuePair {
+		projected := &KeyValuePair{Version: kvPair.Version, Timestamp: kvPair.Timestamp, Key: kvPair.Key}
+
+		var object map[string]json.RawMessage
+		if json.Unmarshal(kvPair.Value, &object) != nil || object == nil {
+			return projected
+		}
+
+		selected := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := object[field]; ok {
+				selected[field] = value
+			}
+		}
+
+		projected.Value, _ = json.Marshal(selected)
+		return projected
+	}
+}
+
+// identityTransform
+//
+//	Return the key-value pair as is.
+func identityTransform(kvPair *KeyValuePair) *KeyValuePair {
+	return kvPair
+}
+
+// readTransform
+//
+//	Get the transform for a read, which is the pipeline registered with the instance followed by the transform passed to the read, if any.
+func (mariInst *Mari) readTransform(transform *Transform) Transform {
+	if transform == nil {
+		return mariInst.transform
+	}
+
+	return Pipeline(mariInst.transform, *transform)
+}
+
+// applyTransform
+//
+//	Apply a transform to each key-value pair in place, dropping the pairs the transform returns nil for.
+func applyTransform(kvPairs []*KeyValuePair, transform Transform) []*KeyValuePair {
+	transformed := kvPairs[:0]
+	for _, kvPair := range kvPairs {
+		kvPair = transform(kvPair)
+		if kvPair != nil {
+			transformed = append(transformed, kvPair)
+		}
+	}
+
+	return transformed
+}
@@ -0,0 +1,366 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari TTL
+
+// PutWithTTL
+//
+//	Inserts or updates a key-value pair that expires after the ttl.
+//	The expiration time is indexed in a reserved bucket ordered by expiration time, so the expiration worker finds due keys with a bounded range instead of scanning the trie.
+//	Writing the key again with Put or PutWithTTL, or deleting it, clears the previous expiration.
+//	If the key is held by a prepared transaction, ErrKeyLocked is returned, and a key longer than MaxTTLKeySize is rejected with ErrKeyTooLarge.
+func (tx *Tx) PutWithTTL(key, value []byte, ttl time.Duration) (recoveredErr error) {
+	defer tx.store.recoverPanic("PutWithTTL", &recoveredErr)
+
+	if !tx.isWrite {
+		return errors.New("attempting to perform a write in a read only transaction, use tx.UpdateTx")
+	}
+
+	if ttl <= 0 {
+		return errors.New("ttl must be greater than 0")
+	}
+
+	key = tx.store.normalizeKey(key)
+	checkErr := tx.store.checkKeyValue(key, value)
+	if checkErr != nil {
+		return checkErr
+	}
+
+	if tx.store.isKeyLocked(key) {
+		return ErrKeyLocked
+	}
+
+	return tx.putExpiring(key, value, uint64(time.Now().Add(ttl).UnixNano()))
+}
+
+// putExpiring
+//
+//	Insert or update a key-value pair along with its entries in the ttl index, so it expires at the expiration time.
+//	A key longer than MaxTTLKeySize is rejected before anything is written, since its entry in the ttl index would not fit in a leaf node.
+func (tx *Tx) putExpiring(key, value []byte, expiresAt uint64) error {
+	if len(key) > MaxTTLKeySize {
+		return fmt.Errorf("%w: %d bytes, expected at most %d with a ttl", ErrKeyTooLarge, len(key), MaxTTLKeySize)
+	}
+
+	putErr := tx.put(key, value)
+	if putErr != nil {
+		return putErr
+	}
+
+	atomic.StoreUint32(&tx.store.hasTTL, 1)
+
+	putErr = tx.put(ttlKey(expiresAt, key), nil)
+	if putErr != nil {
+		return putErr
+	}
+
+	return tx.put(expiresKey(key), serializeUint64(expiresAt))
+}
+
+// ExpiresAt
+//
+//	Get the expiration time of a key written with a ttl.
+//	If the key has no ttl, the zero time is returned.
+func (tx *Tx) ExpiresAt(key []byte) (_ time.Time, recoveredErr error) {
+	defer tx.store.recoverPanic("ExpiresAt", &recoveredErr)
+
+	guardErr := tx.checkReadGuard()
+	if guardErr != nil {
+		return time.Time{}, guardErr
+	}
+
+	expiresAt, getErr := tx.loadExpiresAt(tx.store.normalizeKey(key))
+	if getErr != nil || expiresAt == 0 {
+		return time.Time{}, getErr
+	}
+
+	return time.Unix(0, int64(expiresAt)), nil
+}
+
+// Expire
+//
+//	Delete every key whose ttl has elapsed, along with its entries in the ttl index, and return the total keys deleted.
+//	Due keys are found with a range over the ttl index up to the current time, and deleted in batched read-write transactions.
+//	An index entry that was cleared by a concurrent write is skipped, so a key written again is not deleted.
+func (mariInst *Mari) Expire() (int, error) {
+	if atomic.LoadUint32(&mariInst.hasTTL) == 0 {
+		return 0, nil
+	}
+
+	var entries []*KeyValuePair
+	expireErr := mariInst.ReadTx(func(tx *Tx) error {
+		var rangeErr error
+		entries, rangeErr = tx.rangeKvPairs(ttlKeyPrefix, ttlKey(uint64(time.Now().UnixNano()), nil), nil)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for idx, entry := range entries {
+			entries[idx] = &KeyValuePair{Key: bytes.Clone(entry.Key)}
+		}
+
+		return nil
+	})
+
+	if expireErr != nil {
+		return 0, expireErr
+	}
+
+	var totalExpired int
+	for start := 0; start < len(entries); start += DefaultExpireBatchSize {
+		end := min(start+DefaultExpireBatchSize, len(entries))
+
+		var batchExpired int
+		expireErr = mariInst.UpdateTx(func(tx *Tx) error {
+			batchExpired = 0
+			for _, entry := range entries[start:end] {
+				indexed, getErr := tx.get(entry.Key)
+				if getErr != nil {
+					return getErr
+				}
+
+				if indexed == nil {
+					continue
+				}
+
+				key := entry.Key[len(ttlKeyPrefix)+OffsetSize64:]
+				if mariInst.isKeyLocked(key) {
+					continue
+				}
+
+				delErr := tx.delete(key)
+				if delErr != nil {
+					return delErr
+				}
+
+				batchExpired++
+			}
+
+			return nil
+		})
+
+		if expireErr != nil {
+			return totalExpired, expireErr
+		}
+
+		totalExpired += batchExpired
+	}
+
+	return totalExpired, nil
+}
+
+// handleExpiration
+//
+//	Run in a separate go routine.
+//	On each expiration interval, delayed by a random jitter up to the expiration jitter, keys whose ttl has elapsed are deleted until the instance is closed.
+//	A read that finds an expired key signals the worker to sweep before the next interval.
+//	Followers reject read-write transactions, so sweeps are skipped until the instance is promoted.
+func (mariInst *Mari) handleExpiration() {
+	defer mariInst.workers.Done()
+
+	timer := time.NewTimer(mariInst.nextExpiration())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-mariInst.closeChan:
+			return
+		case <-mariInst.signalExpireChan:
+		case <-timer.C:
+			timer.Reset(mariInst.nextExpiration())
+		}
+
+		if atomic.LoadUint32(&mariInst.isFollower) == 1 {
+			continue
+		}
+
+		mariInst.Expire()
+	}
+}
+
+// nextExpiration
+//
+//	Get the delay until the next expiration sweep, which is the expiration interval plus a random jitter up to the expiration jitter.
+func (mariInst *Mari) nextExpiration() time.Duration {
+	if mariInst.expirationJitter <= 0 {
+		return mariInst.expirationInterval
+	}
+
+	return mariInst.expirationInterval + rand.N(mariInst.expirationJitter)
+}
+
+// recoverTTL
+//
+//	Determine if any key was written with a ttl when the instance is opened, so writes check the ttl index.
+func (mariInst *Mari) recoverTTL() error {
+	return mariInst.ReadTx(func(tx *Tx) error {
+		entries, rangeErr := tx.rangeKvPairs(ttlKeyPrefix, bucketEndKey(ttlKeyPrefix), nil)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		if len(entries) > 0 {
+			atomic.StoreUint32(&mariInst.hasTTL, 1)
+		}
+
+		return nil
+	})
+}
+
+// clearTTL
+//
+//	Remove the entries for a key from the ttl index if it was written with a ttl.
+//	Reserved keys never have a ttl, so they are skipped.
+func (tx *Tx) clearTTL(key []byte) error {
+	if atomic.LoadUint32(&tx.store.hasTTL) == 0 || isReservedKey(key) {
+		return nil
+	}
+
+	expiresAt, getErr := tx.loadExpiresAt(key)
+	if getErr != nil || expiresAt == 0 {
+		return getErr
+	}
+
+	delErr := tx.delete(ttlKey(expiresAt, key))
+	if delErr != nil {
+		return delErr
+	}
+
+	return tx.delete(expiresKey(key))
+}
+
+// isExpired
+//
+//	Determine if the ttl of a key has elapsed, even if the key has not been swept yet.
+//	Reserved keys never have a ttl, so they never expire.
+func (tx *Tx) isExpired(key []byte) (bool, error) {
+	if atomic.LoadUint32(&tx.store.hasTTL) == 0 || isReservedKey(key) {
+		return false, nil
+	}
+
+	expiresAt, getErr := tx.loadExpiresAt(key)
+	if getErr != nil || expiresAt == 0 {
+		return false, getErr
+	}
+
+	return expiresAt <= uint64(time.Now().UnixNano()), nil
+}
+
+// excludeExpired
+//
+//	Remove the key-value pairs whose ttl has elapsed from the sorted results of a read, so expired keys are never read between sweeps.
+//	The expiration times are found with a single range over the expires bucket between the first and last key, instead of a lookup per key.
+//	With max versions, every retained version of an expired key is removed.
+func (tx *Tx) excludeExpired(kvPairs []*KeyValuePair) ([]*KeyValuePair, error) {
+	if atomic.LoadUint32(&tx.store.hasTTL) == 0 || len(kvPairs) == 0 {
+		return kvPairs, nil
+	}
+
+	expires, rangeErr := tx.rangeKvPairs(expiresKey(kvPairs[0].Key), expiresKey(kvPairs[len(kvPairs)-1].Key), nil)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	now := uint64(time.Now().UnixNano())
+	expired := make(map[string]bool)
+	for _, entry := range expires {
+		expiresAt, decodeErr := deserializeUint64(entry.Value)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+
+		if expiresAt <= now {
+			expired[string(entry.Key[len(expiresKeyPrefix):])] = true
+		}
+	}
+
+	if len(expired) == 0 {
+		return kvPairs, nil
+	}
+
+	liveKvPairs := kvPairs[:0]
+	var lastExpired []byte
+	for _, kvPair := range kvPairs {
+		if !expired[string(kvPair.Key)] {
+			liveKvPairs = append(liveKvPairs, kvPair)
+			continue
+		}
+
+		if bytes.Equal(kvPair.Key, lastExpired) {
+			continue
+		}
+
+		lastExpired = kvPair.Key
+		expireErr := tx.lazyExpire(kvPair.Key)
+		if expireErr != nil {
+			return nil, expireErr
+		}
+	}
+
+	return liveKvPairs, nil
+}
+
+// lazyExpire
+//
+//	Treat a key read after its ttl elapsed as deleted.
+//	In a read-write transaction, the key is deleted along with its ttl, writing its tombstone with Tombstones, unless it is held by a prepared transaction.
+//	In a read only transaction, the expiration worker is signaled to sweep before the next interval.
+func (tx *Tx) lazyExpire(key []byte) error {
+	if !tx.isWrite {
+		select {
+		case tx.store.signalExpireChan <- true:
+		default:
+		}
+
+		return nil
+	}
+
+	if tx.store.isKeyLocked(key) {
+		return nil
+	}
+
+	return tx.delete(bytes.Clone(key))
+}
+
+// loadExpiresAt
+//
+//	Get the expiration time of a key in unix nanoseconds, or 0 if the key has no ttl.
+func (tx *Tx) loadExpiresAt(key []byte) (uint64, error) {
+	kvPair, getErr := tx.get(expiresKey(key))
+	if getErr != nil || kvPair == nil {
+		return 0, getErr
+	}
+
+	return deserializeUint64(kvPair.Value)
+}
+
+// ttlKey
+//
+//	Get the key of the ttl index entry for a key, which is the expiration time in big endian followed by the key so entries are ordered by expiration time.
+func ttlKey(expiresAt uint64, key []byte) []byte {
+	sKey := binary.BigEndian.AppendUint64(bytes.Clone(ttlKeyPrefix), expiresAt)
+	return append(sKey, key...)
+}
+
+// expiresKey
+//
+//	Get the key holding the expiration time for a key.
+func expiresKey(key []byte) []byte {
+	return append(bytes.Clone(expiresKeyPrefix), key...)
+}
+
+// bucketEndKey
+//
+//	Get the smallest key greater than every key in a reserved bucket, by incrementing the trailing separator of the prefix.
+func bucketEndKey(prefix []byte) []byte {
+	return append(bytes.Clone(prefix[:len(prefix)-1]), prefix[len(prefix)-1]+1)
+}
@@ -0,0 +1,392 @@
+package mariv2
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+//============================================= Mari Two-Phase Commit
+
+// PrepareTx
+//
+//	Prepare a read-write transaction as a participant in a two-phase commit, without applying it.
+//	The transaction operations are run against the latest version, and the resulting writes are persisted as an intent under the transaction id in a reserved bucket.
+//	The keys written are locked until the transaction is committed or rolled back, so other transactions writing them fail with ErrKeyLocked and the prepared transaction is guaranteed to commit.
+//	The keys are locked before the intent is committed, and every commit checks the locks on its write set, so a transaction that wrote a key before it was locked fails with ErrKeyLocked instead of committing under the prepared transaction.
+//	If another transaction commits first, the operations are run again on the latest version instead of rebased, so the intent never holds writes computed from a stale version.
+//	Intents survive a crash, and the locks are restored when the instance is reopened.
+func (mariInst *Mari) PrepareTx(id string, txOps func(tx *Tx) error) error {
+	if txOps == nil {
+		return ErrNilTxOps
+	}
+
+	mariInst.prepared.lock.Lock()
+	defer mariInst.prepared.lock.Unlock()
+
+	var writeSet []*txWrite
+	prepareErr := mariInst.UpdateTx(func(tx *Tx) error {
+		tx.noRebase, tx.preparedID = true, id
+		mariInst.unlockKeys(id, writeSet)
+		writeSet = nil
+
+		intent, getErr := tx.get(preparedKey(id))
+		if getErr != nil {
+			return getErr
+		}
+
+		if intent != nil {
+			return ErrTxPrepared
+		}
+
+		root := *tx.root
+		opsErr := txOps(tx)
+		if opsErr != nil {
+			return opsErr
+		}
+
+		if mariInst.lockedByOther(tx.writeSet, id) {
+			return ErrKeyLocked
+		}
+
+		writeSet = tx.writeSet
+		mariInst.lockKeys(id, writeSet)
+
+		*tx.root = root
+		tx.writeSet = nil
+
+		return tx.put(preparedKey(id), serializeWriteSet(writeSet))
+	})
+
+	if prepareErr != nil {
+		mariInst.unlockKeys(id, writeSet)
+		return prepareErr
+	}
+
+	return nil
+}
+
+// CommitPrepared
+//
+//	Apply the writes of a prepared transaction and remove its intent in a single read-write transaction, then release its locks.
+//	If the transaction is not prepared, ErrPreparedTxNotFound is returned.
+func (mariInst *Mari) CommitPrepared(id string) error {
+	mariInst.prepared.lock.Lock()
+	defer mariInst.prepared.lock.Unlock()
+
+	var writeSet []*txWrite
+	commitErr := mariInst.UpdateTx(func(tx *Tx) error {
+		tx.preparedID = id
+
+		var commitTxErr error
+		writeSet, commitTxErr = loadWriteSet(tx, id)
+		if commitTxErr != nil {
+			return commitTxErr
+		}
+
+		for _, write := range writeSet {
+			if write.isDelete {
+				commitTxErr = tx.delete(write.key)
+			} else {
+				commitTxErr = tx.put(write.key, write.value)
+			}
+
+			if commitTxErr != nil {
+				return commitTxErr
+			}
+		}
+
+		return tx.delete(preparedKey(id))
+	})
+
+	if commitErr != nil {
+		return commitErr
+	}
+
+	mariInst.unlockKeys(id, writeSet)
+	return nil
+}
+
+// RollbackPrepared
+//
+//	Discard a prepared transaction by removing its intent, then release its locks.
+//	If the transaction is not prepared, ErrPreparedTxNotFound is returned.
+func (mariInst *Mari) RollbackPrepared(id string) error {
+	mariInst.prepared.lock.Lock()
+	defer mariInst.prepared.lock.Unlock()
+
+	var writeSet []*txWrite
+	rollbackErr := mariInst.UpdateTx(func(tx *Tx) error {
+		var rollbackTxErr error
+		writeSet, rollbackTxErr = loadWriteSet(tx, id)
+		if rollbackTxErr != nil {
+			return rollbackTxErr
+		}
+
+		return tx.delete(preparedKey(id))
+	})
+
+	if rollbackErr != nil {
+		return rollbackErr
+	}
+
+	mariInst.unlockKeys(id, writeSet)
+	return nil
+}
+
+// PreparedTxs
+//
+//	Get the ids of all transactions that are prepared but not committed or rolled back, in ascending order.
+//	Used by a coordinator to resolve in-doubt transactions after a crash.
+func (mariInst *Mari) PreparedTxs() ([]string, error) {
+	var ids []string
+	preparedErr := mariInst.ReadTx(func(tx *Tx) error {
+		intents, rangeErr := rangePrepared(tx)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for _, intent := range intents {
+			ids = append(ids, string(intent.Key[len(preparedKeyPrefix):]))
+		}
+
+		return nil
+	})
+
+	if preparedErr != nil {
+		return nil, preparedErr
+	}
+	return ids, nil
+}
+
+// recoverPrepared
+//
+//	Restore the key locks for every persisted intent when the instance is opened.
+func (mariInst *Mari) recoverPrepared() error {
+	return mariInst.ReadTx(func(tx *Tx) error {
+		intents, rangeErr := rangePrepared(tx)
+		if rangeErr != nil {
+			return rangeErr
+		}
+
+		for _, intent := range intents {
+			writeSet, desErr := deserializeWriteSet(intent.Value)
+			if desErr != nil {
+				return desErr
+			}
+
+			mariInst.lockKeys(string(intent.Key[len(preparedKeyPrefix):]), writeSet)
+		}
+
+		return nil
+	})
+}
+
+// isKeyLocked
+//
+//	Determine if a key is held by a prepared transaction.
+func (mariInst *Mari) isKeyLocked(key []byte) bool {
+	if atomic.LoadInt64(&mariInst.prepared.total) == 0 {
+		return false
+	}
+
+	mariInst.prepared.keysLock.RLock()
+	defer mariInst.prepared.keysLock.RUnlock()
+
+	_, ok := mariInst.prepared.keys[string(key)]
+	return ok
+}
+
+// isPrefixLocked
+//
+//	Determine if any key that begins with the prefix is held by a prepared transaction.
+func (mariInst *Mari) isPrefixLocked(prefix []byte) bool {
+	return mariInst.lockedByOther([]*txWrite{{key: prefix, isDelete: true, isPrefix: true}}, "")
+}
+
+// lockedByOther
+//
+//	Determine if any key in a write set is held by a prepared transaction other than the one with the id, where an empty id matches no prepared transaction.
+//	A prefix delete checks every locked key, since any key that begins with the prefix is written.
+func (mariInst *Mari) lockedByOther(writeSet []*txWrite, id string) bool {
+	if atomic.LoadInt64(&mariInst.prepared.total) == 0 {
+		return false
+	}
+
+	mariInst.prepared.keysLock.RLock()
+	defer mariInst.prepared.keysLock.RUnlock()
+
+	for _, write := range writeSet {
+		if write.isPrefix {
+			for key, holder := range mariInst.prepared.keys {
+				if holder != id && strings.HasPrefix(key, string(write.key)) {
+					return true
+				}
+			}
+
+			continue
+		}
+
+		holder, ok := mariInst.prepared.keys[string(write.key)]
+		if ok && holder != id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lockKeys
+//
+//	Lock every key in the write set of a prepared transaction.
+func (mariInst *Mari) lockKeys(id string, writeSet []*txWrite) {
+	mariInst.prepared.keysLock.Lock()
+	defer mariInst.prepared.keysLock.Unlock()
+
+	for _, write := range writeSet {
+		_, ok := mariInst.prepared.keys[string(write.key)]
+		if !ok {
+			mariInst.prepared.keys[string(write.key)] = id
+			atomic.AddInt64(&mariInst.prepared.total, 1)
+		}
+	}
+}
+
+// unlockKeys
+//
+//	Release every key in the write set that is held by the prepared transaction.
+func (mariInst *Mari) unlockKeys(id string, writeSet []*txWrite) {
+	mariInst.prepared.keysLock.Lock()
+	defer mariInst.prepared.keysLock.Unlock()
+
+	for _, write := range writeSet {
+		holder, ok := mariInst.prepared.keys[string(write.key)]
+		if ok && holder == id {
+			delete(mariInst.prepared.keys, string(write.key))
+			atomic.AddInt64(&mariInst.prepared.total, -1)
+		}
+	}
+}
+
+// loadWriteSet
+//
+//	Get the write set persisted in the intent for a prepared transaction.
+func loadWriteSet(tx *Tx, id string) ([]*txWrite, error) {
+	intent, getErr := tx.get(preparedKey(id))
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	if intent == nil {
+		return nil, ErrPreparedTxNotFound
+	}
+
+	return deserializeWriteSet(intent.Value)
+}
+
+// rangePrepared
+//
+//	Get every persisted intent in the reserved bucket.
+func rangePrepared(tx *Tx) ([]*KeyValuePair, error) {
+	kvPairs, rangeErr := tx.rangeKvPairs(preparedKeyPrefix, bucketEndKey(preparedKeyPrefix), nil)
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+
+	var intents []*KeyValuePair
+	for _, kvPair := range kvPairs {
+		if bytes.HasPrefix(kvPair.Key, preparedKeyPrefix) {
+			intents = append(intents, kvPair)
+		}
+	}
+
+	return intents, nil
+}
+
+// preparedKey
+//
+//	Get the key of the intent for a prepared transaction.
+func preparedKey(id string) []byte {
+	return append(bytes.Clone(preparedKeyPrefix), id...)
+}
+
+// serializeWriteSet
+//
+//	Serialize a write set as the total writes (8 bytes), followed by each write as the delete flag (1 byte), key length (4 bytes), key, value length (4 bytes), and value.
+//	The delete flag is 0 for a put, 1 for a delete, and 2 for a prefix delete.
+func serializeWriteSet(writeSet []*txWrite) []byte {
+	sWriteSet := serializeUint64(uint64(len(writeSet)))
+	for _, write := range writeSet {
+		var isDelete byte
+		switch {
+		case write.isPrefix:
+			isDelete = 2
+		case write.isDelete:
+			isDelete = 1
+		}
+
+		sWriteSet = append(sWriteSet, isDelete)
+		sWriteSet = append(sWriteSet, serializeUint32(uint32(len(write.key)))...)
+		sWriteSet = append(sWriteSet, write.key...)
+		sWriteSet = append(sWriteSet, serializeUint32(uint32(len(write.value)))...)
+		sWriteSet = append(sWriteSet, write.value...)
+	}
+
+	return sWriteSet
+}
+
+// deserializeWriteSet
+//
+//	Deserialize the byte representation of a write set. Keys and values are copied out of the memory map.
+func deserializeWriteSet(sWriteSet []byte) ([]*txWrite, error) {
+	invalidErr := errors.New("invalid data length for serialized write set")
+	if len(sWriteSet) < OffsetSize64 {
+		return nil, invalidErr
+	}
+
+	readBytes := func(offset int) ([]byte, int, error) {
+		if offset+OffsetSize32 > len(sWriteSet) {
+			return nil, 0, invalidErr
+		}
+
+		length, _ := deserializeUint32(sWriteSet[offset : offset+OffsetSize32])
+		start := offset + OffsetSize32
+		if uint64(start)+uint64(length) > uint64(len(sWriteSet)) {
+			return nil, 0, invalidErr
+		}
+
+		end := start + int(length)
+		return bytes.Clone(sWriteSet[start:end]), end, nil
+	}
+
+	totalWrites, _ := deserializeUint64(sWriteSet[:OffsetSize64])
+
+	var writeSet []*txWrite
+	offset := OffsetSize64
+	for range totalWrites {
+		if offset >= len(sWriteSet) {
+			return nil, invalidErr
+		}
+
+		isDelete, isPrefix := sWriteSet[offset] != 0, sWriteSet[offset] == 2
+		key, nextOffset, readErr := readBytes(offset + 1)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		value, nextOffset, readErr := readBytes(nextOffset)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		if isDelete {
+			value = nil
+		}
+
+		writeSet = append(writeSet, &txWrite{key: key, value: value, isDelete: isDelete, isPrefix: isPrefix})
+		offset = nextOffset
+	}
+
+	return writeSet, nil
+}
@@ -1,9 +1,15 @@
 package mariv2
 
 import (
+	"container/list"
+	"context"
+	"hash/maphash"
+	"log/slog"
+	"net"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -18,10 +24,136 @@ type InitOpts struct {
 	FileName string
 	// NodePoolSize: the total number of pre-allocated nodes to create in the node pool
 	NodePoolSize *int64
+	// NodePoolMaxRetained: the max number of nodes kept in the node pool for reuse, nodes put back to a full pool are dropped. Defaults to the node pool size
+	NodePoolMaxRetained *int64
+	// DisableNodePool: optionally pass true to allocate every node and leave recycling to the garbage collector
+	DisableNodePool *bool
+	// PoolDebug: optionally pass true to track every node taken from and put back into the node pool with the stack of the caller, so leaked and double returned nodes are reported by PoolAudit and double returns are logged. Tracking is expensive, so it should only be enabled while debugging
+	PoolDebug *bool
 	// CompactionTrigger: the custom compaction trigger function
 	CompactTrigger *CompactionTrigger
 	// AppendOnly: optionally pass true to stop the compaction process from occuring
 	AppendOnly *bool
+	// Follower: optionally pass true to open the instance as a follower, which rejects read-write transactions until promoted
+	Follower *bool
+	// ExpirationInterval: how often the expiration worker sweeps keys written with a ttl. Defaults to DefaultExpirationInterval
+	ExpirationInterval *time.Duration
+	// ExpirationJitter: optionally pass a duration to delay each expiration sweep by a random amount up to it, so instances opened together do not sweep at the same time. By default sweeps are not delayed
+	ExpirationJitter *time.Duration
+	// SubtreeCounts: optionally pass false to stop serializing the total keys in each subtree with internal nodes. Only applies to new files and compaction. By default will be true
+	SubtreeCounts *bool
+	// ValueChecksums: optionally pass true to serialize a checksum of the value with each leaf node, which is validated by tx.GetVerified. Only applies to new files and compaction, and requires subtree counts. By default will be false
+	ValueChecksums *bool
+	// Transforms: optionally register a pipeline of transforms, applied in order to every key-value pair returned by reads on the instance, before the transform passed to the read. Nil transforms are skipped
+	Transforms []Transform
+	// IteratorMaxAge: how long an iterator can be open before a warning is logged. Pass 0 to disable leak detection. Defaults to DefaultIteratorMaxAge
+	IteratorMaxAge *time.Duration
+	// ProfileTransactions: optionally pass true to run read and read-write transactions with pprof labels. By default only background workers are labeled
+	ProfileTransactions *bool
+	// OpLogSampleRate: optionally pass the fraction of operations, between 0 and 1, logged through the logger with the hash of their key, their latency, the nodes they visited, and the size of their results. Applies to Get, Put, Delete, Iterate, and Range. By default operations are not logged
+	OpLogSampleRate *float64
+	// Logger: the logger for warnings from the instance. Defaults to slog.Default()
+	Logger *slog.Logger
+	// Storage: optionally pass middleware to layer behavior around the memory mapped storage, like injected latency or faults, metrics, or rejecting writes. Applied in order, so the first middleware wraps the memory map and the last is called first
+	Storage []StorageMiddleware
+	// ReadTxWarnThreshold: how long a read only transaction can be open before a warning is logged with the stack that started it, while it is still open. Capturing the stack adds a cost to every read only transaction, so it is disabled by default
+	ReadTxWarnThreshold *time.Duration
+	// ContentionWarnThreshold: how long a read-write transaction can spend retrying on contention before a warning is logged with the hottest keys. Pass 0 to disable. Defaults to DefaultContentionWarnThreshold
+	ContentionWarnThreshold *time.Duration
+	// CloseTimeout: optionally pass how long Close and Remove wait for active transactions and background workers to finish before returning ErrBusy. Pass 0 to return ErrBusy without waiting. By default, Close waits until they finish
+	CloseTimeout *time.Duration
+	// ContentionPrefixLength: optionally pass the length of the key prefix conflicts are counted by, so hotspots spread across the keys of a prefix are grouped. By default conflicts are counted by full key
+	ContentionPrefixLength *int
+	// ReadTxAbortThreshold: how long a read only transaction can run before its operations return ErrReadTxTimeout. By default, read only transactions are not aborted
+	ReadTxAbortThreshold *time.Duration
+	// OpenValidation: how much of an existing file is checked for corruption when it is opened. Defaults to OpenValidationFast
+	OpenValidation *OpenValidation
+	// Degraded: optionally pass true to quarantine corrupt subtrees found by open validation, Verify, or reads, so the rest of the keyspace remains readable. By default corruption is returned as an error
+	Degraded *bool
+	// FileMode: the permissions of the file when it is created, and of the files created by compaction. Defaults to DefaultFileMode
+	FileMode *os.FileMode
+	// SyncDirectory: optionally pass true to fsync the directory after the file is created and after compaction renames it, so the directory entry survives a crash. By default will be false
+	SyncDirectory *bool
+	// Anonymous: optionally pass true to create the file without a name in Filepath, using O_TMPFILE where it is supported, so it is reclaimed by the filesystem when closed, even on a crash. FileName is ignored. By default will be false
+	Anonymous *bool
+	// RemoveOnClose: optionally pass true to remove the file when the instance is closed. By default will be false
+	RemoveOnClose *bool
+	// DisableFlush: optionally pass true to never flush the memory map or sync the file to disk, for scratch instances that do not need to survive a crash. By default will be false
+	DisableFlush *bool
+	// SyncCommits: optionally pass true for read-write transactions to wait until the commit is synced to disk before returning. By default will be false
+	SyncCommits *bool
+	// Isolation: the isolation level of read-write transactions. Defaults to IsolationSnapshot
+	Isolation *IsolationLevel
+	// FlushStrategy: how writes to the memory map are flushed to disk. Defaults to FlushStrategySync
+	FlushStrategy *FlushStrategy
+	// FlushBackend: optionally pass how regions of the memory map are flushed to disk through the Storage. Defaults to FlushBackendMsync
+	FlushBackend *FlushBackend
+	// EmptyValues: how nil and empty values passed to Put and PutWithTTL are handled. Defaults to EmptyValuesStore
+	EmptyValues *EmptyValuePolicy
+	// Tombstones: optionally pass true for deletes to write a tombstone with the version of the delete, which is retained until compaction and can be read with IncludeTombstones. By default deletes are not recorded
+	Tombstones *bool
+	// MaxKeySize: optionally pass the max length in bytes of keys passed to Put and PutWithTTL, after which they are rejected with ErrKeyTooLarge. Must be between 1 and MaxKeySize, which is the default, or MaxTombstoneKeySize with Tombstones
+	MaxKeySize *int
+	// MaxValueSize: optionally pass the max length in bytes of values passed to Put and PutWithTTL, after which they are rejected with ErrValueTooLarge. Must be between 1 and MaxValueSize, which is the default
+	MaxValueSize *int
+	// KeyNormalizer: optionally normalize keys on write and lookup, like LowerASCIINormalizer for a case-insensitive keyspace. The id of the normalizer is persisted in the file, so a file can only be opened with the normalizer it was created with. By default keys are not normalized
+	KeyNormalizer KeyNormalizer
+	// FlushInterval: with FlushStrategyBatch or FlushStrategyBackground, how often the dirty pages are written back. Defaults to DefaultFlushInterval
+	FlushInterval *time.Duration
+	// TargetCommitLatency: with FlushStrategyAdaptive, the p99 sync latency above which commits are grouped instead of synced individually. Defaults to DefaultTargetCommitLatency
+	TargetCommitLatency *time.Duration
+	// FlushDirtyBytes: with FlushStrategyBatch or FlushStrategyBackground, the dirty bytes after which the dirty pages are written back before the interval elapses. Defaults to DefaultFlushDirtyBytes
+	FlushDirtyBytes *int64
+	// DirectCompaction: optionally pass true to write compacted files with direct I/O, so compaction does not evict the page cache backing the memory map. Only supported on linux, and ignored for anonymous instances
+	DirectCompaction *bool
+	// IOLimiter: the limiter for background I/O, like compaction and verification, which can be shared between instances. By default background I/O is not limited
+	IOLimiter *IOLimiter
+	// ValueCacheSize: optionally pass the max key-value pairs held in an in-memory cache in front of tx.Get for read only transactions, evicting the least recently used. By default reads are not cached
+	ValueCacheSize *int
+	// CommitHooks: optionally register functions called with the event of every successful commit, in the goroutine that committed, once the commit is visible. Hooks run in the order passed
+	CommitHooks []CommitHook
+	// Validators: optionally register validators run on every key-value pair written by Put and PutWithTTL under their prefix, so malformed values are rejected with a ValidationError when written instead of surprising readers. Validators run in the order passed
+	Validators []*Validator
+	// Quotas: optionally limit the keys and bytes stored under key prefixes, so tenants sharing a file under their own prefixes can not crowd each other out. A commit that would put a prefix over its quota is rejected with a QuotaError
+	Quotas []*Quota
+	// RepairSources: optionally pass the leader or other replicas of the instance, tried in order when a value read by GetVerified does not match its checksum, so the value is served from a copy matching the checksum and rewritten in the local file. By default a corrupt value is returned as an error
+	RepairSources []RepairSource
+	// AuditLog: optionally pass the path of an append only audit log, separate from the memory mapped file, recording every operation committed with its version, timestamp and the annotations of its transaction. By default operations are not audited
+	AuditLog *string
+	// NegativeCacheSize: optionally pass the max keys not found by tx.Get held in an in-memory cache for read only transactions, evicting the least recently used, so polling for keys not yet written does not descend the trie. By default misses are not cached
+	NegativeCacheSize *int
+	// ResidencySampleInterval: optionally pass how often to sample the pages of the serialized data resident in memory with mincore, reported in Stats. Only supported on linux. By default residency is not sampled
+	ResidencySampleInterval *time.Duration
+	// MetricsSink: optionally pass a sink the stats of the instance are pushed to on every metrics interval, like a StatsDSink, for environments without a scrape based pipeline. By default metrics are not pushed
+	MetricsSink MetricsSink
+	// MetricsInterval: how often the stats are pushed to the metrics sink. Defaults to DefaultMetricsInterval
+	MetricsInterval *time.Duration
+	// ReadOpsPerSecond: optionally pass the max read only transactions started per second, with a burst of one second, after which reads are rejected with a ThrottledError. By default reads are not limited
+	ReadOpsPerSecond *int64
+	// WriteOpsPerSecond: optionally pass the max read-write transactions started per second, with a burst of one second, after which writes are rejected with a ThrottledError. By default writes are not limited
+	WriteOpsPerSecond *int64
+	// SoftMemoryLimit: optionally pass the max bytes held in memory by the value cache, the negative cache, the node pool, and the results of scans in flight. Past the limit the caches are shrunk, and while usage stays over it the node pool stops retaining nodes. By default memory is not limited
+	SoftMemoryLimit *int64
+	// ShedScansOver: with SoftMemoryLimit, optionally pass the results above which new scans are rejected with ErrMemoryPressure while usage is over the limit after shrinking the caches. By default scans are not rejected
+	ShedScansOver *int
+	// HotSetPrefixLength: optionally pass the length of the key prefixes reads are counted by, so the most read prefixes can be recorded as the hot set manifest with RecordHotSet. By default reads are not counted
+	HotSetPrefixLength *int
+	// WarmOnOpen: optionally pass true to prefetch the prefixes of the hot set manifest in the background once the instance is opened, so reads right after a restart do not wait on page faults
+	WarmOnOpen *bool
+	// ColdAfter: optionally pass how long a value can go without being read or written before it is moved to the cold file next to the instance file, keeping the memory map small. Reads fetch cold values transparently. By default values are never moved
+	ColdAfter *time.Duration
+	// ColdMinValueSize: optionally pass the smallest value moved to the cold file, since a cold value is replaced by a stub of ColdStubSize bytes. Defaults to DefaultColdMinValueSize
+	ColdMinValueSize *int
+	// TieringInterval: optionally pass how often values past ColdAfter are moved to the cold file. Defaults to DefaultTieringInterval
+	TieringInterval *time.Duration
+	// AccessPrefixLength: optionally pass the length of the key prefixes the last access is tracked by, so coarse last access times are recorded in the system keyspace and can be reported with AccessReport. Keys shorter than the prefix length are not tracked. By default last access is not tracked
+	AccessPrefixLength *int
+	// AccessSampleRate: with AccessPrefixLength, optionally pass the fraction of reads and writes, between 0 and 1, that record the last access of their prefix. Defaults to DefaultAccessSampleRate
+	AccessSampleRate *float64
+	// AccessRecordInterval: with AccessPrefixLength, optionally pass how often the sampled last access times are recorded in the system keyspace. Defaults to DefaultAccessRecordInterval
+	AccessRecordInterval *time.Duration
+	// ReadAtLeastTimeout: how long ReadTxAtLeast waits for the instance to reach a version before returning ErrVersionNotReached. Defaults to DefaultReadAtLeastTimeout
+	ReadAtLeastTimeout *time.Duration
 }
 
 // MariMetaData contains information related to where the root is located in the mem map and the version.
@@ -32,6 +164,14 @@ type MetaData struct {
 	rootOffset uint64
 	// NextStartOffset: the offset where the last node in the mmap is located
 	nextStartOffset uint64
+	// FormatVersion: the version of the serialized file format
+	formatVersion uint64
+	// Timestamp: the hybrid logical clock timestamp of the latest commit
+	timestamp uint64
+	// HistoryStartOffset: the offset of the first path copy after the initial or compacted root
+	historyStartOffset uint64
+	// KeyNormalizer: the id of the key normalizer the file was created with, or 0 if keys are not normalized
+	keyNormalizer uint64
 }
 
 // MariNode represents a singular node within the hash array mapped trie data structure.
@@ -48,6 +188,10 @@ type INode struct {
 	leaf *LNode
 	// Children: an array of child nodes, which are MariINodes. Location in the array is determined by the sparse index
 	children []*INode
+	// Count: the total keys in the subtree of the node, including its own leaf. Only serialized when subtree counts are enabled
+	count uint64
+	// Trace: the trace recording operations on the node and its children, never serialized
+	trace *TxTrace
 }
 
 // MariNode represents a singular node within the hash array mapped trie data structure.
@@ -58,32 +202,90 @@ type LNode struct {
 	startOffset uint64
 	// EndOffset: the offset from the end of the serialized node is located
 	endOffset uint16
+	// Timestamp: the hybrid logical clock timestamp of the commit that last wrote the key-value pair
+	timestamp uint64
 	// KeyLength: the length of the key in a Leaf Node. Keys can be variable size
 	keyLength uint8
 	// Key: The key associated with a value. Keys are in byte array representation. Keys are only stored within leaf nodes
 	key []byte
 	// Value: The value associated with a key, in byte array representation. Values are only stored within leaf nodes
 	value []byte
+	// Checksum: the checksum of the value, which is only serialized if the file has value checksums
+	checksum uint32
+	// Checksummed: whether the checksum was read with the leaf or computed for a new value. Otherwise it is computed when the leaf is serialized
+	checksummed bool
 }
 
 // KeyValuePair
 type KeyValuePair struct {
-	// Version: a tag for Copy-on-Write indicating the version of the node
-	// Version uint64
+	// Version: the version of Mari when the key-value pair was last written
+	Version uint64
+	// Timestamp: the hybrid logical clock timestamp of the commit that last wrote the key-value pair
+	Timestamp uint64
 	// Key: The key associated with a value. Keys are in byte array representation. Keys are only stored within leaf nodes
 	Key []byte
 	// Value: The value associated with a key, in byte array representation. Values are only stored within leaf nodes
 	Value []byte
+	// Deleted: whether the key-value pair is the tombstone of a deleted key, with the version and timestamp of the delete and no value. Only returned by Range with IncludeTombstones and by GetTombstone
+	Deleted bool
 }
 
 // Mari contains the memory mapped buffer for Mari, as well as all metadata for operations to occur
 type Mari struct {
 	// filepath: path to the Mari file
 	filepath string
+	// fileMode: the permissions of files created by the instance
+	fileMode os.FileMode
+	// syncDirectory: a flag to determine if the directory is synced after the file is created or renamed
+	syncDirectory bool
+	// anonymous: a flag to determine if the file was created without a name, so it is never renamed or removed
+	anonymous bool
+	// registryPath: the path the instance is registered under in the process wide registry, which is empty for anonymous instances
+	registryPath string
+	// removeOnClose: a flag to determine if the file is removed when the instance is closed
+	removeOnClose bool
+	// disableFlush: a flag to determine if flushes and syncs to disk are skipped
+	disableFlush bool
+	// syncCommits: a flag to determine if read-write transactions wait until the commit is synced to disk
+	syncCommits bool
+	// isolation: the isolation level of read-write transactions
+	isolation IsolationLevel
+	// emptyValues: how nil and empty values passed to Put and PutWithTTL are handled
+	emptyValues EmptyValuePolicy
+	// tombstones: whether deletes write a tombstone of the deleted key
+	tombstones bool
+	// maxKeySize: the max length of keys passed to Put and PutWithTTL
+	maxKeySize int
+	// maxValueSize: the max length of values passed to Put and PutWithTTL
+	maxValueSize int
+	// keyNormalizer: the normalizer applied to keys on write and lookup, or nil if keys are not normalized
+	keyNormalizer KeyNormalizer
+	// commitSeq: the total commits since the instance was opened, which the flush go routine records as synced
+	commitSeq uint64
+	// commitSyncs: the commits synced to disk by the flush go routine, which synchronous commits wait on
+	commitSyncs *commitSyncs
+	// flushStrategy: how writes to the memory map are flushed to disk
+	flushStrategy FlushStrategy
+	// flushInterval: how often the dirty pages are written back with FlushStrategyBatch or FlushStrategyBackground
+	flushInterval time.Duration
+	// flushDirtyBytes: the dirty bytes after which the dirty pages are written back before the interval elapses
+	flushDirtyBytes uint64
+	// dirty: the region of the memory map written since writeback was last started, with FlushStrategyBatch or FlushStrategyBackground
+	dirty *dirtyRegion
+	// adaptive: the sync latency window and current mode with FlushStrategyAdaptive
+	adaptive *adaptiveSync
+	// signalDirtyChan: send a signal to the dirty pages go routine when the dirty bytes exceed the threshold
+	signalDirtyChan chan bool
+	// directCompaction: a flag to determine if compacted files are written with direct I/O
+	directCompaction bool
+	// ioLimiter: the limiter for background I/O
+	ioLimiter *IOLimiter
 	// file: the Mari file
 	file *os.File
-	// opened: flag indicating if the file has been opened
-	opened bool
+	// state: the lifecycle State of the instance, transitioned atomically
+	state uint32
+	// closeTimeout: how long Close waits for active transactions and background workers, or less than 0 to wait until they finish
+	closeTimeout time.Duration
 	// data: the memory mapped file as a byte slice
 	data atomic.Value
 	// isResizing: atomic flag to determine if the mem map is being resized or not
@@ -102,18 +304,230 @@ type Mari struct {
 	compactTrigger CompactionTrigger
 	// appendOnly: a flag to determine whether or not to perform the compaction process. By default will be false
 	appendOnly bool
+	// isFollower: atomic flag to determine if read-write transactions are rejected because the instance is not the leader
+	isFollower uint32
+	// clock: the hybrid logical clock used to timestamp commits
+	clock *HLC
+	// versions: the lazily built index of committed versions, used for as-of queries
+	versions *versionIndex
+	// prepared: transactions prepared for two-phase commit that have not been committed or rolled back
+	prepared *preparedTxs
+	// keyLocks: the advisory locks held on keys in the process
+	keyLocks *keyLocks
+	// subscribers: the channels notified with the version of every commit
+	subscribers *versionSubscribers
+	// hasTTL: atomic flag to determine if any key has been written with a ttl, so writes only check the ttl index when needed
+	hasTTL uint32
+	// expirationInterval: how often the expiration worker sweeps keys written with a ttl
+	expirationInterval time.Duration
+	// expirationJitter: the max random delay added to each expiration interval
+	expirationJitter time.Duration
+	// signalExpireChan: send a signal to the expiration worker to sweep before the next interval, when a read finds an expired key
+	signalExpireChan chan bool
+	// storage: the memory mapped storage wrapped with the storage middleware, or nil without middleware so nodes are read and written on the memory map directly
+	storage Storage
+	// flushRing: the io_uring regions are flushed through with FlushBackendIOURing, closed with the instance
+	flushRing *ioURing
+	// closeChan: closed when the instance is closed to stop the background workers
+	closeChan chan struct{}
+	// workers: the background workers that must exit before the file is closed
+	workers sync.WaitGroup
+	// iterators: the open iterators and the versions they pin
+	iterators *openIterators
+	// iteratorMaxAge: how long an iterator can be open before a warning is logged
+	iteratorMaxAge time.Duration
+	// logger: the logger for warnings from the instance
+	logger *slog.Logger
+	// instanceLabel: the pprof label value identifying the instance, which is the file name
+	instanceLabel string
+	// profileTransactions: whether transactions are run with pprof labels
+	profileTransactions bool
+	// opLogSampleRate: the fraction of operations logged with their trace, where 0 or less logs none
+	opLogSampleRate float64
+	// readTxWarnThreshold: how long a read only transaction can run before a warning is logged
+	readTxWarnThreshold time.Duration
+	// contention: the retries, aborts and conflicting keys of read-write transactions
+	contention *contention
+	// slowOps: the most recent transactions that ran past their warning thresholds
+	slowOps *slowOps
+	// amplification: the bytes written and the payload of commits
+	amplification *amplification
+	// valueCache: the cache of key-value pairs read by tx.Get, or nil if disabled
+	valueCache *valueCache
+	// missCache: the cache of keys not found by tx.Get, or nil if disabled
+	missCache *valueCache
+	// residency: the latest sample of the pages resident in memory, or nil if disabled
+	residency *residency
+	// metricsSink: the sink the stats are pushed to, or nil if disabled
+	metricsSink MetricsSink
+	// metricsInterval: how often the stats are pushed to the metrics sink
+	metricsInterval time.Duration
+	// readThrottle: the limit on read only transactions per second, or nil if reads are not limited
+	readThrottle *opsThrottle
+	// writeThrottle: the limit on read-write transactions per second, or nil if writes are not limited
+	writeThrottle *opsThrottle
+	// memory: the soft memory limit, or nil if memory is not limited
+	memory *memoryLimiter
+	// hotSet: the reads counted by key prefix, or nil if reads are not counted
+	hotSet *hotSet
+	// warmOnOpen: whether the hot set manifest is prefetched once the instance is opened
+	warmOnOpen bool
+	// tiering: the cold file values are moved to, or nil if no value has been or can be moved
+	tiering *tiering
+	// tieredValues: the total values moved to the cold file
+	tieredValues uint64
+	// coldReads: the total values read from the cold file
+	coldReads uint64
+	// accessTracker: the last access sampled by key prefix, or nil if last access is not tracked
+	accessTracker *accessTracker
+	// readAtLeastTimeout: how long ReadTxAtLeast waits for the instance to reach a version
+	readAtLeastTimeout time.Duration
+	// audit: the audit log of committed operations, or nil if disabled
+	audit *auditLog
+	// commitHooks: the functions called with the event of every commit
+	commitHooks []CommitHook
+	// validators: the validators run on the key-value pairs written by Put and PutWithTTL, with normalized prefixes
+	validators []*Validator
+	// quotas: the quotas on key prefixes, with normalized prefixes, and the bytes last counted under each
+	quotas []*quotaState
+	// repairSources: the sources a corrupt value is fetched from, in order
+	repairSources []RepairSource
+	// repairChan: the values repaired from a repair source, queued to be rewritten by the repair worker
+	repairChan chan *repairRequest
+	// readRepairs: the total corrupt values served from a repair source
+	readRepairs uint64
+	// commitStream: the channels sent the event of every commit
+	commitStream *commitStream
+	// readTxAbortThreshold: how long a read only transaction can run before its operations are rejected
+	readTxAbortThreshold time.Duration
+	// activeReadTxs: atomic count of the open read only transactions
+	activeReadTxs int64
+	// readPins: the snapshot versions of the open read only transactions
+	readPins *readPins
+	// longReadTxs: atomic count of the read only transactions that ran past the warning threshold
+	longReadTxs uint64
+	// subtreeCounts: a flag to determine if every internal node in the file is serialized with its subtree count, based on the file format version
+	subtreeCounts bool
+	// enableSubtreeCounts: a flag to determine if new files and compacted files are written with subtree counts. By default will be true
+	enableSubtreeCounts bool
+	// valueChecksums: a flag to determine if every leaf node in the file is serialized with a checksum of its value, based on the file format version
+	valueChecksums bool
+	// enableValueChecksums: a flag to determine if new files and compacted files are written with value checksums. By default will be false
+	enableValueChecksums bool
+	// legacyTimestamp: the timestamp given to the leaf nodes of a legacy layout file while it is upgraded on open, or 0 if the file is not in the legacy layout
+	legacyTimestamp uint64
+	// transform: the pipeline of transforms registered with the instance, applied to every key-value pair returned by reads
+	transform Transform
+	// degraded: whether corrupt subtrees are quarantined instead of failing the instance
+	degraded bool
+	// quarantine: the corrupt subtrees found in degraded mode
+	quarantine *quarantine
+}
+
+// HLC is a hybrid logical clock. Timestamps are the wall clock milliseconds shifted left by HLCLogicalBits, plus a logical counter
+type HLC struct {
+	// lock: guards the last issued timestamp
+	lock sync.Mutex
+	// last: the last timestamp issued or received
+	last uint64
+	// now: the wall clock source
+	now func() time.Time
+}
+
+// versionIndex maps committed versions to the offset of their root and their commit timestamp
+type versionIndex struct {
+	// lock: guards the index while it is extended
+	lock sync.Mutex
+	// entries: the indexed versions, in ascending order by version and timestamp
+	entries []versionEntry
+	// nextOffset: the offset of the next path copy to index
+	nextOffset uint64
+}
+
+// versionEntry is a single committed version in the version index
+type versionEntry struct {
+	// version: the committed version
+	version uint64
+	// rootOffset: the offset of the root for the version
+	rootOffset uint64
+	// timestamp: the commit timestamp of the version
+	timestamp uint64
 }
 
 // MariNodePool contains pre-allocated MariINodes/MariLNodes to improve performance so go garbage collection doesn't handle allocating/deallocating nodes on every op
 type Pool struct {
+	// initialSize: the number of nodes pre-allocated when the pool is created
+	initialSize int64
 	// maxSize: the max size for the node pool
 	maxSize int64
+	// disabled: a flag to determine if nodes are allocated and dropped instead of recycled
+	disabled bool
 	// size: the current number of allocated nodes in the node pool
 	size int64
+	// gets: the total nodes taken from the node pool
+	gets uint64
+	// allocations: the total nodes allocated because the node pool was empty or disabled
+	allocations uint64
+	// puts: the total nodes put back into the node pool
+	puts uint64
+	// drops: the total nodes dropped because the node pool was full or disabled
+	drops uint64
+	// shedding: set to 1 while the instance is under memory pressure, so nodes put back are dropped
+	shedding uint32
 	// iNodePool: the node pool that contains pre-allocated internal nodes
 	iPool *sync.Pool
 	// lNodePool: the node pool that contains pre-allocated leaf nodes
 	lPool *sync.Pool
+	// audit: with PoolDebug, the tracked checkouts and returns of nodes, or nil if nodes are not tracked
+	audit *poolAudit
+}
+
+// poolAudit tracks the nodes taken from and put back into the node pool with PoolDebug
+type poolAudit struct {
+	// lock: guards the tracked nodes
+	lock sync.Mutex
+	// logger: the logger double returns are logged to
+	logger *slog.Logger
+	// checkedOut: the nodes taken from the pool and not yet put back, by address
+	checkedOut map[unsafe.Pointer]*poolEvent
+	// returned: the nodes put back into the pool and not yet taken again, by address
+	returned map[unsafe.Pointer]*poolEvent
+	// doubleReturns: the nodes put back while already put back, in the order they were detected
+	doubleReturns []*PoolCheckout
+	// untracked: the total nodes put back that were never taken from the pool, like nodes read from the memory map
+	untracked uint64
+}
+
+// poolEvent is a checkout or return of a node tracked with PoolDebug
+type poolEvent struct {
+	// kind: PoolNodeInternal or PoolNodeLeaf
+	kind string
+	// at: when the node was taken or put back
+	at time.Time
+	// stack: the program counters of the caller, symbolized only when reported
+	stack []uintptr
+}
+
+// PoolAudit is the report of the nodes tracked with PoolDebug
+type PoolAudit struct {
+	// Outstanding: the nodes taken from the pool and not put back, that were taken at least the min age ago, oldest first
+	Outstanding []*PoolCheckout
+	// DoubleReturns: the nodes put back into the pool while already put back, which can be handed out to two owners at once
+	DoubleReturns []*PoolCheckout
+	// Untracked: the total nodes put back that were never taken from the pool
+	Untracked uint64
+}
+
+// PoolCheckout is a node tracked with PoolDebug
+type PoolCheckout struct {
+	// Kind: PoolNodeInternal or PoolNodeLeaf
+	Kind string
+	// Age: how long ago the node was taken from the pool, or was first put back for a double return
+	Age time.Duration
+	// Stack: the stack that took the node from the pool, or that put it back the second time for a double return
+	Stack string
+	// PrevStack: for a double return, the stack that first put the node back
+	PrevStack string
 }
 
 // MariTx represents a transaction on the store
@@ -122,8 +536,1556 @@ type Tx struct {
 	store *Mari
 	// root: the root of the trie on which to operate on
 	root *unsafe.Pointer
+	// snapshotVersion: the version of the root captured when the transaction started, which is the version being written for read-write transactions
+	snapshotVersion uint64
+	// snapshotTimestamp: the hybrid logical clock timestamp the root captured when the transaction started was committed at, which compaction keeps
+	snapshotTimestamp uint64
+	// snapshotOffset: the offset of the root captured when the transaction started, which commit validates the transaction against
+	snapshotOffset uint64
+	// baseOffset: the offset of the root the modified path was copied from, which is the snapshot root until the transaction is rebased on a later root
+	baseOffset uint64
+	// readSet: with IsolationSerializable, the keys read by a read-write transaction
+	readSet [][]byte
+	// scanSet: with IsolationSerializable, the scans performed by a read-write transaction
+	scanSet []*txScan
+	// keyLock: the advisory lock the transaction was started through, so it can write the locked key
+	keyLock *KeyLock
+	// forUpdate: the keys read with GetForUpdate and the versions observed, which are validated at commit at any isolation level
+	forUpdate []*txRead
+	// noRebase: whether the transaction is retried on the latest version instead of rebased when another transaction committed first, for writes computed from the entire snapshot like a rollback
+	noRebase bool
+	// preparedID: the id of the prepared transaction the commit prepares or applies, so the keys locked by it can be written
+	preparedID string
+	// conflicted: whether the transaction failed validation on commit, as opposed to failing to commit while the file was resized or compacted
+	conflicted bool
 	// isWrite: determines whether the transaction is read only or read-write
 	isWrite bool
+	// writeSet: the puts and deletes performed in the transaction, in order
+	writeSet []*txWrite
+	// annotations: the metadata attached to a read-write transaction with SetAnnotation
+	annotations map[string]string
+	// commitVersion: the version a read-write transaction was committed at, or 0 until it is committed
+	commitVersion uint64
+	// commitTimestamp: the hybrid logical clock timestamp a read-write transaction was committed at, or 0 until it is committed
+	commitTimestamp uint64
+	// commitEvent: the event of a successful commit, passed to the commit hooks once the resize read lock is released
+	commitEvent *CommitEvent
+	// managed: whether the transaction was started with Begin and must be committed or rolled back
+	managed bool
+	// done: whether a transaction started with Begin has been committed or rolled back
+	done bool
+	// startedAt: when a read only transaction was started, only set when a read guard threshold is set
+	startedAt time.Time
+	// deadline: when a read only transaction is aborted, only set when the abort threshold is set
+	deadline time.Time
+	// stack: the program counters of the caller that started a read only transaction, only captured when the warning threshold is set and symbolized only when reported
+	stack []uintptr
+	// reported: whether a read only transaction has been reported as open past the warning threshold, guarded by the read pins lock
+	reported bool
+}
+
+// txWrite is a single put or delete in the write set of a transaction
+type txWrite struct {
+	// key: the key written
+	key []byte
+	// value: the value written, which is nil for deletes
+	value []byte
+	// isDelete: whether the write is a delete
+	isDelete bool
+	// isPrefix: whether the write is a delete of every key that begins with the key, recorded by tx.DeletePrefix
+	isPrefix bool
+}
+
+// txRead is a key read for update by a read-write transaction, and the version observed
+type txRead struct {
+	// key: the key read
+	key []byte
+	// version: the version of the key observed, if it exists
+	version uint64
+	// exists: whether the key existed when read
+	exists bool
+}
+
+// txScan is a scan performed by a read-write transaction, recorded so it can be repeated at commit with IsolationSerializable
+type txScan struct {
+	// startKey: the start key of the scan
+	startKey []byte
+	// endKey: for range, the end key of the scan
+	endKey []byte
+	// totalResults: for iterate, the max results of the scan, which is 0 for range
+	totalResults int
+}
+
+// KeyLock is an in-process advisory lock on a key, which is never persisted
+type KeyLock struct {
+	// store: the mari instance the key is locked on
+	store *Mari
+	// key: the locked key
+	key string
+	// released: closed when the lock is released, waking the callers waiting for the key
+	released chan struct{}
+	// unlocked: atomic flag to determine if the lock has been released
+	unlocked uint32
+}
+
+// keyLocks is the table of advisory locks held on keys
+type keyLocks struct {
+	// lock: guards the held locks
+	lock sync.Mutex
+	// held: the lock held on each key
+	held map[string]*KeyLock
+	// total: the number of held locks, so commits skip the table when no locks are held
+	total int64
+}
+
+// preparedTxs tracks transactions prepared for two-phase commit and the keys they hold
+type preparedTxs struct {
+	// lock: serializes prepare, commit, and rollback so the key locks are checked and acquired atomically
+	lock sync.Mutex
+	// keysLock: guards the key locks
+	keysLock sync.RWMutex
+	// keys: the locked keys, mapped to the id of the prepared transaction holding them
+	keys map[string]string
+	// total: the total number of locked keys, checked before taking the read lock so writes are not slowed when nothing is prepared
+	total int64
+}
+
+// versionSubscribers tracks the channels subscribed to committed versions
+type versionSubscribers struct {
+	// lock: guards the subscribed channels and serializes notifications
+	lock sync.Mutex
+	// chans: the subscribed channels, each buffered with the latest version not yet received
+	chans map[chan uint64]struct{}
+	// lastVersion: the last version notified, so a version is not notified twice
+	lastVersion uint64
+	// notified: whether any version has been notified
+	notified bool
+	// closed: whether the instance has been closed, after which new channels are closed immediately
+	closed bool
+}
+
+// sampledOp is an operation sampled with OpLogSampleRate, traced until it is logged
+type sampledOp struct {
+	// op: the name of the operation, like get or range
+	op string
+	// key: the key of the operation, or the start key of a scan, which is logged as a hash
+	key []byte
+	// trace: the nodes visited and read by the operation
+	trace *TxTrace
+	// startedAt: when the operation started, for its latency
+	startedAt time.Time
+}
+
+// TxTrace records the work performed by the operations traced with tx.Explain, or sampled with OpLogSampleRate
+type TxTrace struct {
+	// NodesVisited: the internal nodes traversed below the root, including nodes already in memory in the path copy of the transaction
+	NodesVisited int
+	// NodesRead: the internal nodes deserialized from the memory map
+	NodesRead int
+	// OffsetsRead: the offsets of the internal nodes read from the memory map, in the order they were read
+	OffsetsRead []uint64
+	// BytesRead: the bytes of the memory map touched reading internal nodes and their leaves
+	BytesRead uint64
+	// PathCopies: the internal nodes copied to modify the trie, which are serialized on commit
+	PathCopies int
+	// Duration: the time taken by the traced operations
+	Duration time.Duration
+	// active: whether operations are being recorded, so nodes still referencing the trace after it completes are not recorded
+	active bool
+}
+
+// RegionError describes an invalid region of the memory map, with the operation and location, so corruption can be located
+type RegionError struct {
+	// Op: the operation that accessed the region
+	Op string
+	// Offset: the offset of the region in the memory map
+	Offset uint64
+	// Length: the length of the region
+	Length uint64
+	// MapSize: the size of the memory map when the region was accessed
+	MapSize uint64
+	// Reason: why the region is invalid
+	Reason string
+	// Err: the kind of region error, which is ErrCorrupt, ErrOutOfBounds, or ErrChecksumMismatch
+	Err error
+}
+
+// QuarantineError is returned when an operation reads a corrupt subtree that was quarantined in degraded mode
+type QuarantineError struct {
+	// Prefix: the key prefix of the subtree, which is nil if the subtree was found by a read and has not been located by Verify
+	Prefix []byte
+	// Offset: the offset of the root of the subtree in the memory map
+	Offset uint64
+	// Err: the corruption found in the subtree, which is a RegionError
+	Err error
+}
+
+// AlreadyOpenError is returned when a file is opened while another instance in the process has it open
+type AlreadyOpenError struct {
+	// Path: the cleaned absolute path of the file
+	Path string
+	// Instance: the instance that has the file open, which can be used instead of opening the file again
+	Instance *Mari
+}
+
+// instanceRegistry contains the instances open in the process, by the cleaned absolute path of their file
+type instanceRegistry struct {
+	// lock: guards the instances
+	lock sync.Mutex
+	// instances: the open instances by path
+	instances map[string]*Mari
+}
+
+// quarantine contains the corrupt subtrees found in degraded mode, by the offset of the root of each subtree
+type quarantine struct {
+	// lock: guards the regions
+	lock sync.RWMutex
+	// regions: the quarantined subtrees by offset, which are shared by every version that references the subtree
+	regions map[uint64]*QuarantineError
+}
+
+// Iterator is a cursor over the key-value pairs of a pinned version, read in batches
+type Iterator struct {
+	// store: the mari instance the iterator reads from
+	store *Mari
+	// tx: the read only transaction holding the pinned version
+	tx *Tx
+	// version: the pinned version
+	version uint64
+	// nextKey: the start key of the next batch
+	nextKey []byte
+	// minVersion: the min version to return
+	minVersion uint64
+	// includeReserved: whether keys under ReservedKeyPrefix are included
+	includeReserved bool
+	// transform: the transform applied to each key-value pair
+	transform Transform
+	// batch: the current batch of key-value pairs
+	batch []*KeyValuePair
+	// pos: the position of the next key-value pair in the batch
+	pos int
+	// current: the key-value pair the iterator is positioned at
+	current *KeyValuePair
+	// exhausted: whether the last batch has been read
+	exhausted bool
+	// err: the error that stopped the iteration
+	err error
+	// openedAt: when the iterator was opened
+	openedAt time.Time
+	// stack: the stack trace where the iterator was opened, only captured when leak detection is enabled
+	stack []byte
+	// reported: whether the iterator has been reported as open past the max age, guarded by the open iterators lock
+	reported bool
+	// closed: atomic flag to determine if the iterator has been closed
+	closed uint32
+}
+
+// openIterators tracks the open iterators and reference counts the versions they pin
+type openIterators struct {
+	// lock: guards the open iterators and pins
+	lock sync.Mutex
+	// open: the open iterators
+	open map[*Iterator]struct{}
+	// pins: the versions pinned by open iterators, mapped to the total iterators pinning each version
+	pins map[uint64]int
+}
+
+// readPins tracks the snapshot versions of the open read only transactions, split into shards so concurrent transactions rarely share a lock
+type readPins struct {
+	// shards: the shards of the open read only transactions, chosen by the address of the transaction
+	shards [ReadPinShards]readPinShard
+}
+
+// readPinShard tracks the snapshot versions of the open read only transactions in one shard of the read pins
+type readPinShard struct {
+	// lock: guards the pins and open transactions of the shard
+	lock sync.Mutex
+	// pins: the snapshot versions of the open read only transactions, mapped to the total transactions reading each version
+	pins map[uint64]int
+	// open: the open read only transactions with a captured stack, checked for transactions open past the warning threshold
+	open map[*Tx]struct{}
+	// _: pads the shard to its own cache line, so pinning in one shard does not contend with the shards next to it
+	_ [40]byte
+}
+
+// VersionInfo is a retained version of the root, returned by Versions
+type VersionInfo struct {
+	// Version: the committed version
+	Version uint64
+	// Timestamp: the hybrid logical clock timestamp of the commit
+	Timestamp uint64
+	// RootOffset: the offset of the root of the version in the memory map
+	RootOffset uint64
+	// Size: the bytes of the path copy written by the commit. For the first retained version, this is the entire trie written on initialization or compaction
+	Size uint64
+	// Readers: the open read only transactions reading the version, including the transactions held by iterators
+	Readers int
+	// Iterators: the open iterators pinning the version
+	Iterators int
+	// Pinned: whether any reader or iterator is open on the version, which blocks compaction and resizing until it is closed
+	Pinned bool
+}
+
+// CheckpointInfo is a named checkpoint, returned by Checkpoints
+type CheckpointInfo struct {
+	// Name: the name the version was tagged with
+	Name string
+	// Version: the version tagged by the checkpoint
+	Version uint64
+	// Timestamp: the hybrid logical clock timestamp of the version
+	Timestamp uint64
+	// Retained: whether the version is still retained, which is false once compaction resets the versions
+	Retained bool
+}
+
+// Stats is a point in time snapshot of the state of a Mari instance
+type Stats struct {
+	// Version: the latest committed version of the root
+	Version uint64
+	// RootOffset: the offset of the latest version root node in the memory map
+	RootOffset uint64
+	// NextStartOffset: the offset where the next path copy will be appended, which is also the total serialized bytes
+	NextStartOffset uint64
+	// Timestamp: the hybrid logical clock timestamp of the latest commit
+	Timestamp uint64
+	// FormatVersion: the version of the serialized file format, which determines if subtree counts are available
+	FormatVersion uint64
+	// FileSize: the total size of the memory mapped file on disk, including unused pre-allocated space
+	FileSize int
+	// AllocatedSize: the bytes allocated on disk for the file, which is less than the file size when the pre-allocated space is sparse. Only read on linux, otherwise the file size
+	AllocatedSize int
+	// ActiveReadTxs: the read only transactions open when the snapshot was taken, including iterators
+	ActiveReadTxs int64
+	// LongReadTxs: the total read only transactions that ran past the warning threshold since the instance was opened
+	LongReadTxs uint64
+	// ReadRepairs: the total values that did not match their checksum and were served from a repair source since the instance was opened
+	ReadRepairs uint64
+	// TieredValues: the total values moved to the cold file since the instance was opened
+	TieredValues uint64
+	// ColdReads: the total values read from the cold file since the instance was opened
+	ColdReads uint64
+	// ColdFileSize: the size of the cold file, or 0 if no value has been moved
+	ColdFileSize int64
+	// BackgroundIO: the usage of the background I/O limiter, which includes every instance sharing the limiter
+	BackgroundIO IOLimiterStats
+	// GroupedSync: with FlushStrategyAdaptive, whether commits are currently grouped instead of synced individually
+	GroupedSync bool
+	// Contention: the retries and aborts of read-write transactions since the instance was opened, and the keys with the most conflicts
+	Contention ContentionStats
+	// ValueCache: the hits, misses, evictions and invalidations of the value cache since the instance was opened, which are all 0 if it is disabled
+	ValueCache ValueCacheStats
+	// NegativeCache: the hits, misses, evictions and invalidations of the negative cache of keys not found since the instance was opened, which are all 0 if it is disabled
+	NegativeCache ValueCacheStats
+	// WriteAmplification: the bytes appended to the memory map by commits since the instance was opened, against the payload of the keys and values written
+	WriteAmplification WriteAmplificationStats
+	// Residency: the latest sample of the serialized data resident in memory, which is all 0 if residency is not sampled
+	Residency ResidencyStats
+	// Throttle: the limits on transactions per second and the transactions rejected since the instance was opened, which are all 0 if transactions are not limited
+	Throttle ThrottleStats
+	// Memory: the bytes held against the soft memory limit, and the cache shrinks and scans rejected since the instance was opened
+	Memory MemoryStats
+	// SyncLatencyP99: with FlushStrategyAdaptive, the p99 latency of the recent syncs in the current mode
+	SyncLatencyP99 time.Duration
+}
+
+// ContentionStats is the contention between read-write transactions
+type ContentionStats struct {
+	// Retries: the total times read-write transactions were retried by UpdateTx after failing validation
+	Retries uint64
+	// Aborts: the total commits of transactions started with Begin rejected on conflict
+	Aborts uint64
+	// HotKeys: the keys, or key prefixes, with the most conflicts, up to ContentionHotKeys, most conflicts first
+	HotKeys []*KeyContention
+}
+
+// PrefixAccess is the last access of a key prefix tracked with AccessPrefixLength
+type PrefixAccess struct {
+	// Prefix: the key prefix, of length AccessPrefixLength
+	Prefix []byte
+	// LastAccess: the last sampled read or write of a key with the prefix, truncated to the second, or the zero time if no access was sampled
+	LastAccess time.Time
+	// Keys: the total keys stored under the prefix
+	Keys int
+}
+
+// AccessReport is the key prefixes accessed within a window, and the prefixes unused for as long
+type AccessReport struct {
+	// Active: the prefixes with keys accessed within the window, most keys first
+	Active []*PrefixAccess
+	// Unused: the prefixes with keys not accessed within the window, most keys first, which are candidates for deletion or cold storage
+	Unused []*PrefixAccess
+	// ActiveKeys: the total keys under the active prefixes, an estimate of the working set for sizing ValueCacheSize
+	ActiveKeys int
+	// UnusedKeys: the total keys under the unused prefixes
+	UnusedKeys int
+}
+
+// HotPrefix is a key prefix in the hot set, with the reads counted for it
+type HotPrefix struct {
+	// Prefix: the key prefix, of length HotSetPrefixLength or shorter for shorter keys
+	Prefix []byte
+	// Reads: the reads of keys with the prefix counted since the instance was opened
+	Reads uint64
+}
+
+// KeyContention is the conflicts on a key, or key prefix, that caused transactions to retry or abort
+type KeyContention struct {
+	// Key: the key, or the key prefix with ContentionPrefixLength
+	Key []byte
+	// Conflicts: the total conflicts on the key
+	Conflicts uint64
+}
+
+// WriteAmplificationStats is the bytes written to the memory map by commits against the logical payload written, which shows the overhead of path copying
+type WriteAmplificationStats struct {
+	// Commits: the total successful commits of read-write transactions
+	Commits uint64
+	// WrittenBytes: the total bytes of path copies appended to the memory map by the commits
+	WrittenBytes uint64
+	// PayloadBytes: the total bytes of the keys and values written by the commits, counting the last write to each key in a transaction and only the key for a delete
+	PayloadBytes uint64
+	// Ratio: WrittenBytes divided by PayloadBytes, or 0 if nothing was written
+	Ratio float64
+}
+
+// ResidencyStats is a sample of the pages of the serialized data resident in memory, which shows if reads are served from memory or disk
+type ResidencyStats struct {
+	// Samples: the total samples taken since the instance was opened
+	Samples uint64
+	// SampledAt: when the latest sample was taken
+	SampledAt time.Time
+	// MappedBytes: the bytes of serialized data in the memory map, rounded up to the page size
+	MappedBytes uint64
+	// ResidentBytes: the bytes of serialized data resident in memory
+	ResidentBytes uint64
+	// ResidentRatio: ResidentBytes divided by MappedBytes, where a low ratio means reads are likely to fault to disk
+	ResidentRatio float64
+	// MajorFaults: an estimate of the major page faults since the instance was opened, which counts every fault of the process, including faults outside of the memory map
+	MajorFaults uint64
+}
+
+// ThrottleStats is the usage of the limits on transactions per second
+type ThrottleStats struct {
+	// ReadRate: the read only transactions per second allowed, where 0 is unlimited
+	ReadRate int64
+	// WriteRate: the read-write transactions per second allowed, where 0 is unlimited
+	WriteRate int64
+	// ReadsThrottled: the total read only transactions rejected since the instance was opened
+	ReadsThrottled uint64
+	// WritesThrottled: the total read-write transactions rejected since the instance was opened
+	WritesThrottled uint64
+}
+
+// MemoryStats is the memory held by the caches, the node pool, and the scans in flight, against the soft memory limit
+type MemoryStats struct {
+	// Limit: the soft memory limit in bytes, where 0 is unlimited
+	Limit int64
+	// Usage: the estimated bytes held, which is reported even if memory is not limited
+	Usage int64
+	// Pressured: whether usage was over the limit after shrinking the caches when memory was last checked
+	Pressured bool
+	// Shrinks: the total times the caches were shrunk to get under the limit
+	Shrinks uint64
+	// ShedScans: the total scans rejected with ErrMemoryPressure
+	ShedScans uint64
+}
+
+// memoryLimiter is the soft memory limit on the caches, the node pool, and the scans in flight
+type memoryLimiter struct {
+	// limit: the max bytes held before the caches are shrunk
+	limit int64
+	// shedScansOver: the results above which scans are rejected under memory pressure, where 0 or less never rejects
+	shedScansOver int
+	// scanBytes: the bytes of the keys and values of the results of scans in flight
+	scanBytes int64
+	// pressured: set to 1 while usage is over the limit after shrinking the caches
+	pressured uint32
+	// shrinks: the total times the caches were shrunk
+	shrinks uint64
+	// shedScans: the total scans rejected
+	shedScans uint64
+}
+
+// opsThrottle is a token bucket limiting the transactions started per second, which rejects transactions instead of waiting when it is empty
+type opsThrottle struct {
+	// lock: guards the tokens and the last refill
+	lock sync.Mutex
+	// rate: the transactions per second added to the bucket, which is also the max tokens
+	rate int64
+	// tokens: the tokens in the bucket at the last refill
+	tokens float64
+	// last: the time of the last refill
+	last time.Time
+	// throttled: the total transactions rejected
+	throttled uint64
+}
+
+// ThrottledError is returned when a transaction is rejected because the instance is over its limit on transactions per second
+type ThrottledError struct {
+	// Op: the operation invoked
+	Op string
+	// RetryAfter: how long until the limit allows another transaction
+	RetryAfter time.Duration
+}
+
+// QuotaError is returned when a commit is rejected because it would put a key prefix over its quota
+type QuotaError struct {
+	// Prefix: the prefix of the quota exceeded
+	Prefix []byte
+	// Keys: the keys under the prefix with the commit applied
+	Keys int
+	// Bytes: the bytes of the keys and values under the prefix with the commit applied
+	Bytes int64
+	// MaxKeys: the max keys of the quota, or 0 if keys are not limited
+	MaxKeys int
+	// MaxBytes: the max bytes of the quota, or 0 if bytes are not limited
+	MaxBytes int64
+}
+
+// QuorumError is returned by QuorumRead when a quorum of the replicas does not reply
+type QuorumError struct {
+	// Quorum: the replicas that had to reply
+	Quorum int
+	// Replied: the replicas that replied before the read failed
+	Replied int
+	// Errs: the errors of the replicas that failed to reply, and of the context if the read timed out
+	Errs []error
+}
+
+// ValidationError is returned when a key-value pair written by Put or PutWithTTL is rejected by a validator
+type ValidationError struct {
+	// Prefix: the prefix of the validator that rejected the key-value pair
+	Prefix []byte
+	// Key: the key written
+	Key []byte
+	// Err: the error returned by the validator
+	Err error
+}
+
+// VerifyReport is the result of checking a file for corruption with VerifyFile
+type VerifyReport struct {
+	// File: the path of the file that was checked
+	File string `json:"file"`
+	// Deep: whether every node reachable from the root was walked, or only the metadata and the root and its children
+	Deep bool `json:"deep"`
+	// OK: whether no corruption was found
+	OK bool `json:"ok"`
+	// Version: the latest committed version of the root, or 0 if the file could not be opened
+	Version uint64 `json:"version"`
+	// FormatVersion: the version of the serialized file format, or 0 if the file could not be opened
+	FormatVersion uint64 `json:"formatVersion"`
+	// ValueChecksums: whether the values of the leaves were validated against their checksums, which requires a deep check of a file with value checksums
+	ValueChecksums bool `json:"valueChecksums"`
+	// FileSize: the size of the file on disk
+	FileSize int64 `json:"fileSize"`
+	// DurationNs: how long the check took, in nanoseconds
+	DurationNs int64 `json:"durationNs"`
+	// Issues: the corruption found, which is empty if the file is ok
+	Issues []*VerifyIssue `json:"issues"`
+}
+
+// VerifyIssue is a corrupt region found by VerifyFile
+type VerifyIssue struct {
+	// Prefix: the key prefix of the corrupt subtree in hex, which is empty for the metadata or the root
+	Prefix string `json:"prefix,omitempty"`
+	// Offset: the offset of the corrupt region in the file
+	Offset uint64 `json:"offset"`
+	// Op: the operation that found the corruption
+	Op string `json:"op"`
+	// ChecksumMismatch: whether a value did not match its checksum, instead of the structure of the trie being corrupt
+	ChecksumMismatch bool `json:"checksumMismatch"`
+	// Reason: why the region is corrupt
+	Reason string `json:"reason"`
+}
+
+// AuditOp is the kind of operation recorded in the audit log
+type AuditOp string
+
+const (
+	// AuditOpPut is a put of a key-value pair
+	AuditOpPut AuditOp = "put"
+	// AuditOpDelete is a delete of a key
+	AuditOpDelete AuditOp = "delete"
+	// AuditOpDeletePrefix is a delete of every key that begins with the key
+	AuditOpDeletePrefix AuditOp = "deletePrefix"
+)
+
+// AuditEntry is an operation of a committed transaction, recorded in the audit log as a line of JSON
+type AuditEntry struct {
+	// Version: the version the transaction was committed at
+	Version uint64 `json:"version"`
+	// Timestamp: the hybrid logical clock timestamp of the commit
+	Timestamp uint64 `json:"timestamp"`
+	// Op: whether the operation is a put or a delete
+	Op AuditOp `json:"op"`
+	// Key: the key written, encoded as base64 in the log
+	Key []byte `json:"key"`
+	// ValueSize: the size of the value put, which is not recorded itself
+	ValueSize int `json:"valueSize,omitempty"`
+	// Annotations: the metadata set on the transaction with SetAnnotation
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// CommitHook is the function signature for commit hooks, which are called with the event of every successful commit. The event is shared, so it must not be modified
+type CommitHook = func(event *CommitEvent)
+
+// ValidateFunc is the function signature for validators, which return an error to reject a key-value pair written by Put or PutWithTTL. The key and value must not be modified
+type ValidateFunc = func(key, value []byte) error
+
+// Validator validates the key-value pairs written under a key prefix, like values that must decode as a message or JSON document
+type Validator struct {
+	// Prefix: the key prefix validated, where an empty prefix validates every key written
+	Prefix []byte
+	// Validate: the function run on each key-value pair written under the prefix
+	Validate ValidateFunc
+}
+
+// Quota limits the keys and bytes stored under a key prefix
+type Quota struct {
+	// Prefix: the key prefix limited, where an empty prefix limits every key outside ReservedKeyPrefix
+	Prefix []byte
+	// MaxKeys: the max keys under the prefix, or 0 to not limit keys
+	MaxKeys int
+	// MaxBytes: the max bytes of the keys and values under the prefix, as stored in the memory map, or 0 to not limit bytes
+	MaxBytes int64
+}
+
+// QuotaUsage is the usage of a quota at the latest version, returned by QuotaUsage
+type QuotaUsage struct {
+	// Prefix: the key prefix of the quota
+	Prefix []byte
+	// Keys: the keys under the prefix
+	Keys int
+	// Bytes: the bytes of the keys and values under the prefix, as stored in the memory map
+	Bytes int64
+	// MaxKeys: the max keys of the quota, or 0 if keys are not limited
+	MaxKeys int
+	// MaxBytes: the max bytes of the quota, or 0 if bytes are not limited
+	MaxBytes int64
+	// Rejected: the commits rejected for exceeding the quota since the instance was opened
+	Rejected uint64
+}
+
+// quotaState is a quota of the instance and the bytes under its prefix at the root last committed, so a commit only counts the bytes of the keys it writes
+type quotaState struct {
+	// quota: the quota, with a normalized prefix
+	quota *Quota
+	// lock: guards the counted root and bytes
+	lock sync.Mutex
+	// counted: whether the bytes have been counted, since they are counted on the first commit instead of when the instance is opened
+	counted bool
+	// rootOffset: the offset of the root the bytes were counted at
+	rootOffset uint64
+	// rootVersion: the version of the root the bytes were counted at, so a root written at the same offset after compaction is not mistaken for it
+	rootVersion uint64
+	// bytes: the bytes of the keys and values under the prefix at the root
+	bytes int64
+	// rejected: the commits rejected for exceeding the quota
+	rejected uint64
+}
+
+// CommitEvent is a successful commit of a read-write transaction, passed to commit hooks and sent to CommitChan subscribers
+type CommitEvent struct {
+	// Version: the version the transaction was committed at
+	Version uint64
+	// Timestamp: the hybrid logical clock timestamp of the commit
+	Timestamp uint64
+	// Changes: the puts and deletes of user keys in the transaction, in the order they were performed
+	Changes []*Change
+	// Annotations: the metadata set on the transaction with SetAnnotation
+	Annotations map[string]string
+}
+
+// Change is a put or delete of a key in a commit
+type Change struct {
+	// Key: the key written
+	Key []byte
+	// Value: the value put, which is nil for deletes
+	Value []byte
+	// Delete: whether the change is a delete
+	Delete bool
+	// Prefix: whether the change is a delete of every key that begins with the key, from tx.DeletePrefix without ttls or tombstones
+	Prefix bool
+}
+
+// ChangefeedOpts contains options for a changefeed
+type ChangefeedOpts struct {
+	// Cursor: optionally pass the name of a durable cursor in the system keyspace, so the changefeed resumes after the last version acked with the name. By default the changefeed starts at the latest version and is not durable
+	Cursor string
+	// Prefix: optionally pass a prefix, so only changes to keys with the prefix are received. By default changes to every user key are received
+	Prefix []byte
+	// Ops: optionally pass the kinds of changes received, AuditOpPut or AuditOpDelete. By default both are received
+	Ops []AuditOp
+	// BufferSize: the events buffered for the consumer. Defaults to 1
+	BufferSize int
+}
+
+// Changefeed is a filtered stream of commit events that catches up on commits it missed from the retained history, so every version is delivered in order
+type Changefeed struct {
+	// mariInst: the instance the changefeed is on
+	mariInst *Mari
+	// opts: the cursor and filters of the changefeed
+	opts ChangefeedOpts
+	// events: the filtered events sent to the consumer
+	events chan *CommitEvent
+	// cancel: unsubscribes from the commit events of the instance
+	cancel func()
+	// done: closed when the changefeed is closed by the consumer
+	done chan struct{}
+	// stopped: closed when the changefeed stops sending events
+	stopped chan struct{}
+	// closeOnce: ensures the changefeed is only closed once
+	closeOnce sync.Once
+	// err: why the changefeed stopped, which is set before the events channel is closed
+	err error
+}
+
+// ReplicationSink receives the version deltas of a leader, in version order, for replicas, backups, or custom replication topologies
+type ReplicationSink interface {
+	// Receive ships a delta, returning nil once the sink acks it. A delta that is not acked is received again
+	Receive(ctx context.Context, delta *CommitEvent) error
+	// Close releases the resources of the sink once replication stops
+	Close() error
+}
+
+// ReplicationOpts contains options for replicating to a sink
+type ReplicationOpts struct {
+	// Cursor: optionally pass the name of a durable changefeed cursor, so replication resumes after the last delta acked by the sink. By default replication starts at the latest version
+	Cursor string
+	// Prefix: optionally pass a prefix, so only changes to keys with the prefix are replicated
+	Prefix []byte
+	// BufferSize: the deltas buffered ahead of the sink. Defaults to 1
+	BufferSize int
+	// RetryInterval: how long to wait before shipping a delta again after the sink fails to ack it. Defaults to DefaultReplicationRetryInterval
+	RetryInterval *time.Duration
+	// SnapshotChunkSize: the max key-value pairs in each chunk of a snapshot sent to a CatchUpSink. Defaults to DefaultSnapshotChunkSize
+	SnapshotChunkSize int
+}
+
+// CatchUpSink is a ReplicationSink for a replica that reports its position, so a replica too far behind the retained versions receives a snapshot followed by deltas
+type CatchUpSink interface {
+	ReplicationSink
+	// Position returns the position of the replica, which is requested when replication starts, when the sink fails, and when the replica falls behind
+	Position(ctx context.Context) (*ReplicaPosition, error)
+	// ReceiveSnapshot ships a chunk of a snapshot, returning nil once the sink acks it
+	ReceiveSnapshot(ctx context.Context, chunk *SnapshotChunk) error
+}
+
+// RepairSource is a copy of the instance, like its leader or another replica, that a value not matching its checksum is fetched from
+type RepairSource interface {
+	// Fetch returns the latest key-value pair for a key, or nil if the key does not exist. The value is only used if it matches the checksum of the corrupt value
+	Fetch(ctx context.Context, key []byte) (*KeyValuePair, error)
+}
+
+// ReplicaReader is a copy of the instance, like its leader or a replica, that QuorumRead reads a key from
+type ReplicaReader interface {
+	// ReadReplica returns the key-value pair for a key, or a nil key-value pair if the key does not exist, with the leader version and timestamp the copy has applied as of the read
+	ReadReplica(ctx context.Context, key []byte) (*ReplicaRead, error)
+}
+
+// ReplicaRead is a key read from a copy of the instance, with how fresh the copy was when read
+type ReplicaRead struct {
+	// Version: the last leader version the copy applied as of the read, which is the latest version of the leader itself
+	Version uint64
+	// Timestamp: the timestamp of the version, which orders reads across copies since timestamps are hybrid logical clocks
+	Timestamp uint64
+	// KvPair: the key-value pair, without its version and timestamp since they are local to the copy, or nil if the key does not exist
+	KvPair *KeyValuePair
+}
+
+// QuorumReadOpts contains options for reading a key from a quorum of replicas with QuorumRead
+type QuorumReadOpts struct {
+	// Quorum: the replicas that must reply before the freshest read is returned. Defaults to a majority of the replicas
+	Quorum int
+	// Timeout: how long to wait for a quorum of the replicas to reply. Defaults to DefaultQuorumReadTimeout
+	Timeout *time.Duration
+}
+
+// ReplicaPosition is what a replica has applied, which determines whether the leader resumes it from deltas or sends it a snapshot
+type ReplicaPosition struct {
+	// Version: the leader version of the last delta or snapshot applied, which is 0 if nothing was applied
+	Version uint64
+	// Timestamp: the hybrid logical clock timestamp of the leader version
+	Timestamp uint64
+	// SnapshotVersion: the leader version of a snapshot that is partially applied, which is 0 if no snapshot is in progress
+	SnapshotVersion uint64
+	// SnapshotTimestamp: the hybrid logical clock timestamp of the snapshot version
+	SnapshotTimestamp uint64
+	// SnapshotKey: the last key of the snapshot applied, which the transfer resumes after
+	SnapshotKey []byte
+}
+
+// SnapshotChunk is a batch of the key-value pairs of a leader version, in key order, sent to a replica too far behind to catch up from deltas
+type SnapshotChunk struct {
+	// Version: the leader version the snapshot is read at
+	Version uint64
+	// Timestamp: the hybrid logical clock timestamp of the version
+	Timestamp uint64
+	// Prefix: the prefix of the replicated keys, which are deleted from the replica before the first chunk is applied
+	Prefix []byte
+	// After: the last key of the previous chunk, which is nil for the first chunk
+	After []byte
+	// Last: the last key read for the chunk, which the next chunk follows
+	Last []byte
+	// Pairs: the key-value pairs of the chunk, with only the key and value set
+	Pairs []*KeyValuePair
+	// Done: whether the chunk is the last of the snapshot
+	Done bool
+	// Checksum: the crc32 checksum of the key-value pairs, which the replica verifies before the chunk is applied
+	Checksum uint32
+}
+
+// Replication ships the deltas of a changefeed to a sink in the background, retrying each delta until it is acked
+type Replication struct {
+	// mariInst: the instance being replicated
+	mariInst *Mari
+	// sink: the sink receiving the deltas
+	sink ReplicationSink
+	// feed: the changefeed the deltas are read from, which is opened once the position of a CatchUpSink is known
+	feed *Changefeed
+	// opts: the cursor, prefix, and sizes of the replication
+	opts ReplicationOpts
+	// retryInterval: how long to wait before shipping a delta again
+	retryInterval time.Duration
+	// ctx: passed to the sink, and canceled when replication is stopped
+	ctx context.Context
+	// cancel: cancels the context passed to the sink
+	cancel context.CancelFunc
+	// stopped: closed when the replication go routine exits
+	stopped chan struct{}
+	// stopOnce: ensures replication is only stopped once
+	stopOnce sync.Once
+	// acked: the version of the last delta or snapshot acked by the sink
+	acked uint64
+	// err: why replication stopped, which is set before stopped is closed
+	err error
+}
+
+// TCPSink ships deltas and snapshots to a replica serving replication with ServeReplication, over a single connection that is dialed again after a failure
+type TCPSink struct {
+	// addr: the address of the replica
+	addr string
+	// conn: the connection to the replica, which is nil until dialed or after a failure
+	conn net.Conn
+}
+
+// TCPRepairSource fetches keys from a replica serving replication with ServeReplication, to repair corrupt values
+type TCPRepairSource struct {
+	// lock: serializes the round trips on the connection, since reads can be repaired concurrently
+	lock sync.Mutex
+	// sink: the connection to the replica
+	sink *TCPSink
+}
+
+// TCPReplicaReader reads keys from a replica serving replication with ServeReplication, for quorum reads
+type TCPReplicaReader struct {
+	// lock: serializes the round trips on the connection, since keys can be read concurrently
+	lock sync.Mutex
+	// sink: the connection to the replica
+	sink *TCPSink
+}
+
+// repairRequest is a value fetched from a repair source, queued to be rewritten in the local file
+type repairRequest struct {
+	// key: the key of the corrupt value
+	key []byte
+	// value: the value fetched, which matches the checksum of the corrupt value
+	value []byte
+	// offset: the offset of the corrupt leaf, so the value is only rewritten if the key was not written since
+	offset uint64
+}
+
+// DirectorySink ships deltas as files to a directory, named by the timestamp of the delta, so they can be applied by ApplyDirectory on another host
+type DirectorySink struct {
+	// dir: the directory the deltas are written to
+	dir string
+}
+
+// OutboxEntry is an event written to the outbox in the same transaction as the records it describes, which is read and acked by a consumer that publishes it
+type OutboxEntry struct {
+	// ID: the hybrid logical clock timestamp issued when the event was appended, which orders the outbox and is passed to AckOutbox
+	ID uint64
+	// Version: the version the event was committed at
+	Version uint64
+	// Event: the payload of the event
+	Event []byte
+}
+
+// commitStream is the channels subscribed to the events of commits
+type commitStream struct {
+	// lock: guards the subscribed channels and serializes sends, so events are sent in version order
+	lock sync.Mutex
+	// chans: the subscribed channels
+	chans map[chan *CommitEvent]struct{}
+	// closed: whether the instance has been closed, after which new channels are closed immediately
+	closed bool
+}
+
+// auditLog is the append only file the operations of commits are recorded in
+type auditLog struct {
+	// file: the audit log, opened for appending
+	file *os.File
+}
+
+// ValueCacheStats is the usage of the value cache, or the negative cache, in front of tx.Get
+type ValueCacheStats struct {
+	// Hits: the total reads served from the cache
+	Hits uint64
+	// Misses: the total reads of keys not in the cache, or cached at a version not valid for the transaction
+	Misses uint64
+	// Evictions: the total entries evicted as least recently used when the cache was full
+	Evictions uint64
+	// Invalidations: the total entries removed because a commit wrote the key
+	Invalidations uint64
+	// Entries: the key-value pairs currently cached
+	Entries int
+}
+
+// valueCache is a bounded least recently used cache of key-value pairs, or of keys not found for the negative cache, invalidated by the keys written by each commit
+type valueCache struct {
+	// lock: guards the entries, the order, and the counters
+	lock sync.Mutex
+	// capacity: the max entries
+	capacity int
+	// entries: the elements of the order by key
+	entries map[string]*list.Element
+	// order: the entries, most recently used first
+	order *list.List
+	// applied: the latest version whose writes have been invalidated
+	applied uint64
+	// hits: the total reads served from the cache
+	hits uint64
+	// misses: the total reads not served from the cache
+	misses uint64
+	// evictions: the total entries evicted
+	evictions uint64
+	// invalidations: the total entries invalidated by commits
+	invalidations uint64
+	// bytes: the estimated bytes held by the entries, counted against the soft memory limit
+	bytes int64
+}
+
+// cacheEntry is a key-value pair in the value cache and the version it was read at
+type cacheEntry struct {
+	// key: the key cached
+	key string
+	// kvPair: a copy of the key-value pair, out of the memory map, or nil for a key not found
+	kvPair *KeyValuePair
+	// version: the snapshot version the key-value pair was read at
+	version uint64
+}
+
+// residency samples the pages of the serialized data resident in memory
+type residency struct {
+	// interval: how often the pages are sampled
+	interval time.Duration
+	// baseFaults: the major page faults of the process when the instance was opened
+	baseFaults uint64
+	// lock: guards the latest sample
+	lock sync.Mutex
+	// latest: the latest sample
+	latest ResidencyStats
+}
+
+// amplification tracks the bytes written and the payload of commits
+type amplification struct {
+	// commits: the total commits
+	commits uint64
+	// writtenBytes: the total bytes appended to the memory map
+	writtenBytes uint64
+	// payloadBytes: the total bytes of keys and values written
+	payloadBytes uint64
+}
+
+// hotSet counts the reads of each key prefix, which are recorded as the hot set manifest
+type hotSet struct {
+	// lock: guards the reads
+	lock sync.Mutex
+	// reads: the reads by key prefix, up to HotSetMaxPrefixes
+	reads map[string]uint64
+	// prefixLength: the length of the key prefix reads are counted by
+	prefixLength int
+}
+
+// tiering moves values that have not been read or written for ColdAfter to the cold file, replacing them in the trie with stubs
+type tiering struct {
+	// lock: serializes tiering passes, which append to the cold file
+	lock sync.Mutex
+	// id: the random id of the instance file that starts every stub, so a stub is never mistaken for a value
+	id []byte
+	// file: the cold file, which values are appended to and never rewritten
+	file *os.File
+	// size: atomic size of the cold file, where the next value is appended
+	size int64
+	// coldAfter: how long a value can go without being read or written before it is moved, or 0 if values are only read from the cold file
+	coldAfter time.Duration
+	// minValueSize: the smallest value moved
+	minValueSize int
+	// interval: how often values are moved
+	interval time.Duration
+	// openedAt: when the cold file was opened, since reads are only tracked from then
+	openedAt time.Time
+	// accesses: the last read of each key read since the instance was opened
+	accesses *accessTimes
+}
+
+// accessTracker samples the last access of each key prefix, which is recorded in the system keyspace
+type accessTracker struct {
+	// lock: guards the accessed and recorded times
+	lock sync.Mutex
+	// accessed: the last access sampled by key prefix since the instance was opened, in unix seconds, up to AccessMaxPrefixes
+	accessed map[string]int64
+	// recorded: the last access by key prefix recorded before the instance was opened, in unix seconds
+	recorded map[string]int64
+	// prefixLength: the length of the key prefix the last access is tracked by
+	prefixLength int
+	// sampleRate: the fraction of reads and writes sampled
+	sampleRate float64
+	// interval: how often the sampled times are recorded
+	interval time.Duration
+}
+
+// accessTimes tracks when each key was last read, by a hash of the key
+type accessTimes struct {
+	// lock: guards the reads
+	lock sync.Mutex
+	// seed: the seed the keys are hashed with
+	seed maphash.Seed
+	// reads: the unix milliseconds of the last read by key hash
+	reads map[uint64]int64
+}
+
+// coldStub is the location of a value in the cold file
+type coldStub struct {
+	// offset: the offset of the value in the cold file
+	offset uint64
+	// length: the length of the value in the cold file
+	length uint32
+	// checksum: the crc32 checksum of the value before it was compressed
+	checksum uint32
+	// version: the version the value was written at, before it was moved
+	version uint64
+	// timestamp: the timestamp the value was written at, before it was moved
+	timestamp uint64
+}
+
+// contention tracks the retries, aborts and conflicting keys of read-write transactions
+type contention struct {
+	// lock: guards the conflicts
+	lock sync.Mutex
+	// retries: the total retries
+	retries uint64
+	// aborts: the total aborts
+	aborts uint64
+	// conflicts: the conflicts by key or key prefix, up to ContentionMaxKeys
+	conflicts map[string]uint64
+	// prefixLength: the length of the key prefix conflicts are counted by, or 0 for the full key
+	prefixLength int
+	// warnThreshold: how long a transaction can retry before a warning is logged
+	warnThreshold time.Duration
+}
+
+// slowOps is a ring of the most recent transactions that ran past their warning thresholds, up to MaxSlowOps
+type slowOps struct {
+	// lock: guards the ring
+	lock sync.Mutex
+	// ops: the recorded transactions, which wraps around once MaxSlowOps are recorded
+	ops []*SlowOp
+	// next: the index of the ring the next transaction is recorded at
+	next int
+}
+
+// SlowOp is a transaction that ran past its warning threshold, shown by the admin UI
+type SlowOp struct {
+	// Op: ProfileOpRead for a read only transaction open past ReadTxWarnThreshold, or ProfileOpUpdate for a read-write transaction retrying on contention past ContentionWarnThreshold
+	Op string
+	// FinishedAt: when the transaction finished
+	FinishedAt time.Time
+	// Duration: how long the transaction ran
+	Duration time.Duration
+	// Version: the snapshot version of a read only transaction, which is 0 for a read-write transaction
+	Version uint64
+	// Retries: the times a read-write transaction was retried, which is 0 for a read only transaction
+	Retries int
+}
+
+// IOLimiter is a token bucket limiting the bytes per second of background I/O, so maintenance tasks can not starve transactions
+type IOLimiter struct {
+	// lock: guards the tokens and the last refill
+	lock sync.Mutex
+	// rate: the bytes per second added to the bucket, where 0 or less does not limit
+	rate int64
+	// burst: the max tokens in the bucket
+	burst int64
+	// tokens: the tokens in the bucket at the last refill, which is negative when background I/O is waiting
+	tokens int64
+	// last: the time of the last refill
+	last time.Time
+	// bytes: the total bytes of background I/O
+	bytes uint64
+	// waited: the total nanoseconds background I/O waited for tokens
+	waited int64
+}
+
+// IOLimiterStats is the usage of a background I/O limiter
+type IOLimiterStats struct {
+	// Rate: the bytes per second of background I/O allowed, where 0 is unlimited
+	Rate int64
+	// Available: the bytes of background I/O that can run without waiting, which is negative while background I/O is waiting
+	Available int64
+	// Bytes: the total bytes of background I/O since the limiter was created
+	Bytes uint64
+	// Waited: the total time background I/O waited on the limiter
+	Waited time.Duration
+}
+
+// PoolStats is the occupancy of the node pool, for tuning the pool size
+type PoolStats struct {
+	// Disabled: if the node pool is disabled
+	Disabled bool
+	// InitialSize: the number of nodes pre-allocated when the instance was opened
+	InitialSize int64
+	// MaxRetained: the max number of nodes kept in the node pool
+	MaxRetained int64
+	// Retained: the nodes in the node pool, which can overcount since the garbage collector may free pooled nodes
+	Retained int64
+	// Gets: the total nodes taken from the node pool since the instance was opened
+	Gets uint64
+	// Allocations: the total nodes allocated because the node pool was empty or disabled
+	Allocations uint64
+	// Puts: the total nodes put back into the node pool
+	Puts uint64
+	// Drops: the total nodes dropped because the node pool was full or disabled
+	Drops uint64
+}
+
+// SpaceReport is the live and dead bytes of the serialized data, for compaction decisions and capacity planning
+type SpaceReport struct {
+	// Version: the version of the root, whose reachable nodes are live
+	Version uint64
+	// FileSize: the total size of the memory mapped file, including unused pre-allocated space
+	FileSize uint64
+	// SerializedBytes: the bytes appended to the file, including the metadata
+	SerializedBytes uint64
+	// MetaBytes: the bytes of the metadata at the start of the file
+	MetaBytes uint64
+	// LiveBytes: the bytes of the nodes reachable from the root
+	LiveBytes uint64
+	// DeadBytes: the bytes of the nodes only reachable from older versions, which are reclaimed by compaction
+	DeadBytes uint64
+	// FreeBytes: the pre-allocated bytes after the serialized data
+	FreeBytes uint64
+	// LiveNodes: the internal and leaf nodes reachable from the root
+	LiveNodes uint64
+	// Fragmentation: the fraction of the serialized nodes that are dead
+	Fragmentation float64
+	// Regions: the live and dead bytes of each fixed size region of the serialized data, in offset order
+	Regions []SpaceRegion
+}
+
+// CompactionEstimate is the expected result of compacting the latest version, estimated without copying it
+type CompactionEstimate struct {
+	// Version: the version of the root that would be compacted
+	Version uint64
+	// SerializedBytes: the bytes appended to the file, including the metadata
+	SerializedBytes uint64
+	// LiveBytes: the estimated bytes of the nodes reachable from the root, which are copied to the compacted file
+	LiveBytes uint64
+	// LiveNodes: the estimated internal and leaf nodes reachable from the root
+	LiveNodes uint64
+	// ReclaimedBytes: the estimated serialized bytes that would be reclaimed by compaction
+	ReclaimedBytes uint64
+	// Duration: the estimated time to read the live nodes, which is a lower bound on the duration of compaction, since it does not include writing and syncing the compacted file
+	Duration time.Duration
+	// SampledFraction: the fraction of the subtrees below the root that were walked, where 1 means the estimate is exact
+	SampledFraction float64
+}
+
+// SpaceRegion is the live and dead bytes of a region of the serialized data
+type SpaceRegion struct {
+	// Offset: the offset of the start of the region
+	Offset uint64
+	// Length: the serialized bytes in the region, excluding the metadata
+	Length uint64
+	// LiveBytes: the bytes of live nodes in the region
+	LiveBytes uint64
+	// DeadBytes: the bytes of dead nodes in the region
+	DeadBytes uint64
+	// Fragmentation: the fraction of the region that is dead
+	Fragmentation float64
+}
+
+// PrefixCount is the total keys stored under a key prefix
+type PrefixCount struct {
+	// Prefix: the key prefix
+	Prefix []byte
+	// Count: the total keys that begin with the prefix
+	Count int
+}
+
+// Lease describes the current holder of leadership
+type Lease struct {
+	// Holder: the id of the instance holding the lease
+	Holder string
+	// Term: incremented every time leadership changes hands, so stale leaders can be detected
+	Term uint64
+	// Expires: the time the lease lapses if it is not renewed
+	Expires time.Time
+}
+
+// MetricsSink receives the stats of an instance on every metrics interval, so they can be pushed to a metrics pipeline. A sink can be shared between instances
+type MetricsSink interface {
+	// Push: send the stats of the instance, labeled with the file name of the instance
+	Push(instance string, stats *Stats) error
+}
+
+// StatsDSink pushes stats to a StatsD server over UDP, with tags in the DogStatsD format
+type StatsDSink struct {
+	// conn: the UDP connection to the server
+	conn net.Conn
+	// prefix: prepended to the name of every metric
+	prefix string
+	// tags: added to every metric, along with the instance
+	tags []string
+	// lock: guards the totals
+	lock sync.Mutex
+	// totals: the last pushed value of each counter by instance and name, so only the increase is sent
+	totals map[string]uint64
+}
+
+// LeaseStore persists the leader lease, which can be a designated key or an external coordination service
+type LeaseStore interface {
+	// Load: get the current lease, or nil if no lease has been written
+	Load(ctx context.Context) (*Lease, error)
+	// CompareAndSwap: replace the current lease with next only if the current lease is equal to prev, returning false otherwise
+	CompareAndSwap(ctx context.Context, prev, next *Lease) (bool, error)
+}
+
+// FailoverOpts contains options for the leader lease coordinator
+type FailoverOpts struct {
+	// ID: the unique id of this instance, written as the lease holder
+	ID string
+	// Store: where the lease is persisted
+	Store LeaseStore
+	// LeaseDuration: how long a lease is held before it lapses without renewal. Defaults to DefaultLeaseDuration
+	LeaseDuration time.Duration
+	// RenewInterval: how often the lease is renewed or checked for expiration. Defaults to a third of the lease duration
+	RenewInterval time.Duration
+	// OnPromote: optional hook called with the new term when this instance becomes the leader
+	OnPromote func(term uint64)
+	// OnDemote: optional hook called when this instance loses the lease
+	OnDemote func()
+}
+
+// Failover coordinates leadership for an instance using a lease, promoting the instance when the lease lapses
+type Failover struct {
+	// store: the mari instance to promote and demote
+	store *Mari
+	// opts: the resolved failover options
+	opts FailoverOpts
+	// lock: guards the last observed lease, which is read by Term while the coordinator go routine ticks
+	lock sync.Mutex
+	// lease: the last lease observed by this coordinator
+	lease *Lease
+	// started: set to 1 by the first call to Start, so the coordinator go routine is only run once and Stop only waits on it once it was started
+	started uint32
+	// stopChan: closed to stop the coordinator
+	stopChan chan struct{}
+	// doneChan: closed when the coordinator go routine exits
+	doneChan chan struct{}
+}
+
+// KeyLeaseStore stores the leader lease in a designated key of a mari instance
+type KeyLeaseStore struct {
+	// store: the mari instance containing the lease key
+	store *Mari
+	// key: the designated lease key
+	key []byte
+}
+
+// Changeset contains the key-value pairs written to an instance after a version, exchanged between instances when syncing
+type Changeset struct {
+	// FromVersion: the changes contain key-value pairs written after this version
+	FromVersion uint64
+	// ToVersion: the version of the snapshot the changes were read from
+	ToVersion uint64
+	// Timestamp: the commit timestamp of the snapshot the changes were read from, merged into the clock of the instance applying the changes
+	Timestamp uint64
+	// Changes: the changed key-value pairs, in ascending order by key
+	Changes []*KeyValuePair
+}
+
+// ConflictResolver is the function signature for resolving a key written on both instances since the last sync.
+// The returned key-value pair is kept on the local instance, and returning nil deletes the key
+type ConflictResolver = func(local, remote *KeyValuePair) (*KeyValuePair, error)
+
+// SyncOpts contains options for applying changesets from another instance
+type SyncOpts struct {
+	// Resolver: the conflict resolver. Defaults to DefaultConflictResolver
+	Resolver *ConflictResolver
+	// BatchSize: the number of changes applied per read-write transaction. Defaults to DefaultSyncBatchSize
+	BatchSize *int
+}
+
+// SyncState contains the versions of two instances at the end of their last sync
+type SyncState struct {
+	// LocalVersion: the version of the local instance that was last synced
+	LocalVersion uint64
+	// RemoteVersion: the version of the remote instance that was last synced
+	RemoteVersion uint64
+}
+
+// SyncResult contains the outcome of applying a changeset
+type SyncResult struct {
+	// Applied: the total number of key-value pairs written
+	Applied int
+	// Conflicts: the total number of keys written on both instances with different values, passed to the resolver
+	Conflicts int
+	// Skipped: the total number of changes that already matched the local instance
+	Skipped int
+}
+
+// IsolationLevel is the isolation of read-write transactions from transactions that commit while they run
+type IsolationLevel int
+
+// EmptyValuePolicy is how nil and empty values are handled on write
+type EmptyValuePolicy int
+
+// Storage reads and writes the serialized data of an instance. The memory map is the storage of every instance, and middleware wraps it
+type Storage interface {
+	// Read: get a view of a region of the serialized data, which is only valid while the transaction is open and must not be modified
+	Read(offset, length uint64) ([]byte, error)
+	// Write: copy serialized path copies, nodes, or metadata into a region
+	Write(data []byte, offset uint64) error
+	// Flush: write a region back to disk and wait for it, which is called for the regions written outside of commits with FlushStrategySync, for the dirty regions written back synchronously, and with FlushBackendIOURing for the sync after commits
+	Flush(offset, length uint64) error
+}
+
+// StorageMiddleware wraps a Storage, delegating to it to layer behavior around it
+type StorageMiddleware = func(next Storage) Storage
+
+// StorageOp is an operation on a Storage, passed to a fault injector
+type StorageOp int
+
+// StorageMetrics records the operations on a Storage wrapped with MetricsStorage
+type StorageMetrics struct {
+	// reads: the total regions read
+	reads uint64
+	// readBytes: the total bytes read
+	readBytes uint64
+	// writes: the total regions written
+	writes uint64
+	// writeBytes: the total bytes written
+	writeBytes uint64
+	// flushes: the total regions flushed
+	flushes uint64
+	// errors: the total operations that returned an error
+	errors uint64
+	// readNanos: the total time spent reading
+	readNanos uint64
+	// writeNanos: the total time spent writing
+	writeNanos uint64
+	// flushNanos: the total time spent flushing
+	flushNanos uint64
+}
+
+// StorageStats is a snapshot of the operations recorded by StorageMetrics
+type StorageStats struct {
+	// Reads: the total regions read
+	Reads uint64
+	// ReadBytes: the total bytes read
+	ReadBytes uint64
+	// Writes: the total regions written
+	Writes uint64
+	// WriteBytes: the total bytes written
+	WriteBytes uint64
+	// Flushes: the total regions flushed
+	Flushes uint64
+	// Errors: the total operations that returned an error
+	Errors uint64
+	// ReadTime: the total time spent reading
+	ReadTime time.Duration
+	// WriteTime: the total time spent writing
+	WriteTime time.Duration
+	// FlushTime: the total time spent flushing
+	FlushTime time.Duration
+}
+
+// mmapStorage is the storage of an instance on its memory map
+type mmapStorage struct {
+	// store: the instance whose memory map is read and written, loaded on every operation since it is remapped on resize and compaction
+	store *Mari
+}
+
+// latencyStorage delays each operation before delegating it
+type latencyStorage struct {
+	// next: the wrapped storage
+	next Storage
+	// read: the delay before each read
+	read time.Duration
+	// write: the delay before each write
+	write time.Duration
+	// flush: the delay before each flush
+	flush time.Duration
+}
+
+// faultStorage returns the error of an injector instead of delegating an operation
+type faultStorage struct {
+	// next: the wrapped storage
+	next Storage
+	// inject: returns the error to fail an operation with, or nil to delegate it
+	inject func(op StorageOp, offset, length uint64) error
+}
+
+// metricsStorage records each operation delegated to the wrapped storage
+type metricsStorage struct {
+	// next: the wrapped storage
+	next Storage
+	// metrics: the recorded operations
+	metrics *StorageMetrics
+}
+
+// readOnlyStorage rejects writes with ErrReadOnlyStorage
+type readOnlyStorage struct {
+	// next: the wrapped storage
+	next Storage
+}
+
+// KeyNormalizer normalizes keys on write and lookup, so keys that normalize to the same bytes address the same key-value pair
+type KeyNormalizer interface {
+	// ID: a stable, non-zero id persisted in the file, so files written with different normalizers are never mixed. Ids below KeyNormalizerCustomID are reserved for the normalizers in Mari
+	ID() uint64
+	// Normalize: return the normalized key, without modifying the key passed in
+	Normalize(key []byte) []byte
+}
+
+// LowerASCIINormalizer normalizes keys by lowercasing ASCII letters, for a case-insensitive keyspace
+type LowerASCIINormalizer struct{}
+
+// OpenValidation is how much of an existing file is checked for corruption when it is opened
+type OpenValidation int
+
+// State is the lifecycle state of an instance
+type State uint32
+
+// StateError is returned by operations invoked while the instance is closing or closed
+type StateError struct {
+	// Op: the operation invoked
+	Op string
+	// State: the state of the instance when the operation was invoked
+	State State
+}
+
+// FlushStrategy is how writes to the memory map are flushed to disk
+type FlushStrategy int
+
+// FlushBackend is how regions of the memory map are flushed to disk
+type FlushBackend int
+
+// iouringStorage flushes regions through an io_uring, batching the regions of concurrent flushes into one submission, and delegates reads and writes
+type iouringStorage struct {
+	// next: the memory mapped storage
+	next Storage
+	// store: the instance whose file is synced, loaded on every batch since it is swapped on compaction
+	store *Mari
+	// ring: the io_uring batches are submitted to, which only the flush submitting batches uses
+	ring *ioURing
+	// lock: guards the pending batch and whether batches are being submitted
+	lock sync.Mutex
+	// pending: the batch flushes add their regions to while another batch is submitted
+	pending *flushBatch
+	// submitting: whether a flush is submitting batches, so later flushes add their regions to the pending batch and wait for it
+	submitting bool
+}
+
+// flushBatch is the regions of concurrent flushes, submitted together
+type flushBatch struct {
+	// ranges: the regions to flush
+	ranges []syncRange
+	// done: closed once the batch is synced
+	done chan struct{}
+	// err: the error syncing the batch, set before done is closed
+	err error
+}
+
+// syncRange is a region of a file to sync
+type syncRange struct {
+	// offset: the offset of the first byte
+	offset uint64
+	// length: the length of the region
+	length uint64
+}
+
+// ioURing is an io_uring with its submission queue, completion queue and submission entries mapped into memory, used by one goroutine at a time
+type ioURing struct {
+	// fd: the file descriptor of the io_uring, or -1 once closed
+	fd int
+	// entries: the size of the submission queue
+	entries uint32
+	// sqRing: the mapped submission queue ring
+	sqRing []byte
+	// cqRing: the mapped completion queue ring
+	cqRing []byte
+	// sqes: the mapped submission queue entries
+	sqes []byte
+	// sqHead: the offset of the head in the submission queue ring, advanced by the kernel
+	sqHead uint32
+	// sqTail: the offset of the tail in the submission queue ring, advanced on submit
+	sqTail uint32
+	// sqMask: the offset of the index mask in the submission queue ring
+	sqMask uint32
+	// sqArray: the offset of the array of submission entry indexes in the submission queue ring
+	sqArray uint32
+	// cqHead: the offset of the head in the completion queue ring, advanced as completions are reaped
+	cqHead uint32
+	// cqTail: the offset of the tail in the completion queue ring, advanced by the kernel
+	cqTail uint32
+	// cqMask: the offset of the index mask in the completion queue ring
+	cqMask uint32
+	// cqes: the offset of the completion entries in the completion queue ring
+	cqes uint32
+}
+
+// dirtyRegion is the region of the memory map written since writeback was last started
+type dirtyRegion struct {
+	// lock: guards the region
+	lock sync.Mutex
+	// start: the offset of the first dirty byte
+	start uint64
+	// end: the offset after the last dirty byte, which is 0 if no bytes are dirty
+	end uint64
+	// meta: a flag to determine if the metadata is dirty, which is tracked apart from the region so the pages between are not written back
+	meta bool
+	// bytes: the total bytes marked dirty, which can be less than the region if writes are not contiguous
+	bytes uint64
+}
+
+// commitSyncs tracks the commits synced to disk by the flush go routine, by commit sequence
+type commitSyncs struct {
+	// lock: guards the synced and failed sequences
+	lock sync.Mutex
+	// cond: broadcast when a sync completes
+	cond *sync.Cond
+	// synced: the latest commit sequence synced to disk
+	synced uint64
+	// failed: the latest commit sequence where the sync failed
+	failed uint64
+	// err: the error of the failed sync
+	err error
+}
+
+// adaptiveSync is the window of recent sync latencies, used by FlushStrategyAdaptive to switch between per-commit and grouped syncs
+type adaptiveSync struct {
+	// lock: guards the samples
+	lock sync.Mutex
+	// target: the p99 sync latency above which commits are grouped
+	target time.Duration
+	// samples: the most recent sync latencies, up to AdaptiveSyncWindow
+	samples []time.Duration
+	// next: the index in the samples overwritten by the next latency once the window is full
+	next int
+	// grouped: atomic flag to determine if commits are grouped and synced by the dirty pages go routine
+	grouped uint32
 }
 
 // MariaCompactionStrategy is the function signature for custom compaction trigger
@@ -133,13 +2095,41 @@ type CompactionTrigger = func(metaData *MetaData) bool
 type Compaction struct {
 	// tempFile: the temporary file for compacting the db
 	tempFile *os.File
+	// anonymous: whether the temporary file was created without a name, in which case it replaces the file without a rename
+	anonymous bool
+	// disableFlush: whether syncs of the temporary file to disk are skipped
+	disableFlush bool
 	// tempData: the temporary memory mapped file as byte slice
 	tempData atomic.Value
 	// compactedVersion: the version to compact at
 	compactedVersion uint64
+	// direct: the writer for the temporary file when it is opened with direct I/O, in which case the file is not memory mapped
+	direct *directWriter
 }
 
-// MariOpTransform is the function signature for transform functions, which modify results
+// directWriter appends to a file opened with direct I/O through a buffer aligned to DirectIOAlignment
+type directWriter struct {
+	// file: the file opened with direct I/O
+	file *os.File
+	// buffer: the aligned buffer of bytes not yet written
+	buffer []byte
+	// buffered: the total bytes in the buffer
+	buffered int
+	// offset: the offset in the file of the start of the buffer
+	offset uint64
+	// head: an aligned copy of the first block of the file, so the metadata can be written once the file is complete
+	head []byte
+}
+
+// subtreeSize is the serialized size and key count of a subtree, measured before it is written with direct I/O
+type subtreeSize struct {
+	// size: the total bytes of the serialized nodes in the subtree
+	size uint64
+	// count: the total keys in the subtree
+	count uint64
+}
+
+// MariOpTransform is the function signature for transform functions, which modify results. Returning nil drops the key-value pair from the results
 type Transform = func(kvPair *KeyValuePair) *KeyValuePair
 
 // MariRangeOpts contains options for iteration and range functions
@@ -148,14 +2138,461 @@ type RangeOpts struct {
 	MinVersion *uint64
 	// Transform: the transform function
 	Transform *Transform
+	// MaxVersions: for range, the max retained versions to return per key, newest first. Only the latest version is returned if nil
+	MaxVersions *int
+	// SharedBuffers: optionally pass true to copy the keys, values, and key-value pairs of the scan into blocks shared by the results as they are collected, so they can be held after the transaction
+	SharedBuffers *bool
+	// IncludeReserved: optionally pass true to include keys under ReservedKeyPrefix in the results of the scan. By default they are excluded
+	IncludeReserved *bool
+	// IncludeTombstones: for range, optionally pass true to include the tombstones of deleted keys in the results, in key order, with Deleted set. Transforms are not applied to tombstones. By default they are excluded
+	IncludeTombstones *bool
+	// ChunkSize: the max results collected per chunk of the scan, which descends from the root once per chunk. Defaults to DefaultScanChunkSize
+	ChunkSize *int
+	// Context: optionally pass a context checked between the chunks of the scan, so a long scan returns the error of the context once it is canceled or past its deadline
+	Context context.Context
 }
 
 // DefaultPageSize is the default page size set by the underlying OS. Usually will be 4KiB
 var DefaultPageSize = os.Getpagesize()
 
+// ReservedKeyPrefix is the prefix for keys used internally by Mari to persist state, like prepared transactions and the ttl index. Keys under the prefix can not be written by users
+var ReservedKeyPrefix = []byte("\x00mari\x00")
+
+// systemKeyPrefix is the reserved bucket for state persisted by packages built on Mari, like applied migrations, divided into named buckets
+var systemKeyPrefix = append(append([]byte{}, ReservedKeyPrefix...), []byte("system\x00")...)
+
+// reservedKeyEnd is the smallest key after every key under ReservedKeyPrefix, since reserved keys are sorted together
+var reservedKeyEnd = bucketEndKey(ReservedKeyPrefix)
+
+// preparedKeyPrefix is the reserved bucket where prepared transaction intents are persisted
+var preparedKeyPrefix = append(append([]byte{}, ReservedKeyPrefix...), []byte("prepared\x00")...)
+
+// ttlKeyPrefix is the reserved bucket indexing keys written with a ttl by expiration time, so due keys can be found with a bounded range
+var ttlKeyPrefix = append(append([]byte{}, ReservedKeyPrefix...), []byte("ttl\x00")...)
+
+// fencingTokenKey is the reserved key holding the highest fencing token seen by the instance
+var fencingTokenKey = append(append([]byte{}, ReservedKeyPrefix...), []byte("fence\x00")...)
+
+// replicatedKey is the key in ReplicationBucket holding the leader version and timestamp of the last delta applied to a replica
+var replicatedKey = []byte("applied")
+
+// snapshotProgressKey is the key in ReplicationBucket holding the leader version and timestamp of a snapshot being applied to a replica, followed by the last key applied
+var snapshotProgressKey = []byte("snapshot")
+
+// tombstoneKeyPrefix is the reserved bucket holding a tombstone for each deleted key with Tombstones, written at the version of the delete
+var tombstoneKeyPrefix = append(append([]byte{}, ReservedKeyPrefix...), []byte("tombstone\x00")...)
+
+// expiresKeyPrefix is the reserved bucket mapping keys written with a ttl to their expiration time, so the ttl index entry can be found on overwrite
+var expiresKeyPrefix = append(append([]byte{}, ReservedKeyPrefix...), []byte("expires\x00")...)
+
+// DefaultFileMode is the default permissions of files created by Mari
+const DefaultFileMode = os.FileMode(0600)
+
 // DefaultNodePoolSize is the max number of nodes in the node pool, and the pre-allocated node pool size
 const DefaultNodePoolSize = int64(1000000)
 
+// DefaultSyncBatchSize is the default number of changes applied per transaction when syncing
+const DefaultSyncBatchSize = 1000
+
+// DefaultExpirationInterval is the default interval between expiration sweeps
+const DefaultExpirationInterval = time.Second
+
+// DefaultExpireBatchSize is the default number of expired keys deleted per transaction when sweeping
+const DefaultExpireBatchSize = 1000
+
+// DefaultIteratorBatchSize is the number of key-value pairs an iterator reads from its snapshot at a time
+const DefaultIteratorBatchSize = 100
+
+// DefaultScanChunkSize is the default max results collected per chunk of Iterate and Range
+const DefaultScanChunkSize = 4096
+
+// InitialScanChunkSize is the results collected by the first chunk of Iterate and Range, which doubles for each chunk after up to the chunk size
+const InitialScanChunkSize = 64
+
+// ScanArenaBlockSize is the size in bytes of each block the keys and values of a scan with SharedBuffers are copied into. A longer value is copied into a block of its own
+const ScanArenaBlockSize = 64 << 10
+
+// ScanArenaPairBlockSize is the number of key-value pairs in each block the results of a scan with SharedBuffers are allocated from
+const ScanArenaPairBlockSize = 256
+
+// scanArena holds the blocks the results of a scan with SharedBuffers are allocated from as the scan collects them, so the results outlive the transaction without an allocation per key-value pair
+type scanArena struct {
+	// pairs: the unused key-value pairs of the current block
+	pairs []KeyValuePair
+	// keys: the current block of keys, which ends with the last key copied
+	keys []byte
+	// lastKey: the last key copied, which a key it is a prefix of extends in place
+	lastKey []byte
+	// values: the current block of values
+	values []byte
+}
+
+// DefaultIteratorMaxAge is the default age after which an open iterator is reported as leaked
+const DefaultIteratorMaxAge = time.Minute
+
+// ProfileLabelInstance is the pprof label key for the file name of the instance
+const ProfileLabelInstance = "mari.instance"
+
+// ProfileLabelSubsystem is the pprof label key for the subsystem running on a go routine
+const ProfileLabelSubsystem = "mari.subsystem"
+
+// ProfileLabelOp is the pprof label key for the type of a transaction
+const ProfileLabelOp = "mari.op"
+
+// Subsystems labeled in profiles
+const (
+	// ProfileSubsystemCompaction: the compaction worker
+	ProfileSubsystemCompaction = "compaction"
+	// ProfileSubsystemFlush: the worker flushing the memory map to disk
+	ProfileSubsystemFlush = "flush"
+	// ProfileSubsystemResize: the worker resizing the memory map
+	ProfileSubsystemResize = "resize"
+	// ProfileSubsystemExpiration: the worker sweeping keys written with a ttl
+	ProfileSubsystemExpiration = "expiration"
+	// ProfileSubsystemIteratorLeaks: the worker reporting iterators left open
+	ProfileSubsystemIteratorLeaks = "iterator-leaks"
+	// ProfileSubsystemReadGuard: the worker reporting read only transactions open past the warning threshold
+	ProfileSubsystemReadGuard = "read-guard"
+	// ProfileSubsystemResidency: the worker sampling the pages resident in memory
+	ProfileSubsystemResidency = "residency"
+	// ProfileSubsystemMetrics: the worker pushing stats to the metrics sink
+	ProfileSubsystemMetrics = "metrics"
+	// ProfileSubsystemWarm: the worker prefetching the hot set manifest once the instance is opened
+	ProfileSubsystemWarm = "warm"
+	// ProfileSubsystemFailover: the failover coordinator renewing and acquiring the leader lease
+	ProfileSubsystemFailover = "failover"
+	// ProfileSubsystemRepair: the worker rewriting values repaired from a repair source
+	ProfileSubsystemRepair = "repair"
+	// ProfileSubsystemTiering: the worker moving cold values to the cold file
+	ProfileSubsystemTiering = "tiering"
+	// ProfileSubsystemAccess: the worker recording the sampled last access times
+	ProfileSubsystemAccess = "access"
+	// ProfileSubsystemTransaction: read and read-write transactions, when transaction labels are enabled
+	ProfileSubsystemTransaction = "transaction"
+)
+
+// Transaction types labeled in profiles
+const (
+	// ProfileOpRead: a read only transaction
+	ProfileOpRead = "read"
+	// ProfileOpUpdate: a read-write transaction, including retries and serializing the path copy
+	ProfileOpUpdate = "update"
+)
+
+// Validation modes when opening an existing file
+const (
+	// OpenValidationFast: trust the metadata, only checking the format version
+	OpenValidationFast OpenValidation = iota
+	// OpenValidationRoot: check the metadata offsets, then read the root of the latest version and each of its children
+	OpenValidationRoot
+	// OpenValidationFull: run Verify on the latest version, reading every reachable node
+	OpenValidationFull
+)
+
+// Isolation levels for read-write transactions
+const (
+	// IsolationSnapshot: reads observe the snapshot the transaction started from, and the transaction conflicts only if another transaction wrote a key it writes
+	IsolationSnapshot IsolationLevel = iota
+	// IsolationSerializable: as IsolationSnapshot, but the transaction also conflicts if another transaction wrote a key it read or changed the results of a scan it performed
+	IsolationSerializable
+)
+
+// Lifecycle states of an instance
+const (
+	// StateOpening: the file is being mapped, validated and recovered by Open
+	StateOpening State = iota
+	// StateRunning: the instance is open and accepting operations
+	StateRunning
+	// StateCompacting: the instance is open and the file is being compacted, operations wait until compaction completes
+	StateCompacting
+	// StateClosing: Close is waiting for active transactions and background workers, and new operations return a StateError
+	StateClosing
+	// StateClosed: the file is unmapped and closed, and operations return a StateError
+	StateClosed
+)
+
+// Policies for nil and empty values
+const (
+	// EmptyValuesStore: nil and empty values are stored as empty values, and read back as empty, non-nil values
+	EmptyValuesStore EmptyValuePolicy = iota
+	// EmptyValuesReject: nil and empty values are rejected with ErrEmptyValue
+	EmptyValuesReject
+)
+
+// Flush strategies for writes to the memory map
+const (
+	// FlushStrategySync: flush regions with a synchronous msync, and sync the file with fsync after commits
+	FlushStrategySync FlushStrategy = iota
+	// FlushStrategyBatch: mark written pages dirty, start their writeback with a periodic asynchronous msync, and sync the file with a single fdatasync after commits
+	FlushStrategyBatch
+	// FlushStrategyBackground: mark written pages dirty, and write them back with a synchronous msync when the interval elapses or the dirty bytes exceed the threshold, without syncing the file after each commit
+	FlushStrategyBackground
+	// FlushStrategyAdaptive: sync each commit as with FlushStrategySync, switching to grouped syncs as with FlushStrategyBackground while the p99 sync latency exceeds the target commit latency
+	FlushStrategyAdaptive
+)
+
+// Flush backends for regions of the memory map
+const (
+	// FlushBackendMsync: flush each region with a synchronous msync
+	FlushBackendMsync FlushBackend = iota
+	// FlushBackendIOURing: on linux, submit the regions of concurrent flushes to an io_uring as a batch of sync_file_range operations followed by a single fdatasync, in one system call
+	FlushBackendIOURing
+)
+
+// IOURingEntries is the size of the submission queue with FlushBackendIOURing. A batch with more regions than fit is flushed as the single region spanning them
+const IOURingEntries = 64
+
+const (
+	// StorageOpRead: a read of a region
+	StorageOpRead StorageOp = iota
+	// StorageOpWrite: a write of a region
+	StorageOpWrite
+	// StorageOpFlush: a flush of a region
+	StorageOpFlush
+)
+
+// DefaultTargetCommitLatency is the default p99 sync latency above which commits are grouped with FlushStrategyAdaptive
+const DefaultTargetCommitLatency = 10 * time.Millisecond
+
+// AdaptiveSyncWindow is the number of recent sync latencies used to compute the p99 latency with FlushStrategyAdaptive
+const AdaptiveSyncWindow = 128
+
+// AdaptiveSyncMinSamples is the number of sync latencies recorded before FlushStrategyAdaptive switches modes
+const AdaptiveSyncMinSamples = 16
+
+// DefaultFlushInterval is the default interval between writing back the dirty pages with FlushStrategyBatch or FlushStrategyBackground
+const DefaultFlushInterval = 100 * time.Millisecond
+
+// DefaultFlushDirtyBytes is the default dirty bytes after which the dirty pages are written back before the interval elapses
+const DefaultFlushDirtyBytes = 16 * 1024 * 1024
+
+// DefaultContentionWarnThreshold is the default duration a read-write transaction can spend retrying before a warning is logged
+const DefaultContentionWarnThreshold = 10 * time.Second
+
+// ContentionMaxKeys is the max keys conflicts are counted for, so the contention table is bounded. Conflicts on new keys are dropped once it is full
+const ContentionMaxKeys = 4096
+
+// PoolAuditStackDepth is the max frames captured for each node taken from or put back into the node pool with PoolDebug
+const PoolAuditStackDepth = 32
+
+// PoolAuditMaxReturned is the max nodes put back into the node pool tracked with PoolDebug, after which double returns are only detected for the nodes tracked
+const PoolAuditMaxReturned = 1 << 20
+
+const (
+	// PoolNodeInternal is the kind of a tracked internal node
+	PoolNodeInternal = "internal"
+	// PoolNodeLeaf is the kind of a tracked leaf node
+	PoolNodeLeaf = "leaf"
+)
+
+// HotSetMaxPrefixes is the max key prefixes reads are counted for, so the hot set table is bounded. Reads of new prefixes are dropped once it is full
+const HotSetMaxPrefixes = 4096
+
+// HotSetBucket is the bucket of the system keyspace where the hot set manifest is recorded, keyed by prefix with the big endian reads as the value
+const HotSetBucket = "hotset"
+
+// TieringBucket is the bucket of the system keyspace where the id of the instance file that starts every cold stub is recorded
+const TieringBucket = "tiering"
+
+// ColdFileExt is the extension of the cold file, which is named after the instance file
+const ColdFileExt = ".cold"
+
+// ColdIDSize is the size of the random id that starts every cold stub
+const ColdIDSize = 16
+
+// ColdStubSize is the size of the stub a cold value is replaced with: the id, offset, length, checksum, and the version and timestamp the value was written at
+const ColdStubSize = ColdIDSize + 8 + 4 + 4 + 8 + 8
+
+// DefaultColdMinValueSize is the default smallest value moved to the cold file
+const DefaultColdMinValueSize = 256
+
+// DefaultTieringInterval is the default interval values past ColdAfter are moved to the cold file on
+const DefaultTieringInterval = time.Minute
+
+// TieringBatchSize is the max key-value pairs scanned per read only transaction, and moved per read-write transaction, by a tiering pass
+const TieringBatchSize = 1024
+
+// AccessBucket is the bucket of the system keyspace where the last access times are recorded, keyed by prefix with the big endian unix seconds as the value
+const AccessBucket = "access"
+
+// AccessMaxPrefixes is the max key prefixes sampled since the instance was opened, so the table is bounded. Accesses of new prefixes are dropped once it is full
+const AccessMaxPrefixes = 4096
+
+// DefaultAccessSampleRate is the default fraction of reads and writes that record the last access of their prefix
+const DefaultAccessSampleRate = 0.1
+
+// DefaultAccessRecordInterval is the default interval the sampled last access times are recorded in the system keyspace
+const DefaultAccessRecordInterval = time.Minute
+
+// TieringAnnotation is the annotation set on the commit of a tiering pass, with the values moved as the value
+const TieringAnnotation = "mari.tiering"
+
+// Kinds of values in the cold file, which is the first byte of each value
+const (
+	// coldValueRaw: the value is stored as is, since it did not compress
+	coldValueRaw byte = iota
+	// coldValueFlate: the value is compressed with flate
+	coldValueFlate
+)
+
+// ContentionHotKeys is the number of keys with the most conflicts returned in the stats and logged on contention
+const ContentionHotKeys = 10
+
+// ReadPinShards is the number of shards the snapshot versions of open read only transactions are tracked in
+const ReadPinShards = 32
+
+// ReadTxStackDepth is the most frames captured for the stack of a read only transaction, reported once it is open past the warning threshold
+const ReadTxStackDepth = 32
+
+// DefaultReadAtLeastTimeout is the default duration ReadTxAtLeast waits for the instance to reach a version
+const DefaultReadAtLeastTimeout = 5 * time.Second
+
+// ReadAtLeastPollInterval is how often ReadTxAtLeast checks the version in the metadata, for followers reading a file committed to by another process
+const ReadAtLeastPollInterval = 10 * time.Millisecond
+
+// DefaultMetricsInterval is the default duration between pushes of the stats to the metrics sink
+const DefaultMetricsInterval = 10 * time.Second
+
+// StatsDMaxPacketSize is the max bytes of metrics sent in a single UDP packet, which fits in the MTU of most networks
+const StatsDMaxPacketSize = 1432
+
+// DefaultSpaceRegionSize is the size of each region of the serialized data in a space report
+const DefaultSpaceRegionSize = uint64(4 * 1024 * 1024)
+
+// ChangefeedBucket is the bucket of the system keyspace where the durable cursors of changefeeds are recorded
+const ChangefeedBucket = "changefeed"
+
+// CheckpointBucket is the bucket of the system keyspace where named checkpoints are recorded, keyed by name with the version and its timestamp as the value
+const CheckpointBucket = "checkpoint"
+
+// MaxCheckpoints is the max named checkpoints retained, after which the oldest checkpoint is dropped when a new name is tagged
+const MaxCheckpoints = 1024
+
+// ReplicationBucket is the bucket of the system keyspace where a replica records the version and timestamp of the last delta it applied
+const ReplicationBucket = "replication"
+
+// DefaultReplicationRetryInterval is the default wait before a delta is shipped again after the sink fails to ack it
+const DefaultReplicationRetryInterval = time.Second
+
+// DefaultReplicationDialTimeout is the default wait for a TCPSink to connect to a replica
+const DefaultReplicationDialTimeout = 5 * time.Second
+
+// MaxReplicationFrameSize is the max size of a frame accepted by ServeReplication, or of a reply accepted by a TCPSink
+const MaxReplicationFrameSize = 1 << 30
+
+// MaxSlowOps is the max slow transactions retained for the admin UI, after which the oldest is dropped
+const MaxSlowOps = 64
+
+// AdminVersions is the max retained versions listed by the admin UI, newest first
+const AdminVersions = 50
+
+// AdminTopPrefixes is the max key prefixes listed by the admin UI, most keys first
+const AdminTopPrefixes = 20
+
+// AdminPrefixDepth is the default length of the key prefixes listed by the admin UI, which can be changed with the depth query parameter
+const AdminPrefixDepth = 1
+
+// AdminMaxPrefixDepth is the longest key prefixes the admin UI lists, since every page load walks the trie to the depth of the prefixes
+const AdminMaxPrefixDepth = 8
+
+// AdminReadHeaderTimeout is how long ServeAdmin waits for the headers of a request
+const AdminReadHeaderTimeout = 5 * time.Second
+
+// AdminMaxValueSize is the max bytes of a value shown by a key lookup in the admin UI, after which the value is truncated
+const AdminMaxValueSize = 4096
+
+// MemoryShrinkTarget is the fraction of the soft memory limit the caches are shrunk to once usage is over the limit, so the caches are not shrunk again on the next read
+const MemoryShrinkTarget = 0.75
+
+// cacheEntryOverhead is the estimated bytes held by an entry of the value cache beyond its key and value, for its list element, map entry, and key-value pair
+const cacheEntryOverhead = 160
+
+// DefaultSnapshotChunkSize is the default max key-value pairs in each chunk of a snapshot sent to a CatchUpSink
+const DefaultSnapshotChunkSize = 1024
+
+// Kinds of frames sent to ServeReplication, which are replied to with a frame of the same kind
+const (
+	// replicationFrameDelta: a serialized delta, replied to with its timestamp once applied
+	replicationFrameDelta byte = iota + 1
+	// replicationFrameSnapshot: a serialized snapshot chunk, replied to with its checksum once applied
+	replicationFrameSnapshot
+	// replicationFramePosition: a request for the position of the replica, replied to with the serialized position
+	replicationFramePosition
+	// replicationFrameFetch: a key to fetch for a repair, replied to with the key-value pair serialized as a write set, or nothing if the key does not exist
+	replicationFrameFetch
+	// replicationFrameRead: a key to read for a quorum read, replied to with the serialized replica read
+	replicationFrameRead
+)
+
+// RepairTimeout is how long a corrupt value is fetched from each repair source before trying the next
+const RepairTimeout = 5 * time.Second
+
+// MaxPendingRepairs is the max repaired values queued to be rewritten in the local file, after which a repaired value is still served but not rewritten until it is read again
+const MaxPendingRepairs = 64
+
+// DefaultQuorumReadTimeout is the default wait for a quorum of the replicas to reply to a quorum read
+const DefaultQuorumReadTimeout = 5 * time.Second
+
+// ReplicationFileExt is the extension of the delta files written by a DirectorySink
+const ReplicationFileExt = ".delta"
+
+// RollbackAnnotation is the annotation set on the commit of a rollback, with the version rolled back to as the value
+const RollbackAnnotation = "mari.rollback"
+
+// OutboxBucket is the bucket of the system keyspace where outbox entries are recorded until they are acked, keyed by the big endian id
+const OutboxBucket = "outbox"
+
+// SnapshotLoadBatchSize is the max key-value pairs copied per version of a clone loaded with LoadSnapshotIntoMemory
+const SnapshotLoadBatchSize = 10000
+
+// CloneBufferSize is the size of the buffer used by CloneTo to stream a file when the kernel can not copy it
+const CloneBufferSize = 1 << 20
+
+// CompactionEstimateSubtrees is the max subtrees below the root walked to estimate compaction, which are chosen at random and scaled by their subtree counts
+const CompactionEstimateSubtrees = 16
+
+// DefaultSampleAttempts is the number of random descents attempted per key requested when sampling
+const DefaultSampleAttempts = 4
+
+// DefaultLeaseDuration is the default duration of a leader lease
+const DefaultLeaseDuration = 10 * time.Second
+
+// FormatVersionLegacy is the serialized file format of the first release, with 24 bytes of metadata and no format version or leaf timestamps. The root written at offset 24 always has version 0, so it reads as format version 0
+const FormatVersionLegacy = uint64(0)
+
+// FormatVersionBase is the serialized file format where internal nodes are written without subtree counts
+const FormatVersionBase = uint64(1)
+
+// FormatVersionSubtreeCounts is the serialized file format where every internal node is written with its subtree count
+const FormatVersionSubtreeCounts = uint64(2)
+
+// FormatVersionValueChecksums is the serialized file format where every internal node is written with its subtree count, and every leaf node with a checksum of its value
+const FormatVersionValueChecksums = uint64(3)
+
+// CurrentFormatVersion is the latest version of the serialized file format supported by this release
+const CurrentFormatVersion = FormatVersionValueChecksums
+
+// HLCLogicalBits is the number of low bits of a hybrid logical clock timestamp used for the logical counter
+const HLCLogicalBits = 16
+
+// KeyNormalizerLowerASCII is the id of LowerASCIINormalizer
+const KeyNormalizerLowerASCII = uint64(1)
+
+// KeyNormalizerCustomID is the smallest id for key normalizers defined outside of Mari
+const KeyNormalizerCustomID = uint64(1 << 16)
+
+// MaxKeySize is the max length of a key in bytes, since the key length of a leaf node is serialized in a single byte
+const MaxKeySize = 255
+
+// MaxTombstoneKeySize is the max length of a key in bytes with Tombstones, since the tombstone of a key is stored under the 16 byte tombstone bucket prefix
+const MaxTombstoneKeySize = MaxKeySize - 16
+
+// MaxTTLKeySize is the max length of a key in bytes written with a ttl, since the ttl index stores the key after the 10 byte ttl bucket prefix and the 8 byte expiration time
+const MaxTTLKeySize = MaxKeySize - 18
+
+// MaxValueSize is the max length of a value in bytes, since the end offset of a leaf node is serialized in two bytes, which must fit the longest key and the checksum of the value
+const MaxValueSize = 1<<16 - NodeKeyIdx - MaxKeySize - NodeChecksumSize
+
 // MaxCompactVersion is the maximum default version to increment to before the compaction process
 const MaxCompactVersion = uint64(1000000)
 
@@ -166,6 +2603,16 @@ const (
 	MetaRootOffsetIdx = 8
 	// Index of Node Version in serialized node
 	MetaEndSerializedOffset = 16
+	// Index of the file format version in serialized metadata
+	MetaFormatVersionIdx = 24
+	// Index of the latest commit timestamp in serialized metadata
+	MetaTimestampIdx = 32
+	// Index of the history start offset in serialized metadata
+	MetaHistoryStartIdx = 40
+	// Index of the key normalizer id in serialized metadata
+	MetaKeyNormalizerIdx = 48
+	// Total size of the serialized metadata, including reserved space
+	MetaSize = 64
 	// The current node version index in serialized node
 	NodeVersionIdx = 0
 	// Index of StartOffset in serialized node
@@ -176,23 +2623,37 @@ const (
 	NodeBitmapIdx = 18
 	// Index of IsLeaf in serialized node
 	NodeLeafOffsetIdx = 50
-	// Index of Children in serialized internal node
+	// Index of Children in serialized internal node, or of the subtree count if it is serialized
 	NodeChildrenIdx = 58
+	// Index of the subtree count in serialized internal node, which shifts the children by 8 bytes
+	NodeCountIdx = 58
+	// Index of Timestamp in serialized leaf node
+	NodeTimestampIdx = 18
 	// Index of Key Length in serialized node
-	NodeKeyLength = 18
+	NodeKeyLength = 26
 	// Index of Key in serialized leaf node node
-	NodeKeyIdx = 19
+	NodeKeyIdx = 27
+	// Index of Key Length in serialized leaf node of the legacy format, which has no timestamp
+	LegacyNodeKeyLength = 18
+	// Index of Key in serialized leaf node of the legacy format
+	LegacyNodeKeyIdx = 19
 	// OffsetSize for uint64 in serialized node
 	OffsetSize64 = 8
 	// Bitmap size in bytes since bitmap sis uint32
 	OffsetSize32 = 4
 	OffsetSize16 = 2
+	// Size of the value checksum at the end of a serialized leaf node, when the file has value checksums
+	NodeChecksumSize = 4
 	// Size of child pointers, where the pointers are uint64 offsets in the memory map
 	NodeChildPtrSize = 8
 	// Offset for the first version of root on Mari initialization
-	InitRootOffset = 24
+	InitRootOffset = 64
 	// 1 GB MaxResize
 	MaxResize = 1000000000
+	// Alignment of the buffers, offsets and lengths of direct I/O writes
+	DirectIOAlignment = 4096
+	// 1 MB buffer for direct I/O writes
+	DirectIOBufferSize = 1 << 20
 )
 
 const (
@@ -220,14 +2681,19 @@ const (
 		0 Version - 8 bytes
 		8 RootOffset - 8 bytes
 		16 EndMmapOffset - 8 bytes
+		24 FormatVersion - 8 bytes
+		32 Timestamp - 8 bytes
+		40 HistoryStartOffset - 8 bytes
+		48 Reserved - 16 bytes
 
 	[0-7, 8-15, 16-23, 24-27, 28, 29-92, 93+]
 	Node (Leaf):
 		0 Version - 8 bytes
 		8 StartOffset - 8 bytes
 		16 EndOffset - 2 bytes
-		18 KeyLength - 1 bytes, size of the key
-		19 Key - variable length
+		18 Timestamp - 8 bytes
+		26 KeyLength - 1 bytes, size of the key
+		27 Key - variable length
 
 
 	Node (Internal):
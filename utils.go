@@ -11,6 +11,13 @@ import (
 //
 //	Debugging function for printing nodes in the ordered array mapped trie.
 func (mariInst *Mari) PrintChildren() error {
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("PrintChildren"); stateErr != nil {
+		return stateErr
+	}
+
 	_, rootOffset, readRootOffErr := mariInst.loadMetaRootOffset()
 	if readRootOffErr != nil {
 		return readRootOffErr
@@ -30,13 +37,6 @@ func (mariInst *Mari) PrintChildren() error {
 	return nil
 }
 
-// calculateHammingWeight
-//
-//	Determines the total number of 1s in the binary representation of a number. 0s are ignored.
-func calculateHammingWeight(bitmap uint32) int {
-	return bits.OnesCount32(bitmap)
-}
-
 // extendTable
 //
 //	Utility function for dynamically expanding the child node array if a bit is set and a value needs to be inserted into the array.
@@ -58,49 +58,31 @@ func getIndexForLevel(key []byte, level int) byte {
 	return key[level]
 }
 
+// lowerBitsMask
+//
+//	The precomputed mask of the bits below each index in a sub bitmap, so positions are calculated without shifting.
+var lowerBitsMask = func() (masks [32]uint32) {
+	for idx := range masks {
+		masks[idx] = uint32(1)<<idx - 1
+	}
+
+	return masks
+}()
+
 // getPosition
 //
 //	Calculates the position in the child node array based on the sparse index and the current bitmap of internal node.
-//	The sparse index is calculated using the hash and bitchunk size.
-//	A mask is calculated by performing a bitwise left shift operation, which shifts the binary representation of the value 1 the number of positions associated with the sparse index value and then subtracts 1.
-//	This creates a binary number with all 1s to the right sparse index positions.
-//	The mask is then applied the bitmap and the resulting isolated bits are the 1s right of the sparse index.
-//	The hamming weight, or total bits right of the sparse index, is then calculated.
+//	The position is the total bits set before the sparse index, which is the population count of every preceding sub bitmap,
+//	plus the population count of the sub bitmap of the index masked to the bits below it.
+//	Population counts use math/bits, which compiles to a single instruction on platforms that support it.
 func getPosition(bitMap [8]uint32, index byte, level int) int {
 	subBitmapIndex := index >> 5
-	indexInSubBitmap := index & 0x1F
-	precedingSubBitmapsCount := 0
-
-	if subBitmapIndex-1 > 0 {
-		switch subBitmapIndex - 1 {
-		case 6:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[6])
-			fallthrough
-		case 5:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[5])
-			fallthrough
-		case 4:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[4])
-			fallthrough
-		case 3:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[3])
-			fallthrough
-		case 2:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[2])
-			fallthrough
-		case 1:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[1])
-			fallthrough
-		case 0:
-			precedingSubBitmapsCount += calculateHammingWeight(bitMap[0])
-		}
+	position := bits.OnesCount32(bitMap[subBitmapIndex] & lowerBitsMask[index&0x1F])
+	for _, subBitmap := range bitMap[:subBitmapIndex] {
+		position += bits.OnesCount32(subBitmap)
 	}
 
-	subBitmap := bitMap[subBitmapIndex]
-	mask := uint32((1 << uint32(indexInSubBitmap)) - 1)
-	isolatedBits := subBitmap & mask
-
-	return precedingSubBitmapsCount + calculateHammingWeight(isolatedBits)
+	return position
 }
 
 // isBitSet
@@ -118,17 +100,12 @@ func isBitSet(bitmap [8]uint32, index byte) bool {
 // populationCount
 //
 //	Determine the total population for the combination of all 8 32 bit bitmaps making up the 256 bit bitmap.
+//	The sub bitmaps are counted in pairs as 64 bit words, halving the population counts.
 func populationCount(bitmap [8]uint32) int {
 	popCount := 0
-
-	popCount += calculateHammingWeight(bitmap[7])
-	popCount += calculateHammingWeight(bitmap[6])
-	popCount += calculateHammingWeight(bitmap[5])
-	popCount += calculateHammingWeight(bitmap[4])
-	popCount += calculateHammingWeight(bitmap[3])
-	popCount += calculateHammingWeight(bitmap[2])
-	popCount += calculateHammingWeight(bitmap[1])
-	popCount += calculateHammingWeight(bitmap[0])
+	for idx := 0; idx < len(bitmap); idx += 2 {
+		popCount += bits.OnesCount64(uint64(bitmap[idx+1])<<32 | uint64(bitmap[idx]))
+	}
 
 	return popCount
 }
@@ -0,0 +1,90 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//============================================= Mari Validators
+
+// newValidators
+//
+//	Copy the validators passed in the instance options, normalizing their prefixes with the key normalizer of the instance, so a prefix matches the normalized keys it is compared against.
+//	Validators without a function are dropped.
+func (mariInst *Mari) newValidators(validators []*Validator) []*Validator {
+	var registered []*Validator
+	for _, validator := range validators {
+		if validator == nil || validator.Validate == nil {
+			continue
+		}
+
+		registered = append(registered, &Validator{Prefix: mariInst.normalizeKey(bytes.Clone(validator.Prefix)), Validate: validator.Validate})
+	}
+
+	return registered
+}
+
+// validate
+//
+//	Run the validators whose prefix the key starts with on a key-value pair written by Put or PutWithTTL, in the order they were registered.
+//	The first validator to fail rejects the write with a ValidationError, before the key-value pair is added to the transaction.
+func (mariInst *Mari) validate(key, value []byte) error {
+	for _, validator := range mariInst.validators {
+		if !bytes.HasPrefix(key, validator.Prefix) {
+			continue
+		}
+
+		validateErr := validator.Validate(key, value)
+		if validateErr != nil {
+			return &ValidationError{Prefix: validator.Prefix, Key: bytes.Clone(key), Err: validateErr}
+		}
+	}
+
+	return nil
+}
+
+// ValidJSON
+//
+//	Get a validator that accepts values that are a single valid JSON document nested at most maxDepth objects and arrays deep, where a maxDepth of 0 or less does not limit the depth.
+//	The value is scanned token by token, so a deeply nested document is rejected without being decoded.
+func ValidJSON(maxDepth int) ValidateFunc {
+	return func(key, value []byte) error {
+		decoder := json.NewDecoder(bytes.NewReader(value))
+
+		depth, tokens := 0, 0
+		for {
+			token, tokenErr := decoder.Token()
+			if errors.Is(tokenErr, io.EOF) {
+				break
+			}
+
+			if tokenErr != nil {
+				return fmt.Errorf("invalid json: %w", tokenErr)
+			}
+
+			tokens++
+			switch token {
+			case json.Delim('{'), json.Delim('['):
+				depth++
+				if maxDepth > 0 && depth > maxDepth {
+					return fmt.Errorf("json is nested more than %d deep", maxDepth)
+				}
+			case json.Delim('}'), json.Delim(']'):
+				depth--
+			}
+
+			if depth == 0 && decoder.More() {
+				return errors.New("invalid json: more than one document")
+			}
+		}
+
+		if tokens == 0 || depth != 0 {
+			return errors.New("invalid json: unexpected end of value")
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,289 @@
+package mariv2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//============================================= Mari Verify
+
+// Verify
+//
+//	Check the metadata and every node reachable from the root of the latest version for corruption.
+//	Every node is bounds checked as it is read, and the structure of the trie is checked as it is walked.
+//	A corrupt node is returned as a RegionError wrapping ErrCorrupt, with the offset of the node.
+//	In degraded mode, every corrupt subtree is quarantined and the walk continues, and the quarantined subtrees are returned joined.
+func (mariInst *Mari) Verify() error {
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Verify"); stateErr != nil {
+		return stateErr
+	}
+
+	root, verifyErr := mariInst.verifyRoot()
+	if verifyErr != nil {
+		return verifyErr
+	}
+
+	_, _, verifyErr = mariInst.verifyRecursive(root, 0, []byte{})
+	if verifyErr != nil || !mariInst.degraded {
+		return verifyErr
+	}
+
+	var quarantinedErrs []error
+	for _, quarantined := range mariInst.Quarantined() {
+		quarantinedErrs = append(quarantinedErrs, quarantined)
+	}
+
+	return errors.Join(quarantinedErrs...)
+}
+
+// VerifyFile
+//
+//	Open an existing file, check it for corruption, and close it, returning a report of the corruption found.
+//	The check validates the metadata and reads the root and each of its children. A deep check runs Verify on the latest version instead, which also validates the value checksums if the file has them.
+//	The file is opened as a follower in degraded mode with flushing disabled, so nothing is written to it and every corrupt subtree is reported instead of only the first.
+//	The options are used for the path, key normalizer, and I/O limiter of the file.
+//	Corruption is returned in the report, an error is only returned if the file could not be checked.
+func VerifyFile(opts InitOpts, deep bool) (*VerifyReport, error) {
+	start := time.Now()
+	report := &VerifyReport{File: filepath.Join(opts.Filepath, opts.FileName), Deep: deep, Issues: []*VerifyIssue{}}
+
+	fileInfo, statErr := os.Stat(report.File)
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	report.FileSize = fileInfo.Size()
+
+	follower := true
+	degraded := true
+	disableFlush := true
+	openValidation := OpenValidationRoot
+	if deep {
+		openValidation = OpenValidationFast
+	}
+
+	opts.Follower = &follower
+	opts.Degraded = &degraded
+	opts.DisableFlush = &disableFlush
+	opts.OpenValidation = &openValidation
+	opts.Anonymous = nil
+	opts.RemoveOnClose = nil
+	opts.AuditLog = nil
+
+	mariInst, openErr := Open(opts)
+	if openErr != nil {
+		issue := newVerifyIssue(nil, openErr)
+		if issue == nil {
+			return nil, openErr
+		}
+
+		report.Issues = []*VerifyIssue{issue}
+		report.DurationNs = time.Since(start).Nanoseconds()
+		return report, nil
+	}
+
+	defer mariInst.Close()
+
+	stats, statsErr := mariInst.Stats()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+
+	report.Version = stats.Version
+	report.FormatVersion = stats.FormatVersion
+	report.ValueChecksums = deep && mariInst.valueChecksums
+
+	if deep {
+		verifyErr := mariInst.Verify()
+		if verifyErr != nil && !errors.Is(verifyErr, ErrQuarantined) {
+			issue := newVerifyIssue(nil, verifyErr)
+			if issue == nil {
+				return nil, verifyErr
+			}
+
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	for _, quarantined := range mariInst.Quarantined() {
+		report.Issues = append(report.Issues, newVerifyIssue(quarantined.Prefix, quarantined))
+	}
+
+	report.OK = len(report.Issues) == 0
+	report.DurationNs = time.Since(start).Nanoseconds()
+	return report, nil
+}
+
+// newVerifyIssue
+//
+//	Create an issue for the region error wrapped in an error, or return nil if the error is not for a corrupt region.
+func newVerifyIssue(prefix []byte, issueErr error) *VerifyIssue {
+	var regionErr *RegionError
+	if !errors.As(issueErr, &regionErr) {
+		return nil
+	}
+
+	return &VerifyIssue{
+		Prefix:           hex.EncodeToString(prefix),
+		Offset:           regionErr.Offset,
+		Op:               regionErr.Op,
+		ChecksumMismatch: errors.Is(regionErr, ErrChecksumMismatch),
+		Reason:           regionErr.Reason,
+	}
+}
+
+// validateOnOpen
+//
+//	Check the file for corruption on open based on the validation mode.
+//	The fast mode trusts the metadata, which is already checked for the format version.
+//	In degraded mode, corrupt subtrees below the root are quarantined instead of failing the open.
+func (mariInst *Mari) validateOnOpen(mode OpenValidation) error {
+	switch mode {
+	case OpenValidationRoot:
+		root, validateErr := mariInst.verifyRoot()
+		if validateErr != nil {
+			return validateErr
+		}
+
+		pos := 0
+		for index := range 256 {
+			if !isBitSet(root.bitmap, byte(index)) {
+				continue
+			}
+
+			_, validateErr = mariInst.getChildNode(root, pos)
+			pos++
+			if validateErr != nil {
+				validateErr = mariInst.locateQuarantined([]byte{byte(index)}, validateErr)
+				if !errors.Is(validateErr, ErrQuarantined) {
+					return validateErr
+				}
+			}
+		}
+
+		return nil
+	case OpenValidationFull:
+		root, validateErr := mariInst.verifyRoot()
+		if validateErr != nil {
+			return validateErr
+		}
+
+		_, _, validateErr = mariInst.verifyRecursive(root, 0, []byte{})
+		return validateErr
+	default:
+		return nil
+	}
+}
+
+// verifyRoot
+//
+//	Check that the offsets in the metadata are within the serialized data, then read the root of the latest version.
+func (mariInst *Mari) verifyRoot() (*INode, error) {
+	var verifyErr error
+	mMap := mariInst.data.Load().(MMap)
+
+	_, endSerialized, verifyErr := mariInst.loadMetaEndSerialized()
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+
+	if endSerialized < InitRootOffset || endSerialized > uint64(len(mMap)) {
+		return nil, &RegionError{Op: "verify metadata", Offset: MetaEndSerializedOffset, Length: OffsetSize64, MapSize: uint64(len(mMap)), Reason: fmt.Sprintf("end of serialized data %d is outside of the memory map", endSerialized), Err: ErrCorrupt}
+	}
+
+	_, rootOffset, verifyErr := mariInst.loadMetaRootOffset()
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+
+	if rootOffset < InitRootOffset || rootOffset >= endSerialized {
+		return nil, &RegionError{Op: "verify metadata", Offset: MetaRootOffsetIdx, Length: OffsetSize64, MapSize: uint64(len(mMap)), Reason: fmt.Sprintf("root offset %d is outside of the serialized data", rootOffset), Err: ErrCorrupt}
+	}
+
+	historyStart, verifyErr := mariInst.loadMetaHistoryStart()
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+
+	if historyStart > endSerialized {
+		return nil, &RegionError{Op: "verify metadata", Offset: MetaHistoryStartIdx, Length: OffsetSize64, MapSize: uint64(len(mMap)), Reason: fmt.Sprintf("history start %d is past the end of the serialized data", historyStart), Err: ErrCorrupt}
+	}
+
+	return mariInst.readINodeFromMemMap(rootOffset)
+}
+
+// verifyRecursive
+//
+//	Walk the subtree of a node, checking that each child is no newer than its parent and that each leaf key is on the path to its node.
+//	If the file has subtree counts, the count of each node must match the keys in its subtree, and if it has value checksums, each leaf value must match its checksum.
+//	In degraded mode, a corrupt child is quarantined and skipped, and the counts of the node and its ancestors are not checked.
+//	Returns the total keys in the subtree, and whether every node in the subtree was walked.
+func (mariInst *Mari) verifyRecursive(node *INode, level int, prefix []byte) (uint64, bool, error) {
+	corrupt := func(node *INode, prefix []byte, reason string) error {
+		regionErr := &RegionError{Op: "verify", Offset: node.startOffset, Length: uint64(node.endOffset) + 1, MapSize: uint64(len(mariInst.data.Load().(MMap))), Reason: reason, Err: ErrCorrupt}
+		return mariInst.quarantineOnCorrupt(node.startOffset, prefix, regionErr)
+	}
+
+	mariInst.ioLimiter.wait(int(node.endOffset) + int(node.leaf.endOffset) + 2)
+
+	var count uint64
+	if len(node.leaf.key) > 0 {
+		if len(node.leaf.key) < level || !bytes.Equal(node.leaf.key[:level], prefix) {
+			return 0, false, corrupt(node, prefix, fmt.Sprintf("leaf key %q is not on the path to the node", node.leaf.key))
+		}
+
+		count++
+	}
+
+	if mariInst.valueChecksums {
+		checksumErr := mariInst.verifyChecksum(node.leaf)
+		if checksumErr != nil {
+			return 0, false, mariInst.quarantineOnCorrupt(node.startOffset, prefix, checksumErr)
+		}
+	}
+
+	complete := true
+	pos := 0
+	for index := range 256 {
+		if !isBitSet(node.bitmap, byte(index)) {
+			continue
+		}
+
+		childPrefix := append(append([]byte{}, prefix...), byte(index))
+		childNode, verifyErr := mariInst.getChildNode(node, pos)
+		pos++
+		if verifyErr == nil && childNode.version > node.version {
+			verifyErr = corrupt(childNode, childPrefix, fmt.Sprintf("child has version %d, which is newer than the parent version %d", childNode.version, node.version))
+		}
+
+		var childCount uint64
+		childComplete := false
+		if verifyErr == nil {
+			childCount, childComplete, verifyErr = mariInst.verifyRecursive(childNode, level+1, childPrefix)
+		}
+
+		if verifyErr != nil {
+			verifyErr = mariInst.locateQuarantined(childPrefix, verifyErr)
+			if !errors.Is(verifyErr, ErrQuarantined) {
+				return 0, false, verifyErr
+			}
+		}
+
+		count += childCount
+		complete = complete && childComplete
+	}
+
+	if mariInst.subtreeCounts && complete && node.count != count {
+		return 0, false, corrupt(node, prefix, fmt.Sprintf("subtree count is %d, but the subtree has %d keys", node.count, count))
+	}
+
+	return count, complete, nil
+}
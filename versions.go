@@ -0,0 +1,340 @@
+package mariv2
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//============================================= Mari Versions
+
+// ReadTxAtVersion
+//
+//	Handles read related operations on a previously committed version of Mari.
+//	Since nodes are never modified after being written, every version since the last compaction can still be read.
+//	If the version is not retained, ErrVersionNotFound is returned.
+func (mariInst *Mari) ReadTxAtVersion(version uint64, txOps func(tx *Tx) error) error {
+	if throttleErr := mariInst.readThrottle.take("ReadTxAtVersion"); throttleErr != nil {
+		return throttleErr
+	}
+
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("ReadTxAtVersion"); stateErr != nil {
+		return stateErr
+	}
+
+	entry, lookupErr := mariInst.lookupVersionEntry(version)
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	return mariInst.readTxAtOffset(entry.rootOffset, txOps)
+}
+
+// ReadTxAsOf
+//
+//	Handles read related operations on the latest version of Mari committed at or before a hybrid logical clock timestamp.
+//	Use HLCFromTime to query as of a wall clock time.
+//	If the timestamp is before the oldest retained version, ErrVersionNotFound is returned.
+func (mariInst *Mari) ReadTxAsOf(timestamp uint64, txOps func(tx *Tx) error) error {
+	if throttleErr := mariInst.readThrottle.take("ReadTxAsOf"); throttleErr != nil {
+		return throttleErr
+	}
+
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("ReadTxAsOf"); stateErr != nil {
+		return stateErr
+	}
+
+	entries, indexErr := mariInst.indexVersions()
+	if indexErr != nil {
+		return indexErr
+	}
+
+	idx := sort.Search(len(entries), func(i int) bool { return entries[i].timestamp > timestamp }) - 1
+	if idx < 0 {
+		return ErrVersionNotFound
+	}
+
+	return mariInst.readTxAtOffset(entries[idx].rootOffset, txOps)
+}
+
+// ReadTxAtLeast
+//
+//	Handles read related operations on the latest version of Mari, once the latest commit is at least a commit timestamp returned by tx.CommitTimestamp.
+//	Waits up to ReadAtLeastTimeout for the commit to be made, or for a follower to observe it, before returning ErrVersionNotReached.
+//	This gives read-after-write consistency to clients passing the timestamp of their last commit as a causality token.
+//	Timestamps increase with every commit and are kept by compaction, unlike versions, so a token issued before a compaction is already reached once it completes.
+func (mariInst *Mari) ReadTxAtLeast(timestamp uint64, txOps func(tx *Tx) error) error {
+	if txOps == nil {
+		return ErrNilTxOps
+	}
+
+	if throttleErr := mariInst.readThrottle.take("ReadTxAtLeast"); throttleErr != nil {
+		return throttleErr
+	}
+
+	versionChan, cancel := mariInst.VersionChan()
+	defer cancel()
+
+	timer := time.NewTimer(mariInst.readAtLeastTimeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(ReadAtLeastPollInterval)
+	defer ticker.Stop()
+
+	for {
+		reached, readErr := mariInst.readTxAtLeast(timestamp, txOps)
+		if reached || readErr != nil {
+			return readErr
+		}
+
+		select {
+		case _, ok := <-versionChan:
+			if !ok {
+				versionChan = nil
+			}
+		case <-ticker.C:
+		case <-timer.C:
+			return ErrVersionNotReached
+		}
+	}
+}
+
+// readTxAtLeast
+//
+//	Perform the read only transaction on the latest root if it was committed at or after the timestamp, returning whether it was reached.
+//	The timestamp stamped on the root leaf is checked instead of the timestamp in the metadata, since the timestamp is updated before the root offset on commit.
+func (mariInst *Mari) readTxAtLeast(timestamp uint64, txOps func(tx *Tx) error) (bool, error) {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("ReadTxAtLeast"); stateErr != nil {
+		return false, stateErr
+	}
+
+	_, rootOffset, loadErr := mariInst.loadMetaRootOffset()
+	if loadErr != nil {
+		return false, loadErr
+	}
+
+	currRoot, readErr := mariInst.readINodeFromMemMap(rootOffset)
+	if readErr != nil {
+		return false, readErr
+	}
+
+	if currRoot.leaf.timestamp < timestamp {
+		return false, nil
+	}
+
+	return true, mariInst.readTxAtOffset(rootOffset, txOps)
+}
+
+// Versions
+//
+//	List every retained version of the root, oldest first, with its commit timestamp, the bytes written by its commit, and the open readers and iterators pinning it.
+//	Versions are retained until compaction rewrites the file with only the latest version, which is blocked while any reader is open, so pinned versions show why space is not being reclaimed.
+func (mariInst *Mari) Versions() ([]VersionInfo, error) {
+	for atomic.LoadUint32(&mariInst.isResizing) == 1 {
+		runtime.Gosched()
+	}
+
+	mariInst.rwResizeLock.RLock()
+	defer mariInst.rwResizeLock.RUnlock()
+
+	if stateErr := mariInst.checkOpen("Versions"); stateErr != nil {
+		return nil, stateErr
+	}
+
+	entries, indexErr := mariInst.indexVersions()
+	if indexErr != nil {
+		return nil, indexErr
+	}
+
+	readers := mariInst.readPins.snapshot()
+	iterators := mariInst.PinnedVersions()
+
+	versions := make([]VersionInfo, len(entries))
+	for idx, entry := range entries {
+		endOffset, sizeErr := mariInst.versionEndOffset(entries, idx)
+		if sizeErr != nil {
+			return nil, sizeErr
+		}
+
+		versions[idx] = VersionInfo{
+			Version:    entry.version,
+			Timestamp:  entry.timestamp,
+			RootOffset: entry.rootOffset,
+			Size:       endOffset - entry.rootOffset,
+			Readers:    readers[entry.version],
+			Iterators:  iterators[entry.version],
+		}
+
+		versions[idx].Pinned = versions[idx].Readers > 0 || versions[idx].Iterators > 0
+	}
+
+	return versions, nil
+}
+
+// versionEndOffset
+//
+//	Determine the end of the bytes written for an indexed version, which is the root of the next version.
+//	The first version is followed by the history start, and the path copy of the latest version is walked to find its end.
+//	The resize read lock must be held by the caller.
+func (mariInst *Mari) versionEndOffset(entries []versionEntry, idx int) (uint64, error) {
+	if idx+1 < len(entries) {
+		return entries[idx+1].rootOffset, nil
+	}
+
+	if idx == 0 {
+		return mariInst.loadMetaHistoryStart()
+	}
+
+	root, readErr := mariInst.readINodeFromMemMap(entries[idx].rootOffset)
+	if readErr != nil {
+		return 0, readErr
+	}
+
+	return mariInst.pathEndOffset(root, entries[idx].rootOffset)
+}
+
+// indexVersions
+//
+//	Extend the version index up to the latest committed root and return the indexed versions.
+//	Each commit appends its path copy directly after the previous one, so the next root is located at the end of the current path copy.
+//	The first entry is the initial or compacted root, and the walk continues from the history start offset since a compacted root is followed by the entire trie.
+//	The resize read lock must be held by the caller.
+func (mariInst *Mari) indexVersions() ([]versionEntry, error) {
+	index := mariInst.versions
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	var indexErr error
+	_, rootOffset, indexErr := mariInst.loadMetaRootOffset()
+	if indexErr != nil {
+		return nil, indexErr
+	}
+
+	if len(index.entries) == 0 {
+		initRoot, indexErr := mariInst.readINodeFromMemMap(InitRootOffset)
+		if indexErr != nil {
+			return nil, indexErr
+		}
+
+		historyStart, indexErr := mariInst.loadMetaHistoryStart()
+		if indexErr != nil {
+			return nil, indexErr
+		}
+
+		index.entries = append(index.entries, versionEntry{version: initRoot.version, rootOffset: InitRootOffset, timestamp: initRoot.leaf.timestamp})
+		index.nextOffset = historyStart
+	}
+
+	for index.nextOffset <= rootOffset {
+		root, indexErr := mariInst.readINodeFromMemMap(index.nextOffset)
+		if indexErr != nil {
+			return nil, indexErr
+		}
+
+		endOffset, indexErr := mariInst.pathEndOffset(root, index.nextOffset)
+		if indexErr != nil {
+			return nil, indexErr
+		}
+
+		index.entries = append(index.entries, versionEntry{version: root.version, rootOffset: index.nextOffset, timestamp: root.leaf.timestamp})
+		index.nextOffset = endOffset
+	}
+
+	return index.entries, nil
+}
+
+// lookupVersionEntry
+//
+//	Get the root offset and timestamp of a retained version from the version index, returning ErrVersionNotFound if it is not retained.
+//	The resize read lock must be held by the caller.
+func (mariInst *Mari) lookupVersionEntry(version uint64) (versionEntry, error) {
+	entries, indexErr := mariInst.indexVersions()
+	if indexErr != nil {
+		return versionEntry{}, indexErr
+	}
+
+	idx := sort.Search(len(entries), func(i int) bool { return entries[i].version >= version })
+	if idx == len(entries) || entries[idx].version != version {
+		return versionEntry{}, ErrVersionNotFound
+	}
+
+	return entries[idx], nil
+}
+
+// pathEndOffset
+//
+//	Determine the end of a serialized path copy by following the children written in the same path copy, which are located after the path start.
+func (mariInst *Mari) pathEndOffset(node *INode, pathStart uint64) (uint64, error) {
+	endOffset := node.leaf.getEndOffsetLNode() + 1
+	for _, child := range node.children {
+		if child.startOffset < pathStart {
+			continue
+		}
+
+		childNode, readErr := mariInst.readINodeFromMemMap(child.startOffset)
+		if readErr != nil {
+			return 0, readErr
+		}
+
+		childEndOffset, readErr := mariInst.pathEndOffset(childNode, pathStart)
+		if readErr != nil {
+			return 0, readErr
+		}
+
+		endOffset = max(endOffset, childEndOffset)
+	}
+
+	return endOffset, nil
+}
+
+// reset
+//
+//	Clear the version index, which is required when compaction rewrites the file.
+func (index *versionIndex) reset() {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	index.entries = nil
+	index.nextOffset = 0
+}
+
+// encodeVersionEntry
+//
+//	Encode a version and its timestamp, like the acked version of a durable changefeed cursor.
+//	Compaction resets the versions, so the timestamp detects a version recorded before compaction.
+func encodeVersionEntry(entry versionEntry) []byte {
+	encoded := make([]byte, 16)
+	binary.BigEndian.PutUint64(encoded[:8], entry.version)
+	binary.BigEndian.PutUint64(encoded[8:], entry.timestamp)
+	return encoded
+}
+
+// decodeVersionEntry
+//
+//	Decode a version and its timestamp encoded with encodeVersionEntry.
+func decodeVersionEntry(encoded []byte) versionEntry {
+	return versionEntry{version: binary.BigEndian.Uint64(encoded[:8]), timestamp: binary.BigEndian.Uint64(encoded[8:])}
+}